@@ -7,6 +7,8 @@ programDir=`ReadINIfile "$configFile" "rpstir2-rp" "programDir" `
 serverHost=`ReadINIfile "$configFile" "rpstir2-rp" "serverHost" `
 serverHttpsPort=`ReadINIfile "$configFile" "rpstir2-rp" "serverHttpsPort" `
 serverHttpPort=`ReadINIfile "$configFile" "rpstir2-rp" "serverHttpPort" `
+vcServerHost=`ReadINIfile "$configFile" "rpstir2-vc" "serverHost" `
+vcServerHttpsPort=`ReadINIfile "$configFile" "rpstir2-vc" "serverHttpsPort" `
 #echo  ${serverHost}":"${serverHttpsPort}
 
 function startFunc()
@@ -86,7 +88,25 @@ function helpFunc()
     echo -e "./rpstir2.sh state\t\t(need start first) when it shows 'isRunning:false', it means that synchronization and validation processes are completed." 
     echo -e "./rpstir2.sh results\t\t(need start first) shows the valid, warning and invalid number of cer, roa, mft and crl respectively."
     echo -e "./rpstir2.sh exportroas\t\t(need start first) export all roas which are valid or warning."
+    echo -e "./rpstir2.sh exportvrps {format} {file} [tals]\t(need start first) export current VRPs/ASPAs as json/csv/openbgpd/bird2/rfc8416 to file, tals such as 'apnic,ripe'."
     echo -e "./rpstir2.sh parse {file}\t(need start first) parse uploads file(*.cer/*.crl/*.mft/*.roa/*.sig/*.asa)"
+    echo -e "./rpstir2.sh rovimpact {file}\t(need start first) analyze ROV and ASPA impact of uploads MRT TABLE_DUMP_V2 file(may be .gz/.bz2)."
+    echo -e "./rpstir2.sh irrreport {file}\t(need start first) compare IRR route/route6 objects of uploads RPSL file(may be .gz) with VRPs, as csv."
+    echo -e "./rpstir2.sh slurmupload {file}\t(need start first) validate and save uploads SLURM file, it will not be active until 'slurmactivate'."
+    echo -e "./rpstir2.sh slurmlint {file}\t(need start first) dry run SLURM file against current VRPs/ASPAs, nothing is saved."
+    echo -e "./rpstir2.sh slurmactivate {slurmLogId} [comment]\t(need start first) activate the uploaded SLURM as a new revision, and generate new RTR serial."
+    echo -e "./rpstir2.sh slurmdeactivate {slurmLogId} [comment]\t(need start first) deactivate the active SLURM as a new revision, and generate new RTR serial."
+    echo -e "./rpstir2.sh slurmlist\t\t(need start first) list all uploaded SLURM and their states."
+    echo -e "./rpstir2.sh slurmrevisions\t(need start first) list all revisions of active SLURM."
+    echo -e "./rpstir2.sh slurmdiff {fromRevisionId} {toRevisionId}\t(need start first) show changed SLURM entries and VRPs between two revisions."
+    echo -e "./rpstir2.sh slurmrollback {revisionId} [comment]\t(need start first) make the revision active again as a new revision, and generate new RTR serial."
+    echo -e "./rpstir2.sh brakerelease {newSerialNumber} [note]\t(need start first) release safety brake, and publish the held RTR serial."
+    echo -e "./rpstir2.sh brakediscard {newSerialNumber} [note]\t(need start first) discard the RTR serial held by safety brake, and keep the previous serial."
+    echo -e "./rpstir2.sh historyserials\t(need start first) list all retained RTR serials and their VRP/ASPA counts."
+    echo -e "./rpstir2.sh historyvrps {serialNumber}\t(need start first) get VRPs/ASPAs at the retained RTR serial."
+    echo -e "./rpstir2.sh historydiff {fromSerialNumber} {toSerialNumber}\t(need start first) show announced and withdrawn VRPs/ASPAs between two RTR serials, and their ROA files."
+    echo -e "./rpstir2.sh provenance {prefix} {asn} [maxLength]\t(need start first) show every source of the VRP: SLURM, or ROA file with EE cert and CA chain up to TAL."
+    echo -e "./rpstir2.sh provenanceaspa {customerAsn}\t(need start first) show every source of the ASPAs of the customer ASN."
     echo -e "./rpstir2.sh help\t\tshow this help."
 }
 
@@ -150,6 +170,15 @@ case $1 in
     curl -s -k -d '' -H "Content-type: application/json" -X POST https://$serverHost:$serverHttpsPort/sys/exportroas
     echo -e "\n"
     ;;  
+  exportvrps)
+    # ./rpstir2.sh exportvrps openbgpd /etc/bgpd/roa.conf apnic,ripe
+    tals=""
+    if [ -n "$4" ]; then
+      tals=",\"tals\":[\"${4//,/\",\"}\"]"
+    fi
+    curl -s -k -d "{\"format\":\"${2}\"${tals}}" -H "Content-type: application/json" -X POST https://$serverHost:$serverHttpsPort/sys/exportvrps -o "${3}"
+    echo -e "\n"
+    ;;  
   parse) 
     #echo "parse upload file"
     #echo ${serverHost}":"${serverHttpsPort}
@@ -157,6 +186,85 @@ case $1 in
     curl -s -k -F "file=@${2}" http://$serverHost:$serverHttpPort/parsevalidate/parsefile
     echo -e "\n"
     ;;  
+  rovimpact) 
+    #echo "analyze rov and aspa impact of upload mrt file"
+    #echo ${serverHost}":"${serverHttpsPort}
+    checkFile $2
+    curl -s -k -F "file=@${2}" https://$serverHost:$serverHttpsPort/rov/impactanalysis
+    echo -e "\n"
+    ;;  
+
+  irrreport) 
+    #echo "compare irr route objects of upload rpsl file with vrps"
+    #echo ${serverHost}":"${serverHttpsPort}
+    checkFile $2
+    curl -s -k -F "file=@${2}" "https://$serverHost:$serverHttpsPort/rov/irrreport?format=csv"
+    echo -e "\n"
+    ;;  
+
+  slurmupload) 
+    checkFile $2
+    curl -s -k -F "file=@${2}" https://$vcServerHost:$vcServerHttpsPort/rtrproducer/slurm/upload
+    echo -e "\n"
+    ;;  
+  slurmlint) 
+    checkFile $2
+    curl -s -k -F "file=@${2}" https://$vcServerHost:$vcServerHttpsPort/rtrproducer/slurm/lint
+    echo -e "\n"
+    ;;  
+  slurmactivate) 
+    curl -s -k -d "{\"slurmLogId\":${2},\"author\":\"${USER}\",\"comment\":\"${3}\"}" -H "Content-type: application/json" -X POST https://$vcServerHost:$vcServerHttpsPort/rtrproducer/slurm/activate
+    echo -e "\n"
+    ;;  
+  slurmdeactivate) 
+    curl -s -k -d "{\"slurmLogId\":${2},\"author\":\"${USER}\",\"comment\":\"${3}\"}" -H "Content-type: application/json" -X POST https://$vcServerHost:$vcServerHttpsPort/rtrproducer/slurm/deactivate
+    echo -e "\n"
+    ;;  
+  slurmlist) 
+    curl -s -k -d '' -X POST https://$vcServerHost:$vcServerHttpsPort/rtrproducer/slurm/list
+    echo -e "\n"
+    ;;  
+  slurmrevisions) 
+    curl -s -k -d '' -X POST https://$vcServerHost:$vcServerHttpsPort/rtrproducer/slurm/revision/list
+    echo -e "\n"
+    ;;  
+  slurmdiff) 
+    curl -s -k -d "{\"fromRevisionId\":${2},\"toRevisionId\":${3}}" -H "Content-type: application/json" -X POST https://$vcServerHost:$vcServerHttpsPort/rtrproducer/slurm/revision/diff
+    echo -e "\n"
+    ;;  
+  slurmrollback) 
+    curl -s -k -d "{\"revisionId\":${2},\"author\":\"${USER}\",\"comment\":\"${3}\"}" -H "Content-type: application/json" -X POST https://$vcServerHost:$vcServerHttpsPort/rtrproducer/slurm/rollback
+    echo -e "\n"
+    ;;  
+  brakerelease) 
+    curl -s -k -d "{\"newSerialNumber\":${2},\"note\":\"${3}\"}" -H "Content-type: application/json" -X POST https://$vcServerHost:$vcServerHttpsPort/rtrproducer/brake/release
+    echo -e "\n"
+    ;;  
+  brakediscard) 
+    curl -s -k -d "{\"newSerialNumber\":${2},\"note\":\"${3}\"}" -H "Content-type: application/json" -X POST https://$vcServerHost:$vcServerHttpsPort/rtrproducer/brake/discard
+    echo -e "\n"
+    ;;  
+  historyserials) 
+    curl -s -k -d '' -X POST https://$vcServerHost:$vcServerHttpsPort/rtrproducer/history/serials
+    echo -e "\n"
+    ;;  
+  historyvrps) 
+    curl -s -k -d "{\"serialNumber\":${2}}" -H "Content-type: application/json" -X POST https://$vcServerHost:$vcServerHttpsPort/rtrproducer/history/vrps
+    echo -e "\n"
+    ;;  
+  historydiff) 
+    curl -s -k -d "{\"fromSerialNumber\":${2},\"toSerialNumber\":${3}}" -H "Content-type: application/json" -X POST https://$vcServerHost:$vcServerHttpsPort/rtrproducer/history/diff
+    echo -e "\n"
+    ;;  
+
+  provenance)
+    curl -s -k -d "{\"prefix\":\"${2}\",\"asn\":${3},\"maxLength\":${4:-0}}" -H "Content-type: application/json" -X POST https://$vcServerHost:$vcServerHttpsPort/rtrproducer/provenance
+    echo -e "\n"
+    ;;
+  provenanceaspa)
+    curl -s -k -d "{\"customerAsn\":${2}}" -H "Content-type: application/json" -X POST https://$vcServerHost:$vcServerHttpsPort/rtrproducer/provenance
+    echo -e "\n"
+    ;;
 
   help)
     helpFunc
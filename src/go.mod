@@ -11,6 +11,7 @@ replace (
 	rpstir2-parsevalidate-db => ./rpstir2-parsevalidate-db
 	rpstir2-parsevalidate-openssl => ./rpstir2-parsevalidate-openssl
 	rpstir2-parsevalidate-packet => ./rpstir2-parsevalidate-packet
+	rpstir2-rov => ./rpstir2-rov
 	rpstir2-rtrclient => ./rpstir2-rtrclient
 	rpstir2-rtrproducer => ./rpstir2-rtrproducer
 	rpstir2-rtrserver => ./rpstir2-rtrserver
@@ -24,10 +25,13 @@ replace (
 require (
 	rpstir2-chainvalidate v0.0.0-00010101000000-000000000000
 	rpstir2-clear v0.0.0-00010101000000-000000000000
+	rpstir2-model v1.0.1-0.20230602021126-da8e9d252004
 	rpstir2-parsevalidate-centralized v0.0.0-00010101000000-000000000000
+	rpstir2-rov v0.0.0-00010101000000-000000000000
 	rpstir2-rtrclient v0.0.0-00010101000000-000000000000
 	rpstir2-rtrproducer v0.0.0-00010101000000-000000000000
 	rpstir2-rtrserver v0.0.0-00010101000000-000000000000
+	rpstir2-sync-core v0.0.0-00010101000000-000000000000
 	rpstir2-sync-entire v0.0.0-00010101000000-000000000000
 	rpstir2-sync-tal v0.0.0-00010101000000-000000000000
 	rpstir2-sys v0.0.0-00010101000000-000000000000
@@ -36,12 +40,10 @@ require (
 require (
 	github.com/chenzhuoyu/iasm v0.9.0 // indirect
 	github.com/google/go-cmp v0.5.9 // indirect
-	rpstir2-model v1.0.1-0.20230602021126-da8e9d252004 // indirect
 	rpstir2-parsevalidate-core v0.0.0-00010101000000-000000000000 // indirect
 	rpstir2-parsevalidate-db v0.0.0-00010101000000-000000000000 // indirect
 	rpstir2-parsevalidate-openssl v0.0.0-00010101000000-000000000000 // indirect
 	rpstir2-parsevalidate-packet v0.0.0-00010101000000-000000000000 // indirect
-	rpstir2-sync-core v0.0.0-00010101000000-000000000000 // indirect
 )
 
 require (
@@ -83,5 +85,5 @@ require (
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 	moul.io/http2curl v1.0.0 // indirect
 	xorm.io/builder v0.3.13 // indirect
-	xorm.io/xorm v1.3.2 // indirect
+	xorm.io/xorm v1.3.2
 )
@@ -1,11 +1,14 @@
 package chainvalidate
 
 import (
+	"io"
+
 	"github.com/cpusoft/goutil/belogs"
 	conf "github.com/cpusoft/goutil/conf"
 	"github.com/cpusoft/goutil/ginserver"
 	"github.com/cpusoft/goutil/httpclient"
 	"github.com/gin-gonic/gin"
+	model "rpstir2-model"
 )
 
 // upload file to parse
@@ -15,6 +18,15 @@ func ChainValidateStart(c *gin.Context) {
 	rpstir2VcUrl := "https://" + conf.String("rpstir2-vc::serverHost") + ":" + conf.String("rpstir2-vc::serverHttpsPort")
 	belogs.Info("ChainValidateStart(): start,  rpstir2Url:", rpstir2Url, "   rpstir2VcUrl:", rpstir2VcUrl)
 
+	// body is empty, or is set by replay sync
+	replayStepModel := model.ReplayStepModel{}
+	err := c.ShouldBindJSON(&replayStepModel)
+	if err != nil && err != io.EOF {
+		belogs.Error("ChainValidateStart(): ShouldBindJSON:", err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+
 	//check serviceState
 	httpclient.Post(rpstir2Url+"/sys/servicestate", `{"operate":"enter","state":"chainvalidate"}`, false)
 
@@ -26,6 +38,10 @@ func ChainValidateStart(c *gin.Context) {
 			// will end this whole sync
 			belogs.Error("ChainValidateStart():  chainValidateStart fail", err)
 			httpclient.Post(rpstir2Url+"/sys/servicestate", `{"operate":"leave","state":"end"}`, false)
+		} else if replayStepModel.SkipRtr {
+			// replay sync may keep current rtr
+			httpclient.Post(rpstir2Url+"/sys/servicestate", `{"operate":"leave","state":"end"}`, false)
+			belogs.Info("ChainValidateStart(): end of replay with skipRtr, will not update rtr,  nextStep is :", nextStep)
 		} else {
 			// leave serviceState
 			httpclient.Post(rpstir2Url+"/sys/servicestate", `{"operate":"leave","state":"chainvalidate"}`, false)
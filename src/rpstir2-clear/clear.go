@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/conf"
 )
 
 func clearStart() {
@@ -24,12 +25,12 @@ func clearRtr() {
 		belogs.Debug("clearRtr():serialNumber fail:", err)
 		return
 	}
-	deleteSerialNumber := serialNumber - 24
-	belogs.Info("clearRtr():serialNumber:", serialNumber, "   deleteSerialNumber:", deleteSerialNumber)
-	if serialNumber <= 24 {
-		belogs.Info("clearRtr():  serialNumber <= 24:", serialNumber, " time(s):", time.Since(start))
+	deleteSerialNumber, err := getRtrDeleteSerialNumber(serialNumber)
+	if err != nil {
+		belogs.Error("clearRtr():getRtrDeleteSerialNumber fail:", serialNumber, err)
 		return
 	}
+	belogs.Info("clearRtr():serialNumber:", serialNumber, "   deleteSerialNumber:", deleteSerialNumber)
 	if deleteSerialNumber <= 0 {
 		belogs.Info("clearRtr(): deleteSerialNumber <= 0:", deleteSerialNumber, " time(s):", time.Since(start))
 		return
@@ -48,5 +49,53 @@ func clearRtr() {
 		belogs.Error("clearRtr():clearRtrFullLogRtrIncremet lab_rpki_rtr_full_log fail:deleteSerialNumber:", deleteSerialNumber, err)
 		// no return
 	}
+
+	// delete too old from router_key and asa incremental/full_log
+	for _, tableName := range []string{"lab_rpki_rtr_router_key_incremental", "lab_rpki_rtr_router_key_full_log",
+		"lab_rpki_rtr_asa_incremental", "lab_rpki_rtr_asa_full_log"} {
+		err = clearRtrFullLogRtrIncremet(tableName, deleteSerialNumber)
+		if err != nil {
+			belogs.Error("clearRtr():clearRtrFullLogRtrIncremet "+tableName+" fail:deleteSerialNumber:", deleteSerialNumber, err)
+			// no return
+		}
+	}
 	belogs.Info("clearRtr(): end, time(s):", time.Since(start))
 }
+
+// keep the last retainSerialCount serials, and all serials created within retainDays when retainDays > 0
+func getRtrDeleteSerialNumber(serialNumber int) (deleteSerialNumber int, err error) {
+	retainSerialCount := conf.Int("rtr::retainSerialCount")
+	if retainSerialCount <= 0 {
+		retainSerialCount = 24
+	}
+	deleteSerialNumber = serialNumber - retainSerialCount
+	retainDays := conf.Int("rtr::retainDays")
+	belogs.Debug("getRtrDeleteSerialNumber():serialNumber:", serialNumber, "  retainSerialCount:", retainSerialCount,
+		"  retainDays:", retainDays)
+	if deleteSerialNumber <= 0 {
+		return deleteSerialNumber, nil
+	}
+
+	if retainDays > 0 {
+		minSerialNumber, has, err := getMinSerialNumberAfterTimeDb(time.Now().AddDate(0, 0, -retainDays))
+		if err != nil {
+			belogs.Error("getRtrDeleteSerialNumber():getMinSerialNumberAfterTimeDb fail:", retainDays, err)
+			return 0, err
+		}
+		if has && minSerialNumber < deleteSerialNumber {
+			deleteSerialNumber = minSerialNumber
+		}
+	}
+
+	// rtr_full_log only keeps checkpoints, so the checkpoint before retained serials should be kept too,
+	// retained serials are rebuilt from it and incrementals
+	checkpointSerialNumber, has, err := getRtrFullLogCheckpointBeforeDb(deleteSerialNumber)
+	if err != nil {
+		belogs.Error("getRtrDeleteSerialNumber():getRtrFullLogCheckpointBeforeDb fail:", deleteSerialNumber, err)
+		return 0, err
+	}
+	if has {
+		deleteSerialNumber = checkpointSerialNumber
+	}
+	return deleteSerialNumber, nil
+}
@@ -155,3 +155,27 @@ func getMaxSerialNumberDb() (serialNumber int, has bool, err error) {
 	belogs.Info("getMaxSerialNumberDb():max(serialNumber):", serialNumber)
 	return serialNumber, has, nil
 }
+
+// the first serialNumber which is created not earlier than t
+func getMinSerialNumberAfterTimeDb(t time.Time) (serialNumber int, has bool, err error) {
+	sql := `select serialNumber from lab_rpki_rtr_serial_number where createTime >= ? order by id limit 1`
+	has, err = xormdb.XormEngine.SQL(sql, t).Get(&serialNumber)
+	if err != nil {
+		belogs.Error("getMinSerialNumberAfterTimeDb():select serialNumber from lab_rpki_rtr_serial_number fail:", t, err)
+		return serialNumber, false, err
+	}
+	belogs.Debug("getMinSerialNumberAfterTimeDb(): t:", t, "  serialNumber:", serialNumber, "  has:", has)
+	return serialNumber, has, nil
+}
+
+// the latest serialNumber in lab_rpki_rtr_full_log which is not later than serialNumber
+func getRtrFullLogCheckpointBeforeDb(serialNumber int) (checkpointSerialNumber int, has bool, err error) {
+	sql := `select serialNumber from lab_rpki_rtr_full_log where serialNumber <= ? order by serialNumber desc limit 1`
+	has, err = xormdb.XormEngine.SQL(sql, serialNumber).Get(&checkpointSerialNumber)
+	if err != nil {
+		belogs.Error("getRtrFullLogCheckpointBeforeDb():select serialNumber from lab_rpki_rtr_full_log fail:", serialNumber, err)
+		return 0, false, err
+	}
+	belogs.Debug("getRtrFullLogCheckpointBeforeDb(): serialNumber:", serialNumber, "  checkpointSerialNumber:", checkpointSerialNumber, "  has:", has)
+	return checkpointSerialNumber, has, nil
+}
@@ -202,6 +202,41 @@ type LabRpkiSyncLogFile struct {
 	State     string    `json:"state" xorm:"state json"`                //LabRpkiSyncLogFileState:
 }
 
+// lab_rpki_slurm_log
+type LabRpkiSlurmLog struct {
+	Id uint64 `json:"id" xorm:"pk autoincr"`
+	//uploaded/active/inactive
+	State          string    `json:"state" xorm:"state varchar(16)"`
+	UploadTime     time.Time `json:"uploadTime" xorm:"uploadTime datetime"`
+	ActivateTime   null.Time `json:"activateTime" xorm:"activateTime datetime"`
+	DeactivateTime null.Time `json:"deactivateTime" xorm:"deactivateTime datetime"`
+	Note           string    `json:"note" xorm:"note varchar(512)"`
+}
+
+// lab_rpki_slurm_log_file
+type LabRpkiSlurmLogFile struct {
+	Id           uint64 `json:"id" xorm:"pk autoincr"`
+	SlurmLogId   uint64 `json:"slurmLogId" xorm:"slurmLogId int"`
+	FileName     string `json:"fileName" xorm:"fileName varchar(128)"`
+	FileHash     string `json:"fileHash" xorm:"fileHash varchar(512)"`
+	SlurmVersion uint64 `json:"slurmVersion" xorm:"slurmVersion int"`
+	JsonAll      string `json:"jsonAll" xorm:"jsonAll json"`
+}
+
+// lab_rpki_slurm_revision, only insert
+type LabRpkiSlurmRevision struct {
+	Id uint64 `json:"id" xorm:"pk autoincr"`
+	//activate/deactivate/rollback
+	Action             string    `json:"action" xorm:"action varchar(16)"`
+	SlurmLogId         null.Int  `json:"slurmLogId" xorm:"slurmLogId int"`
+	RollbackRevisionId null.Int  `json:"rollbackRevisionId" xorm:"rollbackRevisionId int"`
+	Author             string    `json:"author" xorm:"author varchar(256)"`
+	Comment            string    `json:"comment" xorm:"comment varchar(1024)"`
+	RevisionTime       time.Time `json:"revisionTime" xorm:"revisionTime datetime"`
+	ActiveSlurmLogIds  string    `json:"activeSlurmLogIds" xorm:"activeSlurmLogIds json"`
+	Entries            string    `json:"entries" xorm:"entries json"`
+}
+
 type LabRpkiSyncLogFileState struct {
 	//finished
 	Sync string `json:"sync"`
@@ -342,6 +377,38 @@ type LabRpkiRtrAsaIncremental struct {
 	SourceFrom string `json:"sourceFrom" xorm:"sourceFrom json"`
 }
 
+// lab_rpki_rtr_router_key_full
+// ski and routerPublicKey are base64url, the same as in slurm
+type LabRpkiRtrRouterKeyFull struct {
+	Id              uint64 `json:"id" xorm:"id int"`
+	SerialNumber    uint64 `json:"serialNumber" xorm:"serialNumber int"`
+	Asn             uint64 `json:"asn" xorm:"asn int"`
+	Ski             string `json:"ski" xorm:"ski varchar(128)"`
+	RouterPublicKey string `json:"routerPublicKey" xorm:"routerPublicKey varchar(512)"`
+	SourceFrom      string `json:"sourceFrom" xorm:"sourceFrom json"`
+}
+
+type LabRpkiRtrRouterKeyFullLog struct {
+	Id              uint64 `json:"id" xorm:"id int"`
+	SerialNumber    uint64 `json:"serialNumber" xorm:"serialNumber int"`
+	Asn             uint64 `json:"asn" xorm:"asn int"`
+	Ski             string `json:"ski" xorm:"ski varchar(128)"`
+	RouterPublicKey string `json:"routerPublicKey" xorm:"routerPublicKey varchar(512)"`
+	SourceFrom      string `json:"sourceFrom" xorm:"sourceFrom json"`
+}
+
+// lab_rpki_rtr_router_key_incremental
+type LabRpkiRtrRouterKeyIncremental struct {
+	Id           uint64 `json:"id" xorm:"id int"`
+	SerialNumber uint64 `json:"serialNumber" xorm:"serialNumber bigint"`
+	//announce/withdraw, is 1/0 in protocol
+	Style           string `json:"style" xorm:"style varchar(16)"`
+	Asn             uint64 `json:"asn" xorm:"asn int"`
+	Ski             string `json:"ski" xorm:"ski varchar(128)"`
+	RouterPublicKey string `json:"routerPublicKey" xorm:"routerPublicKey varchar(512)"`
+	SourceFrom      string `json:"sourceFrom" xorm:"sourceFrom json"`
+}
+
 type LabRpkiRtrSourceFrom struct {
 	// sync/slurm/rushtransfer
 	Source           string `json:"source"`
@@ -370,6 +437,9 @@ type SlurmToRtrFullLog struct {
 	ProviderAsn   null.Int `json:"providerAsn" xorm:"providerAsn int"`
 	AddressFamily string   `json:"addressFamily" xorm:"addressFamily varchar(16)"`
 
+	Ski             string `json:"ski" xorm:"ski varchar(256)"`
+	RouterPublicKey string `json:"routerPublicKey" xorm:"routerPublicKey varchar(256)"`
+
 	SlurmId        uint64 `json:"slurmId" xorm:"slurmId int"`
 	SlurmLogId     uint64 `json:"slurmLogId" xorm:"slurmLogId int"`
 	SlurmLogFileId uint64 `json:"slurmLogFileId" xorm:"slurmLogFileId int"`
@@ -387,6 +457,64 @@ type LabRpkiSyncRrdpLog struct {
 	LastSerial uint64    `json:"lastSerial" xorm:"lastSerial int"`
 	CurSerial  uint64    `json:"curSerial" xorm:"curSerial int"`
 	RrdpTime   time.Time `json:"rrdpTime" xorm:"rrdpTime datetime"`
-	//snapshot/delta
+	//snapshot/delta/deltaFail/sessionReset
 	RrdpType string `json:"rrdpType" xorm:"rrdpType varchar(16)"`
+	ErrMsg   string `json:"errMsg,omitempty" xorm:"errMsg varchar(1024)"`
+}
+
+// the last notification.xml of notifyUrl, etag/lastModified are of it
+type LabRpkiSyncRrdpNotify struct {
+	Id           uint64    `json:"id" xorm:"id int"`
+	NotifyUrl    string    `json:"notifyUrl" xorm:"notifyUrl varchar(512)"`
+	SessionId    string    `json:"sessionId" xorm:"sessionId varchar(512)"`
+	MaxSerial    uint64    `json:"maxSerial" xorm:"maxSerial int"`
+	MinSerial    uint64    `json:"minSerial" xorm:"minSerial int"`
+	Etag         string    `json:"etag" xorm:"etag varchar(512)"`
+	LastModified string    `json:"lastModified" xorm:"lastModified varchar(128)"`
+	PreceptTime  time.Time `json:"preceptTime" xorm:"preceptTime datetime"`
+}
+
+// repository is notifyUrl of rrdp or rsync module(rsync://host/module/), updated at the end of every sync.
+// failCount is count of continuous fails
+type LabRpkiSyncRepo struct {
+	Id              uint64    `json:"id" xorm:"id int"`
+	RepoUrl         string    `json:"repoUrl" xorm:"repoUrl varchar(512)"`
+	Protocol        string    `json:"protocol" xorm:"protocol varchar(16)"`
+	LastAttemptTime time.Time `json:"lastAttemptTime" xorm:"lastAttemptTime datetime"`
+	LastSuccessTime time.Time `json:"lastSuccessTime" xorm:"lastSuccessTime datetime"`
+	FailCount       uint64    `json:"failCount" xorm:"failCount int"`
+	LastError       string    `json:"lastError" xorm:"lastError varchar(1024)"`
+	DurationMs      uint64    `json:"durationMs" xorm:"durationMs bigint"`
+	Bytes           uint64    `json:"bytes" xorm:"bytes bigint"`
+	ObjectCount     uint64    `json:"objectCount" xorm:"objectCount int"`
+	SessionId       string    `json:"sessionId" xorm:"sessionId varchar(512)"`
+	Serial          uint64    `json:"serial" xorm:"serial int"`
+	SyncLogId       uint64    `json:"syncLogId" xorm:"syncLogId int"`
+}
+
+// one sync of repository
+type LabRpkiSyncRepoLog struct {
+	Id          uint64    `json:"id" xorm:"id int"`
+	RepoUrl     string    `json:"repoUrl" xorm:"repoUrl varchar(512)"`
+	SyncLogId   uint64    `json:"syncLogId" xorm:"syncLogId int"`
+	Protocol    string    `json:"protocol" xorm:"protocol varchar(16)"`
+	State       string    `json:"state" xorm:"state varchar(16)"`
+	Error       string    `json:"error" xorm:"error varchar(1024)"`
+	AttemptTime time.Time `json:"attemptTime" xorm:"attemptTime datetime"`
+	DurationMs  uint64    `json:"durationMs" xorm:"durationMs bigint"`
+	Bytes       uint64    `json:"bytes" xorm:"bytes bigint"`
+	ObjectCount uint64    `json:"objectCount" xorm:"objectCount int"`
+	SessionId   string    `json:"sessionId" xorm:"sessionId varchar(512)"`
+	Serial      uint64    `json:"serial" xorm:"serial int"`
+}
+
+// rrdp of notifyUrl failed and fell back to rsync, rrdp will not be tried until nextRrdpTime
+type LabRpkiSyncRrdpFallback struct {
+	Id           uint64    `json:"id" xorm:"id int"`
+	NotifyUrl    string    `json:"notifyUrl" xorm:"notifyUrl varchar(512)"`
+	FailCount    uint64    `json:"failCount" xorm:"failCount int"`
+	FailReason   string    `json:"failReason" xorm:"failReason varchar(1024)"`
+	FailTime     time.Time `json:"failTime" xorm:"failTime datetime"`
+	NextRrdpTime time.Time `json:"nextRrdpTime" xorm:"nextRrdpTime datetime"`
+	SyncLogId    uint64    `json:"syncLogId" xorm:"syncLogId int"`
 }
@@ -0,0 +1,32 @@
+package model
+
+import (
+	"testing"
+)
+
+func TestJudgeOriginByFilePath(t *testing.T) {
+	SetOriginRules([]OriginRule{
+		{Path: "rpki.apernet.io/repo/APERNET/1/", Rir: ORIGIN_RIR_APNIC, Repo: "rpki.apernet.io"},
+		{Path: "rpki.apernet.io/repo/APERNET/0/", Rir: ORIGIN_RIR_ARIN, Repo: "rpki.apernet.io"},
+		{Path: "ripe.net", Rir: ORIGIN_RIR_RIPE_NCC},
+	})
+	defer SetOriginRules(nil)
+
+	tests := []struct {
+		filePath string
+		rir      string
+		repo     string
+	}{
+		{"/rsync/rpki.apernet.io/repo/APERNET/0/a.roa", ORIGIN_RIR_ARIN, "rpki.apernet.io"},
+		{"/rsync/rpki.apernet.io/repo/APERNET/1/a.roa", ORIGIN_RIR_APNIC, "rpki.apernet.io"},
+		// repo is host in rsync::destPath or rrdp::destPath
+		{"/rsync/rpki.ripe.net/repository/a.roa", ORIGIN_RIR_RIPE_NCC, ""},
+		{"/rsync/rpki.example.net/repo/a.roa", "unknown", ""},
+	}
+	for _, test := range tests {
+		originModel := JudgeOriginByFilePath(test.filePath)
+		if originModel.Rir != test.rir || (len(test.repo) > 0 && originModel.Repo != test.repo) {
+			t.Fatal(test.filePath, "should be:", test.rir, test.repo, "  but:", originModel.Rir, originModel.Repo)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package model
+
+import (
+	"sync"
+	"time"
+)
+
+// replay sync from local repository archive instead of network, for reproducible debugging and regression tests.
+// one of repoPath and archiveFile should be set
+type ReplayModel struct {
+	// directory laid out like rsyncrepo/rrdprepo: host/module/path
+	RepoPath string `json:"repoPath"`
+	// tarball(.tar/.tar.gz/.tgz) of this directory
+	ArchiveFile string `json:"archiveFile"`
+	// directory of tal files, default is sync::talPath
+	TalPath string `json:"talPath"`
+	// objects are validated as on this time, such as "2023-01-02T15:04:05Z", default is current time
+	ValidationTime time.Time `json:"validationTime"`
+	// result of replay is not sent to rtr, so rtr clients keep current vrps/aspas
+	SkipRtr bool `json:"skipRtr"`
+}
+
+// body of /parsevalidate/start and /chainvalidate/start after replay sync, empty body is a normal sync
+type ReplayStepModel struct {
+	// objects are validated as on this time, zero is current time
+	ValidationTime time.Time `json:"validationTime"`
+	// it is replay sync, the body will be sent to /chainvalidate/start
+	Replay bool `json:"replay"`
+	// result of replay sync is not sent to rtr
+	SkipRtr bool `json:"skipRtr"`
+}
+
+// time to validate cer/crl/mft/roa/asa, zero is current time. it is only set while replay sync and its parsevalidate
+// are running, and they reset it by defer. so other syncs and apis always validate as on current time
+var validationTime time.Time
+var validationTimeMutex sync.RWMutex
+
+func SetValidationTime(t time.Time) {
+	validationTimeMutex.Lock()
+	defer validationTimeMutex.Unlock()
+	validationTime = t
+}
+
+func GetValidationTime() time.Time {
+	validationTimeMutex.RLock()
+	defer validationTimeMutex.RUnlock()
+	if validationTime.IsZero() {
+		return time.Now()
+	}
+	return validationTime
+}
@@ -0,0 +1,21 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidationTime(t *testing.T) {
+	replayTime := time.Date(2023, 1, 2, 15, 4, 5, 0, time.UTC)
+	func() {
+		SetValidationTime(replayTime)
+		defer SetValidationTime(time.Time{})
+		if !GetValidationTime().Equal(replayTime) {
+			t.Fatal("should be replay time:", GetValidationTime())
+		}
+	}()
+	// reset after replay, current time is used
+	if now := GetValidationTime(); now.Sub(time.Now()) > time.Second || time.Since(now) > time.Second {
+		t.Fatal("should be current time:", now)
+	}
+}
@@ -30,6 +30,21 @@ type SyncResult struct {
 	FailUrls         jsonutil.JsonSyncMap `json:"failUrls"`
 	FailUrlsTryCount uint64               `json:"failUrlsTryCount"`
 
+	//rrdp failed and fell back to rsync: notifyUrl --> reason and rsync urls
+	FallbackUrls jsonutil.JsonSyncMap `json:"fallbackUrls"`
+
+	//rrdp publish/withdraw out of repository: notifyUrl --> rejected uris and reasons
+	RrdpUriErrors jsonutil.JsonSyncMap `json:"rrdpUriErrors"`
+
+	//rrdp notification.xml, snapshot.xml and delta.xml by http
+	RrdpFetchResult RrdpFetchResult `json:"rrdpFetchResult"`
+
+	//repository which exceeds ca depth or child repositories limit: url --> reason
+	LimitUrls jsonutil.JsonSyncMap `json:"limitUrls"`
+
+	//repository which is denied by sync::repoPolicyFile: url --> comment of rule
+	DenyUrls jsonutil.JsonSyncMap `json:"denyUrls"`
+
 	//parse failed
 	//FailParseValidateCerts map[string]string `json:"failParseValidateCerts"`
 	FailParseValidateCerts jsonutil.JsonSyncMap `json:"failParseValidateCerts"`
@@ -41,6 +56,15 @@ type SyncResult struct {
 	NoChangeFilesLen uint64 `json:"noChangeFilesLen"`
 }
 
+// notModifiedCount is count of 304, bytes is after gunzip, wireBytes is before gunzip.
+// bytes-wireBytes is saved by gzip
+type RrdpFetchResult struct {
+	FetchCount       uint64 `json:"fetchCount"`
+	NotModifiedCount uint64 `json:"notModifiedCount"`
+	Bytes            uint64 `json:"bytes"`
+	WireBytes        uint64 `json:"wireBytes"`
+}
+
 type SyncLogSyncState struct {
 	SyncStyle string `json:"syncStyle"`
 
@@ -75,7 +99,7 @@ type ServiceState struct {
 
 	// is running: true/false. whether the whole sync is complete.
 	IsRunning string `json:"isRunning"`
-	// current state (only public model): idle/sync/parsevalidate/chainvalidate/rtr
+	// current state (only public model): idle/sync/parsevalidate/chainvalidate/rtr/slurm
 	RunningState  string `json:"runningState"`
 	curStateMutex *sync.RWMutex
 }
@@ -92,8 +116,9 @@ func NewServiceState() *ServiceState {
 	return ss
 }
 
-// state: sync/parsevalidate/chainvalidate/rtr
-// only "sync" need isrunning is "false" and runningState is "idle", and will set isruning is "true"
+// state: sync/parsevalidate/chainvalidate/rtr/slurm
+// only "sync" and "slurm" need isrunning is "false" and runningState is "idle", and will set isruning is "true".
+// "slurm" is rtr update by changes of slurm, it cannot run with sync and its rtr
 // others will not change isrunning, and runningState will set state
 func (ss *ServiceState) EnterState(state string) (s *ServiceState, err error) {
 	ss.curStateMutex.Lock()
@@ -105,21 +130,26 @@ func (ss *ServiceState) EnterState(state string) (s *ServiceState, err error) {
 			return nil, errors.New("Synchronization cannot start at the same time")
 		}
 		ss.IsRunning = "true"
+	} else if state == "slurm" {
+		if ss.IsRunning == "true" || ss.RunningState != "idle" {
+			return nil, errors.New("Slurm cannot update rtr when synchronization or rtr is running")
+		}
+		ss.IsRunning = "true"
 	}
 
 	ss.RunningState = state
 	return ss, nil
 }
 
-// state: sync/parsevalidate/chainvalidate/rtr
-// only "rtr/end" will set isrunning is "false"
+// state: sync/parsevalidate/chainvalidate/rtr/slurm
+// only "rtr/end/slurm" will set isrunning is "false"
 // others will not change isurnning, and runingState will set "idle".
 func (ss *ServiceState) LeaveState(state string) (s *ServiceState, err error) {
 	ss.curStateMutex.Lock()
 	defer ss.curStateMutex.Unlock()
 	belogs.Info("LeaveState():state:", state, "   ss.isRunning :", ss.IsRunning, "  ss.runningState:", ss.RunningState)
 
-	if state == "rtr" || state == "end" {
+	if state == "rtr" || state == "end" || state == "slurm" {
 		ss.IsRunning = "false"
 	}
 	ss.RunningState = "idle"
@@ -0,0 +1,34 @@
+package model
+
+import (
+	"testing"
+)
+
+func TestServiceStateSlurm(t *testing.T) {
+	ss := NewServiceState()
+	if _, err := ss.EnterState("slurm"); err != nil {
+		t.Fatal("enter slurm when idle:", err)
+	}
+	if _, err := ss.EnterState("sync"); err == nil {
+		t.Fatal("sync should be refused while slurm is running")
+	}
+	ss.LeaveState("slurm")
+	if ss.IsRunning != "false" || ss.RunningState != "idle" {
+		t.Fatal("leave slurm:", ss.IsRunning, ss.RunningState)
+	}
+
+	// between steps of sync, runningState is idle but isRunning is still true
+	ss.EnterState("sync")
+	ss.LeaveState("sync")
+	if _, err := ss.EnterState("slurm"); err == nil {
+		t.Fatal("slurm should be refused while sync is running")
+	}
+	ss.EnterState("rtr")
+	if _, err := ss.EnterState("slurm"); err == nil {
+		t.Fatal("slurm should be refused while rtr is running")
+	}
+	ss.LeaveState("rtr")
+	if _, err := ss.EnterState("slurm"); err != nil {
+		t.Fatal("enter slurm after rtr:", err)
+	}
+}
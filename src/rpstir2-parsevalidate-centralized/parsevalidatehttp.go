@@ -1,6 +1,7 @@
 package parsevalidatecentralized
 
 import (
+	"io"
 	"io/ioutil"
 	"os"
 	"time"
@@ -18,11 +19,24 @@ import (
 func ParseValidateStart(c *gin.Context) {
 	belogs.Debug("ParseValidateStart(): start: ")
 
+	// body is empty, or is set by replay sync
+	replayStepModel := model.ReplayStepModel{}
+	err := c.ShouldBindJSON(&replayStepModel)
+	if err != nil && err != io.EOF {
+		belogs.Error("ParseValidateStart(): ShouldBindJSON:", err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	belogs.Info("ParseValidateStart(): replayStepModel:", jsonutil.MarshalJson(replayStepModel))
+
 	//check serviceState
 	httpclient.Post("https://"+conf.String("rpstir2-rp::serverHost")+":"+conf.String("rpstir2-rp::serverHttpsPort")+
 		"/sys/servicestate", `{"operate":"enter","state":"parsevalidate"}`, false)
 
 	go func() {
+		// validate as on validationTime of replay, and reset to current time after parsevalidate
+		model.SetValidationTime(replayStepModel.ValidationTime)
+		defer model.SetValidationTime(time.Time{})
 		nextStep, err := parseValidateStart()
 		belogs.Debug("ParseValidateStart():  parseValidateStart end,  nextStep is :", nextStep, err)
 		// leave serviceState
@@ -35,8 +49,12 @@ func ParseValidateStart(c *gin.Context) {
 			httpclient.Post("https://"+conf.String("rpstir2-rp::serverHost")+":"+conf.String("rpstir2-rp::serverHttpsPort")+
 				"/sys/servicestate", `{"operate":"leave","state":"parsevalidate"}`, false)
 			// will call chainValidate
+			chainValidateBody := ""
+			if replayStepModel.Replay {
+				chainValidateBody = jsonutil.MarshalJson(replayStepModel)
+			}
 			go httpclient.Post("https://"+conf.String("rpstir2-rp::serverHost")+":"+conf.String("rpstir2-rp::serverHttpsPort")+
-				"/chainvalidate/start", "", false)
+				"/chainvalidate/start", chainValidateBody, false)
 			belogs.Info("ParseValidateStart():  sync.Start end,  nextStep is :", nextStep)
 		}
 
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
-	"time"
 
 	"github.com/cpusoft/goutil/asn1util"
 	"github.com/cpusoft/goutil/belogs"
@@ -323,7 +322,7 @@ func validateCerlModel(cerModel *model.CerModel, stateModel *model.StateModel) (
 	//check time
 	// myssl.c P3856 rescert_dates_chk
 	// myssl.c P2970-2997
-	now := time.Now()
+	now := model.GetValidationTime()
 	if cerModel.NotBefore.IsZero() {
 		stateMsg := model.StateMsg{Stage: "parsevalidate",
 			Fail:   "NotBefore is empty",
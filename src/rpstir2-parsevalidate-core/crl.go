@@ -3,7 +3,6 @@ package parsevalidatecore
 import (
 	"errors"
 	"strconv"
-	"time"
 
 	"github.com/cpusoft/goutil/asn1util"
 	"github.com/cpusoft/goutil/belogs"
@@ -142,7 +141,7 @@ func validateCrlModel(crlModel *model.CrlModel, stateModel *model.StateModel) (e
 		stateModel.AddError(&stateMsg)
 	}
 	//check time
-	now := time.Now()
+	now := model.GetValidationTime()
 	if crlModel.ThisUpdate.IsZero() {
 		stateMsg := model.StateMsg{Stage: "parsevalidate",
 			Fail:   "ThisUpdate is empty",
@@ -2,7 +2,6 @@ package parsevalidatecore
 
 import (
 	"net/url"
-	"time"
 
 	"github.com/cpusoft/goutil/belogs"
 	"github.com/cpusoft/goutil/conf"
@@ -65,7 +64,7 @@ func ValidateEeCertModel(stateModel *model.StateModel, eeCertModel *model.EeCert
 			Detail: "Digest algorithm is " + eeCertModel.DigestAlgorithm}
 		stateModel.AddError(&stateMsg)
 	}
-	now := time.Now()
+	now := model.GetValidationTime()
 	if eeCertModel.NotBefore.IsZero() {
 		stateMsg := model.StateMsg{Stage: "parsevalidate",
 			Fail:   "NotBefore of EE is empty",
@@ -180,7 +179,7 @@ func ValidateSignerInfoModel(stateModel *model.StateModel, signerInfoModel *mode
 			Detail: "Digest Algorithm of SignerInfo is " + signerInfoModel.DigestAlgorithm}
 		stateModel.AddError(&stateMsg)
 	}
-	now := time.Now()
+	now := model.GetValidationTime()
 	if signerInfoModel.SigningTime.IsZero() {
 		stateMsg := model.StateMsg{Stage: "parsevalidate",
 			Fail:   "SigningTime of SignerInfo is empty",
@@ -4,7 +4,6 @@ import (
 	"errors"
 	"math/big"
 	"strconv"
-	"time"
 
 	"github.com/cpusoft/goutil/asn1util"
 	"github.com/cpusoft/goutil/belogs"
@@ -343,7 +342,7 @@ func validateMftModel(mftModel *model.MftModel, stateModel *model.StateModel) (e
 	}
 
 	//check time
-	now := time.Now()
+	now := model.GetValidationTime()
 	if mftModel.ThisUpdate.IsZero() {
 		stateMsg := model.StateMsg{Stage: "parsevalidate",
 			Fail:   "ThisUpdate is empty",
@@ -4,7 +4,6 @@ import (
 	"crypto/x509"
 	"fmt"
 	"strconv"
-	"time"
 
 	"github.com/cpusoft/goutil/asn1util"
 	"github.com/cpusoft/goutil/belogs"
@@ -121,7 +120,7 @@ func ParseCrlModelByX509(fileByte []byte, crlModel *model.CrlModel) (err error)
 	crlModel.IssuerAll, _ = asn1util.GetDNFromRDNSeq(tbsCertList.Issuer, ",")
 	crlModel.ThisUpdate = tbsCertList.ThisUpdate.Local()
 	crlModel.NextUpdate = tbsCertList.NextUpdate.Local()
-	crlModel.HasExpired = strconv.FormatBool(crl.HasExpired(time.Now()))
+	crlModel.HasExpired = strconv.FormatBool(crl.HasExpired(model.GetValidationTime()))
 	//exts := tbsCertList.Extensions
 	crlModel.RevokedCertModels = make([]model.RevokedCertModel, 0)
 	revokedCerts := tbsCertList.RevokedCertificates
@@ -0,0 +1,218 @@
+package bmp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"rpstir2-rov/validate"
+)
+
+// fake router which sends bmp messages
+type fakeBmpSender struct {
+	conn net.Conn
+}
+
+func (f *fakeBmpSender) send(msgType uint8, body []byte) {
+	b := make([]byte, BMP_COMMON_HEADER_LENGTH, BMP_COMMON_HEADER_LENGTH+len(body))
+	b[0] = BMP_VERSION
+	binary.BigEndian.PutUint32(b[1:5], uint32(BMP_COMMON_HEADER_LENGTH+len(body)))
+	b[5] = msgType
+	f.conn.Write(append(b, body...))
+}
+
+func fakePerPeerHeader(peerIp string, peerAsn uint32) []byte {
+	b := make([]byte, BMP_PER_PEER_HEADER_LENGTH)
+	ip := netip.MustParseAddr(peerIp)
+	if ip.Is6() {
+		b[1] = BMP_PEER_FLAG_IPV6
+		ip16 := ip.As16()
+		copy(b[10:26], ip16[:])
+	} else {
+		ip4 := ip.As4()
+		copy(b[22:26], ip4[:])
+	}
+	binary.BigEndian.PutUint32(b[26:30], peerAsn)
+	copy(b[30:34], []byte{10, 0, 0, 1})
+	binary.BigEndian.PutUint32(b[34:38], uint32(time.Now().Unix()))
+	return b
+}
+
+func fakeNlri(prefixes ...string) []byte {
+	b := make([]byte, 0)
+	for _, p := range prefixes {
+		prefix := netip.MustParsePrefix(p)
+		b = append(b, byte(prefix.Bits()))
+		b = append(b, prefix.Addr().AsSlice()[:(prefix.Bits()+7)/8]...)
+	}
+	return b
+}
+
+// ipv4 nlri in update, ipv6 in MP_REACH_NLRI/MP_UNREACH_NLRI
+func fakeBgpUpdate(asPath []uint32, withdrawn, announced []string) []byte {
+	withdrawn4, announced4 := make([]string, 0), make([]string, 0)
+	withdrawn6, announced6 := make([]string, 0), make([]string, 0)
+	for _, p := range withdrawn {
+		if netip.MustParsePrefix(p).Addr().Is4() {
+			withdrawn4 = append(withdrawn4, p)
+		} else {
+			withdrawn6 = append(withdrawn6, p)
+		}
+	}
+	for _, p := range announced {
+		if netip.MustParsePrefix(p).Addr().Is4() {
+			announced4 = append(announced4, p)
+		} else {
+			announced6 = append(announced6, p)
+		}
+	}
+
+	attrs := make([]byte, 0)
+	if len(asPath) > 0 {
+		value := []byte{2, byte(len(asPath))}
+		for _, asn := range asPath {
+			value = binary.BigEndian.AppendUint32(value, asn)
+		}
+		attrs = append(attrs, 0x40, BGP_ATTR_TYPE_AS_PATH, byte(len(value)))
+		attrs = append(attrs, value...)
+	}
+	if len(announced6) > 0 {
+		value := []byte{0, BGP_AFI_IPV6, BGP_SAFI_UNICAST, 16}
+		value = append(value, netip.MustParseAddr("2001:db8::1").AsSlice()...)
+		value = append(value, 0)
+		value = append(value, fakeNlri(announced6...)...)
+		attrs = append(attrs, 0x80, BGP_ATTR_TYPE_MP_REACH_NLRI, byte(len(value)))
+		attrs = append(attrs, value...)
+	}
+	if len(withdrawn6) > 0 {
+		value := []byte{0, BGP_AFI_IPV6, BGP_SAFI_UNICAST}
+		value = append(value, fakeNlri(withdrawn6...)...)
+		attrs = append(attrs, 0x80, BGP_ATTR_TYPE_MP_UNREACH_NLRI, byte(len(value)))
+		attrs = append(attrs, value...)
+	}
+
+	w := fakeNlri(withdrawn4...)
+	body := binary.BigEndian.AppendUint16(nil, uint16(len(w)))
+	body = append(body, w...)
+	body = binary.BigEndian.AppendUint16(body, uint16(len(attrs)))
+	body = append(body, attrs...)
+	body = append(body, fakeNlri(announced4...)...)
+
+	b := make([]byte, 16, BGP_HEADER_LENGTH+len(body))
+	for i := range b {
+		b[i] = 0xff
+	}
+	b = binary.BigEndian.AppendUint16(b, uint16(BGP_HEADER_LENGTH+len(body)))
+	b = append(b, BGP_MSG_TYPE_UPDATE)
+	return append(b, body...)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	for i := 0; i < 200; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("timeout")
+}
+
+func TestBmpServer(t *testing.T) {
+	vrpSet := validate.NewVrpSet()
+	vrpSet.SerialNumber = 1
+	vrpSet.AddVrp(validate.Vrp{Asn: 64496, Prefix: netip.MustParsePrefix("192.0.2.0/24"), MaxLength: 24})
+	vrpSet.AddVrp(validate.Vrp{Asn: 64497, Prefix: netip.MustParsePrefix("2001:db8::/32"), MaxLength: 48})
+	s := NewBmpServer(vrpSet, 100)
+	err := s.Start("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	conn, err := net.Dial("tcp", s.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	f := &fakeBmpSender{conn: conn}
+	f.send(BMP_MSG_TYPE_INITIATION, []byte{0, BMP_INFO_TYPE_SYS_NAME, 0, 7, 'r', 'o', 'u', 't', 'e', 'r', '1'})
+	f.send(BMP_MSG_TYPE_PEER_UP, fakePerPeerHeader("198.51.100.1", 64500))
+	f.send(BMP_MSG_TYPE_ROUTE_MONITORING, append(fakePerPeerHeader("198.51.100.1", 64500),
+		fakeBgpUpdate([]uint32{64500, 64496}, nil, []string{"192.0.2.0/24", "203.0.113.0/24"})...))
+	f.send(BMP_MSG_TYPE_ROUTE_MONITORING, append(fakePerPeerHeader("198.51.100.1", 64500),
+		fakeBgpUpdate([]uint32{64500, 64499}, nil, []string{"192.0.2.128/25", "2001:db8:1::/48"})...))
+
+	waitFor(t, func() bool {
+		peers := s.GetPeers()
+		return len(peers) == 1 && peers[0].RouteCount == 4
+	})
+	peers := s.GetPeers()
+	fmt.Println(peers)
+	if peers[0].SysName != "router1" || peers[0].ValidCount != 1 || peers[0].InvalidCount != 2 || peers[0].NotFoundCount != 1 {
+		t.Fatal("wrong peer summary", peers[0])
+	}
+	invalids := s.GetInvalidRoutes("", "198.51.100.1")
+	if len(invalids) != 1 || len(invalids[0].Routes) != 2 || invalids[0].Routes[0].Prefix.String() != "192.0.2.128/25" {
+		t.Fatal("wrong invalid routes", invalids)
+	}
+
+	// withdraw one invalid route
+	f.send(BMP_MSG_TYPE_ROUTE_MONITORING, append(fakePerPeerHeader("198.51.100.1", 64500),
+		fakeBgpUpdate(nil, []string{"2001:db8:1::/48"}, nil)...))
+	waitFor(t, func() bool {
+		return s.GetPeers()[0].RouteCount == 3
+	})
+
+	// new vrps: 192.0.2.128/25 by 64499 becomes valid, 203.0.113.0/24 becomes invalid
+	newVrpSet := vrpSet.Clone()
+	newVrpSet.SerialNumber = 2
+	newVrpSet.AddVrp(validate.Vrp{Asn: 64499, Prefix: netip.MustParsePrefix("192.0.2.128/25"), MaxLength: 25})
+	newVrpSet.AddVrp(validate.Vrp{Asn: 64511, Prefix: netip.MustParsePrefix("203.0.113.0/24"), MaxLength: 24})
+	s.UpdateVrpSet(newVrpSet)
+
+	stateChanges := s.GetStateChanges(1)
+	fmt.Println(stateChanges)
+	if len(stateChanges) != 2 {
+		t.Fatal("wrong state changes", stateChanges)
+	}
+	for _, c := range stateChanges {
+		if (c.Prefix == "192.0.2.128/25" && c.NewState != validate.ROV_STATE_VALID) ||
+			(c.Prefix == "203.0.113.0/24" && c.NewState != validate.ROV_STATE_INVALID) {
+			t.Fatal("wrong state change", c)
+		}
+	}
+	if len(s.GetStateChanges(0)) != 7 {
+		t.Fatal("wrong all state changes", s.GetStateChanges(0))
+	}
+
+	// peer down removes Adj-RIB-In
+	f.send(BMP_MSG_TYPE_PEER_DOWN, append(fakePerPeerHeader("198.51.100.1", 64500), 2))
+	waitFor(t, func() bool {
+		return len(s.GetPeers()) == 0
+	})
+}
+
+func TestAddStateChange(t *testing.T) {
+	vrpSet := validate.NewVrpSet()
+	s := NewBmpServer(vrpSet, 3)
+	peer := &bmpPeer{key: peerKey{routerIp: "192.0.2.1", peerIp: netip.MustParseAddr("198.51.100.1")}, peerAsn: 64500}
+	route := &BmpRoute{Prefix: netip.MustParsePrefix("192.0.2.0/24"), OriginAsn: 64496}
+	for i := uint64(1); i <= 10; i++ {
+		vrpSet.SerialNumber = i
+		s.addStateChange(peer, route, validate.ROV_STATE_NOT_FOUND, validate.ROV_STATE_VALID, time.Now())
+		if len(s.stateChanges) >= 2*s.maxStateChanges {
+			t.Fatal("should be trimmed:", len(s.stateChanges))
+		}
+	}
+	// only the latest 3 are returned
+	stateChanges := s.GetStateChanges(0)
+	if len(stateChanges) != 3 || stateChanges[0].SerialNumber != 8 || stateChanges[2].SerialNumber != 10 {
+		t.Fatal("wrong state changes", stateChanges)
+	}
+	if stateChanges = s.GetStateChanges(9); len(stateChanges) != 1 || stateChanges[0].SerialNumber != 10 {
+		t.Fatal("wrong state changes after 9", stateChanges)
+	}
+}
@@ -0,0 +1,178 @@
+package bmp
+
+import (
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"rpstir2-rov/mrt"
+	"rpstir2-rov/validate"
+)
+
+// rfc7854 4.1
+const (
+	BMP_VERSION                = 3
+	BMP_COMMON_HEADER_LENGTH   = 6
+	BMP_PER_PEER_HEADER_LENGTH = 42
+
+	BMP_MSG_TYPE_ROUTE_MONITORING  = 0
+	BMP_MSG_TYPE_STATISTICS_REPORT = 1
+	BMP_MSG_TYPE_PEER_DOWN         = 2
+	BMP_MSG_TYPE_PEER_UP           = 3
+	BMP_MSG_TYPE_INITIATION        = 4
+	BMP_MSG_TYPE_TERMINATION       = 5
+	BMP_MSG_TYPE_ROUTE_MIRRORING   = 6
+
+	// rfc7854 4.2 peer flags
+	BMP_PEER_FLAG_IPV6        = 0x80
+	BMP_PEER_FLAG_POST_POLICY = 0x40
+	BMP_PEER_FLAG_AS2         = 0x20
+
+	// rfc7854 4.4 information tlv
+	BMP_INFO_TYPE_STRING    = 0
+	BMP_INFO_TYPE_SYS_DESCR = 1
+	BMP_INFO_TYPE_SYS_NAME  = 2
+)
+
+// rfc4271 4.1 and rfc4760
+const (
+	BGP_HEADER_LENGTH   = 19
+	BGP_MSG_TYPE_UPDATE = 2
+
+	BGP_ATTR_FLAG_EXTENDED_LENGTH = 0x10
+	BGP_ATTR_TYPE_AS_PATH         = 2
+	BGP_ATTR_TYPE_MP_REACH_NLRI   = 14
+	BGP_ATTR_TYPE_MP_UNREACH_NLRI = 15
+
+	BGP_AFI_IPV4     = 1
+	BGP_AFI_IPV6     = 2
+	BGP_SAFI_UNICAST = 1
+)
+
+// max length of one bmp message, avoid to alloc too much memory by broken router
+const bmpMaxMessageLength = 1024 * 1024
+
+// state in BmpStateChange when route is announced first time or withdrawn
+const (
+	BMP_STATE_NONE = "none"
+)
+
+type BmpCommonHeader struct {
+	Version uint8  `json:"version"`
+	Length  uint32 `json:"length"`
+	Type    uint8  `json:"type"`
+}
+
+type BmpPerPeerHeader struct {
+	PeerType          uint8      `json:"peerType"`
+	PeerFlags         uint8      `json:"peerFlags"`
+	PeerDistinguisher uint64     `json:"peerDistinguisher"`
+	PeerIp            netip.Addr `json:"peerIp"`
+	PeerAsn           uint32     `json:"peerAsn"`
+	PeerBgpId         netip.Addr `json:"peerBgpId"`
+	Timestamp         time.Time  `json:"timestamp"`
+}
+
+// announced and withdrawn prefixes in one bgp update
+type BgpUpdate struct {
+	Withdrawn []netip.Prefix `json:"withdrawn"`
+	Announced []netip.Prefix `json:"announced"`
+	AsPath    mrt.AsPath     `json:"asPath"`
+}
+
+// one peer of one monitored router, pre-policy and post-policy are different Adj-RIB-In
+type peerKey struct {
+	routerIp          string
+	peerDistinguisher uint64
+	peerIp            netip.Addr
+	isPostPolicy      bool
+}
+
+type BmpRoute struct {
+	Prefix     netip.Prefix `json:"prefix"`
+	AsPath     string       `json:"asPath"`
+	OriginAsn  uint32       `json:"originAsn"`
+	HasOrigin  bool         `json:"hasOrigin"`
+	RovState   string       `json:"rovState"`
+	RovReason  string       `json:"rovReason,omitempty"`
+	UpdateTime time.Time    `json:"updateTime"`
+}
+
+type bmpPeer struct {
+	key       peerKey
+	peerAsn   uint32
+	peerBgpId netip.Addr
+	upTime    time.Time
+	// Adj-RIB-In, without add-path, one route for one prefix
+	routes map[netip.Prefix]*BmpRoute
+}
+
+type BmpRouter struct {
+	RouterIp    string    `json:"routerIp"`
+	SysName     string    `json:"sysName"`
+	SysDescr    string    `json:"sysDescr"`
+	ConnectTime time.Time `json:"connectTime"`
+}
+
+type BmpPeerSummary struct {
+	RouterIp          string    `json:"routerIp"`
+	SysName           string    `json:"sysName"`
+	PeerIp            string    `json:"peerIp"`
+	PeerAsn           uint32    `json:"peerAsn"`
+	PeerBgpId         string    `json:"peerBgpId"`
+	PeerDistinguisher uint64    `json:"peerDistinguisher"`
+	IsPostPolicy      bool      `json:"isPostPolicy"`
+	UpTime            time.Time `json:"upTime"`
+	RouteCount        uint64    `json:"routeCount"`
+	ValidCount        uint64    `json:"validCount"`
+	InvalidCount      uint64    `json:"invalidCount"`
+	NotFoundCount     uint64    `json:"notFoundCount"`
+}
+
+type BmpPeerRoutes struct {
+	RouterIp     string     `json:"routerIp"`
+	PeerIp       string     `json:"peerIp"`
+	PeerAsn      uint32     `json:"peerAsn"`
+	IsPostPolicy bool       `json:"isPostPolicy"`
+	Routes       []BmpRoute `json:"routes"`
+}
+
+// state of route is changed by bgp update or by new vrps
+type BmpStateChange struct {
+	SerialNumber uint64    `json:"serialNumber"`
+	ChangeTime   time.Time `json:"changeTime"`
+	RouterIp     string    `json:"routerIp"`
+	PeerIp       string    `json:"peerIp"`
+	PeerAsn      uint32    `json:"peerAsn"`
+	IsPostPolicy bool      `json:"isPostPolicy"`
+	Prefix       string    `json:"prefix"`
+	OriginAsn    uint32    `json:"originAsn"`
+	OldState     string    `json:"oldState"`
+	NewState     string    `json:"newState"`
+}
+
+type BmpServer struct {
+	listener net.Listener
+
+	mutex   sync.RWMutex
+	vrpSet  *validate.VrpSet
+	routers map[string]*BmpRouter
+	peers   map[peerKey]*bmpPeer
+	conns   map[net.Conn]struct{}
+
+	// ring of recent state changes, oldest first
+	stateChanges    []BmpStateChange
+	maxStateChanges int
+}
+
+// body of /rov/bmp/invalidroutes, empty means all
+type BmpInvalidRoutesRequest struct {
+	RouterIp string `json:"routerIp"`
+	PeerIp   string `json:"peerIp"`
+}
+
+// body of /rov/bmp/statechanges
+type BmpStateChangesRequest struct {
+	SerialNumber uint64 `json:"serialNumber"`
+}
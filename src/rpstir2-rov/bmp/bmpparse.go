@@ -0,0 +1,232 @@
+package bmp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"time"
+
+	"rpstir2-rov/mrt"
+)
+
+// read one whole bmp message, return common header and body after common header
+func readBmpMessage(reader io.Reader) (commonHeader BmpCommonHeader, body []byte, err error) {
+	headerBytes := make([]byte, BMP_COMMON_HEADER_LENGTH)
+	_, err = io.ReadFull(reader, headerBytes)
+	if err != nil {
+		return commonHeader, nil, err
+	}
+	commonHeader = BmpCommonHeader{
+		Version: headerBytes[0],
+		Length:  binary.BigEndian.Uint32(headerBytes[1:5]),
+		Type:    headerBytes[5],
+	}
+	if commonHeader.Version != BMP_VERSION {
+		return commonHeader, nil, fmt.Errorf("bmp version %d is not supported", commonHeader.Version)
+	}
+	if commonHeader.Length < BMP_COMMON_HEADER_LENGTH || commonHeader.Length > bmpMaxMessageLength {
+		return commonHeader, nil, fmt.Errorf("bmp message length %d is error", commonHeader.Length)
+	}
+	body = make([]byte, commonHeader.Length-BMP_COMMON_HEADER_LENGTH)
+	_, err = io.ReadFull(reader, body)
+	if err != nil {
+		return commonHeader, nil, errors.New("bmp message is truncated")
+	}
+	return commonHeader, body, nil
+}
+
+// rfc7854 4.2
+func parsePerPeerHeader(body []byte) (perPeerHeader BmpPerPeerHeader, err error) {
+	if len(body) < BMP_PER_PEER_HEADER_LENGTH {
+		return perPeerHeader, errors.New("bmp per-peer header is truncated")
+	}
+	perPeerHeader.PeerType = body[0]
+	perPeerHeader.PeerFlags = body[1]
+	perPeerHeader.PeerDistinguisher = binary.BigEndian.Uint64(body[2:10])
+	// ipv4 is in the last 4 bytes of 16 bytes
+	if perPeerHeader.PeerFlags&BMP_PEER_FLAG_IPV6 != 0 {
+		var ip [16]byte
+		copy(ip[:], body[10:26])
+		perPeerHeader.PeerIp = netip.AddrFrom16(ip)
+	} else {
+		var ip [4]byte
+		copy(ip[:], body[22:26])
+		perPeerHeader.PeerIp = netip.AddrFrom4(ip)
+	}
+	perPeerHeader.PeerAsn = binary.BigEndian.Uint32(body[26:30])
+	var bgpId [4]byte
+	copy(bgpId[:], body[30:34])
+	perPeerHeader.PeerBgpId = netip.AddrFrom4(bgpId)
+	perPeerHeader.Timestamp = time.Unix(int64(binary.BigEndian.Uint32(body[34:38])),
+		int64(binary.BigEndian.Uint32(body[38:42]))*1000)
+	return perPeerHeader, nil
+}
+
+// rfc7854 4.3, 4.4: type(2), length(2), value
+func parseInformationTlvs(b []byte) (infos map[uint16]string, err error) {
+	infos = make(map[uint16]string)
+	pos := 0
+	for pos < len(b) {
+		if len(b) < pos+4 {
+			return nil, errors.New("bmp information tlv is truncated")
+		}
+		infoType := binary.BigEndian.Uint16(b[pos : pos+2])
+		infoLength := int(binary.BigEndian.Uint16(b[pos+2 : pos+4]))
+		pos += 4
+		if len(b) < pos+infoLength {
+			return nil, errors.New("bmp information tlv is truncated")
+		}
+		infos[infoType] = string(b[pos : pos+infoLength])
+		pos += infoLength
+	}
+	return infos, nil
+}
+
+// bgp update pdu, including 19 bytes bgp header.
+// asn4 is false when the router sends as_path in legacy 2-byte asn
+func parseBgpUpdate(b []byte, asn4 bool) (bgpUpdate BgpUpdate, err error) {
+	if len(b) < BGP_HEADER_LENGTH {
+		return bgpUpdate, errors.New("bgp header is truncated")
+	}
+	length := int(binary.BigEndian.Uint16(b[16:18]))
+	if length < BGP_HEADER_LENGTH || length > len(b) {
+		return bgpUpdate, fmt.Errorf("bgp message length %d is error", length)
+	}
+	if b[18] != BGP_MSG_TYPE_UPDATE {
+		return bgpUpdate, fmt.Errorf("bgp message type %d is not update", b[18])
+	}
+	b = b[BGP_HEADER_LENGTH:length]
+
+	// withdrawn routes length(2), withdrawn routes, path attribute length(2), path attributes, nlri
+	if len(b) < 2 {
+		return bgpUpdate, errors.New("bgp withdrawn routes length is truncated")
+	}
+	withdrawnLength := int(binary.BigEndian.Uint16(b[0:2]))
+	pos := 2
+	if len(b) < pos+withdrawnLength+2 {
+		return bgpUpdate, errors.New("bgp withdrawn routes is truncated")
+	}
+	bgpUpdate.Withdrawn, err = parseNlri(b[pos:pos+withdrawnLength], false)
+	if err != nil {
+		return bgpUpdate, err
+	}
+	pos += withdrawnLength
+
+	attrLength := int(binary.BigEndian.Uint16(b[pos : pos+2]))
+	pos += 2
+	if len(b) < pos+attrLength {
+		return bgpUpdate, errors.New("bgp path attributes is truncated")
+	}
+	err = parseBgpAttributes(b[pos:pos+attrLength], asn4, &bgpUpdate)
+	if err != nil {
+		return bgpUpdate, err
+	}
+	pos += attrLength
+
+	announced, err := parseNlri(b[pos:], false)
+	if err != nil {
+		return bgpUpdate, err
+	}
+	bgpUpdate.Announced = append(bgpUpdate.Announced, announced...)
+	return bgpUpdate, nil
+}
+
+func parseBgpAttributes(b []byte, asn4 bool, bgpUpdate *BgpUpdate) (err error) {
+	pos := 0
+	for pos < len(b) {
+		// flags(1), type(1), length(1 or 2)
+		if len(b) < pos+3 {
+			return errors.New("bgp path attribute is truncated")
+		}
+		attrFlags := b[pos]
+		attrType := b[pos+1]
+		pos += 2
+		var attrLength int
+		if attrFlags&BGP_ATTR_FLAG_EXTENDED_LENGTH != 0 {
+			if len(b) < pos+2 {
+				return errors.New("bgp path attribute is truncated")
+			}
+			attrLength = int(binary.BigEndian.Uint16(b[pos : pos+2]))
+			pos += 2
+		} else {
+			attrLength = int(b[pos])
+			pos++
+		}
+		if len(b) < pos+attrLength {
+			return errors.New("bgp path attribute is truncated")
+		}
+		value := b[pos : pos+attrLength]
+		pos += attrLength
+
+		switch attrType {
+		case BGP_ATTR_TYPE_AS_PATH:
+			bgpUpdate.AsPath, err = mrt.ParseAsPath(value, asn4)
+			if err != nil {
+				return err
+			}
+		case BGP_ATTR_TYPE_MP_REACH_NLRI:
+			// afi(2), safi(1), next hop length(1), next hop, reserved(1), nlri
+			if len(value) < 4 || len(value) < 5+int(value[3]) {
+				return errors.New("bgp MP_REACH_NLRI is truncated")
+			}
+			isIpv6, ok := unicastAfi(value)
+			if !ok {
+				continue
+			}
+			announced, err := parseNlri(value[5+int(value[3]):], isIpv6)
+			if err != nil {
+				return err
+			}
+			bgpUpdate.Announced = append(bgpUpdate.Announced, announced...)
+		case BGP_ATTR_TYPE_MP_UNREACH_NLRI:
+			// afi(2), safi(1), withdrawn routes
+			if len(value) < 3 {
+				return errors.New("bgp MP_UNREACH_NLRI is truncated")
+			}
+			isIpv6, ok := unicastAfi(value)
+			if !ok {
+				continue
+			}
+			withdrawn, err := parseNlri(value[3:], isIpv6)
+			if err != nil {
+				return err
+			}
+			bgpUpdate.Withdrawn = append(bgpUpdate.Withdrawn, withdrawn...)
+		}
+	}
+	return nil
+}
+
+// only ipv4/ipv6 unicast is used in rov
+func unicastAfi(value []byte) (isIpv6 bool, ok bool) {
+	afi := binary.BigEndian.Uint16(value[0:2])
+	if value[2] != BGP_SAFI_UNICAST {
+		return false, false
+	}
+	switch afi {
+	case BGP_AFI_IPV4:
+		return false, true
+	case BGP_AFI_IPV6:
+		return true, true
+	}
+	return false, false
+}
+
+// prefix length(1), prefix, without add-path
+func parseNlri(b []byte, isIpv6 bool) (prefixes []netip.Prefix, err error) {
+	prefixes = make([]netip.Prefix, 0)
+	pos := 0
+	for pos < len(b) {
+		prefixLength := int(b[pos])
+		pos++
+		prefix, n, err := mrt.ParsePrefix(b[pos:], prefixLength, isIpv6)
+		if err != nil {
+			return nil, err
+		}
+		pos += n
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, nil
+}
@@ -0,0 +1,415 @@
+package bmp
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"sort"
+	"time"
+
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/conf"
+	"rpstir2-rov/validate"
+)
+
+var BmpTcpServer *BmpServer
+
+// start bmp server on bmp::serverTcpPort, load vrps from db, and reload when rtr serialNumber changes
+func BmpServerStart(tcpPort string) {
+	belogs.Debug("BmpServerStart(): serverTcpPort:", tcpPort)
+	vrpSet, err := validate.GetVrpSetDb()
+	if err != nil {
+		belogs.Error("BmpServerStart(): GetVrpSetDb fail, will use empty vrps:", err)
+		vrpSet = validate.NewVrpSet()
+	}
+	bmpServer := NewBmpServer(vrpSet, conf.Int("bmp::maxStateChanges"))
+	err = bmpServer.Start("0.0.0.0:" + tcpPort)
+	if err != nil {
+		belogs.Error("BmpServerStart(): Start fail, tcpPort:", tcpPort, err)
+		return
+	}
+	BmpTcpServer = bmpServer
+	belogs.Info("BmpServerStart(): start bmp server on :", tcpPort)
+
+	refreshIntervalSeconds := conf.Int("bmp::refreshIntervalSeconds")
+	if refreshIntervalSeconds <= 0 {
+		refreshIntervalSeconds = 60
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(refreshIntervalSeconds) * time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			refreshVrpSet(bmpServer)
+		}
+	}()
+}
+
+// reload vrps only when serialNumber is changed
+func refreshVrpSet(bmpServer *BmpServer) {
+	serialNumber, err := validate.GetCurSerialNumberDb()
+	if err != nil {
+		belogs.Error("refreshVrpSet(): GetCurSerialNumberDb fail:", err)
+		return
+	}
+	if serialNumber == bmpServer.SerialNumber() {
+		return
+	}
+	vrpSet, err := validate.GetVrpSetDb()
+	if err != nil {
+		belogs.Error("refreshVrpSet(): GetVrpSetDb fail:", err)
+		return
+	}
+	bmpServer.UpdateVrpSet(vrpSet)
+}
+
+func NewBmpServer(vrpSet *validate.VrpSet, maxStateChanges int) *BmpServer {
+	if maxStateChanges <= 0 {
+		maxStateChanges = 100000
+	}
+	return &BmpServer{
+		vrpSet:          vrpSet,
+		routers:         make(map[string]*BmpRouter),
+		peers:           make(map[peerKey]*bmpPeer),
+		conns:           make(map[net.Conn]struct{}),
+		stateChanges:    make([]BmpStateChange, 0),
+		maxStateChanges: maxStateChanges,
+	}
+}
+
+// listen and accept in background
+func (s *BmpServer) Start(address string) (err error) {
+	s.listener, err = net.Listen("tcp", address)
+	if err != nil {
+		belogs.Error("Start(): Listen fail, address:", address, err)
+		return err
+	}
+	go func() {
+		for {
+			conn, err := s.listener.Accept()
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				belogs.Error("Start(): Accept fail:", err)
+				continue
+			}
+			go s.handleConn(conn)
+		}
+	}()
+	return nil
+}
+
+func (s *BmpServer) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+func (s *BmpServer) Stop() {
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	s.mutex.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mutex.Unlock()
+}
+
+func (s *BmpServer) SerialNumber() uint64 {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.vrpSet.SerialNumber
+}
+
+// one monitored router, bmp is one-way from router, so just read until closed
+func (s *BmpServer) handleConn(conn net.Conn) {
+	routerIp := conn.RemoteAddr().String()
+	if addrPort, err := netip.ParseAddrPort(routerIp); err == nil {
+		routerIp = addrPort.Addr().Unmap().String()
+	}
+	belogs.Info("handleConn(): router connected:", routerIp)
+	s.mutex.Lock()
+	s.conns[conn] = struct{}{}
+	s.routers[routerIp] = &BmpRouter{RouterIp: routerIp, ConnectTime: time.Now()}
+	s.mutex.Unlock()
+
+	defer func() {
+		conn.Close()
+		s.removeRouter(conn, routerIp)
+		belogs.Info("handleConn(): router disconnected:", routerIp)
+	}()
+
+	for {
+		commonHeader, body, err := readBmpMessage(conn)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				belogs.Error("handleConn(): readBmpMessage fail, routerIp:", routerIp, err)
+			}
+			return
+		}
+		err = s.processMessage(routerIp, commonHeader, body)
+		if err != nil {
+			belogs.Error("handleConn(): processMessage fail, routerIp:", routerIp, "  type:", commonHeader.Type, err)
+			return
+		}
+		if commonHeader.Type == BMP_MSG_TYPE_TERMINATION {
+			return
+		}
+	}
+}
+
+func (s *BmpServer) processMessage(routerIp string, commonHeader BmpCommonHeader, body []byte) (err error) {
+	switch commonHeader.Type {
+	case BMP_MSG_TYPE_INITIATION:
+		infos, err := parseInformationTlvs(body)
+		if err != nil {
+			return err
+		}
+		s.mutex.Lock()
+		if router, ok := s.routers[routerIp]; ok {
+			router.SysName = infos[BMP_INFO_TYPE_SYS_NAME]
+			router.SysDescr = infos[BMP_INFO_TYPE_SYS_DESCR]
+		}
+		s.mutex.Unlock()
+		belogs.Info("processMessage(): initiation, routerIp:", routerIp, "  sysName:", infos[BMP_INFO_TYPE_SYS_NAME])
+	case BMP_MSG_TYPE_PEER_UP:
+		perPeerHeader, err := parsePerPeerHeader(body)
+		if err != nil {
+			return err
+		}
+		s.mutex.Lock()
+		peer := s.getOrNewPeer(routerIp, perPeerHeader)
+		peer.upTime = perPeerHeader.Timestamp
+		s.mutex.Unlock()
+		belogs.Info("processMessage(): peer up, routerIp:", routerIp, "  peerIp:", perPeerHeader.PeerIp, "  peerAsn:", perPeerHeader.PeerAsn)
+	case BMP_MSG_TYPE_PEER_DOWN:
+		perPeerHeader, err := parsePerPeerHeader(body)
+		if err != nil {
+			return err
+		}
+		// pre-policy and post-policy are both down
+		s.mutex.Lock()
+		for _, isPostPolicy := range []bool{false, true} {
+			delete(s.peers, peerKey{routerIp: routerIp, peerDistinguisher: perPeerHeader.PeerDistinguisher,
+				peerIp: perPeerHeader.PeerIp, isPostPolicy: isPostPolicy})
+		}
+		s.mutex.Unlock()
+		belogs.Info("processMessage(): peer down, routerIp:", routerIp, "  peerIp:", perPeerHeader.PeerIp, "  peerAsn:", perPeerHeader.PeerAsn)
+	case BMP_MSG_TYPE_ROUTE_MONITORING:
+		perPeerHeader, err := parsePerPeerHeader(body)
+		if err != nil {
+			return err
+		}
+		bgpUpdate, err := parseBgpUpdate(body[BMP_PER_PEER_HEADER_LENGTH:], perPeerHeader.PeerFlags&BMP_PEER_FLAG_AS2 == 0)
+		if err != nil {
+			return err
+		}
+		s.updateRoutes(routerIp, perPeerHeader, bgpUpdate)
+	case BMP_MSG_TYPE_TERMINATION:
+		belogs.Info("processMessage(): termination, routerIp:", routerIp)
+	default:
+		// statistics report and route mirroring are not used in rov
+		belogs.Debug("processMessage(): ignore, routerIp:", routerIp, "  type:", commonHeader.Type)
+	}
+	return nil
+}
+
+// should be in lock
+func (s *BmpServer) getOrNewPeer(routerIp string, perPeerHeader BmpPerPeerHeader) *bmpPeer {
+	key := peerKey{routerIp: routerIp, peerDistinguisher: perPeerHeader.PeerDistinguisher,
+		peerIp: perPeerHeader.PeerIp, isPostPolicy: perPeerHeader.PeerFlags&BMP_PEER_FLAG_POST_POLICY != 0}
+	peer, ok := s.peers[key]
+	if !ok {
+		peer = &bmpPeer{key: key, routes: make(map[netip.Prefix]*BmpRoute)}
+		s.peers[key] = peer
+	}
+	peer.peerAsn = perPeerHeader.PeerAsn
+	peer.peerBgpId = perPeerHeader.PeerBgpId
+	return peer
+}
+
+func (s *BmpServer) updateRoutes(routerIp string, perPeerHeader BmpPerPeerHeader, bgpUpdate BgpUpdate) {
+	now := time.Now()
+	originAsn, hasOrigin := bgpUpdate.AsPath.OriginAsn()
+	asPath := bgpUpdate.AsPath.String()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	peer := s.getOrNewPeer(routerIp, perPeerHeader)
+	for _, prefix := range bgpUpdate.Withdrawn {
+		route, ok := peer.routes[prefix]
+		if !ok {
+			continue
+		}
+		delete(peer.routes, prefix)
+		s.addStateChange(peer, route, route.RovState, BMP_STATE_NONE, now)
+	}
+	for _, prefix := range bgpUpdate.Announced {
+		rovResult := s.vrpSet.ValidateOrigin(prefix, originAsn, hasOrigin)
+		oldState := BMP_STATE_NONE
+		if route, ok := peer.routes[prefix]; ok {
+			oldState = route.RovState
+		}
+		route := &BmpRoute{Prefix: prefix, AsPath: asPath, OriginAsn: originAsn, HasOrigin: hasOrigin,
+			RovState: rovResult.State, RovReason: rovResult.Reason, UpdateTime: now}
+		peer.routes[prefix] = route
+		if oldState != route.RovState {
+			s.addStateChange(peer, route, oldState, route.RovState, now)
+		}
+	}
+}
+
+// revalidate all routes by new vrps, and record the changed
+func (s *BmpServer) UpdateVrpSet(vrpSet *validate.VrpSet) {
+	start := time.Now()
+	now := time.Now()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.vrpSet = vrpSet
+	var routeCount, changedCount uint64
+	for _, peer := range s.peers {
+		for _, route := range peer.routes {
+			routeCount++
+			rovResult := vrpSet.ValidateOrigin(route.Prefix, route.OriginAsn, route.HasOrigin)
+			if rovResult.State == route.RovState {
+				route.RovReason = rovResult.Reason
+				continue
+			}
+			changedCount++
+			oldState := route.RovState
+			route.RovState = rovResult.State
+			route.RovReason = rovResult.Reason
+			s.addStateChange(peer, route, oldState, route.RovState, now)
+		}
+	}
+	belogs.Info("UpdateVrpSet(): serialNumber:", vrpSet.SerialNumber, "  vrpSet.Count:", vrpSet.Count,
+		"  routeCount:", routeCount, "  changedCount:", changedCount, "  time(s):", time.Since(start))
+}
+
+// should be in lock
+func (s *BmpServer) addStateChange(peer *bmpPeer, route *BmpRoute, oldState, newState string, changeTime time.Time) {
+	s.stateChanges = append(s.stateChanges, BmpStateChange{
+		SerialNumber: s.vrpSet.SerialNumber,
+		ChangeTime:   changeTime,
+		RouterIp:     peer.key.routerIp,
+		PeerIp:       peer.key.peerIp.String(),
+		PeerAsn:      peer.peerAsn,
+		IsPostPolicy: peer.key.isPostPolicy,
+		Prefix:       route.Prefix.String(),
+		OriginAsn:    route.OriginAsn,
+		OldState:     oldState,
+		NewState:     newState,
+	})
+	// trim only when twice the limit is reached, so it is not copied on every change.
+	// GetStateChanges only returns the latest maxStateChanges
+	if len(s.stateChanges) >= 2*s.maxStateChanges {
+		n := copy(s.stateChanges, s.stateChanges[len(s.stateChanges)-s.maxStateChanges:])
+		s.stateChanges = s.stateChanges[:n]
+	}
+}
+
+// when router is disconnected, its Adj-RIB-In are removed
+func (s *BmpServer) removeRouter(conn net.Conn, routerIp string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.conns, conn)
+	delete(s.routers, routerIp)
+	for key := range s.peers {
+		if key.routerIp == routerIp {
+			delete(s.peers, key)
+		}
+	}
+}
+
+func (s *BmpServer) GetPeers() []BmpPeerSummary {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	peerSummarys := make([]BmpPeerSummary, 0, len(s.peers))
+	for _, peer := range s.peers {
+		peerSummary := BmpPeerSummary{
+			RouterIp:          peer.key.routerIp,
+			PeerIp:            peer.key.peerIp.String(),
+			PeerAsn:           peer.peerAsn,
+			PeerBgpId:         peer.peerBgpId.String(),
+			PeerDistinguisher: peer.key.peerDistinguisher,
+			IsPostPolicy:      peer.key.isPostPolicy,
+			UpTime:            peer.upTime,
+			RouteCount:        uint64(len(peer.routes)),
+		}
+		if router, ok := s.routers[peer.key.routerIp]; ok {
+			peerSummary.SysName = router.SysName
+		}
+		for _, route := range peer.routes {
+			switch route.RovState {
+			case validate.ROV_STATE_VALID:
+				peerSummary.ValidCount++
+			case validate.ROV_STATE_INVALID:
+				peerSummary.InvalidCount++
+			default:
+				peerSummary.NotFoundCount++
+			}
+		}
+		peerSummarys = append(peerSummarys, peerSummary)
+	}
+	sort.Slice(peerSummarys, func(i, j int) bool {
+		if peerSummarys[i].RouterIp != peerSummarys[j].RouterIp {
+			return peerSummarys[i].RouterIp < peerSummarys[j].RouterIp
+		}
+		if peerSummarys[i].PeerIp != peerSummarys[j].PeerIp {
+			return peerSummarys[i].PeerIp < peerSummarys[j].PeerIp
+		}
+		return !peerSummarys[i].IsPostPolicy && peerSummarys[j].IsPostPolicy
+	})
+	return peerSummarys
+}
+
+// invalid routes of every peer, routerIp and peerIp are filters, empty means all
+func (s *BmpServer) GetInvalidRoutes(routerIp, peerIp string) []BmpPeerRoutes {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	peerRoutess := make([]BmpPeerRoutes, 0)
+	for _, peer := range s.peers {
+		if (routerIp != "" && routerIp != peer.key.routerIp) || (peerIp != "" && peerIp != peer.key.peerIp.String()) {
+			continue
+		}
+		peerRoutes := BmpPeerRoutes{RouterIp: peer.key.routerIp, PeerIp: peer.key.peerIp.String(),
+			PeerAsn: peer.peerAsn, IsPostPolicy: peer.key.isPostPolicy, Routes: make([]BmpRoute, 0)}
+		for _, route := range peer.routes {
+			if route.RovState == validate.ROV_STATE_INVALID {
+				peerRoutes.Routes = append(peerRoutes.Routes, *route)
+			}
+		}
+		if len(peerRoutes.Routes) == 0 {
+			continue
+		}
+		sort.Slice(peerRoutes.Routes, func(i, j int) bool {
+			return peerRoutes.Routes[i].Prefix.String() < peerRoutes.Routes[j].Prefix.String()
+		})
+		peerRoutess = append(peerRoutess, peerRoutes)
+	}
+	sort.Slice(peerRoutess, func(i, j int) bool {
+		if peerRoutess[i].RouterIp != peerRoutess[j].RouterIp {
+			return peerRoutess[i].RouterIp < peerRoutess[j].RouterIp
+		}
+		return peerRoutess[i].PeerIp < peerRoutess[j].PeerIp
+	})
+	return peerRoutess
+}
+
+// state changes after serialNumber, that is, under the later serials.
+// only the latest bmp::maxStateChanges are kept
+func (s *BmpServer) GetStateChanges(serialNumber uint64) []BmpStateChange {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	stateChanges := make([]BmpStateChange, 0)
+	start := 0
+	if len(s.stateChanges) > s.maxStateChanges {
+		start = len(s.stateChanges) - s.maxStateChanges
+	}
+	for i := start; i < len(s.stateChanges); i++ {
+		if s.stateChanges[i].SerialNumber > serialNumber {
+			stateChanges = append(stateChanges, s.stateChanges[i])
+		}
+	}
+	return stateChanges
+}
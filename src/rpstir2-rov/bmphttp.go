@@ -0,0 +1,60 @@
+package rov
+
+import (
+	"errors"
+
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/ginserver"
+	"github.com/cpusoft/goutil/jsonutil"
+	"github.com/gin-gonic/gin"
+	"rpstir2-rov/bmp"
+)
+
+// peers of all bmp routers, and count of routes in every rov state
+func BmpPeers(c *gin.Context) {
+	belogs.Debug("BmpPeers(): start")
+	if bmp.BmpTcpServer == nil {
+		belogs.Error("BmpPeers(): BmpTcpServer is nil, check bmp::enable")
+		ginserver.ResponseFail(c, errors.New("bmp server is not started, check bmp::enable"), "")
+		return
+	}
+	ginserver.ResponseOk(c, bmp.BmpTcpServer.GetPeers())
+}
+
+// invalid routes per peer, {"routerIp":"","peerIp":""}, empty means all
+func BmpInvalidRoutes(c *gin.Context) {
+	belogs.Debug("BmpInvalidRoutes(): start")
+	bmpInvalidRoutesRequest := bmp.BmpInvalidRoutesRequest{}
+	err := c.ShouldBindJSON(&bmpInvalidRoutesRequest)
+	if err != nil {
+		belogs.Error("BmpInvalidRoutes(): ShouldBindJSON fail:", err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	if bmp.BmpTcpServer == nil {
+		belogs.Error("BmpInvalidRoutes(): BmpTcpServer is nil, check bmp::enable")
+		ginserver.ResponseFail(c, errors.New("bmp server is not started, check bmp::enable"), "")
+		return
+	}
+	belogs.Debug("BmpInvalidRoutes(): bmpInvalidRoutesRequest:", jsonutil.MarshalJson(bmpInvalidRoutesRequest))
+	ginserver.ResponseOk(c, bmp.BmpTcpServer.GetInvalidRoutes(bmpInvalidRoutesRequest.RouterIp, bmpInvalidRoutesRequest.PeerIp))
+}
+
+// rov state changes after serialNumber, {"serialNumber":10}
+func BmpStateChanges(c *gin.Context) {
+	belogs.Debug("BmpStateChanges(): start")
+	bmpStateChangesRequest := bmp.BmpStateChangesRequest{}
+	err := c.ShouldBindJSON(&bmpStateChangesRequest)
+	if err != nil {
+		belogs.Error("BmpStateChanges(): ShouldBindJSON fail:", err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	if bmp.BmpTcpServer == nil {
+		belogs.Error("BmpStateChanges(): BmpTcpServer is nil, check bmp::enable")
+		ginserver.ResponseFail(c, errors.New("bmp server is not started, check bmp::enable"), "")
+		return
+	}
+	belogs.Debug("BmpStateChanges(): serialNumber:", bmpStateChangesRequest.SerialNumber)
+	ginserver.ResponseOk(c, bmp.BmpTcpServer.GetStateChanges(bmpStateChangesRequest.SerialNumber))
+}
@@ -0,0 +1,3 @@
+module rpstir2-rov
+
+go 1.19
@@ -0,0 +1,170 @@
+package impact
+
+import (
+	"errors"
+	"net/netip"
+	"sort"
+	"time"
+
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/jsonutil"
+	"rpstir2-rov/mrt"
+	"rpstir2-rov/validate"
+)
+
+type rovPairKey struct {
+	prefix    netip.Prefix
+	originAsn uint32
+	hasOrigin bool
+}
+
+type rovPair struct {
+	rovResult       validate.RovResult
+	rovInvalidRoute *RovInvalidRoute
+}
+
+type aspaPair struct {
+	aspaResult       validate.AspaResult
+	aspaInvalidRoute *AspaInvalidRoute
+}
+
+// analyze mrt file by current vrps and aspas in lab_rpki_rtr_full/lab_rpki_rtr_asa_full
+func AnalyzeMrtFile(mrtFile string, impactOption ImpactOption) (impactResult *ImpactResult, err error) {
+	start := time.Now()
+	belogs.Info("AnalyzeMrtFile(): mrtFile:", mrtFile, "  impactOption:", jsonutil.MarshalJson(impactOption))
+
+	vrpSet, err := validate.GetVrpSetDb()
+	if err != nil {
+		belogs.Error("AnalyzeMrtFile(): GetVrpSetDb fail:", err)
+		return nil, err
+	}
+	aspaSet, err := validate.GetAspaSetDb()
+	if err != nil {
+		belogs.Error("AnalyzeMrtFile(): GetAspaSetDb fail:", err)
+		return nil, err
+	}
+
+	impactResult, err = AnalyzeMrtFileBySets(mrtFile, vrpSet, aspaSet, impactOption)
+	if err != nil {
+		belogs.Error("AnalyzeMrtFile(): AnalyzeMrtFileBySets fail, mrtFile:", mrtFile, err)
+		return nil, err
+	}
+	belogs.Info("AnalyzeMrtFile(): mrtFile:", mrtFile, "  rovSummary:", jsonutil.MarshalJson(impactResult.RovSummary),
+		"  aspaSummary:", jsonutil.MarshalJson(impactResult.AspaSummary), "  time(s):", time.Since(start))
+	return impactResult, nil
+}
+
+func AnalyzeMrtFileBySets(mrtFile string, vrpSet *validate.VrpSet, aspaSet *validate.AspaSet,
+	impactOption ImpactOption) (impactResult *ImpactResult, err error) {
+
+	if impactOption.AspaDirection == "" {
+		impactOption.AspaDirection = validate.ASPA_DIRECTION_UPSTREAM
+	}
+	if impactOption.AspaDirection != validate.ASPA_DIRECTION_UPSTREAM &&
+		impactOption.AspaDirection != validate.ASPA_DIRECTION_DOWNSTREAM {
+		belogs.Error("AnalyzeMrtFileBySets(): aspaDirection is error:", impactOption.AspaDirection)
+		return nil, errors.New("aspaDirection should be upstream or downstream")
+	}
+
+	impactResult = &ImpactResult{
+		MrtFile:           mrtFile,
+		AnalyzeTime:       time.Now(),
+		SerialNumber:      vrpSet.SerialNumber,
+		VrpCount:          vrpSet.Count,
+		AspaCount:         aspaSet.Count,
+		AspaDirection:     impactOption.AspaDirection,
+		RovSummary:        newImpactSummary(),
+		AspaSummary:       newImpactSummary(),
+		RovInvalidRoutes:  make([]*RovInvalidRoute, 0),
+		AspaInvalidRoutes: make([]*AspaInvalidRoute, 0),
+	}
+	rovPairs := make(map[rovPairKey]*rovPair)
+	aspaPairs := make(map[string]*aspaPair)
+
+	impactResult.MrtStat, err = mrt.ParseMrtFile(mrtFile, func(ribRoute *mrt.RibRoute) error {
+		asPathStr := ribRoute.AsPathString()
+		originAsn, hasOrigin := ribRoute.OriginAsn()
+
+		// rov
+		key := rovPairKey{prefix: ribRoute.Prefix, originAsn: originAsn, hasOrigin: hasOrigin}
+		rp, ok := rovPairs[key]
+		if !ok {
+			rp = &rovPair{rovResult: vrpSet.ValidateOrigin(ribRoute.Prefix, originAsn, hasOrigin)}
+			rovPairs[key] = rp
+			impactResult.RovSummary.PairCountByState[rp.rovResult.State]++
+			if rp.rovResult.State == validate.ROV_STATE_INVALID {
+				impactResult.RovSummary.PairCountByReason[rp.rovResult.Reason]++
+				if impactOption.MaxInvalidRoutes <= 0 || len(impactResult.RovInvalidRoutes) < impactOption.MaxInvalidRoutes {
+					rp.rovInvalidRoute = &RovInvalidRoute{
+						Prefix:       ribRoute.Prefix.String(),
+						OriginAsn:    originAsn,
+						HasOrigin:    hasOrigin,
+						Reason:       rp.rovResult.Reason,
+						CoveringVrps: rp.rovResult.CoveringVrps,
+						SampleAsPath: asPathStr,
+					}
+					impactResult.RovInvalidRoutes = append(impactResult.RovInvalidRoutes, rp.rovInvalidRoute)
+				} else {
+					impactResult.Truncated = true
+				}
+			}
+		}
+		impactResult.RovSummary.RouteCountByState[rp.rovResult.State]++
+		if rp.rovInvalidRoute != nil {
+			rp.rovInvalidRoute.PeerCount++
+		}
+
+		// aspa
+		aspaKey := ribRoute.Prefix.String() + " " + asPathStr
+		ap, ok := aspaPairs[aspaKey]
+		if !ok {
+			asPath, hasAsSet := ribRoute.FlatAsPath()
+			ap = &aspaPair{aspaResult: aspaSet.ValidateAspa(asPath, hasAsSet, ribRoute.Prefix.Addr().Is6(), impactOption.AspaDirection)}
+			aspaPairs[aspaKey] = ap
+			impactResult.AspaSummary.PairCountByState[ap.aspaResult.State]++
+			if ap.aspaResult.State == validate.ASPA_STATE_INVALID {
+				impactResult.AspaSummary.PairCountByReason[ap.aspaResult.Reason]++
+				if impactOption.MaxInvalidRoutes <= 0 || len(impactResult.AspaInvalidRoutes) < impactOption.MaxInvalidRoutes {
+					ap.aspaInvalidRoute = &AspaInvalidRoute{
+						Prefix:      ribRoute.Prefix.String(),
+						AsPath:      asPathStr,
+						OriginAsn:   originAsn,
+						Reason:      ap.aspaResult.Reason,
+						CustomerAsn: ap.aspaResult.CustomerAsn,
+						ProviderAsn: ap.aspaResult.ProviderAsn,
+					}
+					impactResult.AspaInvalidRoutes = append(impactResult.AspaInvalidRoutes, ap.aspaInvalidRoute)
+				} else {
+					impactResult.Truncated = true
+				}
+			}
+		}
+		impactResult.AspaSummary.RouteCountByState[ap.aspaResult.State]++
+		if ap.aspaInvalidRoute != nil {
+			ap.aspaInvalidRoute.PeerCount++
+		}
+		return nil
+	})
+	if err != nil {
+		belogs.Error("AnalyzeMrtFileBySets(): ParseMrtFile fail, mrtFile:", mrtFile, err)
+		return nil, err
+	}
+
+	sort.SliceStable(impactResult.RovInvalidRoutes, func(i, j int) bool {
+		return impactResult.RovInvalidRoutes[i].PeerCount > impactResult.RovInvalidRoutes[j].PeerCount
+	})
+	sort.SliceStable(impactResult.AspaInvalidRoutes, func(i, j int) bool {
+		return impactResult.AspaInvalidRoutes[i].PeerCount > impactResult.AspaInvalidRoutes[j].PeerCount
+	})
+	belogs.Debug("AnalyzeMrtFileBySets(): mrtFile:", mrtFile, "  len(rovPairs):", len(rovPairs),
+		"  len(aspaPairs):", len(aspaPairs), "  mrtStat:", jsonutil.MarshalJson(impactResult.MrtStat))
+	return impactResult, nil
+}
+
+func newImpactSummary() ImpactSummary {
+	return ImpactSummary{
+		RouteCountByState: make(map[string]uint64),
+		PairCountByState:  make(map[string]uint64),
+		PairCountByReason: make(map[string]uint64),
+	}
+}
@@ -0,0 +1,64 @@
+package impact
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/cpusoft/goutil/belogs"
+	"rpstir2-rov/validate"
+)
+
+var impactCsvHeader = []string{"check", "prefix", "originAsn", "asPath", "reason",
+	"responsible", "peerCount"}
+
+// one line for every invalid route, rov and aspa are in the same file.
+// responsible: vrps as "asn prefix-maxLength" for rov, "customerAsn->providerAsn" for aspa
+func WriteImpactCsv(w io.Writer, impactResult *ImpactResult) (err error) {
+	csvWriter := csv.NewWriter(w)
+	err = csvWriter.Write(impactCsvHeader)
+	if err != nil {
+		belogs.Error("WriteImpactCsv(): write header fail:", err)
+		return err
+	}
+	for _, r := range impactResult.RovInvalidRoutes {
+		err = csvWriter.Write([]string{"rov", r.Prefix, formatOriginAsn(r.OriginAsn, r.HasOrigin),
+			r.SampleAsPath, r.Reason, FormatVrps(r.CoveringVrps), strconv.FormatUint(r.PeerCount, 10)})
+		if err != nil {
+			belogs.Error("WriteImpactCsv(): write rov fail:", r.Prefix, err)
+			return err
+		}
+	}
+	for _, r := range impactResult.AspaInvalidRoutes {
+		responsible := ""
+		if r.Reason != validate.ASPA_REASON_AS_SET {
+			responsible = strconv.FormatUint(uint64(r.CustomerAsn), 10) + "->" + strconv.FormatUint(uint64(r.ProviderAsn), 10)
+		}
+		err = csvWriter.Write([]string{"aspa", r.Prefix, strconv.FormatUint(uint64(r.OriginAsn), 10),
+			r.AsPath, r.Reason, responsible, strconv.FormatUint(r.PeerCount, 10)})
+		if err != nil {
+			belogs.Error("WriteImpactCsv(): write aspa fail:", r.Prefix, err)
+			return err
+		}
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// "AS64496 192.0.2.0/24-24;AS64497 192.0.2.0/23-24"
+func FormatVrps(vrps []validate.Vrp) string {
+	s := make([]string, 0, len(vrps))
+	for i := range vrps {
+		s = append(s, "AS"+strconv.FormatUint(uint64(vrps[i].Asn), 10)+" "+
+			vrps[i].Prefix.String()+"-"+strconv.Itoa(vrps[i].MaxLength))
+	}
+	return strings.Join(s, ";")
+}
+
+func formatOriginAsn(originAsn uint32, hasOrigin bool) string {
+	if !hasOrigin {
+		return ""
+	}
+	return strconv.FormatUint(uint64(originAsn), 10)
+}
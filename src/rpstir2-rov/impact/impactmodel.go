@@ -0,0 +1,71 @@
+package impact
+
+import (
+	"time"
+
+	"rpstir2-rov/mrt"
+	"rpstir2-rov/validate"
+)
+
+type ImpactOption struct {
+	// upstream/downstream, default is upstream
+	AspaDirection string `json:"aspaDirection"`
+	// max count of invalid routes in drill-down lists, 0 means no limit
+	MaxInvalidRoutes int `json:"maxInvalidRoutes"`
+}
+
+// local mrt file path, or upload file by multipart
+type ImpactRequest struct {
+	MrtFile string `json:"mrtFile"`
+	ImpactOption
+}
+
+// route: prefix+peer; pair: prefix+originAsn for rov, prefix+asPath for aspa
+type ImpactSummary struct {
+	RouteCountByState map[string]uint64 `json:"routeCountByState"`
+	PairCountByState  map[string]uint64 `json:"pairCountByState"`
+	// only for invalid
+	PairCountByReason map[string]uint64 `json:"pairCountByReason"`
+}
+
+type RovInvalidRoute struct {
+	Prefix    string `json:"prefix"`
+	OriginAsn uint32 `json:"originAsn"`
+	// false when as_path is empty or ends with AS_SET
+	HasOrigin bool `json:"hasOrigin"`
+	// invalidAsn/invalidLength/noOrigin
+	Reason string `json:"reason"`
+	// vrps which make this route invalid
+	CoveringVrps []validate.Vrp `json:"coveringVrps"`
+	PeerCount    uint64         `json:"peerCount"`
+	SampleAsPath string         `json:"sampleAsPath"`
+}
+
+type AspaInvalidRoute struct {
+	Prefix    string `json:"prefix"`
+	AsPath    string `json:"asPath"`
+	OriginAsn uint32 `json:"originAsn"`
+	Reason    string `json:"reason"`
+	// the hop customerAsn-->providerAsn which is not attested
+	CustomerAsn uint32 `json:"customerAsn"`
+	ProviderAsn uint32 `json:"providerAsn"`
+	PeerCount   uint64 `json:"peerCount"`
+}
+
+type ImpactResult struct {
+	MrtFile       string      `json:"mrtFile"`
+	AnalyzeTime   time.Time   `json:"analyzeTime"`
+	SerialNumber  uint64      `json:"serialNumber"`
+	VrpCount      uint64      `json:"vrpCount"`
+	AspaCount     uint64      `json:"aspaCount"`
+	AspaDirection string      `json:"aspaDirection"`
+	MrtStat       mrt.MrtStat `json:"mrtStat"`
+
+	RovSummary  ImpactSummary `json:"rovSummary"`
+	AspaSummary ImpactSummary `json:"aspaSummary"`
+
+	RovInvalidRoutes  []*RovInvalidRoute  `json:"rovInvalidRoutes"`
+	AspaInvalidRoutes []*AspaInvalidRoute `json:"aspaInvalidRoutes"`
+	// when invalid routes are more than MaxInvalidRoutes
+	Truncated bool `json:"truncated"`
+}
@@ -0,0 +1,223 @@
+package irr
+
+import (
+	"net/netip"
+	"sort"
+	"time"
+
+	"github.com/cpusoft/goutil/belogs"
+	"rpstir2-rov/validate"
+)
+
+// compare route objects in rpsl files with current vrps in lab_rpki_rtr_full
+func ReportIrrFiles(rpslFiles []string) (irrReport *IrrReport, err error) {
+	start := time.Now()
+	belogs.Info("ReportIrrFiles(): rpslFiles:", rpslFiles)
+
+	vrpSet, err := validate.GetVrpSetDb()
+	if err != nil {
+		belogs.Error("ReportIrrFiles(): GetVrpSetDb fail:", err)
+		return nil, err
+	}
+
+	routeObjects := make([]*RouteObject, 0)
+	var rpslStat RpslStat
+	for _, rpslFile := range rpslFiles {
+		stat, err := ParseRpslFile(rpslFile, func(routeObject *RouteObject) {
+			routeObjects = append(routeObjects, routeObject)
+		})
+		if err != nil {
+			belogs.Error("ReportIrrFiles(): ParseRpslFile fail, rpslFile:", rpslFile, err)
+			return nil, err
+		}
+		rpslStat.ObjectCount += stat.ObjectCount
+		rpslStat.RouteObjectCount += stat.RouteObjectCount
+		rpslStat.ErrorCount += stat.ErrorCount
+	}
+
+	irrReport = ReportIrrByVrpSet(routeObjects, vrpSet)
+	irrReport.RpslFiles = rpslFiles
+	irrReport.RpslStat = rpslStat
+	belogs.Info("ReportIrrFiles(): rpslFiles:", rpslFiles, "  routeObjectCount:", len(routeObjects),
+		"  len(invalidRouteObjects):", len(irrReport.InvalidRouteObjects), "  len(uncoveredVrps):", len(irrReport.UncoveredVrps),
+		"  len(originMismatches):", len(irrReport.OriginMismatches), "  time(s):", time.Since(start))
+	return irrReport, nil
+}
+
+func ReportIrrByVrpSet(routeObjects []*RouteObject, vrpSet *validate.VrpSet) (irrReport *IrrReport) {
+	irrReport = &IrrReport{
+		ReportTime:          time.Now(),
+		SerialNumber:        vrpSet.SerialNumber,
+		VrpCount:            vrpSet.Count,
+		InvalidRouteObjects: make([]InvalidRouteObject, 0),
+		UncoveredVrps:       make([]validate.Vrp, 0),
+		OriginMismatches:    make([]OriginMismatch, 0),
+	}
+	originAsnGroups := make(map[uint32]*OriginAsnGroup)
+	maintainerGroups := make(map[string]*MaintainerGroup)
+	getOriginAsnGroup := func(originAsn uint32) *OriginAsnGroup {
+		g, ok := originAsnGroups[originAsn]
+		if !ok {
+			g = &OriginAsnGroup{OriginAsn: originAsn}
+			originAsnGroups[originAsn] = g
+		}
+		return g
+	}
+	getMaintainerGroup := func(maintainer string) *MaintainerGroup {
+		g, ok := maintainerGroups[maintainer]
+		if !ok {
+			g = &MaintainerGroup{Maintainer: maintainer}
+			maintainerGroups[maintainer] = g
+		}
+		return g
+	}
+
+	// vrps which are covered by route object of the same asn
+	coveredVrps := make(map[validate.Vrp]struct{})
+	// route objects on the same prefix as vrp
+	exactRouteObjects := make(map[netip.Prefix][]*RouteObject)
+	for _, routeObject := range routeObjects {
+		getOriginAsnGroup(routeObject.OriginAsn).RouteObjectCount++
+		for _, m := range routeObject.Maintainers {
+			getMaintainerGroup(m).RouteObjectCount++
+		}
+
+		rovResult := vrpSet.ValidateOrigin(routeObject.Prefix, routeObject.OriginAsn, true)
+		isExact := false
+		for _, vrp := range rovResult.CoveringVrps {
+			if vrp.Asn == routeObject.OriginAsn && routeObject.Prefix.Bits() <= vrp.MaxLength {
+				coveredVrps[vrp] = struct{}{}
+			}
+			if vrp.Prefix == routeObject.Prefix {
+				isExact = true
+			}
+		}
+		if isExact {
+			exactRouteObjects[routeObject.Prefix] = append(exactRouteObjects[routeObject.Prefix], routeObject)
+		}
+		if rovResult.State != validate.ROV_STATE_INVALID {
+			continue
+		}
+		irrReport.InvalidRouteObjects = append(irrReport.InvalidRouteObjects, InvalidRouteObject{
+			RouteObject:  *routeObject,
+			Reason:       rovResult.Reason,
+			CoveringVrps: rovResult.CoveringVrps,
+		})
+		getOriginAsnGroup(routeObject.OriginAsn).InvalidCount++
+		for _, m := range routeObject.Maintainers {
+			getMaintainerGroup(m).InvalidCount++
+		}
+	}
+
+	for _, vrp := range vrpSet.Vrps() {
+		// AS0 means no route should be originated
+		if vrp.Asn == 0 {
+			continue
+		}
+		if _, ok := coveredVrps[vrp]; ok {
+			continue
+		}
+		irrReport.UncoveredVrps = append(irrReport.UncoveredVrps, vrp)
+		getOriginAsnGroup(vrp.Asn).UncoveredVrpCount++
+	}
+
+	for prefix, exacts := range exactRouteObjects {
+		vrpAsns := make(map[uint32]struct{})
+		for _, vrp := range vrpSet.Covering(prefix) {
+			if vrp.Prefix == prefix {
+				vrpAsns[vrp.Asn] = struct{}{}
+			}
+		}
+		irrAsns := make(map[uint32]struct{})
+		maintainers := make(map[string]struct{})
+		for _, routeObject := range exacts {
+			irrAsns[routeObject.OriginAsn] = struct{}{}
+			if _, ok := vrpAsns[routeObject.OriginAsn]; ok {
+				continue
+			}
+			for _, m := range routeObject.Maintainers {
+				maintainers[m] = struct{}{}
+			}
+		}
+		mismatched := false
+		for asn := range irrAsns {
+			if _, ok := vrpAsns[asn]; !ok {
+				mismatched = true
+				getOriginAsnGroup(asn).OriginMismatchCount++
+			}
+		}
+		if !mismatched {
+			continue
+		}
+		for m := range maintainers {
+			getMaintainerGroup(m).OriginMismatchCount++
+		}
+		irrReport.OriginMismatches = append(irrReport.OriginMismatches, OriginMismatch{
+			Prefix:      prefix,
+			VrpAsns:     sortedAsns(vrpAsns),
+			IrrAsns:     sortedAsns(irrAsns),
+			Maintainers: sortedStrings(maintainers),
+		})
+	}
+
+	sort.Slice(irrReport.InvalidRouteObjects, func(i, j int) bool {
+		return lessPrefixAsn(irrReport.InvalidRouteObjects[i].Prefix, irrReport.InvalidRouteObjects[i].OriginAsn,
+			irrReport.InvalidRouteObjects[j].Prefix, irrReport.InvalidRouteObjects[j].OriginAsn)
+	})
+	sort.Slice(irrReport.UncoveredVrps, func(i, j int) bool {
+		return lessPrefixAsn(irrReport.UncoveredVrps[i].Prefix, irrReport.UncoveredVrps[i].Asn,
+			irrReport.UncoveredVrps[j].Prefix, irrReport.UncoveredVrps[j].Asn)
+	})
+	sort.Slice(irrReport.OriginMismatches, func(i, j int) bool {
+		return lessPrefixAsn(irrReport.OriginMismatches[i].Prefix, 0, irrReport.OriginMismatches[j].Prefix, 0)
+	})
+
+	// only groups which have problems
+	irrReport.OriginAsnGroups = make([]OriginAsnGroup, 0)
+	for _, g := range originAsnGroups {
+		if g.InvalidCount > 0 || g.UncoveredVrpCount > 0 || g.OriginMismatchCount > 0 {
+			irrReport.OriginAsnGroups = append(irrReport.OriginAsnGroups, *g)
+		}
+	}
+	sort.Slice(irrReport.OriginAsnGroups, func(i, j int) bool {
+		return irrReport.OriginAsnGroups[i].OriginAsn < irrReport.OriginAsnGroups[j].OriginAsn
+	})
+	irrReport.MaintainerGroups = make([]MaintainerGroup, 0)
+	for _, g := range maintainerGroups {
+		if g.InvalidCount > 0 || g.OriginMismatchCount > 0 {
+			irrReport.MaintainerGroups = append(irrReport.MaintainerGroups, *g)
+		}
+	}
+	sort.Slice(irrReport.MaintainerGroups, func(i, j int) bool {
+		return irrReport.MaintainerGroups[i].Maintainer < irrReport.MaintainerGroups[j].Maintainer
+	})
+	return irrReport
+}
+
+func lessPrefixAsn(p1 netip.Prefix, asn1 uint32, p2 netip.Prefix, asn2 uint32) bool {
+	if c := p1.Addr().Compare(p2.Addr()); c != 0 {
+		return c < 0
+	}
+	if p1.Bits() != p2.Bits() {
+		return p1.Bits() < p2.Bits()
+	}
+	return asn1 < asn2
+}
+
+func sortedAsns(m map[uint32]struct{}) []uint32 {
+	asns := make([]uint32, 0, len(m))
+	for asn := range m {
+		asns = append(asns, asn)
+	}
+	sort.Slice(asns, func(i, j int) bool { return asns[i] < asns[j] })
+	return asns
+}
+
+func sortedStrings(m map[string]struct{}) []string {
+	s := make([]string, 0, len(m))
+	for k := range m {
+		s = append(s, k)
+	}
+	sort.Strings(s)
+	return s
+}
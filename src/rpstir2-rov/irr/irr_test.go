@@ -0,0 +1,73 @@
+package irr
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"rpstir2-rov/validate"
+)
+
+const testRpsl = `% comment
+route:          192.0.2.0/24
+descr:          valid
+origin:         AS64496
+mnt-by:         MAINT-A
+source:         RADB
+
+route:          192.0.2.0/24
+descr:          wrong origin
+origin:         AS64511 # old upstream
+mnt-by:         MAINT-B, MAINT-C
+source:         RADB
+
+route:          192.0.2.0/25
+origin:         AS64496
+mnt-by:         MAINT-A
+source:         RADB
+
+route6:         2001:db8::/32
+origin:         AS64497
+mnt-by:         MAINT-A
+source:         RIPE
+
+aut-num:        AS64496
+as-name:        TEST
+
+route:          198.51.100.0/24
+origin:         wrong
+`
+
+func TestReportIrrByVrpSet(t *testing.T) {
+	routeObjects := make([]*RouteObject, 0)
+	rpslStat, err := ParseRpsl(strings.NewReader(testRpsl), func(routeObject *RouteObject) {
+		routeObjects = append(routeObjects, routeObject)
+	})
+	fmt.Println(rpslStat, err)
+	if err != nil || rpslStat.ObjectCount != 6 || rpslStat.RouteObjectCount != 5 || rpslStat.ErrorCount != 1 {
+		t.Fatal("wrong rpslStat", rpslStat, err)
+	}
+
+	vrpSet := validate.NewVrpSet()
+	vrpSet.AddVrp(validate.Vrp{Asn: 64496, Prefix: netip.MustParsePrefix("192.0.2.0/24"), MaxLength: 24})
+	vrpSet.AddVrp(validate.Vrp{Asn: 64498, Prefix: netip.MustParsePrefix("203.0.113.0/24"), MaxLength: 24})
+	irrReport := ReportIrrByVrpSet(routeObjects, vrpSet)
+	fmt.Println(irrReport.InvalidRouteObjects, irrReport.UncoveredVrps, irrReport.OriginMismatches)
+	fmt.Println(irrReport.OriginAsnGroups, irrReport.MaintainerGroups)
+
+	if len(irrReport.InvalidRouteObjects) != 2 ||
+		irrReport.InvalidRouteObjects[0].Reason != validate.ROV_REASON_INVALID_ASN ||
+		irrReport.InvalidRouteObjects[1].Reason != validate.ROV_REASON_INVALID_LENGTH {
+		t.Fatal("wrong invalidRouteObjects", irrReport.InvalidRouteObjects)
+	}
+	if len(irrReport.UncoveredVrps) != 1 || irrReport.UncoveredVrps[0].Asn != 64498 {
+		t.Fatal("wrong uncoveredVrps", irrReport.UncoveredVrps)
+	}
+	if len(irrReport.OriginMismatches) != 1 || len(irrReport.OriginMismatches[0].Maintainers) != 2 {
+		t.Fatal("wrong originMismatches", irrReport.OriginMismatches)
+	}
+	if len(irrReport.MaintainerGroups) != 3 {
+		t.Fatal("wrong maintainerGroups", irrReport.MaintainerGroups)
+	}
+}
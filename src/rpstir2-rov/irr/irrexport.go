@@ -0,0 +1,61 @@
+package irr
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/cpusoft/goutil/belogs"
+	"rpstir2-rov/impact"
+	"rpstir2-rov/validate"
+)
+
+var irrCsvHeader = []string{"check", "prefix", "originAsn", "maintainers", "source", "reason", "vrps"}
+
+// one line for every problem:
+// invalid: route object is rpki invalid, vrps are the covering vrps;
+// uncovered: vrp has no route object, originAsn is asn of vrp;
+// mismatch: irr origins of the same prefix are different from vrps, originAsn are irr origins
+func WriteIrrCsv(w io.Writer, irrReport *IrrReport) (err error) {
+	csvWriter := csv.NewWriter(w)
+	err = csvWriter.Write(irrCsvHeader)
+	if err != nil {
+		belogs.Error("WriteIrrCsv(): write header fail:", err)
+		return err
+	}
+	for _, r := range irrReport.InvalidRouteObjects {
+		err = csvWriter.Write([]string{"invalid", r.Prefix.String(), strconv.FormatUint(uint64(r.OriginAsn), 10),
+			strings.Join(r.Maintainers, ";"), r.Source, r.Reason, impact.FormatVrps(r.CoveringVrps)})
+		if err != nil {
+			belogs.Error("WriteIrrCsv(): write invalid fail:", r.Prefix, err)
+			return err
+		}
+	}
+	for _, r := range irrReport.UncoveredVrps {
+		err = csvWriter.Write([]string{"uncovered", r.Prefix.String(), strconv.FormatUint(uint64(r.Asn), 10),
+			"", "", "", impact.FormatVrps([]validate.Vrp{r})})
+		if err != nil {
+			belogs.Error("WriteIrrCsv(): write uncovered fail:", r.Prefix, err)
+			return err
+		}
+	}
+	for _, r := range irrReport.OriginMismatches {
+		err = csvWriter.Write([]string{"mismatch", r.Prefix.String(), formatAsns(r.IrrAsns),
+			strings.Join(r.Maintainers, ";"), "", "vrpAsns " + formatAsns(r.VrpAsns), ""})
+		if err != nil {
+			belogs.Error("WriteIrrCsv(): write mismatch fail:", r.Prefix, err)
+			return err
+		}
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+func formatAsns(asns []uint32) string {
+	s := make([]string, 0, len(asns))
+	for _, asn := range asns {
+		s = append(s, strconv.FormatUint(uint64(asn), 10))
+	}
+	return strings.Join(s, ";")
+}
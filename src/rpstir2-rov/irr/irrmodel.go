@@ -0,0 +1,75 @@
+package irr
+
+import (
+	"net/netip"
+	"time"
+
+	"rpstir2-rov/validate"
+)
+
+// one route or route6 object in rpsl
+type RouteObject struct {
+	Prefix      netip.Prefix `json:"prefix"`
+	OriginAsn   uint32       `json:"originAsn"`
+	Maintainers []string     `json:"maintainers"`
+	Source      string       `json:"source"`
+}
+
+type RpslStat struct {
+	ObjectCount      uint64 `json:"objectCount"`
+	RouteObjectCount uint64 `json:"routeObjectCount"`
+	// route objects which have wrong prefix or origin
+	ErrorCount uint64 `json:"errorCount"`
+}
+
+// local rpsl dump files, such as radb.db.gz, ripe.db.route.gz, or upload one file by multipart
+type IrrRequest struct {
+	RpslFiles []string `json:"rpslFiles"`
+}
+
+// route object which is rpki invalid
+type InvalidRouteObject struct {
+	RouteObject
+	// invalidAsn/invalidLength
+	Reason       string         `json:"reason"`
+	CoveringVrps []validate.Vrp `json:"coveringVrps"`
+}
+
+// the same prefix has different origins in irr and in rpki
+type OriginMismatch struct {
+	Prefix      netip.Prefix `json:"prefix"`
+	VrpAsns     []uint32     `json:"vrpAsns"`
+	IrrAsns     []uint32     `json:"irrAsns"`
+	Maintainers []string     `json:"maintainers"`
+}
+
+type OriginAsnGroup struct {
+	OriginAsn           uint32 `json:"originAsn"`
+	RouteObjectCount    uint64 `json:"routeObjectCount"`
+	InvalidCount        uint64 `json:"invalidCount"`
+	UncoveredVrpCount   uint64 `json:"uncoveredVrpCount"`
+	OriginMismatchCount uint64 `json:"originMismatchCount"`
+}
+
+type MaintainerGroup struct {
+	Maintainer          string `json:"maintainer"`
+	RouteObjectCount    uint64 `json:"routeObjectCount"`
+	InvalidCount        uint64 `json:"invalidCount"`
+	OriginMismatchCount uint64 `json:"originMismatchCount"`
+}
+
+type IrrReport struct {
+	RpslFiles    []string  `json:"rpslFiles"`
+	ReportTime   time.Time `json:"reportTime"`
+	SerialNumber uint64    `json:"serialNumber"`
+	VrpCount     uint64    `json:"vrpCount"`
+	RpslStat     RpslStat  `json:"rpslStat"`
+
+	InvalidRouteObjects []InvalidRouteObject `json:"invalidRouteObjects"`
+	// vrps which have no route object of the same asn in prefix-maxLength
+	UncoveredVrps    []validate.Vrp   `json:"uncoveredVrps"`
+	OriginMismatches []OriginMismatch `json:"originMismatches"`
+
+	OriginAsnGroups  []OriginAsnGroup  `json:"originAsnGroups"`
+	MaintainerGroups []MaintainerGroup `json:"maintainerGroups"`
+}
@@ -0,0 +1,147 @@
+package irr
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cpusoft/goutil/belogs"
+)
+
+// max length of one line in rpsl, some descr/remarks are very long
+const rpslMaxLineLength = 1024 * 1024
+
+// parse route/route6 objects in rpsl file(may be .gz), call routeObjectFunc for every route object.
+// wrong route objects are counted and skipped
+func ParseRpslFile(rpslFile string, routeObjectFunc func(routeObject *RouteObject)) (rpslStat RpslStat, err error) {
+	start := time.Now()
+	belogs.Debug("ParseRpslFile(): rpslFile:", rpslFile)
+	file, err := os.Open(rpslFile)
+	if err != nil {
+		belogs.Error("ParseRpslFile(): Open fail, rpslFile:", rpslFile, err)
+		return rpslStat, err
+	}
+	defer file.Close()
+
+	bufReader := bufio.NewReader(file)
+	var reader io.Reader = bufReader
+	magic, _ := bufReader.Peek(2)
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gzipReader, err := gzip.NewReader(bufReader)
+		if err != nil {
+			belogs.Error("ParseRpslFile(): gzip NewReader fail, rpslFile:", rpslFile, err)
+			return rpslStat, err
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	}
+
+	rpslStat, err = ParseRpsl(reader, routeObjectFunc)
+	if err != nil {
+		belogs.Error("ParseRpslFile(): ParseRpsl fail, rpslFile:", rpslFile, err)
+		return rpslStat, err
+	}
+	belogs.Info("ParseRpslFile(): rpslFile:", rpslFile, "  objectCount:", rpslStat.ObjectCount,
+		"  routeObjectCount:", rpslStat.RouteObjectCount, "  errorCount:", rpslStat.ErrorCount, "  time(s):", time.Since(start))
+	return rpslStat, nil
+}
+
+// rfc2622 2: objects are separated by blank lines, "attribute: value" in one line,
+// and line which starts with space, tab or '+' continues the previous attribute
+func ParseRpsl(reader io.Reader, routeObjectFunc func(routeObject *RouteObject)) (rpslStat RpslStat, err error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), rpslMaxLineLength)
+
+	attributes := make([][2]string, 0, 16)
+	flush := func() {
+		if len(attributes) == 0 {
+			return
+		}
+		rpslStat.ObjectCount++
+		if attributes[0][0] == "route" || attributes[0][0] == "route6" {
+			rpslStat.RouteObjectCount++
+			routeObject, err := convertRouteObject(attributes)
+			if err != nil {
+				belogs.Debug("ParseRpsl(): convertRouteObject fail, skip:", attributes[0][1], err)
+				rpslStat.ErrorCount++
+			} else {
+				routeObjectFunc(routeObject)
+			}
+		}
+		attributes = attributes[:0]
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		// comments and server messages
+		if line[0] == '#' || line[0] == '%' {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' || line[0] == '+' {
+			if len(attributes) > 0 {
+				attributes[len(attributes)-1][1] += " " + strings.TrimSpace(line[1:])
+			}
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i <= 0 {
+			continue
+		}
+		attributes = append(attributes, [2]string{strings.ToLower(strings.TrimSpace(line[:i])), strings.TrimSpace(line[i+1:])})
+	}
+	if err = scanner.Err(); err != nil {
+		belogs.Error("ParseRpsl(): Scan fail:", err)
+		return rpslStat, err
+	}
+	flush()
+	return rpslStat, nil
+}
+
+func convertRouteObject(attributes [][2]string) (routeObject *RouteObject, err error) {
+	prefix, err := netip.ParsePrefix(removeRpslComment(attributes[0][1]))
+	if err != nil {
+		return nil, err
+	}
+	routeObject = &RouteObject{Prefix: prefix.Masked(), Maintainers: make([]string, 0, 1)}
+	hasOrigin := false
+	for _, attribute := range attributes[1:] {
+		value := removeRpslComment(attribute[1])
+		switch attribute[0] {
+		case "origin":
+			originAsn, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(value), "AS"), 10, 32)
+			if err != nil {
+				return nil, errors.New("origin " + value + " is wrong")
+			}
+			routeObject.OriginAsn = uint32(originAsn)
+			hasOrigin = true
+		case "mnt-by":
+			// "MAINT-A, MAINT-B" or "MAINT-A MAINT-B"
+			for _, m := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' }) {
+				routeObject.Maintainers = append(routeObject.Maintainers, strings.ToUpper(m))
+			}
+		case "source":
+			routeObject.Source = strings.ToUpper(value)
+		}
+	}
+	if !hasOrigin {
+		return nil, errors.New("there is no origin")
+	}
+	return routeObject, nil
+}
+
+func removeRpslComment(value string) string {
+	if i := strings.Index(value, "#"); i >= 0 {
+		value = value[:i]
+	}
+	return strings.TrimSpace(value)
+}
@@ -0,0 +1,71 @@
+package rov
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/ginserver"
+	"github.com/cpusoft/goutil/jsonutil"
+	"github.com/gin-gonic/gin"
+	"rpstir2-rov/irr"
+)
+
+// compare route/route6 objects in rpsl dump files with current vrps.
+// upload one file by multipart, or json {"rpslFiles":["/root/rpki/data/radb.db.gz"]}.
+// ?format=csv will export problems as csv, default is json
+func IrrReport(c *gin.Context) {
+	belogs.Info("IrrReport(): start")
+
+	irrRequest := irr.IrrRequest{}
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		tmpDir, err := os.MkdirTemp("", "IrrReport")
+		if err != nil {
+			belogs.Error("IrrReport(): MkdirTemp fail:", err)
+			ginserver.ResponseFail(c, err, "")
+			return
+		}
+		defer os.RemoveAll(tmpDir)
+		rpslFile, err := ginserver.ReceiveFile(c, tmpDir)
+		if err != nil {
+			belogs.Error("IrrReport(): ReceiveFile fail:", err)
+			ginserver.ResponseFail(c, err, "")
+			return
+		}
+		irrRequest.RpslFiles = []string{rpslFile}
+	} else {
+		err := c.ShouldBindJSON(&irrRequest)
+		if err != nil {
+			belogs.Error("IrrReport(): ShouldBindJSON fail:", err)
+			ginserver.ResponseFail(c, err, "")
+			return
+		}
+		if len(irrRequest.RpslFiles) == 0 {
+			belogs.Error("IrrReport(): rpslFiles is empty")
+			ginserver.ResponseFail(c, errors.New("rpslFiles is empty"), "")
+			return
+		}
+	}
+	belogs.Debug("IrrReport(): irrRequest:", jsonutil.MarshalJson(irrRequest))
+
+	irrReport, err := irr.ReportIrrFiles(irrRequest.RpslFiles)
+	if err != nil {
+		belogs.Error("IrrReport(): ReportIrrFiles fail:", irrRequest.RpslFiles, err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+
+	if c.Query("format") == "csv" {
+		c.Header("Content-Type", "text/csv")
+		c.Header("Content-Disposition", "attachment; filename=irrreport.csv")
+		c.Status(http.StatusOK)
+		err = irr.WriteIrrCsv(c.Writer, irrReport)
+		if err != nil {
+			belogs.Error("IrrReport(): WriteIrrCsv fail:", irrRequest.RpslFiles, err)
+		}
+		return
+	}
+	ginserver.ResponseOk(c, irrReport)
+}
@@ -0,0 +1,349 @@
+package mrt
+
+import (
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"time"
+
+	"github.com/cpusoft/goutil/belogs"
+)
+
+// max length of one mrt record, avoid to alloc too much memory by broken file
+const mrtMaxRecordLength = 16 * 1024 * 1024
+
+// parse MRT TABLE_DUMP_V2 file(may be .gz or .bz2), call ribRouteFunc for every route.
+// when ribRouteFunc return error, will stop parsing
+func ParseMrtFile(mrtFile string, ribRouteFunc func(ribRoute *RibRoute) error) (mrtStat MrtStat, err error) {
+	start := time.Now()
+	belogs.Debug("ParseMrtFile(): mrtFile:", mrtFile)
+	file, err := os.Open(mrtFile)
+	if err != nil {
+		belogs.Error("ParseMrtFile(): Open fail, mrtFile:", mrtFile, err)
+		return mrtStat, err
+	}
+	defer file.Close()
+
+	mrtStat, err = ParseMrt(file, ribRouteFunc)
+	if err != nil {
+		belogs.Error("ParseMrtFile(): ParseMrt fail, mrtFile:", mrtFile, err)
+		return mrtStat, err
+	}
+	belogs.Info("ParseMrtFile(): mrtFile:", mrtFile, "  recordCount:", mrtStat.RecordCount,
+		"  peerCount:", mrtStat.PeerCount, "  prefixCount:", mrtStat.PrefixCount,
+		"  routeCount:", mrtStat.RouteCount, "  time(s):", time.Since(start))
+	return mrtStat, nil
+}
+
+func ParseMrt(reader io.Reader, ribRouteFunc func(ribRoute *RibRoute) error) (mrtStat MrtStat, err error) {
+	bufReader, err := decompressReader(reader)
+	if err != nil {
+		belogs.Error("ParseMrt(): decompressReader fail:", err)
+		return mrtStat, err
+	}
+
+	var peerEntries []PeerEntry
+	headerBytes := make([]byte, 12)
+	body := make([]byte, 0, 4096)
+	for {
+		_, err = io.ReadFull(bufReader, headerBytes)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			belogs.Error("ParseMrt(): read header fail, recordCount:", mrtStat.RecordCount, err)
+			return mrtStat, errors.New("mrt header is truncated")
+		}
+		mrtHeader := MrtHeader{
+			Timestamp: binary.BigEndian.Uint32(headerBytes[0:4]),
+			Type:      binary.BigEndian.Uint16(headerBytes[4:6]),
+			Subtype:   binary.BigEndian.Uint16(headerBytes[6:8]),
+			Length:    binary.BigEndian.Uint32(headerBytes[8:12]),
+		}
+		if mrtHeader.Length > mrtMaxRecordLength {
+			belogs.Error("ParseMrt(): record is too long, recordCount:", mrtStat.RecordCount, " mrtHeader:", mrtHeader)
+			return mrtStat, errors.New("mrt record length is too long")
+		}
+		if cap(body) < int(mrtHeader.Length) {
+			body = make([]byte, mrtHeader.Length)
+		}
+		body = body[:mrtHeader.Length]
+		_, err = io.ReadFull(bufReader, body)
+		if err != nil {
+			belogs.Error("ParseMrt(): read body fail, recordCount:", mrtStat.RecordCount, " mrtHeader:", mrtHeader, err)
+			return mrtStat, errors.New("mrt record is truncated")
+		}
+		mrtStat.RecordCount++
+
+		if mrtHeader.Type != MRT_TYPE_TABLE_DUMP_V2 {
+			belogs.Debug("ParseMrt(): not TABLE_DUMP_V2, skip, mrtHeader:", mrtHeader)
+			mrtStat.SkipCount++
+			continue
+		}
+
+		switch mrtHeader.Subtype {
+		case TABLE_DUMP_V2_PEER_INDEX_TABLE:
+			peerEntries, err = parsePeerIndexTable(body)
+			if err != nil {
+				belogs.Error("ParseMrt(): parsePeerIndexTable fail, recordCount:", mrtStat.RecordCount, err)
+				return mrtStat, err
+			}
+			mrtStat.PeerCount = uint64(len(peerEntries))
+			belogs.Debug("ParseMrt(): len(peerEntries):", len(peerEntries))
+		case TABLE_DUMP_V2_RIB_IPV4_UNICAST, TABLE_DUMP_V2_RIB_IPV6_UNICAST,
+			TABLE_DUMP_V2_RIB_IPV4_UNICAST_ADDPATH, TABLE_DUMP_V2_RIB_IPV6_UNICAST_ADDPATH:
+			if peerEntries == nil {
+				belogs.Error("ParseMrt(): rib record is before PEER_INDEX_TABLE, recordCount:", mrtStat.RecordCount)
+				return mrtStat, errors.New("rib record is before PEER_INDEX_TABLE")
+			}
+			err = parseRibUnicast(body, mrtHeader, peerEntries, &mrtStat, ribRouteFunc)
+			if err != nil {
+				belogs.Error("ParseMrt(): parseRibUnicast fail, recordCount:", mrtStat.RecordCount, err)
+				return mrtStat, err
+			}
+		default:
+			// multicast and generic are not used in rov
+			mrtStat.SkipCount++
+		}
+	}
+	return mrtStat, nil
+}
+
+// support raw, gzip and bzip2 by magic bytes
+func decompressReader(reader io.Reader) (*bufio.Reader, error) {
+	bufReader := bufio.NewReaderSize(reader, 1024*1024)
+	magic, err := bufReader.Peek(3)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if len(magic) >= 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gzipReader, err := gzip.NewReader(bufReader)
+		if err != nil {
+			return nil, err
+		}
+		return bufio.NewReaderSize(gzipReader, 1024*1024), nil
+	}
+	if len(magic) == 3 && magic[0] == 'B' && magic[1] == 'Z' && magic[2] == 'h' {
+		return bufio.NewReaderSize(bzip2.NewReader(bufReader), 1024*1024), nil
+	}
+	return bufReader, nil
+}
+
+func parsePeerIndexTable(body []byte) (peerEntries []PeerEntry, err error) {
+	// collector bgp id(4), view name length(2)
+	if len(body) < 6 {
+		return nil, errors.New("PEER_INDEX_TABLE is truncated")
+	}
+	viewNameLength := int(binary.BigEndian.Uint16(body[4:6]))
+	pos := 6 + viewNameLength
+	if len(body) < pos+2 {
+		return nil, errors.New("PEER_INDEX_TABLE view name is truncated")
+	}
+	peerCount := int(binary.BigEndian.Uint16(body[pos : pos+2]))
+	pos += 2
+
+	peerEntries = make([]PeerEntry, 0, peerCount)
+	for i := 0; i < peerCount; i++ {
+		if len(body) < pos+5 {
+			return nil, fmt.Errorf("PEER_INDEX_TABLE peer %d is truncated", i)
+		}
+		peerEntry := PeerEntry{PeerType: body[pos]}
+		var bgpId [4]byte
+		copy(bgpId[:], body[pos+1:pos+5])
+		peerEntry.PeerBgpId = netip.AddrFrom4(bgpId)
+		pos += 5
+
+		ipLength := 4
+		if peerEntry.PeerType&PEER_TYPE_IPV6 != 0 {
+			ipLength = 16
+		}
+		asLength := 2
+		if peerEntry.PeerType&PEER_TYPE_AS4 != 0 {
+			asLength = 4
+		}
+		if len(body) < pos+ipLength+asLength {
+			return nil, fmt.Errorf("PEER_INDEX_TABLE peer %d is truncated", i)
+		}
+		peerEntry.PeerIp, _ = netip.AddrFromSlice(body[pos : pos+ipLength])
+		pos += ipLength
+		if asLength == 4 {
+			peerEntry.PeerAsn = binary.BigEndian.Uint32(body[pos : pos+4])
+		} else {
+			peerEntry.PeerAsn = uint32(binary.BigEndian.Uint16(body[pos : pos+2]))
+		}
+		pos += asLength
+		peerEntries = append(peerEntries, peerEntry)
+	}
+	return peerEntries, nil
+}
+
+func parseRibUnicast(body []byte, mrtHeader MrtHeader, peerEntries []PeerEntry,
+	mrtStat *MrtStat, ribRouteFunc func(ribRoute *RibRoute) error) (err error) {
+
+	isIpv6 := mrtHeader.Subtype == TABLE_DUMP_V2_RIB_IPV6_UNICAST ||
+		mrtHeader.Subtype == TABLE_DUMP_V2_RIB_IPV6_UNICAST_ADDPATH
+	addPath := mrtHeader.Subtype == TABLE_DUMP_V2_RIB_IPV4_UNICAST_ADDPATH ||
+		mrtHeader.Subtype == TABLE_DUMP_V2_RIB_IPV6_UNICAST_ADDPATH
+
+	// sequence number(4), prefix length(1), prefix
+	if len(body) < 5 {
+		return errors.New("rib entry header is truncated")
+	}
+	pos := 4
+	prefixLength := int(body[pos])
+	pos++
+	prefix, n, err := ParsePrefix(body[pos:], prefixLength, isIpv6)
+	if err != nil {
+		return err
+	}
+	pos += n
+	mrtStat.PrefixCount++
+
+	if len(body) < pos+2 {
+		return errors.New("rib entry count is truncated")
+	}
+	entryCount := int(binary.BigEndian.Uint16(body[pos : pos+2]))
+	pos += 2
+	for i := 0; i < entryCount; i++ {
+		// peer index(2), originated time(4), [path id(4)], attribute length(2)
+		headerLength := 8
+		if addPath {
+			headerLength = 12
+		}
+		if len(body) < pos+headerLength {
+			return fmt.Errorf("rib entry %d of %s is truncated", i, prefix)
+		}
+		ribRoute := RibRoute{Prefix: prefix}
+		ribRoute.PeerIndex = binary.BigEndian.Uint16(body[pos : pos+2])
+		ribRoute.OriginatedTime = time.Unix(int64(binary.BigEndian.Uint32(body[pos+2:pos+6])), 0)
+		pos += 6
+		if addPath {
+			ribRoute.PathId = binary.BigEndian.Uint32(body[pos : pos+4])
+			pos += 4
+		}
+		attrLength := int(binary.BigEndian.Uint16(body[pos : pos+2]))
+		pos += 2
+		if len(body) < pos+attrLength {
+			return fmt.Errorf("rib entry %d attributes of %s is truncated", i, prefix)
+		}
+		if int(ribRoute.PeerIndex) >= len(peerEntries) {
+			return fmt.Errorf("rib entry %d of %s has peer index %d out of PEER_INDEX_TABLE", i, prefix, ribRoute.PeerIndex)
+		}
+		ribRoute.Peer = peerEntries[ribRoute.PeerIndex]
+		ribRoute.AsPathSegments, err = parseAsPathFromAttributes(body[pos : pos+attrLength])
+		if err != nil {
+			return fmt.Errorf("rib entry %d of %s: %v", i, prefix, err)
+		}
+		pos += attrLength
+
+		mrtStat.RouteCount++
+		if isIpv6 {
+			mrtStat.Ipv6RouteCount++
+		} else {
+			mrtStat.Ipv4RouteCount++
+		}
+		err = ribRouteFunc(&ribRoute)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prefix is in ceil(prefixLength/8) bytes, return the count of used bytes
+func ParsePrefix(b []byte, prefixLength int, isIpv6 bool) (prefix netip.Prefix, n int, err error) {
+	maxLength := 32
+	if isIpv6 {
+		maxLength = 128
+	}
+	if prefixLength > maxLength {
+		return prefix, 0, fmt.Errorf("prefix length %d is too long", prefixLength)
+	}
+	n = (prefixLength + 7) / 8
+	if len(b) < n {
+		return prefix, 0, errors.New("prefix is truncated")
+	}
+	var addr netip.Addr
+	if isIpv6 {
+		var a [16]byte
+		copy(a[:], b[:n])
+		addr = netip.AddrFrom16(a)
+	} else {
+		var a [4]byte
+		copy(a[:], b[:n])
+		addr = netip.AddrFrom4(a)
+	}
+	return netip.PrefixFrom(addr, prefixLength).Masked(), n, nil
+}
+
+// only AS_PATH is needed. In TABLE_DUMP_V2, AS_PATH is always in 4-byte asn(rfc6396 4.3.4)
+func parseAsPathFromAttributes(b []byte) (asPath AsPath, err error) {
+	pos := 0
+	for pos < len(b) {
+		if len(b) < pos+3 {
+			return nil, errors.New("path attribute is truncated")
+		}
+		flags := b[pos]
+		attrType := b[pos+1]
+		var attrLength int
+		if flags&BGP_ATTR_FLAG_EXTENDED_LENGTH != 0 {
+			if len(b) < pos+4 {
+				return nil, errors.New("path attribute is truncated")
+			}
+			attrLength = int(binary.BigEndian.Uint16(b[pos+2 : pos+4]))
+			pos += 4
+		} else {
+			attrLength = int(b[pos+2])
+			pos += 3
+		}
+		if len(b) < pos+attrLength {
+			return nil, errors.New("path attribute value is truncated")
+		}
+		if attrType == BGP_ATTR_TYPE_AS_PATH {
+			return ParseAsPath(b[pos:pos+attrLength], true)
+		}
+		pos += attrLength
+	}
+	// no AS_PATH, such as ibgp local route
+	return make(AsPath, 0), nil
+}
+
+// asn4 is false when as_path is in 2-byte asn(rfc4271), true when in 4-byte asn(rfc6793)
+func ParseAsPath(b []byte, asn4 bool) (asPath AsPath, err error) {
+	asnLength := 2
+	if asn4 {
+		asnLength = 4
+	}
+	asPath = make(AsPath, 0, 2)
+	pos := 0
+	for pos < len(b) {
+		if len(b) < pos+2 {
+			return nil, errors.New("as_path segment is truncated")
+		}
+		segmentType := b[pos]
+		count := int(b[pos+1])
+		pos += 2
+		if len(b) < pos+asnLength*count {
+			return nil, errors.New("as_path segment asns is truncated")
+		}
+		if segmentType < AS_PATH_SEGMENT_AS_SET || segmentType > AS_PATH_SEGMENT_AS_CONFED_SET {
+			return nil, fmt.Errorf("as_path segment type %d is unknown", segmentType)
+		}
+		asPathSegment := AsPathSegment{Type: segmentType, Asns: make([]uint32, count)}
+		for i := 0; i < count; i++ {
+			if asn4 {
+				asPathSegment.Asns[i] = binary.BigEndian.Uint32(b[pos : pos+4])
+			} else {
+				asPathSegment.Asns[i] = uint32(binary.BigEndian.Uint16(b[pos : pos+2]))
+			}
+			pos += asnLength
+		}
+		asPath = append(asPath, asPathSegment)
+	}
+	return asPath, nil
+}
@@ -0,0 +1,62 @@
+package mrt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+)
+
+func mrtRecord(subtype uint16, body []byte) []byte {
+	b := make([]byte, 12)
+	binary.BigEndian.PutUint32(b[0:4], 1685577600)
+	binary.BigEndian.PutUint16(b[4:6], MRT_TYPE_TABLE_DUMP_V2)
+	binary.BigEndian.PutUint16(b[6:8], subtype)
+	binary.BigEndian.PutUint32(b[8:12], uint32(len(body)))
+	return append(b, body...)
+}
+
+func TestParseMrt(t *testing.T) {
+	// PEER_INDEX_TABLE: one ipv4 peer 192.0.2.1 AS64496
+	peer := []byte{10, 0, 0, 1, 0, 0, 0, 1}
+	peer = append(peer, PEER_TYPE_AS4, 10, 0, 0, 2, 192, 0, 2, 1, 0, 0, 0xfb, 0xf0)
+
+	// as_path: 64496 64497 64498
+	asPath := []byte{AS_PATH_SEGMENT_AS_SEQUENCE, 3, 0, 0, 0xfb, 0xf0, 0, 0, 0xfb, 0xf1, 0, 0, 0xfb, 0xf2}
+	attrs := []byte{0x40, 1, 1, 0}
+	attrs = append(attrs, 0x40, BGP_ATTR_TYPE_AS_PATH, byte(len(asPath)))
+	attrs = append(attrs, asPath...)
+
+	// RIB_IPV4_UNICAST: 198.51.100.0/24
+	rib := []byte{0, 0, 0, 0, 24, 198, 51, 100, 0, 1, 0, 0, 0x64, 0x77, 0x9b, 0x80}
+	rib = append(rib, byte(len(attrs)>>8), byte(len(attrs)))
+	rib = append(rib, attrs...)
+
+	data := append(mrtRecord(TABLE_DUMP_V2_PEER_INDEX_TABLE, peer), mrtRecord(TABLE_DUMP_V2_RIB_IPV4_UNICAST, rib)...)
+	ribRoutes := make([]RibRoute, 0)
+	mrtStat, err := ParseMrt(bytes.NewReader(data), func(ribRoute *RibRoute) error {
+		ribRoutes = append(ribRoutes, *ribRoute)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println(mrtStat, ribRoutes)
+	if mrtStat.PeerCount != 1 || mrtStat.RouteCount != 1 || len(ribRoutes) != 1 {
+		t.Fatal("mrtStat is error:", mrtStat)
+	}
+	if ribRoutes[0].Prefix.String() != "198.51.100.0/24" || ribRoutes[0].Peer.PeerAsn != 64496 ||
+		ribRoutes[0].Peer.PeerIp.String() != "192.0.2.1" {
+		t.Fatal("ribRoute is error:", ribRoutes[0])
+	}
+	originAsn, hasOrigin := ribRoutes[0].OriginAsn()
+	if !hasOrigin || originAsn != 64498 || ribRoutes[0].AsPathString() != "64496 64497 64498" {
+		t.Fatal("as_path is error:", ribRoutes[0].AsPathString())
+	}
+
+	// truncated
+	_, err = ParseMrt(bytes.NewReader(data[:len(data)-3]), func(ribRoute *RibRoute) error { return nil })
+	if err == nil {
+		t.Fatal("truncated mrt should fail")
+	}
+}
@@ -0,0 +1,156 @@
+package mrt
+
+import (
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rfc6396, rfc8050
+const (
+	MRT_TYPE_TABLE_DUMP    = 12
+	MRT_TYPE_TABLE_DUMP_V2 = 13
+
+	TABLE_DUMP_V2_PEER_INDEX_TABLE           = 1
+	TABLE_DUMP_V2_RIB_IPV4_UNICAST           = 2
+	TABLE_DUMP_V2_RIB_IPV4_MULTICAST         = 3
+	TABLE_DUMP_V2_RIB_IPV6_UNICAST           = 4
+	TABLE_DUMP_V2_RIB_IPV6_MULTICAST         = 5
+	TABLE_DUMP_V2_RIB_GENERIC                = 6
+	TABLE_DUMP_V2_RIB_IPV4_UNICAST_ADDPATH   = 8
+	TABLE_DUMP_V2_RIB_IPV4_MULTICAST_ADDPATH = 9
+	TABLE_DUMP_V2_RIB_IPV6_UNICAST_ADDPATH   = 10
+	TABLE_DUMP_V2_RIB_IPV6_MULTICAST_ADDPATH = 11
+	TABLE_DUMP_V2_RIB_GENERIC_ADDPATH        = 12
+
+	// peer type in PEER_INDEX_TABLE
+	PEER_TYPE_IPV6 = 0x01
+	PEER_TYPE_AS4  = 0x02
+
+	// bgp path attribute, rfc4271
+	BGP_ATTR_FLAG_EXTENDED_LENGTH = 0x10
+	BGP_ATTR_TYPE_AS_PATH         = 2
+
+	// as_path segment type, rfc4271 rfc5065
+	AS_PATH_SEGMENT_AS_SET             = 1
+	AS_PATH_SEGMENT_AS_SEQUENCE        = 2
+	AS_PATH_SEGMENT_AS_CONFED_SEQUENCE = 3
+	AS_PATH_SEGMENT_AS_CONFED_SET      = 4
+)
+
+type MrtHeader struct {
+	Timestamp uint32 `json:"timestamp"`
+	Type      uint16 `json:"type"`
+	Subtype   uint16 `json:"subtype"`
+	Length    uint32 `json:"length"`
+}
+
+// one entry of PEER_INDEX_TABLE
+type PeerEntry struct {
+	PeerType  uint8      `json:"peerType"`
+	PeerBgpId netip.Addr `json:"peerBgpId"`
+	PeerIp    netip.Addr `json:"peerIp"`
+	PeerAsn   uint32     `json:"peerAsn"`
+}
+
+type AsPathSegment struct {
+	// AS_SET/AS_SEQUENCE/AS_CONFED_SEQUENCE/AS_CONFED_SET
+	Type uint8    `json:"type"`
+	Asns []uint32 `json:"asns"`
+}
+
+// one route of one peer in RIB_IPV4_UNICAST/RIB_IPV6_UNICAST
+type RibRoute struct {
+	Prefix         netip.Prefix `json:"prefix"`
+	PeerIndex      uint16       `json:"peerIndex"`
+	Peer           PeerEntry    `json:"peer"`
+	PathId         uint32       `json:"pathId"`
+	OriginatedTime time.Time    `json:"originatedTime"`
+	AsPathSegments AsPath       `json:"asPathSegments"`
+}
+
+type AsPath []AsPathSegment
+
+// AS_PATH as the order in bgp: neighbor first, origin last.
+// confederation segments are removed, hasAsSet is true when any AS_SET exists
+func (a AsPath) Flat() (asns []uint32, hasAsSet bool) {
+	asns = make([]uint32, 0, 8)
+	for i := range a {
+		switch a[i].Type {
+		case AS_PATH_SEGMENT_AS_SEQUENCE:
+			asns = append(asns, a[i].Asns...)
+		case AS_PATH_SEGMENT_AS_SET:
+			hasAsSet = true
+			asns = append(asns, a[i].Asns...)
+		}
+	}
+	return asns, hasAsSet
+}
+
+// rfc6811: origin is the last asn of the last AS_SEQUENCE segment,
+// when the last segment is AS_SET, or as_path is empty, there is no origin
+func (a AsPath) OriginAsn() (originAsn uint32, hasOrigin bool) {
+	for i := len(a) - 1; i >= 0; i-- {
+		switch a[i].Type {
+		case AS_PATH_SEGMENT_AS_SEQUENCE:
+			if len(a[i].Asns) == 0 {
+				continue
+			}
+			return a[i].Asns[len(a[i].Asns)-1], true
+		case AS_PATH_SEGMENT_AS_SET:
+			return 0, false
+		}
+	}
+	return 0, false
+}
+
+// "64496 64497 {64498 64499}"
+func (a AsPath) String() string {
+	var b strings.Builder
+	for i := range a {
+		if i > 0 {
+			b.WriteString(" ")
+		}
+		left, right := "", ""
+		switch a[i].Type {
+		case AS_PATH_SEGMENT_AS_SET:
+			left, right = "{", "}"
+		case AS_PATH_SEGMENT_AS_CONFED_SEQUENCE:
+			left, right = "(", ")"
+		case AS_PATH_SEGMENT_AS_CONFED_SET:
+			left, right = "[", "]"
+		}
+		b.WriteString(left)
+		for j, asn := range a[i].Asns {
+			if j > 0 {
+				b.WriteString(" ")
+			}
+			b.WriteString(strconv.FormatUint(uint64(asn), 10))
+		}
+		b.WriteString(right)
+	}
+	return b.String()
+}
+
+func (r *RibRoute) FlatAsPath() (asns []uint32, hasAsSet bool) {
+	return r.AsPathSegments.Flat()
+}
+
+func (r *RibRoute) OriginAsn() (originAsn uint32, hasOrigin bool) {
+	return r.AsPathSegments.OriginAsn()
+}
+
+func (r *RibRoute) AsPathString() string {
+	return r.AsPathSegments.String()
+}
+
+type MrtStat struct {
+	RecordCount    uint64 `json:"recordCount"`
+	SkipCount      uint64 `json:"skipCount"`
+	PeerCount      uint64 `json:"peerCount"`
+	PrefixCount    uint64 `json:"prefixCount"`
+	RouteCount     uint64 `json:"routeCount"`
+	Ipv4RouteCount uint64 `json:"ipv4RouteCount"`
+	Ipv6RouteCount uint64 `json:"ipv6RouteCount"`
+}
@@ -0,0 +1,74 @@
+package rov
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/ginserver"
+	"github.com/cpusoft/goutil/jsonutil"
+	"github.com/gin-gonic/gin"
+	"rpstir2-rov/impact"
+)
+
+// analyze mrt TABLE_DUMP_V2 file by current vrps and aspas.
+// upload file by multipart(file, aspaDirection, maxInvalidRoutes),
+// or json {"mrtFile":"/root/rpki/data/rib.20230601.0000.bz2","aspaDirection":"upstream"}.
+// ?format=csv will export invalid routes as csv, default is json
+func ImpactAnalysis(c *gin.Context) {
+	belogs.Info("ImpactAnalysis(): start")
+
+	impactRequest := impact.ImpactRequest{}
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		tmpDir, err := os.MkdirTemp("", "ImpactAnalysis")
+		if err != nil {
+			belogs.Error("ImpactAnalysis(): MkdirTemp fail:", err)
+			ginserver.ResponseFail(c, err, "")
+			return
+		}
+		defer os.RemoveAll(tmpDir)
+		impactRequest.MrtFile, err = ginserver.ReceiveFile(c, tmpDir)
+		if err != nil {
+			belogs.Error("ImpactAnalysis(): ReceiveFile fail:", err)
+			ginserver.ResponseFail(c, err, "")
+			return
+		}
+		impactRequest.AspaDirection = c.PostForm("aspaDirection")
+		impactRequest.MaxInvalidRoutes, _ = strconv.Atoi(c.PostForm("maxInvalidRoutes"))
+	} else {
+		err := c.ShouldBindJSON(&impactRequest)
+		if err != nil {
+			belogs.Error("ImpactAnalysis(): ShouldBindJSON fail:", err)
+			ginserver.ResponseFail(c, err, "")
+			return
+		}
+		if impactRequest.MrtFile == "" {
+			belogs.Error("ImpactAnalysis(): mrtFile is empty")
+			ginserver.ResponseFail(c, errors.New("mrtFile is empty"), "")
+			return
+		}
+	}
+	belogs.Debug("ImpactAnalysis(): impactRequest:", jsonutil.MarshalJson(impactRequest))
+
+	impactResult, err := impact.AnalyzeMrtFile(impactRequest.MrtFile, impactRequest.ImpactOption)
+	if err != nil {
+		belogs.Error("ImpactAnalysis(): AnalyzeMrtFile fail:", impactRequest.MrtFile, err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+
+	if c.Query("format") == "csv" {
+		c.Header("Content-Type", "text/csv")
+		c.Header("Content-Disposition", "attachment; filename=rovimpact.csv")
+		c.Status(http.StatusOK)
+		err = impact.WriteImpactCsv(c.Writer, impactResult)
+		if err != nil {
+			belogs.Error("ImpactAnalysis(): WriteImpactCsv fail:", impactRequest.MrtFile, err)
+		}
+		return
+	}
+	ginserver.ResponseOk(c, impactResult)
+}
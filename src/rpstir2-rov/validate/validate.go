@@ -0,0 +1,243 @@
+package validate
+
+import (
+	"errors"
+	"net/netip"
+
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/convert"
+	"github.com/cpusoft/goutil/iputil"
+)
+
+func NewVrpSet() *VrpSet {
+	return &VrpSet{vrps: make(map[vrpKey][]Vrp)}
+}
+
+func (v *VrpSet) AddVrp(vrp Vrp) {
+	vrp.Prefix = vrp.Prefix.Masked()
+	key := vrpKey{addr: vrp.Prefix.Addr(), bits: vrp.Prefix.Bits()}
+	v.vrps[key] = append(v.vrps[key], vrp)
+	v.Count++
+}
+
+func (v *VrpSet) RemoveVrp(vrp Vrp) {
+	vrp.Prefix = vrp.Prefix.Masked()
+	key := vrpKey{addr: vrp.Prefix.Addr(), bits: vrp.Prefix.Bits()}
+	vrps := v.vrps[key]
+	for i := range vrps {
+		if vrps[i] == vrp {
+			vrps = append(vrps[:i], vrps[i+1:]...)
+			v.Count--
+			break
+		}
+	}
+	if len(vrps) == 0 {
+		delete(v.vrps, key)
+	} else {
+		v.vrps[key] = vrps
+	}
+}
+
+func (v *VrpSet) Clone() *VrpSet {
+	c := &VrpSet{SerialNumber: v.SerialNumber, Count: v.Count, vrps: make(map[vrpKey][]Vrp, len(v.vrps))}
+	for key, vrps := range v.vrps {
+		c.vrps[key] = append([]Vrp(nil), vrps...)
+	}
+	return c
+}
+
+// all vrps, in no order
+func (v *VrpSet) Vrps() []Vrp {
+	vrps := make([]Vrp, 0, v.Count)
+	for _, vs := range v.vrps {
+		vrps = append(vrps, vs...)
+	}
+	return vrps
+}
+
+// all vrps whose prefix covers (equal or less specific) this prefix
+func (v *VrpSet) Covering(prefix netip.Prefix) []Vrp {
+	covering := make([]Vrp, 0)
+	for bits := prefix.Bits(); bits >= 0; bits-- {
+		p, err := prefix.Addr().Prefix(bits)
+		if err != nil {
+			continue
+		}
+		if vrps, ok := v.vrps[vrpKey{addr: p.Addr(), bits: bits}]; ok {
+			covering = append(covering, vrps...)
+		}
+	}
+	return covering
+}
+
+// rfc6811 2. when hasOrigin is false(AS_SET or empty as_path), no vrp can match
+func (v *VrpSet) ValidateOrigin(prefix netip.Prefix, originAsn uint32, hasOrigin bool) (rovResult RovResult) {
+	covering := v.Covering(prefix)
+	if len(covering) == 0 {
+		return RovResult{State: ROV_STATE_NOT_FOUND}
+	}
+	rovResult = RovResult{State: ROV_STATE_INVALID, CoveringVrps: covering}
+	if !hasOrigin {
+		rovResult.Reason = ROV_REASON_NO_ORIGIN
+		return rovResult
+	}
+	asnMatched := false
+	for i := range covering {
+		// AS0 vrp never matches
+		if covering[i].Asn == 0 || covering[i].Asn != originAsn {
+			continue
+		}
+		asnMatched = true
+		if prefix.Bits() <= covering[i].MaxLength {
+			return RovResult{State: ROV_STATE_VALID, CoveringVrps: covering}
+		}
+	}
+	if asnMatched {
+		rovResult.Reason = ROV_REASON_INVALID_LENGTH
+	} else {
+		rovResult.Reason = ROV_REASON_INVALID_ASN
+	}
+	return rovResult
+}
+
+func NewAspaSet() *AspaSet {
+	return &AspaSet{providers: make(map[aspaKey]map[uint32]struct{})}
+}
+
+// addressFamily: 0 is both, 1 is ipv4, 2 is ipv6
+func (a *AspaSet) AddAspa(customerAsn, providerAsn uint32, addressFamily int) {
+	key := aspaKey{customerAsn: customerAsn, addressFamily: addressFamily}
+	providers, ok := a.providers[key]
+	if !ok {
+		providers = make(map[uint32]struct{})
+		a.providers[key] = providers
+	}
+	providers[providerAsn] = struct{}{}
+	a.Count++
+}
+
+// hop(customerAsn, providerAsn) in draft-ietf-sidrops-aspa-verification 5
+func (a *AspaSet) hop(customerAsn, providerAsn uint32, addressFamily int) string {
+	found := false
+	for _, af := range []int{0, addressFamily} {
+		providers, ok := a.providers[aspaKey{customerAsn: customerAsn, addressFamily: af}]
+		if !ok {
+			continue
+		}
+		found = true
+		if _, ok := providers[providerAsn]; ok {
+			return ASPA_HOP_PROVIDER_PLUS
+		}
+	}
+	if found {
+		return ASPA_HOP_NOT_PROVIDER_PLUS
+	}
+	return ASPA_HOP_NO_ATTESTATION
+}
+
+// asPath is in bgp order(neighbor first, origin last), hasAsSet means there is AS_SET in as_path.
+// direction is upstream(from customer or lateral peer) or downstream(from provider).
+func (a *AspaSet) ValidateAspa(asPath []uint32, hasAsSet bool, isIpv6 bool, direction string) (aspaResult AspaResult) {
+	if hasAsSet {
+		return AspaResult{State: ASPA_STATE_INVALID, Reason: ASPA_REASON_AS_SET}
+	}
+	addressFamily := ASPA_ADDRESS_FAMILY_IPV4
+	if isIpv6 {
+		addressFamily = ASPA_ADDRESS_FAMILY_IPV6
+	}
+
+	// remove prepends and reverse: path[0] is origin, path[n-1] is neighbor
+	path := make([]uint32, 0, len(asPath))
+	for i := len(asPath) - 1; i >= 0; i-- {
+		if len(path) > 0 && path[len(path)-1] == asPath[i] {
+			continue
+		}
+		path = append(path, asPath[i])
+	}
+	n := len(path)
+
+	if direction == ASPA_DIRECTION_DOWNSTREAM {
+		return a.validateAspaDownstream(path, addressFamily)
+	}
+	if n <= 1 {
+		return AspaResult{State: ASPA_STATE_VALID}
+	}
+	allProviderPlus := true
+	for i := 0; i < n-1; i++ {
+		switch a.hop(path[i], path[i+1], addressFamily) {
+		case ASPA_HOP_NOT_PROVIDER_PLUS:
+			return AspaResult{State: ASPA_STATE_INVALID, Reason: ASPA_HOP_NOT_PROVIDER_PLUS,
+				CustomerAsn: path[i], ProviderAsn: path[i+1]}
+		case ASPA_HOP_NO_ATTESTATION:
+			allProviderPlus = false
+		}
+	}
+	if allProviderPlus {
+		return AspaResult{State: ASPA_STATE_VALID}
+	}
+	return AspaResult{State: ASPA_STATE_UNKNOWN, Reason: ASPA_HOP_NO_ATTESTATION}
+}
+
+// path[0] is origin, path[n-1] is neighbor
+func (a *AspaSet) validateAspaDownstream(path []uint32, addressFamily int) (aspaResult AspaResult) {
+	n := len(path)
+	if n <= 2 {
+		return AspaResult{State: ASPA_STATE_VALID}
+	}
+
+	// up ramp: from origin to top
+	maxUpRamp, minUpRamp := n, n
+	var notProviderCustomer, notProviderProvider uint32
+	for i := 0; i < n-1; i++ {
+		h := a.hop(path[i], path[i+1], addressFamily)
+		if h != ASPA_HOP_PROVIDER_PLUS && minUpRamp == n {
+			minUpRamp = i + 1
+		}
+		if h == ASPA_HOP_NOT_PROVIDER_PLUS {
+			maxUpRamp = i + 1
+			notProviderCustomer, notProviderProvider = path[i], path[i+1]
+			break
+		}
+	}
+	// down ramp: from neighbor to top
+	maxDownRamp, minDownRamp := n, n
+	for j := n - 1; j > 0; j-- {
+		h := a.hop(path[j], path[j-1], addressFamily)
+		if h != ASPA_HOP_PROVIDER_PLUS && minDownRamp == n {
+			minDownRamp = n - j
+		}
+		if h == ASPA_HOP_NOT_PROVIDER_PLUS {
+			maxDownRamp = n - j
+			break
+		}
+	}
+
+	if maxUpRamp+maxDownRamp < n {
+		return AspaResult{State: ASPA_STATE_INVALID, Reason: ASPA_HOP_NOT_PROVIDER_PLUS,
+			CustomerAsn: notProviderCustomer, ProviderAsn: notProviderProvider}
+	}
+	if minUpRamp+minDownRamp < n {
+		return AspaResult{State: ASPA_STATE_UNKNOWN, Reason: ASPA_HOP_NO_ATTESTATION}
+	}
+	return AspaResult{State: ASPA_STATE_VALID}
+}
+
+// address in lab_rpki_rtr_full may be trimmed, such as 147.28.83
+func ConvertRtrAddressToPrefix(address string, prefixLength uint64) (prefix netip.Prefix, err error) {
+	addressFill, err := iputil.FillAddressWithZero(address, iputil.GetIpType(address))
+	if err != nil {
+		belogs.Error("ConvertRtrAddressToPrefix(): FillAddressWithZero fail, address:", address, err)
+		return prefix, err
+	}
+	addr, err := netip.ParseAddr(addressFill)
+	if err != nil {
+		belogs.Error("ConvertRtrAddressToPrefix(): ParseAddr fail, address:", address, "  addressFill:", addressFill, err)
+		return prefix, err
+	}
+	prefix, err = addr.Prefix(int(prefixLength))
+	if err != nil {
+		belogs.Error("ConvertRtrAddressToPrefix(): Prefix fail, address:", address, "  prefixLength:", prefixLength, err)
+		return prefix, errors.New("prefixLength " + convert.ToString(prefixLength) + " is error")
+	}
+	return prefix, nil
+}
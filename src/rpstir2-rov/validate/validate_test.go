@@ -0,0 +1,60 @@
+package validate
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestValidateOrigin(t *testing.T) {
+	vrpSet := NewVrpSet()
+	vrpSet.AddVrp(Vrp{Asn: 64496, Prefix: netip.MustParsePrefix("192.0.2.0/23"), MaxLength: 24})
+	vrpSet.AddVrp(Vrp{Asn: 0, Prefix: netip.MustParsePrefix("198.51.100.0/24"), MaxLength: 24})
+
+	tests := []struct {
+		prefix    string
+		originAsn uint32
+		hasOrigin bool
+		state     string
+		reason    string
+	}{
+		{"192.0.2.0/24", 64496, true, ROV_STATE_VALID, ""},
+		{"192.0.2.0/25", 64496, true, ROV_STATE_INVALID, ROV_REASON_INVALID_LENGTH},
+		{"192.0.2.0/24", 64497, true, ROV_STATE_INVALID, ROV_REASON_INVALID_ASN},
+		{"192.0.2.0/24", 0, false, ROV_STATE_INVALID, ROV_REASON_NO_ORIGIN},
+		{"198.51.100.0/24", 0, true, ROV_STATE_INVALID, ROV_REASON_INVALID_ASN},
+		{"203.0.113.0/24", 64496, true, ROV_STATE_NOT_FOUND, ""},
+	}
+	for _, test := range tests {
+		rovResult := vrpSet.ValidateOrigin(netip.MustParsePrefix(test.prefix), test.originAsn, test.hasOrigin)
+		if rovResult.State != test.state || rovResult.Reason != test.reason {
+			t.Error(test.prefix, test.originAsn, " expect:", test.state, test.reason, "  got:", rovResult.State, rovResult.Reason)
+		}
+	}
+}
+
+func TestValidateAspa(t *testing.T) {
+	// 64496 --> 64497 --> 64498, 64499 has aspa without 64498
+	aspaSet := NewAspaSet()
+	aspaSet.AddAspa(64496, 64497, 0)
+	aspaSet.AddAspa(64497, 64498, 0)
+	aspaSet.AddAspa(64499, 64500, ASPA_ADDRESS_FAMILY_IPV4)
+
+	tests := []struct {
+		asPath    []uint32
+		direction string
+		state     string
+	}{
+		{[]uint32{64498, 64497, 64496}, ASPA_DIRECTION_UPSTREAM, ASPA_STATE_VALID},
+		{[]uint32{64498, 64497, 64497, 64496}, ASPA_DIRECTION_UPSTREAM, ASPA_STATE_VALID},
+		{[]uint32{64501, 64498, 64497, 64496}, ASPA_DIRECTION_UPSTREAM, ASPA_STATE_UNKNOWN},
+		{[]uint32{64496, 64499}, ASPA_DIRECTION_UPSTREAM, ASPA_STATE_INVALID},
+		{[]uint32{64499, 64496, 64497}, ASPA_DIRECTION_DOWNSTREAM, ASPA_STATE_INVALID},
+		{[]uint32{64496, 64497, 64498, 64497, 64496}, ASPA_DIRECTION_DOWNSTREAM, ASPA_STATE_VALID},
+	}
+	for _, test := range tests {
+		aspaResult := aspaSet.ValidateAspa(test.asPath, false, false, test.direction)
+		if aspaResult.State != test.state {
+			t.Error(test.asPath, test.direction, " expect:", test.state, "  got:", aspaResult.State)
+		}
+	}
+}
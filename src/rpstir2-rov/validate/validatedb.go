@@ -0,0 +1,79 @@
+package validate
+
+import (
+	"time"
+
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/jsonutil"
+	"github.com/cpusoft/goutil/xormdb"
+)
+
+// current serialNumber of rtr
+func GetCurSerialNumberDb() (serialNumber uint64, err error) {
+	sql := `select serialNumber from lab_rpki_rtr_serial_number order by id desc limit 1`
+	_, err = xormdb.XormEngine.SQL(sql).Get(&serialNumber)
+	if err != nil {
+		belogs.Error("GetCurSerialNumberDb(): select serialNumber fail:", err)
+		return 0, err
+	}
+	return serialNumber, nil
+}
+
+// get all vrps from lab_rpki_rtr_full, which is just what rtr server sends to routers
+func GetVrpSetDb() (vrpSet *VrpSet, err error) {
+	start := time.Now()
+	serialNumber, err := GetCurSerialNumberDb()
+	if err != nil {
+		belogs.Error("GetVrpSetDb(): GetCurSerialNumberDb fail:", err)
+		return nil, err
+	}
+
+	rtrFulls := make([]rtrFullDb, 0)
+	sql := `select asn, address, prefixLength, maxLength from lab_rpki_rtr_full order by id `
+	err = xormdb.XormEngine.SQL(sql).Find(&rtrFulls)
+	if err != nil {
+		belogs.Error("GetVrpSetDb(): select lab_rpki_rtr_full fail:", err)
+		return nil, err
+	}
+
+	vrpSet = NewVrpSet()
+	vrpSet.SerialNumber = serialNumber
+	for i := range rtrFulls {
+		prefix, err := ConvertRtrAddressToPrefix(rtrFulls[i].Address, rtrFulls[i].PrefixLength)
+		if err != nil {
+			belogs.Error("GetVrpSetDb(): ConvertRtrAddressToPrefix fail, rtrFull:", jsonutil.MarshalJson(rtrFulls[i]), err)
+			return nil, err
+		}
+		vrpSet.AddVrp(Vrp{Asn: uint32(rtrFulls[i].Asn), Prefix: prefix, MaxLength: int(rtrFulls[i].MaxLength)})
+	}
+	belogs.Info("GetVrpSetDb(): serialNumber:", serialNumber, "  vrpSet.Count:", vrpSet.Count, "  time(s):", time.Since(start))
+	return vrpSet, nil
+}
+
+// get all aspas from lab_rpki_rtr_asa_full
+func GetAspaSetDb() (aspaSet *AspaSet, err error) {
+	start := time.Now()
+	serialNumber, err := GetCurSerialNumberDb()
+	if err != nil {
+		belogs.Error("GetAspaSetDb(): GetCurSerialNumberDb fail:", err)
+		return nil, err
+	}
+
+	rtrAsaFulls := make([]rtrAsaFullDb, 0)
+	sql := `select customerAsn, providerAsn, addressFamily from lab_rpki_rtr_asa_full order by id `
+	err = xormdb.XormEngine.SQL(sql).Find(&rtrAsaFulls)
+	if err != nil {
+		belogs.Error("GetAspaSetDb(): select lab_rpki_rtr_asa_full fail:", err)
+		return nil, err
+	}
+
+	aspaSet = NewAspaSet()
+	aspaSet.SerialNumber = serialNumber
+	for i := range rtrAsaFulls {
+		// null is both ipv4 and ipv6
+		aspaSet.AddAspa(uint32(rtrAsaFulls[i].CustomerAsn), uint32(rtrAsaFulls[i].ProviderAsn),
+			int(rtrAsaFulls[i].AddressFamily.ValueOrZero()))
+	}
+	belogs.Info("GetAspaSetDb(): serialNumber:", serialNumber, "  aspaSet.Count:", aspaSet.Count, "  time(s):", time.Since(start))
+	return aspaSet, nil
+}
@@ -0,0 +1,101 @@
+package validate
+
+import (
+	"net/netip"
+
+	"github.com/guregu/null"
+)
+
+// rfc6811
+const (
+	ROV_STATE_VALID     = "valid"
+	ROV_STATE_INVALID   = "invalid"
+	ROV_STATE_NOT_FOUND = "notFound"
+
+	// reason of invalid
+	ROV_REASON_INVALID_ASN    = "invalidAsn"
+	ROV_REASON_INVALID_LENGTH = "invalidLength"
+	ROV_REASON_NO_ORIGIN      = "noOrigin"
+)
+
+// draft-ietf-sidrops-aspa-verification
+const (
+	ASPA_STATE_VALID   = "valid"
+	ASPA_STATE_INVALID = "invalid"
+	ASPA_STATE_UNKNOWN = "unknown"
+
+	// route is received from customer/lateral peer, or from provider/route server
+	ASPA_DIRECTION_UPSTREAM   = "upstream"
+	ASPA_DIRECTION_DOWNSTREAM = "downstream"
+
+	ASPA_REASON_AS_SET = "asSet"
+
+	ASPA_HOP_PROVIDER_PLUS     = "providerPlus"
+	ASPA_HOP_NOT_PROVIDER_PLUS = "notProviderPlus"
+	ASPA_HOP_NO_ATTESTATION    = "noAttestation"
+
+	// same as addressFamily in lab_rpki_rtr_asa_full
+	ASPA_ADDRESS_FAMILY_IPV4 = 1
+	ASPA_ADDRESS_FAMILY_IPV6 = 2
+)
+
+type Vrp struct {
+	Asn       uint32       `json:"asn"`
+	Prefix    netip.Prefix `json:"prefix"`
+	MaxLength int          `json:"maxLength"`
+}
+
+type vrpKey struct {
+	// masked address
+	addr netip.Addr
+	bits int
+}
+
+// all vrps, indexed by prefix
+type VrpSet struct {
+	SerialNumber uint64 `json:"serialNumber"`
+	Count        uint64 `json:"count"`
+	vrps         map[vrpKey][]Vrp
+}
+
+type aspaKey struct {
+	customerAsn   uint32
+	addressFamily int
+}
+
+// all customerAsn-->providerAsns.
+// addressFamily is 0 means both ipv4 and ipv6
+type AspaSet struct {
+	SerialNumber uint64 `json:"serialNumber"`
+	Count        uint64 `json:"count"`
+	providers    map[aspaKey]map[uint32]struct{}
+}
+
+type RovResult struct {
+	State string `json:"state"`
+	// invalidAsn/invalidLength/noOrigin
+	Reason string `json:"reason,omitempty"`
+	// covering vrps, for invalid, they are the vrps responsible
+	CoveringVrps []Vrp `json:"coveringVrps,omitempty"`
+}
+
+type AspaResult struct {
+	State  string `json:"state"`
+	Reason string `json:"reason,omitempty"`
+	// first hop which is not provider, customerAsn-->providerAsn
+	CustomerAsn uint32 `json:"customerAsn,omitempty"`
+	ProviderAsn uint32 `json:"providerAsn,omitempty"`
+}
+
+type rtrFullDb struct {
+	Asn          int64  `json:"asn" xorm:"asn bigint"`
+	Address      string `json:"address" xorm:"address varchar(512)"`
+	PrefixLength uint64 `json:"prefixLength" xorm:"prefixLength int"`
+	MaxLength    uint64 `json:"maxLength" xorm:"maxLength int"`
+}
+
+type rtrAsaFullDb struct {
+	CustomerAsn   uint64   `json:"customerAsn" xorm:"customerAsn int"`
+	ProviderAsn   uint64   `json:"providerAsn" xorm:"providerAsn int"`
+	AddressFamily null.Int `json:"addressFamily" xorm:"addressFamily int"`
+}
@@ -7,9 +7,12 @@ import (
 	"github.com/cpusoft/goutil/jsonutil"
 	model "rpstir2-model"
 	rtrcommon "rpstir2-rtrproducer/common"
+	rtrpreview "rpstir2-rtrproducer/preview"
 )
 
-func RtrUpdateByAsaFromSync(curSerialNumberModel, newSerialNumberModel *rtrcommon.SerialNumberModel) (err error) {
+// previewGate may be nil, when it is not nil, will wait it to be approved before publishing
+func RtrUpdateByAsaFromSync(curSerialNumberModel, newSerialNumberModel *rtrcommon.SerialNumberModel,
+	previewGate *rtrpreview.PreviewGate) (err error) {
 	start := time.Now()
 	belogs.Info("RtrUpdateByAsaFromSync():start, curSerialNumberModel:", jsonutil.MarshalJson(curSerialNumberModel),
 		"    newSerialNumberModel:", jsonutil.MarshalJson(newSerialNumberModel))
@@ -31,6 +34,8 @@ func RtrUpdateByAsaFromSync(curSerialNumberModel, newSerialNumberModel *rtrcommo
 	//when both  len are 0, return nil
 	if len(asaToRtrFullLogs) == 0 && len(slurmToRtrFullLogs) == 0 {
 		belogs.Info("RtrUpdateByAsaFromSync():asa or slurm are both empty")
+		// brake may be waiting for asa
+		previewGate.SetAsaIncrementals(nil)
 		return nil
 	}
 
@@ -61,6 +66,14 @@ func RtrUpdateByAsaFromSync(curSerialNumberModel, newSerialNumberModel *rtrcommo
 	belogs.Info("RtrUpdateByAsaFromSync():getRtrAsaIncrementals, len(rtrAsaIncrementals)", len(rtrAsaIncrementals),
 		"  curSerialNumberModel:", curSerialNumberModel, "   newSerialNumber:", newSerialNumberModel, "  time(s):", time.Since(start))
 
+	// serialNumber is shared with roa, so should wait for preview of roa. withdrawn aspas are checked by brake
+	previewGate.SetAsaIncrementals(rtrAsaIncrementals)
+	err = previewGate.Wait()
+	if err != nil {
+		belogs.Error("RtrUpdateByAsaFromSync():Wait previewGate fail: newSerialNumber:", newSerialNumberModel.SerialNumber, err)
+		return err
+	}
+
 	err = updateSerialNumberAndRtrAsaFullAndRtrAsaIncrementalDb(newSerialNumberModel, rtrAsaIncrementals)
 	if err != nil {
 		belogs.Error("RtrUpdateByAsaFromSync():updateSerialNumberAndRtrAsaFullAndRtrAsaIncrementalDb: fail: newSerialNumber:",
@@ -72,83 +85,119 @@ func RtrUpdateByAsaFromSync(curSerialNumberModel, newSerialNumberModel *rtrcommo
 	return nil
 }
 
+// sorted-merge cur and new rtr asa full log, which are streamed from db
 func getRtrAsaIncrementals(curSerialNumberModel, newSerialNumberModel *rtrcommon.SerialNumberModel) (rtrAsaIncrementals []model.LabRpkiRtrAsaIncremental, err error) {
 	start := time.Now()
 	belogs.Debug("getRtrAsaIncrementals(): curSerialNumberModel:", jsonutil.MarshalJson(curSerialNumberModel), "   newSerialNumberModel:", jsonutil.MarshalJson(newSerialNumberModel))
 
 	// get cur rtrFull
-	rtrAsaFullCurs, err := getRtrAsaFullFromRtrFullLogDb(curSerialNumberModel.SerialNumber)
+	curIterator, err := newRtrAsaFullLogIteratorDb(curSerialNumberModel.SerialNumber)
 	if err != nil {
-		belogs.Error("getRtrAsaIncrementals():getRtrAsaFullFromRtrFullLogDb rtrAsaFullCurs fail: cur SerialNumber:", curSerialNumberModel.SerialNumber, err)
+		belogs.Error("getRtrAsaIncrementals():newRtrAsaFullLogIteratorDb cur fail: cur SerialNumber:", curSerialNumberModel.SerialNumber, err)
 		return nil, err
 	}
-	belogs.Info("getRtrAsaIncrementals(): getRtrAsaFullFromRtrFullLogDb len(rtrAsaFullCurs):", len(rtrAsaFullCurs),
-		" cur serialNumber:", curSerialNumberModel.SerialNumber, "  time(s):", time.Since(start))
+	defer curIterator.Close()
 
-	// get latest rtrFull
-	rtrAsaFullNews, err := getRtrAsaFullFromRtrFullLogDb(newSerialNumberModel.SerialNumber)
+	// get new rtrFull
+	newIterator, err := newRtrAsaFullLogIteratorDb(newSerialNumberModel.SerialNumber)
 	if err != nil {
-		belogs.Error("getRtrAsaIncrementals():getRtrAsaFullFromRtrFullLogDb rtrAsaFullNews fail: new SerialNumber:", newSerialNumberModel.SerialNumber, err)
+		belogs.Error("getRtrAsaIncrementals():newRtrAsaFullLogIteratorDb new fail: new SerialNumber:", newSerialNumberModel.SerialNumber, err)
 		return nil, err
 	}
-	belogs.Info("getRtrAsaIncrementals(): getRtrAsaFullFromRtrFullLogDb, len(rtrAsaFullNews):", len(rtrAsaFullNews),
-		"  new SerialNumber:", newSerialNumberModel.SerialNumber, "  time(s):", time.Since(start))
+	defer newIterator.Close()
 
 	// get rtr incrementals
-	rtrAsaIncrementals, err = diffRtrAsaFullToRtrAsaIncremental(rtrAsaFullCurs, rtrAsaFullNews, newSerialNumberModel.SerialNumber)
+	rtrAsaIncrementals, err = mergeRtrAsaFullToRtrAsaIncremental(curIterator.Next, newIterator.Next, newSerialNumberModel.SerialNumber)
 	if err != nil {
-		belogs.Error("getRtrAsaIncrementals():GetRtrFull rtrFullLast fail: new SerialNumber:", newSerialNumberModel.SerialNumber, err)
+		belogs.Error("getRtrAsaIncrementals():mergeRtrAsaFullToRtrAsaIncremental fail: new SerialNumber:", newSerialNumberModel.SerialNumber, err)
 		return nil, err
 	}
-	belogs.Info("getRtrAsaIncrementals():diffRtrAsaFullToRtrAsaIncremental, len(rtrAsaIncrementals)", len(rtrAsaIncrementals),
-		" new  SerialNumber:", newSerialNumberModel.SerialNumber, "  time(s):", time.Since(start))
+	belogs.Info("getRtrAsaIncrementals():mergeRtrAsaFullToRtrAsaIncremental, len(rtrAsaIncrementals)", len(rtrAsaIncrementals),
+		"  cur serialNumber:", curSerialNumberModel.SerialNumber, "  cur count:", curIterator.count,
+		"  new serialNumber:", newSerialNumberModel.SerialNumber, "  new count:", newIterator.count, "  time(s):", time.Since(start))
 	return rtrAsaIncrementals, nil
 }
 
-func diffRtrAsaFullToRtrAsaIncremental(rtrAsaFullCurs, rtrAsaFullNews map[string]model.LabRpkiRtrAsaFull,
+// same order as "order by customerAsn, providerAsn, addressFamily" in db, null addressFamily is first
+func compareRtrAsaFull(a, b *model.LabRpkiRtrAsaFull) int {
+	if a.CustomerAsn != b.CustomerAsn {
+		if a.CustomerAsn < b.CustomerAsn {
+			return -1
+		}
+		return 1
+	}
+	if a.ProviderAsn != b.ProviderAsn {
+		if a.ProviderAsn < b.ProviderAsn {
+			return -1
+		}
+		return 1
+	}
+	af, bf := int64(-1), int64(-1)
+	if a.AddressFamily.Valid {
+		af = a.AddressFamily.Int64
+	}
+	if b.AddressFamily.Valid {
+		bf = b.AddressFamily.Int64
+	}
+	if af != bf {
+		if af < bf {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+// nextCur and nextNew return sorted rtr asa fulls without duplicated key, and return nil at end.
+// only in new is announce, only in cur is withdraw
+func mergeRtrAsaFullToRtrAsaIncremental(nextCur, nextNew func() (*model.LabRpkiRtrAsaFull, error),
 	newSerialNumber uint64) (rtrAsaIncrementals []model.LabRpkiRtrAsaIncremental, err error) {
-	belogs.Debug("diffRtrAsaFullToRtrAsaIncremental(): len(rtrAsaFullsCurs):", len(rtrAsaFullCurs),
-		"   len(rtrAsaFullNews):", len(rtrAsaFullNews), "   newSerialNumber:", newSerialNumber)
-
-	rtrAsaIncrementals = make([]model.LabRpkiRtrAsaIncremental, 0, len(rtrAsaFullCurs))
-	for keyNew, valueNew := range rtrAsaFullNews {
-		// new exist in cur, then del in cur
-		if _, ok := rtrAsaFullCurs[keyNew]; ok {
-			belogs.Debug("diffRtrAsaFullToRtrAsaIncremental(): keyNew found in rtrAsaFullCurs:", keyNew,
-				"  will del in rtrAsaFullCurs:", jsonutil.MarshalJson(rtrAsaFullCurs[keyNew]),
-				"  and will ignore in rtrAsaFullNews:", jsonutil.MarshalJson(valueNew))
-			delete(rtrAsaFullCurs, keyNew)
+	rtrAsaIncrementals = make([]model.LabRpkiRtrAsaIncremental, 0)
+	newRtrAsaIncremental := func(style string, rtrAsaFull *model.LabRpkiRtrAsaFull) model.LabRpkiRtrAsaIncremental {
+		return model.LabRpkiRtrAsaIncremental{
+			Style:         style,
+			CustomerAsn:   rtrAsaFull.CustomerAsn,
+			ProviderAsn:   rtrAsaFull.ProviderAsn,
+			AddressFamily: rtrAsaFull.AddressFamily,
+			SerialNumber:  newSerialNumber,
+			SourceFrom:    rtrAsaFull.SourceFrom,
+		}
+	}
+
+	cur, err := nextCur()
+	if err != nil {
+		return nil, err
+	}
+	new, err := nextNew()
+	if err != nil {
+		return nil, err
+	}
+	for cur != nil || new != nil {
+		c := 0
+		if cur == nil {
+			c = 1
+		} else if new == nil {
+			c = -1
 		} else {
-			// new is not exist in cur, then this is announce
-			rtrAsaIncremental := model.LabRpkiRtrAsaIncremental{
-				Style:         "announce",
-				CustomerAsn:   valueNew.CustomerAsn,
-				ProviderAsn:   valueNew.ProviderAsn,
-				AddressFamily: valueNew.AddressFamily,
-				SerialNumber:  uint64(newSerialNumber),
-				SourceFrom:    valueNew.SourceFrom,
+			c = compareRtrAsaFull(cur, new)
+		}
+		if c <= 0 {
+			if c < 0 {
+				rtrAsaIncrementals = append(rtrAsaIncrementals, newRtrAsaIncremental("withdraw", cur))
+			}
+			if cur, err = nextCur(); err != nil {
+				return nil, err
 			}
-			belogs.Debug("diffRtrAsaFullToRtrAsaIncremental():keyNew not found in rtrAsaFullCurs, valueNew:", jsonutil.MarshalJson(valueNew),
-				"   will set as announce incremental:", jsonutil.MarshalJson(rtrAsaIncremental))
-			rtrAsaIncrementals = append(rtrAsaIncrementals, rtrAsaIncremental)
 		}
-	}
-	belogs.Debug("diffRtrAsaFullToRtrAsaIncremental(): after announce, remain will as withdraw len(rtrAsaFullCurs):",
-		len(rtrAsaFullCurs))
-	// remain in cur, is not show in new, so this is withdraw
-	for _, valueCur := range rtrAsaFullCurs {
-		rtrAsaIncremental := model.LabRpkiRtrAsaIncremental{
-			Style:         "withdraw",
-			CustomerAsn:   valueCur.CustomerAsn,
-			ProviderAsn:   valueCur.ProviderAsn,
-			AddressFamily: valueCur.AddressFamily,
-			SerialNumber:  uint64(newSerialNumber),
-			SourceFrom:    valueCur.SourceFrom,
+		if c >= 0 {
+			if c > 0 {
+				rtrAsaIncrementals = append(rtrAsaIncrementals, newRtrAsaIncremental("announce", new))
+			}
+			if new, err = nextNew(); err != nil {
+				return nil, err
+			}
 		}
-		belogs.Debug("diffRtrAsaFullToRtrAsaIncremental(): withdraw incremental:",
-			jsonutil.MarshalJson(rtrAsaIncremental))
-		rtrAsaIncrementals = append(rtrAsaIncrementals, rtrAsaIncremental)
 	}
-	belogs.Debug("diffRtrAsaFullToRtrAsaIncremental(): newSerialNumber, len(rtrAsaIncrementals):", newSerialNumber, len(rtrAsaIncrementals))
+	belogs.Debug("mergeRtrAsaFullToRtrAsaIncremental(): newSerialNumber, len(rtrAsaIncrementals):", newSerialNumber, len(rtrAsaIncrementals))
 	return rtrAsaIncrementals, nil
 }
@@ -4,11 +4,11 @@ import (
 	"time"
 
 	"github.com/cpusoft/goutil/belogs"
-	"github.com/cpusoft/goutil/convert"
 	"github.com/cpusoft/goutil/jsonutil"
 	"github.com/cpusoft/goutil/xormdb"
 	model "rpstir2-model"
 	rtrcommon "rpstir2-rtrproducer/common"
+	"xorm.io/xorm"
 )
 
 func getAllAsasDb() ([]model.AsaToRtrFullLog, error) {
@@ -51,36 +51,45 @@ func getAllAsasDb() ([]model.AsaToRtrFullLog, error) {
 	return asaToRtrFullLogs, nil
 }
 
-func getRtrAsaFullFromRtrFullLogDb(serialNumber uint64) (rtrAsaFulls map[string]model.LabRpkiRtrAsaFull, err error) {
-	start := time.Now()
-	belogs.Debug("getRtrAsaFullFromRtrFullLogDb():serialNumber:", serialNumber)
-	rtrAsaFs := make([]model.LabRpkiRtrAsaFull, 0)
-	sql :=
-		`select serialNumber,customerAsn,providerAsn,addressFamily,sourceFrom 
-	    from lab_rpki_rtr_asa_full_log 
-	    where serialNumber = ? 
-		order by id `
-	err = xormdb.XormEngine.SQL(sql, serialNumber).Find(&rtrAsaFs)
+// rows of lab_rpki_rtr_asa_full_log of one serialNumber, sorted by key and skip duplicated key
+type rtrAsaFullLogIterator struct {
+	rows  *xorm.Rows
+	last  *model.LabRpkiRtrAsaFull
+	count uint64
+}
+
+func newRtrAsaFullLogIteratorDb(serialNumber uint64) (iterator *rtrAsaFullLogIterator, err error) {
+	sql := `select serialNumber,customerAsn,providerAsn,addressFamily,sourceFrom from lab_rpki_rtr_asa_full_log
+		where serialNumber = ? order by customerAsn, providerAsn, addressFamily, id `
+	rows, err := xormdb.XormEngine.SQL(sql, serialNumber).Rows(new(model.LabRpkiRtrAsaFull))
 	if err != nil {
-		belogs.Error("getRtrAsaFullFromRtrFullLogDb(): get lab_rpki_rtr_asa_full_log fail: serialNumber: ", serialNumber, err)
+		belogs.Error("newRtrAsaFullLogIteratorDb(): Rows fail: serialNumber:", serialNumber, err)
 		return nil, err
 	}
-	if len(rtrAsaFs) == 0 {
-		belogs.Debug("getRtrAsaFullFromRtrFullLogDb(): len(rtrAsaFs)==0: serialNumber", serialNumber)
-		return make(map[string]model.LabRpkiRtrAsaFull, 0), nil
-	}
-	belogs.Debug("getRtrAsaFullFromRtrFullLogDb():model.LabRpkiRtrAsaFull, serialNumber, len(rtrAsaFs) : ", serialNumber, len(rtrAsaFs))
+	return &rtrAsaFullLogIterator{rows: rows}, nil
+}
 
-	rtrAsaFulls = make(map[string]model.LabRpkiRtrAsaFull, len(rtrAsaFs)+50)
-	for i := range rtrAsaFs {
-		key := convert.ToString(rtrAsaFs[i].CustomerAsn) + "_" +
-			convert.ToString(rtrAsaFs[i].ProviderAsn) + "_" + convert.ToString(rtrAsaFs[i].AddressFamily.ValueOrZero())
-		rtrAsaFulls[key] = rtrAsaFs[i]
+// return nil at end
+func (iterator *rtrAsaFullLogIterator) Next() (*model.LabRpkiRtrAsaFull, error) {
+	for iterator.rows.Next() {
+		rtrAsaFull := new(model.LabRpkiRtrAsaFull)
+		err := iterator.rows.Scan(rtrAsaFull)
+		if err != nil {
+			belogs.Error("Next(): Scan lab_rpki_rtr_asa_full_log fail:", err)
+			return nil, err
+		}
+		if iterator.last != nil && compareRtrAsaFull(iterator.last, rtrAsaFull) == 0 {
+			continue
+		}
+		iterator.last = rtrAsaFull
+		iterator.count++
+		return rtrAsaFull, nil
 	}
-	belogs.Info("getRtrAsaFullFromRtrFullLogDb():map LabRpkiRtrAsaFull, serialNumber:",
-		serialNumber, "  , len(rtrAsaFs):", len(rtrAsaFs), "   time(s):", time.Since(start))
-	return rtrAsaFulls, nil
+	return nil, iterator.rows.Err()
+}
 
+func (iterator *rtrAsaFullLogIterator) Close() {
+	iterator.rows.Close()
 }
 
 func insertRtrAsaFullLogFromAsaDb(newSerialNumber uint64, asaToRtrFullLogs []model.AsaToRtrFullLog) (err error) {
@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/conf"
 	"github.com/guregu/null"
 	model "rpstir2-model"
 )
@@ -46,3 +47,12 @@ func ConvertAsaAddressFamilyToRtr(addressFamilyInt null.Int) (addressFamilyIpv4
 		"   addressFamilyIpv6:", addressFamilyIpv6)
 	return addressFamilyIpv4, addressFamilyIpv6, nil
 }
+
+// full log of every rtr::fullLogCheckpointInterval serialNumbers is kept, 0 means all are kept
+func IsRtrFullLogCheckpoint(serialNumber uint64) bool {
+	interval := conf.Int("rtr::fullLogCheckpointInterval")
+	if interval <= 0 {
+		return true
+	}
+	return serialNumber%uint64(interval) == 0
+}
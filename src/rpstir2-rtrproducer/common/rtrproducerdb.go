@@ -492,7 +492,7 @@ func UpdateRtrAsaFullOrFullLogFromSlurmDb(tableName string, newSerialNumber uint
 	return effectSlurmToRtrFullLogs, nil
 }
 */
-// style=prefix/asa
+// style=prefix/asa/routerKey
 func GetAllSlurmsDb(style string) (slurmToRtrFullLogs []model.SlurmToRtrFullLog, err error) {
 	// get all slurm, not care state->"$.rtr"='notYet' or 'finished'
 	var sql string
@@ -515,6 +515,15 @@ func GetAllSlurmsDb(style string) (slurmToRtrFullLogs []model.SlurmToRtrFullLog,
 		    slurmLogFileId 
 	    from lab_rpki_slurm  where style in ('aspaFilters','aspaAssertions') 
 		order by id `
+	} else if style == "routerKey" {
+		sql = `select id as slurmId, style,  
+			asn,
+			ifnull(ski,'') as ski, 
+			ifnull(routerPublicKey,'') as routerPublicKey,
+			slurmLogId,
+		    slurmLogFileId 
+	    from lab_rpki_slurm  where style in ('bgpsecFilters','bgpsecAssertions') 
+		order by id `
 	}
 	belogs.Debug("GetAllSlurmsDb(): sql:", sql)
 	err = xormdb.XormEngine.SQL(sql).Find(&slurmToRtrFullLogs)
@@ -549,3 +558,71 @@ func InsertSerialNumberDb(session *xorm.Session, newSerialNumberModel *SerialNum
 	}
 	return nil
 }
+
+// when new serialNumber will not be published(such as rejected by preview), remove its full log,
+// so next new serialNumber(the same number) will not get these
+func DeleteRtrFullLogsBySerialNumberDb(serialNumber uint64) (err error) {
+	start := time.Now()
+	session, err := xormdb.NewSession()
+	if err != nil {
+		belogs.Error("DeleteRtrFullLogsBySerialNumberDb(): NewSession fail :", err)
+		return err
+	}
+	defer session.Close()
+
+	_, err = session.Exec(`delete from lab_rpki_rtr_full_log where serialNumber = ?`, serialNumber)
+	if err != nil {
+		return xormdb.RollbackAndLogError(session, "DeleteRtrFullLogsBySerialNumberDb(): delete lab_rpki_rtr_full_log fail: ", err)
+	}
+	_, err = session.Exec(`delete from lab_rpki_rtr_asa_full_log where serialNumber = ?`, serialNumber)
+	if err != nil {
+		return xormdb.RollbackAndLogError(session, "DeleteRtrFullLogsBySerialNumberDb(): delete lab_rpki_rtr_asa_full_log fail: ", err)
+	}
+	_, err = session.Exec(`delete from lab_rpki_rtr_router_key_full_log where serialNumber = ?`, serialNumber)
+	if err != nil {
+		return xormdb.RollbackAndLogError(session, "DeleteRtrFullLogsBySerialNumberDb(): delete lab_rpki_rtr_router_key_full_log fail: ", err)
+	}
+
+	err = xormdb.CommitSession(session)
+	if err != nil {
+		return xormdb.RollbackAndLogError(session, "DeleteRtrFullLogsBySerialNumberDb(): CommitSession fail: ", err)
+	}
+	belogs.Info("DeleteRtrFullLogsBySerialNumberDb(): serialNumber:", serialNumber, "   time(s):", time.Since(start))
+	return nil
+}
+
+// after new serialNumber is published, full log of previous serialNumber is removed unless it is checkpoint,
+// it can be rebuilt from the last checkpoint and lab_rpki_rtr_incremental/lab_rpki_rtr_asa_incremental/lab_rpki_rtr_router_key_incremental
+func CompactRtrFullLogDb(serialNumber uint64) (err error) {
+	if IsRtrFullLogCheckpoint(serialNumber) {
+		belogs.Debug("CompactRtrFullLogDb(): serialNumber is checkpoint:", serialNumber)
+		return nil
+	}
+	start := time.Now()
+	session, err := xormdb.NewSession()
+	if err != nil {
+		belogs.Error("CompactRtrFullLogDb(): NewSession fail :", err)
+		return err
+	}
+	defer session.Close()
+
+	_, err = session.Exec(`delete from lab_rpki_rtr_full_log where serialNumber = ?`, serialNumber)
+	if err != nil {
+		return xormdb.RollbackAndLogError(session, "CompactRtrFullLogDb(): delete lab_rpki_rtr_full_log fail: ", err)
+	}
+	_, err = session.Exec(`delete from lab_rpki_rtr_asa_full_log where serialNumber = ?`, serialNumber)
+	if err != nil {
+		return xormdb.RollbackAndLogError(session, "CompactRtrFullLogDb(): delete lab_rpki_rtr_asa_full_log fail: ", err)
+	}
+	_, err = session.Exec(`delete from lab_rpki_rtr_router_key_full_log where serialNumber = ?`, serialNumber)
+	if err != nil {
+		return xormdb.RollbackAndLogError(session, "CompactRtrFullLogDb(): delete lab_rpki_rtr_router_key_full_log fail: ", err)
+	}
+
+	err = xormdb.CommitSession(session)
+	if err != nil {
+		return xormdb.RollbackAndLogError(session, "CompactRtrFullLogDb(): CommitSession fail: ", err)
+	}
+	belogs.Info("CompactRtrFullLogDb(): serialNumber:", serialNumber, "   time(s):", time.Since(start))
+	return nil
+}
@@ -0,0 +1,349 @@
+package history
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/jsonutil"
+)
+
+// counts of all serials are got from whole full log and incremental tables, so they are computed
+// once after every publish or compaction, and are cached
+var historySerialsCache struct {
+	mutex          sync.Mutex
+	key            historySerialsKey
+	historySerials []HistorySerial
+}
+
+// all serialNumbers which are still retained in lab_rpki_rtr_full_log, the newest is first
+func GetHistorySerials() ([]HistorySerial, error) {
+	key, err := getHistorySerialsKeyDb()
+	if err != nil {
+		belogs.Error("GetHistorySerials(): getHistorySerialsKeyDb fail:", err)
+		return nil, err
+	}
+	historySerialsCache.mutex.Lock()
+	defer historySerialsCache.mutex.Unlock()
+	if historySerialsCache.historySerials != nil && historySerialsCache.key == key {
+		belogs.Debug("GetHistorySerials(): use cache, key:", jsonutil.MarshalJson(key))
+		return append([]HistorySerial(nil), historySerialsCache.historySerials...), nil
+	}
+
+	historySerials, err := getHistorySerialsWithCounts()
+	if err != nil {
+		belogs.Error("GetHistorySerials(): getHistorySerialsWithCounts fail:", err)
+		return nil, err
+	}
+	historySerialsCache.key = key
+	historySerialsCache.historySerials = historySerials
+	return append([]HistorySerial(nil), historySerials...), nil
+}
+
+func getHistorySerialsWithCounts() ([]HistorySerial, error) {
+	historySerials, err := getHistorySerialsDb()
+	if err != nil {
+		belogs.Error("getHistorySerialsWithCounts(): getHistorySerialsDb fail:", err)
+		return nil, err
+	}
+	vrpFullLogCounts, vrpDeltaCounts, err := getHistoryCountsDb("lab_rpki_rtr_full_log",
+		"asn, address, prefixLength, maxLength", "lab_rpki_rtr_incremental")
+	if err != nil {
+		belogs.Error("getHistorySerialsWithCounts(): getHistoryCountsDb vrp fail:", err)
+		return nil, err
+	}
+	// addressFamily may be null, and count(distinct) ignores null
+	aspaFullLogCounts, aspaDeltaCounts, err := getHistoryCountsDb("lab_rpki_rtr_asa_full_log",
+		"customerAsn, providerAsn, ifnull(addressFamily, -1)", "lab_rpki_rtr_asa_incremental")
+	if err != nil {
+		belogs.Error("getHistorySerialsWithCounts(): getHistoryCountsDb aspa fail:", err)
+		return nil, err
+	}
+
+	// historySerials are ascending, count is from checkpoint, or from previous count and incrementals
+	var vrpCount, aspaCount int64
+	for i := range historySerials {
+		vrpCount = getHistoryCount(historySerials[i].SerialNumber, vrpCount, vrpFullLogCounts, vrpDeltaCounts)
+		aspaCount = getHistoryCount(historySerials[i].SerialNumber, aspaCount, aspaFullLogCounts, aspaDeltaCounts)
+		historySerials[i].VrpCount = uint64(vrpCount)
+		historySerials[i].AspaCount = uint64(aspaCount)
+	}
+	sort.Slice(historySerials, func(i, j int) bool {
+		return historySerials[i].SerialNumber > historySerials[j].SerialNumber
+	})
+	return historySerials, nil
+}
+
+func getHistoryCount(serialNumber uint64, prevCount int64, fullLogCounts, deltaCounts map[uint64]int64) int64 {
+	if count, ok := fullLogCounts[serialNumber]; ok {
+		return count
+	}
+	count := prevCount + deltaCounts[serialNumber]
+	if count < 0 {
+		return 0
+	}
+	return count
+}
+
+// vrps and aspas at serialNumber, or at the last serialNumber not later than time
+func GetHistoryVrpSet(historyVrpRequest HistoryVrpRequest) (historyVrpSet HistoryVrpSet, err error) {
+	serialNumber := historyVrpRequest.SerialNumber
+	if serialNumber == 0 {
+		if historyVrpRequest.Time.IsZero() {
+			return historyVrpSet, errors.New("serialNumber or time should be set")
+		}
+		var has bool
+		serialNumber, has, err = getHistorySerialNumberByTimeDb(historyVrpRequest.Time)
+		if err != nil {
+			belogs.Error("GetHistoryVrpSet(): getHistorySerialNumberByTimeDb fail:", historyVrpRequest.Time, err)
+			return historyVrpSet, err
+		}
+		if !has {
+			return historyVrpSet, errors.New("no serialNumber is before " + historyVrpRequest.Time.Format("2006-01-02 15:04:05"))
+		}
+	}
+
+	historyVrpSet.HistorySerial, err = getRetainedHistorySerial(serialNumber)
+	if err != nil {
+		belogs.Error("GetHistoryVrpSet(): getRetainedHistorySerial fail:", serialNumber, err)
+		return historyVrpSet, err
+	}
+	historyVrps, historyVrpDeltas, err := getHistoryVrpsDb(serialNumber)
+	if err != nil {
+		belogs.Error("GetHistoryVrpSet(): getHistoryVrpsDb fail:", serialNumber, err)
+		return historyVrpSet, err
+	}
+	historyVrpSet.Vrps = applyHistoryVrpDeltas(historyVrps, historyVrpDeltas)
+
+	historyAspas, historyAspaDeltas, err := getHistoryAspasDb(serialNumber)
+	if err != nil {
+		belogs.Error("GetHistoryVrpSet(): getHistoryAspasDb fail:", serialNumber, err)
+		return historyVrpSet, err
+	}
+	historyVrpSet.Aspas = applyHistoryAspaDeltas(historyAspas, historyAspaDeltas)
+	belogs.Info("GetHistoryVrpSet(): serialNumber:", serialNumber, "  len(Vrps):", len(historyVrpSet.Vrps),
+		"  len(Aspas):", len(historyVrpSet.Aspas))
+	return historyVrpSet, nil
+}
+
+// vrps/aspas which are announced and withdrawn from fromSerialNumber to toSerialNumber
+func DiffHistorySerials(historyDiffRequest HistoryDiffRequest) (historyDiff HistoryDiff, err error) {
+	fromSet, err := GetHistoryVrpSet(HistoryVrpRequest{SerialNumber: historyDiffRequest.FromSerialNumber})
+	if err != nil {
+		belogs.Error("DiffHistorySerials(): GetHistoryVrpSet fromSerialNumber fail:", historyDiffRequest.FromSerialNumber, err)
+		return historyDiff, err
+	}
+	toSet, err := GetHistoryVrpSet(HistoryVrpRequest{SerialNumber: historyDiffRequest.ToSerialNumber})
+	if err != nil {
+		belogs.Error("DiffHistorySerials(): GetHistoryVrpSet toSerialNumber fail:", historyDiffRequest.ToSerialNumber, err)
+		return historyDiff, err
+	}
+	historyDiff.FromSerial = fromSet.HistorySerial
+	historyDiff.ToSerial = toSet.HistorySerial
+
+	announceVrps, withdrawVrps := diffHistoryVrps(fromSet.Vrps, toSet.Vrps)
+	historyDiff.AnnounceAspas, historyDiff.WithdrawAspas = diffHistoryAspas(fromSet.Aspas, toSet.Aspas)
+
+	historyDiff.AnnounceVrps, err = convertHistoryDiffVrps(announceVrps)
+	if err != nil {
+		belogs.Error("DiffHistorySerials(): convertHistoryDiffVrps announceVrps fail:", err)
+		return historyDiff, err
+	}
+	historyDiff.WithdrawVrps, err = convertHistoryDiffVrps(withdrawVrps)
+	if err != nil {
+		belogs.Error("DiffHistorySerials(): convertHistoryDiffVrps withdrawVrps fail:", err)
+		return historyDiff, err
+	}
+	belogs.Info("DiffHistorySerials(): fromSerialNumber:", historyDiffRequest.FromSerialNumber,
+		"  toSerialNumber:", historyDiffRequest.ToSerialNumber,
+		"  len(AnnounceVrps):", len(historyDiff.AnnounceVrps), "  len(WithdrawVrps):", len(historyDiff.WithdrawVrps),
+		"  len(AnnounceAspas):", len(historyDiff.AnnounceAspas), "  len(WithdrawAspas):", len(historyDiff.WithdrawAspas))
+	return historyDiff, nil
+}
+
+func getRetainedHistorySerial(serialNumber uint64) (historySerial HistorySerial, err error) {
+	historySerials, err := GetHistorySerials()
+	if err != nil {
+		return historySerial, err
+	}
+	for i := range historySerials {
+		if historySerials[i].SerialNumber == serialNumber {
+			return historySerials[i], nil
+		}
+	}
+	return historySerial, errors.New("serialNumber " + strconv.FormatUint(serialNumber, 10) +
+		" does not exist or has been cleared")
+}
+
+// rebuild vrps at serialNumber from checkpoint and the incrementals after it, in order of serialNumber
+func applyHistoryVrpDeltas(historyVrps []HistoryVrp, historyVrpDeltas []historyVrpDelta) []HistoryVrp {
+	if len(historyVrpDeltas) == 0 {
+		return historyVrps
+	}
+	historyVrpMap := make(map[string]HistoryVrp, len(historyVrps))
+	keys := make([]string, 0, len(historyVrps))
+	for i := range historyVrps {
+		key := getHistoryVrpKey(&historyVrps[i])
+		historyVrpMap[key] = historyVrps[i]
+		keys = append(keys, key)
+	}
+	for i := range historyVrpDeltas {
+		key := getHistoryVrpKey(&historyVrpDeltas[i].HistoryVrp)
+		if historyVrpDeltas[i].Style == "withdraw" {
+			delete(historyVrpMap, key)
+			continue
+		}
+		if _, ok := historyVrpMap[key]; !ok {
+			keys = append(keys, key)
+		}
+		historyVrpMap[key] = historyVrpDeltas[i].HistoryVrp
+	}
+	result := make([]HistoryVrp, 0, len(historyVrpMap))
+	for _, key := range keys {
+		if historyVrp, ok := historyVrpMap[key]; ok {
+			result = append(result, historyVrp)
+			// key may be withdrawn and announced again
+			delete(historyVrpMap, key)
+		}
+	}
+	return result
+}
+
+func applyHistoryAspaDeltas(historyAspas []HistoryAspa, historyAspaDeltas []historyAspaDelta) []HistoryAspa {
+	if len(historyAspaDeltas) == 0 {
+		return historyAspas
+	}
+	historyAspaMap := make(map[string]HistoryAspa, len(historyAspas))
+	keys := make([]string, 0, len(historyAspas))
+	for i := range historyAspas {
+		key := getHistoryAspaKey(&historyAspas[i])
+		historyAspaMap[key] = historyAspas[i]
+		keys = append(keys, key)
+	}
+	for i := range historyAspaDeltas {
+		key := getHistoryAspaKey(&historyAspaDeltas[i].HistoryAspa)
+		if historyAspaDeltas[i].Style == "withdraw" {
+			delete(historyAspaMap, key)
+			continue
+		}
+		if _, ok := historyAspaMap[key]; !ok {
+			keys = append(keys, key)
+		}
+		historyAspaMap[key] = historyAspaDeltas[i].HistoryAspa
+	}
+	result := make([]HistoryAspa, 0, len(historyAspaMap))
+	for _, key := range keys {
+		if historyAspa, ok := historyAspaMap[key]; ok {
+			result = append(result, historyAspa)
+			delete(historyAspaMap, key)
+		}
+	}
+	return result
+}
+
+func getHistoryVrpKey(historyVrp *HistoryVrp) string {
+	return strconv.FormatInt(historyVrp.Asn, 10) + "_" + historyVrp.Address + "_" +
+		strconv.FormatUint(historyVrp.PrefixLength, 10) + "_" + strconv.FormatUint(historyVrp.MaxLength, 10)
+}
+
+func getHistoryAspaKey(historyAspa *HistoryAspa) string {
+	return strconv.FormatUint(historyAspa.CustomerAsn, 10) + "_" + strconv.FormatUint(historyAspa.ProviderAsn, 10) + "_" +
+		strconv.FormatUint(historyAspa.AddressFamily, 10)
+}
+
+// announced are in toVrps but not in fromVrps, withdrawn are in fromVrps but not in toVrps
+func diffHistoryVrps(fromVrps, toVrps []HistoryVrp) (announceVrps, withdrawVrps []HistoryVrp) {
+	fromKeys := make(map[string]struct{}, len(fromVrps))
+	for i := range fromVrps {
+		fromKeys[getHistoryVrpKey(&fromVrps[i])] = struct{}{}
+	}
+	toKeys := make(map[string]struct{}, len(toVrps))
+	announceVrps = make([]HistoryVrp, 0)
+	for i := range toVrps {
+		key := getHistoryVrpKey(&toVrps[i])
+		toKeys[key] = struct{}{}
+		if _, ok := fromKeys[key]; !ok {
+			announceVrps = append(announceVrps, toVrps[i])
+		}
+	}
+	withdrawVrps = make([]HistoryVrp, 0)
+	for i := range fromVrps {
+		if _, ok := toKeys[getHistoryVrpKey(&fromVrps[i])]; !ok {
+			withdrawVrps = append(withdrawVrps, fromVrps[i])
+		}
+	}
+	return announceVrps, withdrawVrps
+}
+
+func diffHistoryAspas(fromAspas, toAspas []HistoryAspa) (announceAspas, withdrawAspas []HistoryAspa) {
+	fromKeys := make(map[string]struct{}, len(fromAspas))
+	for i := range fromAspas {
+		fromKeys[getHistoryAspaKey(&fromAspas[i])] = struct{}{}
+	}
+	toKeys := make(map[string]struct{}, len(toAspas))
+	announceAspas = make([]HistoryAspa, 0)
+	for i := range toAspas {
+		key := getHistoryAspaKey(&toAspas[i])
+		toKeys[key] = struct{}{}
+		if _, ok := fromKeys[key]; !ok {
+			announceAspas = append(announceAspas, toAspas[i])
+		}
+	}
+	withdrawAspas = make([]HistoryAspa, 0)
+	for i := range fromAspas {
+		if _, ok := toKeys[getHistoryAspaKey(&fromAspas[i])]; !ok {
+			withdrawAspas = append(withdrawAspas, fromAspas[i])
+		}
+	}
+	return announceAspas, withdrawAspas
+}
+
+// parse sourceFrom, and find the roa file by syncLogFileId
+func convertHistoryDiffVrps(historyVrps []HistoryVrp) (historyDiffVrps []HistoryDiffVrp, err error) {
+	historyDiffVrps = make([]HistoryDiffVrp, 0, len(historyVrps))
+	syncLogFileIds := make([]uint64, 0)
+	for i := range historyVrps {
+		historyDiffVrp := HistoryDiffVrp{
+			Asn:          historyVrps[i].Asn,
+			Address:      historyVrps[i].Address,
+			PrefixLength: historyVrps[i].PrefixLength,
+			MaxLength:    historyVrps[i].MaxLength,
+		}
+		if len(historyVrps[i].SourceFrom) > 0 {
+			err = jsonutil.UnmarshalJson(historyVrps[i].SourceFrom, &historyDiffVrp.SourceFrom)
+			if err != nil {
+				belogs.Error("convertHistoryDiffVrps(): UnmarshalJson sourceFrom fail:", historyVrps[i].SourceFrom, err)
+				return nil, err
+			}
+		}
+		if historyDiffVrp.SourceFrom.SyncLogFileId > 0 {
+			syncLogFileIds = append(syncLogFileIds, historyDiffVrp.SourceFrom.SyncLogFileId)
+		}
+		historyDiffVrps = append(historyDiffVrps, historyDiffVrp)
+	}
+	if len(syncLogFileIds) == 0 {
+		return historyDiffVrps, nil
+	}
+
+	sort.Slice(syncLogFileIds, func(i, j int) bool { return syncLogFileIds[i] < syncLogFileIds[j] })
+	uniqueIds := syncLogFileIds[:1]
+	for _, id := range syncLogFileIds[1:] {
+		if id != uniqueIds[len(uniqueIds)-1] {
+			uniqueIds = append(uniqueIds, id)
+		}
+	}
+	historySourceFiles, err := getHistorySourceFilesDb(uniqueIds)
+	if err != nil {
+		belogs.Error("convertHistoryDiffVrps(): getHistorySourceFilesDb fail:", err)
+		return nil, err
+	}
+	for i := range historyDiffVrps {
+		if f, ok := historySourceFiles[historyDiffVrps[i].SourceFrom.SyncLogFileId]; ok {
+			historySourceFile := f
+			historyDiffVrps[i].SourceFile = &historySourceFile
+		}
+	}
+	return historyDiffVrps, nil
+}
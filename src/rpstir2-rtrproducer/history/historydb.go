@@ -0,0 +1,177 @@
+package history
+
+import (
+	"time"
+
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/xormdb"
+)
+
+// serialNumbers which are older than the min serialNumber in lab_rpki_rtr_full_log have been cleared,
+// counts are not in sql, because lab_rpki_rtr_full_log only keeps checkpoints and the latest serialNumber
+func getHistorySerialsDb() (historySerials []HistorySerial, err error) {
+	historySerials = make([]HistorySerial, 0)
+	sql := `select serialNumber, createTime from lab_rpki_rtr_serial_number
+		where serialNumber >= (select min(serialNumber) from lab_rpki_rtr_full_log) order by serialNumber `
+	err = xormdb.XormEngine.SQL(sql).Find(&historySerials)
+	if err != nil {
+		belogs.Error("getHistorySerialsDb(): select lab_rpki_rtr_serial_number fail:", err)
+		return nil, err
+	}
+	belogs.Debug("getHistorySerialsDb(): len(historySerials):", len(historySerials))
+	return historySerials, nil
+}
+
+// serialNumber --> count of distinct keyColumns in full log, because full log has no unique key and may have duplicated rows,
+// and serialNumber --> count of announce minus count of withdraw in incremental
+func getHistoryCountsDb(fullLogTable, keyColumns, incrementalTable string) (fullLogCounts, deltaCounts map[uint64]int64, err error) {
+	historyCounts := make([]historyCount, 0)
+	err = xormdb.XormEngine.SQL(`select serialNumber, count(distinct ` + keyColumns + `) as count from ` + fullLogTable +
+		` group by serialNumber`).Find(&historyCounts)
+	if err != nil {
+		belogs.Error("getHistoryCountsDb(): select fail:", fullLogTable, err)
+		return nil, nil, err
+	}
+	fullLogCounts = make(map[uint64]int64, len(historyCounts))
+	for i := range historyCounts {
+		fullLogCounts[historyCounts[i].SerialNumber] = historyCounts[i].Count
+	}
+
+	historyCounts = make([]historyCount, 0)
+	err = xormdb.XormEngine.SQL(`select serialNumber, sum(case when style = 'announce' then 1 else -1 end) as count from ` +
+		incrementalTable + ` group by serialNumber`).Find(&historyCounts)
+	if err != nil {
+		belogs.Error("getHistoryCountsDb(): select fail:", incrementalTable, err)
+		return nil, nil, err
+	}
+	deltaCounts = make(map[uint64]int64, len(historyCounts))
+	for i := range historyCounts {
+		deltaCounts[historyCounts[i].SerialNumber] = historyCounts[i].Count
+	}
+	belogs.Debug("getHistoryCountsDb():", fullLogTable, len(fullLogCounts), incrementalTable, len(deltaCounts))
+	return fullLogCounts, deltaCounts, nil
+}
+
+// it is changed when a new serialNumber is published, or full log is compacted or cleared
+func getHistorySerialsKeyDb() (historySerialsKey historySerialsKey, err error) {
+	sql := `select (select ifnull(max(serialNumber), 0) from lab_rpki_rtr_serial_number) as serialNumber,
+			(select ifnull(min(serialNumber), 0) from lab_rpki_rtr_full_log) as minFullLogSerialNumber,
+			(select count(distinct serialNumber) from lab_rpki_rtr_full_log) as fullLogSerialCount `
+	_, err = xormdb.XormEngine.SQL(sql).Get(&historySerialsKey)
+	if err != nil {
+		belogs.Error("getHistorySerialsKeyDb(): select lab_rpki_rtr_serial_number and lab_rpki_rtr_full_log fail:", err)
+		return historySerialsKey, err
+	}
+	return historySerialsKey, nil
+}
+
+// the last serialNumber which is created not later than t
+func getHistorySerialNumberByTimeDb(t time.Time) (serialNumber uint64, has bool, err error) {
+	sql := `select serialNumber from lab_rpki_rtr_serial_number where createTime <= ? order by serialNumber desc limit 1`
+	has, err = xormdb.XormEngine.SQL(sql, t).Get(&serialNumber)
+	if err != nil {
+		belogs.Error("getHistorySerialNumberByTimeDb(): select lab_rpki_rtr_serial_number fail, t:", t, err)
+		return 0, false, err
+	}
+	return serialNumber, has, nil
+}
+
+// the latest serialNumber in full log which is not later than serialNumber, it is the base to apply incrementals
+func getHistoryBaseSerialNumberDb(fullLogTable string, serialNumber uint64) (baseSerialNumber uint64, has bool, err error) {
+	sql := `select serialNumber from ` + fullLogTable + ` where serialNumber <= ? order by serialNumber desc limit 1`
+	has, err = xormdb.XormEngine.SQL(sql, serialNumber).Get(&baseSerialNumber)
+	if err != nil {
+		belogs.Error("getHistoryBaseSerialNumberDb(): select fail:", fullLogTable, serialNumber, err)
+		return 0, false, err
+	}
+	return baseSerialNumber, has, nil
+}
+
+// vrps in checkpoint, and the incrementals after checkpoint to serialNumber
+func getHistoryVrpsDb(serialNumber uint64) (historyVrps []HistoryVrp, historyVrpDeltas []historyVrpDelta, err error) {
+	start := time.Now()
+	historyVrps = make([]HistoryVrp, 0)
+	historyVrpDeltas = make([]historyVrpDelta, 0)
+	baseSerialNumber, has, err := getHistoryBaseSerialNumberDb("lab_rpki_rtr_full_log", serialNumber)
+	if err != nil {
+		belogs.Error("getHistoryVrpsDb(): getHistoryBaseSerialNumberDb fail, serialNumber:", serialNumber, err)
+		return nil, nil, err
+	}
+	if has {
+		sql := `select asn, address, prefixLength, maxLength, sourceFrom from lab_rpki_rtr_full_log
+			where serialNumber = ? order by id `
+		err = xormdb.XormEngine.SQL(sql, baseSerialNumber).Find(&historyVrps)
+		if err != nil {
+			belogs.Error("getHistoryVrpsDb(): select lab_rpki_rtr_full_log fail, baseSerialNumber:", baseSerialNumber, err)
+			return nil, nil, err
+		}
+	}
+	if baseSerialNumber < serialNumber {
+		sql := `select style, asn, address, prefixLength, maxLength, sourceFrom from lab_rpki_rtr_incremental
+			where serialNumber > ? and serialNumber <= ? order by serialNumber, id `
+		err = xormdb.XormEngine.SQL(sql, baseSerialNumber, serialNumber).Find(&historyVrpDeltas)
+		if err != nil {
+			belogs.Error("getHistoryVrpsDb(): select lab_rpki_rtr_incremental fail, baseSerialNumber:", baseSerialNumber,
+				"  serialNumber:", serialNumber, err)
+			return nil, nil, err
+		}
+	}
+	belogs.Info("getHistoryVrpsDb(): serialNumber:", serialNumber, "  baseSerialNumber:", baseSerialNumber,
+		"  len(historyVrps):", len(historyVrps), "  len(historyVrpDeltas):", len(historyVrpDeltas), "  time(s):", time.Since(start))
+	return historyVrps, historyVrpDeltas, nil
+}
+
+func getHistoryAspasDb(serialNumber uint64) (historyAspas []HistoryAspa, historyAspaDeltas []historyAspaDelta, err error) {
+	historyAspas = make([]HistoryAspa, 0)
+	historyAspaDeltas = make([]historyAspaDelta, 0)
+	baseSerialNumber, has, err := getHistoryBaseSerialNumberDb("lab_rpki_rtr_asa_full_log", serialNumber)
+	if err != nil {
+		belogs.Error("getHistoryAspasDb(): getHistoryBaseSerialNumberDb fail, serialNumber:", serialNumber, err)
+		return nil, nil, err
+	}
+	if has {
+		sql := `select customerAsn, providerAsn, addressFamily, sourceFrom from lab_rpki_rtr_asa_full_log
+			where serialNumber = ? order by id `
+		err = xormdb.XormEngine.SQL(sql, baseSerialNumber).Find(&historyAspas)
+		if err != nil {
+			belogs.Error("getHistoryAspasDb(): select lab_rpki_rtr_asa_full_log fail, baseSerialNumber:", baseSerialNumber, err)
+			return nil, nil, err
+		}
+	}
+	if baseSerialNumber < serialNumber {
+		sql := `select style, customerAsn, providerAsn, addressFamily, sourceFrom from lab_rpki_rtr_asa_incremental
+			where serialNumber > ? and serialNumber <= ? order by serialNumber, id `
+		err = xormdb.XormEngine.SQL(sql, baseSerialNumber, serialNumber).Find(&historyAspaDeltas)
+		if err != nil {
+			belogs.Error("getHistoryAspasDb(): select lab_rpki_rtr_asa_incremental fail, baseSerialNumber:", baseSerialNumber,
+				"  serialNumber:", serialNumber, err)
+			return nil, nil, err
+		}
+	}
+	belogs.Debug("getHistoryAspasDb(): serialNumber:", serialNumber, "  baseSerialNumber:", baseSerialNumber,
+		"  len(historyAspas):", len(historyAspas), "  len(historyAspaDeltas):", len(historyAspaDeltas))
+	return historyAspas, historyAspaDeltas, nil
+}
+
+// syncLogFileId --> file, files which have been cleared are not in map
+func getHistorySourceFilesDb(syncLogFileIds []uint64) (historySourceFiles map[uint64]HistorySourceFile, err error) {
+	historySourceFiles = make(map[uint64]HistorySourceFile, len(syncLogFileIds))
+	for i := 0; i < len(syncLogFileIds); i += 1000 {
+		end := i + 1000
+		if end > len(syncLogFileIds) {
+			end = len(syncLogFileIds)
+		}
+		files := make([]HistorySourceFile, 0, end-i)
+		err = xormdb.XormEngine.Table("lab_rpki_sync_log_file").Cols("id,syncTime,syncType,filePath,fileName,sourceUrl").
+			In("id", syncLogFileIds[i:end]).Find(&files)
+		if err != nil {
+			belogs.Error("getHistorySourceFilesDb(): select lab_rpki_sync_log_file fail, len(syncLogFileIds):", len(syncLogFileIds), err)
+			return nil, err
+		}
+		for j := range files {
+			historySourceFiles[files[j].SyncLogFileId] = files[j]
+		}
+	}
+	belogs.Debug("getHistorySourceFilesDb(): len(syncLogFileIds):", len(syncLogFileIds), "  len(historySourceFiles):", len(historySourceFiles))
+	return historySourceFiles, nil
+}
@@ -0,0 +1,102 @@
+package history
+
+import (
+	"time"
+
+	model "rpstir2-model"
+)
+
+// serialNumber which is still retained, its vrps are in checkpoint of lab_rpki_rtr_full_log and incrementals
+type HistorySerial struct {
+	SerialNumber uint64    `json:"serialNumber" xorm:"serialNumber bigint"`
+	CreateTime   time.Time `json:"createTime" xorm:"createTime datetime"`
+	VrpCount     uint64    `json:"vrpCount" xorm:"vrpCount int"`
+	AspaCount    uint64    `json:"aspaCount" xorm:"aspaCount int"`
+}
+
+// serialNumber, or the last serialNumber not later than time when serialNumber is 0
+type HistoryVrpRequest struct {
+	SerialNumber uint64    `json:"serialNumber"`
+	Time         time.Time `json:"time"`
+}
+
+type HistoryDiffRequest struct {
+	FromSerialNumber uint64 `json:"fromSerialNumber"`
+	ToSerialNumber   uint64 `json:"toSerialNumber"`
+}
+
+// one row in lab_rpki_rtr_full_log, address may be trimmed
+type HistoryVrp struct {
+	Asn          int64  `json:"asn" xorm:"asn bigint"`
+	Address      string `json:"address" xorm:"address varchar(512)"`
+	PrefixLength uint64 `json:"prefixLength" xorm:"prefixLength int"`
+	MaxLength    uint64 `json:"maxLength" xorm:"maxLength int"`
+	SourceFrom   string `json:"sourceFrom" xorm:"sourceFrom json"`
+}
+
+// one row in lab_rpki_rtr_asa_full_log
+type HistoryAspa struct {
+	CustomerAsn   uint64 `json:"customerAsn" xorm:"customerAsn int"`
+	ProviderAsn   uint64 `json:"providerAsn" xorm:"providerAsn int"`
+	AddressFamily uint64 `json:"addressFamily" xorm:"addressFamily int"`
+	SourceFrom    string `json:"sourceFrom" xorm:"sourceFrom json"`
+}
+
+// one row in lab_rpki_rtr_incremental, style is announce or withdraw
+type historyVrpDelta struct {
+	Style      string `xorm:"style varchar(16)"`
+	HistoryVrp `xorm:"extends"`
+}
+
+// one row in lab_rpki_rtr_asa_incremental
+type historyAspaDelta struct {
+	Style       string `xorm:"style varchar(16)"`
+	HistoryAspa `xorm:"extends"`
+}
+
+type historySerialsKey struct {
+	SerialNumber           uint64 `xorm:"serialNumber bigint"`
+	MinFullLogSerialNumber uint64 `xorm:"minFullLogSerialNumber bigint"`
+	FullLogSerialCount     uint64 `xorm:"fullLogSerialCount bigint"`
+}
+
+type historyCount struct {
+	SerialNumber uint64 `xorm:"serialNumber bigint"`
+	Count        int64  `xorm:"count bigint"`
+}
+
+type HistoryVrpSet struct {
+	HistorySerial
+	Vrps  []HistoryVrp  `json:"vrps"`
+	Aspas []HistoryAspa `json:"aspas"`
+}
+
+// the roa file which causes the vrp, from lab_rpki_sync_log_file
+type HistorySourceFile struct {
+	SyncLogFileId uint64    `json:"syncLogFileId" xorm:"id int"`
+	SyncTime      time.Time `json:"syncTime" xorm:"syncTime datetime"`
+	SyncType      string    `json:"syncType" xorm:"syncType varchar(16)"`
+	FilePath      string    `json:"filePath" xorm:"filePath varchar(1024)"`
+	FileName      string    `json:"fileName" xorm:"fileName varchar(128)"`
+	SourceUrl     string    `json:"sourceUrl" xorm:"sourceUrl varchar(512)"`
+}
+
+// sourceFile is empty when the vrp is from slurm, or the sync log file has been cleared
+type HistoryDiffVrp struct {
+	Asn          int64                      `json:"asn"`
+	Address      string                     `json:"address"`
+	PrefixLength uint64                     `json:"prefixLength"`
+	MaxLength    uint64                     `json:"maxLength"`
+	SourceFrom   model.LabRpkiRtrSourceFrom `json:"sourceFrom"`
+	SourceFile   *HistorySourceFile         `json:"sourceFile,omitempty"`
+}
+
+// withdrawn vrps/aspas are from fromSerialNumber, announced are from toSerialNumber
+type HistoryDiff struct {
+	FromSerial    HistorySerial    `json:"fromSerial"`
+	ToSerial      HistorySerial    `json:"toSerial"`
+	AnnounceVrps  []HistoryDiffVrp `json:"announceVrps"`
+	WithdrawVrps  []HistoryDiffVrp `json:"withdrawVrps"`
+	AnnounceAspas []HistoryAspa    `json:"announceAspas"`
+	WithdrawAspas []HistoryAspa    `json:"withdrawAspas"`
+}
@@ -0,0 +1,67 @@
+package rtrproducer
+
+import (
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/ginserver"
+	"github.com/cpusoft/goutil/jsonutil"
+	"github.com/gin-gonic/gin"
+	rtrhistory "rpstir2-rtrproducer/history"
+)
+
+// serialNumbers which are still retained in lab_rpki_rtr_full_log
+func HistorySerials(c *gin.Context) {
+	belogs.Info("HistorySerials(): http start")
+
+	historySerials, err := rtrhistory.GetHistorySerials()
+	if err != nil {
+		belogs.Error("HistorySerials(): GetHistorySerials fail:", err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	belogs.Info("HistorySerials(): http ok, len(historySerials):", len(historySerials))
+	ginserver.ResponseOk(c, historySerials)
+}
+
+// vrps and aspas at serialNumber, or at time
+func HistoryVrps(c *gin.Context) {
+	belogs.Info("HistoryVrps(): http start")
+
+	historyVrpRequest := rtrhistory.HistoryVrpRequest{}
+	err := c.ShouldBindJSON(&historyVrpRequest)
+	if err != nil {
+		belogs.Error("HistoryVrps(): ShouldBindJSON fail:", err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	historyVrpSet, err := rtrhistory.GetHistoryVrpSet(historyVrpRequest)
+	if err != nil {
+		belogs.Error("HistoryVrps(): GetHistoryVrpSet fail:", jsonutil.MarshalJson(historyVrpRequest), err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	belogs.Info("HistoryVrps(): http ok, serialNumber:", historyVrpSet.SerialNumber,
+		"  len(Vrps):", len(historyVrpSet.Vrps), "  len(Aspas):", len(historyVrpSet.Aspas))
+	ginserver.ResponseOk(c, historyVrpSet)
+}
+
+// announced and withdrawn vrps/aspas between two serialNumbers
+func HistoryDiff(c *gin.Context) {
+	belogs.Info("HistoryDiff(): http start")
+
+	historyDiffRequest := rtrhistory.HistoryDiffRequest{}
+	err := c.ShouldBindJSON(&historyDiffRequest)
+	if err != nil {
+		belogs.Error("HistoryDiff(): ShouldBindJSON fail:", err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	historyDiff, err := rtrhistory.DiffHistorySerials(historyDiffRequest)
+	if err != nil {
+		belogs.Error("HistoryDiff(): DiffHistorySerials fail:", jsonutil.MarshalJson(historyDiffRequest), err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	belogs.Info("HistoryDiff(): http ok, historyDiffRequest:", jsonutil.MarshalJson(historyDiffRequest),
+		"  len(AnnounceVrps):", len(historyDiff.AnnounceVrps), "  len(WithdrawVrps):", len(historyDiff.WithdrawVrps))
+	ginserver.ResponseOk(c, historyDiff)
+}
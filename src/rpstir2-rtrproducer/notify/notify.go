@@ -0,0 +1,353 @@
+package notify
+
+import (
+	"errors"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/conf"
+	"github.com/cpusoft/goutil/fileutil"
+	"github.com/cpusoft/goutil/httpclient"
+	"github.com/cpusoft/goutil/jsonutil"
+	"github.com/cpusoft/goutil/osutil"
+	model "rpstir2-model"
+	"rpstir2-rov/validate"
+)
+
+// when vrps/aspas of current serial are changed, post summary to notify::webhookUrls and write to notify::spoolDir.
+// reason is sync/slurm, serialNumber is the one just published by reason.
+func NotifyRtrChange(reason string, serialNumber uint64) (err error) {
+	if !conf.Bool("notify::enable") {
+		return nil
+	}
+	start := time.Now()
+	notifySummary, changed, err := getNotifySummary(reason, serialNumber)
+	if err != nil {
+		belogs.Error("NotifyRtrChange(): getNotifySummary fail:", reason, serialNumber, err)
+		return err
+	}
+	if !changed {
+		belogs.Info("NotifyRtrChange(): no watched vrps/aspas are changed, serialNumber:", serialNumber)
+		return nil
+	}
+
+	body := jsonutil.MarshalJson(notifySummary)
+	spoolErr := writeNotifySpool(notifySummary, body)
+	webhookErr := postNotifyWebhooks(body)
+	belogs.Info("NotifyRtrChange(): serialNumber:", notifySummary.SerialNumber, "  reason:", reason,
+		"  announceVrpCount:", notifySummary.AnnounceVrpCount, "  withdrawVrpCount:", notifySummary.WithdrawVrpCount,
+		"  announceAspaCount:", notifySummary.AnnounceAspaCount, "  withdrawAspaCount:", notifySummary.WithdrawAspaCount,
+		"  time(s):", time.Since(start))
+	if spoolErr != nil {
+		return spoolErr
+	}
+	return webhookErr
+}
+
+// alarm such as safety brake, post to notify::webhookUrls and write to notify::spoolDir, ignore watch lists
+func NotifyAlarm(alarm string, serialNumber uint64, detail interface{}) (err error) {
+	// alarm is always logged, even it is not notified
+	belogs.Error("NotifyAlarm(): alarm:", alarm, "  serialNumber:", serialNumber, "  detail:", jsonutil.MarshalJson(detail))
+	if !conf.Bool("notify::enable") {
+		return nil
+	}
+	notifyAlarm := NotifyAlarmModel{
+		Alarm:        alarm,
+		SerialNumber: serialNumber,
+		NotifyTime:   time.Now(),
+		Detail:       detail,
+	}
+	body := jsonutil.MarshalJson(notifyAlarm)
+	spoolErr := writeNotifySpoolFile("rtr-alarm-"+alarm+"-"+strconv.FormatUint(serialNumber, 10)+"-"+
+		notifyAlarm.NotifyTime.Format("20060102150405")+".json", body)
+	webhookErr := postNotifyWebhooks(body)
+	belogs.Info("NotifyAlarm(): notified alarm:", alarm, "  serialNumber:", serialNumber)
+	if spoolErr != nil {
+		return spoolErr
+	}
+	return webhookErr
+}
+
+// changed is false when nothing is changed, or watch lists are set but none is affected
+func getNotifySummary(reason string, serialNumber uint64) (notifySummary NotifySummary, changed bool, err error) {
+	notifyVrps, err := getNotifyVrpsDb(serialNumber)
+	if err != nil {
+		belogs.Error("getNotifySummary(): getNotifyVrpsDb fail:", serialNumber, err)
+		return notifySummary, false, err
+	}
+	notifyAspas, err := getNotifyAspasDb(serialNumber)
+	if err != nil {
+		belogs.Error("getNotifySummary(): getNotifyAspasDb fail:", serialNumber, err)
+		return notifySummary, false, err
+	}
+	if len(notifyVrps) == 0 && len(notifyAspas) == 0 {
+		return notifySummary, false, nil
+	}
+	for i := range notifyVrps {
+		prefix, err := validate.ConvertRtrAddressToPrefix(notifyVrps[i].Address, notifyVrps[i].PrefixLength)
+		if err != nil {
+			belogs.Error("getNotifySummary(): ConvertRtrAddressToPrefix fail:", jsonutil.MarshalJson(notifyVrps[i]), err)
+			return notifySummary, false, err
+		}
+		notifyVrps[i].Prefix = prefix.String()
+		notifyVrps[i].Ta = getNotifyTa(notifyVrps[i].Source, notifyVrps[i].FilePath)
+	}
+	for i := range notifyAspas {
+		notifyAspas[i].Ta = getNotifyTa(notifyAspas[i].Source, notifyAspas[i].FilePath)
+	}
+
+	notifySummary = NotifySummary{
+		Reason:         reason,
+		SerialNumber:   serialNumber,
+		NotifyTime:     time.Now(),
+		TalCounts:      make(map[string]*NotifyCount),
+		TopChangedAsns: getTopChangedAsns(notifyVrps, notifyAspas, conf.Int("notify::topAsnCount")),
+	}
+	if serialNumber > 0 {
+		notifySummary.CurSerialNumber = serialNumber - 1
+	}
+	countNotifyChanges(&notifySummary, notifyVrps, notifyAspas)
+
+	watchPrefixes, watchAsns, err := getNotifyWatchLists()
+	if err != nil {
+		belogs.Error("getNotifySummary(): getNotifyWatchLists fail:", err)
+		return notifySummary, false, err
+	}
+	if len(watchPrefixes) > 0 || len(watchAsns) > 0 {
+		notifySummary.WatchedVrps, notifySummary.WatchedAspas = filterWatchedChanges(notifyVrps, notifyAspas, watchPrefixes, watchAsns)
+		if len(notifySummary.WatchedVrps) == 0 && len(notifySummary.WatchedAspas) == 0 {
+			return notifySummary, false, nil
+		}
+	}
+	if conf.Bool("notify::withDeltas") {
+		notifySummary.Vrps = notifyVrps
+		notifySummary.Aspas = notifyAspas
+	}
+	return notifySummary, true, nil
+}
+
+// ta(rir) is judged by file path of roa/asa in sync log file, or is source when not from sync
+func getNotifyTa(source, filePath string) string {
+	if source != "sync" {
+		return source
+	}
+	if len(filePath) == 0 {
+		return "unknown"
+	}
+	origin := model.JudgeOriginByFilePath(filePath)
+	if origin == nil || len(origin.Rir) == 0 {
+		return "unknown"
+	}
+	return origin.Rir
+}
+
+func countNotifyChanges(notifySummary *NotifySummary, notifyVrps []NotifyVrp, notifyAspas []NotifyAspa) {
+	getTalCount := func(ta string) *NotifyCount {
+		notifyCount, ok := notifySummary.TalCounts[ta]
+		if !ok {
+			notifyCount = &NotifyCount{}
+			notifySummary.TalCounts[ta] = notifyCount
+		}
+		return notifyCount
+	}
+	for i := range notifyVrps {
+		if notifyVrps[i].Style == "announce" {
+			notifySummary.AnnounceVrpCount++
+			getTalCount(notifyVrps[i].Ta).AnnounceVrpCount++
+		} else {
+			notifySummary.WithdrawVrpCount++
+			getTalCount(notifyVrps[i].Ta).WithdrawVrpCount++
+		}
+	}
+	for i := range notifyAspas {
+		if notifyAspas[i].Style == "announce" {
+			notifySummary.AnnounceAspaCount++
+			getTalCount(notifyAspas[i].Ta).AnnounceAspaCount++
+		} else {
+			notifySummary.WithdrawAspaCount++
+			getTalCount(notifyAspas[i].Ta).WithdrawAspaCount++
+		}
+	}
+}
+
+// asns which have the most announced and withdrawn vrps/aspas, default is top 10
+func getTopChangedAsns(notifyVrps []NotifyVrp, notifyAspas []NotifyAspa, topAsnCount int) []NotifyAsnCount {
+	if topAsnCount <= 0 {
+		topAsnCount = 10
+	}
+	asnCounts := make(map[uint64]*NotifyAsnCount)
+	addAsnCount := func(asn uint64, style string) {
+		asnCount, ok := asnCounts[asn]
+		if !ok {
+			asnCount = &NotifyAsnCount{Asn: asn}
+			asnCounts[asn] = asnCount
+		}
+		if style == "announce" {
+			asnCount.AnnounceCount++
+		} else {
+			asnCount.WithdrawCount++
+		}
+	}
+	for i := range notifyVrps {
+		addAsnCount(uint64(notifyVrps[i].Asn), notifyVrps[i].Style)
+	}
+	for i := range notifyAspas {
+		addAsnCount(notifyAspas[i].CustomerAsn, notifyAspas[i].Style)
+	}
+
+	topChangedAsns := make([]NotifyAsnCount, 0, len(asnCounts))
+	for _, asnCount := range asnCounts {
+		topChangedAsns = append(topChangedAsns, *asnCount)
+	}
+	sort.Slice(topChangedAsns, func(i, j int) bool {
+		ci := topChangedAsns[i].AnnounceCount + topChangedAsns[i].WithdrawCount
+		cj := topChangedAsns[j].AnnounceCount + topChangedAsns[j].WithdrawCount
+		if ci != cj {
+			return ci > cj
+		}
+		return topChangedAsns[i].Asn < topChangedAsns[j].Asn
+	})
+	if len(topChangedAsns) > topAsnCount {
+		topChangedAsns = topChangedAsns[:topAsnCount]
+	}
+	return topChangedAsns
+}
+
+// notify::watchPrefixes and notify::watchAsns are split by ','
+func getNotifyWatchLists() (watchPrefixes []netip.Prefix, watchAsns map[uint64]struct{}, err error) {
+	watchPrefixes = make([]netip.Prefix, 0)
+	for _, s := range strings.Split(conf.String("notify::watchPrefixes"), ",") {
+		s = strings.TrimSpace(s)
+		if len(s) == 0 {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			belogs.Error("getNotifyWatchLists(): ParsePrefix fail:", s, err)
+			return nil, nil, errors.New("notify::watchPrefixes " + s + " is invalid prefix")
+		}
+		watchPrefixes = append(watchPrefixes, prefix.Masked())
+	}
+	watchAsns = make(map[uint64]struct{})
+	for _, s := range strings.Split(conf.String("notify::watchAsns"), ",") {
+		s = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(s)), "AS")
+		if len(s) == 0 {
+			continue
+		}
+		asn, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			belogs.Error("getNotifyWatchLists(): ParseUint fail:", s, err)
+			return nil, nil, errors.New("notify::watchAsns " + s + " is invalid asn")
+		}
+		watchAsns[asn] = struct{}{}
+	}
+	return watchPrefixes, watchAsns, nil
+}
+
+// vrps which overlap watched prefixes or have watched asn, aspas whose customerAsn or providerAsn is watched
+func filterWatchedChanges(notifyVrps []NotifyVrp, notifyAspas []NotifyAspa,
+	watchPrefixes []netip.Prefix, watchAsns map[uint64]struct{}) (watchedVrps []NotifyVrp, watchedAspas []NotifyAspa) {
+	watchedVrps = make([]NotifyVrp, 0)
+	for i := range notifyVrps {
+		if _, ok := watchAsns[uint64(notifyVrps[i].Asn)]; ok {
+			watchedVrps = append(watchedVrps, notifyVrps[i])
+			continue
+		}
+		prefix, err := netip.ParsePrefix(notifyVrps[i].Prefix)
+		if err != nil {
+			continue
+		}
+		for j := range watchPrefixes {
+			if watchPrefixes[j].Overlaps(prefix) {
+				watchedVrps = append(watchedVrps, notifyVrps[i])
+				break
+			}
+		}
+	}
+	watchedAspas = make([]NotifyAspa, 0)
+	for i := range notifyAspas {
+		_, customerOk := watchAsns[notifyAspas[i].CustomerAsn]
+		_, providerOk := watchAsns[notifyAspas[i].ProviderAsn]
+		if customerOk || providerOk {
+			watchedAspas = append(watchedAspas, notifyAspas[i])
+		}
+	}
+	return watchedVrps, watchedAspas
+}
+
+// write to notify::spoolDir as rtr-notify-{serialNumber}-{time}.json, so it can be picked up by other tools
+func writeNotifySpool(notifySummary NotifySummary, body string) (err error) {
+	return writeNotifySpoolFile("rtr-notify-"+strconv.FormatUint(notifySummary.SerialNumber, 10)+"-"+
+		notifySummary.NotifyTime.Format("20060102150405")+".json", body)
+}
+
+func writeNotifySpoolFile(file, body string) (err error) {
+	spoolDir := conf.String("notify::spoolDir")
+	if len(spoolDir) == 0 {
+		return nil
+	}
+	err = os.MkdirAll(spoolDir, 0755)
+	if err != nil {
+		belogs.Error("writeNotifySpoolFile(): MkdirAll fail:", spoolDir, err)
+		return err
+	}
+	fileName := osutil.JoinPathFile(spoolDir, file)
+	err = fileutil.WriteBytesToFile(fileName, []byte(body))
+	if err != nil {
+		belogs.Error("writeNotifySpoolFile(): WriteBytesToFile fail:", fileName, err)
+		return err
+	}
+	belogs.Info("writeNotifySpoolFile(): fileName:", fileName)
+	return nil
+}
+
+// post to every url in notify::webhookUrls, retry notify::retryCount times when fail
+func postNotifyWebhooks(body string) (err error) {
+	retryCount := conf.Int("notify::retryCount")
+	if retryCount < 0 {
+		retryCount = 0
+	}
+	retryIntervalSeconds := conf.Int("notify::retryIntervalSeconds")
+	if retryIntervalSeconds <= 0 {
+		retryIntervalSeconds = 10
+	}
+	verify := conf.Bool("notify::webhookVerifyHttps")
+	for _, url := range strings.Split(conf.String("notify::webhookUrls"), ",") {
+		url = strings.TrimSpace(url)
+		if len(url) == 0 {
+			continue
+		}
+		var err1 error
+		for i := 0; i <= retryCount; i++ {
+			if i > 0 {
+				time.Sleep(time.Duration(retryIntervalSeconds) * time.Second)
+			}
+			err1 = postNotifyWebhook(url, body, verify)
+			if err1 == nil {
+				break
+			}
+			belogs.Error("postNotifyWebhooks(): postNotifyWebhook fail, url:", url, "  try:", i+1, err1)
+		}
+		if err1 != nil {
+			err = err1
+		}
+	}
+	return err
+}
+
+func postNotifyWebhook(url, body string, verify bool) error {
+	resp, _, err := httpclient.Post(url, body, verify)
+	if err != nil {
+		return err
+	}
+	if resp != nil && (resp.StatusCode < 200 || resp.StatusCode >= 300) {
+		return errors.New("webhook " + url + " responses status " + resp.Status)
+	}
+	belogs.Info("postNotifyWebhook(): ok, url:", url)
+	return nil
+}
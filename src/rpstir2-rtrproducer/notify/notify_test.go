@@ -0,0 +1,30 @@
+package notify
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestFilterWatchedChanges(t *testing.T) {
+	notifyVrps := []NotifyVrp{
+		{Style: "withdraw", Asn: 64496, Prefix: "198.51.100.0/24", MaxLength: 24},
+		{Style: "announce", Asn: 64497, Prefix: "203.0.113.0/25", MaxLength: 25},
+		{Style: "announce", Asn: 64498, Prefix: "2001:db8::/32", MaxLength: 48},
+	}
+	notifyAspas := []NotifyAspa{
+		{Style: "announce", CustomerAsn: 64500, ProviderAsn: 64497},
+		{Style: "withdraw", CustomerAsn: 64501, ProviderAsn: 64502},
+	}
+	watchPrefixes := []netip.Prefix{netip.MustParsePrefix("203.0.113.0/24")}
+	watchAsns := map[uint64]struct{}{64496: {}, 64497: {}}
+
+	watchedVrps, watchedAspas := filterWatchedChanges(notifyVrps, notifyAspas, watchPrefixes, watchAsns)
+	if len(watchedVrps) != 2 || len(watchedAspas) != 1 {
+		t.Fatal("should have 2 watched vrps and 1 watched aspa:", watchedVrps, watchedAspas)
+	}
+
+	topChangedAsns := getTopChangedAsns(notifyVrps, notifyAspas, 2)
+	if len(topChangedAsns) != 2 || topChangedAsns[0].Asn != 64496 {
+		t.Fatal("top changed asns is wrong:", topChangedAsns)
+	}
+}
@@ -0,0 +1,44 @@
+package notify
+
+import (
+	"time"
+
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/xormdb"
+)
+
+// announced/withdrawn vrps of serialNumber. file path is from sync log file by syncLogFileId of sourceFrom,
+// so ta of withdrawn vrp is still known after its roa is removed
+func getNotifyVrpsDb(serialNumber uint64) (notifyVrps []NotifyVrp, err error) {
+	start := time.Now()
+	notifyVrps = make([]NotifyVrp, 0)
+	sql := `select i.style as style, i.asn as asn, i.address as address, i.prefixLength as prefixLength, i.maxLength as maxLength,
+			i.sourceFrom->>'$.source' as source, ifnull(l.filePath, '') as filePath
+		from lab_rpki_rtr_incremental i left join lab_rpki_sync_log_file l
+			on i.sourceFrom->>'$.source' = 'sync' and l.id = i.sourceFrom->>'$.syncLogFileId'
+		where i.serialNumber = ? order by i.id `
+	err = xormdb.XormEngine.SQL(sql, serialNumber).Find(&notifyVrps)
+	if err != nil {
+		belogs.Error("getNotifyVrpsDb(): select lab_rpki_rtr_incremental fail, serialNumber:", serialNumber, err)
+		return nil, err
+	}
+	belogs.Info("getNotifyVrpsDb(): serialNumber:", serialNumber, "  len(notifyVrps):", len(notifyVrps), "  time(s):", time.Since(start))
+	return notifyVrps, nil
+}
+
+// announced/withdrawn aspas of serialNumber, file path is from sync log file as vrps
+func getNotifyAspasDb(serialNumber uint64) (notifyAspas []NotifyAspa, err error) {
+	notifyAspas = make([]NotifyAspa, 0)
+	sql := `select i.style as style, i.customerAsn as customerAsn, i.providerAsn as providerAsn, i.addressFamily as addressFamily,
+			i.sourceFrom->>'$.source' as source, ifnull(l.filePath, '') as filePath
+		from lab_rpki_rtr_asa_incremental i left join lab_rpki_sync_log_file l
+			on i.sourceFrom->>'$.source' = 'sync' and l.id = i.sourceFrom->>'$.syncLogFileId'
+		where i.serialNumber = ? order by i.id `
+	err = xormdb.XormEngine.SQL(sql, serialNumber).Find(&notifyAspas)
+	if err != nil {
+		belogs.Error("getNotifyAspasDb(): select lab_rpki_rtr_asa_incremental fail, serialNumber:", serialNumber, err)
+		return nil, err
+	}
+	belogs.Debug("getNotifyAspasDb(): serialNumber:", serialNumber, "  len(notifyAspas):", len(notifyAspas))
+	return notifyAspas, nil
+}
@@ -0,0 +1,79 @@
+package notify
+
+import (
+	"time"
+)
+
+// summary of changed vrps/aspas of one serial, which is posted to webhooks and written to spool
+type NotifySummary struct {
+	// sync/slurm
+	Reason          string    `json:"reason"`
+	SerialNumber    uint64    `json:"serialNumber"`
+	CurSerialNumber uint64    `json:"curSerialNumber"`
+	NotifyTime      time.Time `json:"notifyTime"`
+
+	AnnounceVrpCount  uint64 `json:"announceVrpCount"`
+	WithdrawVrpCount  uint64 `json:"withdrawVrpCount"`
+	AnnounceAspaCount uint64 `json:"announceAspaCount"`
+	WithdrawAspaCount uint64 `json:"withdrawAspaCount"`
+
+	// tal(rir) --> counts. tal is "slurm" when from slurm, "unknown" when the sync log file is not found
+	TalCounts      map[string]*NotifyCount `json:"talCounts"`
+	TopChangedAsns []NotifyAsnCount        `json:"topChangedAsns"`
+
+	// only when notify::watchPrefixes or notify::watchAsns is set
+	WatchedVrps  []NotifyVrp  `json:"watchedVrps,omitempty"`
+	WatchedAspas []NotifyAspa `json:"watchedAspas,omitempty"`
+
+	// only when notify::withDeltas is true
+	Vrps  []NotifyVrp  `json:"vrps,omitempty"`
+	Aspas []NotifyAspa `json:"aspas,omitempty"`
+}
+
+type NotifyCount struct {
+	AnnounceVrpCount  uint64 `json:"announceVrpCount"`
+	WithdrawVrpCount  uint64 `json:"withdrawVrpCount"`
+	AnnounceAspaCount uint64 `json:"announceAspaCount"`
+	WithdrawAspaCount uint64 `json:"withdrawAspaCount"`
+}
+
+// asn of vrp, or customerAsn of aspa
+type NotifyAsnCount struct {
+	Asn           uint64 `json:"asn"`
+	AnnounceCount uint64 `json:"announceCount"`
+	WithdrawCount uint64 `json:"withdrawCount"`
+}
+
+// one row in lab_rpki_rtr_incremental, address may be trimmed
+type NotifyVrp struct {
+	// announce/withdraw
+	Style        string `json:"style" xorm:"style varchar(16)"`
+	Asn          int64  `json:"asn" xorm:"asn bigint"`
+	Address      string `json:"-" xorm:"address varchar(512)"`
+	PrefixLength uint64 `json:"-" xorm:"prefixLength int"`
+	Prefix       string `json:"prefix" xorm:"-"`
+	MaxLength    uint64 `json:"maxLength" xorm:"maxLength int"`
+	Source       string `json:"-" xorm:"source varchar(16)"`
+	FilePath     string `json:"-" xorm:"filePath varchar(512)"`
+	Ta           string `json:"ta" xorm:"-"`
+}
+
+// one row in lab_rpki_rtr_asa_incremental
+type NotifyAspa struct {
+	// announce/withdraw
+	Style         string `json:"style" xorm:"style varchar(16)"`
+	CustomerAsn   uint64 `json:"customerAsn" xorm:"customerAsn int"`
+	ProviderAsn   uint64 `json:"providerAsn" xorm:"providerAsn int"`
+	AddressFamily uint64 `json:"addressFamily" xorm:"addressFamily int"`
+	Source        string `json:"-" xorm:"source varchar(16)"`
+	FilePath      string `json:"-" xorm:"filePath varchar(512)"`
+	Ta            string `json:"ta" xorm:"-"`
+}
+
+// alarm is posted to webhooks and written to spool, such as "brake"
+type NotifyAlarmModel struct {
+	Alarm        string      `json:"alarm"`
+	SerialNumber uint64      `json:"serialNumber"`
+	NotifyTime   time.Time   `json:"notifyTime"`
+	Detail       interface{} `json:"detail"`
+}
@@ -0,0 +1,339 @@
+package preview
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/conf"
+	"github.com/cpusoft/goutil/convert"
+	"github.com/cpusoft/goutil/jsonutil"
+	model "rpstir2-model"
+	"rpstir2-rov/validate"
+	rtrnotify "rpstir2-rtrproducer/notify"
+)
+
+// at most 10000 flipped routes are in result, flipCount and toInvalidCount still count all of them
+const maxFlippedRoutes = 10000
+
+var curPreviewGate *PreviewGate
+var curPreviewGateMutex sync.RWMutex
+
+// when both rtr::previewEnable and rtr::brakeEnable are false, return nil, and all methods of nil gate will do nothing
+func NewPreviewGate(curSerialNumber, newSerialNumber uint64) *PreviewGate {
+	if !conf.Bool("rtr::previewEnable") && !conf.Bool("rtr::brakeEnable") {
+		return nil
+	}
+	g := &PreviewGate{
+		previewResult: PreviewResult{
+			State:           PREVIEW_STATE_HOLDING,
+			CurSerialNumber: curSerialNumber,
+			NewSerialNumber: newSerialNumber,
+			FlipCount:       make(map[string]uint64),
+			FlippedRoutes:   make([]FlippedRoute, 0),
+		},
+		decided: make(chan struct{}),
+		asaSet:  make(chan struct{}),
+	}
+	curPreviewGateMutex.Lock()
+	curPreviewGate = g
+	curPreviewGateMutex.Unlock()
+	belogs.Info("NewPreviewGate(): curSerialNumber:", curSerialNumber, "  newSerialNumber:", newSerialNumber)
+	return g
+}
+
+// evaluate announced/withdrawn vrps by reference rib and safety brake, then auto publish or hold to wait for approval
+func (g *PreviewGate) PreviewAndWait(rtrIncrementals []model.LabRpkiRtrIncremental) (err error) {
+	if g == nil {
+		return nil
+	}
+	start := time.Now()
+	if conf.Bool("rtr::previewEnable") {
+		err = g.preview(rtrIncrementals)
+		if err != nil {
+			belogs.Error("PreviewAndWait(): preview fail:", err)
+			g.Abort(err)
+			return err
+		}
+	}
+	if conf.Bool("rtr::brakeEnable") {
+		err = g.brake(rtrIncrementals)
+		if err != nil {
+			belogs.Error("PreviewAndWait(): brake fail:", err)
+			g.Abort(err)
+			return err
+		}
+	}
+
+	g.mutex.Lock()
+	threshold := conf.Int("rtr::previewAutoPublishThreshold")
+	if !conf.Bool("rtr::previewEnable") {
+		threshold = 0
+	}
+	g.previewResult.AutoPublishThreshold = int64(threshold)
+	toInvalidCount := g.previewResult.ToInvalidCount
+	brakeResult := g.previewResult.Brake
+	g.mutex.Unlock()
+	belogs.Info("PreviewAndWait(): newSerialNumber:", g.previewResult.NewSerialNumber, "  toInvalidCount:", toInvalidCount,
+		"  autoPublishThreshold:", threshold, "  time(s):", time.Since(start))
+
+	if brakeResult != nil && brakeResult.Triggered {
+		belogs.Error("PreviewAndWait(): safety brake is triggered, hold newSerialNumber:", g.previewResult.NewSerialNumber,
+			"  reasons:", jsonutil.MarshalJson(brakeResult.Reasons),
+			", wait for /rtrproducer/brake/release or /rtrproducer/brake/discard")
+		go rtrnotify.NotifyAlarm("brake", g.previewResult.NewSerialNumber, brakeResult)
+	} else if threshold >= 0 && toInvalidCount <= uint64(threshold) {
+		g.decide(PREVIEW_STATE_AUTO_PUBLISHED, "toInvalidCount is not more than autoPublishThreshold", nil)
+	} else {
+		belogs.Info("PreviewAndWait(): hold newSerialNumber:", g.previewResult.NewSerialNumber,
+			", wait for /rtrproducer/preview/approve or /rtrproducer/preview/reject")
+	}
+	// holding serial is discarded when it is not decided in time, so previous serial is still served
+	if holdMinutes := conf.Int("rtr::previewHoldMinutes"); holdMinutes > 0 {
+		timer := time.AfterFunc(time.Duration(holdMinutes)*time.Minute, func() {
+			g.expire(time.Duration(holdMinutes) * time.Minute)
+		})
+		defer timer.Stop()
+	}
+	return g.Wait()
+}
+
+func (g *PreviewGate) expire(holdTime time.Duration) {
+	note := "not decided in " + holdTime.String()
+	if g.decide(PREVIEW_STATE_EXPIRED, note, errors.New("new serialNumber "+convert.ToString(g.getNewSerialNumber())+" is "+note)) {
+		belogs.Error("expire(): holding serial is expired and discarded, newSerialNumber:", g.getNewSerialNumber())
+	}
+}
+
+func (g *PreviewGate) getNewSerialNumber() uint64 {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.previewResult.NewSerialNumber
+}
+
+// block until approved/rejected/aborted
+func (g *PreviewGate) Wait() error {
+	if g == nil {
+		return nil
+	}
+	<-g.decided
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.err
+}
+
+// asa should set its incrementals before waiting, even they are empty, so brake can check withdrawn aspas
+func (g *PreviewGate) SetAsaIncrementals(rtrAsaIncrementals []model.LabRpkiRtrAsaIncremental) {
+	if g == nil {
+		return
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.isAsaSet {
+		return
+	}
+	g.isAsaSet = true
+	g.asaIncrementals = rtrAsaIncrementals
+	close(g.asaSet)
+}
+
+// block until asa incrementals are set, or gate is aborted because asa fails
+func (g *PreviewGate) waitAsaIncrementals() (rtrAsaIncrementals []model.LabRpkiRtrAsaIncremental, err error) {
+	select {
+	case <-g.asaSet:
+	case <-g.decided:
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.err != nil {
+		return nil, g.err
+	}
+	return g.asaIncrementals, nil
+}
+
+// when fail before preview, let others which are waiting return
+func (g *PreviewGate) Abort(err error) {
+	if g == nil {
+		return
+	}
+	g.decide(PREVIEW_STATE_ABORTED, err.Error(), err)
+}
+
+// rejected, discarded or aborted, so new serial will not be published
+func (g *PreviewGate) IsDiscarded() bool {
+	if g == nil {
+		return false
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.previewResult.State == PREVIEW_STATE_REJECTED || g.previewResult.State == PREVIEW_STATE_ABORTED ||
+		g.previewResult.State == PREVIEW_STATE_DISCARDED || g.previewResult.State == PREVIEW_STATE_EXPIRED
+}
+
+func (g *PreviewGate) decide(state, note string, err error) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.isDecided {
+		return false
+	}
+	g.isDecided = true
+	g.err = err
+	g.previewResult.State = state
+	g.previewResult.DecideTime = time.Now()
+	g.previewResult.DecideNote = note
+	close(g.decided)
+	belogs.Info("decide(): newSerialNumber:", g.previewResult.NewSerialNumber, "  state:", state, "  note:", note)
+	return true
+}
+
+func (g *PreviewGate) preview(rtrIncrementals []model.LabRpkiRtrIncremental) (err error) {
+	start := time.Now()
+	// lab_rpki_rtr_full is still cur serialNumber
+	oldVrpSet, err := validate.GetVrpSetDb()
+	if err != nil {
+		belogs.Error("preview(): GetVrpSetDb fail:", err)
+		return err
+	}
+	newVrpSet := oldVrpSet.Clone()
+	announcedVrpSet := validate.NewVrpSet()
+	withdrawnVrpSet := validate.NewVrpSet()
+	for i := range rtrIncrementals {
+		prefix, err := validate.ConvertRtrAddressToPrefix(rtrIncrementals[i].Address, rtrIncrementals[i].PrefixLength)
+		if err != nil {
+			belogs.Error("preview(): ConvertRtrAddressToPrefix fail:", jsonutil.MarshalJson(rtrIncrementals[i]), err)
+			return err
+		}
+		vrp := validate.Vrp{Asn: uint32(rtrIncrementals[i].Asn), Prefix: prefix, MaxLength: int(rtrIncrementals[i].MaxLength)}
+		if rtrIncrementals[i].Style == "announce" {
+			newVrpSet.AddVrp(vrp)
+			announcedVrpSet.AddVrp(vrp)
+		} else {
+			newVrpSet.RemoveVrp(vrp)
+			withdrawnVrpSet.AddVrp(vrp)
+		}
+	}
+
+	referenceFile, referenceRoutes, err := getReferenceRoutes()
+	if err != nil {
+		belogs.Error("preview(): getReferenceRoutes fail:", err)
+		return err
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.previewResult.AnnounceCount = announcedVrpSet.Count
+	g.previewResult.WithdrawCount = withdrawnVrpSet.Count
+	g.previewResult.ReferenceFile = referenceFile
+	g.previewResult.ReferenceRouteCount = uint64(len(referenceRoutes))
+	g.previewResult.PreviewTime = time.Now()
+	for i := range referenceRoutes {
+		announcedVrps := announcedVrpSet.Covering(referenceRoutes[i].prefix)
+		withdrawnVrps := withdrawnVrpSet.Covering(referenceRoutes[i].prefix)
+		if len(announcedVrps) == 0 && len(withdrawnVrps) == 0 {
+			continue
+		}
+		oldRovResult := oldVrpSet.ValidateOrigin(referenceRoutes[i].prefix, referenceRoutes[i].originAsn, referenceRoutes[i].hasOrigin)
+		newRovResult := newVrpSet.ValidateOrigin(referenceRoutes[i].prefix, referenceRoutes[i].originAsn, referenceRoutes[i].hasOrigin)
+		if oldRovResult.State == newRovResult.State {
+			continue
+		}
+		g.previewResult.FlipCount[oldRovResult.State+"->"+newRovResult.State]++
+		if newRovResult.State == validate.ROV_STATE_INVALID {
+			g.previewResult.ToInvalidCount++
+		}
+		if len(g.previewResult.FlippedRoutes) < maxFlippedRoutes {
+			g.previewResult.FlippedRoutes = append(g.previewResult.FlippedRoutes, FlippedRoute{
+				Prefix:        referenceRoutes[i].prefix.String(),
+				OriginAsn:     referenceRoutes[i].originAsn,
+				OldState:      oldRovResult.State,
+				NewState:      newRovResult.State,
+				NewReason:     newRovResult.Reason,
+				AnnouncedVrps: announcedVrps,
+				WithdrawnVrps: withdrawnVrps,
+			})
+		}
+	}
+	belogs.Info("preview(): newSerialNumber:", g.previewResult.NewSerialNumber, "  announceCount:", g.previewResult.AnnounceCount,
+		"  withdrawCount:", g.previewResult.WithdrawCount, "  referenceRouteCount:", g.previewResult.ReferenceRouteCount,
+		"  flipCount:", jsonutil.MarshalJson(g.previewResult.FlipCount), "  time(s):", time.Since(start))
+	return nil
+}
+
+// current or last preview
+func GetPreview() (previewResult PreviewResult, err error) {
+	curPreviewGateMutex.RLock()
+	g := curPreviewGate
+	curPreviewGateMutex.RUnlock()
+	if g == nil {
+		return previewResult, errors.New("there is no preview, check rtr::previewEnable and rtr::brakeEnable")
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.previewResult, nil
+}
+
+// approve to publish holding serial
+func ApprovePreview(previewDecideRequest PreviewDecideRequest) (err error) {
+	return decidePreview(previewDecideRequest, PREVIEW_STATE_APPROVED, nil)
+}
+
+// reject, the new serial will not be published, and previous serial will be kept
+func RejectPreview(previewDecideRequest PreviewDecideRequest) (err error) {
+	return decidePreview(previewDecideRequest, PREVIEW_STATE_REJECTED,
+		errors.New("new serialNumber "+convert.ToString(previewDecideRequest.NewSerialNumber)+" is rejected"))
+}
+
+// release safety brake to publish holding serial
+func ReleaseBrake(previewDecideRequest PreviewDecideRequest) (err error) {
+	if err = checkBrakeTriggered(); err != nil {
+		return err
+	}
+	return decidePreview(previewDecideRequest, PREVIEW_STATE_RELEASED, nil)
+}
+
+// discard holding serial when safety brake is triggered, previous serial will be kept
+func DiscardBrake(previewDecideRequest PreviewDecideRequest) (err error) {
+	if err = checkBrakeTriggered(); err != nil {
+		return err
+	}
+	return decidePreview(previewDecideRequest, PREVIEW_STATE_DISCARDED,
+		errors.New("new serialNumber "+convert.ToString(previewDecideRequest.NewSerialNumber)+" is discarded"))
+}
+
+func checkBrakeTriggered() error {
+	curPreviewGateMutex.RLock()
+	g := curPreviewGate
+	curPreviewGateMutex.RUnlock()
+	if g == nil {
+		return errors.New("there is no safety brake, check rtr::brakeEnable")
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.previewResult.Brake == nil || !g.previewResult.Brake.Triggered {
+		return errors.New("safety brake of newSerialNumber " + convert.ToString(g.previewResult.NewSerialNumber) + " is not triggered")
+	}
+	return nil
+}
+
+func decidePreview(previewDecideRequest PreviewDecideRequest, state string, decideErr error) (err error) {
+	curPreviewGateMutex.RLock()
+	g := curPreviewGate
+	curPreviewGateMutex.RUnlock()
+	if g == nil {
+		return errors.New("there is no preview to decide")
+	}
+	g.mutex.Lock()
+	newSerialNumber := g.previewResult.NewSerialNumber
+	g.mutex.Unlock()
+	// avoid to decide a later serial by mistake
+	if previewDecideRequest.NewSerialNumber != newSerialNumber {
+		belogs.Error("decidePreview(): newSerialNumber is not holding:", previewDecideRequest.NewSerialNumber, "  holding:", newSerialNumber)
+		return errors.New("newSerialNumber " + convert.ToString(previewDecideRequest.NewSerialNumber) + " is not holding")
+	}
+	if !g.decide(state, previewDecideRequest.Note, decideErr) {
+		belogs.Error("decidePreview(): newSerialNumber has been decided:", newSerialNumber)
+		return errors.New("newSerialNumber " + convert.ToString(newSerialNumber) + " has been decided")
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package preview
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPreviewGateDecide(t *testing.T) {
+	g := &PreviewGate{previewResult: PreviewResult{State: PREVIEW_STATE_HOLDING, NewSerialNumber: 2},
+		decided: make(chan struct{})}
+	g.expire(time.Minute)
+	if err := g.Wait(); err == nil || !g.IsDiscarded() || g.previewResult.State != PREVIEW_STATE_EXPIRED {
+		t.Fatal("expired serial should be discarded:", g.previewResult.State, err)
+	}
+	// only the first decision is kept
+	g.Abort(errors.New("asa fail"))
+	if g.previewResult.State != PREVIEW_STATE_EXPIRED {
+		t.Fatal("state should not be changed after decided:", g.previewResult.State)
+	}
+
+	g = &PreviewGate{previewResult: PreviewResult{State: PREVIEW_STATE_HOLDING, NewSerialNumber: 3},
+		decided: make(chan struct{})}
+	g.Abort(errors.New("router key fail"))
+	if err := g.Wait(); err == nil || !g.IsDiscarded() {
+		t.Fatal("aborted serial should be discarded:", err)
+	}
+}
@@ -0,0 +1,189 @@
+package preview
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/conf"
+	"github.com/cpusoft/goutil/jsonutil"
+	model "rpstir2-model"
+)
+
+// thresholds of safety brake, 0 means not checked
+type brakeThreshold struct {
+	maxWithdrawCount       uint64
+	maxWithdrawPercent     uint64
+	maxTalWithdrawCount    uint64
+	maxTalWithdrawPercent  uint64
+	maxRepoWithdrawCount   uint64
+	maxRepoWithdrawPercent uint64
+	maxAspaWithdrawCount   uint64
+	maxAspaWithdrawPercent uint64
+	// percent thresholds are only checked when curVrpCount of tal/repository is not less than it
+	minPercentVrpCount uint64
+}
+
+func getBrakeThreshold() brakeThreshold {
+	getUint := func(key string) uint64 {
+		v := conf.Int(key)
+		if v < 0 {
+			return 0
+		}
+		return uint64(v)
+	}
+	return brakeThreshold{
+		maxWithdrawCount:       getUint("rtr::brakeMaxWithdrawCount"),
+		maxWithdrawPercent:     getUint("rtr::brakeMaxWithdrawPercent"),
+		maxTalWithdrawCount:    getUint("rtr::brakeMaxTalWithdrawCount"),
+		maxTalWithdrawPercent:  getUint("rtr::brakeMaxTalWithdrawPercent"),
+		maxRepoWithdrawCount:   getUint("rtr::brakeMaxRepoWithdrawCount"),
+		maxRepoWithdrawPercent: getUint("rtr::brakeMaxRepoWithdrawPercent"),
+		maxAspaWithdrawCount:   getUint("rtr::brakeMaxAspaWithdrawCount"),
+		maxAspaWithdrawPercent: getUint("rtr::brakeMaxAspaWithdrawPercent"),
+		minPercentVrpCount:     getUint("rtr::brakeMinPercentVrpCount"),
+	}
+}
+
+// count withdrawn vrps of new serial by tal/repository and withdrawn aspas, and check thresholds
+func (g *PreviewGate) brake(rtrIncrementals []model.LabRpkiRtrIncremental) (err error) {
+	start := time.Now()
+	g.mutex.Lock()
+	curSerialNumber := g.previewResult.CurSerialNumber
+	g.mutex.Unlock()
+
+	brakeFileCounts, err := getBrakeFileCountsDb(curSerialNumber)
+	if err != nil {
+		belogs.Error("brake(): getBrakeFileCountsDb fail:", curSerialNumber, err)
+		return err
+	}
+	curAspaCount, err := getBrakeCurAspaCountDb(curSerialNumber)
+	if err != nil {
+		belogs.Error("brake(): getBrakeCurAspaCountDb fail:", curSerialNumber, err)
+		return err
+	}
+	rtrAsaIncrementals, err := g.waitAsaIncrementals()
+	if err != nil {
+		belogs.Error("brake(): waitAsaIncrementals fail:", curSerialNumber, err)
+		return err
+	}
+	brakeResult := countBrake(brakeFileCounts, rtrIncrementals)
+	brakeResult.CurAspaCount = curAspaCount
+	for i := range rtrAsaIncrementals {
+		if rtrAsaIncrementals[i].Style == "withdraw" {
+			brakeResult.WithdrawAspaCount++
+		}
+	}
+	checkBrake(brakeResult, getBrakeThreshold())
+
+	g.mutex.Lock()
+	g.previewResult.Brake = brakeResult
+	g.mutex.Unlock()
+	belogs.Info("brake(): curSerialNumber:", curSerialNumber, "  curVrpCount:", brakeResult.CurVrpCount,
+		"  withdrawVrpCount:", brakeResult.WithdrawVrpCount, "  curAspaCount:", brakeResult.CurAspaCount,
+		"  withdrawAspaCount:", brakeResult.WithdrawAspaCount, "  triggered:", brakeResult.Triggered,
+		"  reasons:", jsonutil.MarshalJson(brakeResult.Reasons), "  time(s):", time.Since(start))
+	return nil
+}
+
+// tal and repository of vrps are judged by file path of roa
+func countBrake(brakeFileCounts []brakeFileCount, rtrIncrementals []model.LabRpkiRtrIncremental) *BrakeResult {
+	brakeResult := &BrakeResult{
+		Reasons:    make([]string, 0),
+		TalCounts:  make(map[string]*BrakeCount),
+		RepoCounts: make(map[string]*BrakeCount),
+	}
+	getBrakeCount := func(counts map[string]*BrakeCount, key string) *BrakeCount {
+		brakeCount, ok := counts[key]
+		if !ok {
+			brakeCount = &BrakeCount{}
+			counts[key] = brakeCount
+		}
+		return brakeCount
+	}
+
+	// syncLogFileId --> origin
+	fileOrigins := make(map[uint64]model.OriginModel, len(brakeFileCounts))
+	for i := range brakeFileCounts {
+		origin := getBrakeOrigin(brakeFileCounts[i].Source, brakeFileCounts[i].FilePath)
+		if brakeFileCounts[i].Source == "sync" {
+			fileOrigins[brakeFileCounts[i].SyncLogFileId] = origin
+		}
+		brakeResult.CurVrpCount += brakeFileCounts[i].Count
+		getBrakeCount(brakeResult.TalCounts, origin.Rir).CurVrpCount += brakeFileCounts[i].Count
+		getBrakeCount(brakeResult.RepoCounts, origin.Repo).CurVrpCount += brakeFileCounts[i].Count
+	}
+
+	for i := range rtrIncrementals {
+		if rtrIncrementals[i].Style != "withdraw" {
+			continue
+		}
+		sourceFrom := model.LabRpkiRtrSourceFrom{}
+		jsonutil.UnmarshalJson(rtrIncrementals[i].SourceFrom, &sourceFrom)
+		origin, ok := fileOrigins[sourceFrom.SyncLogFileId]
+		if sourceFrom.Source != "sync" || !ok {
+			origin = getBrakeOrigin(sourceFrom.Source, "")
+		}
+		brakeResult.WithdrawVrpCount++
+		getBrakeCount(brakeResult.TalCounts, origin.Rir).WithdrawVrpCount++
+		getBrakeCount(brakeResult.RepoCounts, origin.Repo).WithdrawVrpCount++
+	}
+	return brakeResult
+}
+
+func getBrakeOrigin(source, filePath string) model.OriginModel {
+	if source != "sync" {
+		return model.OriginModel{Rir: source, Repo: source}
+	}
+	if len(filePath) == 0 {
+		return model.OriginModel{Rir: "unknown", Repo: "unknown"}
+	}
+	origin := model.JudgeOriginByFilePath(filePath)
+	if len(origin.Rir) == 0 {
+		origin.Rir = "unknown"
+	}
+	if len(origin.Repo) == 0 {
+		origin.Repo = "unknown"
+	}
+	return *origin
+}
+
+func checkBrake(brakeResult *BrakeResult, threshold brakeThreshold) {
+	check := func(name, kind string, brakeCount BrakeCount, maxCount, maxPercent uint64, checkMinCount bool) {
+		if maxCount > 0 && brakeCount.WithdrawVrpCount > maxCount {
+			brakeResult.Reasons = append(brakeResult.Reasons, name+" withdraws "+strconv.FormatUint(brakeCount.WithdrawVrpCount, 10)+
+				" "+kind+", more than "+strconv.FormatUint(maxCount, 10))
+		}
+		if maxPercent == 0 || brakeCount.CurVrpCount == 0 ||
+			(checkMinCount && brakeCount.CurVrpCount < threshold.minPercentVrpCount) {
+			return
+		}
+		if brakeCount.WithdrawVrpCount*100 > maxPercent*brakeCount.CurVrpCount {
+			brakeResult.Reasons = append(brakeResult.Reasons, name+" withdraws "+strconv.FormatUint(brakeCount.WithdrawVrpCount, 10)+
+				" of "+strconv.FormatUint(brakeCount.CurVrpCount, 10)+" "+kind+", more than "+strconv.FormatUint(maxPercent, 10)+"%")
+		}
+	}
+
+	check("all", "vrps", BrakeCount{CurVrpCount: brakeResult.CurVrpCount, WithdrawVrpCount: brakeResult.WithdrawVrpCount},
+		threshold.maxWithdrawCount, threshold.maxWithdrawPercent, false)
+	for _, tal := range sortedBrakeKeys(brakeResult.TalCounts) {
+		check("tal "+tal, "vrps", *brakeResult.TalCounts[tal], threshold.maxTalWithdrawCount, threshold.maxTalWithdrawPercent, true)
+	}
+	for _, repo := range sortedBrakeKeys(brakeResult.RepoCounts) {
+		check("repository "+repo, "vrps", *brakeResult.RepoCounts[repo], threshold.maxRepoWithdrawCount, threshold.maxRepoWithdrawPercent, true)
+	}
+	// aspa counts are in vrp fields of BrakeCount
+	check("all", "aspas", BrakeCount{CurVrpCount: brakeResult.CurAspaCount, WithdrawVrpCount: brakeResult.WithdrawAspaCount},
+		threshold.maxAspaWithdrawCount, threshold.maxAspaWithdrawPercent, false)
+	brakeResult.Triggered = len(brakeResult.Reasons) > 0
+}
+
+func sortedBrakeKeys(counts map[string]*BrakeCount) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
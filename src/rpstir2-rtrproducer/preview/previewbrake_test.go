@@ -0,0 +1,49 @@
+package preview
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCheckBrake(t *testing.T) {
+	brakeResult := &BrakeResult{
+		Reasons:          make([]string, 0),
+		CurVrpCount:      10000,
+		WithdrawVrpCount: 600,
+		TalCounts: map[string]*BrakeCount{
+			"RIPE NCC": {CurVrpCount: 5000, WithdrawVrpCount: 550},
+			"APNIC":    {CurVrpCount: 5000, WithdrawVrpCount: 50},
+		},
+		RepoCounts: map[string]*BrakeCount{
+			"rpki.ripe.net":  {CurVrpCount: 5000, WithdrawVrpCount: 550},
+			"rpki.apnic.net": {CurVrpCount: 4990, WithdrawVrpCount: 40},
+			// more than 100% is withdrawn, but too small to check percent
+			"ca.rg.net": {CurVrpCount: 10, WithdrawVrpCount: 10},
+		},
+		CurAspaCount:      100,
+		WithdrawAspaCount: 30,
+	}
+	threshold := brakeThreshold{maxWithdrawCount: 1000, maxTalWithdrawPercent: 10, maxRepoWithdrawPercent: 50,
+		minPercentVrpCount: 100, maxAspaWithdrawPercent: 50}
+	checkBrake(brakeResult, threshold)
+	fmt.Println(brakeResult.Reasons)
+	if !brakeResult.Triggered || len(brakeResult.Reasons) != 1 {
+		t.Fatal("only tal RIPE NCC should trigger brake:", brakeResult.Reasons)
+	}
+
+	// ca.rg.net triggers when it is not less than minPercentVrpCount
+	brakeResult.Reasons = make([]string, 0)
+	threshold.minPercentVrpCount = 10
+	checkBrake(brakeResult, threshold)
+	if len(brakeResult.Reasons) != 2 {
+		t.Fatal("tal RIPE NCC and repository ca.rg.net should trigger brake:", brakeResult.Reasons)
+	}
+
+	// withdrawn aspas
+	brakeResult.Reasons = make([]string, 0)
+	threshold = brakeThreshold{maxAspaWithdrawPercent: 20}
+	checkBrake(brakeResult, threshold)
+	if !brakeResult.Triggered || len(brakeResult.Reasons) != 1 {
+		t.Fatal("only aspas should trigger brake:", brakeResult.Reasons)
+	}
+}
@@ -0,0 +1,38 @@
+package preview
+
+import (
+	"time"
+
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/xormdb"
+)
+
+// count of vrps in lab_rpki_rtr_full_log of serialNumber, group by roa file
+func getBrakeFileCountsDb(serialNumber uint64) (brakeFileCounts []brakeFileCount, err error) {
+	start := time.Now()
+	brakeFileCounts = make([]brakeFileCount, 0)
+	sql := `select t.source as source, t.syncLogFileId as syncLogFileId, ifnull(l.filePath, '') as filePath, t.count as count
+		from (select f.sourceFrom->>'$.source' as source, ifnull(f.sourceFrom->>'$.syncLogFileId', 0) as syncLogFileId, count(*) as count
+			from lab_rpki_rtr_full_log f where f.serialNumber = ?
+			group by source, syncLogFileId) t
+		left join lab_rpki_sync_log_file l on t.source = 'sync' and l.id = t.syncLogFileId `
+	err = xormdb.XormEngine.SQL(sql, serialNumber).Find(&brakeFileCounts)
+	if err != nil {
+		belogs.Error("getBrakeFileCountsDb(): select lab_rpki_rtr_full_log fail, serialNumber:", serialNumber, err)
+		return nil, err
+	}
+	belogs.Info("getBrakeFileCountsDb(): serialNumber:", serialNumber, "  len(brakeFileCounts):", len(brakeFileCounts),
+		"  time(s):", time.Since(start))
+	return brakeFileCounts, nil
+}
+
+// count of aspas in lab_rpki_rtr_asa_full_log of serialNumber
+func getBrakeCurAspaCountDb(serialNumber uint64) (curAspaCount uint64, err error) {
+	_, err = xormdb.XormEngine.SQL("select count(*) from lab_rpki_rtr_asa_full_log where serialNumber = ?", serialNumber).Get(&curAspaCount)
+	if err != nil {
+		belogs.Error("getBrakeCurAspaCountDb(): select lab_rpki_rtr_asa_full_log fail, serialNumber:", serialNumber, err)
+		return 0, err
+	}
+	belogs.Debug("getBrakeCurAspaCountDb(): serialNumber:", serialNumber, "  curAspaCount:", curAspaCount)
+	return curAspaCount, nil
+}
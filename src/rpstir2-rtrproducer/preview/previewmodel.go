@@ -0,0 +1,121 @@
+package preview
+
+import (
+	"net/netip"
+	"sync"
+	"time"
+
+	model "rpstir2-model"
+	"rpstir2-rov/validate"
+)
+
+const (
+	PREVIEW_STATE_HOLDING        = "holding"
+	PREVIEW_STATE_APPROVED       = "approved"
+	PREVIEW_STATE_REJECTED       = "rejected"
+	PREVIEW_STATE_AUTO_PUBLISHED = "autoPublished"
+	PREVIEW_STATE_ABORTED        = "aborted"
+	// safety brake is released or discarded by operator
+	PREVIEW_STATE_RELEASED  = "released"
+	PREVIEW_STATE_DISCARDED = "discarded"
+	// not decided in rtr::previewHoldMinutes, it is discarded
+	PREVIEW_STATE_EXPIRED = "expired"
+)
+
+// one prefix/origin in reference rib
+type referenceRoute struct {
+	prefix    netip.Prefix
+	originAsn uint32
+	hasOrigin bool
+}
+
+type ReferenceRoute struct {
+	Prefix    netip.Prefix
+	OriginAsn uint32
+	HasOrigin bool
+}
+
+type FlippedRoute struct {
+	Prefix    string `json:"prefix"`
+	OriginAsn uint32 `json:"originAsn"`
+	OldState  string `json:"oldState"`
+	NewState  string `json:"newState"`
+	NewReason string `json:"newReason,omitempty"`
+	// announced or withdrawn vrps which cover this route
+	AnnouncedVrps []validate.Vrp `json:"announcedVrps,omitempty"`
+	WithdrawnVrps []validate.Vrp `json:"withdrawnVrps,omitempty"`
+}
+
+type PreviewResult struct {
+	State           string `json:"state"`
+	CurSerialNumber uint64 `json:"curSerialNumber"`
+	NewSerialNumber uint64 `json:"newSerialNumber"`
+	AnnounceCount   uint64 `json:"announceCount"`
+	WithdrawCount   uint64 `json:"withdrawCount"`
+
+	// mrt file or prefix file
+	ReferenceFile       string `json:"referenceFile"`
+	ReferenceRouteCount uint64 `json:"referenceRouteCount"`
+
+	// "valid->invalid": count
+	FlipCount            map[string]uint64 `json:"flipCount"`
+	ToInvalidCount       uint64            `json:"toInvalidCount"`
+	FlippedRoutes        []FlippedRoute    `json:"flippedRoutes"`
+	AutoPublishThreshold int64             `json:"autoPublishThreshold"`
+
+	// only when rtr::brakeEnable
+	Brake *BrakeResult `json:"brake,omitempty"`
+
+	PreviewTime time.Time `json:"previewTime"`
+	DecideTime  time.Time `json:"decideTime,omitempty"`
+	DecideNote  string    `json:"decideNote,omitempty"`
+}
+
+// gate of one new serial, roa and asa publish only after it is decided
+type PreviewGate struct {
+	mutex         sync.Mutex
+	previewResult PreviewResult
+	decided       chan struct{}
+	isDecided     bool
+	err           error
+
+	// asa incrementals are set by asa, and brake waits for them
+	asaSet          chan struct{}
+	isAsaSet        bool
+	asaIncrementals []model.LabRpkiRtrAsaIncremental
+}
+
+// safety brake by withdrawn vrps, globally and per tal/repository
+type BrakeResult struct {
+	Triggered bool     `json:"triggered"`
+	Reasons   []string `json:"reasons"`
+
+	CurVrpCount      uint64 `json:"curVrpCount"`
+	WithdrawVrpCount uint64 `json:"withdrawVrpCount"`
+	// rir --> count, rir is "slurm" when from slurm, "unknown" when the roa file has been cleared
+	TalCounts map[string]*BrakeCount `json:"talCounts"`
+	// repo --> count
+	RepoCounts map[string]*BrakeCount `json:"repoCounts"`
+
+	CurAspaCount      uint64 `json:"curAspaCount"`
+	WithdrawAspaCount uint64 `json:"withdrawAspaCount"`
+}
+
+type BrakeCount struct {
+	CurVrpCount      uint64 `json:"curVrpCount"`
+	WithdrawVrpCount uint64 `json:"withdrawVrpCount"`
+}
+
+// count of vrps of one roa file in current serial
+type brakeFileCount struct {
+	Source        string `xorm:"source varchar(16)"`
+	SyncLogFileId uint64 `xorm:"syncLogFileId int"`
+	FilePath      string `xorm:"filePath varchar(1024)"`
+	Count         uint64 `xorm:"count int"`
+}
+
+// body of /rtrproducer/preview/approve, /rtrproducer/preview/reject, /rtrproducer/brake/release and /rtrproducer/brake/discard
+type PreviewDecideRequest struct {
+	NewSerialNumber uint64 `json:"newSerialNumber"`
+	Note            string `json:"note"`
+}
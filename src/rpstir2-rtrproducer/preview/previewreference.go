@@ -0,0 +1,150 @@
+package preview
+
+import (
+	"bufio"
+	"errors"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/conf"
+	"rpstir2-rov/mrt"
+)
+
+// parsing full rib is slow, so cache by file and modify time
+var referenceCache struct {
+	mutex           sync.Mutex
+	file            string
+	modTime         time.Time
+	referenceRoutes []referenceRoute
+}
+
+// rtr::previewMrtFile is mrt TABLE_DUMP_V2 file,
+// rtr::previewPrefixFile is text file, one "prefix originAsn" in one line, such as "192.0.2.0/24 64496"
+func getReferenceRoutes() (referenceFile string, referenceRoutes []referenceRoute, err error) {
+	start := time.Now()
+	mrtFile := conf.String("rtr::previewMrtFile")
+	prefixFile := conf.String("rtr::previewPrefixFile")
+	if mrtFile == "" && prefixFile == "" {
+		belogs.Error("getReferenceRoutes(): rtr::previewMrtFile and rtr::previewPrefixFile are both empty")
+		return "", nil, errors.New("rtr::previewMrtFile and rtr::previewPrefixFile are both empty")
+	}
+	referenceFile = mrtFile
+	if referenceFile == "" {
+		referenceFile = prefixFile
+	}
+
+	fileInfo, err := os.Stat(referenceFile)
+	if err != nil {
+		belogs.Error("getReferenceRoutes(): Stat fail, referenceFile:", referenceFile, err)
+		return "", nil, err
+	}
+
+	referenceCache.mutex.Lock()
+	defer referenceCache.mutex.Unlock()
+	if referenceCache.file == referenceFile && referenceCache.modTime.Equal(fileInfo.ModTime()) {
+		belogs.Debug("getReferenceRoutes(): use cache, referenceFile:", referenceFile)
+		return referenceFile, referenceCache.referenceRoutes, nil
+	}
+
+	if mrtFile != "" {
+		referenceRoutes, err = getReferenceRoutesFromMrt(mrtFile)
+	} else {
+		referenceRoutes, err = getReferenceRoutesFromPrefixFile(prefixFile)
+	}
+	if err != nil {
+		belogs.Error("getReferenceRoutes(): get referenceRoutes fail, referenceFile:", referenceFile, err)
+		return "", nil, err
+	}
+	referenceCache.file = referenceFile
+	referenceCache.modTime = fileInfo.ModTime()
+	referenceCache.referenceRoutes = referenceRoutes
+	belogs.Info("getReferenceRoutes(): referenceFile:", referenceFile, "  len(referenceRoutes):", len(referenceRoutes),
+		"  time(s):", time.Since(start))
+	return referenceFile, referenceRoutes, nil
+}
+
+// for other packages, such as slurm lint. when no reference file is configured, referenceFile is empty
+func GetReferenceRoutes() (referenceFile string, referenceRoutes []ReferenceRoute, err error) {
+	if conf.String("rtr::previewMrtFile") == "" && conf.String("rtr::previewPrefixFile") == "" {
+		return "", make([]ReferenceRoute, 0), nil
+	}
+	referenceFile, routes, err := getReferenceRoutes()
+	if err != nil {
+		belogs.Error("GetReferenceRoutes(): getReferenceRoutes fail:", err)
+		return "", nil, err
+	}
+	referenceRoutes = make([]ReferenceRoute, 0, len(routes))
+	for i := range routes {
+		referenceRoutes = append(referenceRoutes, ReferenceRoute{Prefix: routes[i].prefix,
+			OriginAsn: routes[i].originAsn, HasOrigin: routes[i].hasOrigin})
+	}
+	return referenceFile, referenceRoutes, nil
+}
+
+// unique prefix/origin of all peers
+func getReferenceRoutesFromMrt(mrtFile string) (referenceRoutes []referenceRoute, err error) {
+	uniques := make(map[referenceRoute]struct{})
+	_, err = mrt.ParseMrtFile(mrtFile, func(ribRoute *mrt.RibRoute) error {
+		originAsn, hasOrigin := ribRoute.OriginAsn()
+		uniques[referenceRoute{prefix: ribRoute.Prefix, originAsn: originAsn, hasOrigin: hasOrigin}] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		belogs.Error("getReferenceRoutesFromMrt(): ParseMrtFile fail, mrtFile:", mrtFile, err)
+		return nil, err
+	}
+	referenceRoutes = make([]referenceRoute, 0, len(uniques))
+	for r := range uniques {
+		referenceRoutes = append(referenceRoutes, r)
+	}
+	return referenceRoutes, nil
+}
+
+func getReferenceRoutesFromPrefixFile(prefixFile string) (referenceRoutes []referenceRoute, err error) {
+	file, err := os.Open(prefixFile)
+	if err != nil {
+		belogs.Error("getReferenceRoutesFromPrefixFile(): Open fail, prefixFile:", prefixFile, err)
+		return nil, err
+	}
+	defer file.Close()
+
+	referenceRoutes = make([]referenceRoute, 0)
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// "192.0.2.0/24 64496" or "192.0.2.0/24,AS64496"
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ' ' || r == '\t' || r == ','
+		})
+		if len(fields) != 2 {
+			belogs.Error("getReferenceRoutesFromPrefixFile(): line should be 'prefix originAsn', prefixFile:", prefixFile, "  line:", lineNum, line)
+			return nil, errors.New("line " + strconv.Itoa(lineNum) + " should be 'prefix originAsn'")
+		}
+		prefix, err := netip.ParsePrefix(fields[0])
+		if err != nil {
+			belogs.Error("getReferenceRoutesFromPrefixFile(): ParsePrefix fail, prefixFile:", prefixFile, "  line:", lineNum, line, err)
+			return nil, errors.New("line " + strconv.Itoa(lineNum) + " has wrong prefix")
+		}
+		originAsn, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(fields[1]), "AS"), 10, 32)
+		if err != nil {
+			belogs.Error("getReferenceRoutesFromPrefixFile(): ParseUint fail, prefixFile:", prefixFile, "  line:", lineNum, line, err)
+			return nil, errors.New("line " + strconv.Itoa(lineNum) + " has wrong originAsn")
+		}
+		referenceRoutes = append(referenceRoutes, referenceRoute{prefix: prefix.Masked(), originAsn: uint32(originAsn), hasOrigin: true})
+	}
+	if err = scanner.Err(); err != nil {
+		belogs.Error("getReferenceRoutesFromPrefixFile(): Scan fail, prefixFile:", prefixFile, err)
+		return nil, err
+	}
+	return referenceRoutes, nil
+}
@@ -0,0 +1,283 @@
+package provenance
+
+import (
+	"errors"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/jsonutil"
+	model "rpstir2-model"
+	"rpstir2-rov/validate"
+)
+
+// avoid endless loop when cer chain is broken
+const provenanceMaxChainDepth = 32
+
+// every source of the vrp or aspa in the latest serialNumber: slurm, or roa/asa file with ee cert and cer chain up to tal
+func GetProvenance(provenanceRequest ProvenanceRequest) (provenanceResult ProvenanceResult, err error) {
+	start := time.Now()
+	if provenanceRequest.Prefix == "" && provenanceRequest.CustomerAsn == 0 {
+		return provenanceResult, errors.New("prefix and asn, or customerAsn should be set")
+	}
+	serialNumber, has, err := getProvenanceSerialNumberDb()
+	if err != nil {
+		belogs.Error("GetProvenance(): getProvenanceSerialNumberDb fail:", err)
+		return provenanceResult, err
+	}
+	if !has {
+		return provenanceResult, errors.New("there is no serialNumber in rtr")
+	}
+	provenanceResult.SerialNumber = serialNumber
+
+	// one cer chain is shared by many roas
+	chains := make(map[string][]ProvenanceObject)
+	if provenanceRequest.Prefix != "" {
+		provenanceResult.Vrps, err = getProvenanceVrps(serialNumber, provenanceRequest, chains)
+		if err != nil {
+			belogs.Error("GetProvenance(): getProvenanceVrps fail:", jsonutil.MarshalJson(provenanceRequest), err)
+			return provenanceResult, err
+		}
+	} else {
+		provenanceResult.Aspas, err = getProvenanceAspas(serialNumber, provenanceRequest.CustomerAsn, chains)
+		if err != nil {
+			belogs.Error("GetProvenance(): getProvenanceAspas fail:", jsonutil.MarshalJson(provenanceRequest), err)
+			return provenanceResult, err
+		}
+	}
+	belogs.Info("GetProvenance(): provenanceRequest:", jsonutil.MarshalJson(provenanceRequest), "  serialNumber:", serialNumber,
+		"  len(Vrps):", len(provenanceResult.Vrps), "  len(Aspas):", len(provenanceResult.Aspas), "  time(s):", time.Since(start))
+	return provenanceResult, nil
+}
+
+func getProvenanceVrps(serialNumber uint64, provenanceRequest ProvenanceRequest,
+	chains map[string][]ProvenanceObject) (provenanceVrps []ProvenanceVrp, err error) {
+	prefix, err := netip.ParsePrefix(provenanceRequest.Prefix)
+	if err != nil {
+		belogs.Error("getProvenanceVrps(): ParsePrefix fail:", provenanceRequest.Prefix, err)
+		return nil, errors.New("prefix " + provenanceRequest.Prefix + " is error")
+	}
+	prefix = prefix.Masked()
+	rows, err := getProvenanceVrpRowsDb(serialNumber, provenanceRequest.Asn, uint64(prefix.Bits()), provenanceRequest.MaxLength)
+	if err != nil {
+		belogs.Error("getProvenanceVrps(): getProvenanceVrpRowsDb fail:", jsonutil.MarshalJson(provenanceRequest), err)
+		return nil, err
+	}
+
+	// same vrp may be from more than one roa or slurm, keep order of rows
+	provenanceVrps = make([]ProvenanceVrp, 0)
+	indexes := make(map[uint64]int)
+	for i := range rows {
+		rowPrefix, err := validate.ConvertRtrAddressToPrefix(rows[i].Address, rows[i].PrefixLength)
+		if err != nil || rowPrefix != prefix {
+			continue
+		}
+		provenanceSource, err := getProvenanceSource("lab_rpki_roa", rows[i].SourceFrom, chains)
+		if err != nil {
+			belogs.Error("getProvenanceVrps(): getProvenanceSource fail:", rows[i].SourceFrom, err)
+			return nil, err
+		}
+		index, ok := indexes[rows[i].MaxLength]
+		if !ok {
+			firstSync, err := getProvenanceVrpFirstSync(&rows[i], provenanceSource)
+			if err != nil {
+				belogs.Error("getProvenanceVrps(): getProvenanceVrpFirstSync fail:", jsonutil.MarshalJson(rows[i]), err)
+				return nil, err
+			}
+			provenanceVrps = append(provenanceVrps, ProvenanceVrp{
+				Asn:       rows[i].Asn,
+				Prefix:    prefix.String(),
+				MaxLength: rows[i].MaxLength,
+				Sources:   make([]ProvenanceSource, 0),
+				FirstSync: firstSync,
+			})
+			index = len(provenanceVrps) - 1
+			indexes[rows[i].MaxLength] = index
+		}
+		provenanceVrps[index].Sources = append(provenanceVrps[index].Sources, provenanceSource)
+	}
+	return provenanceVrps, nil
+}
+
+func getProvenanceAspas(serialNumber uint64, customerAsn uint64,
+	chains map[string][]ProvenanceObject) (provenanceAspas []ProvenanceAspa, err error) {
+	rows, err := getProvenanceAspaRowsDb(serialNumber, customerAsn)
+	if err != nil {
+		belogs.Error("getProvenanceAspas(): getProvenanceAspaRowsDb fail:", customerAsn, err)
+		return nil, err
+	}
+
+	provenanceAspas = make([]ProvenanceAspa, 0)
+	indexes := make(map[string]int)
+	for i := range rows {
+		provenanceSource, err := getProvenanceSource("lab_rpki_asa", rows[i].SourceFrom, chains)
+		if err != nil {
+			belogs.Error("getProvenanceAspas(): getProvenanceSource fail:", rows[i].SourceFrom, err)
+			return nil, err
+		}
+		key := strconv.FormatUint(rows[i].ProviderAsn, 10) + "_" + strconv.FormatUint(rows[i].AddressFamily, 10)
+		index, ok := indexes[key]
+		if !ok {
+			firstSync, err := getProvenanceAspaFirstSync(&rows[i], provenanceSource)
+			if err != nil {
+				belogs.Error("getProvenanceAspas(): getProvenanceAspaFirstSync fail:", jsonutil.MarshalJson(rows[i]), err)
+				return nil, err
+			}
+			provenanceAspas = append(provenanceAspas, ProvenanceAspa{
+				CustomerAsn:   rows[i].CustomerAsn,
+				ProviderAsn:   rows[i].ProviderAsn,
+				AddressFamily: rows[i].AddressFamily,
+				Sources:       make([]ProvenanceSource, 0),
+				FirstSync:     firstSync,
+			})
+			index = len(provenanceAspas) - 1
+			indexes[key] = index
+		}
+		provenanceAspas[index].Sources = append(provenanceAspas[index].Sources, provenanceSource)
+	}
+	return provenanceAspas, nil
+}
+
+// tableName: lab_rpki_roa/lab_rpki_asa
+func getProvenanceSource(tableName string, sourceFromJson string,
+	chains map[string][]ProvenanceObject) (provenanceSource ProvenanceSource, err error) {
+	err = jsonutil.UnmarshalJson(sourceFromJson, &provenanceSource.SourceFrom)
+	if err != nil {
+		belogs.Error("getProvenanceSource(): UnmarshalJson sourceFrom fail:", sourceFromJson, err)
+		return provenanceSource, err
+	}
+
+	if provenanceSource.SourceFrom.Source == "slurm" {
+		provenanceSlurm, has, err := getProvenanceSlurmDb(provenanceSource.SourceFrom.SlurmId)
+		if err != nil {
+			belogs.Error("getProvenanceSource(): getProvenanceSlurmDb fail:", sourceFromJson, err)
+			return provenanceSource, err
+		}
+		if has {
+			provenanceSource.Slurm = &provenanceSlurm
+		}
+		return provenanceSource, nil
+	}
+	if provenanceSource.SourceFrom.SyncLogFileId == 0 {
+		return provenanceSource, nil
+	}
+
+	provenanceObject, has, err := getProvenanceObjectDb(tableName, provenanceSource.SourceFrom.SyncLogFileId)
+	if err != nil {
+		belogs.Error("getProvenanceSource(): getProvenanceObjectDb fail:", tableName, sourceFromJson, err)
+		return provenanceSource, err
+	}
+	if !has {
+		belogs.Debug("getProvenanceSource(): file has been deleted:", tableName, sourceFromJson)
+		return provenanceSource, nil
+	}
+	if len(provenanceObject.EeCertJson) > 0 {
+		eeCertModel := model.EeCertModel{}
+		err = jsonutil.UnmarshalJson(provenanceObject.EeCertJson, &eeCertModel)
+		if err != nil {
+			belogs.Error("getProvenanceSource(): UnmarshalJson eeCertModel fail:", provenanceObject.FilePath, provenanceObject.FileName, err)
+			return provenanceSource, err
+		}
+		provenanceSource.EeCert = &ProvenanceEeCert{
+			Sn:        eeCertModel.Sn,
+			Subject:   eeCertModel.SubjectAll,
+			NotBefore: eeCertModel.NotBefore,
+			NotAfter:  eeCertModel.NotAfter,
+		}
+		// validity of roa/asa is the validity of ee cert
+		provenanceObject.NotBefore = eeCertModel.NotBefore
+		provenanceObject.NotAfter = eeCertModel.NotAfter
+	}
+	provenanceSource.Object = &provenanceObject
+	provenanceSource.Tal = provenanceObject.Rir
+
+	chain, ok := chains[provenanceObject.Aki]
+	if !ok {
+		chain, err = getProvenanceChain(provenanceObject.Aki)
+		if err != nil {
+			belogs.Error("getProvenanceSource(): getProvenanceChain fail:", provenanceObject.Aki, err)
+			return provenanceSource, err
+		}
+		chains[provenanceObject.Aki] = chain
+	}
+	provenanceSource.Chain = chain
+	return provenanceSource, nil
+}
+
+// from the issuer cer up to the root cer, the root cer is self-signed or its aki is empty
+func getProvenanceChain(aki string) (chain []ProvenanceObject, err error) {
+	chain = make([]ProvenanceObject, 0)
+	skis := make(map[string]struct{})
+	for len(aki) > 0 && len(chain) < provenanceMaxChainDepth {
+		if _, ok := skis[aki]; ok {
+			break
+		}
+		skis[aki] = struct{}{}
+		provenanceCer, has, err := getProvenanceCerDb(aki)
+		if err != nil {
+			belogs.Error("getProvenanceChain(): getProvenanceCerDb fail:", aki, err)
+			return nil, err
+		}
+		if !has {
+			belogs.Debug("getProvenanceChain(): there is no cer, aki:", aki)
+			break
+		}
+		chain = append(chain, provenanceCer)
+		aki = provenanceCer.Aki
+	}
+	return chain, nil
+}
+
+func getProvenanceVrpFirstSync(row *provenanceRow, provenanceSource ProvenanceSource) (*ProvenanceFirstSync, error) {
+	provenanceAnnounce, has, err := getProvenanceVrpAnnounceDb(row)
+	if err != nil {
+		return nil, err
+	}
+	return getProvenanceFirstSync(provenanceAnnounce, has, provenanceSource)
+}
+
+func getProvenanceAspaFirstSync(row *provenanceRow, provenanceSource ProvenanceSource) (*ProvenanceFirstSync, error) {
+	provenanceAnnounce, has, err := getProvenanceAspaAnnounceDb(row)
+	if err != nil {
+		return nil, err
+	}
+	return getProvenanceFirstSync(provenanceAnnounce, has, provenanceSource)
+}
+
+// the sync which announced it in rtr, or the first sync of its roa/asa file when the incremental has been cleared.
+// it is nil when it is only from slurm
+func getProvenanceFirstSync(provenanceAnnounce provenanceAnnounce, hasAnnounce bool,
+	provenanceSource ProvenanceSource) (*ProvenanceFirstSync, error) {
+	if hasAnnounce {
+		sourceFrom := model.LabRpkiRtrSourceFrom{}
+		err := jsonutil.UnmarshalJson(provenanceAnnounce.SourceFrom, &sourceFrom)
+		if err != nil {
+			belogs.Error("getProvenanceFirstSync(): UnmarshalJson sourceFrom fail:", provenanceAnnounce.SourceFrom, err)
+			return nil, err
+		}
+		if sourceFrom.Source == "sync" && sourceFrom.SyncLogFileId > 0 {
+			provenanceFirstSync, has, err := getProvenanceSyncLogFileDb(sourceFrom.SyncLogFileId)
+			if err != nil {
+				return nil, err
+			}
+			if !has {
+				provenanceFirstSync = ProvenanceFirstSync{SyncLogId: sourceFrom.SyncLogId, SyncLogFileId: sourceFrom.SyncLogFileId}
+			}
+			provenanceFirstSync.SerialNumber = provenanceAnnounce.SerialNumber
+			return &provenanceFirstSync, nil
+		}
+	}
+
+	if provenanceSource.Object == nil {
+		return nil, nil
+	}
+	provenanceFirstSync, has, err := getProvenanceFirstSyncLogFileDb(provenanceSource.Object.FilePath, provenanceSource.Object.FileName)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, nil
+	}
+	return &provenanceFirstSync, nil
+}
@@ -0,0 +1,147 @@
+package provenance
+
+import (
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/xormdb"
+)
+
+// the latest published serialNumber, its full log is always kept. full log of a new serialNumber which is
+// held by preview or brake is not published, so it is not used
+func getProvenanceSerialNumberDb() (serialNumber uint64, has bool, err error) {
+	sql := `select serialNumber from lab_rpki_rtr_serial_number order by serialNumber desc limit 1`
+	has, err = xormdb.XormEngine.SQL(sql).Get(&serialNumber)
+	if err != nil {
+		belogs.Error("getProvenanceSerialNumberDb(): select lab_rpki_rtr_serial_number fail:", err)
+		return 0, false, err
+	}
+	return serialNumber, has, nil
+}
+
+// all rows of asn and prefixLength, prefix will be filtered later because address may be trimmed
+func getProvenanceVrpRowsDb(serialNumber uint64, asn int64, prefixLength, maxLength uint64) (provenanceRows []provenanceRow, err error) {
+	provenanceRows = make([]provenanceRow, 0)
+	session := xormdb.XormEngine.Table("lab_rpki_rtr_full_log").Cols("asn,address,prefixLength,maxLength,sourceFrom").
+		Where("serialNumber = ?", serialNumber).And("asn = ?", asn).And("prefixLength = ?", prefixLength)
+	if maxLength > 0 {
+		session = session.And("maxLength = ?", maxLength)
+	}
+	err = session.OrderBy("id").Find(&provenanceRows)
+	if err != nil {
+		belogs.Error("getProvenanceVrpRowsDb(): select lab_rpki_rtr_full_log fail, serialNumber:", serialNumber,
+			"  asn:", asn, "  prefixLength:", prefixLength, err)
+		return nil, err
+	}
+	belogs.Debug("getProvenanceVrpRowsDb(): serialNumber:", serialNumber, "  asn:", asn, "  len(provenanceRows):", len(provenanceRows))
+	return provenanceRows, nil
+}
+
+func getProvenanceAspaRowsDb(serialNumber uint64, customerAsn uint64) (provenanceRows []provenanceRow, err error) {
+	provenanceRows = make([]provenanceRow, 0)
+	sql := `select customerAsn, providerAsn, ifnull(addressFamily,0) as addressFamily, sourceFrom from lab_rpki_rtr_asa_full_log
+		where serialNumber = ? and customerAsn = ? order by id `
+	err = xormdb.XormEngine.SQL(sql, serialNumber, customerAsn).Find(&provenanceRows)
+	if err != nil {
+		belogs.Error("getProvenanceAspaRowsDb(): select lab_rpki_rtr_asa_full_log fail, serialNumber:", serialNumber,
+			"  customerAsn:", customerAsn, err)
+		return nil, err
+	}
+	belogs.Debug("getProvenanceAspaRowsDb(): serialNumber:", serialNumber, "  customerAsn:", customerAsn, "  len(provenanceRows):", len(provenanceRows))
+	return provenanceRows, nil
+}
+
+// tableName: lab_rpki_roa/lab_rpki_asa, has is false when the file has been deleted
+func getProvenanceObjectDb(tableName string, syncLogFileId uint64) (provenanceObject ProvenanceObject, has bool, err error) {
+	sql := `select o.id, o.filePath, o.fileName, ifnull(f.sourceUrl,'') as sourceUrl, o.ski, o.aki,
+			o.state->>'$.state' as state, ifnull(o.origin->>'$.rir','') as rir, o.syncLogId, o.syncLogFileId,
+			o.jsonAll->'$.eeCertModel' as eeCertJson
+		from ` + tableName + ` o left join lab_rpki_sync_log_file f on f.id = o.syncLogFileId
+		where o.syncLogFileId = ? order by o.id desc limit 1`
+	has, err = xormdb.XormEngine.SQL(sql, syncLogFileId).Get(&provenanceObject)
+	if err != nil {
+		belogs.Error("getProvenanceObjectDb(): select fail:", tableName, "  syncLogFileId:", syncLogFileId, err)
+		return provenanceObject, false, err
+	}
+	return provenanceObject, has, nil
+}
+
+// the cer whose ski is aki, valid cer is first when there are more than one
+func getProvenanceCerDb(aki string) (provenanceObject ProvenanceObject, has bool, err error) {
+	sql := `select c.id, c.filePath, c.fileName, ifnull(f.sourceUrl,'') as sourceUrl, c.subject, c.ski, c.aki,
+			c.notBefore, c.notAfter, c.state->>'$.state' as state, ifnull(c.origin->>'$.rir','') as rir,
+			c.syncLogId, c.syncLogFileId
+		from lab_rpki_cer c left join lab_rpki_sync_log_file f on f.id = c.syncLogFileId
+		where c.ski = ? order by c.state->>'$.state' in ('valid','warning') desc, c.id desc limit 1`
+	has, err = xormdb.XormEngine.SQL(sql, aki).Get(&provenanceObject)
+	if err != nil {
+		belogs.Error("getProvenanceCerDb(): select lab_rpki_cer fail, aki:", aki, err)
+		return provenanceObject, false, err
+	}
+	return provenanceObject, has, nil
+}
+
+func getProvenanceSlurmDb(slurmId uint64) (provenanceSlurm ProvenanceSlurm, has bool, err error) {
+	sql := `select s.id, s.style, ifnull(s.comment,'') as comment, s.slurmLogId, s.slurmLogFileId,
+			ifnull(f.fileName,'') as fileName, l.state as slurmLogState, l.uploadTime
+		from lab_rpki_slurm s left join lab_rpki_slurm_log_file f on f.id = s.slurmLogFileId
+			left join lab_rpki_slurm_log l on l.id = s.slurmLogId
+		where s.id = ?`
+	has, err = xormdb.XormEngine.SQL(sql, slurmId).Get(&provenanceSlurm)
+	if err != nil {
+		belogs.Error("getProvenanceSlurmDb(): select lab_rpki_slurm fail, slurmId:", slurmId, err)
+		return provenanceSlurm, false, err
+	}
+	return provenanceSlurm, has, nil
+}
+
+// the first announce of the vrp after its last withdraw, which is the start of it in rtr
+func getProvenanceVrpAnnounceDb(row *provenanceRow) (provenanceAnnounce provenanceAnnounce, has bool, err error) {
+	sql := `select serialNumber, sourceFrom from lab_rpki_rtr_incremental
+		where style = 'announce' and asn = ? and address = ? and prefixLength = ? and maxLength = ?
+			and serialNumber > ifnull((select max(w.serialNumber) from lab_rpki_rtr_incremental w
+				where w.style = 'withdraw' and w.asn = ? and w.address = ? and w.prefixLength = ? and w.maxLength = ?), 0)
+		order by serialNumber limit 1`
+	has, err = xormdb.XormEngine.SQL(sql, row.Asn, row.Address, row.PrefixLength, row.MaxLength,
+		row.Asn, row.Address, row.PrefixLength, row.MaxLength).Get(&provenanceAnnounce)
+	if err != nil {
+		belogs.Error("getProvenanceVrpAnnounceDb(): select lab_rpki_rtr_incremental fail:", row.Asn, row.Address, err)
+		return provenanceAnnounce, false, err
+	}
+	return provenanceAnnounce, has, nil
+}
+
+func getProvenanceAspaAnnounceDb(row *provenanceRow) (provenanceAnnounce provenanceAnnounce, has bool, err error) {
+	sql := `select serialNumber, sourceFrom from lab_rpki_rtr_asa_incremental
+		where style = 'announce' and customerAsn = ? and providerAsn = ? and ifnull(addressFamily,0) = ?
+			and serialNumber > ifnull((select max(w.serialNumber) from lab_rpki_rtr_asa_incremental w
+				where w.style = 'withdraw' and w.customerAsn = ? and w.providerAsn = ? and ifnull(w.addressFamily,0) = ?), 0)
+		order by serialNumber limit 1`
+	has, err = xormdb.XormEngine.SQL(sql, row.CustomerAsn, row.ProviderAsn, row.AddressFamily,
+		row.CustomerAsn, row.ProviderAsn, row.AddressFamily).Get(&provenanceAnnounce)
+	if err != nil {
+		belogs.Error("getProvenanceAspaAnnounceDb(): select lab_rpki_rtr_asa_incremental fail:", row.CustomerAsn, row.ProviderAsn, err)
+		return provenanceAnnounce, false, err
+	}
+	return provenanceAnnounce, has, nil
+}
+
+func getProvenanceSyncLogFileDb(syncLogFileId uint64) (provenanceFirstSync ProvenanceFirstSync, has bool, err error) {
+	sql := `select id, syncLogId, syncTime, syncType from lab_rpki_sync_log_file where id = ?`
+	has, err = xormdb.XormEngine.SQL(sql, syncLogFileId).Get(&provenanceFirstSync)
+	if err != nil {
+		belogs.Error("getProvenanceSyncLogFileDb(): select lab_rpki_sync_log_file fail, syncLogFileId:", syncLogFileId, err)
+		return provenanceFirstSync, false, err
+	}
+	return provenanceFirstSync, has, nil
+}
+
+// the first sync of the file, which is still in lab_rpki_sync_log_file
+func getProvenanceFirstSyncLogFileDb(filePath, fileName string) (provenanceFirstSync ProvenanceFirstSync, has bool, err error) {
+	sql := `select id, syncLogId, syncTime, syncType from lab_rpki_sync_log_file
+		where filePath = ? and fileName = ? and syncType in ('add','update') order by id limit 1`
+	has, err = xormdb.XormEngine.SQL(sql, filePath, fileName).Get(&provenanceFirstSync)
+	if err != nil {
+		belogs.Error("getProvenanceFirstSyncLogFileDb(): select lab_rpki_sync_log_file fail:", filePath, fileName, err)
+		return provenanceFirstSync, false, err
+	}
+	return provenanceFirstSync, has, nil
+}
@@ -0,0 +1,116 @@
+package provenance
+
+import (
+	"time"
+
+	model "rpstir2-model"
+)
+
+// vrp: prefix and asn, maxLength is 0 means any maxLength.
+// aspa: customerAsn, when prefix is empty
+type ProvenanceRequest struct {
+	Prefix      string `json:"prefix"`
+	MaxLength   uint64 `json:"maxLength"`
+	Asn         int64  `json:"asn"`
+	CustomerAsn uint64 `json:"customerAsn"`
+}
+
+// sources of vrps/aspas in the latest serialNumber
+type ProvenanceResult struct {
+	SerialNumber uint64           `json:"serialNumber"`
+	Vrps         []ProvenanceVrp  `json:"vrps,omitempty"`
+	Aspas        []ProvenanceAspa `json:"aspas,omitempty"`
+}
+
+type ProvenanceVrp struct {
+	Asn       int64                `json:"asn"`
+	Prefix    string               `json:"prefix"`
+	MaxLength uint64               `json:"maxLength"`
+	Sources   []ProvenanceSource   `json:"sources"`
+	FirstSync *ProvenanceFirstSync `json:"firstSync,omitempty"`
+}
+
+type ProvenanceAspa struct {
+	CustomerAsn   uint64               `json:"customerAsn"`
+	ProviderAsn   uint64               `json:"providerAsn"`
+	AddressFamily uint64               `json:"addressFamily"`
+	Sources       []ProvenanceSource   `json:"sources"`
+	FirstSync     *ProvenanceFirstSync `json:"firstSync,omitempty"`
+}
+
+// one row in rtr full log. object is roa/asa file, chain is from its issuer cer up to the root cer of tal.
+// object is nil when the file has been deleted after the serialNumber
+type ProvenanceSource struct {
+	SourceFrom model.LabRpkiRtrSourceFrom `json:"sourceFrom"`
+	Object     *ProvenanceObject          `json:"object,omitempty"`
+	EeCert     *ProvenanceEeCert          `json:"eeCert,omitempty"`
+	Chain      []ProvenanceObject         `json:"chain,omitempty"`
+	Tal        string                     `json:"tal,omitempty"`
+	Slurm      *ProvenanceSlurm           `json:"slurm,omitempty"`
+}
+
+// roa/asa/cer, from lab_rpki_roa/lab_rpki_asa/lab_rpki_cer
+type ProvenanceObject struct {
+	Id            uint64    `json:"id" xorm:"id int"`
+	FilePath      string    `json:"filePath" xorm:"filePath varchar(1024)"`
+	FileName      string    `json:"fileName" xorm:"fileName varchar(128)"`
+	Uri           string    `json:"uri" xorm:"sourceUrl varchar(512)"`
+	Subject       string    `json:"subject,omitempty" xorm:"subject varchar(1024)"`
+	Ski           string    `json:"ski" xorm:"ski varchar(128)"`
+	Aki           string    `json:"aki" xorm:"aki varchar(128)"`
+	NotBefore     time.Time `json:"notBefore" xorm:"notBefore datetime"`
+	NotAfter      time.Time `json:"notAfter" xorm:"notAfter datetime"`
+	State         string    `json:"state" xorm:"state varchar(16)"`
+	Rir           string    `json:"rir" xorm:"rir varchar(64)"`
+	SyncLogId     uint64    `json:"syncLogId" xorm:"syncLogId int"`
+	SyncLogFileId uint64    `json:"syncLogFileId" xorm:"syncLogFileId int"`
+	// only roa/asa, is parsed to eeCert
+	EeCertJson string `json:"-" xorm:"eeCertJson json"`
+}
+
+type ProvenanceEeCert struct {
+	Sn        string    `json:"sn"`
+	Subject   string    `json:"subject"`
+	NotBefore time.Time `json:"notBefore"`
+	NotAfter  time.Time `json:"notAfter"`
+}
+
+// from lab_rpki_slurm, lab_rpki_slurm_log and lab_rpki_slurm_log_file
+type ProvenanceSlurm struct {
+	SlurmId        uint64    `json:"slurmId" xorm:"id int"`
+	Style          string    `json:"style" xorm:"style varchar(128)"`
+	Comment        string    `json:"comment" xorm:"comment varchar(256)"`
+	SlurmLogId     uint64    `json:"slurmLogId" xorm:"slurmLogId int"`
+	SlurmLogFileId uint64    `json:"slurmLogFileId" xorm:"slurmLogFileId int"`
+	FileName       string    `json:"fileName" xorm:"fileName varchar(128)"`
+	SlurmLogState  string    `json:"slurmLogState" xorm:"slurmLogState varchar(16)"`
+	UploadTime     time.Time `json:"uploadTime" xorm:"uploadTime datetime"`
+}
+
+// the sync which produced the vrp/aspa. serialNumber is 0 when the announce incremental has been cleared,
+// then it is the first sync of the roa/asa file
+type ProvenanceFirstSync struct {
+	SerialNumber  uint64    `json:"serialNumber,omitempty"`
+	SyncLogId     uint64    `json:"syncLogId" xorm:"syncLogId int"`
+	SyncLogFileId uint64    `json:"syncLogFileId" xorm:"id int"`
+	SyncTime      time.Time `json:"syncTime" xorm:"syncTime datetime"`
+	SyncType      string    `json:"syncType" xorm:"syncType varchar(16)"`
+}
+
+// one row in lab_rpki_rtr_full_log/lab_rpki_rtr_asa_full_log
+type provenanceRow struct {
+	Asn           int64  `xorm:"asn bigint"`
+	Address       string `xorm:"address varchar(512)"`
+	PrefixLength  uint64 `xorm:"prefixLength int"`
+	MaxLength     uint64 `xorm:"maxLength int"`
+	CustomerAsn   uint64 `xorm:"customerAsn int"`
+	ProviderAsn   uint64 `xorm:"providerAsn int"`
+	AddressFamily uint64 `xorm:"addressFamily int"`
+	SourceFrom    string `xorm:"sourceFrom json"`
+}
+
+// the latest announce in lab_rpki_rtr_incremental/lab_rpki_rtr_asa_incremental
+type provenanceAnnounce struct {
+	SerialNumber uint64 `xorm:"serialNumber bigint"`
+	SourceFrom   string `xorm:"sourceFrom json"`
+}
@@ -0,0 +1,31 @@
+package rtrproducer
+
+import (
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/ginserver"
+	"github.com/cpusoft/goutil/jsonutil"
+	"github.com/gin-gonic/gin"
+	rtrprovenance "rpstir2-rtrproducer/provenance"
+)
+
+// {"prefix":"192.0.2.0/24","asn":64496,"maxLength":24} or {"customerAsn":64496}, maxLength is optional
+func Provenance(c *gin.Context) {
+	belogs.Info("Provenance(): http start")
+
+	provenanceRequest := rtrprovenance.ProvenanceRequest{}
+	err := c.ShouldBindJSON(&provenanceRequest)
+	if err != nil {
+		belogs.Error("Provenance(): ShouldBindJSON fail:", err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	provenanceResult, err := rtrprovenance.GetProvenance(provenanceRequest)
+	if err != nil {
+		belogs.Error("Provenance(): GetProvenance fail:", jsonutil.MarshalJson(provenanceRequest), err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	belogs.Info("Provenance(): http ok, provenanceRequest:", jsonutil.MarshalJson(provenanceRequest),
+		"  len(Vrps):", len(provenanceResult.Vrps), "  len(Aspas):", len(provenanceResult.Aspas))
+	ginserver.ResponseOk(c, provenanceResult)
+}
@@ -0,0 +1,89 @@
+package roa
+
+import (
+	"strings"
+
+	"github.com/cpusoft/goutil/belogs"
+	model "rpstir2-model"
+)
+
+// same order as "order by asn, address, prefixLength, maxLength" in db, address is compared as binary
+func compareRtrFull(a, b *model.LabRpkiRtrFull) int {
+	if a.Asn != b.Asn {
+		if a.Asn < b.Asn {
+			return -1
+		}
+		return 1
+	}
+	if c := strings.Compare(a.Address, b.Address); c != 0 {
+		return c
+	}
+	if a.PrefixLength != b.PrefixLength {
+		if a.PrefixLength < b.PrefixLength {
+			return -1
+		}
+		return 1
+	}
+	if a.MaxLength != b.MaxLength {
+		if a.MaxLength < b.MaxLength {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+// nextCur and nextNew return sorted rtr fulls without duplicated key, and return nil at end.
+// only in new is announce, only in cur is withdraw
+func mergeRtrFullToRtrIncremental(nextCur, nextNew func() (*model.LabRpkiRtrFull, error),
+	newSerialNumber uint64) (rtrIncrementals []model.LabRpkiRtrIncremental, err error) {
+	rtrIncrementals = make([]model.LabRpkiRtrIncremental, 0)
+	newRtrIncremental := func(style string, rtrFull *model.LabRpkiRtrFull) model.LabRpkiRtrIncremental {
+		return model.LabRpkiRtrIncremental{
+			Style:        style,
+			Asn:          rtrFull.Asn,
+			Address:      rtrFull.Address,
+			PrefixLength: rtrFull.PrefixLength,
+			MaxLength:    rtrFull.MaxLength,
+			SerialNumber: newSerialNumber,
+			SourceFrom:   rtrFull.SourceFrom,
+		}
+	}
+
+	cur, err := nextCur()
+	if err != nil {
+		return nil, err
+	}
+	new, err := nextNew()
+	if err != nil {
+		return nil, err
+	}
+	for cur != nil || new != nil {
+		c := 0
+		if cur == nil {
+			c = 1
+		} else if new == nil {
+			c = -1
+		} else {
+			c = compareRtrFull(cur, new)
+		}
+		if c <= 0 {
+			if c < 0 {
+				rtrIncrementals = append(rtrIncrementals, newRtrIncremental("withdraw", cur))
+			}
+			if cur, err = nextCur(); err != nil {
+				return nil, err
+			}
+		}
+		if c >= 0 {
+			if c > 0 {
+				rtrIncrementals = append(rtrIncrementals, newRtrIncremental("announce", new))
+			}
+			if new, err = nextNew(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	belogs.Debug("mergeRtrFullToRtrIncremental(): newSerialNumber, len(rtrIncrementals):", newSerialNumber, len(rtrIncrementals))
+	return rtrIncrementals, nil
+}
@@ -0,0 +1,42 @@
+package roa
+
+import (
+	"fmt"
+	"testing"
+
+	model "rpstir2-model"
+)
+
+func TestMergeRtrFullToRtrIncremental(t *testing.T) {
+	next := func(rtrFulls []model.LabRpkiRtrFull) func() (*model.LabRpkiRtrFull, error) {
+		i := 0
+		return func() (*model.LabRpkiRtrFull, error) {
+			if i >= len(rtrFulls) {
+				return nil, nil
+			}
+			i++
+			return &rtrFulls[i-1], nil
+		}
+	}
+	curs := []model.LabRpkiRtrFull{
+		{Asn: 64496, Address: "192.0.2.0", PrefixLength: 24, MaxLength: 24},
+		{Asn: 64496, Address: "198.51.100.0", PrefixLength: 24, MaxLength: 24},
+		{Asn: 64497, Address: "2001:db8::", PrefixLength: 32, MaxLength: 48},
+	}
+	news := []model.LabRpkiRtrFull{
+		{Asn: 64496, Address: "192.0.2.0", PrefixLength: 24, MaxLength: 24},
+		{Asn: 64496, Address: "198.51.100.0", PrefixLength: 24, MaxLength: 25},
+		{Asn: 64497, Address: "2001:db8::", PrefixLength: 32, MaxLength: 48},
+		{Asn: 64498, Address: "203.0.113.0", PrefixLength: 24, MaxLength: 24},
+	}
+	rtrIncrementals, err := mergeRtrFullToRtrIncremental(next(curs), next(news), 2)
+	fmt.Println(rtrIncrementals, err)
+	if err != nil || len(rtrIncrementals) != 3 {
+		t.Fatal("should be 1 withdraw and 2 announce:", rtrIncrementals, err)
+	}
+	if rtrIncrementals[0].Style != "withdraw" || rtrIncrementals[0].MaxLength != 24 ||
+		rtrIncrementals[1].Style != "announce" || rtrIncrementals[1].MaxLength != 25 ||
+		rtrIncrementals[2].Style != "announce" || rtrIncrementals[2].Asn != 64498 {
+		t.Fatal("wrong incrementals:", rtrIncrementals)
+	}
+}
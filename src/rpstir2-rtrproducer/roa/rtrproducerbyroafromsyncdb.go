@@ -4,41 +4,13 @@ import (
 	"time"
 
 	"github.com/cpusoft/goutil/belogs"
-	"github.com/cpusoft/goutil/convert"
 	"github.com/cpusoft/goutil/jsonutil"
 	"github.com/cpusoft/goutil/xormdb"
 	model "rpstir2-model"
 	rtrcommon "rpstir2-rtrproducer/common"
+	"xorm.io/xorm"
 )
 
-func getAllRoasDb() (roaToRtrFullLogs []model.RoaToRtrFullLog, err error) {
-	// get lastest syncLogFile.Id
-
-	sql :=
-		`SELECT
-		r.id AS roaId,
-		r.asn AS asn,
-		substring_index( i.addressPrefix, '/', 1 ) AS address,
-		substring_index( i.addressPrefix, '/', -1 ) AS prefixLength,
-		i.maxLength AS maxLength,
-		r.syncLogId AS syncLogId,
-		r.syncLogFileId AS syncLogFileId 
-	FROM
-		( lab_rpki_roa r , lab_rpki_roa_ipaddress i ) 
-	WHERE
-		( i.roaId = r.id and r.state->'$.state' in ('valid','warning')  ) 
-	ORDER BY
-	    address,prefixLength desc,maxLength desc,r.asn,i.id		 `
-	err = xormdb.XormEngine.SQL(sql).Find(&roaToRtrFullLogs)
-	if err != nil {
-		belogs.Error("getAllRoasDb(): find fail:", err)
-		return roaToRtrFullLogs, err
-	}
-	belogs.Debug("getAllRoasDb(): len(roaToRtrFullLogs):", len(roaToRtrFullLogs))
-
-	return roaToRtrFullLogs, nil
-}
-
 func updateSerialNumberAndRtrFullAndRtrIncrementalDb(newSerialNumberModel *rtrcommon.SerialNumberModel,
 	rtrIncrementals []model.LabRpkiRtrIncremental) (err error) {
 	start := time.Now()
@@ -114,78 +86,82 @@ func updateSerialNumberAndRtrFullAndRtrIncrementalDb(newSerialNumberModel *rtrco
 	return nil
 }
 
-func getRtrFullFromRtrFullLogDb(serialNumber uint64) (rtrFulls map[string]model.LabRpkiRtrFull, err error) {
-	start := time.Now()
-	belogs.Debug("getRtrFullFromRtrFullLogDb():serialNumber:", serialNumber)
-	rtrFs := make([]model.LabRpkiRtrFull, 0)
-	/* sql :=
-		`select asn, address, prefixLength, maxlength, sourceFrom
-	    from lab_rpki_rtr_full_log
-	    where serialNumber = ?
-		order by id `
-	*/
-	err = xormdb.XormEngine.Table("lab_rpki_rtr_full_log").
-		Cols("asn, address, prefixLength, maxlength, sourceFrom").
-		Where("serialNumber = ?", serialNumber).OrderBy("id").Find(&rtrFs)
+// rows of lab_rpki_rtr_full_log of one serialNumber, sorted by key and skip duplicated key
+type rtrFullLogIterator struct {
+	rows  *xorm.Rows
+	last  *model.LabRpkiRtrFull
+	count uint64
+}
+
+func newRtrFullLogIteratorDb(serialNumber uint64) (iterator *rtrFullLogIterator, err error) {
+	sql := `select asn, address, prefixLength, maxLength, sourceFrom from lab_rpki_rtr_full_log
+		where serialNumber = ? order by asn, binary address, prefixLength, maxLength, id `
+	rows, err := xormdb.XormEngine.SQL(sql, serialNumber).Rows(new(model.LabRpkiRtrFull))
 	if err != nil {
-		belogs.Error("getRtrFullFromRtrFullLogDb(): find fail: serialNumber: ", serialNumber, err)
+		belogs.Error("newRtrFullLogIteratorDb(): Rows fail: serialNumber:", serialNumber, err)
 		return nil, err
 	}
-	if len(rtrFs) == 0 {
-		belogs.Debug("getRtrFullFromRtrFullLogDb(): len(rtrFs)==0: serialNumber", serialNumber)
-		return rtrFulls, nil
-	}
-	belogs.Debug("getRtrFullFromRtrFullLogDb():model.LabRpkiRtrFull, serialNumber, len(rtrFs) : ", serialNumber, len(rtrFs))
+	return &rtrFullLogIterator{rows: rows}, nil
+}
 
-	rtrFulls = make(map[string]model.LabRpkiRtrFull, len(rtrFs)+50)
-	for i := range rtrFs {
-		key := convert.ToString(rtrFs[i].Asn) + "_" + rtrFs[i].Address + "_" +
-			convert.ToString(rtrFs[i].PrefixLength) + "_" + convert.ToString(rtrFs[i].MaxLength)
-		rtrFulls[key] = rtrFs[i]
+// return nil at end
+func (iterator *rtrFullLogIterator) Next() (*model.LabRpkiRtrFull, error) {
+	for iterator.rows.Next() {
+		rtrFull := new(model.LabRpkiRtrFull)
+		err := iterator.rows.Scan(rtrFull)
+		if err != nil {
+			belogs.Error("Next(): Scan lab_rpki_rtr_full_log fail:", err)
+			return nil, err
+		}
+		if iterator.last != nil && compareRtrFull(iterator.last, rtrFull) == 0 {
+			continue
+		}
+		iterator.last = rtrFull
+		iterator.count++
+		return rtrFull, nil
 	}
-	belogs.Info("getRtrFullFromRtrFullLogDb():map LabRpkiRtrFull, serialNumber, len(rtrFulls):", serialNumber, len(rtrFulls), "   time(s):", time.Since(start))
-	return rtrFulls, nil
+	return nil, iterator.rows.Err()
+}
 
+func (iterator *rtrFullLogIterator) Close() {
+	iterator.rows.Close()
 }
 
-func insertRtrFullLogFromRoaDb(newSerialNumber uint64, roaToRtrFullLogs []model.RoaToRtrFullLog) (err error) {
+// insert valid/warning roas into lab_rpki_rtr_full_log by sql, sourceFrom is same as model.LabRpkiRtrSourceFrom
+func insertRtrFullLogFromRoaDb(newSerialNumber uint64) (roaCount int64, err error) {
 	start := time.Now()
 	session, err := xormdb.NewSession()
 	if err != nil {
 		belogs.Error("insertRtrFullLogFromRoaDb(): NewSession fail :", err)
-		return err
+		return 0, err
 	}
 	defer session.Close()
 
-	// insert roa into rtr_full_log
-	sql := `insert  into lab_rpki_rtr_full_log
-				(serialNumber,asn,address,prefixLength, maxLength,sourceFrom) values
-				(?,?,?,  ?,?,?)`
-	sourceFrom := model.LabRpkiRtrSourceFrom{
-		Source: "sync",
+	sql := `insert into lab_rpki_rtr_full_log
+			(serialNumber,asn,address,prefixLength, maxLength,sourceFrom)
+		select ?, r.asn, substring_index(i.addressPrefix, '/', 1), substring_index(i.addressPrefix, '/', -1), i.maxLength,
+			json_object('source', 'sync', 'syncLogId', r.syncLogId, 'syncLogFileId', r.syncLogFileId,
+				'slurmId', 0, 'slurmLogId', 0, 'slurmLogFileId', 0, 'transferUuid', '')
+		from lab_rpki_roa r, lab_rpki_roa_ipaddress i
+		where i.roaId = r.id and r.state->'$.state' in ('valid','warning')
+		order by r.id, i.id `
+	affected, err := session.Exec(sql, newSerialNumber)
+	if err != nil {
+		belogs.Error("insertRtrFullLogFromRoaDb():insert into lab_rpki_rtr_full_log from roa fail: newSerialNumber:", newSerialNumber, err)
+		return 0, xormdb.RollbackAndLogError(session, "insertRtrFullLogFromRoaDb(): insert into lab_rpki_rtr_full_log fail: ", err)
 	}
-	belogs.Debug("insertRtrFullLogFromRoaDb(): will insert lab_rpki_rtr_full_log from roaToRtrFullLogs, len(roaToRtrFullLogs): ", len(roaToRtrFullLogs))
-	for i := range roaToRtrFullLogs {
-		sourceFrom.SyncLogId = roaToRtrFullLogs[i].SyncLogId
-		sourceFrom.SyncLogFileId = roaToRtrFullLogs[i].SyncLogFileId
-		sourceFromJson := jsonutil.MarshalJson(sourceFrom)
-
-		_, err = session.Exec(sql,
-			newSerialNumber, roaToRtrFullLogs[i].Asn, roaToRtrFullLogs[i].Address,
-			roaToRtrFullLogs[i].PrefixLength, roaToRtrFullLogs[i].MaxLength, sourceFromJson)
-		if err != nil {
-			belogs.Error("insertRtrFullLogFromRoaDb():insert into lab_rpki_rtr_full_log from roa fail:",
-				jsonutil.MarshalJson(roaToRtrFullLogs[i]), err)
-			return xormdb.RollbackAndLogError(session, "insertRtrFullLogFromRoaDb(): insert into lab_rpki_rtr_full_log fail: ", err)
-		}
+	roaCount, err = affected.RowsAffected()
+	if err != nil {
+		belogs.Error("insertRtrFullLogFromRoaDb(): RowsAffected fail: newSerialNumber:", newSerialNumber, err)
+		return 0, xormdb.RollbackAndLogError(session, "insertRtrFullLogFromRoaDb(): RowsAffected fail: ", err)
 	}
 
 	// commit
 	err = xormdb.CommitSession(session)
 	if err != nil {
 		belogs.Error("insertRtrFullLogFromRoaDb(): CommitSession fail :", err)
-		return xormdb.RollbackAndLogError(session, "insertRtrFullLogFromRoaDb(): CommitSession fail: ", err)
+		return 0, xormdb.RollbackAndLogError(session, "insertRtrFullLogFromRoaDb(): CommitSession fail: ", err)
 	}
-	belogs.Info("insertRtrFullLogFromRoaDb(): CommitSession ok, len(roaToRtrFullLogs): ", len(roaToRtrFullLogs), "   time(s):", time.Since(start))
-	return nil
+	belogs.Info("insertRtrFullLogFromRoaDb(): CommitSession ok, newSerialNumber:", newSerialNumber, "  roaCount: ", roaCount, "   time(s):", time.Since(start))
+	return roaCount, nil
 }
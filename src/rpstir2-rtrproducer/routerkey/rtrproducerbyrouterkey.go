@@ -0,0 +1,169 @@
+package routerkey
+
+import (
+	"time"
+
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/convert"
+	"github.com/cpusoft/goutil/jsonutil"
+	model "rpstir2-model"
+	rtrcommon "rpstir2-rtrproducer/common"
+	rtrpreview "rpstir2-rtrproducer/preview"
+)
+
+// router keys of new serialNumber: keys of cur serialNumber which are not from slurm, removed by bgpsecFilters,
+// then added by bgpsecAssertions(rfc8416 4.1). bgpsec router certificates are not parsed by sync yet,
+// so now all keys come from bgpsecAssertions, and bgpsecFilters will not remove any asserted key.
+// previewGate may be nil, when it is not nil, will wait it to be approved before publishing
+func RtrUpdateRouterKey(curSerialNumberModel, newSerialNumberModel *rtrcommon.SerialNumberModel,
+	previewGate *rtrpreview.PreviewGate) (err error) {
+	start := time.Now()
+	belogs.Info("RtrUpdateRouterKey():start, curSerialNumberModel:", jsonutil.MarshalJson(curSerialNumberModel),
+		"    newSerialNumberModel:", jsonutil.MarshalJson(newSerialNumberModel))
+
+	slurmToRtrFullLogs, err := rtrcommon.GetAllSlurmsDb("routerKey")
+	if err != nil {
+		belogs.Error("RtrUpdateRouterKey(): GetAllSlurmsDb fail:", err)
+		return err
+	}
+	rtrRouterKeyFullCurs, err := getRtrRouterKeyFullFromRtrFullLogDb(curSerialNumberModel.SerialNumber)
+	if err != nil {
+		belogs.Error("RtrUpdateRouterKey():getRtrRouterKeyFullFromRtrFullLogDb cur fail: cur SerialNumber:", curSerialNumberModel.SerialNumber, err)
+		return err
+	}
+	belogs.Info("RtrUpdateRouterKey(): len(slurmToRtrFullLogs):", len(slurmToRtrFullLogs),
+		"  len(rtrRouterKeyFullCurs):", len(rtrRouterKeyFullCurs), "  time(s):", time.Since(start))
+
+	//when both  len are 0, return nil
+	if len(slurmToRtrFullLogs) == 0 && len(rtrRouterKeyFullCurs) == 0 {
+		belogs.Info("RtrUpdateRouterKey():router key and slurm are both empty")
+		return nil
+	}
+
+	rtrRouterKeyFullNews := filterAndAssertRouterKeys(rtrRouterKeyFullCurs, slurmToRtrFullLogs, newSerialNumberModel.SerialNumber)
+	err = insertRtrRouterKeyFullLogDb(newSerialNumberModel.SerialNumber, rtrRouterKeyFullNews)
+	if err != nil {
+		belogs.Error("RtrUpdateRouterKey():insertRtrRouterKeyFullLogDb fail: new SerialNumber:", newSerialNumberModel.SerialNumber, err)
+		return err
+	}
+
+	rtrRouterKeyIncrementals := diffRtrRouterKeyFullToRtrRouterKeyIncremental(rtrRouterKeyFullCurs, rtrRouterKeyFullNews,
+		newSerialNumberModel.SerialNumber)
+	belogs.Info("RtrUpdateRouterKey():diffRtrRouterKeyFullToRtrRouterKeyIncremental, len(rtrRouterKeyFullNews):", len(rtrRouterKeyFullNews),
+		"  len(rtrRouterKeyIncrementals):", len(rtrRouterKeyIncrementals), "  time(s):", time.Since(start))
+
+	// serialNumber is shared with roa, so should wait for preview of roa
+	err = previewGate.Wait()
+	if err != nil {
+		belogs.Error("RtrUpdateRouterKey():Wait previewGate fail: newSerialNumber:", newSerialNumberModel.SerialNumber, err)
+		return err
+	}
+
+	err = updateSerialNumberAndRtrRouterKeyFullAndRtrRouterKeyIncrementalDb(newSerialNumberModel, rtrRouterKeyIncrementals)
+	if err != nil {
+		belogs.Error("RtrUpdateRouterKey():updateSerialNumberAndRtrRouterKeyFullAndRtrRouterKeyIncrementalDb fail: newSerialNumber:",
+			jsonutil.MarshalJson(newSerialNumberModel), "   len(rtrRouterKeyIncrementals):", len(rtrRouterKeyIncrementals), err)
+		return err
+	}
+	belogs.Info("RtrUpdateRouterKey(): end, newSerialNumberModel:", jsonutil.MarshalJson(newSerialNumberModel),
+		"   len(rtrRouterKeyIncrementals):", len(rtrRouterKeyIncrementals), "  time(s):", time.Since(start))
+	return nil
+}
+
+func filterAndAssertRouterKeys(rtrRouterKeyFullCurs map[string]model.LabRpkiRtrRouterKeyFull,
+	slurmToRtrFullLogs []model.SlurmToRtrFullLog, newSerialNumber uint64) (rtrRouterKeyFullNews map[string]model.LabRpkiRtrRouterKeyFull) {
+	rtrRouterKeyFullNews = make(map[string]model.LabRpkiRtrRouterKeyFull, len(rtrRouterKeyFullCurs)+len(slurmToRtrFullLogs))
+	for key, rtrRouterKeyFull := range rtrRouterKeyFullCurs {
+		sourceFrom := model.LabRpkiRtrSourceFrom{}
+		jsonutil.UnmarshalJson(rtrRouterKeyFull.SourceFrom, &sourceFrom)
+		// last slurm assertions will be added again
+		if sourceFrom.Source == "slurm" {
+			continue
+		}
+		if isFilteredRouterKey(rtrRouterKeyFull, slurmToRtrFullLogs) {
+			belogs.Debug("filterAndAssertRouterKeys(): filtered by slurm:", jsonutil.MarshalJson(rtrRouterKeyFull))
+			continue
+		}
+		rtrRouterKeyFull.SerialNumber = newSerialNumber
+		rtrRouterKeyFullNews[key] = rtrRouterKeyFull
+	}
+
+	for i := range slurmToRtrFullLogs {
+		if slurmToRtrFullLogs[i].Style != "bgpsecAssertions" {
+			continue
+		}
+		sourceFrom := model.LabRpkiRtrSourceFrom{
+			Source:         "slurm",
+			SlurmId:        slurmToRtrFullLogs[i].SlurmId,
+			SlurmLogId:     slurmToRtrFullLogs[i].SlurmLogId,
+			SlurmLogFileId: slurmToRtrFullLogs[i].SlurmLogFileId,
+		}
+		rtrRouterKeyFull := model.LabRpkiRtrRouterKeyFull{
+			SerialNumber:    newSerialNumber,
+			Asn:             uint64(slurmToRtrFullLogs[i].Asn.ValueOrZero()),
+			Ski:             slurmToRtrFullLogs[i].Ski,
+			RouterPublicKey: slurmToRtrFullLogs[i].RouterPublicKey,
+			SourceFrom:      jsonutil.MarshalJson(sourceFrom),
+		}
+		rtrRouterKeyFullNews[getRouterKeyKey(rtrRouterKeyFull.Asn, rtrRouterKeyFull.Ski, rtrRouterKeyFull.RouterPublicKey)] = rtrRouterKeyFull
+	}
+	return rtrRouterKeyFullNews
+}
+
+// rfc8416 3.3.2: match by asn, or by ski, or by both
+func isFilteredRouterKey(rtrRouterKeyFull model.LabRpkiRtrRouterKeyFull, slurmToRtrFullLogs []model.SlurmToRtrFullLog) bool {
+	for i := range slurmToRtrFullLogs {
+		if slurmToRtrFullLogs[i].Style != "bgpsecFilters" {
+			continue
+		}
+		if !slurmToRtrFullLogs[i].Asn.Valid && len(slurmToRtrFullLogs[i].Ski) == 0 {
+			continue
+		}
+		if slurmToRtrFullLogs[i].Asn.Valid && uint64(slurmToRtrFullLogs[i].Asn.ValueOrZero()) != rtrRouterKeyFull.Asn {
+			continue
+		}
+		if len(slurmToRtrFullLogs[i].Ski) > 0 && slurmToRtrFullLogs[i].Ski != rtrRouterKeyFull.Ski {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+func diffRtrRouterKeyFullToRtrRouterKeyIncremental(rtrRouterKeyFullCurs, rtrRouterKeyFullNews map[string]model.LabRpkiRtrRouterKeyFull,
+	newSerialNumber uint64) (rtrRouterKeyIncrementals []model.LabRpkiRtrRouterKeyIncremental) {
+	rtrRouterKeyIncrementals = make([]model.LabRpkiRtrRouterKeyIncremental, 0)
+	for keyNew, valueNew := range rtrRouterKeyFullNews {
+		if _, ok := rtrRouterKeyFullCurs[keyNew]; ok {
+			continue
+		}
+		rtrRouterKeyIncrementals = append(rtrRouterKeyIncrementals, model.LabRpkiRtrRouterKeyIncremental{
+			SerialNumber:    newSerialNumber,
+			Style:           "announce",
+			Asn:             valueNew.Asn,
+			Ski:             valueNew.Ski,
+			RouterPublicKey: valueNew.RouterPublicKey,
+			SourceFrom:      valueNew.SourceFrom,
+		})
+	}
+	for keyCur, valueCur := range rtrRouterKeyFullCurs {
+		if _, ok := rtrRouterKeyFullNews[keyCur]; ok {
+			continue
+		}
+		rtrRouterKeyIncrementals = append(rtrRouterKeyIncrementals, model.LabRpkiRtrRouterKeyIncremental{
+			SerialNumber:    newSerialNumber,
+			Style:           "withdraw",
+			Asn:             valueCur.Asn,
+			Ski:             valueCur.Ski,
+			RouterPublicKey: valueCur.RouterPublicKey,
+			SourceFrom:      valueCur.SourceFrom,
+		})
+	}
+	belogs.Debug("diffRtrRouterKeyFullToRtrRouterKeyIncremental(): newSerialNumber:", newSerialNumber,
+		"  len(rtrRouterKeyIncrementals):", len(rtrRouterKeyIncrementals))
+	return rtrRouterKeyIncrementals
+}
+
+func getRouterKeyKey(asn uint64, ski, routerPublicKey string) string {
+	return convert.ToString(asn) + "_" + ski + "_" + routerPublicKey
+}
@@ -0,0 +1,132 @@
+package routerkey
+
+import (
+	"time"
+
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/jsonutil"
+	"github.com/cpusoft/goutil/xormdb"
+	model "rpstir2-model"
+	rtrcommon "rpstir2-rtrproducer/common"
+)
+
+func getRtrRouterKeyFullFromRtrFullLogDb(serialNumber uint64) (rtrRouterKeyFulls map[string]model.LabRpkiRtrRouterKeyFull, err error) {
+	start := time.Now()
+	belogs.Debug("getRtrRouterKeyFullFromRtrFullLogDb():serialNumber:", serialNumber)
+	rtrRouterKeyFs := make([]model.LabRpkiRtrRouterKeyFull, 0)
+	sql :=
+		`select serialNumber,asn,ski,routerPublicKey,sourceFrom 
+	    from lab_rpki_rtr_router_key_full_log 
+	    where serialNumber = ? 
+		order by id `
+	err = xormdb.XormEngine.SQL(sql, serialNumber).Find(&rtrRouterKeyFs)
+	if err != nil {
+		belogs.Error("getRtrRouterKeyFullFromRtrFullLogDb(): get lab_rpki_rtr_router_key_full_log fail: serialNumber: ", serialNumber, err)
+		return nil, err
+	}
+
+	rtrRouterKeyFulls = make(map[string]model.LabRpkiRtrRouterKeyFull, len(rtrRouterKeyFs))
+	for i := range rtrRouterKeyFs {
+		key := getRouterKeyKey(rtrRouterKeyFs[i].Asn, rtrRouterKeyFs[i].Ski, rtrRouterKeyFs[i].RouterPublicKey)
+		rtrRouterKeyFulls[key] = rtrRouterKeyFs[i]
+	}
+	belogs.Info("getRtrRouterKeyFullFromRtrFullLogDb():map LabRpkiRtrRouterKeyFull, serialNumber:",
+		serialNumber, "  , len(rtrRouterKeyFs):", len(rtrRouterKeyFs), "   time(s):", time.Since(start))
+	return rtrRouterKeyFulls, nil
+}
+
+func insertRtrRouterKeyFullLogDb(newSerialNumber uint64, rtrRouterKeyFulls map[string]model.LabRpkiRtrRouterKeyFull) (err error) {
+	start := time.Now()
+	session, err := xormdb.NewSession()
+	if err != nil {
+		belogs.Error("insertRtrRouterKeyFullLogDb(): NewSession fail :", err)
+		return err
+	}
+	defer session.Close()
+
+	sql := `insert ignore into lab_rpki_rtr_router_key_full_log
+				(serialNumber,asn,ski,routerPublicKey,sourceFrom) values
+				(?,?,?,?,?)`
+	for _, rtrRouterKeyFull := range rtrRouterKeyFulls {
+		_, err = session.Exec(sql,
+			newSerialNumber, rtrRouterKeyFull.Asn, rtrRouterKeyFull.Ski, rtrRouterKeyFull.RouterPublicKey, rtrRouterKeyFull.SourceFrom)
+		if err != nil {
+			belogs.Error("insertRtrRouterKeyFullLogDb():insert into lab_rpki_rtr_router_key_full_log fail:",
+				jsonutil.MarshalJson(rtrRouterKeyFull), err)
+			return xormdb.RollbackAndLogError(session, "insertRtrRouterKeyFullLogDb(): insert into lab_rpki_rtr_router_key_full_log fail: ", err)
+		}
+	}
+
+	// commit
+	err = xormdb.CommitSession(session)
+	if err != nil {
+		belogs.Error("insertRtrRouterKeyFullLogDb(): CommitSession fail :", err)
+		return xormdb.RollbackAndLogError(session, "insertRtrRouterKeyFullLogDb(): CommitSession fail: ", err)
+	}
+	belogs.Info("insertRtrRouterKeyFullLogDb(): CommitSession ok, newSerialNumber:", newSerialNumber,
+		"  len(rtrRouterKeyFulls): ", len(rtrRouterKeyFulls), "   time(s):", time.Since(start))
+	return nil
+}
+
+func updateSerialNumberAndRtrRouterKeyFullAndRtrRouterKeyIncrementalDb(newSerialNumberModel *rtrcommon.SerialNumberModel,
+	rtrRouterKeyIncrementals []model.LabRpkiRtrRouterKeyIncremental) (err error) {
+	start := time.Now()
+	belogs.Debug("updateSerialNumberAndRtrRouterKeyFullAndRtrRouterKeyIncrementalDb(): newSerialNumberModel:", jsonutil.MarshalJson(newSerialNumberModel),
+		"   len(rtrRouterKeyIncrementals):", len(rtrRouterKeyIncrementals))
+
+	session, err := xormdb.NewSession()
+	if err != nil {
+		belogs.Error("updateSerialNumberAndRtrRouterKeyFullAndRtrRouterKeyIncrementalDb(): NewSession fail :", err)
+		return err
+	}
+	defer session.Close()
+
+	// serialnumber/rtrrouterkeyfull/rtrrouterkeyincr should in one session
+	err = rtrcommon.InsertSerialNumberDb(session, newSerialNumberModel, start)
+	if err != nil {
+		belogs.Error("updateSerialNumberAndRtrRouterKeyFullAndRtrRouterKeyIncrementalDb():InsertSerialNumberDb fail,newSerialNumberModel:", jsonutil.MarshalJson(newSerialNumberModel), err)
+		return xormdb.RollbackAndLogError(session, "updateSerialNumberAndRtrRouterKeyFullAndRtrRouterKeyIncrementalDb():InsertSerialNumberDb fail:", err)
+	}
+
+	// delete and insert into lab_rpki_rtr_router_key_full
+	_, err = session.Exec(`delete from lab_rpki_rtr_router_key_full`)
+	if err != nil {
+		belogs.Error("updateSerialNumberAndRtrRouterKeyFullAndRtrRouterKeyIncrementalDb():delete lab_rpki_rtr_router_key_full fail:", err)
+		return xormdb.RollbackAndLogError(session, "updateSerialNumberAndRtrRouterKeyFullAndRtrRouterKeyIncrementalDb():delete lab_rpki_rtr_router_key_full fail:", err)
+	}
+	sql := `
+	insert ignore into lab_rpki_rtr_router_key_full 
+		  (serialNumber, asn, ski, routerPublicKey, sourceFrom) 
+	select serialNumber, asn, ski, routerPublicKey, sourceFrom 
+	from lab_rpki_rtr_router_key_full_log where serialNumber=? order by id`
+	_, err = session.Exec(sql, newSerialNumberModel.SerialNumber)
+	if err != nil {
+		belogs.Error("updateSerialNumberAndRtrRouterKeyFullAndRtrRouterKeyIncrementalDb():insert into lab_rpki_rtr_router_key_full from lab_rpki_rtr_router_key_full_log fail: newSerialNumber:",
+			jsonutil.MarshalJson(newSerialNumberModel), err)
+		return xormdb.RollbackAndLogError(session, "updateSerialNumberAndRtrRouterKeyFullAndRtrRouterKeyIncrementalDb():insert into lab_rpki_rtr_router_key_full fail: ", err)
+	}
+
+	sql = `insert ignore into lab_rpki_rtr_router_key_incremental
+		(serialNumber,style,asn,ski,   routerPublicKey,sourceFrom) values
+		(?,?,?,?,  ?,?)`
+	for i := range rtrRouterKeyIncrementals {
+		_, err = session.Exec(sql,
+			newSerialNumberModel.SerialNumber, rtrRouterKeyIncrementals[i].Style, rtrRouterKeyIncrementals[i].Asn, rtrRouterKeyIncrementals[i].Ski,
+			rtrRouterKeyIncrementals[i].RouterPublicKey, rtrRouterKeyIncrementals[i].SourceFrom)
+		if err != nil {
+			belogs.Error("updateSerialNumberAndRtrRouterKeyFullAndRtrRouterKeyIncrementalDb():insert into lab_rpki_rtr_router_key_incremental fail: newSerialNumber:",
+				jsonutil.MarshalJson(newSerialNumberModel), jsonutil.MarshalJson(rtrRouterKeyIncrementals[i]), err)
+			return xormdb.RollbackAndLogError(session, "updateSerialNumberAndRtrRouterKeyFullAndRtrRouterKeyIncrementalDb():insert into lab_rpki_rtr_router_key_incremental fail: ", err)
+		}
+	}
+
+	// commit
+	err = xormdb.CommitSession(session)
+	if err != nil {
+		belogs.Error("updateSerialNumberAndRtrRouterKeyFullAndRtrRouterKeyIncrementalDb(): CommitSession fail :", err)
+		return xormdb.RollbackAndLogError(session, "updateSerialNumberAndRtrRouterKeyFullAndRtrRouterKeyIncrementalDb(): CommitSession fail: ", err)
+	}
+	belogs.Info("updateSerialNumberAndRtrRouterKeyFullAndRtrRouterKeyIncrementalDb(): CommitSession ok: newSerialNumberModel:", jsonutil.MarshalJson(newSerialNumberModel),
+		"   len(rtrRouterKeyIncrementals):", len(rtrRouterKeyIncrementals), "   time(s):", time.Since(start))
+	return nil
+}
@@ -5,7 +5,11 @@ import (
 	"github.com/cpusoft/goutil/conf"
 	"github.com/cpusoft/goutil/ginserver"
 	"github.com/cpusoft/goutil/httpclient"
+	"github.com/cpusoft/goutil/jsonutil"
 	"github.com/gin-gonic/gin"
+	model "rpstir2-model"
+	rtrnotify "rpstir2-rtrproducer/notify"
+	rtrpreview "rpstir2-rtrproducer/preview"
 	rtrslurm "rpstir2-rtrproducer/slurm"
 	rtrsync "rpstir2-rtrproducer/sync"
 )
@@ -19,8 +23,8 @@ func RtrUpdateFromSync(c *gin.Context) {
 		"/sys/servicestate", `{"operate":"enter","state":"rtr"}`, false)
 
 	go func() {
-		nextStep, err := rtrsync.RtrUpdateFromSync()
-		belogs.Debug("RtrUpdateFromSync(): http RtrUpdateFromSync end,  nextStep is :", nextStep, err)
+		nextStep, newSerialNumber, err := rtrsync.RtrUpdateFromSync()
+		belogs.Debug("RtrUpdateFromSync(): http RtrUpdateFromSync end,  nextStep is :", nextStep, "  newSerialNumber:", newSerialNumber, err)
 		// leave serviceState
 		if err != nil {
 			// will end this whole sync
@@ -50,6 +54,9 @@ func RtrUpdateFromSync(c *gin.Context) {
 			go httpclient.Post("https://"+conf.String("rpstir2-vc::serverHost")+":"+conf.String("rpstir2-vc::transferHttpsPort")+
 				path, `{"lastStep":"rtrUpdateFromSync"}`, false)
 
+			// notify webhooks and spool when vrps/aspas are changed
+			go rtrnotify.NotifyRtrChange("sync", newSerialNumber)
+
 			belogs.Info("RtrUpdateFromSync(): http RtrUpdateFromSync end,  nextStep is :", nextStep)
 		}
 
@@ -62,28 +69,155 @@ func RtrUpdateFromSync(c *gin.Context) {
 func RtrUpdateFromSlurm(c *gin.Context) {
 	belogs.Debug("RtrUpdateFromSlurm(): http start")
 
-	err := rtrslurm.RtrUpdateFromSlurm()
-	// leave serviceState
+	// cannot run with sync and its rtr
+	err := enterSlurmServiceState()
+	if err != nil {
+		belogs.Error("RtrUpdateFromSlurm(): http enterSlurmServiceState fail", err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	defer leaveSlurmServiceState()
+
+	newSerialNumber, err := rtrslurm.RtrUpdateFromSlurm()
 	if err != nil {
-		// will end this whole sync
 		belogs.Error("RtrUpdateFromSlurm(): http  rtrUpdateFromSlurm fail", err)
 		ginserver.ResponseFail(c, err, "")
 		return
-	} else {
+	}
+	if newSerialNumber > 0 {
+		publishRtrUpdateBySlurm(newSerialNumber)
+	}
+	belogs.Info("RtrUpdateFromSlurm(): http  rtrUpdateFromSlurm end, newSerialNumber:", newSerialNumber)
+	ginserver.ResponseOk(c, nil)
+}
 
-		belogs.Info("RtrUpdateFromSlurm(): http ok: will call /rtr/server/sendserialnotify, ",
-			" and call /rushtransfer/triggerpushincr")
-		// call serial notify to rtr client
-		go httpclient.Post("https://"+conf.String("rpstir2-vc::serverHost")+":"+conf.String("rpstir2-vc::serverHttpsPort")+
-			"/rtr/server/sendserialnotify", "", false)
+// enter "slurm" of service state, it fails when sync or rtr is running
+func enterSlurmServiceState() (err error) {
+	ssr := model.ServiceState{}
+	err = httpclient.PostAndUnmarshalResponseModel("https://"+conf.String("rpstir2-rp::serverHost")+":"+conf.String("rpstir2-rp::serverHttpsPort")+
+		"/sys/servicestate", `{"operate":"enter","state":"slurm"}`, false, &ssr)
+	if err != nil {
+		belogs.Error("enterSlurmServiceState(): PostAndUnmarshalResponseModel fail:", err)
+		return err
+	}
+	return nil
+}
 
-		// call transfer to push incremental
-		go httpclient.Post("https://"+conf.String("rpstir2-vc::serverHost")+":"+conf.String("rpstir2-vc::transferHttpsPort")+
-			"/rushtransfer/triggerpushincr", `{"lastStep":"rtrUpdateFromSlurm"}`, false)
+func leaveSlurmServiceState() {
+	httpclient.Post("https://"+conf.String("rpstir2-rp::serverHost")+":"+conf.String("rpstir2-rp::serverHttpsPort")+
+		"/sys/servicestate", `{"operate":"leave","state":"slurm"}`, false)
+}
+
+// new serialNumber by slurm is published: call serial notify to rtr client, transfer and notify
+func publishRtrUpdateBySlurm(newSerialNumber uint64) {
+	belogs.Info("publishRtrUpdateBySlurm(): will call /rtr/server/sendserialnotify, ",
+		" and call /rushtransfer/triggerpushincr, newSerialNumber:", newSerialNumber)
+	// call serial notify to rtr client
+	go httpclient.Post("https://"+conf.String("rpstir2-vc::serverHost")+":"+conf.String("rpstir2-vc::serverHttpsPort")+
+		"/rtr/server/sendserialnotify", "", false)
 
-		belogs.Info("RtrUpdateFromSlurm(): http  rtrUpdateFromSlurm end:")
-		ginserver.ResponseOk(c, nil)
+	// call transfer to push incremental
+	go httpclient.Post("https://"+conf.String("rpstir2-vc::serverHost")+":"+conf.String("rpstir2-vc::transferHttpsPort")+
+		"/rushtransfer/triggerpushincr", `{"lastStep":"rtrUpdateFromSlurm"}`, false)
+
+	// notify webhooks and spool when vrps/aspas are changed
+	go rtrnotify.NotifyRtrChange("slurm", newSerialNumber)
+}
+
+// get current(holding) or last preview of new serial
+func RtrPreview(c *gin.Context) {
+	belogs.Debug("RtrPreview(): http start")
+
+	previewResult, err := rtrpreview.GetPreview()
+	if err != nil {
+		belogs.Error("RtrPreview(): http GetPreview fail", err)
+		ginserver.ResponseFail(c, err, "")
 		return
 	}
+	belogs.Debug("RtrPreview(): http previewResult:", jsonutil.MarshalJson(previewResult))
+	ginserver.ResponseOk(c, previewResult)
+}
+
+// approve holding serial, then rtr will be published
+func RtrPreviewApprove(c *gin.Context) {
+	belogs.Info("RtrPreviewApprove(): http start")
+
+	previewDecideRequest := rtrpreview.PreviewDecideRequest{}
+	err := c.ShouldBindJSON(&previewDecideRequest)
+	if err != nil {
+		belogs.Error("RtrPreviewApprove(): ShouldBindJSON fail:", err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	err = rtrpreview.ApprovePreview(previewDecideRequest)
+	if err != nil {
+		belogs.Error("RtrPreviewApprove(): http ApprovePreview fail:", jsonutil.MarshalJson(previewDecideRequest), err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	belogs.Info("RtrPreviewApprove(): http ok, previewDecideRequest:", jsonutil.MarshalJson(previewDecideRequest))
+	ginserver.ResponseOk(c, nil)
+}
 
+// reject holding serial, then previous serial will be kept
+func RtrPreviewReject(c *gin.Context) {
+	belogs.Info("RtrPreviewReject(): http start")
+
+	previewDecideRequest := rtrpreview.PreviewDecideRequest{}
+	err := c.ShouldBindJSON(&previewDecideRequest)
+	if err != nil {
+		belogs.Error("RtrPreviewReject(): ShouldBindJSON fail:", err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	err = rtrpreview.RejectPreview(previewDecideRequest)
+	if err != nil {
+		belogs.Error("RtrPreviewReject(): http RejectPreview fail:", jsonutil.MarshalJson(previewDecideRequest), err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	belogs.Info("RtrPreviewReject(): http ok, previewDecideRequest:", jsonutil.MarshalJson(previewDecideRequest))
+	ginserver.ResponseOk(c, nil)
+}
+
+// release safety brake of holding serial, then rtr will be published
+func RtrBrakeRelease(c *gin.Context) {
+	belogs.Info("RtrBrakeRelease(): http start")
+
+	previewDecideRequest := rtrpreview.PreviewDecideRequest{}
+	err := c.ShouldBindJSON(&previewDecideRequest)
+	if err != nil {
+		belogs.Error("RtrBrakeRelease(): ShouldBindJSON fail:", err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	err = rtrpreview.ReleaseBrake(previewDecideRequest)
+	if err != nil {
+		belogs.Error("RtrBrakeRelease(): http ReleaseBrake fail:", jsonutil.MarshalJson(previewDecideRequest), err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	belogs.Info("RtrBrakeRelease(): http ok, previewDecideRequest:", jsonutil.MarshalJson(previewDecideRequest))
+	ginserver.ResponseOk(c, nil)
+}
+
+// discard holding serial of safety brake, then previous serial will be kept
+func RtrBrakeDiscard(c *gin.Context) {
+	belogs.Info("RtrBrakeDiscard(): http start")
+
+	previewDecideRequest := rtrpreview.PreviewDecideRequest{}
+	err := c.ShouldBindJSON(&previewDecideRequest)
+	if err != nil {
+		belogs.Error("RtrBrakeDiscard(): ShouldBindJSON fail:", err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	err = rtrpreview.DiscardBrake(previewDecideRequest)
+	if err != nil {
+		belogs.Error("RtrBrakeDiscard(): http DiscardBrake fail:", jsonutil.MarshalJson(previewDecideRequest), err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	belogs.Info("RtrBrakeDiscard(): http ok, previewDecideRequest:", jsonutil.MarshalJson(previewDecideRequest))
+	ginserver.ResponseOk(c, nil)
 }
@@ -22,8 +22,8 @@ func TestRtrUpdateFromSync(t *testing.T) {
 	defer xormdb.XormEngine.Close()
 	//xormdb.XormEngine.ShowSQL(true)
 
-	nextStep, err := rtrsync.RtrUpdateFromSync()
-	fmt.Println(nextStep, err)
+	nextStep, newSerialNumber, err := rtrsync.RtrUpdateFromSync()
+	fmt.Println(nextStep, newSerialNumber, err)
 }
 
 func TestRtrUpdateFromSlurm(t *testing.T) {
@@ -37,6 +37,6 @@ func TestRtrUpdateFromSlurm(t *testing.T) {
 	defer xormdb.XormEngine.Close()
 	//xormdb.XormEngine.ShowSQL(true)
 
-	err = rtrslurm.RtrUpdateFromSlurm()
-	fmt.Println(err)
+	newSerialNumber, err := rtrslurm.RtrUpdateFromSlurm()
+	fmt.Println(newSerialNumber, err)
 }
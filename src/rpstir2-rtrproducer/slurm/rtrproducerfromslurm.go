@@ -7,13 +7,15 @@ import (
 	"github.com/cpusoft/goutil/jsonutil"
 	model "rpstir2-model"
 	rtrcommon "rpstir2-rtrproducer/common"
+	rtrrouterkey "rpstir2-rtrproducer/routerkey"
 )
 
 // 1. get all slurm (including had published to rtr)
 // 3. start tx: save new roa to db; filter by all slurm; commit tx
 // 4. send rtr notify to router
 // 5. transfer incr to vc
-func RtrUpdateFromSlurm() (err error) {
+// newSerialNumber is 0 when there is no slurm
+func RtrUpdateFromSlurm() (newSerialNumber uint64, err error) {
 	start := time.Now()
 	belogs.Info("RtrUpdateFromSlurm():start:")
 
@@ -21,7 +23,7 @@ func RtrUpdateFromSlurm() (err error) {
 	prefixSlurmToRtrFullLogs, err := rtrcommon.GetAllSlurmsDb("prefix")
 	if err != nil {
 		belogs.Error("RtrUpdateFromSlurm(): GetAllSlurmsDb prefix fail:", err)
-		return err
+		return 0, err
 	}
 	belogs.Debug("RtrUpdateFromSlurm(): prefixSlurmToRtrFullLogs:", len(prefixSlurmToRtrFullLogs), jsonutil.MarshalJson(prefixSlurmToRtrFullLogs))
 	belogs.Info("RtrUpdateFromSlurm(): len(prefixSlurmToRtrFullLogs):", len(prefixSlurmToRtrFullLogs), "  time(s):", time.Since(start))
@@ -29,21 +31,28 @@ func RtrUpdateFromSlurm() (err error) {
 	asaSlurmToRtrFullLogs, err := rtrcommon.GetAllSlurmsDb("asa")
 	if err != nil {
 		belogs.Error("RtrUpdateFromSlurm(): GetAllSlurmsDb asa fail:", err)
-		return err
+		return 0, err
 	}
 	belogs.Debug("RtrUpdateFromSlurm(): asaSlurmToRtrFullLogs:", len(asaSlurmToRtrFullLogs), jsonutil.MarshalJson(asaSlurmToRtrFullLogs))
 	belogs.Info("RtrUpdateFromSlurm(): len(asaSlurmToRtrFullLogs):", len(asaSlurmToRtrFullLogs), "  time(s):", time.Since(start))
 
-	if len(prefixSlurmToRtrFullLogs) == 0 && len(asaSlurmToRtrFullLogs) == 0 {
-		belogs.Info("RtrUpdateFromSlurm(): prefixSlurmToRtrFullLogs and asaSlurmToRtrFullLogs both are empty, will return 'end' ")
-		return nil
+	routerKeySlurmToRtrFullLogs, err := rtrcommon.GetAllSlurmsDb("routerKey")
+	if err != nil {
+		belogs.Error("RtrUpdateFromSlurm(): GetAllSlurmsDb routerKey fail:", err)
+		return 0, err
+	}
+	belogs.Info("RtrUpdateFromSlurm(): len(routerKeySlurmToRtrFullLogs):", len(routerKeySlurmToRtrFullLogs), "  time(s):", time.Since(start))
+
+	if len(prefixSlurmToRtrFullLogs) == 0 && len(asaSlurmToRtrFullLogs) == 0 && len(routerKeySlurmToRtrFullLogs) == 0 {
+		belogs.Info("RtrUpdateFromSlurm(): prefixSlurmToRtrFullLogs, asaSlurmToRtrFullLogs and routerKeySlurmToRtrFullLogs are all empty, will return 'end' ")
+		return 0, nil
 	}
 
 	// check is top of rushnode
 	rushNodeModel, has, err := selectSelfNodeDb()
 	if err != nil {
 		belogs.Error("RtrUpdateFromSlurm():rushNodeIsTopResult fail:", err)
-		return err
+		return 0, err
 	}
 	belogs.Info("RtrUpdateFromSlurm(): rushNodeModel:", jsonutil.MarshalJson(rushNodeModel), " has:", has)
 	isTop := "false"
@@ -55,7 +64,7 @@ func RtrUpdateFromSlurm() (err error) {
 	curSerialNumberModel, err := rtrcommon.GetSerialNumberDb()
 	if err != nil {
 		belogs.Error("RtrUpdateFromSlurm(): GetSerialNumberDb fail:", err)
-		return err
+		return 0, err
 	}
 	newSerialNumberModel := &rtrcommon.SerialNumberModel{}
 	if isTop == "true" {
@@ -78,11 +87,24 @@ func RtrUpdateFromSlurm() (err error) {
 		newSerialNumberModel, prefixSlurmToRtrFullLogs, asaSlurmToRtrFullLogs)
 	if err != nil {
 		belogs.Error("RtrUpdateFromSlurm():updateRtrFullAndFullLogAndIncrementalFromSlurm fail:", err)
-		return err
+		return 0, err
+	}
+
+	// router key uses the same new serialNumber, which has been saved
+	err = rtrrouterkey.RtrUpdateRouterKey(curSerialNumberModel, newSerialNumberModel, nil)
+	if err != nil {
+		belogs.Error("RtrUpdateFromSlurm():RtrUpdateRouterKey fail:", err)
+		return 0, err
+	}
+	// only full log of checkpoint and new serialNumber are kept
+	err = rtrcommon.CompactRtrFullLogDb(curSerialNumberModel.SerialNumber)
+	if err != nil {
+		belogs.Error("RtrUpdateFromSlurm(): CompactRtrFullLogDb fail, curSerialNumber:", curSerialNumberModel.SerialNumber, err)
+		// no return
 	}
 	belogs.Info("RtrUpdateFromSlurm(): end, new SerialNumber:", newSerialNumberModel.GlobalSerialNumber,
 		"  time(s):", time.Since(start))
-	return nil
+	return newSerialNumberModel.SerialNumber, nil
 }
 
 func updateRtrFullAndFullLogAndIncrementalFromSlurm(curSerialNumberModel, newSerialNumberModel *rtrcommon.SerialNumberModel,
@@ -0,0 +1,211 @@
+package slurm
+
+import (
+	"errors"
+	"net/netip"
+	"time"
+
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/convert"
+	"github.com/cpusoft/goutil/hashutil"
+	"github.com/cpusoft/goutil/jsonutil"
+	"github.com/guregu/null"
+	model "rpstir2-model"
+)
+
+// validate and save slurm files as one slurm log, it will be active after ActivateSlurm
+func UploadSlurmFiles(slurmUploadFiles []SlurmUploadFile, note string) (slurmUploadResult SlurmUploadResult, err error) {
+	start := time.Now()
+	belogs.Info("UploadSlurmFiles(): len(slurmUploadFiles):", len(slurmUploadFiles), "  note:", note)
+	if len(slurmUploadFiles) == 0 {
+		return slurmUploadResult, errors.New("there is no slurm file")
+	}
+
+	slurmFiles, slurmValidateResults, valid := validateSlurmFiles(slurmUploadFiles)
+	slurmUploadResult.SlurmValidateResult = slurmValidateResults
+	if !valid {
+		belogs.Error("UploadSlurmFiles(): validateSlurmFiles fail:", jsonutil.MarshalJson(slurmValidateResults))
+		return slurmUploadResult, errors.New("slurm files are invalid")
+	}
+
+	labRpkiSlurmLog := model.LabRpkiSlurmLog{
+		State:      SLURM_LOG_STATE_UPLOADED,
+		UploadTime: time.Now(),
+		Note:       note,
+	}
+	labRpkiSlurmLogFiles := make([]model.LabRpkiSlurmLogFile, 0, len(slurmFiles))
+	for i := range slurmFiles {
+		labRpkiSlurmLogFiles = append(labRpkiSlurmLogFiles, model.LabRpkiSlurmLogFile{
+			FileName:     slurmFiles[i].fileName,
+			FileHash:     hashutil.Sha256(slurmFiles[i].content),
+			SlurmVersion: uint64(slurmFiles[i].slurm.SlurmVersion),
+			JsonAll:      string(slurmFiles[i].content),
+		})
+	}
+	slurmLogId, err := insertSlurmLogDb(&labRpkiSlurmLog, labRpkiSlurmLogFiles)
+	if err != nil {
+		belogs.Error("UploadSlurmFiles(): insertSlurmLogDb fail:", err)
+		return slurmUploadResult, err
+	}
+	slurmUploadResult.SlurmLogId = slurmLogId
+	belogs.Info("UploadSlurmFiles(): slurmLogId:", slurmLogId, "  time(s):", time.Since(start))
+	return slurmUploadResult, nil
+}
+
+// insert into lab_rpki_slurm and save as a new revision, caller should update rtr to get new serial
+func ActivateSlurm(slurmLogId uint64, author, comment string) (err error) {
+	start := time.Now()
+	belogs.Info("ActivateSlurm(): slurmLogId:", slurmLogId, "  author:", author)
+
+	labRpkiSlurmLog, has, err := getSlurmLogDb(slurmLogId)
+	if err != nil {
+		belogs.Error("ActivateSlurm(): getSlurmLogDb fail, slurmLogId:", slurmLogId, err)
+		return err
+	}
+	if !has {
+		return errors.New("slurmLogId " + convert.ToString(slurmLogId) + " does not exist")
+	}
+	if labRpkiSlurmLog.State == SLURM_LOG_STATE_ACTIVE {
+		return errors.New("slurmLogId " + convert.ToString(slurmLogId) + " is already active")
+	}
+
+	// check overlap with other active slurms
+	labRpkiSlurmLogFiles, err := getSlurmLogFilesDb(slurmLogId, false)
+	if err != nil {
+		belogs.Error("ActivateSlurm(): getSlurmLogFilesDb fail, slurmLogId:", slurmLogId, err)
+		return err
+	}
+	activeSlurmLogFiles, err := getSlurmLogFilesDb(0, true)
+	if err != nil {
+		belogs.Error("ActivateSlurm(): getSlurmLogFilesDb active fail:", err)
+		return err
+	}
+	slurmFiles := make([]slurmFile, 0, len(labRpkiSlurmLogFiles)+len(activeSlurmLogFiles))
+	for _, labRpkiSlurmLogFile := range append(activeSlurmLogFiles, labRpkiSlurmLogFiles...) {
+		slurm, slurmValidateResult := ValidateSlurmFile(labRpkiSlurmLogFile.FileName, []byte(labRpkiSlurmLogFile.JsonAll))
+		if len(slurmValidateResult.Errors) > 0 {
+			belogs.Error("ActivateSlurm(): ValidateSlurmFile fail, labRpkiSlurmLogFile.Id:", labRpkiSlurmLogFile.Id, slurmValidateResult.Errors)
+			return errors.New("slurm file " + labRpkiSlurmLogFile.FileName + " is invalid")
+		}
+		slurmFiles = append(slurmFiles, slurmFile{
+			fileName: labRpkiSlurmLogFile.FileName + "(slurmLogId:" + convert.ToString(labRpkiSlurmLogFile.SlurmLogId) + ")",
+			content:  []byte(labRpkiSlurmLogFile.JsonAll),
+			slurm:    slurm,
+		})
+	}
+	overlaps := checkSlurmOverlap(slurmFiles)
+	if len(overlaps) > 0 {
+		belogs.Error("ActivateSlurm(): checkSlurmOverlap fail, slurmLogId:", slurmLogId, jsonutil.MarshalJson(overlaps))
+		return errors.New(overlaps[0].fileName + ": " + overlaps[0].err)
+	}
+
+	slurmRows := make(map[uint64][]slurmRow, len(labRpkiSlurmLogFiles))
+	for i, labRpkiSlurmLogFile := range labRpkiSlurmLogFiles {
+		slurmRows[labRpkiSlurmLogFile.Id] = convertSlurmToRows(slurmFiles[len(activeSlurmLogFiles)+i].slurm)
+	}
+	err = activateSlurmDb(slurmLogId, slurmRows, author, comment)
+	if err != nil {
+		belogs.Error("ActivateSlurm(): activateSlurmDb fail, slurmLogId:", slurmLogId, err)
+		return err
+	}
+	belogs.Info("ActivateSlurm(): slurmLogId:", slurmLogId, "  time(s):", time.Since(start))
+	return nil
+}
+
+// delete from lab_rpki_slurm and save as a new revision, caller should update rtr to get new serial
+func DeactivateSlurm(slurmLogId uint64, author, comment string) (err error) {
+	start := time.Now()
+	belogs.Info("DeactivateSlurm(): slurmLogId:", slurmLogId, "  author:", author)
+
+	labRpkiSlurmLog, has, err := getSlurmLogDb(slurmLogId)
+	if err != nil {
+		belogs.Error("DeactivateSlurm(): getSlurmLogDb fail, slurmLogId:", slurmLogId, err)
+		return err
+	}
+	if !has || labRpkiSlurmLog.State != SLURM_LOG_STATE_ACTIVE {
+		return errors.New("slurmLogId " + convert.ToString(slurmLogId) + " is not active")
+	}
+	err = deactivateSlurmDb(slurmLogId, author, comment)
+	if err != nil {
+		belogs.Error("DeactivateSlurm(): deactivateSlurmDb fail, slurmLogId:", slurmLogId, err)
+		return err
+	}
+	belogs.Info("DeactivateSlurm(): slurmLogId:", slurmLogId, "  time(s):", time.Since(start))
+	return nil
+}
+
+// all uploaded slurms, latest first
+func GetSlurmLogs() (slurmLogModels []SlurmLogModel, err error) {
+	slurmLogModels, err = getSlurmLogsDb()
+	if err != nil {
+		belogs.Error("GetSlurmLogs(): getSlurmLogsDb fail:", err)
+		return nil, err
+	}
+	belogs.Debug("GetSlurmLogs(): len(slurmLogModels):", len(slurmLogModels))
+	return slurmLogModels, nil
+}
+
+// styles are the same as GetAllSlurmsDb, aspa is one row for every provider
+func convertSlurmToRows(slurm *model.Slurm) (slurmRows []slurmRow) {
+	slurmRows = make([]slurmRow, 0)
+	for _, f := range slurm.ValidationOutputFilters.PrefixFilters {
+		slurmRows = append(slurmRows, slurmRow{Style: "prefixFilters", Asn: f.Asn,
+			AddressPrefix: formatSlurmPrefix(f.Prefix), MaxLength: formatSlurmMaxLength(f.MaxPrefixLength),
+			Comment: f.Comment, TreatLevel: f.TreatLevel})
+	}
+	for _, a := range slurm.LocallyAddedAssertions.PrefixAssertions {
+		slurmRows = append(slurmRows, slurmRow{Style: "prefixAssertions", Asn: a.Asn,
+			AddressPrefix: formatSlurmPrefix(a.Prefix), MaxLength: formatSlurmMaxLength(a.MaxPrefixLength),
+			Comment: a.Comment, TreatLevel: a.TreatLevel})
+	}
+	for _, f := range slurm.ValidationOutputFilters.BgpsecFilters {
+		slurmRows = append(slurmRows, slurmRow{Style: "bgpsecFilters", Asn: f.Asn,
+			Ski: null.NewString(f.SKI, len(f.SKI) > 0), Comment: f.Comment})
+	}
+	for _, a := range slurm.LocallyAddedAssertions.BgpsecAssertions {
+		slurmRows = append(slurmRows, slurmRow{Style: "bgpsecAssertions", Asn: a.Asn,
+			Ski: null.StringFrom(a.SKI), RouterPublicKey: null.StringFrom(a.RouterPublicKey), Comment: a.Comment})
+	}
+	for _, f := range slurm.ValidationOutputFilters.AspaFilters {
+		slurmRows = append(slurmRows, convertAspaToRows("aspaFilters", f.CustomerAsn, f.ProviderAsns, f.Comment)...)
+	}
+	for _, a := range slurm.LocallyAddedAssertions.AspaAssertions {
+		slurmRows = append(slurmRows, convertAspaToRows("aspaAssertions", a.CustomerAsn, a.ProviderAsns, a.Comment)...)
+	}
+	for i := range slurmRows {
+		slurmRows[i].Version = slurm.SlurmVersion
+	}
+	return slurmRows
+}
+
+// aspaFilters without providers filter all of the customerAsn
+func convertAspaToRows(style string, customerAsn null.Int, providerAsns []model.ProviderAsns, comment string) (slurmRows []slurmRow) {
+	if len(providerAsns) == 0 {
+		return []slurmRow{{Style: style, CustomerAsn: customerAsn, Comment: comment}}
+	}
+	slurmRows = make([]slurmRow, 0, len(providerAsns))
+	for _, p := range providerAsns {
+		slurmRows = append(slurmRows, slurmRow{Style: style, CustomerAsn: customerAsn, ProviderAsn: p.ProviderAsn,
+			AddressFamily: null.StringFrom(p.AddressFamily), Comment: comment})
+	}
+	return slurmRows
+}
+
+// canonical prefix, GetAllSlurmsDb splits it by '/'
+func formatSlurmPrefix(prefix string) null.String {
+	if len(prefix) == 0 {
+		return null.String{}
+	}
+	p, err := netip.ParsePrefix(prefix)
+	if err != nil {
+		return null.StringFrom(prefix)
+	}
+	return null.StringFrom(p.Masked().String())
+}
+
+func formatSlurmMaxLength(maxPrefixLength uint64) null.Int {
+	if maxPrefixLength == 0 {
+		return null.Int{}
+	}
+	return null.IntFrom(int64(maxPrefixLength))
+}
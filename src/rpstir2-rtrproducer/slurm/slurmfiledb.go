@@ -0,0 +1,232 @@
+package slurm
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/convert"
+	"github.com/cpusoft/goutil/jsonutil"
+	"github.com/cpusoft/goutil/xormdb"
+	"github.com/guregu/null"
+	model "rpstir2-model"
+	"xorm.io/xorm"
+)
+
+func insertSlurmLogDb(labRpkiSlurmLog *model.LabRpkiSlurmLog, labRpkiSlurmLogFiles []model.LabRpkiSlurmLogFile) (slurmLogId uint64, err error) {
+	start := time.Now()
+	session, err := xormdb.NewSession()
+	if err != nil {
+		belogs.Error("insertSlurmLogDb(): NewSession fail :", err)
+		return 0, err
+	}
+	defer session.Close()
+
+	_, err = session.Table("lab_rpki_slurm_log").Insert(labRpkiSlurmLog)
+	if err != nil {
+		belogs.Error("insertSlurmLogDb(): insert lab_rpki_slurm_log fail:", jsonutil.MarshalJson(labRpkiSlurmLog), err)
+		return 0, xormdb.RollbackAndLogError(session, "insertSlurmLogDb(): insert lab_rpki_slurm_log fail: ", err)
+	}
+	for i := range labRpkiSlurmLogFiles {
+		labRpkiSlurmLogFiles[i].SlurmLogId = labRpkiSlurmLog.Id
+		_, err = session.Table("lab_rpki_slurm_log_file").Insert(&labRpkiSlurmLogFiles[i])
+		if err != nil {
+			belogs.Error("insertSlurmLogDb(): insert lab_rpki_slurm_log_file fail, fileName:", labRpkiSlurmLogFiles[i].FileName, err)
+			return 0, xormdb.RollbackAndLogError(session, "insertSlurmLogDb(): insert lab_rpki_slurm_log_file fail: ", err)
+		}
+	}
+	err = xormdb.CommitSession(session)
+	if err != nil {
+		belogs.Error("insertSlurmLogDb(): CommitSession fail :", err)
+		return 0, xormdb.RollbackAndLogError(session, "insertSlurmLogDb(): CommitSession fail: ", err)
+	}
+	belogs.Info("insertSlurmLogDb(): CommitSession ok, slurmLogId:", labRpkiSlurmLog.Id,
+		"  len(labRpkiSlurmLogFiles):", len(labRpkiSlurmLogFiles), "  time(s):", time.Since(start))
+	return labRpkiSlurmLog.Id, nil
+}
+
+func getSlurmLogDb(slurmLogId uint64) (labRpkiSlurmLog model.LabRpkiSlurmLog, has bool, err error) {
+	sql := `select id, state, uploadTime, activateTime, deactivateTime, note from lab_rpki_slurm_log where id = ? `
+	has, err = xormdb.XormEngine.SQL(sql, slurmLogId).Get(&labRpkiSlurmLog)
+	if err != nil {
+		belogs.Error("getSlurmLogDb(): select lab_rpki_slurm_log fail, slurmLogId:", slurmLogId, err)
+		return labRpkiSlurmLog, false, err
+	}
+	belogs.Debug("getSlurmLogDb(): labRpkiSlurmLog:", jsonutil.MarshalJson(labRpkiSlurmLog), "  has:", has)
+	return labRpkiSlurmLog, has, nil
+}
+
+// files of slurmLogId, or files of all active slurm logs
+func getSlurmLogFilesDb(slurmLogId uint64, active bool) (labRpkiSlurmLogFiles []model.LabRpkiSlurmLogFile, err error) {
+	labRpkiSlurmLogFiles = make([]model.LabRpkiSlurmLogFile, 0)
+	if active {
+		sql := `select f.id, f.slurmLogId, f.fileName, f.fileHash, f.slurmVersion, f.jsonAll
+			from lab_rpki_slurm_log_file f, lab_rpki_slurm_log l
+			where f.slurmLogId = l.id and l.state = ? order by f.id `
+		err = xormdb.XormEngine.SQL(sql, SLURM_LOG_STATE_ACTIVE).Find(&labRpkiSlurmLogFiles)
+	} else {
+		sql := `select id, slurmLogId, fileName, fileHash, slurmVersion, jsonAll
+			from lab_rpki_slurm_log_file where slurmLogId = ? order by id `
+		err = xormdb.XormEngine.SQL(sql, slurmLogId).Find(&labRpkiSlurmLogFiles)
+	}
+	if err != nil {
+		belogs.Error("getSlurmLogFilesDb(): select lab_rpki_slurm_log_file fail, slurmLogId:", slurmLogId, "  active:", active, err)
+		return nil, err
+	}
+	belogs.Debug("getSlurmLogFilesDb(): slurmLogId:", slurmLogId, "  active:", active, "  len(labRpkiSlurmLogFiles):", len(labRpkiSlurmLogFiles))
+	return labRpkiSlurmLogFiles, nil
+}
+
+// slurmRows: map[slurmLogFileId][]slurmRow
+func activateSlurmDb(slurmLogId uint64, slurmRows map[uint64][]slurmRow, author, comment string) (err error) {
+	start := time.Now()
+	session, err := xormdb.NewSession()
+	if err != nil {
+		belogs.Error("activateSlurmDb(): NewSession fail :", err)
+		return err
+	}
+	defer session.Close()
+
+	// state check in the same tx, avoid activating twice
+	sql := `update lab_rpki_slurm_log set state = ?, activateTime = ? where id = ? and state != ? `
+	affected, err := session.Exec(sql, SLURM_LOG_STATE_ACTIVE, start, slurmLogId, SLURM_LOG_STATE_ACTIVE)
+	if err != nil {
+		belogs.Error("activateSlurmDb(): update lab_rpki_slurm_log fail, slurmLogId:", slurmLogId, err)
+		return xormdb.RollbackAndLogError(session, "activateSlurmDb(): update lab_rpki_slurm_log fail: ", err)
+	}
+	if rows, _ := affected.RowsAffected(); rows == 0 {
+		return xormdb.RollbackAndLogError(session, "activateSlurmDb(): update lab_rpki_slurm_log fail: ",
+			errors.New("slurmLogId "+convert.ToString(slurmLogId)+" is already active"))
+	}
+
+	count, err := insertSlurmRowsDb(session, slurmLogId, slurmRows)
+	if err != nil {
+		belogs.Error("activateSlurmDb(): insertSlurmRowsDb fail, slurmLogId:", slurmLogId, err)
+		return xormdb.RollbackAndLogError(session, "activateSlurmDb(): insertSlurmRowsDb fail: ", err)
+	}
+	err = insertSlurmRevisionDb(session, SLURM_REVISION_ACTION_ACTIVATE, null.IntFrom(int64(slurmLogId)), null.Int{},
+		author, comment, start)
+	if err != nil {
+		belogs.Error("activateSlurmDb(): insertSlurmRevisionDb fail, slurmLogId:", slurmLogId, err)
+		return xormdb.RollbackAndLogError(session, "activateSlurmDb(): insertSlurmRevisionDb fail: ", err)
+	}
+	err = xormdb.CommitSession(session)
+	if err != nil {
+		belogs.Error("activateSlurmDb(): CommitSession fail :", err)
+		return xormdb.RollbackAndLogError(session, "activateSlurmDb(): CommitSession fail: ", err)
+	}
+	belogs.Info("activateSlurmDb(): CommitSession ok, slurmLogId:", slurmLogId, "  count:", count, "  time(s):", time.Since(start))
+	return nil
+}
+
+func deactivateSlurmDb(slurmLogId uint64, author, comment string) (err error) {
+	start := time.Now()
+	session, err := xormdb.NewSession()
+	if err != nil {
+		belogs.Error("deactivateSlurmDb(): NewSession fail :", err)
+		return err
+	}
+	defer session.Close()
+
+	affected, err := session.Exec(`delete from lab_rpki_slurm where slurmLogId = ? `, slurmLogId)
+	if err != nil {
+		belogs.Error("deactivateSlurmDb(): delete lab_rpki_slurm fail, slurmLogId:", slurmLogId, err)
+		return xormdb.RollbackAndLogError(session, "deactivateSlurmDb(): delete lab_rpki_slurm fail: ", err)
+	}
+	_, err = session.Exec(`update lab_rpki_slurm_log set state = ?, deactivateTime = ? where id = ? `,
+		SLURM_LOG_STATE_INACTIVE, start, slurmLogId)
+	if err != nil {
+		belogs.Error("deactivateSlurmDb(): update lab_rpki_slurm_log fail, slurmLogId:", slurmLogId, err)
+		return xormdb.RollbackAndLogError(session, "deactivateSlurmDb(): update lab_rpki_slurm_log fail: ", err)
+	}
+	err = insertSlurmRevisionDb(session, SLURM_REVISION_ACTION_DEACTIVATE, null.IntFrom(int64(slurmLogId)), null.Int{},
+		author, comment, start)
+	if err != nil {
+		belogs.Error("deactivateSlurmDb(): insertSlurmRevisionDb fail, slurmLogId:", slurmLogId, err)
+		return xormdb.RollbackAndLogError(session, "deactivateSlurmDb(): insertSlurmRevisionDb fail: ", err)
+	}
+	err = xormdb.CommitSession(session)
+	if err != nil {
+		belogs.Error("deactivateSlurmDb(): CommitSession fail :", err)
+		return xormdb.RollbackAndLogError(session, "deactivateSlurmDb(): CommitSession fail: ", err)
+	}
+	rows, _ := affected.RowsAffected()
+	belogs.Info("deactivateSlurmDb(): CommitSession ok, slurmLogId:", slurmLogId, "  delete rows:", rows, "  time(s):", time.Since(start))
+	return nil
+}
+
+// slurmRows: map[slurmLogFileId][]slurmRow
+func insertSlurmRowsDb(session *xorm.Session, slurmLogId uint64, slurmRows map[uint64][]slurmRow) (count int, err error) {
+	sql := `insert into lab_rpki_slurm
+		(version, style, asn, addressPrefix, maxLength,
+		 ski, routerPublicKey, customerAsn, providerAsn, addressFamily,
+		 comment, treatLevel, slurmLogId, slurmLogFileId, state) values
+		(?,?,?,?,?,  ?,?,?,?,?,  ?,?,?,?,?)`
+	state := `{"rtr":"notYet"}`
+	for slurmLogFileId, rows := range slurmRows {
+		for i := range rows {
+			_, err = session.Exec(sql,
+				rows[i].Version, rows[i].Style, rows[i].Asn, rows[i].AddressPrefix, rows[i].MaxLength,
+				rows[i].Ski, rows[i].RouterPublicKey, rows[i].CustomerAsn, rows[i].ProviderAsn, rows[i].AddressFamily,
+				rows[i].Comment, rows[i].TreatLevel, slurmLogId, slurmLogFileId, state)
+			if err != nil {
+				belogs.Error("insertSlurmRowsDb(): insert lab_rpki_slurm fail, slurmLogId:", slurmLogId,
+					"  slurmLogFileId:", slurmLogFileId, jsonutil.MarshalJson(rows[i]), err)
+				return 0, err
+			}
+			count++
+		}
+	}
+	return count, nil
+}
+
+func getSlurmLogsDb() (slurmLogModels []SlurmLogModel, err error) {
+	labRpkiSlurmLogs := make([]model.LabRpkiSlurmLog, 0)
+	sql := `select id, state, uploadTime, activateTime, deactivateTime, note from lab_rpki_slurm_log order by id desc `
+	err = xormdb.XormEngine.SQL(sql).Find(&labRpkiSlurmLogs)
+	if err != nil {
+		belogs.Error("getSlurmLogsDb(): select lab_rpki_slurm_log fail:", err)
+		return nil, err
+	}
+
+	// not include jsonAll
+	labRpkiSlurmLogFiles := make([]model.LabRpkiSlurmLogFile, 0)
+	sql = `select id, slurmLogId, fileName, fileHash, slurmVersion from lab_rpki_slurm_log_file order by id `
+	err = xormdb.XormEngine.SQL(sql).Find(&labRpkiSlurmLogFiles)
+	if err != nil {
+		belogs.Error("getSlurmLogsDb(): select lab_rpki_slurm_log_file fail:", err)
+		return nil, err
+	}
+
+	type slurmCount struct {
+		SlurmLogId uint64 `xorm:"slurmLogId int"`
+		Count      uint64 `xorm:"count int"`
+	}
+	slurmCounts := make([]slurmCount, 0)
+	sql = `select slurmLogId, count(*) as count from lab_rpki_slurm group by slurmLogId `
+	err = xormdb.XormEngine.SQL(sql).Find(&slurmCounts)
+	if err != nil {
+		belogs.Error("getSlurmLogsDb(): select count from lab_rpki_slurm fail:", err)
+		return nil, err
+	}
+
+	slurmLogModels = make([]SlurmLogModel, 0, len(labRpkiSlurmLogs))
+	for i := range labRpkiSlurmLogs {
+		slurmLogModel := SlurmLogModel{
+			LabRpkiSlurmLog: labRpkiSlurmLogs[i],
+			SlurmLogFiles:   make([]model.LabRpkiSlurmLogFile, 0),
+		}
+		for j := range labRpkiSlurmLogFiles {
+			if labRpkiSlurmLogFiles[j].SlurmLogId == labRpkiSlurmLogs[i].Id {
+				slurmLogModel.SlurmLogFiles = append(slurmLogModel.SlurmLogFiles, labRpkiSlurmLogFiles[j])
+			}
+		}
+		for j := range slurmCounts {
+			if slurmCounts[j].SlurmLogId == labRpkiSlurmLogs[i].Id {
+				slurmLogModel.SlurmCount = slurmCounts[j].Count
+			}
+		}
+		slurmLogModels = append(slurmLogModels, slurmLogModel)
+	}
+	return slurmLogModels, nil
+}
@@ -0,0 +1,184 @@
+package slurm
+
+import (
+	"github.com/guregu/null"
+	model "rpstir2-model"
+)
+
+// state of lab_rpki_slurm_log
+const (
+	SLURM_LOG_STATE_UPLOADED = "uploaded"
+	SLURM_LOG_STATE_ACTIVE   = "active"
+	SLURM_LOG_STATE_INACTIVE = "inactive"
+)
+
+// slurmVersion 1 is rfc8416, slurmVersion 2 adds aspaFilters/aspaAssertions
+const (
+	SLURM_VERSION_1 = 1
+	SLURM_VERSION_2 = 2
+)
+
+// result of validating one slurm file, the file is valid only when Errors is empty
+type SlurmValidateResult struct {
+	FileName             string   `json:"fileName"`
+	SlurmVersion         int      `json:"slurmVersion"`
+	PrefixFilterCount    int      `json:"prefixFilterCount"`
+	BgpsecFilterCount    int      `json:"bgpsecFilterCount"`
+	AspaFilterCount      int      `json:"aspaFilterCount"`
+	PrefixAssertionCount int      `json:"prefixAssertionCount"`
+	BgpsecAssertionCount int      `json:"bgpsecAssertionCount"`
+	AspaAssertionCount   int      `json:"aspaAssertionCount"`
+	Errors               []string `json:"errors"`
+}
+
+type SlurmUploadResult struct {
+	SlurmLogId          uint64                `json:"slurmLogId"`
+	SlurmValidateResult []SlurmValidateResult `json:"slurmValidateResult"`
+}
+
+// action of lab_rpki_slurm_revision
+const (
+	SLURM_REVISION_ACTION_ACTIVATE   = "activate"
+	SLURM_REVISION_ACTION_DEACTIVATE = "deactivate"
+	SLURM_REVISION_ACTION_ROLLBACK   = "rollback"
+)
+
+// activate/deactivate, author and comment are saved in revision
+type SlurmLogRequest struct {
+	SlurmLogId uint64 `json:"slurmLogId"`
+	Author     string `json:"author"`
+	Comment    string `json:"comment"`
+}
+
+// rollback to revisionId, as a new revision
+type SlurmRollbackRequest struct {
+	RevisionId uint64 `json:"revisionId"`
+	Author     string `json:"author"`
+	Comment    string `json:"comment"`
+}
+
+type SlurmRevisionDiffRequest struct {
+	FromRevisionId uint64 `json:"fromRevisionId"`
+	ToRevisionId   uint64 `json:"toRevisionId"`
+}
+
+// one row in lab_rpki_slurm, saved in lab_rpki_slurm_revision.entries
+type SlurmRevisionEntry struct {
+	Style           string      `json:"style" xorm:"style varchar(128)"`
+	Asn             null.Int    `json:"asn" xorm:"asn int"`
+	AddressPrefix   null.String `json:"addressPrefix" xorm:"addressPrefix varchar(512)"`
+	MaxLength       null.Int    `json:"maxLength" xorm:"maxLength int"`
+	Ski             null.String `json:"ski" xorm:"ski varchar(256)"`
+	RouterPublicKey null.String `json:"routerPublicKey" xorm:"routerPublicKey varchar(256)"`
+	CustomerAsn     null.Int    `json:"customerAsn" xorm:"customerAsn int"`
+	ProviderAsn     null.Int    `json:"providerAsn" xorm:"providerAsn int"`
+	AddressFamily   null.String `json:"addressFamily" xorm:"addressFamily varchar(16)"`
+	Comment         string      `json:"comment" xorm:"comment varchar(256)"`
+	SlurmLogId      uint64      `json:"slurmLogId" xorm:"slurmLogId int"`
+}
+
+// revision without entries
+type SlurmRevisionModel struct {
+	model.LabRpkiSlurmRevision `xorm:"extends"`
+	EntryCount                 uint64 `json:"entryCount" xorm:"entryCount int"`
+}
+
+type SlurmVrp struct {
+	Asn          uint64 `json:"asn" xorm:"asn bigint"`
+	Address      string `json:"address" xorm:"address varchar(512)"`
+	PrefixLength uint64 `json:"prefixLength" xorm:"prefixLength int"`
+	MaxLength    uint64 `json:"maxLength" xorm:"maxLength int"`
+}
+
+// entries and vrps of toRevisionId compared with fromRevisionId
+type SlurmRevisionDiff struct {
+	FromRevisionId uint64               `json:"fromRevisionId"`
+	ToRevisionId   uint64               `json:"toRevisionId"`
+	AddedEntries   []SlurmRevisionEntry `json:"addedEntries"`
+	RemovedEntries []SlurmRevisionEntry `json:"removedEntries"`
+	AnnounceVrps   []SlurmVrp           `json:"announceVrps"`
+	WithdrawVrps   []SlurmVrp           `json:"withdrawVrps"`
+}
+
+// one entry of candidate slurm which has problem, entry is empty when the problem is of the whole file
+type SlurmLintEntry struct {
+	FileName          string              `json:"fileName"`
+	Entry             *SlurmRevisionEntry `json:"entry,omitempty"`
+	Reason            string              `json:"reason"`
+	InvalidatedRoutes []SlurmLintRoute    `json:"invalidatedRoutes,omitempty"`
+}
+
+// route in reference rib(rtr::previewMrtFile or rtr::previewPrefixFile)
+type SlurmLintRoute struct {
+	Prefix    string `json:"prefix"`
+	OriginAsn uint32 `json:"originAsn"`
+	OldState  string `json:"oldState"`
+	NewReason string `json:"newReason"`
+}
+
+// dry run of candidate slurm together with active slurms, nothing is saved
+type SlurmLintResult struct {
+	SlurmValidateResult []SlurmValidateResult `json:"slurmValidateResult"`
+	// filters which match no vrp/aspa from roa/asa
+	UnmatchedFilters []SlurmLintEntry `json:"unmatchedFilters"`
+	// assertions which are already covered by vrp/aspa from roa/asa
+	CoveredAssertions []SlurmLintEntry `json:"coveredAssertions"`
+	// assertions which make routes in reference rib invalid
+	InvalidatingAssertions []SlurmLintEntry `json:"invalidatingAssertions"`
+	// overlapping with active slurms, duplicated or contradictory entries
+	Conflicts []SlurmLintEntry `json:"conflicts"`
+
+	ReferenceFile       string `json:"referenceFile"`
+	ReferenceRouteCount uint64 `json:"referenceRouteCount"`
+
+	CurVrpCount     uint64 `json:"curVrpCount"`
+	NewVrpCount     uint64 `json:"newVrpCount"`
+	VrpCountChange  int64  `json:"vrpCountChange"`
+	CurAspaCount    uint64 `json:"curAspaCount"`
+	NewAspaCount    uint64 `json:"newAspaCount"`
+	AspaCountChange int64  `json:"aspaCountChange"`
+}
+
+// one row in lab_rpki_rtr_asa_full, addressFamily is 0(ipv4) or 1(ipv6)
+type SlurmAspa struct {
+	CustomerAsn   uint64 `json:"customerAsn" xorm:"customerAsn int"`
+	ProviderAsn   uint64 `json:"providerAsn" xorm:"providerAsn int"`
+	AddressFamily uint64 `json:"addressFamily" xorm:"addressFamily int"`
+}
+
+// one uploaded slurm, files do not include jsonAll
+type SlurmLogModel struct {
+	model.LabRpkiSlurmLog
+	SlurmLogFiles []model.LabRpkiSlurmLogFile `json:"slurmLogFiles"`
+	// rows in lab_rpki_slurm, only active slurm has rows
+	SlurmCount uint64 `json:"slurmCount"`
+}
+
+// one slurm file which has been validated
+type slurmFile struct {
+	fileName string
+	content  []byte
+	slurm    *model.Slurm
+}
+
+// uploaded by multipart
+type SlurmUploadFile struct {
+	FileName string
+	Content  []byte
+}
+
+// one row in lab_rpki_slurm
+type slurmRow struct {
+	Version         int
+	Style           string
+	Asn             null.Int
+	AddressPrefix   null.String
+	MaxLength       null.Int
+	Ski             null.String
+	RouterPublicKey null.String
+	CustomerAsn     null.Int
+	ProviderAsn     null.Int
+	AddressFamily   null.String
+	Comment         string
+	TreatLevel      string
+}
@@ -0,0 +1,473 @@
+package slurm
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/convert"
+	"github.com/cpusoft/goutil/jsonutil"
+	"github.com/guregu/null"
+	"rpstir2-rov/validate"
+	rtrcommon "rpstir2-rtrproducer/common"
+	rtrpreview "rpstir2-rtrproducer/preview"
+)
+
+// at most 1000 invalidated routes of one assertion are in result, others are not listed
+const maxSlurmLintRoutes = 1000
+
+// one entry of candidate slurm files
+type slurmLintCandidate struct {
+	fileName string
+	entry    SlurmRevisionEntry
+}
+
+// dry run: candidate slurm files are checked together with active slurms against vrps/aspas from roa/asa,
+// nothing is saved to lab_rpki_slurm
+func LintSlurmFiles(slurmUploadFiles []SlurmUploadFile) (slurmLintResult SlurmLintResult, err error) {
+	start := time.Now()
+	belogs.Info("LintSlurmFiles(): len(slurmUploadFiles):", len(slurmUploadFiles))
+	if len(slurmUploadFiles) == 0 {
+		return slurmLintResult, errors.New("there is no slurm file")
+	}
+	slurmLintResult.UnmatchedFilters = make([]SlurmLintEntry, 0)
+	slurmLintResult.CoveredAssertions = make([]SlurmLintEntry, 0)
+	slurmLintResult.InvalidatingAssertions = make([]SlurmLintEntry, 0)
+	slurmLintResult.Conflicts = make([]SlurmLintEntry, 0)
+
+	slurmFiles, slurmValidateResults, valid := validateSlurmFiles(slurmUploadFiles)
+	slurmLintResult.SlurmValidateResult = slurmValidateResults
+	if !valid {
+		belogs.Error("LintSlurmFiles(): validateSlurmFiles fail:", jsonutil.MarshalJson(slurmValidateResults))
+		return slurmLintResult, errors.New("slurm files are invalid")
+	}
+
+	// the same overlap check as ActivateSlurm
+	activeSlurmLogFiles, err := getSlurmLogFilesDb(0, true)
+	if err != nil {
+		belogs.Error("LintSlurmFiles(): getSlurmLogFilesDb active fail:", err)
+		return slurmLintResult, err
+	}
+	allSlurmFiles := make([]slurmFile, 0, len(activeSlurmLogFiles)+len(slurmFiles))
+	for _, labRpkiSlurmLogFile := range activeSlurmLogFiles {
+		slurm, slurmValidateResult := ValidateSlurmFile(labRpkiSlurmLogFile.FileName, []byte(labRpkiSlurmLogFile.JsonAll))
+		if len(slurmValidateResult.Errors) > 0 {
+			belogs.Error("LintSlurmFiles(): ValidateSlurmFile fail, labRpkiSlurmLogFile.Id:", labRpkiSlurmLogFile.Id, slurmValidateResult.Errors)
+			return slurmLintResult, errors.New("slurm file " + labRpkiSlurmLogFile.FileName + " is invalid")
+		}
+		allSlurmFiles = append(allSlurmFiles, slurmFile{
+			fileName: labRpkiSlurmLogFile.FileName + "(slurmLogId:" + convert.ToString(labRpkiSlurmLogFile.SlurmLogId) + ")",
+			content:  []byte(labRpkiSlurmLogFile.JsonAll),
+			slurm:    slurm,
+		})
+	}
+	allSlurmFiles = append(allSlurmFiles, slurmFiles...)
+	for _, overlap := range checkSlurmOverlap(allSlurmFiles) {
+		slurmLintResult.Conflicts = append(slurmLintResult.Conflicts, SlurmLintEntry{FileName: overlap.fileName, Reason: overlap.err})
+	}
+
+	candidates := make([]slurmLintCandidate, 0)
+	for i := range slurmFiles {
+		for _, row := range convertSlurmToRows(slurmFiles[i].slurm) {
+			candidates = append(candidates, slurmLintCandidate{fileName: slurmFiles[i].fileName, entry: convertSlurmRowToEntry(&row)})
+		}
+	}
+	activeEntries, err := getActiveSlurmEntriesDb()
+	if err != nil {
+		belogs.Error("LintSlurmFiles(): getActiveSlurmEntriesDb fail:", err)
+		return slurmLintResult, err
+	}
+	roaVrps, curVrpCount, err := getRtrVrpsWithoutSlurmDb()
+	if err != nil {
+		belogs.Error("LintSlurmFiles(): getRtrVrpsWithoutSlurmDb fail:", err)
+		return slurmLintResult, err
+	}
+	asaAspas, curAspaCount, err := getRtrAspasWithoutSlurmDb()
+	if err != nil {
+		belogs.Error("LintSlurmFiles(): getRtrAspasWithoutSlurmDb fail:", err)
+		return slurmLintResult, err
+	}
+
+	allEntries := make([]SlurmRevisionEntry, 0, len(activeEntries)+len(candidates))
+	allEntries = append(allEntries, activeEntries...)
+	for i := range candidates {
+		allEntries = append(allEntries, candidates[i].entry)
+	}
+	slurmLintResult.Conflicts = append(slurmLintResult.Conflicts, lintSlurmConflicts(candidates, activeEntries)...)
+
+	newVrpSet, err := lintSlurmVrps(candidates, allEntries, roaVrps, &slurmLintResult)
+	if err != nil {
+		belogs.Error("LintSlurmFiles(): lintSlurmVrps fail:", err)
+		return slurmLintResult, err
+	}
+	newAspaCount := lintSlurmAspas(candidates, allEntries, asaAspas, &slurmLintResult)
+
+	err = lintSlurmInvalidatingAssertions(candidates, newVrpSet, &slurmLintResult)
+	if err != nil {
+		belogs.Error("LintSlurmFiles(): lintSlurmInvalidatingAssertions fail:", err)
+		return slurmLintResult, err
+	}
+
+	slurmLintResult.CurVrpCount = curVrpCount
+	slurmLintResult.NewVrpCount = newVrpSet.Count
+	slurmLintResult.VrpCountChange = int64(newVrpSet.Count) - int64(curVrpCount)
+	slurmLintResult.CurAspaCount = curAspaCount
+	slurmLintResult.NewAspaCount = newAspaCount
+	slurmLintResult.AspaCountChange = int64(newAspaCount) - int64(curAspaCount)
+	belogs.Info("LintSlurmFiles(): len(candidates):", len(candidates), "  len(UnmatchedFilters):", len(slurmLintResult.UnmatchedFilters),
+		"  len(CoveredAssertions):", len(slurmLintResult.CoveredAssertions), "  len(InvalidatingAssertions):", len(slurmLintResult.InvalidatingAssertions),
+		"  len(Conflicts):", len(slurmLintResult.Conflicts), "  vrpCountChange:", slurmLintResult.VrpCountChange,
+		"  aspaCountChange:", slurmLintResult.AspaCountChange, "  time(s):", time.Since(start))
+	return slurmLintResult, nil
+}
+
+// duplicated entries, and assertions which are removed by filters
+func lintSlurmConflicts(candidates []slurmLintCandidate, activeEntries []SlurmRevisionEntry) (conflicts []SlurmLintEntry) {
+	conflicts = make([]SlurmLintEntry, 0)
+	owners := make(map[string]string, len(activeEntries)+len(candidates))
+	for i := range activeEntries {
+		owners[getSlurmRevisionEntryKey(&activeEntries[i])] = "slurmLogId:" + convert.ToString(activeEntries[i].SlurmLogId)
+	}
+	for i := range candidates {
+		key := getSlurmRevisionEntryKey(&candidates[i].entry)
+		if owner, ok := owners[key]; ok {
+			conflicts = append(conflicts, newSlurmLintEntry(&candidates[i], "duplicated with entry in "+owner))
+			continue
+		}
+		owners[key] = candidates[i].fileName
+	}
+
+	// every filter and assertion of which at least one is candidate
+	for i := range candidates {
+		for j := range activeEntries {
+			if isSlurmEntryFiltered(&candidates[i].entry, &activeEntries[j]) {
+				conflicts = append(conflicts, newSlurmLintEntry(&candidates[i],
+					"assertion is filtered by "+activeEntries[j].Style+" in slurmLogId:"+convert.ToString(activeEntries[j].SlurmLogId)))
+			} else if isSlurmEntryFiltered(&activeEntries[j], &candidates[i].entry) {
+				conflicts = append(conflicts, newSlurmLintEntry(&candidates[i],
+					"filter removes "+activeEntries[j].Style+" in slurmLogId:"+convert.ToString(activeEntries[j].SlurmLogId)))
+			}
+		}
+		for j := range candidates {
+			if isSlurmEntryFiltered(&candidates[i].entry, &candidates[j].entry) {
+				conflicts = append(conflicts, newSlurmLintEntry(&candidates[i],
+					"assertion is filtered by "+candidates[j].entry.Style+" in "+candidates[j].fileName))
+			}
+		}
+	}
+	return conflicts
+}
+
+// prefixFilters which match no roa vrp, prefixAssertions which are covered by roa vrps.
+// return all vrps after active and candidate slurms
+func lintSlurmVrps(candidates []slurmLintCandidate, allEntries []SlurmRevisionEntry, roaVrps []SlurmVrp,
+	slurmLintResult *SlurmLintResult) (newVrpSet *validate.VrpSet, err error) {
+	filters, assertions := convertSlurmRevisionEntriesToVrps(allEntries)
+	for i := range candidates {
+		if candidates[i].entry.Style != "prefixFilters" {
+			continue
+		}
+		matched := false
+		for j := range roaVrps {
+			if isSlurmVrpFiltered(&roaVrps[j], []SlurmRevisionEntry{candidates[i].entry}) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			slurmLintResult.UnmatchedFilters = append(slurmLintResult.UnmatchedFilters,
+				newSlurmLintEntry(&candidates[i], "no vrp from roa matches the filter"))
+		}
+	}
+
+	// the same as diffSlurmRevisionVrps, vrp is unique by asn/prefix/maxLength
+	roaVrpSet := validate.NewVrpSet()
+	newVrpSet = validate.NewVrpSet()
+	newVrps := make(map[validate.Vrp]struct{}, len(roaVrps)+len(assertions))
+	for i := range roaVrps {
+		if isSlurmVrpFiltered(&roaVrps[i], filters) {
+			continue
+		}
+		vrp, err := convertSlurmVrpToVrp(&roaVrps[i])
+		if err != nil {
+			belogs.Error("lintSlurmVrps(): convertSlurmVrpToVrp fail:", jsonutil.MarshalJson(roaVrps[i]), err)
+			return nil, err
+		}
+		roaVrpSet.AddVrp(vrp)
+		newVrps[vrp] = struct{}{}
+	}
+	for i := range assertions {
+		vrp, err := convertSlurmVrpToVrp(&assertions[i])
+		if err != nil {
+			belogs.Error("lintSlurmVrps(): convertSlurmVrpToVrp fail:", jsonutil.MarshalJson(assertions[i]), err)
+			return nil, err
+		}
+		newVrps[vrp] = struct{}{}
+	}
+	for vrp := range newVrps {
+		newVrpSet.AddVrp(vrp)
+	}
+
+	for i := range candidates {
+		if candidates[i].entry.Style != "prefixAssertions" {
+			continue
+		}
+		_, candidateAssertions := convertSlurmRevisionEntriesToVrps([]SlurmRevisionEntry{candidates[i].entry})
+		vrp, err := convertSlurmVrpToVrp(&candidateAssertions[0])
+		if err != nil {
+			belogs.Error("lintSlurmVrps(): convertSlurmVrpToVrp fail:", jsonutil.MarshalJson(candidates[i].entry), err)
+			return nil, err
+		}
+		for _, coveringVrp := range roaVrpSet.Covering(vrp.Prefix) {
+			if coveringVrp.Asn == vrp.Asn && coveringVrp.MaxLength >= vrp.MaxLength {
+				slurmLintResult.CoveredAssertions = append(slurmLintResult.CoveredAssertions,
+					newSlurmLintEntry(&candidates[i], "covered by vrp from roa: AS"+convert.ToString(coveringVrp.Asn)+" "+
+						coveringVrp.Prefix.String()+"-"+convert.ToString(coveringVrp.MaxLength)))
+				break
+			}
+		}
+	}
+	return newVrpSet, nil
+}
+
+// aspaFilters which match no asa aspa, aspaAssertions which are covered by asa aspas.
+// return count of all aspas after active and candidate slurms
+func lintSlurmAspas(candidates []slurmLintCandidate, allEntries []SlurmRevisionEntry, asaAspas []SlurmAspa,
+	slurmLintResult *SlurmLintResult) (newAspaCount uint64) {
+	for i := range candidates {
+		if candidates[i].entry.Style != "aspaFilters" {
+			continue
+		}
+		matched := false
+		for j := range asaAspas {
+			if isSlurmAspaFiltered(&asaAspas[j], &candidates[i].entry) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			slurmLintResult.UnmatchedFilters = append(slurmLintResult.UnmatchedFilters,
+				newSlurmLintEntry(&candidates[i], "no aspa from asa matches the filter"))
+		}
+	}
+
+	asaAspaKeys := make(map[SlurmAspa]struct{}, len(asaAspas))
+	newAspaKeys := make(map[SlurmAspa]struct{}, len(asaAspas))
+	for i := range asaAspas {
+		filtered := false
+		for j := range allEntries {
+			if allEntries[j].Style == "aspaFilters" && isSlurmAspaFiltered(&asaAspas[i], &allEntries[j]) {
+				filtered = true
+				break
+			}
+		}
+		if !filtered {
+			asaAspaKeys[asaAspas[i]] = struct{}{}
+			newAspaKeys[asaAspas[i]] = struct{}{}
+		}
+	}
+	for i := range allEntries {
+		if allEntries[i].Style != "aspaAssertions" {
+			continue
+		}
+		for _, aspa := range convertSlurmEntryToAspas(&allEntries[i]) {
+			newAspaKeys[aspa] = struct{}{}
+		}
+	}
+
+	for i := range candidates {
+		if candidates[i].entry.Style != "aspaAssertions" {
+			continue
+		}
+		aspas := convertSlurmEntryToAspas(&candidates[i].entry)
+		covered := len(aspas) > 0
+		for _, aspa := range aspas {
+			if _, ok := asaAspaKeys[aspa]; !ok {
+				covered = false
+				break
+			}
+		}
+		if covered {
+			slurmLintResult.CoveredAssertions = append(slurmLintResult.CoveredAssertions,
+				newSlurmLintEntry(&candidates[i], "covered by aspa from asa"))
+		}
+	}
+	return uint64(len(newAspaKeys))
+}
+
+// routes in reference rib, which are not invalid now, and will be invalid because of candidate prefixAssertions
+func lintSlurmInvalidatingAssertions(candidates []slurmLintCandidate, newVrpSet *validate.VrpSet,
+	slurmLintResult *SlurmLintResult) (err error) {
+	referenceFile, referenceRoutes, err := rtrpreview.GetReferenceRoutes()
+	if err != nil {
+		belogs.Error("lintSlurmInvalidatingAssertions(): GetReferenceRoutes fail:", err)
+		return err
+	}
+	slurmLintResult.ReferenceFile = referenceFile
+	slurmLintResult.ReferenceRouteCount = uint64(len(referenceRoutes))
+	if len(referenceRoutes) == 0 {
+		belogs.Info("lintSlurmInvalidatingAssertions(): there is no reference route, referenceFile:", referenceFile)
+		return nil
+	}
+
+	// candidate index of every asserted vrp
+	assertionVrpSet := validate.NewVrpSet()
+	assertionIndexes := make(map[validate.Vrp][]int)
+	for i := range candidates {
+		if candidates[i].entry.Style != "prefixAssertions" {
+			continue
+		}
+		_, candidateAssertions := convertSlurmRevisionEntriesToVrps([]SlurmRevisionEntry{candidates[i].entry})
+		vrp, err := convertSlurmVrpToVrp(&candidateAssertions[0])
+		if err != nil {
+			belogs.Error("lintSlurmInvalidatingAssertions(): convertSlurmVrpToVrp fail:", jsonutil.MarshalJson(candidates[i].entry), err)
+			return err
+		}
+		if _, ok := assertionIndexes[vrp]; !ok {
+			assertionVrpSet.AddVrp(vrp)
+		}
+		assertionIndexes[vrp] = append(assertionIndexes[vrp], i)
+	}
+	if len(assertionIndexes) == 0 {
+		return nil
+	}
+	curVrpSet, err := validate.GetVrpSetDb()
+	if err != nil {
+		belogs.Error("lintSlurmInvalidatingAssertions(): GetVrpSetDb fail:", err)
+		return err
+	}
+
+	invalidatedRoutes := make(map[int][]SlurmLintRoute)
+	for i := range referenceRoutes {
+		coveringVrps := assertionVrpSet.Covering(referenceRoutes[i].Prefix)
+		if len(coveringVrps) == 0 {
+			continue
+		}
+		newRovResult := newVrpSet.ValidateOrigin(referenceRoutes[i].Prefix, referenceRoutes[i].OriginAsn, referenceRoutes[i].HasOrigin)
+		if newRovResult.State != validate.ROV_STATE_INVALID {
+			continue
+		}
+		curRovResult := curVrpSet.ValidateOrigin(referenceRoutes[i].Prefix, referenceRoutes[i].OriginAsn, referenceRoutes[i].HasOrigin)
+		if curRovResult.State == validate.ROV_STATE_INVALID {
+			continue
+		}
+		slurmLintRoute := SlurmLintRoute{
+			Prefix:    referenceRoutes[i].Prefix.String(),
+			OriginAsn: referenceRoutes[i].OriginAsn,
+			OldState:  curRovResult.State,
+			NewReason: newRovResult.Reason,
+		}
+		for _, vrp := range coveringVrps {
+			for _, index := range assertionIndexes[vrp] {
+				if len(invalidatedRoutes[index]) < maxSlurmLintRoutes {
+					invalidatedRoutes[index] = append(invalidatedRoutes[index], slurmLintRoute)
+				}
+			}
+		}
+	}
+	for i := range candidates {
+		if routes, ok := invalidatedRoutes[i]; ok {
+			slurmLintEntry := newSlurmLintEntry(&candidates[i], "makes routes in reference rib invalid")
+			slurmLintEntry.InvalidatedRoutes = routes
+			slurmLintResult.InvalidatingAssertions = append(slurmLintResult.InvalidatingAssertions, slurmLintEntry)
+		}
+	}
+	return nil
+}
+
+// filter and assertion should be the same kind, such as prefixFilters and prefixAssertions
+func isSlurmEntryFiltered(assertion, filter *SlurmRevisionEntry) bool {
+	switch {
+	case assertion.Style == "prefixAssertions" && filter.Style == "prefixFilters":
+		_, assertions := convertSlurmRevisionEntriesToVrps([]SlurmRevisionEntry{*assertion})
+		return isSlurmVrpFiltered(&assertions[0], []SlurmRevisionEntry{*filter})
+	case assertion.Style == "bgpsecAssertions" && filter.Style == "bgpsecFilters":
+		if filter.Asn.Valid && filter.Asn.ValueOrZero() != assertion.Asn.ValueOrZero() {
+			return false
+		}
+		return !filter.Ski.Valid || filter.Ski.ValueOrZero() == assertion.Ski.ValueOrZero()
+	case assertion.Style == "aspaAssertions" && filter.Style == "aspaFilters":
+		for _, aspa := range convertSlurmEntryToAspas(assertion) {
+			if isSlurmAspaFiltered(&aspa, filter) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// the same as UpdateRtrAsaFullOrFullLogFromSlurmDb
+func isSlurmAspaFiltered(aspa *SlurmAspa, filter *SlurmRevisionEntry) bool {
+	if filter.CustomerAsn.Valid && uint64(filter.CustomerAsn.ValueOrZero()) != aspa.CustomerAsn {
+		return false
+	}
+	if filter.ProviderAsn.Valid && uint64(filter.ProviderAsn.ValueOrZero()) != aspa.ProviderAsn {
+		return false
+	}
+	for _, addressFamily := range getSlurmAspaAddressFamilies(filter.AddressFamily) {
+		if addressFamily == aspa.AddressFamily {
+			return true
+		}
+	}
+	return false
+}
+
+// one aspaAssertions row is one or two rows in lab_rpki_rtr_asa_full
+func convertSlurmEntryToAspas(entry *SlurmRevisionEntry) (slurmAspas []SlurmAspa) {
+	slurmAspas = make([]SlurmAspa, 0, 2)
+	if !entry.ProviderAsn.Valid {
+		return slurmAspas
+	}
+	for _, addressFamily := range getSlurmAspaAddressFamilies(entry.AddressFamily) {
+		slurmAspas = append(slurmAspas, SlurmAspa{
+			CustomerAsn:   uint64(entry.CustomerAsn.ValueOrZero()),
+			ProviderAsn:   uint64(entry.ProviderAsn.ValueOrZero()),
+			AddressFamily: addressFamily,
+		})
+	}
+	return slurmAspas
+}
+
+// addressFamily in lab_rpki_rtr_asa_full
+func getSlurmAspaAddressFamilies(addressFamily null.String) (addressFamilies []uint64) {
+	addressFamilyIpv4, addressFamilyIpv6, err := rtrcommon.ConvertSlurmAddressFamilyToRtr(addressFamily.ValueOrZero())
+	if err != nil {
+		return nil
+	}
+	addressFamilies = make([]uint64, 0, 2)
+	if addressFamilyIpv4.Valid {
+		addressFamilies = append(addressFamilies, uint64(addressFamilyIpv4.ValueOrZero()))
+	}
+	if addressFamilyIpv6.Valid {
+		addressFamilies = append(addressFamilies, uint64(addressFamilyIpv6.ValueOrZero()))
+	}
+	return addressFamilies
+}
+
+func convertSlurmVrpToVrp(slurmVrp *SlurmVrp) (vrp validate.Vrp, err error) {
+	prefix, err := validate.ConvertRtrAddressToPrefix(slurmVrp.Address, slurmVrp.PrefixLength)
+	if err != nil {
+		return vrp, err
+	}
+	return validate.Vrp{Asn: uint32(slurmVrp.Asn), Prefix: prefix.Masked(), MaxLength: int(slurmVrp.MaxLength)}, nil
+}
+
+func convertSlurmRowToEntry(row *slurmRow) SlurmRevisionEntry {
+	return SlurmRevisionEntry{
+		Style:           row.Style,
+		Asn:             row.Asn,
+		AddressPrefix:   row.AddressPrefix,
+		MaxLength:       row.MaxLength,
+		Ski:             row.Ski,
+		RouterPublicKey: row.RouterPublicKey,
+		CustomerAsn:     row.CustomerAsn,
+		ProviderAsn:     row.ProviderAsn,
+		AddressFamily:   row.AddressFamily,
+		Comment:         row.Comment,
+	}
+}
+
+func newSlurmLintEntry(candidate *slurmLintCandidate, reason string) SlurmLintEntry {
+	entry := candidate.entry
+	return SlurmLintEntry{FileName: candidate.fileName, Entry: &entry, Reason: reason}
+}
@@ -0,0 +1,42 @@
+package slurm
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/guregu/null"
+)
+
+func TestLintSlurmConflicts(t *testing.T) {
+	activeEntries := []SlurmRevisionEntry{
+		{Style: "prefixFilters", Asn: null.IntFrom(64496), SlurmLogId: 1},
+		{Style: "aspaAssertions", CustomerAsn: null.IntFrom(64500), ProviderAsn: null.IntFrom(64501),
+			AddressFamily: null.StringFrom("IPv4"), SlurmLogId: 1},
+	}
+	candidates := []slurmLintCandidate{
+		// filtered by active prefixFilters
+		{fileName: "a.json", entry: SlurmRevisionEntry{Style: "prefixAssertions", Asn: null.IntFrom(64496),
+			AddressPrefix: null.StringFrom("198.51.100.0/24")}},
+		// removes active aspaAssertions
+		{fileName: "a.json", entry: SlurmRevisionEntry{Style: "aspaFilters", CustomerAsn: null.IntFrom(64500)}},
+		// duplicated with the first one
+		{fileName: "b.json", entry: SlurmRevisionEntry{Style: "prefixAssertions", Asn: null.IntFrom(64496),
+			AddressPrefix: null.StringFrom("198.51.100.0/24")}},
+		{fileName: "b.json", entry: SlurmRevisionEntry{Style: "prefixAssertions", Asn: null.IntFrom(64497),
+			AddressPrefix: null.StringFrom("203.0.113.0/24")}},
+	}
+	conflicts := lintSlurmConflicts(candidates, activeEntries)
+	fmt.Println(conflicts)
+	if len(conflicts) != 4 {
+		t.Fatal("should have 4 conflicts:", len(conflicts))
+	}
+
+	aspa := SlurmAspa{CustomerAsn: 64500, ProviderAsn: 64501, AddressFamily: 1}
+	if isSlurmAspaFiltered(&aspa, &SlurmRevisionEntry{Style: "aspaFilters", CustomerAsn: null.IntFrom(64500),
+		ProviderAsn: null.IntFrom(64501), AddressFamily: null.StringFrom("IPv4")}) {
+		t.Fatal("ipv6 aspa should not be filtered by ipv4 filter")
+	}
+	if !isSlurmAspaFiltered(&aspa, &SlurmRevisionEntry{Style: "aspaFilters", CustomerAsn: null.IntFrom(64500)}) {
+		t.Fatal("aspa should be filtered by customerAsn")
+	}
+}
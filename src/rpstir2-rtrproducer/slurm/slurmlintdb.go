@@ -0,0 +1,65 @@
+package slurm
+
+import (
+	"time"
+
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/xormdb"
+)
+
+// rows of all active slurms in lab_rpki_slurm
+func getActiveSlurmEntriesDb() (slurmRevisionEntries []SlurmRevisionEntry, err error) {
+	slurmRevisionEntries = make([]SlurmRevisionEntry, 0)
+	sql := `select style, asn, addressPrefix, maxLength, ski, routerPublicKey,
+			customerAsn, providerAsn, addressFamily, comment, slurmLogId
+		from lab_rpki_slurm order by id `
+	err = xormdb.XormEngine.SQL(sql).Find(&slurmRevisionEntries)
+	if err != nil {
+		belogs.Error("getActiveSlurmEntriesDb(): select lab_rpki_slurm fail:", err)
+		return nil, err
+	}
+	belogs.Debug("getActiveSlurmEntriesDb(): len(slurmRevisionEntries):", len(slurmRevisionEntries))
+	return slurmRevisionEntries, nil
+}
+
+// vrps in lab_rpki_rtr_full which come from roa, not from slurm
+func getRtrVrpsWithoutSlurmDb() (slurmVrps []SlurmVrp, curVrpCount uint64, err error) {
+	start := time.Now()
+	slurmVrps = make([]SlurmVrp, 0)
+	sql := `select asn, address, prefixLength, maxLength from lab_rpki_rtr_full
+		where sourceFrom->'$.source' != 'slurm' order by id `
+	err = xormdb.XormEngine.SQL(sql).Find(&slurmVrps)
+	if err != nil {
+		belogs.Error("getRtrVrpsWithoutSlurmDb(): select lab_rpki_rtr_full fail:", err)
+		return nil, 0, err
+	}
+	_, err = xormdb.XormEngine.SQL(`select count(*) from lab_rpki_rtr_full`).Get(&curVrpCount)
+	if err != nil {
+		belogs.Error("getRtrVrpsWithoutSlurmDb(): select count lab_rpki_rtr_full fail:", err)
+		return nil, 0, err
+	}
+	belogs.Info("getRtrVrpsWithoutSlurmDb(): len(slurmVrps):", len(slurmVrps), "  curVrpCount:", curVrpCount,
+		"  time(s):", time.Since(start))
+	return slurmVrps, curVrpCount, nil
+}
+
+// aspas in lab_rpki_rtr_asa_full which come from asa, not from slurm
+func getRtrAspasWithoutSlurmDb() (slurmAspas []SlurmAspa, curAspaCount uint64, err error) {
+	start := time.Now()
+	slurmAspas = make([]SlurmAspa, 0)
+	sql := `select customerAsn, providerAsn, addressFamily from lab_rpki_rtr_asa_full
+		where sourceFrom->'$.source' != 'slurm' order by id `
+	err = xormdb.XormEngine.SQL(sql).Find(&slurmAspas)
+	if err != nil {
+		belogs.Error("getRtrAspasWithoutSlurmDb(): select lab_rpki_rtr_asa_full fail:", err)
+		return nil, 0, err
+	}
+	_, err = xormdb.XormEngine.SQL(`select count(*) from lab_rpki_rtr_asa_full`).Get(&curAspaCount)
+	if err != nil {
+		belogs.Error("getRtrAspasWithoutSlurmDb(): select count lab_rpki_rtr_asa_full fail:", err)
+		return nil, 0, err
+	}
+	belogs.Info("getRtrAspasWithoutSlurmDb(): len(slurmAspas):", len(slurmAspas), "  curAspaCount:", curAspaCount,
+		"  time(s):", time.Since(start))
+	return slurmAspas, curAspaCount, nil
+}
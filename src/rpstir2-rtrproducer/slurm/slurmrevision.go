@@ -0,0 +1,289 @@
+package slurm
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/convert"
+	"github.com/cpusoft/goutil/iputil"
+	"github.com/cpusoft/goutil/jsonutil"
+)
+
+// all revisions, latest first, not include entries
+func GetSlurmRevisions() (slurmRevisionModels []SlurmRevisionModel, err error) {
+	slurmRevisionModels, err = getSlurmRevisionsDb()
+	if err != nil {
+		belogs.Error("GetSlurmRevisions(): getSlurmRevisionsDb fail:", err)
+		return nil, err
+	}
+	return slurmRevisionModels, nil
+}
+
+// fromRevisionId is 0 means no slurm
+func DiffSlurmRevisions(fromRevisionId, toRevisionId uint64) (slurmRevisionDiff SlurmRevisionDiff, err error) {
+	start := time.Now()
+	belogs.Info("DiffSlurmRevisions(): fromRevisionId:", fromRevisionId, "  toRevisionId:", toRevisionId)
+
+	fromEntries, err := getSlurmRevisionEntries(fromRevisionId)
+	if err != nil {
+		belogs.Error("DiffSlurmRevisions(): getSlurmRevisionEntries from fail, fromRevisionId:", fromRevisionId, err)
+		return slurmRevisionDiff, err
+	}
+	toEntries, err := getSlurmRevisionEntries(toRevisionId)
+	if err != nil {
+		belogs.Error("DiffSlurmRevisions(): getSlurmRevisionEntries to fail, toRevisionId:", toRevisionId, err)
+		return slurmRevisionDiff, err
+	}
+	slurmRevisionDiff.FromRevisionId = fromRevisionId
+	slurmRevisionDiff.ToRevisionId = toRevisionId
+	slurmRevisionDiff.AddedEntries, slurmRevisionDiff.RemovedEntries = diffSlurmRevisionEntries(fromEntries, toEntries)
+
+	roaVrps, err := getRoaVrpsDb()
+	if err != nil {
+		belogs.Error("DiffSlurmRevisions(): getRoaVrpsDb fail:", err)
+		return slurmRevisionDiff, err
+	}
+	slurmRevisionDiff.AnnounceVrps, slurmRevisionDiff.WithdrawVrps = diffSlurmRevisionVrps(roaVrps, fromEntries, toEntries)
+	belogs.Info("DiffSlurmRevisions(): fromRevisionId:", fromRevisionId, "  toRevisionId:", toRevisionId,
+		"  len(AddedEntries):", len(slurmRevisionDiff.AddedEntries), "  len(RemovedEntries):", len(slurmRevisionDiff.RemovedEntries),
+		"  len(AnnounceVrps):", len(slurmRevisionDiff.AnnounceVrps), "  len(WithdrawVrps):", len(slurmRevisionDiff.WithdrawVrps),
+		"  time(s):", time.Since(start))
+	return slurmRevisionDiff, nil
+}
+
+// active slurm logs of revisionId will be active again, as a new revision. caller should update rtr to get new serial
+func RollbackSlurm(revisionId uint64, author, comment string) (err error) {
+	start := time.Now()
+	belogs.Info("RollbackSlurm(): revisionId:", revisionId, "  author:", author)
+
+	labRpkiSlurmRevision, has, err := getSlurmRevisionDb(revisionId)
+	if err != nil {
+		belogs.Error("RollbackSlurm(): getSlurmRevisionDb fail, revisionId:", revisionId, err)
+		return err
+	}
+	if !has {
+		return errors.New("revisionId " + convert.ToString(revisionId) + " does not exist")
+	}
+	activeSlurmLogIds := make([]uint64, 0)
+	err = jsonutil.UnmarshalJson(labRpkiSlurmRevision.ActiveSlurmLogIds, &activeSlurmLogIds)
+	if err != nil {
+		belogs.Error("RollbackSlurm(): UnmarshalJson activeSlurmLogIds fail, revisionId:", revisionId, err)
+		return err
+	}
+
+	// slurm files are never changed after uploading, so rows are the same as the revision
+	slurmRows := make(map[uint64]map[uint64][]slurmRow, len(activeSlurmLogIds))
+	for _, slurmLogId := range activeSlurmLogIds {
+		labRpkiSlurmLogFiles, err := getSlurmLogFilesDb(slurmLogId, false)
+		if err != nil {
+			belogs.Error("RollbackSlurm(): getSlurmLogFilesDb fail, slurmLogId:", slurmLogId, err)
+			return err
+		}
+		slurmRows[slurmLogId] = make(map[uint64][]slurmRow, len(labRpkiSlurmLogFiles))
+		for _, labRpkiSlurmLogFile := range labRpkiSlurmLogFiles {
+			slurm, slurmValidateResult := ValidateSlurmFile(labRpkiSlurmLogFile.FileName, []byte(labRpkiSlurmLogFile.JsonAll))
+			if len(slurmValidateResult.Errors) > 0 {
+				belogs.Error("RollbackSlurm(): ValidateSlurmFile fail, labRpkiSlurmLogFile.Id:", labRpkiSlurmLogFile.Id, slurmValidateResult.Errors)
+				return errors.New("slurm file " + labRpkiSlurmLogFile.FileName + " is invalid")
+			}
+			slurmRows[slurmLogId][labRpkiSlurmLogFile.Id] = convertSlurmToRows(slurm)
+		}
+	}
+	err = rollbackSlurmDb(revisionId, slurmRows, author, comment)
+	if err != nil {
+		belogs.Error("RollbackSlurm(): rollbackSlurmDb fail, revisionId:", revisionId, err)
+		return err
+	}
+	belogs.Info("RollbackSlurm(): revisionId:", revisionId, "  activeSlurmLogIds:", activeSlurmLogIds, "  time(s):", time.Since(start))
+	return nil
+}
+
+func getSlurmRevisionEntries(revisionId uint64) (slurmRevisionEntries []SlurmRevisionEntry, err error) {
+	slurmRevisionEntries = make([]SlurmRevisionEntry, 0)
+	if revisionId == 0 {
+		return slurmRevisionEntries, nil
+	}
+	labRpkiSlurmRevision, has, err := getSlurmRevisionDb(revisionId)
+	if err != nil {
+		belogs.Error("getSlurmRevisionEntries(): getSlurmRevisionDb fail, revisionId:", revisionId, err)
+		return nil, err
+	}
+	if !has {
+		return nil, errors.New("revisionId " + convert.ToString(revisionId) + " does not exist")
+	}
+	err = jsonutil.UnmarshalJson(labRpkiSlurmRevision.Entries, &slurmRevisionEntries)
+	if err != nil {
+		belogs.Error("getSlurmRevisionEntries(): UnmarshalJson entries fail, revisionId:", revisionId, err)
+		return nil, err
+	}
+	return slurmRevisionEntries, nil
+}
+
+// comment and slurmLogId are not compared
+func diffSlurmRevisionEntries(fromEntries, toEntries []SlurmRevisionEntry) (addedEntries, removedEntries []SlurmRevisionEntry) {
+	fromKeys := make(map[string]struct{}, len(fromEntries))
+	for i := range fromEntries {
+		fromKeys[getSlurmRevisionEntryKey(&fromEntries[i])] = struct{}{}
+	}
+	toKeys := make(map[string]struct{}, len(toEntries))
+	for i := range toEntries {
+		toKeys[getSlurmRevisionEntryKey(&toEntries[i])] = struct{}{}
+	}
+	addedEntries = make([]SlurmRevisionEntry, 0)
+	for i := range toEntries {
+		if _, ok := fromKeys[getSlurmRevisionEntryKey(&toEntries[i])]; !ok {
+			addedEntries = append(addedEntries, toEntries[i])
+		}
+	}
+	removedEntries = make([]SlurmRevisionEntry, 0)
+	for i := range fromEntries {
+		if _, ok := toKeys[getSlurmRevisionEntryKey(&fromEntries[i])]; !ok {
+			removedEntries = append(removedEntries, fromEntries[i])
+		}
+	}
+	return addedEntries, removedEntries
+}
+
+func getSlurmRevisionEntryKey(e *SlurmRevisionEntry) string {
+	return strings.Join([]string{e.Style, convert.ToString(e.Asn.ValueOrZero()), e.AddressPrefix.ValueOrZero(),
+		convert.ToString(e.MaxLength.ValueOrZero()), e.Ski.ValueOrZero(), e.RouterPublicKey.ValueOrZero(),
+		convert.ToString(e.CustomerAsn.ValueOrZero()), convert.ToString(e.ProviderAsn.ValueOrZero()), e.AddressFamily.ValueOrZero()}, "_")
+}
+
+// vrps are roa vrps filtered by prefixFilters and added by prefixAssertions, the same as UpdateRtrFullOrFullLogFromSlurmDb
+func diffSlurmRevisionVrps(roaVrps []SlurmVrp, fromEntries, toEntries []SlurmRevisionEntry) (announceVrps, withdrawVrps []SlurmVrp) {
+	type vrpState struct {
+		vrp    SlurmVrp
+		inFrom bool
+		inTo   bool
+	}
+	fromFilters, fromAssertions := convertSlurmRevisionEntriesToVrps(fromEntries)
+	toFilters, toAssertions := convertSlurmRevisionEntriesToVrps(toEntries)
+
+	getVrpKey := func(vrp SlurmVrp) string {
+		return convert.ToString(vrp.Asn) + "_" + vrp.Address + "/" + convert.ToString(vrp.PrefixLength) + "_" + convert.ToString(vrp.MaxLength)
+	}
+	assertionKeys := make(map[string]struct{}, len(fromAssertions)+len(toAssertions))
+	for _, vrp := range append(fromAssertions, toAssertions...) {
+		assertionKeys[getVrpKey(vrp)] = struct{}{}
+	}
+
+	vrpStates := make(map[string]*vrpState)
+	getVrpState := func(vrp SlurmVrp) *vrpState {
+		key := getVrpKey(vrp)
+		if v, ok := vrpStates[key]; ok {
+			return v
+		}
+		v := &vrpState{vrp: vrp}
+		vrpStates[key] = v
+		return v
+	}
+	for i := range roaVrps {
+		// only when filtered differently or asserted, the vrp may change
+		inFrom := !isSlurmVrpFiltered(&roaVrps[i], fromFilters)
+		inTo := !isSlurmVrpFiltered(&roaVrps[i], toFilters)
+		if inFrom == inTo {
+			if _, ok := assertionKeys[getVrpKey(roaVrps[i])]; !ok {
+				continue
+			}
+		}
+		v := getVrpState(roaVrps[i])
+		v.inFrom = v.inFrom || inFrom
+		v.inTo = v.inTo || inTo
+	}
+	for i := range fromAssertions {
+		getVrpState(fromAssertions[i]).inFrom = true
+	}
+	for i := range toAssertions {
+		getVrpState(toAssertions[i]).inTo = true
+	}
+
+	announceVrps = make([]SlurmVrp, 0)
+	withdrawVrps = make([]SlurmVrp, 0)
+	for _, v := range vrpStates {
+		if v.inTo && !v.inFrom {
+			announceVrps = append(announceVrps, v.vrp)
+		} else if v.inFrom && !v.inTo {
+			withdrawVrps = append(withdrawVrps, v.vrp)
+		}
+	}
+	sortSlurmVrps(announceVrps)
+	sortSlurmVrps(withdrawVrps)
+	return announceVrps, withdrawVrps
+}
+
+// prefixFilters may have zero fields, which match all
+func convertSlurmRevisionEntriesToVrps(slurmRevisionEntries []SlurmRevisionEntry) (filters []SlurmRevisionEntry, assertions []SlurmVrp) {
+	filters = make([]SlurmRevisionEntry, 0)
+	assertions = make([]SlurmVrp, 0)
+	for i := range slurmRevisionEntries {
+		if slurmRevisionEntries[i].Style == "prefixFilters" {
+			filters = append(filters, slurmRevisionEntries[i])
+		} else if slurmRevisionEntries[i].Style == "prefixAssertions" {
+			address, prefixLength := splitSlurmAddressPrefix(slurmRevisionEntries[i].AddressPrefix.ValueOrZero())
+			maxLength := uint64(slurmRevisionEntries[i].MaxLength.ValueOrZero())
+			if maxLength == 0 {
+				maxLength = prefixLength
+			}
+			assertions = append(assertions, SlurmVrp{
+				Asn:          uint64(slurmRevisionEntries[i].Asn.ValueOrZero()),
+				Address:      address,
+				PrefixLength: prefixLength,
+				MaxLength:    maxLength,
+			})
+		}
+	}
+	return filters, assertions
+}
+
+func isSlurmVrpFiltered(vrp *SlurmVrp, filters []SlurmRevisionEntry) bool {
+	for i := range filters {
+		if filters[i].Asn.Valid && uint64(filters[i].Asn.ValueOrZero()) != vrp.Asn {
+			continue
+		}
+		if filters[i].MaxLength.Valid && filters[i].MaxLength.ValueOrZero() > 0 &&
+			uint64(filters[i].MaxLength.ValueOrZero()) != vrp.MaxLength {
+			continue
+		}
+		if filters[i].AddressPrefix.Valid {
+			address, prefixLength := splitSlurmAddressPrefix(filters[i].AddressPrefix.ValueOrZero())
+			if prefixLength > 0 && prefixLength != vrp.PrefixLength {
+				continue
+			}
+			if len(address) > 0 && address != vrp.Address {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func splitSlurmAddressPrefix(addressPrefix string) (address string, prefixLength uint64) {
+	pos := strings.Index(addressPrefix, "/")
+	if pos < 0 {
+		return addressPrefix, 0
+	}
+	address, _ = iputil.TrimAddressPrefixZero(addressPrefix[:pos], iputil.GetIpType(addressPrefix[:pos]))
+	prefixLength, _ = strconv.ParseUint(addressPrefix[pos+1:], 10, 64)
+	return address, prefixLength
+}
+
+func sortSlurmVrps(slurmVrps []SlurmVrp) {
+	sort.Slice(slurmVrps, func(i, j int) bool {
+		if slurmVrps[i].Address != slurmVrps[j].Address {
+			return slurmVrps[i].Address < slurmVrps[j].Address
+		}
+		if slurmVrps[i].PrefixLength != slurmVrps[j].PrefixLength {
+			return slurmVrps[i].PrefixLength < slurmVrps[j].PrefixLength
+		}
+		if slurmVrps[i].MaxLength != slurmVrps[j].MaxLength {
+			return slurmVrps[i].MaxLength < slurmVrps[j].MaxLength
+		}
+		return slurmVrps[i].Asn < slurmVrps[j].Asn
+	})
+}
@@ -0,0 +1,162 @@
+package slurm
+
+import (
+	"time"
+
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/jsonutil"
+	"github.com/cpusoft/goutil/xormdb"
+	"github.com/guregu/null"
+	model "rpstir2-model"
+	"xorm.io/xorm"
+)
+
+// save all active slurm logs and all rows of lab_rpki_slurm after the change, should be in the same session of the change
+func insertSlurmRevisionDb(session *xorm.Session, action string, slurmLogId, rollbackRevisionId null.Int,
+	author, comment string, revisionTime time.Time) (err error) {
+	activeSlurmLogIds := make([]uint64, 0)
+	err = session.SQL(`select id from lab_rpki_slurm_log where state = ? order by id `, SLURM_LOG_STATE_ACTIVE).Find(&activeSlurmLogIds)
+	if err != nil {
+		belogs.Error("insertSlurmRevisionDb(): select lab_rpki_slurm_log fail:", err)
+		return err
+	}
+	slurmRevisionEntries := make([]SlurmRevisionEntry, 0)
+	sql := `select style, asn, addressPrefix, maxLength, ski, routerPublicKey,
+			customerAsn, providerAsn, addressFamily, comment, slurmLogId
+		from lab_rpki_slurm order by id `
+	err = session.SQL(sql).Find(&slurmRevisionEntries)
+	if err != nil {
+		belogs.Error("insertSlurmRevisionDb(): select lab_rpki_slurm fail:", err)
+		return err
+	}
+
+	labRpkiSlurmRevision := model.LabRpkiSlurmRevision{
+		Action:             action,
+		SlurmLogId:         slurmLogId,
+		RollbackRevisionId: rollbackRevisionId,
+		Author:             author,
+		Comment:            comment,
+		RevisionTime:       revisionTime,
+		ActiveSlurmLogIds:  jsonutil.MarshalJson(activeSlurmLogIds),
+		Entries:            jsonutil.MarshalJson(slurmRevisionEntries),
+	}
+	_, err = session.Table("lab_rpki_slurm_revision").Insert(&labRpkiSlurmRevision)
+	if err != nil {
+		belogs.Error("insertSlurmRevisionDb(): insert lab_rpki_slurm_revision fail, action:", action, "  slurmLogId:", slurmLogId,
+			"  rollbackRevisionId:", rollbackRevisionId, err)
+		return err
+	}
+	belogs.Info("insertSlurmRevisionDb(): revisionId:", labRpkiSlurmRevision.Id, "  action:", action,
+		"  activeSlurmLogIds:", labRpkiSlurmRevision.ActiveSlurmLogIds, "  len(slurmRevisionEntries):", len(slurmRevisionEntries))
+	return nil
+}
+
+func getSlurmRevisionsDb() (slurmRevisionModels []SlurmRevisionModel, err error) {
+	slurmRevisionModels = make([]SlurmRevisionModel, 0)
+	sql := `select id, action, slurmLogId, rollbackRevisionId, author, comment, revisionTime, activeSlurmLogIds,
+			json_length(entries) as entryCount
+		from lab_rpki_slurm_revision order by id desc `
+	err = xormdb.XormEngine.SQL(sql).Find(&slurmRevisionModels)
+	if err != nil {
+		belogs.Error("getSlurmRevisionsDb(): select lab_rpki_slurm_revision fail:", err)
+		return nil, err
+	}
+	belogs.Debug("getSlurmRevisionsDb(): len(slurmRevisionModels):", len(slurmRevisionModels))
+	return slurmRevisionModels, nil
+}
+
+func getSlurmRevisionDb(revisionId uint64) (labRpkiSlurmRevision model.LabRpkiSlurmRevision, has bool, err error) {
+	sql := `select id, action, slurmLogId, rollbackRevisionId, author, comment, revisionTime, activeSlurmLogIds, entries
+		from lab_rpki_slurm_revision where id = ? `
+	has, err = xormdb.XormEngine.SQL(sql, revisionId).Get(&labRpkiSlurmRevision)
+	if err != nil {
+		belogs.Error("getSlurmRevisionDb(): select lab_rpki_slurm_revision fail, revisionId:", revisionId, err)
+		return labRpkiSlurmRevision, false, err
+	}
+	return labRpkiSlurmRevision, has, nil
+}
+
+// slurmRows: map[slurmLogId]map[slurmLogFileId][]slurmRow, they are all slurm logs active in the revision
+func rollbackSlurmDb(revisionId uint64, slurmRows map[uint64]map[uint64][]slurmRow, author, comment string) (err error) {
+	start := time.Now()
+	session, err := xormdb.NewSession()
+	if err != nil {
+		belogs.Error("rollbackSlurmDb(): NewSession fail :", err)
+		return err
+	}
+	defer session.Close()
+
+	activeSlurmLogIds := make([]uint64, 0)
+	err = session.SQL(`select id from lab_rpki_slurm_log where state = ? `, SLURM_LOG_STATE_ACTIVE).Find(&activeSlurmLogIds)
+	if err != nil {
+		belogs.Error("rollbackSlurmDb(): select lab_rpki_slurm_log fail:", err)
+		return xormdb.RollbackAndLogError(session, "rollbackSlurmDb(): select lab_rpki_slurm_log fail: ", err)
+	}
+	for _, activeSlurmLogId := range activeSlurmLogIds {
+		if _, ok := slurmRows[activeSlurmLogId]; ok {
+			continue
+		}
+		_, err = session.Exec(`update lab_rpki_slurm_log set state = ?, deactivateTime = ? where id = ? `,
+			SLURM_LOG_STATE_INACTIVE, start, activeSlurmLogId)
+		if err != nil {
+			belogs.Error("rollbackSlurmDb(): deactivate lab_rpki_slurm_log fail, slurmLogId:", activeSlurmLogId, err)
+			return xormdb.RollbackAndLogError(session, "rollbackSlurmDb(): deactivate lab_rpki_slurm_log fail: ", err)
+		}
+	}
+
+	// all rows will be inserted again
+	_, err = session.Exec(`delete from lab_rpki_slurm`)
+	if err != nil {
+		belogs.Error("rollbackSlurmDb(): delete lab_rpki_slurm fail:", err)
+		return xormdb.RollbackAndLogError(session, "rollbackSlurmDb(): delete lab_rpki_slurm fail: ", err)
+	}
+	count := 0
+	for slurmLogId, rows := range slurmRows {
+		_, err = session.Exec(`update lab_rpki_slurm_log set state = ?, activateTime = ? where id = ? and state != ? `,
+			SLURM_LOG_STATE_ACTIVE, start, slurmLogId, SLURM_LOG_STATE_ACTIVE)
+		if err != nil {
+			belogs.Error("rollbackSlurmDb(): activate lab_rpki_slurm_log fail, slurmLogId:", slurmLogId, err)
+			return xormdb.RollbackAndLogError(session, "rollbackSlurmDb(): activate lab_rpki_slurm_log fail: ", err)
+		}
+		c, err := insertSlurmRowsDb(session, slurmLogId, rows)
+		if err != nil {
+			belogs.Error("rollbackSlurmDb(): insertSlurmRowsDb fail, slurmLogId:", slurmLogId, err)
+			return xormdb.RollbackAndLogError(session, "rollbackSlurmDb(): insertSlurmRowsDb fail: ", err)
+		}
+		count += c
+	}
+
+	err = insertSlurmRevisionDb(session, SLURM_REVISION_ACTION_ROLLBACK, null.Int{}, null.IntFrom(int64(revisionId)),
+		author, comment, start)
+	if err != nil {
+		belogs.Error("rollbackSlurmDb(): insertSlurmRevisionDb fail, revisionId:", revisionId, err)
+		return xormdb.RollbackAndLogError(session, "rollbackSlurmDb(): insertSlurmRevisionDb fail: ", err)
+	}
+	err = xormdb.CommitSession(session)
+	if err != nil {
+		belogs.Error("rollbackSlurmDb(): CommitSession fail :", err)
+		return xormdb.RollbackAndLogError(session, "rollbackSlurmDb(): CommitSession fail: ", err)
+	}
+	belogs.Info("rollbackSlurmDb(): CommitSession ok, revisionId:", revisionId, "  len(slurmRows):", len(slurmRows),
+		"  count:", count, "  time(s):", time.Since(start))
+	return nil
+}
+
+// vrps from valid roas, before slurm
+func getRoaVrpsDb() (slurmVrps []SlurmVrp, err error) {
+	start := time.Now()
+	slurmVrps = make([]SlurmVrp, 0)
+	sql := `select distinct r.asn as asn,
+			substring_index( i.addressPrefix, '/', 1 ) as address,
+			substring_index( i.addressPrefix, '/', -1 ) as prefixLength,
+			i.maxLength as maxLength
+		from lab_rpki_roa r, lab_rpki_roa_ipaddress i
+		where i.roaId = r.id and r.state->'$.state' in ('valid','warning') `
+	err = xormdb.XormEngine.SQL(sql).Find(&slurmVrps)
+	if err != nil {
+		belogs.Error("getRoaVrpsDb(): select lab_rpki_roa fail:", err)
+		return nil, err
+	}
+	belogs.Info("getRoaVrpsDb(): len(slurmVrps):", len(slurmVrps), "  time(s):", time.Since(start))
+	return slurmVrps, nil
+}
@@ -0,0 +1,361 @@
+package slurm
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/netip"
+	"strconv"
+
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/guregu/null"
+	model "rpstir2-model"
+)
+
+// validate every file, and check overlap among files(rfc8416 4.2)
+func ValidateSlurmFiles(slurmUploadFiles []SlurmUploadFile) (slurmValidateResults []SlurmValidateResult, valid bool) {
+	_, slurmValidateResults, valid = validateSlurmFiles(slurmUploadFiles)
+	return slurmValidateResults, valid
+}
+
+func validateSlurmFiles(slurmUploadFiles []SlurmUploadFile) (slurmFiles []slurmFile, slurmValidateResults []SlurmValidateResult, valid bool) {
+	slurmFiles = make([]slurmFile, 0, len(slurmUploadFiles))
+	slurmValidateResults = make([]SlurmValidateResult, 0, len(slurmUploadFiles))
+	valid = true
+	for i := range slurmUploadFiles {
+		slurm, slurmValidateResult := ValidateSlurmFile(slurmUploadFiles[i].FileName, slurmUploadFiles[i].Content)
+		slurmValidateResults = append(slurmValidateResults, slurmValidateResult)
+		if len(slurmValidateResult.Errors) > 0 {
+			valid = false
+			continue
+		}
+		slurmFiles = append(slurmFiles, slurmFile{fileName: slurmUploadFiles[i].FileName,
+			content: slurmUploadFiles[i].Content, slurm: slurm})
+	}
+	if !valid {
+		return nil, slurmValidateResults, false
+	}
+
+	overlaps := checkSlurmOverlap(slurmFiles)
+	for i := range overlaps {
+		for j := range slurmValidateResults {
+			if slurmValidateResults[j].FileName == overlaps[i].fileName {
+				slurmValidateResults[j].Errors = append(slurmValidateResults[j].Errors, overlaps[i].err)
+			}
+		}
+	}
+	if len(overlaps) > 0 {
+		return nil, slurmValidateResults, false
+	}
+	return slurmFiles, slurmValidateResults, true
+}
+
+// schema, slurmVersion, prefix/maxLength, asn, ski and afiLimit
+func ValidateSlurmFile(fileName string, content []byte) (slurm *model.Slurm, slurmValidateResult SlurmValidateResult) {
+	slurmValidateResult.FileName = fileName
+	slurmValidateResult.Errors = make([]string, 0)
+
+	slurm, errs := parseSlurm(content)
+	if len(errs) > 0 {
+		belogs.Debug("ValidateSlurmFile(): parseSlurm fail, fileName:", fileName, errs)
+		slurmValidateResult.Errors = errs
+		return nil, slurmValidateResult
+	}
+	slurmValidateResult.SlurmVersion = slurm.SlurmVersion
+	slurmValidateResult.PrefixFilterCount = len(slurm.ValidationOutputFilters.PrefixFilters)
+	slurmValidateResult.BgpsecFilterCount = len(slurm.ValidationOutputFilters.BgpsecFilters)
+	slurmValidateResult.AspaFilterCount = len(slurm.ValidationOutputFilters.AspaFilters)
+	slurmValidateResult.PrefixAssertionCount = len(slurm.LocallyAddedAssertions.PrefixAssertions)
+	slurmValidateResult.BgpsecAssertionCount = len(slurm.LocallyAddedAssertions.BgpsecAssertions)
+	slurmValidateResult.AspaAssertionCount = len(slurm.LocallyAddedAssertions.AspaAssertions)
+
+	slurmValidateResult.Errors = validateSlurm(slurm)
+	if len(slurmValidateResult.Errors) > 0 {
+		belogs.Debug("ValidateSlurmFile(): validateSlurm fail, fileName:", fileName, slurmValidateResult.Errors)
+		return nil, slurmValidateResult
+	}
+	return slurm, slurmValidateResult
+}
+
+// rfc8416 3.1: all members are required, and no other member is allowed
+func parseSlurm(content []byte) (slurm *model.Slurm, errs []string) {
+	var top map[string]json.RawMessage
+	err := json.Unmarshal(content, &top)
+	if err != nil {
+		return nil, []string{"slurm is not json object: " + err.Error()}
+	}
+	errs = checkMembers("", top, []string{"slurmVersion", "validationOutputFilters", "locallyAddedAssertions"})
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	var slurmVersion int
+	err = json.Unmarshal(top["slurmVersion"], &slurmVersion)
+	if err != nil || (slurmVersion != SLURM_VERSION_1 && slurmVersion != SLURM_VERSION_2) {
+		return nil, []string{"slurmVersion " + string(top["slurmVersion"]) + " is not supported, should be 1 or 2"}
+	}
+	filterMembers := []string{"prefixFilters", "bgpsecFilters"}
+	assertionMembers := []string{"prefixAssertions", "bgpsecAssertions"}
+	if slurmVersion == SLURM_VERSION_2 {
+		filterMembers = append(filterMembers, "aspaFilters")
+		assertionMembers = append(assertionMembers, "aspaAssertions")
+	}
+	for _, m := range []struct {
+		name    string
+		members []string
+	}{{"validationOutputFilters", filterMembers}, {"locallyAddedAssertions", assertionMembers}} {
+		var obj map[string]json.RawMessage
+		err = json.Unmarshal(top[m.name], &obj)
+		if err != nil {
+			errs = append(errs, m.name+" is not json object")
+			continue
+		}
+		errs = append(errs, checkMembers(m.name+".", obj, m.members)...)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	slurm = new(model.Slurm)
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(slurm)
+	if err != nil {
+		return nil, []string{"slurm is wrong: " + err.Error()}
+	}
+	return slurm, nil
+}
+
+func checkMembers(path string, obj map[string]json.RawMessage, members []string) (errs []string) {
+	errs = make([]string, 0)
+	for _, member := range members {
+		if _, ok := obj[member]; !ok {
+			errs = append(errs, path+member+" is required")
+		}
+	}
+	for name := range obj {
+		known := false
+		for _, member := range members {
+			if name == member {
+				known = true
+				break
+			}
+		}
+		if !known {
+			errs = append(errs, path+name+" is not allowed")
+		}
+	}
+	return errs
+}
+
+func validateSlurm(slurm *model.Slurm) (errs []string) {
+	errs = make([]string, 0)
+	addErr := func(path string, i int, err error) {
+		errs = append(errs, path+"["+strconv.Itoa(i)+"]: "+err.Error())
+	}
+
+	for i, f := range slurm.ValidationOutputFilters.PrefixFilters {
+		// rfc8416 3.3.1: at least one of prefix and asn
+		if len(f.Prefix) == 0 && !f.Asn.Valid {
+			addErr("prefixFilters", i, errors.New("one of prefix and asn is required"))
+			continue
+		}
+		if f.Asn.Valid {
+			if err := checkAsn(f.Asn); err != nil {
+				addErr("prefixFilters", i, err)
+			}
+		}
+		if len(f.Prefix) > 0 {
+			if _, err := checkPrefix(f.Prefix, f.MaxPrefixLength); err != nil {
+				addErr("prefixFilters", i, err)
+			}
+		} else if f.MaxPrefixLength > 0 {
+			addErr("prefixFilters", i, errors.New("maxPrefixLength without prefix"))
+		}
+	}
+	for i, f := range slurm.ValidationOutputFilters.BgpsecFilters {
+		if len(f.SKI) == 0 && !f.Asn.Valid {
+			addErr("bgpsecFilters", i, errors.New("one of SKI and asn is required"))
+			continue
+		}
+		if f.Asn.Valid {
+			if err := checkAsn(f.Asn); err != nil {
+				addErr("bgpsecFilters", i, err)
+			}
+		}
+		if len(f.SKI) > 0 {
+			if err := checkSki(f.SKI); err != nil {
+				addErr("bgpsecFilters", i, err)
+			}
+		}
+	}
+	for i, f := range slurm.ValidationOutputFilters.AspaFilters {
+		if err := checkAspa(f.CustomerAsn, f.ProviderAsns, false); err != nil {
+			addErr("aspaFilters", i, err)
+		}
+	}
+
+	for i, a := range slurm.LocallyAddedAssertions.PrefixAssertions {
+		if err := checkAsn(a.Asn); err != nil {
+			addErr("prefixAssertions", i, err)
+		}
+		if len(a.Prefix) == 0 {
+			addErr("prefixAssertions", i, errors.New("prefix is required"))
+		} else if _, err := checkPrefix(a.Prefix, a.MaxPrefixLength); err != nil {
+			addErr("prefixAssertions", i, err)
+		}
+	}
+	for i, a := range slurm.LocallyAddedAssertions.BgpsecAssertions {
+		if err := checkAsn(a.Asn); err != nil {
+			addErr("bgpsecAssertions", i, err)
+		}
+		if err := checkSki(a.SKI); err != nil {
+			addErr("bgpsecAssertions", i, err)
+		}
+		if b, err := base64.RawURLEncoding.DecodeString(a.RouterPublicKey); err != nil || len(b) == 0 {
+			addErr("bgpsecAssertions", i, errors.New("routerPublicKey "+a.RouterPublicKey+" is not base64url"))
+		}
+	}
+	for i, a := range slurm.LocallyAddedAssertions.AspaAssertions {
+		if err := checkAspa(a.CustomerAsn, a.ProviderAsns, true); err != nil {
+			addErr("aspaAssertions", i, err)
+		}
+	}
+	return errs
+}
+
+func checkAsn(asn null.Int) error {
+	if !asn.Valid {
+		return errors.New("asn is required")
+	}
+	if asn.Int64 < 0 || asn.Int64 > math.MaxUint32 {
+		return errors.New("asn " + strconv.FormatInt(asn.Int64, 10) + " is out of range 0-4294967295")
+	}
+	return nil
+}
+
+// prefix should not have host bits, maxPrefixLength should be in prefixLength-32/128
+func checkPrefix(prefix string, maxPrefixLength uint64) (netip.Prefix, error) {
+	p, err := netip.ParsePrefix(prefix)
+	if err != nil {
+		return p, errors.New("prefix " + prefix + " is wrong")
+	}
+	if p.Masked() != p {
+		return p, errors.New("prefix " + prefix + " has host bits, should be " + p.Masked().String())
+	}
+	if maxPrefixLength > 0 && (maxPrefixLength < uint64(p.Bits()) || maxPrefixLength > uint64(p.Addr().BitLen())) {
+		return p, errors.New("maxPrefixLength " + strconv.FormatUint(maxPrefixLength, 10) + " of prefix " + prefix +
+			" should be in " + strconv.Itoa(p.Bits()) + "-" + strconv.Itoa(p.Addr().BitLen()))
+	}
+	return p, nil
+}
+
+// rfc8416 3.3.2: base64url of 20 octets ski, without trailing '='
+func checkSki(ski string) error {
+	b, err := base64.RawURLEncoding.DecodeString(ski)
+	if err != nil || len(b) != 20 {
+		return errors.New("SKI " + ski + " is not base64url of 20 octets")
+	}
+	return nil
+}
+
+func checkAspa(customerAsn null.Int, providerAsns []model.ProviderAsns, isAssertion bool) error {
+	if err := checkAsn(customerAsn); err != nil {
+		return errors.New("customerAsid: " + err.Error())
+	}
+	if isAssertion && len(providerAsns) == 0 {
+		return errors.New("providers is required")
+	}
+	for _, p := range providerAsns {
+		if err := checkAsn(p.ProviderAsn); err != nil {
+			return errors.New("providerAsid: " + err.Error())
+		}
+		if isAssertion && p.ProviderAsn.Int64 == customerAsn.Int64 {
+			return errors.New("providerAsid " + strconv.FormatInt(p.ProviderAsn.Int64, 10) + " is the same as customerAsid")
+		}
+		if p.AddressFamily != "" && p.AddressFamily != model.SLURM_PROVIDER_ASNS_ADDRESS_FAMILY_IPV4 &&
+			p.AddressFamily != model.SLURM_PROVIDER_ASNS_ADDRESS_FAMILY_IPV6 {
+			return errors.New("afiLimit " + p.AddressFamily + " should be IPv4 or IPv6")
+		}
+	}
+	return nil
+}
+
+type slurmOverlap struct {
+	fileName string
+	err      string
+}
+
+// rfc8416 4.2: prefixes, bgpsec asns and aspa customer asns in one file should not overlap with other files
+func checkSlurmOverlap(slurmFiles []slurmFile) (overlaps []slurmOverlap) {
+	overlaps = make([]slurmOverlap, 0)
+	type prefixOwner struct {
+		prefix   netip.Prefix
+		fileName string
+	}
+	prefixOwners := make([]prefixOwner, 0)
+	bgpsecAsnOwners := make(map[int64]string)
+	aspaAsnOwners := make(map[int64]string)
+	for i := range slurmFiles {
+		slurm := slurmFiles[i].slurm
+		fileName := slurmFiles[i].fileName
+		prefixes := make([]netip.Prefix, 0)
+		for _, f := range slurm.ValidationOutputFilters.PrefixFilters {
+			if p, err := netip.ParsePrefix(f.Prefix); err == nil {
+				prefixes = append(prefixes, p)
+			}
+		}
+		for _, a := range slurm.LocallyAddedAssertions.PrefixAssertions {
+			if p, err := netip.ParsePrefix(a.Prefix); err == nil {
+				prefixes = append(prefixes, p)
+			}
+		}
+		for _, p := range prefixes {
+			for _, o := range prefixOwners {
+				if o.fileName != fileName && o.prefix.Overlaps(p) {
+					overlaps = append(overlaps, slurmOverlap{fileName: fileName,
+						err: "prefix " + p.String() + " overlaps with " + o.prefix.String() + " in " + o.fileName})
+				}
+			}
+		}
+		for _, p := range prefixes {
+			prefixOwners = append(prefixOwners, prefixOwner{prefix: p, fileName: fileName})
+		}
+
+		bgpsecAsns := make(map[int64]struct{})
+		for _, f := range slurm.ValidationOutputFilters.BgpsecFilters {
+			if f.Asn.Valid {
+				bgpsecAsns[f.Asn.Int64] = struct{}{}
+			}
+		}
+		for _, a := range slurm.LocallyAddedAssertions.BgpsecAssertions {
+			bgpsecAsns[a.Asn.Int64] = struct{}{}
+		}
+		aspaAsns := make(map[int64]struct{})
+		for _, f := range slurm.ValidationOutputFilters.AspaFilters {
+			aspaAsns[f.CustomerAsn.Int64] = struct{}{}
+		}
+		for _, a := range slurm.LocallyAddedAssertions.AspaAssertions {
+			aspaAsns[a.CustomerAsn.Int64] = struct{}{}
+		}
+		for asn := range bgpsecAsns {
+			if owner, ok := bgpsecAsnOwners[asn]; ok && owner != fileName {
+				overlaps = append(overlaps, slurmOverlap{fileName: fileName,
+					err: "bgpsec asn " + strconv.FormatInt(asn, 10) + " is also in " + owner})
+			} else {
+				bgpsecAsnOwners[asn] = fileName
+			}
+		}
+		for asn := range aspaAsns {
+			if owner, ok := aspaAsnOwners[asn]; ok && owner != fileName {
+				overlaps = append(overlaps, slurmOverlap{fileName: fileName,
+					err: "aspa customerAsid " + strconv.FormatInt(asn, 10) + " is also in " + owner})
+			} else {
+				aspaAsnOwners[asn] = fileName
+			}
+		}
+	}
+	return overlaps
+}
@@ -0,0 +1,71 @@
+package slurm
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestValidateSlurmFiles(t *testing.T) {
+	slurm1 := `{
+  "slurmVersion": 1,
+  "validationOutputFilters": {
+    "prefixFilters": [
+      {"prefix": "192.0.2.0/24", "comment": "All VRPs encompassed by prefix"},
+      {"asn": 64496, "comment": "All VRPs matching ASN"}
+    ],
+    "bgpsecFilters": [
+      {"asn": 64496, "SKI": "Zm9vYmFyYmF6cXV4cXV1eHF1dXg", "comment": "Key matching Router SKI"}
+    ]
+  },
+  "locallyAddedAssertions": {
+    "prefixAssertions": [
+      {"asn": 64496, "prefix": "198.51.100.0/24", "comment": "My other important route"},
+      {"asn": 64496, "prefix": "2001:DB8::/32", "maxPrefixLength": 48, "comment": "My other important de-aggregated routes"}
+    ],
+    "bgpsecAssertions": []
+  }
+}`
+	slurm2 := `{
+  "slurmVersion": 2,
+  "validationOutputFilters": {"prefixFilters": [], "bgpsecFilters": [], "aspaFilters": [{"customerAsid": 64497}]},
+  "locallyAddedAssertions": {
+    "prefixAssertions": [{"asn": 64497, "prefix": "203.0.113.0/24"}],
+    "bgpsecAssertions": [],
+    "aspaAssertions": [{"customerAsid": 64498, "providers": [{"providerAsid": 64499, "afiLimit": "IPv4"}]}]
+  }
+}`
+	results, valid := ValidateSlurmFiles([]SlurmUploadFile{{FileName: "1.json", Content: []byte(slurm1)},
+		{FileName: "2.json", Content: []byte(slurm2)}})
+	fmt.Println(results)
+	if !valid || results[0].PrefixAssertionCount != 2 || results[1].AspaAssertionCount != 1 {
+		t.Fatal("should be valid", results)
+	}
+
+	wrongs := map[string]string{
+		"version":   `{"slurmVersion": 3, "validationOutputFilters": {"prefixFilters": [], "bgpsecFilters": []}, "locallyAddedAssertions": {"prefixAssertions": [], "bgpsecAssertions": []}}`,
+		"missing":   `{"slurmVersion": 1, "validationOutputFilters": {"prefixFilters": []}, "locallyAddedAssertions": {"prefixAssertions": [], "bgpsecAssertions": []}}`,
+		"aspaInV1":  `{"slurmVersion": 1, "validationOutputFilters": {"prefixFilters": [], "bgpsecFilters": [], "aspaFilters": []}, "locallyAddedAssertions": {"prefixAssertions": [], "bgpsecAssertions": []}}`,
+		"unknown":   `{"slurmVersion": 1, "validationOutputFilters": {"prefixFilters": [{"prefix": "192.0.2.0/24", "foo": 1}], "bgpsecFilters": []}, "locallyAddedAssertions": {"prefixAssertions": [], "bgpsecAssertions": []}}`,
+		"hostBits":  `{"slurmVersion": 1, "validationOutputFilters": {"prefixFilters": [{"prefix": "192.0.2.1/24"}], "bgpsecFilters": []}, "locallyAddedAssertions": {"prefixAssertions": [], "bgpsecAssertions": []}}`,
+		"maxLength": `{"slurmVersion": 1, "validationOutputFilters": {"prefixFilters": [], "bgpsecFilters": []}, "locallyAddedAssertions": {"prefixAssertions": [{"asn": 1, "prefix": "192.0.2.0/24", "maxPrefixLength": 33}], "bgpsecAssertions": []}}`,
+		"asn":       `{"slurmVersion": 1, "validationOutputFilters": {"prefixFilters": [], "bgpsecFilters": []}, "locallyAddedAssertions": {"prefixAssertions": [{"asn": 4294967296, "prefix": "192.0.2.0/24"}], "bgpsecAssertions": []}}`,
+		"noAsn":     `{"slurmVersion": 1, "validationOutputFilters": {"prefixFilters": [], "bgpsecFilters": []}, "locallyAddedAssertions": {"prefixAssertions": [{"prefix": "192.0.2.0/24"}], "bgpsecAssertions": []}}`,
+		"ski":       `{"slurmVersion": 1, "validationOutputFilters": {"prefixFilters": [], "bgpsecFilters": [{"SKI": "Zm9v"}]}, "locallyAddedAssertions": {"prefixAssertions": [], "bgpsecAssertions": []}}`,
+	}
+	for name, wrong := range wrongs {
+		_, result := ValidateSlurmFile(name, []byte(wrong))
+		fmt.Println(name, result.Errors)
+		if len(result.Errors) == 0 {
+			t.Fatal("should be invalid:", name)
+		}
+	}
+
+	// 192.0.2.0/25 overlaps with 192.0.2.0/24 in 1.json
+	overlap := `{"slurmVersion": 1, "validationOutputFilters": {"prefixFilters": [], "bgpsecFilters": []}, "locallyAddedAssertions": {"prefixAssertions": [{"asn": 64511, "prefix": "192.0.2.0/25"}], "bgpsecAssertions": []}}`
+	results, valid = ValidateSlurmFiles([]SlurmUploadFile{{FileName: "1.json", Content: []byte(slurm1)},
+		{FileName: "3.json", Content: []byte(overlap)}})
+	fmt.Println(results)
+	if valid || len(results[1].Errors) != 1 {
+		t.Fatal("should overlap", results)
+	}
+}
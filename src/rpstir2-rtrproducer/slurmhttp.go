@@ -0,0 +1,261 @@
+package rtrproducer
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/ginserver"
+	"github.com/cpusoft/goutil/jsonutil"
+	"github.com/gin-gonic/gin"
+	rtrslurm "rpstir2-rtrproducer/slurm"
+	rtrsync "rpstir2-rtrproducer/sync"
+)
+
+// max size of one slurm file
+const slurmFileMaxSize = 64 * 1024 * 1024
+
+// only validate, not save. upload one or more files by multipart, the field name is "file"
+func SlurmValidate(c *gin.Context) {
+	belogs.Info("SlurmValidate(): http start")
+
+	slurmUploadFiles, err := receiveSlurmFiles(c)
+	if err != nil {
+		belogs.Error("SlurmValidate(): receiveSlurmFiles fail:", err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	slurmValidateResults, valid := rtrslurm.ValidateSlurmFiles(slurmUploadFiles)
+	belogs.Info("SlurmValidate(): http valid:", valid, "  slurmValidateResults:", jsonutil.MarshalJson(slurmValidateResults))
+	if !valid {
+		ginserver.ResponseFail(c, errors.New("slurm files are invalid"), slurmValidateResults)
+		return
+	}
+	ginserver.ResponseOk(c, slurmValidateResults)
+}
+
+// dry run against current vrps/aspas, not save. upload one or more files by multipart, the field name is "file"
+func SlurmLint(c *gin.Context) {
+	belogs.Info("SlurmLint(): http start")
+
+	slurmUploadFiles, err := receiveSlurmFiles(c)
+	if err != nil {
+		belogs.Error("SlurmLint(): receiveSlurmFiles fail:", err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	slurmLintResult, err := rtrslurm.LintSlurmFiles(slurmUploadFiles)
+	if err != nil {
+		belogs.Error("SlurmLint(): LintSlurmFiles fail:", jsonutil.MarshalJson(slurmLintResult.SlurmValidateResult), err)
+		ginserver.ResponseFail(c, err, slurmLintResult)
+		return
+	}
+	belogs.Info("SlurmLint(): http ok, vrpCountChange:", slurmLintResult.VrpCountChange,
+		"  aspaCountChange:", slurmLintResult.AspaCountChange, "  len(Conflicts):", len(slurmLintResult.Conflicts))
+	ginserver.ResponseOk(c, slurmLintResult)
+}
+
+// validate and save, "note" in form is optional. it will not be active until /rtrproducer/slurm/activate
+func SlurmUpload(c *gin.Context) {
+	belogs.Info("SlurmUpload(): http start")
+
+	slurmUploadFiles, err := receiveSlurmFiles(c)
+	if err != nil {
+		belogs.Error("SlurmUpload(): receiveSlurmFiles fail:", err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	slurmUploadResult, err := rtrslurm.UploadSlurmFiles(slurmUploadFiles, c.PostForm("note"))
+	if err != nil {
+		belogs.Error("SlurmUpload(): UploadSlurmFiles fail:", jsonutil.MarshalJson(slurmUploadResult), err)
+		ginserver.ResponseFail(c, err, slurmUploadResult)
+		return
+	}
+	belogs.Info("SlurmUpload(): http ok, slurmUploadResult:", jsonutil.MarshalJson(slurmUploadResult))
+	ginserver.ResponseOk(c, slurmUploadResult)
+}
+
+// {"slurmLogId":1,"author":"","comment":""}, then new serial will be generated
+func SlurmActivate(c *gin.Context) {
+	belogs.Info("SlurmActivate(): http start")
+
+	slurmLogRequest := rtrslurm.SlurmLogRequest{}
+	err := c.ShouldBindJSON(&slurmLogRequest)
+	if err != nil {
+		belogs.Error("SlurmActivate(): ShouldBindJSON fail:", err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	// slurm cannot be changed while sync or rtr is running
+	err = enterSlurmServiceState()
+	if err != nil {
+		belogs.Error("SlurmActivate(): enterSlurmServiceState fail:", err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	err = rtrslurm.ActivateSlurm(slurmLogRequest.SlurmLogId, slurmLogRequest.Author, slurmLogRequest.Comment)
+	if err != nil {
+		leaveSlurmServiceState()
+		belogs.Error("SlurmActivate(): ActivateSlurm fail:", jsonutil.MarshalJson(slurmLogRequest), err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	go rtrRebuildBySlurm()
+	belogs.Info("SlurmActivate(): http ok, slurmLogRequest:", jsonutil.MarshalJson(slurmLogRequest))
+	ginserver.ResponseOk(c, nil)
+}
+
+// {"slurmLogId":1,"author":"","comment":""}, then new serial will be generated
+func SlurmDeactivate(c *gin.Context) {
+	belogs.Info("SlurmDeactivate(): http start")
+
+	slurmLogRequest := rtrslurm.SlurmLogRequest{}
+	err := c.ShouldBindJSON(&slurmLogRequest)
+	if err != nil {
+		belogs.Error("SlurmDeactivate(): ShouldBindJSON fail:", err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	// slurm cannot be changed while sync or rtr is running
+	err = enterSlurmServiceState()
+	if err != nil {
+		belogs.Error("SlurmDeactivate(): enterSlurmServiceState fail:", err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	err = rtrslurm.DeactivateSlurm(slurmLogRequest.SlurmLogId, slurmLogRequest.Author, slurmLogRequest.Comment)
+	if err != nil {
+		leaveSlurmServiceState()
+		belogs.Error("SlurmDeactivate(): DeactivateSlurm fail:", jsonutil.MarshalJson(slurmLogRequest), err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	go rtrRebuildBySlurm()
+	belogs.Info("SlurmDeactivate(): http ok, slurmLogRequest:", jsonutil.MarshalJson(slurmLogRequest))
+	ginserver.ResponseOk(c, nil)
+}
+
+// all uploaded slurms and their states
+func SlurmList(c *gin.Context) {
+	belogs.Debug("SlurmList(): http start")
+
+	slurmLogModels, err := rtrslurm.GetSlurmLogs()
+	if err != nil {
+		belogs.Error("SlurmList(): GetSlurmLogs fail:", err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	ginserver.ResponseOk(c, slurmLogModels)
+}
+
+// all revisions of active slurm, latest first
+func SlurmRevisionList(c *gin.Context) {
+	belogs.Debug("SlurmRevisionList(): http start")
+
+	slurmRevisionModels, err := rtrslurm.GetSlurmRevisions()
+	if err != nil {
+		belogs.Error("SlurmRevisionList(): GetSlurmRevisions fail:", err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	ginserver.ResponseOk(c, slurmRevisionModels)
+}
+
+// {"fromRevisionId":1,"toRevisionId":2}, fromRevisionId is 0 means no slurm
+func SlurmRevisionDiff(c *gin.Context) {
+	belogs.Info("SlurmRevisionDiff(): http start")
+
+	slurmRevisionDiffRequest := rtrslurm.SlurmRevisionDiffRequest{}
+	err := c.ShouldBindJSON(&slurmRevisionDiffRequest)
+	if err != nil {
+		belogs.Error("SlurmRevisionDiff(): ShouldBindJSON fail:", err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	slurmRevisionDiff, err := rtrslurm.DiffSlurmRevisions(slurmRevisionDiffRequest.FromRevisionId, slurmRevisionDiffRequest.ToRevisionId)
+	if err != nil {
+		belogs.Error("SlurmRevisionDiff(): DiffSlurmRevisions fail:", jsonutil.MarshalJson(slurmRevisionDiffRequest), err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	ginserver.ResponseOk(c, slurmRevisionDiff)
+}
+
+// {"revisionId":1,"author":"","comment":""}, then new serial will be generated
+func SlurmRollback(c *gin.Context) {
+	belogs.Info("SlurmRollback(): http start")
+
+	slurmRollbackRequest := rtrslurm.SlurmRollbackRequest{}
+	err := c.ShouldBindJSON(&slurmRollbackRequest)
+	if err != nil {
+		belogs.Error("SlurmRollback(): ShouldBindJSON fail:", err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	// slurm cannot be changed while sync or rtr is running
+	err = enterSlurmServiceState()
+	if err != nil {
+		belogs.Error("SlurmRollback(): enterSlurmServiceState fail:", err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	err = rtrslurm.RollbackSlurm(slurmRollbackRequest.RevisionId, slurmRollbackRequest.Author, slurmRollbackRequest.Comment)
+	if err != nil {
+		leaveSlurmServiceState()
+		belogs.Error("SlurmRollback(): RollbackSlurm fail:", jsonutil.MarshalJson(slurmRollbackRequest), err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	go rtrRebuildBySlurm()
+	belogs.Info("SlurmRollback(): http ok, slurmRollbackRequest:", jsonutil.MarshalJson(slurmRollbackRequest))
+	ginserver.ResponseOk(c, nil)
+}
+
+// updatefromslurm only adds effect of current slurms, so rebuild from roa/asa and all active slurms,
+// the incrementals will include both the new and the removed slurms.
+// it is called after enterSlurmServiceState, and leaves "slurm" of service state at the end
+func rtrRebuildBySlurm() {
+	defer leaveSlurmServiceState()
+	newSerialNumber, err := rtrsync.RtrRebuild()
+	if err != nil {
+		belogs.Error("rtrRebuildBySlurm(): RtrRebuild fail:", err)
+		return
+	}
+	publishRtrUpdateBySlurm(newSerialNumber)
+}
+
+func receiveSlurmFiles(c *gin.Context) (slurmUploadFiles []rtrslurm.SlurmUploadFile, err error) {
+	form, err := c.MultipartForm()
+	if err != nil {
+		belogs.Error("receiveSlurmFiles(): MultipartForm fail:", err)
+		return nil, err
+	}
+	fileHeaders := form.File["file"]
+	if len(fileHeaders) == 0 {
+		return nil, errors.New("there is no slurm file")
+	}
+	slurmUploadFiles = make([]rtrslurm.SlurmUploadFile, 0, len(fileHeaders))
+	for _, fileHeader := range fileHeaders {
+		if fileHeader.Size > slurmFileMaxSize {
+			return nil, errors.New("slurm file " + fileHeader.Filename + " is too large")
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			belogs.Error("receiveSlurmFiles(): Open fail:", fileHeader.Filename, err)
+			return nil, err
+		}
+		content, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			belogs.Error("receiveSlurmFiles(): ReadAll fail:", fileHeader.Filename, err)
+			return nil, err
+		}
+		slurmUploadFiles = append(slurmUploadFiles, rtrslurm.SlurmUploadFile{
+			FileName: filepath.Base(fileHeader.Filename),
+			Content:  content,
+		})
+	}
+	belogs.Debug("receiveSlurmFiles(): len(slurmUploadFiles):", len(slurmUploadFiles))
+	return slurmUploadFiles, nil
+}
@@ -8,7 +8,9 @@ import (
 	"golang.org/x/sync/errgroup"
 	rtrasa "rpstir2-rtrproducer/asa"
 	rtrcommon "rpstir2-rtrproducer/common"
+	rtrpreview "rpstir2-rtrproducer/preview"
 	rtrroa "rpstir2-rtrproducer/roa"
+	rtrrouterkey "rpstir2-rtrproducer/routerkey"
 )
 
 // 1. get all slurm (including had published to rtr)
@@ -16,35 +18,75 @@ import (
 // 3. start tx: save new roa to db; filter by all slurm; commit tx
 // 4. send rtr notify to router
 // 5. transfer incr to vc
-func RtrUpdateFromSync() (nextStep string, err error) {
+func RtrUpdateFromSync() (nextStep string, newSerialNumber uint64, err error) {
 	start := time.Now()
 	belogs.Info("RtrUpdateFromSync():start")
-	var g errgroup.Group
 	// update lab_rpki_sync_log set rtring
 	labRpkiSyncLogId, err := updateRsyncLogRtrStateStartDb("rtring")
 	if err != nil {
 		belogs.Error("RtrUpdateFromSync():updateRsyncLogRtrStateStartDb fail:", err, "  time(s):", time.Since(start))
-		return "", err
+		return "", 0, err
 	}
 	belogs.Info("RtrUpdateFromSync(): labRpkiSyncLogId:", labRpkiSyncLogId, "  time(s):", time.Since(start))
 
+	newSerialNumber, err = RtrRebuild()
+	if err != nil {
+		belogs.Error("RtrUpdateFromSync():RtrRebuild fail:", err, "  time(s):", time.Since(start))
+		return "", 0, err
+	}
+
+	// update state
+	err = updateRsyncLogRtrStateEndDb(labRpkiSyncLogId, "rtred")
+	if err != nil {
+		belogs.Error("RtrUpdateFromSync():updateRsyncLogRtrStateEndDb fail: newSerialNumber, labRpkiSyncLogId: ",
+			newSerialNumber, labRpkiSyncLogId, err, "  time(s):", time.Since(start))
+		return "", 0, err
+	}
+	belogs.Info("RtrUpdateFromSync(): updateRsyncLogRtrStateEndDb,  labRpkiSyncLogId:", labRpkiSyncLogId, "  time(s):", time.Since(start))
+
+	// get next step
+	nextStep, err = getNextStep()
+	if err != nil {
+		belogs.Error("RtrUpdateFromSync():getNextStep fail:", err, "  time(s):", time.Since(start))
+		return "", 0, err
+	}
+
+	belogs.Info("RtrUpdateFromSync():nextStep:", nextStep, " newSerialNumber:", newSerialNumber,
+		"  time(s):", time.Since(start))
+
+	belogs.Info("Synchronization and validation processes are completed!!!")
+	return nextStep, newSerialNumber, nil
+}
+
+// new serialNumber is built from all roa/asa and all active slurms, so removed slurms are also in incrementals.
+// it is used by sync and by changes of slurm
+func RtrRebuild() (newSerialNumber uint64, err error) {
+	start := time.Now()
+	belogs.Info("RtrRebuild():start")
+	var g errgroup.Group
+
 	//get serialNumber
 	curSerialNumberModel, newSerialNumberModel, err := getCurAndNewSerialNumberModel()
 	if err != nil {
-		belogs.Error("RtrUpdateFromSync():getCurAndNewSerialNumberModel fail:", err, "  time(s):", time.Since(start))
-		return "", err
+		belogs.Error("RtrRebuild():getCurAndNewSerialNumberModel fail:", err, "  time(s):", time.Since(start))
+		return 0, err
 	}
-	belogs.Info("RtrUpdateFromSync(): curSerialNumberModel:", jsonutil.MarshalJson(curSerialNumberModel),
+	belogs.Info("RtrRebuild(): curSerialNumberModel:", jsonutil.MarshalJson(curSerialNumberModel),
 		"    newSerialNumberModel:", jsonutil.MarshalJson(newSerialNumberModel), "  time(s):", time.Since(start))
 
+	// when rtr::previewEnable or rtr::brakeEnable, roa and asa will be published after preview is approved or brake is released
+	previewGate := rtrpreview.NewPreviewGate(curSerialNumberModel.SerialNumber, newSerialNumberModel.SerialNumber)
+
 	// roa+slurm --> rtrfull/rtrfullog/rtrincr
 	g.Go(func() error {
-		err1 := rtrroa.RtrUpdateByRoaFromSync(curSerialNumberModel, newSerialNumberModel)
+		err1 := rtrroa.RtrUpdateByRoaFromSync(curSerialNumberModel, newSerialNumberModel, previewGate)
 		if err1 != nil {
-			belogs.Error("RtrUpdateFromSync():RtrUpdateByRoaFromSync fail:", err, "  time(s):", time.Since(start))
+			// asa may be waiting for preview
+			previewGate.Abort(err1)
+			belogs.Error("RtrRebuild():RtrUpdateByRoaFromSync fail:", err1, "  time(s):", time.Since(start))
 			return err1
 		}
-		belogs.Info("RtrUpdateFromSync(): RtrUpdateByRoaFromSync pass, curSerialNumberModel:", jsonutil.MarshalJson(curSerialNumberModel),
+		belogs.Info("RtrRebuild(): RtrUpdateByRoaFromSync pass, curSerialNumberModel:", jsonutil.MarshalJson(curSerialNumberModel),
 			"    newSerialNumberModel:", jsonutil.MarshalJson(newSerialNumberModel), "  time(s):", time.Since(start))
 		return nil
 
@@ -52,43 +94,54 @@ func RtrUpdateFromSync() (nextStep string, err error) {
 
 	// asa --> rtrasafull/rtrasafulllog/rtrasaincr
 	g.Go(func() error {
-		err1 := rtrasa.RtrUpdateByAsaFromSync(curSerialNumberModel, newSerialNumberModel)
+		err1 := rtrasa.RtrUpdateByAsaFromSync(curSerialNumberModel, newSerialNumberModel, previewGate)
 		if err1 != nil {
-			belogs.Error("RtrUpdateFromSync(): RtrUpdateByAsaFromSync fail:", err, "  time(s):", time.Since(start))
+			// roa may be waiting for preview
+			previewGate.Abort(err1)
+			belogs.Error("RtrRebuild(): RtrUpdateByAsaFromSync fail:", err1, "  time(s):", time.Since(start))
 			return err1
 		}
-		belogs.Info("RtrUpdateFromSync(): RtrUpdateByAsaFromSync pass, curSerialNumberModel:", jsonutil.MarshalJson(curSerialNumberModel),
+		belogs.Info("RtrRebuild(): RtrUpdateByAsaFromSync pass, curSerialNumberModel:", jsonutil.MarshalJson(curSerialNumberModel),
 			"    newSerialNumberModel:", jsonutil.MarshalJson(newSerialNumberModel), "  time(s):", time.Since(start))
 
 		return nil
 	})
 
-	if err := g.Wait(); err != nil {
-		belogs.Error("RtrUpdateFromSync(): fail, err:", err, "   time(s):", time.Since(start))
-		return "", err
-	}
+	// bgpsec slurm --> rtrrouterkeyfull/rtrrouterkeyfulllog/rtrrouterkeyincr
+	g.Go(func() error {
+		err1 := rtrrouterkey.RtrUpdateRouterKey(curSerialNumberModel, newSerialNumberModel, previewGate)
+		if err1 != nil {
+			// roa and asa may be waiting for preview
+			previewGate.Abort(err1)
+			belogs.Error("RtrRebuild(): RtrUpdateRouterKey fail:", err1, "  time(s):", time.Since(start))
+			return err1
+		}
+		belogs.Info("RtrRebuild(): RtrUpdateRouterKey pass, curSerialNumberModel:", jsonutil.MarshalJson(curSerialNumberModel),
+			"    newSerialNumberModel:", jsonutil.MarshalJson(newSerialNumberModel), "  time(s):", time.Since(start))
+		return nil
+	})
 
-	// update state
-	err = updateRsyncLogRtrStateEndDb(labRpkiSyncLogId, "rtred")
-	if err != nil {
-		belogs.Error("RtrUpdateFromSync():updateRsyncLogRtrStateEndDb fail: newSerialNumber, labRpkiSyncLogId: ",
-			jsonutil.MarshalJson(newSerialNumberModel), labRpkiSyncLogId, err, "  time(s):", time.Since(start))
-		return "", err
+	if err := g.Wait(); err != nil {
+		belogs.Error("RtrRebuild(): fail, err:", err, "   time(s):", time.Since(start))
+		// keep serving previous serial
+		if previewGate.IsDiscarded() {
+			err1 := rtrcommon.DeleteRtrFullLogsBySerialNumberDb(newSerialNumberModel.SerialNumber)
+			if err1 != nil {
+				belogs.Error("RtrRebuild(): DeleteRtrFullLogsBySerialNumberDb fail, newSerialNumber:", newSerialNumberModel.SerialNumber, err1)
+			}
+		}
+		return 0, err
 	}
-	belogs.Info("RtrUpdateFromSync(): updateRsyncLogRtrStateEndDb,  labRpkiSyncLogId:", labRpkiSyncLogId, "  time(s):", time.Since(start))
 
-	// get next step
-	nextStep, err = getNextStep()
+	// only full log of checkpoint and new serialNumber are kept
+	err = rtrcommon.CompactRtrFullLogDb(curSerialNumberModel.SerialNumber)
 	if err != nil {
-		belogs.Error("RtrUpdateFromSync():getNextStep fail:", err, "  time(s):", time.Since(start))
-		return "", err
+		belogs.Error("RtrRebuild(): CompactRtrFullLogDb fail, curSerialNumber:", curSerialNumberModel.SerialNumber, err)
+		// no return
 	}
 
-	belogs.Info("RtrUpdateFromSync():nextStep:", nextStep, " newSerialNumber:", newSerialNumberModel.SerialNumber,
-		"  time(s):", time.Since(start))
-
-	belogs.Info("Synchronization and validation processes are completed!!!")
-	return nextStep, nil
+	belogs.Info("RtrRebuild(): newSerialNumber:", newSerialNumberModel.SerialNumber, "  time(s):", time.Since(start))
+	return newSerialNumberModel.SerialNumber, nil
 }
 
 func getCurAndNewSerialNumberModel() (curSerialNumberModel, newSerialNumberModel *rtrcommon.SerialNumberModel, err error) {
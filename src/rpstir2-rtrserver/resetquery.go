@@ -52,14 +52,14 @@ func ParseToResetQuery(buf *bytes.Reader, protocolVersion uint8) (rtrPduModel Rt
 }
 
 func ProcessResetQuery(rtrPduModel RtrPduModel) (resetResponses []RtrPduModel, err error) {
-	rtrFulls, rtrAsaFulls, sessionId, serialNumber, err := getRtrFullAndSessionIdAndSerialNumberDb()
+	rtrFulls, rtrAsaFulls, rtrRouterKeyFulls, sessionId, serialNumber, err := getRtrFullAndSessionIdAndSerialNumberDb()
 	if err != nil {
 		belogs.Error("ProcessResetQuery(): GetRtrFullAndSerialNumAndSessionId fail: ", err)
 		return resetResponses, err
 	}
-	belogs.Debug("ProcessResetQuery(): len(rtrFulls):", len(rtrFulls), " sessionId:", sessionId,
+	belogs.Debug("ProcessResetQuery(): len(rtrFulls):", len(rtrFulls), " len(rtrRouterKeyFulls):", len(rtrRouterKeyFulls), " sessionId:", sessionId,
 		" serialNumber: ", serialNumber)
-	rtrPduModels, err := assembleResetResponses(rtrFulls, rtrAsaFulls, rtrPduModel.GetProtocolVersion(), sessionId, serialNumber)
+	rtrPduModels, err := assembleResetResponses(rtrFulls, rtrAsaFulls, rtrRouterKeyFulls, rtrPduModel.GetProtocolVersion(), sessionId, serialNumber)
 	if err != nil {
 		belogs.Error("ProcessResetQuery(): assembleResetResponses fail: ", err)
 		return resetResponses, err
@@ -67,15 +67,21 @@ func ProcessResetQuery(rtrPduModel RtrPduModel) (resetResponses []RtrPduModel, e
 	return rtrPduModels, nil
 }
 
-// when len(rtrFull)==0, it is an error with no_data_available
+// when len(rtrFull)==0, it is an error with no_data_available.
+// router key is since protocolVersion 1(rfc8210)
 func assembleResetResponses(rtrFulls []model.LabRpkiRtrFull, rtrAsaFulls []model.LabRpkiRtrAsaFull,
+	rtrRouterKeyFulls []model.LabRpkiRtrRouterKeyFull,
 	protocolVersion uint8, sessionId uint16, serialNumber uint32) (rtrPduModels []RtrPduModel, err error) {
 	belogs.Info("assembleResetResponses(): len(rtrFulls):", len(rtrFulls), " len(rtrAsaFulls):", len(rtrAsaFulls),
+		" len(rtrRouterKeyFulls):", len(rtrRouterKeyFulls),
 		"   protocolVersion:", protocolVersion, "   sessionId:", sessionId, "   serialNumber:", serialNumber)
 	rtrPduModels = make([]RtrPduModel, 0)
 	//rtr full from roa rtr
 	if protocolVersion == PDU_PROTOCOL_VERSION_0 || protocolVersion == PDU_PROTOCOL_VERSION_1 {
-		if len(rtrFulls) > 0 {
+		if protocolVersion == PDU_PROTOCOL_VERSION_0 {
+			rtrRouterKeyFulls = nil
+		}
+		if len(rtrFulls) > 0 || len(rtrRouterKeyFulls) > 0 {
 			belogs.Debug("assembleResetResponses(): protocolVersion=0 or 1, len(rtrFulls)>0, len(rtrFulls): ", len(rtrFulls),
 				"  protocolVersion:", protocolVersion, "   sessionId:", sessionId, "   serialNumber:", serialNumber)
 
@@ -93,6 +99,14 @@ func assembleResetResponses(rtrFulls []model.LabRpkiRtrFull, rtrAsaFulls []model
 			rtrPduModels = append(rtrPduModels, rtrFullPduModels...)
 			belogs.Debug("assembleResetResponses(): protocolVersion=0 or 1, len(rtrFullPduModels) : ", len(rtrFullPduModels))
 
+			// rtr router key full to response
+			rtrRouterKeyFullPduModels, err := convertRtrRouterKeyFullsToRtrPduModels(rtrRouterKeyFulls, protocolVersion)
+			if err != nil {
+				belogs.Error("assembleResetResponses(): protocolVersion=0 or 1, convertRtrRouterKeyFullsToRtrPduModels fail: ", err)
+				return nil, err
+			}
+			rtrPduModels = append(rtrPduModels, rtrRouterKeyFullPduModels...)
+
 			// end response
 			endOfDataModel := assembleEndOfDataResponse(protocolVersion, sessionId, serialNumber)
 			rtrPduModels = append(rtrPduModels, endOfDataModel)
@@ -113,7 +127,7 @@ func assembleResetResponses(rtrFulls []model.LabRpkiRtrFull, rtrAsaFulls []model
 		}
 	} else if protocolVersion == PDU_PROTOCOL_VERSION_2 {
 		//rtr full from asa rtr
-		if len(rtrFulls) > 0 || len(rtrAsaFulls) > 0 {
+		if len(rtrFulls) > 0 || len(rtrAsaFulls) > 0 || len(rtrRouterKeyFulls) > 0 {
 			belogs.Debug("assembleResetResponses(): protocolVersion=2, len(rtrFulls):", len(rtrFulls), " len(rtrAsaFulls): ", len(rtrAsaFulls),
 				"  protocolVersion:", protocolVersion, "   sessionId:", sessionId, "   serialNumber:", serialNumber)
 
@@ -140,6 +154,14 @@ func assembleResetResponses(rtrFulls []model.LabRpkiRtrFull, rtrAsaFulls []model
 			rtrPduModels = append(rtrPduModels, rtrAsaFullPduModels...)
 			belogs.Debug("assembleResetResponses(): len(rtrAsaFullPduModels) : ", len(rtrAsaFullPduModels))
 
+			// rtr router key full to response
+			rtrRouterKeyFullPduModels, err := convertRtrRouterKeyFullsToRtrPduModels(rtrRouterKeyFulls, protocolVersion)
+			if err != nil {
+				belogs.Error("assembleResetResponses(): convertRtrRouterKeyFullsToRtrPduModels fail: ", err)
+				return nil, err
+			}
+			rtrPduModels = append(rtrPduModels, rtrRouterKeyFullPduModels...)
+
 			// end response
 			endOfDataModel := assembleEndOfDataResponse(protocolVersion, sessionId, serialNumber)
 			rtrPduModels = append(rtrPduModels, endOfDataModel)
@@ -230,3 +252,19 @@ func convertRtrAsaFullsToRtrPduModels(rtrAsaFulls []model.LabRpkiRtrAsaFull,
 		" len(rtrAsaPduModels):", len(rtrAsaPduModels), "  time(s):", time.Since(start))
 	return rtrAsaPduModels, nil
 }
+
+func convertRtrRouterKeyFullsToRtrPduModels(rtrRouterKeyFulls []model.LabRpkiRtrRouterKeyFull,
+	protocolVersion uint8) (rtrPduModels []RtrPduModel, err error) {
+	rtrPduModels = make([]RtrPduModel, 0, len(rtrRouterKeyFulls))
+	for i := range rtrRouterKeyFulls {
+		rtrPduModel, err := NewRtrRouterKeyModelFromDb(protocolVersion, PDU_FLAG_ANNOUNCE, rtrRouterKeyFulls[i].Ski,
+			uint32(rtrRouterKeyFulls[i].Asn), rtrRouterKeyFulls[i].RouterPublicKey)
+		if err != nil {
+			belogs.Error("convertRtrRouterKeyFullsToRtrPduModels(): NewRtrRouterKeyModelFromDb fail: ", jsonutil.MarshalJson(rtrRouterKeyFulls[i]), err)
+			return nil, err
+		}
+		rtrPduModels = append(rtrPduModels, rtrPduModel)
+	}
+	belogs.Debug("convertRtrRouterKeyFullsToRtrPduModels(): len(rtrRouterKeyFulls): ", len(rtrRouterKeyFulls), " len(rtrPduModels):", len(rtrPduModels))
+	return rtrPduModels, nil
+}
@@ -18,14 +18,14 @@ func ParseToRouterKey(buf *bytes.Reader, protocolVersion uint8) (rtrPduModel Rtr
 		Length               uint32   `json:"length"`
 		SubjectKeyIdentifier [20]byte `json:"subjectKeyIdentifier"`
 		Asn                  uint32   `json:"asn"`
-		SubjectPublicKeyInfo uint32   `json:"subjectPublicKeyInfo"`
+		SubjectPublicKeyInfo []byte   `json:"subjectPublicKeyInfo"`
 	*/
 	var flags uint8
 	var zero uint8
 	var length uint32
 	var subjectKeyIdentifier [20]byte
 	var asn uint32
-	var subjectPublicKeyInfo uint32
+	var subjectPublicKeyInfo []byte
 
 	// get flags
 	err = binary.Read(buf, binary.BigEndian, &flags)
@@ -67,6 +67,15 @@ func ParseToRouterKey(buf *bytes.Reader, protocolVersion uint8) (rtrPduModel Rtr
 			buf, "Fail to get length")
 		return rtrPduModel, rtrError
 	}
+	// header(8)+ski(20)+asn(4)+spki
+	if length <= 32 || int64(length)-8 > int64(buf.Len()) {
+		belogs.Error("ParseToRouterKey():PDU_TYPE_ROUTER_KEY, length must be more than 32 and not more than pdu, buf:", buf, "  length:", length)
+		rtrError := NewRtrError(
+			errors.New("pduType is ROUTER KEY, length must be more than 32 and not more than pdu"),
+			true, protocolVersion, PDU_TYPE_ERROR_CODE_CORRUPT_DATA,
+			buf, "Fail to get length")
+		return rtrPduModel, rtrError
+	}
 
 	// get subjectKeyIdentifier
 	err = binary.Read(buf, binary.BigEndian, &subjectKeyIdentifier)
@@ -91,6 +100,7 @@ func ParseToRouterKey(buf *bytes.Reader, protocolVersion uint8) (rtrPduModel Rtr
 	}
 
 	// get subjectPublicKeyInfo
+	subjectPublicKeyInfo = make([]byte, length-32)
 	err = binary.Read(buf, binary.BigEndian, &subjectPublicKeyInfo)
 	if err != nil {
 		belogs.Error("ParseToRouterKey(): PDU_TYPE_ROUTER_KEY get subjectPublicKeyInfo fail, buf:", buf, err)
@@ -2,7 +2,9 @@ package rtrserver
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/binary"
+	"errors"
 
 	"github.com/cpusoft/goutil/belogs"
 	"github.com/cpusoft/goutil/convert"
@@ -431,22 +433,42 @@ type RtrRouterKeyModel struct {
 	Length               uint32   `json:"length"`
 	SubjectKeyIdentifier [20]byte `json:"subjectKeyIdentifier"`
 	Asn                  uint32   `json:"asn"`
-	SubjectPublicKeyInfo uint32   `json:"subjectPublicKeyInfo"`
+	SubjectPublicKeyInfo []byte   `json:"subjectPublicKeyInfo"`
 }
 
 func NewRtrRouterKeyModel(protocolVersion uint8, flags uint8, subjectKeyIdentifier [20]byte,
-	asn uint32, subjectPublicKeyInfo uint32) *RtrRouterKeyModel {
+	asn uint32, subjectPublicKeyInfo []byte) *RtrRouterKeyModel {
+	// length: header(8)+ski(20)+asn(4)+spki
 	return &RtrRouterKeyModel{
 		ProtocolVersion:      protocolVersion,
 		PduType:              PDU_TYPE_ROUTER_KEY,
 		Flags:                flags,
 		Zero:                 0,
+		Length:               32 + uint32(len(subjectPublicKeyInfo)),
 		SubjectKeyIdentifier: subjectKeyIdentifier,
 		Asn:                  asn,
 		SubjectPublicKeyInfo: subjectPublicKeyInfo,
 	}
 }
 
+// ski and routerPublicKey in db are base64url without padding(rfc8416)
+func NewRtrRouterKeyModelFromDb(protocolVersion uint8, flags uint8, ski string,
+	asn uint32, routerPublicKey string) (*RtrRouterKeyModel, error) {
+	skiBytes, err := base64.RawURLEncoding.DecodeString(ski)
+	if err != nil || len(skiBytes) != 20 {
+		belogs.Error("NewRtrRouterKeyModelFromDb(): ski is not base64url of 20 bytes:", ski, err)
+		return nil, errors.New("ski is not base64url of 20 bytes: " + ski)
+	}
+	subjectPublicKeyInfo, err := base64.RawURLEncoding.DecodeString(routerPublicKey)
+	if err != nil || len(subjectPublicKeyInfo) == 0 {
+		belogs.Error("NewRtrRouterKeyModelFromDb(): routerPublicKey is not base64url:", routerPublicKey, err)
+		return nil, errors.New("routerPublicKey is not base64url: " + routerPublicKey)
+	}
+	subjectKeyIdentifier := [20]byte{}
+	copy(subjectKeyIdentifier[:], skiBytes)
+	return NewRtrRouterKeyModel(protocolVersion, flags, subjectKeyIdentifier, asn, subjectPublicKeyInfo), nil
+}
+
 func (p *RtrRouterKeyModel) Bytes() []byte {
 	wr := bytes.NewBuffer([]byte{})
 	binary.Write(wr, binary.BigEndian, p.ProtocolVersion)
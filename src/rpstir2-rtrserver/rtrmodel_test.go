@@ -1,6 +1,7 @@
 package rtrserver
 
 import (
+	"bytes"
 	"encoding/hex"
 	"fmt"
 	"testing"
@@ -16,3 +17,20 @@ func TestRtrPdu(t *testing.T) {
 	fmt.Println(convert.PrintBytes(erm.Bytes(), 8))
 
 }
+
+func TestRtrRouterKeyPdu(t *testing.T) {
+	// ski of 20 bytes, routerPublicKey is not a real key
+	rkm, err := NewRtrRouterKeyModelFromDb(1, PDU_FLAG_ANNOUNCE, "Zm9vYmFyYmF6cXV4cXV1eHF1dXg", 64496, "MFkwEwYHKoZIzj0CAQ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := rkm.Bytes()
+	fmt.Println(convert.PrintBytes(b, 8))
+	if int(rkm.Length) != len(b) {
+		t.Fatal("length should be", len(b), rkm.Length)
+	}
+	pdu, err := ParseToRouterKey(bytes.NewReader(b[2:]), 1)
+	if err != nil || jsonutil.MarshalJson(pdu) != jsonutil.MarshalJson(rkm) {
+		t.Fatal("parse fail:", jsonutil.MarshalJson(pdu), err)
+	}
+}
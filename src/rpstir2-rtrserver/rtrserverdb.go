@@ -38,14 +38,14 @@ func getSpanSerialNumbersDb(clientSerialNumber uint32) (serialNumbers []uint32,
 
 func getRtrIncrementalAndSessionIdAndSerialNumberDb(clientSerialNumber uint32) (
 	rtrIncrementals []model.LabRpkiRtrIncremental, rtrAsaIncrementals []model.LabRpkiRtrAsaIncremental,
-	sessionId uint16, serialNumber uint32, err error) {
+	rtrRouterKeyIncrementals []model.LabRpkiRtrRouterKeyIncremental, sessionId uint16, serialNumber uint32, err error) {
 
 	start := time.Now()
 	rtrIncrementals = make([]model.LabRpkiRtrIncremental, 0)
 	err = xormdb.XormEngine.Where("serialNumber > ?", clientSerialNumber).Find(&rtrIncrementals)
 	if err != nil {
 		belogs.Error("getRtrIncrementalAndSessionIdAndSerialNumberDb():get rtrIncrementals fail:  clientSerialNumber is ", clientSerialNumber, err)
-		return nil, nil, sessionId, serialNumber, err
+		return nil, nil, nil, sessionId, serialNumber, err
 	}
 	belogs.Debug("getRtrIncrementalAndSessionIdAndSerialNumberDb():select lab_rpki_rtr_incremental,clientSerialNumber, len(rtrIncrementals) :",
 		clientSerialNumber, len(rtrIncrementals))
@@ -54,32 +54,43 @@ func getRtrIncrementalAndSessionIdAndSerialNumberDb(clientSerialNumber uint32) (
 	err = xormdb.XormEngine.Where("serialNumber > ?", clientSerialNumber).Find(&rtrAsaIncrementals)
 	if err != nil {
 		belogs.Error("getRtrIncrementalAndSessionIdAndSerialNumberDb():get rtrAsaIncrementals fail:  clientSerialNumber is ", clientSerialNumber, err)
-		return nil, nil, sessionId, serialNumber, err
+		return nil, nil, nil, sessionId, serialNumber, err
 	}
 	belogs.Debug("getRtrIncrementalAndSessionIdAndSerialNumberDb():select lab_rpki_rtr_asa_incremental,clientSerialNumber, len(rtrAsaIncrementals) :",
 		clientSerialNumber, len(rtrAsaIncrementals))
 
+	rtrRouterKeyIncrementals = make([]model.LabRpkiRtrRouterKeyIncremental, 0)
+	err = xormdb.XormEngine.Table("lab_rpki_rtr_router_key_incremental").Where("serialNumber > ?", clientSerialNumber).
+		OrderBy("id").Find(&rtrRouterKeyIncrementals)
+	if err != nil {
+		belogs.Error("getRtrIncrementalAndSessionIdAndSerialNumberDb():get rtrRouterKeyIncrementals fail:  clientSerialNumber is ", clientSerialNumber, err)
+		return nil, nil, nil, sessionId, serialNumber, err
+	}
+	belogs.Debug("getRtrIncrementalAndSessionIdAndSerialNumberDb():select lab_rpki_rtr_router_key_incremental,clientSerialNumber, len(rtrRouterKeyIncrementals) :",
+		clientSerialNumber, len(rtrRouterKeyIncrementals))
+
 	sessionId, err = getSessionIdDb()
 	if err != nil {
 		belogs.Error("getRtrIncrementalAndSessionIdAndSerialNumberDb():getSessionIdDb fail:", err)
-		return nil, nil, sessionId, serialNumber, err
+		return nil, nil, nil, sessionId, serialNumber, err
 	}
 
 	// lab_rpki_rtr_serial_number, get serialNumber
 	serialNumber, err = getMaxSerialNumberDb()
 	if err != nil {
 		belogs.Error("getRtrIncrementalAndSessionIdAndSerialNumberDb():getMaxSerialNumberDb fail:", err)
-		return nil, nil, sessionId, serialNumber, err
+		return nil, nil, nil, sessionId, serialNumber, err
 	}
 
 	belogs.Info("getRtrIncrementalAndSessionIdAndSerialNumberDb():len(rtrIncrementals) :", len(rtrIncrementals),
+		"   len(rtrAsaIncrementals):", len(rtrAsaIncrementals), "   len(rtrRouterKeyIncrementals):", len(rtrRouterKeyIncrementals),
 		"   sessionId:", sessionId, "  serialNumber:", serialNumber,
 		"   clientSerialNumber:", clientSerialNumber, "  time(s):", time.Since(start))
-	return rtrIncrementals, rtrAsaIncrementals, sessionId, serialNumber, nil
+	return rtrIncrementals, rtrAsaIncrementals, rtrRouterKeyIncrementals, sessionId, serialNumber, nil
 }
 
 func getRtrFullAndSessionIdAndSerialNumberDb() (rtrFulls []model.LabRpkiRtrFull, rtrAsaFulls []model.LabRpkiRtrAsaFull,
-	sessionId uint16, serialNumber uint32, err error) {
+	rtrRouterKeyFulls []model.LabRpkiRtrRouterKeyFull, sessionId uint16, serialNumber uint32, err error) {
 	start := time.Now()
 	/*
 		sql := `select id, serialNumber, asn,address, prefixLength,maxLength
@@ -90,7 +101,7 @@ func getRtrFullAndSessionIdAndSerialNumberDb() (rtrFulls []model.LabRpkiRtrFull,
 		OrderBy("id").Find(&rtrFulls)
 	if err != nil {
 		belogs.Error("getRtrFullAndSessionIdAndSerialNumberDb():select  lab_rpki_rtr_full fail:", err)
-		return nil, nil, sessionId, serialNumber, err
+		return nil, nil, nil, sessionId, serialNumber, err
 	}
 	belogs.Debug("getRtrFullAndSessionIdAndSerialNumberDb():select lab_rpki_rtr_full, len :", len(rtrFulls))
 
@@ -99,26 +110,36 @@ func getRtrFullAndSessionIdAndSerialNumberDb() (rtrFulls []model.LabRpkiRtrFull,
 		OrderBy("id").Find(&rtrAsaFulls)
 	if err != nil {
 		belogs.Error("getRtrFullAndSessionIdAndSerialNumberDb():select  lab_rpki_rtr_asa_full fail:", err)
-		return nil, nil, sessionId, serialNumber, err
+		return nil, nil, nil, sessionId, serialNumber, err
 	}
 	belogs.Debug("getRtrFullAndSessionIdAndSerialNumberDb():select lab_rpki_rtr_asa_full, len :", len(rtrAsaFulls))
 
+	rtrRouterKeyFulls = make([]model.LabRpkiRtrRouterKeyFull, 0)
+	err = xormdb.XormEngine.Table("lab_rpki_rtr_router_key_full").Cols("id, serialNumber, asn, ski, routerPublicKey").
+		OrderBy("id").Find(&rtrRouterKeyFulls)
+	if err != nil {
+		belogs.Error("getRtrFullAndSessionIdAndSerialNumberDb():select  lab_rpki_rtr_router_key_full fail:", err)
+		return nil, nil, nil, sessionId, serialNumber, err
+	}
+	belogs.Debug("getRtrFullAndSessionIdAndSerialNumberDb():select lab_rpki_rtr_router_key_full, len :", len(rtrRouterKeyFulls))
+
 	// lab_rpki_rtr_serial_number, get serialNumber
 	serialNumber, err = getMaxSerialNumberDb()
 	if err != nil {
 		belogs.Error("getRtrFullAndSessionIdAndSerialNumberDb():getMaxSerialNumberDb fail:", err)
-		return nil, nil, sessionId, serialNumber, err
+		return nil, nil, nil, sessionId, serialNumber, err
 	}
 
 	sessionId, err = getSessionIdDb()
 	if err != nil {
 		belogs.Error("getRtrFullAndSessionIdAndSerialNumberDb():getSessionIdDb fail:", err)
-		return nil, nil, sessionId, serialNumber, err
+		return nil, nil, nil, sessionId, serialNumber, err
 	}
 	belogs.Info("getRtrFullAndSessionIdAndSerialNumberDb():len(rtrFulls) :", len(rtrFulls), "  len(rtrAsaFulls):", len(rtrAsaFulls),
+		"  len(rtrRouterKeyFulls):", len(rtrRouterKeyFulls),
 		"   sessionId:", sessionId, "  serialNumber:", serialNumber,
 		"   time(s):", time.Since(start))
-	return rtrFulls, rtrAsaFulls, sessionId, serialNumber, nil
+	return rtrFulls, rtrAsaFulls, rtrRouterKeyFulls, sessionId, serialNumber, nil
 }
 func getSessionIdAndSerialNumberDb() (sessionId uint16, serialNumber uint32, err error) {
 
@@ -111,15 +111,16 @@ func ProcessSerialQuery(rtrPduModel RtrPduModel) (serialResponses []RtrPduModel,
 		belogs.Debug("ProcessSerialQuery():server get  len(serialNumbers) >0 && <=2 , will send Cache Response of rtr incremental,",
 			" clientSessionId: ", clientSessionId, ", clientSerialNumber:", clientSerialNumber,
 			", len(serialNumbers): ", len(serialNumbers))
-		rtrIncrementals, rtrAsaIncrementals, sessionId, serialNumber, err := getRtrIncrementalAndSessionIdAndSerialNumberDb(clientSerialNumber)
+		rtrIncrementals, rtrAsaIncrementals, rtrRouterKeyIncrementals, sessionId, serialNumber, err := getRtrIncrementalAndSessionIdAndSerialNumberDb(clientSerialNumber)
 		if err != nil {
 			belogs.Error("ProcessSerialQuery(): len(serialNumbers) >0 && <=2,  getRtrIncrementalAndSessionIdAndSerialNumberDb fail: ", clientSerialNumber, err)
 			return nil, err
 		}
 		belogs.Debug("ProcessSerialQuery(): len(rtrIncrementals):", len(rtrIncrementals),
-			"  len(rtrAsaIncrementals):", len(rtrAsaIncrementals), "   sessionId:", sessionId, "  serialNumber:", serialNumber)
+			"  len(rtrAsaIncrementals):", len(rtrAsaIncrementals), "  len(rtrRouterKeyIncrementals):", len(rtrRouterKeyIncrementals),
+			"   sessionId:", sessionId, "  serialNumber:", serialNumber)
 
-		rtrPduModels, err := assembleSerialResponses(rtrIncrementals, rtrAsaIncrementals,
+		rtrPduModels, err := assembleSerialResponses(rtrIncrementals, rtrAsaIncrementals, rtrRouterKeyIncrementals,
 			rtrSerialQueryModel.GetProtocolVersion(), sessionId, serialNumber)
 		if err != nil {
 			belogs.Error("ProcessSerialQuery():server get len(serialNumbers) >0 && <=2 , assembleSerialResponses fail: ", err)
@@ -158,17 +159,22 @@ func needResetQuery(clientSessionId uint16, clientSerialNumber uint32) (serialNu
 
 }
 
-// when len(rtrIncrementals)==0, just return endofdata, it is not an error
+// when len(rtrIncrementals)==0, just return endofdata, it is not an error.
+// router key is since protocolVersion 1(rfc8210)
 func assembleSerialResponses(rtrIncrementals []model.LabRpkiRtrIncremental, rtrAsaIncrementals []model.LabRpkiRtrAsaIncremental,
+	rtrRouterKeyIncrementals []model.LabRpkiRtrRouterKeyIncremental,
 	protocolVersion uint8, sessionId uint16, serialNumber uint32) (rtrPduModels []RtrPduModel, err error) {
 
-	belogs.Info("assembleSerialResponses(): len(rtrIncrementals):", len(rtrIncrementals),
+	belogs.Info("assembleSerialResponses(): len(rtrIncrementals):", len(rtrIncrementals), "   len(rtrRouterKeyIncrementals):", len(rtrRouterKeyIncrementals),
 		"   protocolVersion:", protocolVersion, "   sessionId:", sessionId, "   serialNumber:", serialNumber)
 	rtrPduModels = make([]RtrPduModel, 0)
 
 	//rtr incr from roa rtr
 	if protocolVersion == PDU_PROTOCOL_VERSION_0 || protocolVersion == PDU_PROTOCOL_VERSION_1 {
-		if len(rtrIncrementals) > 0 {
+		if protocolVersion == PDU_PROTOCOL_VERSION_0 {
+			rtrRouterKeyIncrementals = nil
+		}
+		if len(rtrIncrementals) > 0 || len(rtrRouterKeyIncrementals) > 0 {
 			belogs.Debug("assembleSerialResponses(): protocolVersion=0 or 1, len(rtrIncrementals)>0, len(rtrIncrementals): ", len(rtrIncrementals),
 				"  protocolVersion:", protocolVersion, "   sessionId:", sessionId, "   serialNumber:", serialNumber)
 
@@ -186,6 +192,14 @@ func assembleSerialResponses(rtrIncrementals []model.LabRpkiRtrIncremental, rtrA
 			rtrPduModels = append(rtrPduModels, rtrIncrementalPduModels...)
 			belogs.Debug("assembleSerialResponses(): protocolVersion=0 or 1, len(rtrIncrementalPduModels) : ", len(rtrIncrementalPduModels))
 
+			// rtr router key incr to response
+			rtrRouterKeyIncrementalPduModels, err := convertRtrRouterKeyIncrementalsToRtrPduModels(rtrRouterKeyIncrementals, protocolVersion)
+			if err != nil {
+				belogs.Error("assembleSerialResponses(): protocolVersion=0 or 1, convertRtrRouterKeyIncrementalsToRtrPduModels fail: ", err)
+				return nil, err
+			}
+			rtrPduModels = append(rtrPduModels, rtrRouterKeyIncrementalPduModels...)
+
 			// end response
 			endOfDataModel := assembleEndOfDataResponse(protocolVersion, sessionId, serialNumber)
 			rtrPduModels = append(rtrPduModels, endOfDataModel)
@@ -207,7 +221,7 @@ func assembleSerialResponses(rtrIncrementals []model.LabRpkiRtrIncremental, rtrA
 		}
 	} else if protocolVersion == PDU_PROTOCOL_VERSION_2 {
 		//rtr incr from asa rtr
-		if len(rtrIncrementals) > 0 || len(rtrAsaIncrementals) > 0 {
+		if len(rtrIncrementals) > 0 || len(rtrAsaIncrementals) > 0 || len(rtrRouterKeyIncrementals) > 0 {
 			belogs.Debug("assembleSerialResponses(): protocolVersion=2, len(rtrIncrementals)>0, len(rtrIncrementals): ", len(rtrIncrementals),
 				"  protocolVersion:", protocolVersion, "   sessionId:", sessionId, "   serialNumber:", serialNumber)
 
@@ -234,6 +248,14 @@ func assembleSerialResponses(rtrIncrementals []model.LabRpkiRtrIncremental, rtrA
 			rtrPduModels = append(rtrPduModels, rtrAsaIncrementalPduModels...)
 			belogs.Debug("assembleSerialResponses(): len(rtrAsaIncrementalPduModels) : ", len(rtrAsaIncrementalPduModels))
 
+			// rtr router key incr to response
+			rtrRouterKeyIncrementalPduModels, err := convertRtrRouterKeyIncrementalsToRtrPduModels(rtrRouterKeyIncrementals, protocolVersion)
+			if err != nil {
+				belogs.Error("assembleSerialResponses(): convertRtrRouterKeyIncrementalsToRtrPduModels fail: ", err)
+				return nil, err
+			}
+			rtrPduModels = append(rtrPduModels, rtrRouterKeyIncrementalPduModels...)
+
 			// end response
 			endOfDataModel := assembleEndOfDataResponse(protocolVersion, sessionId, serialNumber)
 			rtrPduModels = append(rtrPduModels, endOfDataModel)
@@ -325,3 +347,19 @@ func convertRtrAsaIncrementalsToRtrPduModels(rtrAsaIncrementals []model.LabRpkiR
 
 	return rtrAsaPduModels, nil
 }
+
+func convertRtrRouterKeyIncrementalsToRtrPduModels(rtrRouterKeyIncrementals []model.LabRpkiRtrRouterKeyIncremental,
+	protocolVersion uint8) (rtrPduModels []RtrPduModel, err error) {
+	rtrPduModels = make([]RtrPduModel, 0, len(rtrRouterKeyIncrementals))
+	for i := range rtrRouterKeyIncrementals {
+		rtrPduModel, err := NewRtrRouterKeyModelFromDb(protocolVersion, getModelFlagsFromStyle(rtrRouterKeyIncrementals[i].Style),
+			rtrRouterKeyIncrementals[i].Ski, uint32(rtrRouterKeyIncrementals[i].Asn), rtrRouterKeyIncrementals[i].RouterPublicKey)
+		if err != nil {
+			belogs.Error("convertRtrRouterKeyIncrementalsToRtrPduModels(): NewRtrRouterKeyModelFromDb fail: ", jsonutil.MarshalJson(rtrRouterKeyIncrementals[i]), err)
+			return nil, err
+		}
+		rtrPduModels = append(rtrPduModels, rtrPduModel)
+	}
+	belogs.Debug("convertRtrRouterKeyIncrementalsToRtrPduModels(): len(rtrRouterKeyIncrementals): ", len(rtrRouterKeyIncrementals), " len(rtrPduModels):", len(rtrPduModels))
+	return rtrPduModels, nil
+}
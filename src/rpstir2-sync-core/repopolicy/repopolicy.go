@@ -0,0 +1,155 @@
+package repopolicy
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/conf"
+	"github.com/cpusoft/goutil/jsonutil"
+	model "rpstir2-model"
+)
+
+var repoPolicy *RepoPolicy
+var repoPolicyMutex sync.RWMutex
+
+// load sync::repoPolicyFile again, it is called at startup and by /entiresync/repo/policy/reload, count of rules is reset.
+// when it fails, current policy is still used. empty sync::repoPolicyFile means no rule
+func ReloadRepoPolicy() (err error) {
+	start := time.Now()
+	policyFile := conf.String("sync::repoPolicyFile")
+	newRepoPolicy := &RepoPolicy{}
+	if len(policyFile) > 0 {
+		b, err := os.ReadFile(policyFile)
+		if err != nil {
+			belogs.Error("ReloadRepoPolicy(): ReadFile fail:", policyFile, err)
+			return err
+		}
+		err = jsonutil.UnmarshalJson(string(b), newRepoPolicy)
+		if err != nil {
+			belogs.Error("ReloadRepoPolicy(): UnmarshalJson fail:", policyFile, err)
+			return err
+		}
+	}
+	err = compileRepoPolicy(newRepoPolicy)
+	if err != nil {
+		belogs.Error("ReloadRepoPolicy(): compileRepoPolicy fail:", policyFile, err)
+		return err
+	}
+	newRepoPolicy.LoadTime = time.Now()
+
+	repoPolicyMutex.Lock()
+	repoPolicy = newRepoPolicy
+	repoPolicyMutex.Unlock()
+	model.SetOriginRules(newRepoPolicy.Origin)
+	belogs.Info("ReloadRepoPolicy(): policyFile:", policyFile, "  len(rrdp):", len(newRepoPolicy.Rrdp),
+		"  len(rsync):", len(newRepoPolicy.Rsync), "  len(origin):", len(newRepoPolicy.Origin), "  time(s):", time.Since(start))
+	return nil
+}
+
+// current policy and count of every rule
+func GetRepoPolicy() RepoPolicy {
+	repoPolicyMutex.RLock()
+	defer repoPolicyMutex.RUnlock()
+	if repoPolicy == nil {
+		return RepoPolicy{}
+	}
+	cp := RepoPolicy{LoadTime: repoPolicy.LoadTime, Origin: repoPolicy.Origin}
+	cp.Rrdp = copyRepoPolicyRules(repoPolicy.Rrdp)
+	cp.Rsync = copyRepoPolicyRules(repoPolicy.Rsync)
+	return cp
+}
+
+// rsync:// is checked by rsync rules, others are checked by rrdp rules.
+// when it is denied, reason has comment of the rule
+func CheckRepoUrl(repoUrl string) (allow bool, reason string) {
+	repoPolicyMutex.RLock()
+	defer repoPolicyMutex.RUnlock()
+	if repoPolicy == nil {
+		return true, ""
+	}
+	rules := repoPolicy.Rrdp
+	if strings.HasPrefix(repoUrl, "rsync://") {
+		rules = repoPolicy.Rsync
+	}
+	rule := matchRepoPolicyRules(rules, repoUrl, time.Now())
+	if rule == nil {
+		return true, ""
+	}
+	atomic.AddUint64(&rule.Count, 1)
+	if rule.Action == "deny" {
+		belogs.Info("CheckRepoUrl(): url is denied:", repoUrl, "  by rule:", jsonutil.MarshalJson(rule))
+		return false, "denied by repository policy: " + rule.Comment
+	}
+	belogs.Debug("CheckRepoUrl(): url is allowed:", repoUrl, "  by rule:", jsonutil.MarshalJson(rule))
+	return true, ""
+}
+
+func compileRepoPolicy(policy *RepoPolicy) (err error) {
+	for _, rules := range [][]*RepoPolicyRule{policy.Rrdp, policy.Rsync} {
+		for _, rule := range rules {
+			if rule.Action != "allow" && rule.Action != "deny" {
+				return errors.New("action of rule should be allow or deny: " + rule.Action)
+			}
+			if len(rule.Host) == 0 && len(rule.Prefix) == 0 && len(rule.Regex) == 0 {
+				return errors.New("one of host, prefix and regex of rule should be set: " + rule.Comment)
+			}
+			if len(rule.Comment) == 0 {
+				return errors.New("comment of rule should be set")
+			}
+			rule.Host = strings.ToLower(rule.Host)
+			rule.Count = 0
+			if len(rule.Regex) > 0 {
+				rule.regex, err = regexp.Compile(rule.Regex)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for _, originRule := range policy.Origin {
+		if len(originRule.Path) == 0 || len(originRule.Rir) == 0 {
+			return errors.New("path and rir of origin should be set: " + originRule.Path)
+		}
+	}
+	return nil
+}
+
+func matchRepoPolicyRules(rules []*RepoPolicyRule, repoUrl string, now time.Time) *RepoPolicyRule {
+	var host string
+	if u, err := url.Parse(repoUrl); err == nil {
+		host = strings.ToLower(u.Hostname())
+	}
+	for _, rule := range rules {
+		if !rule.Expire.IsZero() && now.After(rule.Expire) {
+			continue
+		}
+		if len(rule.Host) > 0 && host != rule.Host && !strings.HasSuffix(host, "."+rule.Host) {
+			continue
+		}
+		if len(rule.Prefix) > 0 && !strings.HasPrefix(repoUrl, rule.Prefix) {
+			continue
+		}
+		if rule.regex != nil && !rule.regex.MatchString(repoUrl) {
+			continue
+		}
+		return rule
+	}
+	return nil
+}
+
+func copyRepoPolicyRules(rules []*RepoPolicyRule) []*RepoPolicyRule {
+	cp := make([]*RepoPolicyRule, 0, len(rules))
+	for _, rule := range rules {
+		r := *rule
+		r.Count = atomic.LoadUint64(&rule.Count)
+		cp = append(cp, &r)
+	}
+	return cp
+}
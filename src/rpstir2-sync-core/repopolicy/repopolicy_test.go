@@ -0,0 +1,61 @@
+package repopolicy
+
+import (
+	"testing"
+	"time"
+
+	model "rpstir2-model"
+)
+
+func TestMatchRepoPolicyRules(t *testing.T) {
+	now := time.Now()
+	policy := &RepoPolicy{
+		Rrdp: []*RepoPolicyRule{
+			{Action: "deny", Host: "localhost", Comment: "local address"},
+			{Action: "allow", Prefix: "https://rrdp.example.net/good/", Comment: "good repository"},
+			{Action: "deny", Host: "example.net", Comment: "bad host"},
+			{Action: "deny", Regex: `notify\.xml$`, Comment: "expired", Expire: now.Add(-time.Hour)},
+		},
+	}
+	err := compileRepoPolicy(policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		url     string
+		comment string
+	}{
+		{"https://localhost/notification.xml", "local address"},
+		{"https://rrdp.example.net/good/notification.xml", "good repository"},
+		{"https://rrdp.example.net/bad/notification.xml", "bad host"},
+		{"https://example.net/notification.xml", "bad host"},
+		{"https://notexample.net/notification.xml", ""},
+		{"https://ca.rg.net/rrdp/notify.xml", ""},
+	}
+	for _, test := range tests {
+		rule := matchRepoPolicyRules(policy.Rrdp, test.url, now)
+		comment := ""
+		if rule != nil {
+			comment = rule.Comment
+		}
+		if comment != test.comment {
+			t.Fatal(test.url, "should match:", test.comment, "  but:", comment)
+		}
+	}
+
+	err = compileRepoPolicy(&RepoPolicy{Rsync: []*RepoPolicyRule{{Action: "deny", Host: "localhost"}}})
+	if err == nil {
+		t.Fatal("rule without comment should fail")
+	}
+}
+
+func TestCompileRepoPolicyOrigin(t *testing.T) {
+	err := compileRepoPolicy(&RepoPolicy{Origin: []model.OriginRule{{Path: "rpki.example.net"}}})
+	if err == nil {
+		t.Fatal("origin without rir should fail")
+	}
+	err = compileRepoPolicy(&RepoPolicy{Origin: []model.OriginRule{{Path: "rpki.example.net", Rir: model.ORIGIN_RIR_ARIN}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
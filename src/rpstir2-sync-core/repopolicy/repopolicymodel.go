@@ -0,0 +1,44 @@
+package repopolicy
+
+import (
+	"regexp"
+	"time"
+
+	model "rpstir2-model"
+)
+
+// policy of repositories, in sync::repoPolicyFile:
+// {"rrdp":[{"action":"deny","host":"localhost","comment":"local address"}],"rsync":[...]}
+type RepoPolicy struct {
+	// rules of notification url of rrdp(https://, rrdp://)
+	Rrdp []*RepoPolicyRule `json:"rrdp"`
+	// rules of rsync url (rsync://)
+	Rsync []*RepoPolicyRule `json:"rsync"`
+	// rir and repo of local file path
+	Origin []model.OriginRule `json:"origin"`
+	// when it is loaded
+	LoadTime time.Time `json:"loadTime"`
+}
+
+// rules are checked in order, and the first rule which matches url and is not expired decides.
+// one or more of host/prefix/regex should be set, and all of them should match.
+// url which matches no rule is allowed
+type RepoPolicyRule struct {
+	// allow/deny
+	Action string `json:"action"`
+	// host or its sub domain: "example.net" matches "rpki.example.net"
+	Host string `json:"host"`
+	// prefix of url: "https://ca.rg.net/rrdp/"
+	Prefix string `json:"prefix"`
+	// regular expression of url
+	Regex string `json:"regex"`
+	// why this rule is added, it is required
+	Comment string `json:"comment"`
+	// rule is ignored after expire, zero is never expired
+	Expire time.Time `json:"expire"`
+
+	// count of urls decided by this rule, since it is loaded
+	Count uint64 `json:"count"`
+
+	regex *regexp.Regexp
+}
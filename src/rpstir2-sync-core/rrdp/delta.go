@@ -1,12 +1,29 @@
 package rrdp
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/conf"
+	"github.com/cpusoft/goutil/hashutil"
 	"github.com/cpusoft/goutil/jsonutil"
+	"github.com/cpusoft/goutil/osutil"
 	"github.com/cpusoft/goutil/rrdputil"
+	"github.com/cpusoft/goutil/urlutil"
 	model "rpstir2-model"
+	coresync "rpstir2-sync-core/sync"
 )
 
 // lastSerial is last syncRrdpLog's curSerial
@@ -14,22 +31,23 @@ func processRrdpDelta(syncLogId uint64, notificationModel *rrdputil.Notification
 	snapshotDeltaResult *SnapshotDeltaResult, syncLogFilesCh chan []model.LabRpkiSyncLogFile) (err error) {
 
 	start := time.Now()
-	deltaModels, err := rrdputil.GetRrdpDeltas(notificationModel, snapshotDeltaResult.LastSerial)
+	deltaModels, err := getRrdpDeltas(notificationModel, snapshotDeltaResult)
 	if err != nil {
-		belogs.Error("processRrdpDelta(): GetRrdpDeltas fail, notifyUrl:", snapshotDeltaResult.NotifyUrl,
+		belogs.Error("processRrdpDelta(): getRrdpDeltas fail, notifyUrl:", snapshotDeltaResult.NotifyUrl,
 			", len(notificationModel.Deltas): ", len(notificationModel.Deltas), err)
 		return err
 	}
-	belogs.Info("processRrdpDelta():GetRrdpDeltas  notifyUrl:", snapshotDeltaResult.NotifyUrl,
+	belogs.Info("processRrdpDelta():getRrdpDeltas  notifyUrl:", snapshotDeltaResult.NotifyUrl,
 		"   len(deltaModels):", len(deltaModels))
 	if len(deltaModels) <= 0 {
 		belogs.Debug("processRrdpDelta():notifyUrl:", snapshotDeltaResult.NotifyUrl, "   len(deltaModels)<=0:", len(deltaModels))
 		return nil
 	}
 
-	rrdpFilesAll, err := rrdputil.SaveRrdpDeltasToRrdpFiles(deltaModels, snapshotDeltaResult.NotifyUrl, snapshotDeltaResult.DestPath)
+	// all deltas are checked and staged first, local files will not be changed when any delta is wrong
+	rrdpFilesAll, err := stageRrdpDeltas(deltaModels, notificationModel, snapshotDeltaResult)
 	if err != nil {
-		belogs.Error("processRrdpDelta(): SaveRrdpDeltasToRrdpFiles fail, notifyUrl:", snapshotDeltaResult.NotifyUrl,
+		belogs.Error("processRrdpDelta(): stageRrdpDeltas fail, notifyUrl:", snapshotDeltaResult.NotifyUrl,
 			"   len(deltaModels):", len(deltaModels),
 			"   snapshotDeltaResult.DestPath: ", snapshotDeltaResult.DestPath, err)
 		return err
@@ -56,3 +74,361 @@ func processRrdpDelta(syncLogId uint64, notificationModel *rrdputil.Notification
 
 	return nil
 }
+
+type rrdpDeltaXml struct {
+	XMLName   xml.Name `xml:"delta"`
+	Version   string   `xml:"version,attr"`
+	SessionId string   `xml:"session_id,attr"`
+	Serial    uint64   `xml:"serial,attr"`
+	Publishs  []struct {
+		Uri    string `xml:"uri,attr"`
+		Hash   string `xml:"hash,attr"`
+		Base64 string `xml:",chardata"`
+	} `xml:"publish"`
+	Withdraws []struct {
+		Uri  string `xml:"uri,attr"`
+		Hash string `xml:"hash,attr"`
+	} `xml:"withdraw"`
+}
+
+// deltas after lastSerial are downloaded one by one, and are checked by hash, session_id and serial in notification.
+// size of every delta, count of publishes in all deltas and the deadline of the repository are limited
+func getRrdpDeltas(notificationModel *rrdputil.NotificationModel,
+	snapshotDeltaResult *SnapshotDeltaResult) (deltaModels []rrdputil.DeltaModel, err error) {
+
+	timeout := time.Duration(conf.Int("rrdp::snapshotTimeoutMinutes")) * time.Minute
+	if timeout <= 0 {
+		timeout = 30 * time.Minute
+	}
+	deltaModels = make([]rrdputil.DeltaModel, 0)
+	publishCount := uint64(0)
+	for i := range notificationModel.Deltas {
+		notificationDelta := &notificationModel.Deltas[i]
+		if notificationDelta.Serial <= snapshotDeltaResult.LastSerial {
+			continue
+		}
+		snapshotDeltaResult.FailDeltaUrl = notificationDelta.Uri
+		deltaTimeout, err := getRrdpTimeout(timeout, snapshotDeltaResult.Deadline)
+		if err != nil {
+			belogs.Error("getRrdpDeltas(): getRrdpTimeout fail, delta uri:", notificationDelta.Uri, err)
+			return nil, err
+		}
+
+		var body bytes.Buffer
+		hash := sha256.New()
+		_, _, _, err = fetchRrdpHttp(notificationDelta.Uri, "", "", deltaTimeout,
+			newRrdpLimitWriter(io.MultiWriter(&body, hash), getRrdpMaxFileBytes()), snapshotDeltaResult.FetchResult)
+		if err != nil {
+			belogs.Error("getRrdpDeltas(): fetchRrdpHttp fail, delta uri:", notificationDelta.Uri, err)
+			return nil, err
+		}
+		fileHash := hex.EncodeToString(hash.Sum(nil))
+		if !strings.EqualFold(fileHash, notificationDelta.Hash) {
+			belogs.Error("getRrdpDeltas(): hash mismatch, delta uri:", notificationDelta.Uri,
+				"  fileHash:", fileHash, "  notification hash:", notificationDelta.Hash)
+			return nil, errors.New("hash of delta " + notificationDelta.Uri + " is not equal to notification")
+		}
+
+		deltaXml := rrdpDeltaXml{}
+		err = xml.Unmarshal(body.Bytes(), &deltaXml)
+		if err != nil {
+			belogs.Error("getRrdpDeltas(): Unmarshal fail, delta uri:", notificationDelta.Uri, err)
+			return nil, err
+		}
+		if deltaXml.Version != "1" || deltaXml.SessionId != notificationModel.SessionId ||
+			deltaXml.Serial != notificationDelta.Serial {
+			belogs.Error("getRrdpDeltas(): delta is not equal to notification, delta uri:", notificationDelta.Uri,
+				"  version:", deltaXml.Version, "  session_id:", deltaXml.SessionId, "  serial:", deltaXml.Serial)
+			return nil, errors.New("version, session_id or serial of delta " + notificationDelta.Uri + " is not equal to notification")
+		}
+
+		publishCount += uint64(len(deltaXml.Publishs))
+		err = coresync.CheckMaxObjectsPerRepo(publishCount, coresync.GetMaxObjectsPerRepo())
+		if err != nil {
+			belogs.Error("getRrdpDeltas(): CheckMaxObjectsPerRepo fail, delta uri:", notificationDelta.Uri, err)
+			return nil, err
+		}
+
+		deltaModel := rrdputil.DeltaModel{
+			Version:   deltaXml.Version,
+			SessionId: deltaXml.SessionId,
+			Serial:    deltaXml.Serial,
+			Hash:      fileHash,
+			DeltaUrl:  notificationDelta.Uri,
+		}
+		for j := range deltaXml.Publishs {
+			deltaModel.DeltaPublishs = append(deltaModel.DeltaPublishs, rrdputil.DeltaPublish{
+				Uri:    deltaXml.Publishs[j].Uri,
+				Hash:   deltaXml.Publishs[j].Hash,
+				Base64: deltaXml.Publishs[j].Base64,
+			})
+		}
+		for j := range deltaXml.Withdraws {
+			deltaModel.DeltaWithdraws = append(deltaModel.DeltaWithdraws, rrdputil.DeltaWithdraw{
+				Uri:  deltaXml.Withdraws[j].Uri,
+				Hash: deltaXml.Withdraws[j].Hash,
+			})
+		}
+		deltaModels = append(deltaModels, deltaModel)
+	}
+	snapshotDeltaResult.FailDeltaUrl = ""
+	belogs.Debug("getRrdpDeltas(): notifyUrl:", snapshotDeltaResult.NotifyUrl, "  len(deltaModels):", len(deltaModels),
+		"  publishCount:", publishCount)
+	return deltaModels, nil
+}
+
+// one local file changed by deltas, only the last state is saved
+type rrdpDeltaFile struct {
+	pathFileName  string
+	stageFileName string
+	sourceUrl     string
+	existedBefore bool
+	exists        bool
+	hash          string
+}
+
+// deltas are applied to a stage path, which is under "destPath_stage", then are moved to destPath.
+// missing delta, hash mismatch, publish of existing object without hash or withdraw of unknown object will fail
+func stageRrdpDeltas(deltaModels []rrdputil.DeltaModel, notificationModel *rrdputil.NotificationModel,
+	snapshotDeltaResult *SnapshotDeltaResult) (rrdpFiles []rrdputil.RrdpFile, err error) {
+	start := time.Now()
+	sort.Slice(deltaModels, func(i, j int) bool {
+		return deltaModels[i].Serial < deltaModels[j].Serial
+	})
+	serial := snapshotDeltaResult.LastSerial
+	for i := range deltaModels {
+		if deltaModels[i].Serial != serial+1 {
+			belogs.Error("stageRrdpDeltas(): delta is missing, notifyUrl:", snapshotDeltaResult.NotifyUrl,
+				"  serial:", serial+1, "  got serial:", deltaModels[i].Serial)
+			return nil, errors.New("delta of serial " + strconv.FormatUint(serial+1, 10) + " is missing")
+		}
+		serial = deltaModels[i].Serial
+	}
+	if serial != notificationModel.Serial {
+		belogs.Error("stageRrdpDeltas(): delta is missing, notifyUrl:", snapshotDeltaResult.NotifyUrl,
+			"  last delta serial:", serial, "  notification serial:", notificationModel.Serial)
+		return nil, errors.New("delta of serial " + strconv.FormatUint(notificationModel.Serial, 10) + " is missing")
+	}
+
+	stagePath := getRrdpStagePath(snapshotDeltaResult.DestPath, snapshotDeltaResult.NotifyUrl)
+	os.RemoveAll(stagePath)
+	defer os.RemoveAll(stagePath)
+
+	// pathFileName --> file, and the order of first change
+	deltaFiles := make(map[string]*rrdpDeltaFile)
+	pathFileNames := make([]string, 0)
+	// file is nil when uri is rejected
+	getDeltaFile := func(uri string) (*rrdpDeltaFile, error) {
+		err := checkRrdpUri(uri, snapshotDeltaResult.UriScopes)
+		if err != nil {
+			snapshotDeltaResult.addUriError(uri, err)
+			return nil, nil
+		}
+		pathFileName, err := urlutil.JoinPrefixPathAndUrlFileName(snapshotDeltaResult.DestPath, uri)
+		if err != nil {
+			belogs.Error("stageRrdpDeltas(): JoinPrefixPathAndUrlFileName fail, uri:", uri, err)
+			return nil, err
+		}
+		err = checkRrdpPathFileName(snapshotDeltaResult.DestPath, pathFileName)
+		if err != nil {
+			snapshotDeltaResult.addUriError(uri, err)
+			return nil, nil
+		}
+		if deltaFile, ok := deltaFiles[pathFileName]; ok {
+			return deltaFile, nil
+		}
+		stageFileName, err := urlutil.JoinPrefixPathAndUrlFileName(stagePath, uri)
+		if err != nil {
+			belogs.Error("stageRrdpDeltas(): JoinPrefixPathAndUrlFileName fail, stagePath:", stagePath, "  uri:", uri, err)
+			return nil, err
+		}
+		deltaFile := &rrdpDeltaFile{pathFileName: pathFileName, stageFileName: stageFileName, sourceUrl: uri}
+		deltaFile.existedBefore, err = osutil.IsExists(pathFileName)
+		if err != nil {
+			belogs.Error("stageRrdpDeltas(): IsExists fail, pathFileName:", pathFileName, err)
+			return nil, err
+		}
+		if deltaFile.existedBefore {
+			deltaFile.hash, err = hashutil.Sha256File(pathFileName)
+			if err != nil {
+				belogs.Error("stageRrdpDeltas(): Sha256File fail, pathFileName:", pathFileName, err)
+				return nil, err
+			}
+		}
+		deltaFile.exists = deltaFile.existedBefore
+		deltaFiles[pathFileName] = deltaFile
+		pathFileNames = append(pathFileNames, pathFileName)
+		return deltaFile, nil
+	}
+
+	for i := range deltaModels {
+		snapshotDeltaResult.FailDeltaUrl = deltaModels[i].DeltaUrl
+		for j := range deltaModels[i].DeltaWithdraws {
+			withdraw := &deltaModels[i].DeltaWithdraws[j]
+			deltaFile, err := getDeltaFile(withdraw.Uri)
+			if err != nil {
+				return nil, err
+			}
+			if deltaFile == nil {
+				continue
+			}
+			if !deltaFile.exists {
+				belogs.Error("stageRrdpDeltas(): withdraw unknown object, serial:", deltaModels[i].Serial, "  uri:", withdraw.Uri)
+				return nil, errors.New("withdraw unknown object " + withdraw.Uri + " in delta " + deltaModels[i].DeltaUrl)
+			}
+			if !strings.EqualFold(deltaFile.hash, withdraw.Hash) {
+				belogs.Error("stageRrdpDeltas(): withdraw hash mismatch, serial:", deltaModels[i].Serial, "  uri:", withdraw.Uri,
+					"  local hash:", deltaFile.hash, "  withdraw hash:", withdraw.Hash)
+				return nil, errors.New("hash mismatch of withdraw " + withdraw.Uri + " in delta " + deltaModels[i].DeltaUrl)
+			}
+			deltaFile.exists = false
+			deltaFile.hash = ""
+		}
+
+		for j := range deltaModels[i].DeltaPublishs {
+			publish := &deltaModels[i].DeltaPublishs[j]
+			deltaFile, err := getDeltaFile(publish.Uri)
+			if err != nil {
+				return nil, err
+			}
+			if deltaFile == nil {
+				continue
+			}
+			if len(publish.Hash) == 0 && deltaFile.exists {
+				belogs.Error("stageRrdpDeltas(): publish existing object without hash, serial:", deltaModels[i].Serial, "  uri:", publish.Uri)
+				return nil, errors.New("publish existing object " + publish.Uri + " without hash in delta " + deltaModels[i].DeltaUrl)
+			}
+			if len(publish.Hash) > 0 && (!deltaFile.exists || !strings.EqualFold(deltaFile.hash, publish.Hash)) {
+				belogs.Error("stageRrdpDeltas(): publish hash mismatch, serial:", deltaModels[i].Serial, "  uri:", publish.Uri,
+					"  exists:", deltaFile.exists, "  local hash:", deltaFile.hash, "  publish hash:", publish.Hash)
+				return nil, errors.New("hash mismatch of publish " + publish.Uri + " in delta " + deltaModels[i].DeltaUrl)
+			}
+
+			// base64 in xml may have spaces and line breaks
+			bytes, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(publish.Base64), ""))
+			if err != nil {
+				belogs.Error("stageRrdpDeltas(): DecodeString fail, serial:", deltaModels[i].Serial, "  uri:", publish.Uri, err)
+				return nil, err
+			}
+			err = os.MkdirAll(filepath.Dir(deltaFile.stageFileName), os.ModePerm)
+			if err != nil {
+				belogs.Error("stageRrdpDeltas(): MkdirAll fail, stageFileName:", deltaFile.stageFileName, err)
+				return nil, err
+			}
+			err = os.WriteFile(deltaFile.stageFileName, bytes, 0644)
+			if err != nil {
+				belogs.Error("stageRrdpDeltas(): WriteFile fail, stageFileName:", deltaFile.stageFileName, err)
+				return nil, err
+			}
+			deltaFile.exists = true
+			deltaFile.hash = hashutil.Sha256(bytes)
+		}
+	}
+	snapshotDeltaResult.FailDeltaUrl = ""
+	belogs.Debug("stageRrdpDeltas(): staged, notifyUrl:", snapshotDeltaResult.NotifyUrl, "  stagePath:", stagePath,
+		"  len(pathFileNames):", len(pathFileNames), "  time(s):", time.Since(start))
+
+	// move to destPath. files which existed before are moved to backup path first, so when any move fails,
+	// all moved files are rolled back, and local files are not changed
+	backupPath := osutil.JoinPathFile(stagePath, "_backup")
+	movedFiles := make([]rrdpMovedFile, 0, len(pathFileNames))
+	rrdpFiles = make([]rrdputil.RrdpFile, 0, len(pathFileNames))
+	for i, pathFileName := range pathFileNames {
+		deltaFile := deltaFiles[pathFileName]
+		var syncType string
+		if deltaFile.exists {
+			syncType = "add"
+			if deltaFile.existedBefore {
+				syncType = "update"
+			}
+		} else if deltaFile.existedBefore {
+			syncType = "del"
+		} else {
+			// published and then withdrawn in these deltas
+			continue
+		}
+		movedFile, err := moveRrdpDeltaFile(deltaFile, osutil.JoinPathFile(backupPath, strconv.Itoa(i)))
+		if err != nil {
+			belogs.Error("stageRrdpDeltas(): moveRrdpDeltaFile fail, will rollback, pathFileName:", pathFileName,
+				"  len(movedFiles):", len(movedFiles), err)
+			rollbackRrdpDeltaFiles(movedFiles)
+			return nil, err
+		}
+		movedFiles = append(movedFiles, movedFile)
+		filePath, fileName := osutil.GetFilePathAndFileName(pathFileName)
+		rrdpFiles = append(rrdpFiles, rrdputil.RrdpFile{
+			FilePath:  filePath,
+			FileName:  fileName,
+			SyncType:  syncType,
+			SourceUrl: deltaFile.sourceUrl,
+		})
+	}
+	belogs.Info("stageRrdpDeltas(): notifyUrl:", snapshotDeltaResult.NotifyUrl, "  len(rrdpFiles):", len(rrdpFiles),
+		"  time(s):", time.Since(start))
+	return rrdpFiles, nil
+}
+
+// local file which is replaced or removed by delta, backupFileName is empty when it did not exist before
+type rrdpMovedFile struct {
+	pathFileName   string
+	backupFileName string
+}
+
+// old file is moved to backupFileName, and then staged file is moved to pathFileName.
+// when it fails in the middle, this file is rolled back here
+func moveRrdpDeltaFile(deltaFile *rrdpDeltaFile, backupFileName string) (movedFile rrdpMovedFile, err error) {
+	movedFile.pathFileName = deltaFile.pathFileName
+	if deltaFile.existedBefore {
+		err = os.MkdirAll(filepath.Dir(backupFileName), os.ModePerm)
+		if err != nil {
+			belogs.Error("moveRrdpDeltaFile(): MkdirAll fail, backupFileName:", backupFileName, err)
+			return movedFile, err
+		}
+		err = os.Rename(deltaFile.pathFileName, backupFileName)
+		if err != nil {
+			belogs.Error("moveRrdpDeltaFile(): Rename to backup fail, pathFileName:", deltaFile.pathFileName,
+				"  backupFileName:", backupFileName, err)
+			return movedFile, err
+		}
+		movedFile.backupFileName = backupFileName
+	}
+	if !deltaFile.exists {
+		return movedFile, nil
+	}
+	err = os.MkdirAll(filepath.Dir(deltaFile.pathFileName), os.ModePerm)
+	if err == nil {
+		err = os.Rename(deltaFile.stageFileName, deltaFile.pathFileName)
+	}
+	if err != nil {
+		belogs.Error("moveRrdpDeltaFile(): Rename fail, stageFileName:", deltaFile.stageFileName,
+			"  pathFileName:", deltaFile.pathFileName, err)
+		rollbackRrdpDeltaFiles([]rrdpMovedFile{movedFile})
+		return movedFile, err
+	}
+	return movedFile, nil
+}
+
+// in reverse order, remove moved file and move backup file back
+func rollbackRrdpDeltaFiles(movedFiles []rrdpMovedFile) {
+	for i := len(movedFiles) - 1; i >= 0; i-- {
+		err := os.Remove(movedFiles[i].pathFileName)
+		if err != nil && !os.IsNotExist(err) {
+			belogs.Error("rollbackRrdpDeltaFiles(): Remove fail, pathFileName:", movedFiles[i].pathFileName, err)
+			// no return
+		}
+		if len(movedFiles[i].backupFileName) == 0 {
+			continue
+		}
+		err = os.Rename(movedFiles[i].backupFileName, movedFiles[i].pathFileName)
+		if err != nil {
+			belogs.Error("rollbackRrdpDeltaFiles(): Rename fail, backupFileName:", movedFiles[i].backupFileName,
+				"  pathFileName:", movedFiles[i].pathFileName, err)
+			// no return
+		}
+	}
+}
+
+// every notifyUrl has its own stage path, under "destPath_stage", so it can be renamed to destPath
+func getRrdpStagePath(destPath, notifyUrl string) string {
+	return osutil.JoinPathFile(filepath.Clean(destPath)+"_stage", hashutil.Sha256([]byte(notifyUrl)))
+}
@@ -0,0 +1,182 @@
+package rrdp
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cpusoft/goutil/rrdputil"
+)
+
+const testRrdpRepo = "rsync://example.net/repo/"
+
+func testRrdpHash(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func testRrdpWriteFile(t *testing.T, pathFileName string, content string) {
+	err := os.MkdirAll(filepath.Dir(pathFileName), os.ModePerm)
+	if err == nil {
+		err = os.WriteFile(pathFileName, []byte(content), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testRrdpReadFile(t *testing.T, pathFileName string) string {
+	b, err := os.ReadFile(pathFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestStageRrdpDeltasMissingSerial(t *testing.T) {
+	destPath := t.TempDir()
+	deltaModels := []rrdputil.DeltaModel{{Serial: 11, DeltaUrl: "https://example.net/11.xml"},
+		{Serial: 13, DeltaUrl: "https://example.net/13.xml"}}
+	notificationModel := rrdputil.NotificationModel{SessionId: "session", Serial: 13}
+	snapshotDeltaResult := SnapshotDeltaResult{NotifyUrl: "https://example.net/notification.xml",
+		DestPath: destPath, LastSerial: 10, UriScopes: []string{testRrdpRepo}}
+	_, err := stageRrdpDeltas(deltaModels, &notificationModel, &snapshotDeltaResult)
+	if err == nil {
+		t.Fatal("missing delta of serial 12 should fail")
+	}
+
+	notificationModel.Serial = 14
+	deltaModels[1].Serial = 12
+	_, err = stageRrdpDeltas(deltaModels, &notificationModel, &snapshotDeltaResult)
+	if err == nil {
+		t.Fatal("missing delta of serial 14 should fail")
+	}
+}
+
+func TestStageRrdpDeltas(t *testing.T) {
+	destPath := t.TempDir()
+	updateFile := filepath.Join(destPath, "example.net", "repo", "a.roa")
+	delFile := filepath.Join(destPath, "example.net", "repo", "b.roa")
+	addFile := filepath.Join(destPath, "example.net", "repo", "sub", "c.roa")
+	testRrdpWriteFile(t, updateFile, "a1")
+	testRrdpWriteFile(t, delFile, "b1")
+
+	deltaModels := []rrdputil.DeltaModel{
+		{Serial: 12, DeltaUrl: "https://example.net/12.xml",
+			DeltaWithdraws: []rrdputil.DeltaWithdraw{{Uri: testRrdpRepo + "b.roa", Hash: testRrdpHash([]byte("b1"))}}},
+		{Serial: 11, DeltaUrl: "https://example.net/11.xml",
+			DeltaPublishs: []rrdputil.DeltaPublish{
+				{Uri: testRrdpRepo + "a.roa", Hash: testRrdpHash([]byte("a1")), Base64: base64.StdEncoding.EncodeToString([]byte("a2"))},
+				{Uri: testRrdpRepo + "sub/c.roa", Base64: base64.StdEncoding.EncodeToString([]byte("c1"))},
+				{Uri: testRrdpRepo + "../x.roa", Base64: base64.StdEncoding.EncodeToString([]byte("x1"))}}},
+	}
+	notificationModel := rrdputil.NotificationModel{SessionId: "session", Serial: 12}
+	snapshotDeltaResult := SnapshotDeltaResult{NotifyUrl: "https://example.net/notification.xml",
+		DestPath: destPath, LastSerial: 10, UriScopes: []string{testRrdpRepo}}
+	rrdpFiles, err := stageRrdpDeltas(deltaModels, &notificationModel, &snapshotDeltaResult)
+	if err != nil {
+		t.Fatal(err)
+	}
+	syncTypes := make(map[string]string)
+	for _, rrdpFile := range rrdpFiles {
+		syncTypes[rrdpFile.FileName] = rrdpFile.SyncType
+	}
+	if syncTypes["a.roa"] != "update" || syncTypes["b.roa"] != "del" || syncTypes["c.roa"] != "add" || len(syncTypes) != 3 {
+		t.Errorf("syncTypes = %v", syncTypes)
+	}
+	if len(snapshotDeltaResult.UriErrors) != 1 {
+		t.Errorf("UriErrors = %v, want uri with '..'", snapshotDeltaResult.UriErrors)
+	}
+	if len(snapshotDeltaResult.FailDeltaUrl) != 0 {
+		t.Errorf("FailDeltaUrl = %s, want empty", snapshotDeltaResult.FailDeltaUrl)
+	}
+	if got := testRrdpReadFile(t, updateFile); got != "a2" {
+		t.Errorf("a.roa = %s, want a2", got)
+	}
+	if got := testRrdpReadFile(t, addFile); got != "c1" {
+		t.Errorf("c.roa = %s, want c1", got)
+	}
+	if _, err := os.Stat(delFile); !os.IsNotExist(err) {
+		t.Errorf("b.roa should be removed, err: %v", err)
+	}
+	if _, err := os.Stat(getRrdpStagePath(destPath, snapshotDeltaResult.NotifyUrl)); !os.IsNotExist(err) {
+		t.Errorf("stage path should be removed, err: %v", err)
+	}
+}
+
+func TestStageRrdpDeltasHashMismatch(t *testing.T) {
+	destPath := t.TempDir()
+	updateFile := filepath.Join(destPath, "example.net", "repo", "a.roa")
+	testRrdpWriteFile(t, updateFile, "a1")
+
+	deltaModels := []rrdputil.DeltaModel{
+		{Serial: 11, DeltaUrl: "https://example.net/11.xml",
+			DeltaPublishs: []rrdputil.DeltaPublish{
+				{Uri: testRrdpRepo + "c.roa", Base64: base64.StdEncoding.EncodeToString([]byte("c1"))}}},
+		{Serial: 12, DeltaUrl: "https://example.net/12.xml",
+			DeltaPublishs: []rrdputil.DeltaPublish{
+				{Uri: testRrdpRepo + "a.roa", Hash: testRrdpHash([]byte("other")), Base64: base64.StdEncoding.EncodeToString([]byte("a2"))}}},
+	}
+	notificationModel := rrdputil.NotificationModel{SessionId: "session", Serial: 12}
+	snapshotDeltaResult := SnapshotDeltaResult{NotifyUrl: "https://example.net/notification.xml",
+		DestPath: destPath, LastSerial: 10, UriScopes: []string{testRrdpRepo}}
+	_, err := stageRrdpDeltas(deltaModels, &notificationModel, &snapshotDeltaResult)
+	if err == nil {
+		t.Fatal("hash mismatch should fail")
+	}
+	if snapshotDeltaResult.FailDeltaUrl != "https://example.net/12.xml" {
+		t.Errorf("FailDeltaUrl = %s, want 12.xml", snapshotDeltaResult.FailDeltaUrl)
+	}
+	if got := testRrdpReadFile(t, updateFile); got != "a1" {
+		t.Errorf("a.roa = %s, want a1", got)
+	}
+	if _, err := os.Stat(filepath.Join(destPath, "example.net", "repo", "c.roa")); !os.IsNotExist(err) {
+		t.Errorf("c.roa should not be added, err: %v", err)
+	}
+}
+
+func TestRollbackRrdpDeltaFiles(t *testing.T) {
+	dir := t.TempDir()
+	stageFile := filepath.Join(dir, "stage", "a.roa")
+	updateFile := filepath.Join(dir, "dest", "a.roa")
+	delFile := filepath.Join(dir, "dest", "b.roa")
+	addFile := filepath.Join(dir, "dest", "c.roa")
+	testRrdpWriteFile(t, stageFile, "a2")
+	testRrdpWriteFile(t, updateFile, "a1")
+	testRrdpWriteFile(t, delFile, "b1")
+
+	movedFiles := make([]rrdpMovedFile, 0)
+	for i, deltaFile := range []*rrdpDeltaFile{
+		{pathFileName: updateFile, stageFileName: stageFile, existedBefore: true, exists: true},
+		{pathFileName: delFile, existedBefore: true},
+	} {
+		movedFile, err := moveRrdpDeltaFile(deltaFile, filepath.Join(dir, "backup", string(rune('0'+i))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		movedFiles = append(movedFiles, movedFile)
+	}
+	if got := testRrdpReadFile(t, updateFile); got != "a2" {
+		t.Fatalf("a.roa = %s, want a2", got)
+	}
+
+	// staged file of c.roa does not exist, so move fails
+	_, err := moveRrdpDeltaFile(&rrdpDeltaFile{pathFileName: addFile, stageFileName: filepath.Join(dir, "stage", "c.roa"),
+		exists: true}, filepath.Join(dir, "backup", "2"))
+	if err == nil {
+		t.Fatal("move of missing staged file should fail")
+	}
+	rollbackRrdpDeltaFiles(movedFiles)
+	if got := testRrdpReadFile(t, updateFile); got != "a1" {
+		t.Errorf("a.roa = %s, want a1", got)
+	}
+	if got := testRrdpReadFile(t, delFile); got != "b1" {
+		t.Errorf("b.roa = %s, want b1", got)
+	}
+	if _, err := os.Stat(addFile); !os.IsNotExist(err) {
+		t.Errorf("c.roa should not exist, err: %v", err)
+	}
+}
@@ -1,26 +1,122 @@
 package rrdp
 
 import (
+	"bytes"
+	"encoding/xml"
+	"time"
+
 	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/conf"
 	"github.com/cpusoft/goutil/jsonutil"
 	"github.com/cpusoft/goutil/rrdputil"
 )
 
-func GetRrdpNotification(notifyUrl string) (notificationModel rrdputil.NotificationModel, err error) {
+// when etag/lastModified of notifyUrl is saved, and its session_id and maxSerial are the last rrdp ones,
+// a conditional request is sent, and notModified is true when server returns 304
+func getRrdpNotificationWithCache(rrdpByUrlModel *RrdpByUrlModel) (notificationModel rrdputil.NotificationModel,
+	notModified bool, err error) {
 
-	belogs.Debug("GetRrdpNotification(): notifyUrl :", notifyUrl)
-	// get nofiy.xmlm
-	notificationModel, err = rrdputil.GetRrdpNotification(notifyUrl)
+	notifyUrl := rrdpByUrlModel.NotifyUrl
+	var etag, lastModified string
+	rrdpNotify, has, err := getSyncRrdpNotifyDb(notifyUrl)
 	if err != nil {
-		belogs.Error("GetRrdpNotification(): GetRrdpNotification fail, notifyUrl: ",
-			notifyUrl, err)
-		return notificationModel, err
+		belogs.Error("getRrdpNotificationWithCache(): getSyncRrdpNotifyDb fail, notifyUrl:", notifyUrl, err)
+		// no return
+	} else if has && rrdpByUrlModel.HasPath && rrdpByUrlModel.HasLast &&
+		rrdpNotify.SessionId == rrdpByUrlModel.LastSessionId && rrdpNotify.MaxSerial == rrdpByUrlModel.LastCurSerial {
+		etag = rrdpNotify.Etag
+		lastModified = rrdpNotify.LastModified
+	}
+	belogs.Debug("getRrdpNotificationWithCache(): notifyUrl:", notifyUrl, "  etag:", etag, "  lastModified:", lastModified)
+
+	timeout := time.Duration(conf.Int("rrdp::notificationTimeoutMinutes")) * time.Minute
+	if timeout <= 0 {
+		timeout = 5 * time.Minute
+	}
+	timeout, err = getRrdpTimeout(timeout, rrdpByUrlModel.Deadline)
+	if err != nil {
+		belogs.Error("getRrdpNotificationWithCache(): getRrdpTimeout fail, notifyUrl: ", notifyUrl, err)
+		return notificationModel, false, err
+	}
+	var body bytes.Buffer
+	notModified, newEtag, newLastModified, err := fetchRrdpHttp(notifyUrl, etag, lastModified, timeout,
+		newRrdpLimitWriter(&body, getRrdpMaxFileBytes()), rrdpByUrlModel.FetchResult)
+	if err != nil {
+		belogs.Error("getRrdpNotificationWithCache(): fetchRrdpHttp fail, notifyUrl: ", notifyUrl, err)
+		return notificationModel, false, err
+	}
+	if notModified {
+		return notificationModel, true, nil
+	}
+
+	notificationModel, err = parseRrdpNotification(body.Bytes())
+	if err != nil {
+		belogs.Error("getRrdpNotificationWithCache(): parseRrdpNotification fail, notifyUrl: ", notifyUrl, err)
+		return notificationModel, false, err
 	}
 	err = rrdputil.CheckRrdpNotification(&notificationModel)
 	if err != nil {
-		belogs.Error("GetRrdpNotification(): CheckRrdpNotification fail, notifyUrl,notificationModel: ",
+		belogs.Error("getRrdpNotificationWithCache(): CheckRrdpNotification fail, notifyUrl,notificationModel: ",
 			notifyUrl, jsonutil.MarshalJson(notificationModel), err)
+		return notificationModel, false, err
+	}
+
+	err = updateSyncRrdpNotifyDb(notifyUrl, newEtag, newLastModified, &notificationModel)
+	if err != nil {
+		belogs.Error("getRrdpNotificationWithCache(): updateSyncRrdpNotifyDb fail, notifyUrl:", notifyUrl, err)
+		// no return
+	}
+	return notificationModel, false, nil
+}
+
+type rrdpNotificationXml struct {
+	XMLName   xml.Name `xml:"notification"`
+	Version   string   `xml:"version,attr"`
+	SessionId string   `xml:"session_id,attr"`
+	Serial    uint64   `xml:"serial,attr"`
+	Snapshot  struct {
+		Uri  string `xml:"uri,attr"`
+		Hash string `xml:"hash,attr"`
+	} `xml:"snapshot"`
+	Deltas []struct {
+		Serial uint64 `xml:"serial,attr"`
+		Uri    string `xml:"uri,attr"`
+		Hash   string `xml:"hash,attr"`
+	} `xml:"delta"`
+}
+
+// minSerial and maxSerial are of deltas, and are serial when there is no delta
+func parseRrdpNotification(body []byte) (notificationModel rrdputil.NotificationModel, err error) {
+	var notificationXml rrdpNotificationXml
+	err = xml.Unmarshal(body, &notificationXml)
+	if err != nil {
+		belogs.Error("parseRrdpNotification(): Unmarshal fail:", err)
 		return notificationModel, err
 	}
+
+	notificationModel.Version = notificationXml.Version
+	notificationModel.SessionId = notificationXml.SessionId
+	notificationModel.Serial = notificationXml.Serial
+	notificationModel.Snapshot.Uri = notificationXml.Snapshot.Uri
+	notificationModel.Snapshot.Hash = notificationXml.Snapshot.Hash
+	notificationModel.Deltas = make([]rrdputil.NotificationDelta, 0, len(notificationXml.Deltas))
+	notificationModel.MapSerialDeltas = make(map[uint64]uint64, len(notificationXml.Deltas))
+	notificationModel.MinSerial = notificationXml.Serial
+	notificationModel.MaxSerial = notificationXml.Serial
+	for i := range notificationXml.Deltas {
+		delta := rrdputil.NotificationDelta{
+			Serial: notificationXml.Deltas[i].Serial,
+			Uri:    notificationXml.Deltas[i].Uri,
+			Hash:   notificationXml.Deltas[i].Hash,
+		}
+		notificationModel.Deltas = append(notificationModel.Deltas, delta)
+		notificationModel.MapSerialDeltas[delta.Serial] = delta.Serial
+		if i == 0 || delta.Serial < notificationModel.MinSerial {
+			notificationModel.MinSerial = delta.Serial
+		}
+		if i == 0 || delta.Serial > notificationModel.MaxSerial {
+			notificationModel.MaxSerial = delta.Serial
+		}
+	}
 	return notificationModel, nil
 }
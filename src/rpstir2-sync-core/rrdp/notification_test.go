@@ -0,0 +1,59 @@
+package rrdp
+
+import (
+	"testing"
+)
+
+func TestParseRrdpNotification(t *testing.T) {
+	body := []byte(`<notification xmlns="http://www.ripe.net/rpki/rrdp" version="1" session_id="9df4b597-af9e-4dca-bdda-719cce2c4e28" serial="5">
+  <snapshot uri="https://example.net/rrdp/snapshot.xml" hash="EB4DCD5B3AF2E9EF8D0C8A1D8AC5A4C0C1F0E13D4FCDD5A3E0E1B8B7E2C1A0F9"/>
+  <delta serial="5" uri="https://example.net/rrdp/5.xml" hash="5E6F"/>
+  <delta serial="3" uri="https://example.net/rrdp/3.xml" hash="3C4D"/>
+  <delta serial="4" uri="https://example.net/rrdp/4.xml" hash="4A5B"/>
+</notification>`)
+	notificationModel, err := parseRrdpNotification(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if notificationModel.Version != "1" || notificationModel.SessionId != "9df4b597-af9e-4dca-bdda-719cce2c4e28" ||
+		notificationModel.Serial != 5 {
+		t.Errorf("version, session_id, serial = %s, %s, %d", notificationModel.Version, notificationModel.SessionId,
+			notificationModel.Serial)
+	}
+	if notificationModel.Snapshot.Uri != "https://example.net/rrdp/snapshot.xml" ||
+		notificationModel.Snapshot.Hash != "EB4DCD5B3AF2E9EF8D0C8A1D8AC5A4C0C1F0E13D4FCDD5A3E0E1B8B7E2C1A0F9" {
+		t.Errorf("snapshot = %v", notificationModel.Snapshot)
+	}
+	if len(notificationModel.Deltas) != 3 || notificationModel.Deltas[1].Serial != 3 ||
+		notificationModel.Deltas[1].Uri != "https://example.net/rrdp/3.xml" || notificationModel.Deltas[1].Hash != "3C4D" {
+		t.Errorf("deltas = %v", notificationModel.Deltas)
+	}
+	if notificationModel.MinSerial != 3 || notificationModel.MaxSerial != 5 || len(notificationModel.MapSerialDeltas) != 3 {
+		t.Errorf("minSerial, maxSerial, mapSerialDeltas = %d, %d, %v", notificationModel.MinSerial,
+			notificationModel.MaxSerial, notificationModel.MapSerialDeltas)
+	}
+
+	// no delta, min and max serial are serial
+	notificationModel, err = parseRrdpNotification([]byte(`<notification version="1" session_id="s" serial="7">
+  <snapshot uri="https://example.net/rrdp/snapshot.xml" hash="AB"/>
+</notification>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if notificationModel.MinSerial != 7 || notificationModel.MaxSerial != 7 || len(notificationModel.Deltas) != 0 {
+		t.Errorf("minSerial, maxSerial, deltas = %d, %d, %v", notificationModel.MinSerial, notificationModel.MaxSerial,
+			notificationModel.Deltas)
+	}
+
+	for _, body := range []string{
+		`<notification version="1" session_id="s" serial="7">`,
+		`<snapshot version="1" session_id="s" serial="7"/>`,
+		`<notification version="1" session_id="s" serial="x"/>`,
+		``,
+	} {
+		_, err = parseRrdpNotification([]byte(body))
+		if err == nil {
+			t.Errorf("%q: should fail", body)
+		}
+	}
+}
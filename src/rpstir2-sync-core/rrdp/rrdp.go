@@ -1,6 +1,7 @@
 package rrdp
 
 import (
+	"errors"
 	"time"
 
 	"github.com/cpusoft/goutil/belogs"
@@ -20,12 +21,12 @@ func RrdpByUrlImpl(rrdpByUrlModel RrdpByUrlModel, connectRrdpUrlCh chan bool,
 	belogs.Debug("RrdpByUrlImpl():start, rrdpByUrlModel:", jsonutil.MarshalJson(rrdpByUrlModel))
 
 	// get notify xml
-	notificationModel, err := GetRrdpNotification(rrdpByUrlModel.NotifyUrl)
+	notificationModel, notModified, err := getRrdpNotificationWithCache(&rrdpByUrlModel)
 	if err != nil {
 		// connect false
 		connectRrdpUrlCh <- false
 		close(connectRrdpUrlCh)
-		belogs.Error("RrdpByUrlImpl(): GetRrdpNotification fail, rrdpByUrlModel:",
+		belogs.Error("RrdpByUrlImpl(): getRrdpNotificationWithCache fail, rrdpByUrlModel:",
 			jsonutil.MarshalJson(rrdpByUrlModel), "  will send false to connectRrdpUrlCh,  err:", err,
 			"  time(s):", time.Since(start))
 		return nil, err
@@ -38,6 +39,10 @@ func RrdpByUrlImpl(rrdpByUrlModel RrdpByUrlModel, connectRrdpUrlCh chan bool,
 		", will send true to connectRrdpUrlCh ,  time(s):", time.Since(start))
 
 	// no need update
+	if notModified {
+		belogs.Info("RrdpByUrlImpl(): notification is not modified, no need rrdp to download, just return:", rrdpByUrlModel.NotifyUrl)
+		return nil, nil
+	}
 	belogs.Debug("RrdpByUrlImpl(): compare :",
 		"   rrdpByUrlModel:", jsonutil.MarshalJson(rrdpByUrlModel),
 		"   notificationModel.SessionId:", notificationModel.SessionId,
@@ -50,22 +55,27 @@ func RrdpByUrlImpl(rrdpByUrlModel RrdpByUrlModel, connectRrdpUrlCh chan bool,
 	}
 
 	// check delta or snapshot
-	canDelta := false
-	if rrdpByUrlModel.HasPath && rrdpByUrlModel.HasLast &&
-		rrdpByUrlModel.LastSessionId == notificationModel.SessionId &&
-		rrdpByUrlModel.LastCurSerial >= notificationModel.MinSerial &&
-		rrdpByUrlModel.LastCurSerial < notificationModel.MaxSerial {
-		canDelta = true
+	canDelta, sessionReset := checkRrdpDeltaOrSnapshot(&rrdpByUrlModel, &notificationModel)
+	belogs.Info("RrdpByUrlImpl():notifyUrl canDelta:", rrdpByUrlModel.NotifyUrl, canDelta, "  sessionReset:", sessionReset)
+
+	// publish/withdraw should be in the repository. when no caRepository is known, all would be rejected,
+	// so local files are kept
+	uriScopes := getRrdpUriScopes(&rrdpByUrlModel)
+	if len(uriScopes) == 0 {
+		belogs.Error("RrdpByUrlImpl(): no caRepository which referenced notifyUrl is known:", rrdpByUrlModel.NotifyUrl)
+		return nil, errors.New("no caRepository which referenced " + rrdpByUrlModel.NotifyUrl + " is known")
 	}
-	belogs.Info("RrdpByUrlImpl():notifyUrl canDelta:", rrdpByUrlModel.NotifyUrl, canDelta)
 
 	// need to get snapshot
 	var snapshotDeltaResult SnapshotDeltaResult
 	if !canDelta {
 		snapshotDeltaResult = SnapshotDeltaResult{
-			NotifyUrl:  rrdpByUrlModel.NotifyUrl,
-			DestPath:   rrdpByUrlModel.DestPath,
-			LastSerial: 0}
+			NotifyUrl:   rrdpByUrlModel.NotifyUrl,
+			DestPath:    rrdpByUrlModel.DestPath,
+			LastSerial:  0,
+			FetchResult: rrdpByUrlModel.FetchResult,
+			Deadline:    rrdpByUrlModel.Deadline,
+			UriScopes:   uriScopes}
 		belogs.Info("RrdpByUrlImpl(): will snapshot:", rrdpByUrlModel.NotifyUrl, jsonutil.MarshalJson(snapshotDeltaResult))
 		err = processRrdpSnapshot(rrdpByUrlModel.SyncLogId, &notificationModel,
 			&snapshotDeltaResult, syncLogFilesCh)
@@ -73,25 +83,71 @@ func RrdpByUrlImpl(rrdpByUrlModel RrdpByUrlModel, connectRrdpUrlCh chan bool,
 	} else {
 		// get delta
 		snapshotDeltaResult = SnapshotDeltaResult{
-			NotifyUrl:  rrdpByUrlModel.NotifyUrl,
-			DestPath:   rrdpByUrlModel.DestPath,
-			LastSerial: rrdpByUrlModel.LastCurSerial}
+			NotifyUrl:   rrdpByUrlModel.NotifyUrl,
+			DestPath:    rrdpByUrlModel.DestPath,
+			LastSerial:  rrdpByUrlModel.LastCurSerial,
+			FetchResult: rrdpByUrlModel.FetchResult,
+			Deadline:    rrdpByUrlModel.Deadline,
+			UriScopes:   uriScopes}
 		belogs.Info("RrdpByUrlImpl(): will delta:", rrdpByUrlModel.NotifyUrl, jsonutil.MarshalJson(snapshotDeltaResult))
 		err = processRrdpDelta(rrdpByUrlModel.SyncLogId, &notificationModel,
 			&snapshotDeltaResult, syncLogFilesCh)
+		if err != nil {
+			// local files are not changed when delta fails, so just use snapshot
+			belogs.Error("RrdpByUrlImpl(): processRrdpDelta fail, will snapshot:", rrdpByUrlModel.NotifyUrl,
+				"  failDeltaUrl:", snapshotDeltaResult.FailDeltaUrl, err)
+			failDeltaUrl := snapshotDeltaResult.FailDeltaUrl
+			if len(failDeltaUrl) == 0 {
+				failDeltaUrl = rrdpByUrlModel.NotifyUrl
+			}
+			insertSyncRrdpLogEventDb(&rrdpByUrlModel, "deltaFail", failDeltaUrl, err.Error())
+			snapshotDeltaResult = SnapshotDeltaResult{
+				NotifyUrl:   rrdpByUrlModel.NotifyUrl,
+				DestPath:    rrdpByUrlModel.DestPath,
+				LastSerial:  0,
+				FetchResult: rrdpByUrlModel.FetchResult,
+				Deadline:    rrdpByUrlModel.Deadline,
+				UriScopes:   uriScopes}
+			err = processRrdpSnapshot(rrdpByUrlModel.SyncLogId, &notificationModel,
+				&snapshotDeltaResult, syncLogFilesCh)
+		}
 	}
 
+	if len(snapshotDeltaResult.UriErrors) > 0 && rrdpByUrlModel.UriErrors != nil {
+		rrdpByUrlModel.UriErrors.Store(rrdpByUrlModel.NotifyUrl, snapshotDeltaResult.UriErrors)
+	}
 	if err != nil {
 		belogs.Error("RrdpByUrlImpl(): processRrdpSnapshot or  processRrdpDelta fail, canDelta:",
 			canDelta, jsonutil.MarshalJson(rrdpByUrlModel), err)
 		return nil, err
 	}
+	if sessionReset {
+		errMsg := "session_id is changed from " + rrdpByUrlModel.LastSessionId + " to " + notificationModel.SessionId
+		belogs.Info("RrdpByUrlImpl(): session is reset by snapshot:", rrdpByUrlModel.NotifyUrl, errMsg)
+		insertSyncRrdpLogEventDb(&rrdpByUrlModel, "sessionReset", notificationModel.Snapshot.Uri, errMsg)
+	}
 	belogs.Info("RrdpByUrlImpl(): end ok, notifyUrl, len(files):", rrdpByUrlModel.NotifyUrl, len(snapshotDeltaResult.RrdpFiles),
 		"  time(s):", time.Since(start))
 	return snapshotDeltaResult.RrdpFiles, nil
 
 }
 
+// delta is used when session_id is same and last serial is in deltas. when session_id is changed, session is reset,
+// local files of last session are removed by snapshot only after it is downloaded and checked, so they are kept
+// when snapshot fails
+func checkRrdpDeltaOrSnapshot(rrdpByUrlModel *RrdpByUrlModel,
+	notificationModel *rrdputil.NotificationModel) (canDelta bool, sessionReset bool) {
+	if !rrdpByUrlModel.HasPath || !rrdpByUrlModel.HasLast {
+		return false, false
+	}
+	if rrdpByUrlModel.LastSessionId != notificationModel.SessionId {
+		return false, true
+	}
+	canDelta = rrdpByUrlModel.LastCurSerial >= notificationModel.MinSerial &&
+		rrdpByUrlModel.LastCurSerial < notificationModel.MaxSerial
+	return canDelta, false
+}
+
 // syncType:add/update/del
 // syncStyle: rrdp/rsync
 func ConvertToSyncLogFile(
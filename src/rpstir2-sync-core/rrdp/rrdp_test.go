@@ -0,0 +1,30 @@
+package rrdp
+
+import (
+	"testing"
+
+	"github.com/cpusoft/goutil/rrdputil"
+)
+
+func TestCheckRrdpDeltaOrSnapshot(t *testing.T) {
+	notificationModel := rrdputil.NotificationModel{SessionId: "session-2", MinSerial: 10, MaxSerial: 20}
+	tests := []struct {
+		name         string
+		model        RrdpByUrlModel
+		canDelta     bool
+		sessionReset bool
+	}{
+		{"first sync", RrdpByUrlModel{}, false, false},
+		{"no local path", RrdpByUrlModel{HasLast: true, LastSessionId: "session-1", LastCurSerial: 15}, false, false},
+		{"same session", RrdpByUrlModel{HasPath: true, HasLast: true, LastSessionId: "session-2", LastCurSerial: 15}, true, false},
+		{"too old serial", RrdpByUrlModel{HasPath: true, HasLast: true, LastSessionId: "session-2", LastCurSerial: 9}, false, false},
+		{"session reset", RrdpByUrlModel{HasPath: true, HasLast: true, LastSessionId: "session-1", LastCurSerial: 15}, false, true},
+	}
+	for _, test := range tests {
+		canDelta, sessionReset := checkRrdpDeltaOrSnapshot(&test.model, &notificationModel)
+		if canDelta != test.canDelta || sessionReset != test.sessionReset {
+			t.Errorf("%s: canDelta, sessionReset = %v, %v, want %v, %v",
+				test.name, canDelta, sessionReset, test.canDelta, test.sessionReset)
+		}
+	}
+}
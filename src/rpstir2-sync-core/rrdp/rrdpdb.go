@@ -13,7 +13,7 @@ import (
 
 // repoHostPath, is nic dest path, eg: /root/rpki/data/reporrdp/rpki.apnic.cn/
 func updateRrdpSnapshotDb(syncLogId uint64, notificationModel *rrdputil.NotificationModel,
-	snapshotModel *rrdputil.SnapshotModel, snapshotDeltaResult *SnapshotDeltaResult,
+	snapshotUrl string, snapshotDeltaResult *SnapshotDeltaResult,
 	syncLogFilesCh chan []model.LabRpkiSyncLogFile) (err error) {
 
 	belogs.Debug("updateRrdpSnapshotDb():syncLogId:", syncLogId,
@@ -61,7 +61,7 @@ func updateRrdpSnapshotDb(syncLogId uint64, notificationModel *rrdputil.Notifica
 	snapshotDeltaResult.LastSerial = 0
 	snapshotDeltaResult.RrdpType = "snapshot"
 	snapshotDeltaResult.RrdpTime = rrdpTime
-	snapshotDeltaResult.SnapshotOrDeltaUrl = snapshotModel.SnapshotUrl
+	snapshotDeltaResult.SnapshotOrDeltaUrl = snapshotUrl
 	err = insertSyncRrdpLogDb(session, syncLogId, snapshotDeltaResult)
 	if err != nil {
 		belogs.Error("updateRrdpSnapshotDb():insertSyncRrdpLogDb fail, syncLogId, notifyUrl:",
@@ -0,0 +1,56 @@
+package rrdp
+
+import (
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/jsonutil"
+	"github.com/cpusoft/goutil/xormdb"
+	model "rpstir2-model"
+)
+
+// notifyUrl --> rrdp which fell back to rsync
+func GetRrdpFallbacksDb() (rrdpFallbacks map[string]model.LabRpkiSyncRrdpFallback, err error) {
+	fallbacks := make([]model.LabRpkiSyncRrdpFallback, 0)
+	err = xormdb.XormEngine.Table("lab_rpki_sync_rrdp_fallback").
+		Cols("id,notifyUrl,failCount,failReason,failTime,nextRrdpTime,syncLogId").Find(&fallbacks)
+	if err != nil {
+		belogs.Error("GetRrdpFallbacksDb(): select lab_rpki_sync_rrdp_fallback fail:", err)
+		return nil, err
+	}
+	rrdpFallbacks = make(map[string]model.LabRpkiSyncRrdpFallback, len(fallbacks))
+	for i := range fallbacks {
+		rrdpFallbacks[fallbacks[i].NotifyUrl] = fallbacks[i]
+	}
+	belogs.Info("GetRrdpFallbacksDb(): len(rrdpFallbacks):", len(rrdpFallbacks))
+	return rrdpFallbacks, nil
+}
+
+func UpdateRrdpFallbackDb(rrdpFallback *model.LabRpkiSyncRrdpFallback) (err error) {
+	session, err := xormdb.NewSession()
+	if err != nil {
+		belogs.Error("UpdateRrdpFallbackDb(): NewSession fail:", err)
+		return err
+	}
+	defer session.Close()
+
+	sql := `insert into lab_rpki_sync_rrdp_fallback(notifyUrl,failCount,failReason,failTime,nextRrdpTime,syncLogId)
+		values(?,?,?,?,?,?)
+		on duplicate key update failCount=values(failCount), failReason=values(failReason), failTime=values(failTime),
+			nextRrdpTime=values(nextRrdpTime), syncLogId=values(syncLogId)`
+	_, err = session.Exec(sql, rrdpFallback.NotifyUrl, rrdpFallback.FailCount, rrdpFallback.FailReason,
+		rrdpFallback.FailTime, rrdpFallback.NextRrdpTime, rrdpFallback.SyncLogId)
+	if err != nil {
+		belogs.Error("UpdateRrdpFallbackDb(): insert lab_rpki_sync_rrdp_fallback fail:", jsonutil.MarshalJson(rrdpFallback), err)
+		return xormdb.RollbackAndLogError(session, "UpdateRrdpFallbackDb(): insert lab_rpki_sync_rrdp_fallback fail: ", err)
+	}
+	return xormdb.CommitSession(session)
+}
+
+// rrdp is ok again
+func DelRrdpFallbackDb(notifyUrl string) (err error) {
+	_, err = xormdb.XormEngine.Exec(`delete from lab_rpki_sync_rrdp_fallback where notifyUrl = ?`, notifyUrl)
+	if err != nil {
+		belogs.Error("DelRrdpFallbackDb(): delete lab_rpki_sync_rrdp_fallback fail:", notifyUrl, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package rrdp
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/conf"
+	model "rpstir2-model"
+)
+
+var rrdpHttpClient *http.Client
+var rrdpHttpClientOnce sync.Once
+
+// one client for all rrdp fetches, so keep-alive connections are reused per host.
+// compression of transport is disabled, gzip is decoded here to count the saved bytes
+func getRrdpHttpClient() *http.Client {
+	rrdpHttpClientOnce.Do(func() {
+		maxIdleConnsPerHost := conf.Int("rrdp::maxIdleConnsPerHost")
+		if maxIdleConnsPerHost <= 0 {
+			maxIdleConnsPerHost = 4
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.MaxIdleConnsPerHost = maxIdleConnsPerHost
+		transport.DisableCompression = true
+		rrdpHttpClient = &http.Client{Transport: transport}
+	})
+	return rrdpHttpClient
+}
+
+// count bytes on wire
+type rrdpCountReader struct {
+	reader io.Reader
+	count  uint64
+}
+
+func (c *rrdpCountReader) Read(p []byte) (n int, err error) {
+	n, err = c.reader.Read(p)
+	c.count += uint64(n)
+	return n, err
+}
+
+// body is written to w after gunzip. when etag or lastModified is not empty, it is a conditional request,
+// and notModified is true when server returns 304.
+func fetchRrdpHttp(url, etag, lastModified string, timeout time.Duration, w io.Writer,
+	fetchResult *model.RrdpFetchResult) (notModified bool, newEtag, newLastModified string, err error) {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		belogs.Error("fetchRrdpHttp(): NewRequestWithContext fail, url:", url, err)
+		return false, "", "", err
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+	if len(etag) > 0 {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if len(lastModified) > 0 {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	resp, err := getRrdpHttpClient().Do(req)
+	if err != nil {
+		belogs.Error("fetchRrdpHttp(): Do fail, url:", url, err)
+		return false, "", "", err
+	}
+	defer resp.Body.Close()
+	if fetchResult != nil {
+		atomic.AddUint64(&fetchResult.FetchCount, 1)
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		if fetchResult != nil {
+			atomic.AddUint64(&fetchResult.NotModifiedCount, 1)
+		}
+		belogs.Info("fetchRrdpHttp(): not modified, url:", url, "  etag:", etag, "  lastModified:", lastModified,
+			"  time(s):", time.Since(start))
+		return true, etag, lastModified, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		belogs.Error("fetchRrdpHttp(): status fail, url:", url, "  status:", resp.Status)
+		return false, "", "", errors.New("get " + url + " fail, status is " + resp.Status)
+	}
+
+	countReader := &rrdpCountReader{reader: resp.Body}
+	var reader io.Reader = countReader
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		gzipReader, err := gzip.NewReader(countReader)
+		if err != nil {
+			belogs.Error("fetchRrdpHttp(): gzip NewReader fail, url:", url, err)
+			return false, "", "", err
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	}
+	length, err := io.Copy(w, reader)
+	if err != nil {
+		belogs.Error("fetchRrdpHttp(): Copy fail, url:", url, err)
+		return false, "", "", err
+	}
+	if fetchResult != nil {
+		atomic.AddUint64(&fetchResult.Bytes, uint64(length))
+		atomic.AddUint64(&fetchResult.WireBytes, countReader.count)
+	}
+	belogs.Debug("fetchRrdpHttp(): url:", url, "  length:", length, "  wire length:", countReader.count,
+		"  time(s):", time.Since(start))
+	return false, resp.Header.Get("ETag"), resp.Header.Get("Last-Modified"), nil
+}
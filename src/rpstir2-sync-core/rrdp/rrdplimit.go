@@ -0,0 +1,56 @@
+package rrdp
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/cpusoft/goutil/conf"
+)
+
+// max bytes of one snapshot.xml or delta.xml after gunzip, sync::maxRrdpFileMegaBytes, 0 is no limit
+func getRrdpMaxFileBytes() uint64 {
+	maxMegaBytes := conf.Int("sync::maxRrdpFileMegaBytes")
+	if maxMegaBytes <= 0 {
+		return 0
+	}
+	return uint64(maxMegaBytes) * 1024 * 1024
+}
+
+// timeout of one fetch should not be after deadline of the repository. zero deadline is no limit
+func getRrdpTimeout(timeout time.Duration, deadline time.Time) (time.Duration, error) {
+	if deadline.IsZero() {
+		return timeout, nil
+	}
+	left := time.Until(deadline)
+	if left <= 0 {
+		return 0, errors.New("sync time of repository is more than limit")
+	}
+	if left < timeout {
+		return left, nil
+	}
+	return timeout, nil
+}
+
+// write will fail when more than maxBytes are written, 0 is no limit
+type rrdpLimitWriter struct {
+	writer   io.Writer
+	maxBytes uint64
+	count    uint64
+}
+
+func newRrdpLimitWriter(writer io.Writer, maxBytes uint64) io.Writer {
+	if maxBytes == 0 {
+		return writer
+	}
+	return &rrdpLimitWriter{writer: writer, maxBytes: maxBytes}
+}
+
+func (l *rrdpLimitWriter) Write(p []byte) (n int, err error) {
+	l.count += uint64(len(p))
+	if l.count > l.maxBytes {
+		return 0, errors.New("size is more than limit " + strconv.FormatUint(l.maxBytes, 10) + " bytes")
+	}
+	return l.writer.Write(p)
+}
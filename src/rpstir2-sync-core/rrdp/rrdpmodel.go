@@ -3,7 +3,9 @@ package rrdp
 import (
 	"time"
 
+	"github.com/cpusoft/goutil/jsonutil"
 	"github.com/cpusoft/goutil/rrdputil"
+	model "rpstir2-model"
 )
 
 type RrdpByUrlModel struct {
@@ -15,6 +17,16 @@ type RrdpByUrlModel struct {
 	LastSessionId string `json:"lastSessionId"`
 	LastCurSerial uint64 `json:"lastCurSerial"`
 	SyncLogId     uint64 `json:"syncLogId"`
+
+	// caRepositories which referenced notifyUrl in this sync, the ones in db are also used
+	CaRepositories []string `json:"caRepositories,omitempty"`
+
+	// http fetch result of notification.xml and snapshot.xml, may be nil
+	FetchResult *model.RrdpFetchResult `json:"-"`
+	// notifyUrl --> rejected uris, may be nil
+	UriErrors *jsonutil.JsonSyncMap `json:"-"`
+	// rrdp of notifyUrl should end before deadline, zero is no limit
+	Deadline time.Time `json:"-"`
 }
 
 // store snapshot and delta some data
@@ -34,6 +46,15 @@ type SnapshotDeltaResult struct {
 	RrdpFiles  []rrdputil.RrdpFile
 
 	SnapshotOrDeltaUrl string
+	// delta which is being processed, it is the failed delta when delta fails
+	FailDeltaUrl string
+
+	FetchResult *model.RrdpFetchResult `json:"-"`
+	Deadline    time.Time              `json:"-"`
+
+	// publish/withdraw should be in uriScopes, or will be rejected and saved in uriErrors
+	UriScopes []string
+	UriErrors []string
 }
 type DeltaResult struct {
 	DeltaModel rrdputil.DeltaModel `json:"deltaModel"`
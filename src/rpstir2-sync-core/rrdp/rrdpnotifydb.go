@@ -0,0 +1,48 @@
+package rrdp
+
+import (
+	"time"
+
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/rrdputil"
+	"github.com/cpusoft/goutil/xormdb"
+	model "rpstir2-model"
+)
+
+func getSyncRrdpNotifyDb(notifyUrl string) (rrdpNotify model.LabRpkiSyncRrdpNotify, has bool, err error) {
+	sql := `select id, notifyUrl, sessionId, ifnull(maxSerial,0) as maxSerial, ifnull(minSerial,0) as minSerial,
+			ifnull(etag,'') as etag, ifnull(lastModified,'') as lastModified, preceptTime
+		from lab_rpki_sync_rrdp_notify where notifyUrl = ?`
+	has, err = xormdb.XormEngine.SQL(sql, notifyUrl).Get(&rrdpNotify)
+	if err != nil {
+		belogs.Error("getSyncRrdpNotifyDb(): select lab_rpki_sync_rrdp_notify fail:", notifyUrl, err)
+		return rrdpNotify, false, err
+	}
+	return rrdpNotify, has, nil
+}
+
+// save the last notification.xml, etag/lastModified are of it
+func updateSyncRrdpNotifyDb(notifyUrl, etag, lastModified string, notificationModel *rrdputil.NotificationModel) (err error) {
+	session, err := xormdb.NewSession()
+	if err != nil {
+		belogs.Error("updateSyncRrdpNotifyDb(): NewSession fail:", err)
+		return err
+	}
+	defer session.Close()
+
+	sql := `insert into lab_rpki_sync_rrdp_notify(notifyUrl,version,sessionId,snapshotUrl,snapshotHash,
+			maxSerial,minSerial,preceptTime,etag,lastModified)
+		values(?,?,?,?,?,  ?,?,?,?,?)
+		on duplicate key update version=values(version), sessionId=values(sessionId), snapshotUrl=values(snapshotUrl),
+			snapshotHash=values(snapshotHash), maxSerial=values(maxSerial), minSerial=values(minSerial),
+			preceptTime=values(preceptTime), etag=values(etag), lastModified=values(lastModified)`
+	_, err = session.Exec(sql, notifyUrl, notificationModel.Version, notificationModel.SessionId,
+		notificationModel.Snapshot.Uri, notificationModel.Snapshot.Hash,
+		notificationModel.MaxSerial, notificationModel.MinSerial, time.Now(),
+		xormdb.SqlNullString(etag), xormdb.SqlNullString(lastModified))
+	if err != nil {
+		belogs.Error("updateSyncRrdpNotifyDb(): insert lab_rpki_sync_rrdp_notify fail:", notifyUrl, err)
+		return xormdb.RollbackAndLogError(session, "updateSyncRrdpNotifyDb(): insert lab_rpki_sync_rrdp_notify fail: ", err)
+	}
+	return xormdb.CommitSession(session)
+}
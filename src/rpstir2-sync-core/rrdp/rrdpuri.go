@@ -0,0 +1,129 @@
+package rrdp
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/xormdb"
+)
+
+// rrdp of notifyUrl can only publish/withdraw objects under rsync bases(rsync://host/module/) of caRepositories
+// of cas which referenced it, in lab_rpki_cer_sia and caRepositories of this sync. when it is empty, no scope is
+// known, and all objects are rejected
+func getRrdpUriScopes(rrdpByUrlModel *RrdpByUrlModel) (uriScopes []string) {
+	caRepositories, err := getCaRepositoriesByRpkiNotifyDb(rrdpByUrlModel.NotifyUrl)
+	if err != nil {
+		belogs.Error("getRrdpUriScopes(): getCaRepositoriesByRpkiNotifyDb fail, notifyUrl:", rrdpByUrlModel.NotifyUrl, err)
+		// no return
+	}
+	caRepositories = append(caRepositories, rrdpByUrlModel.CaRepositories...)
+
+	uriScopes = make([]string, 0)
+	existed := make(map[string]bool)
+	for _, caRepository := range caRepositories {
+		uriScope, err := getRrdpUriScope(caRepository)
+		if err != nil {
+			belogs.Error("getRrdpUriScopes(): getRrdpUriScope fail, notifyUrl:", rrdpByUrlModel.NotifyUrl,
+				"  caRepository:", caRepository, err)
+			continue
+		}
+		if !existed[uriScope] {
+			existed[uriScope] = true
+			uriScopes = append(uriScopes, uriScope)
+		}
+	}
+	belogs.Debug("getRrdpUriScopes(): notifyUrl:", rrdpByUrlModel.NotifyUrl, "  uriScopes:", uriScopes)
+	return uriScopes
+}
+
+// rsync://host/module/
+func getRrdpUriScope(caRepository string) (uriScope string, err error) {
+	err = checkRrdpUriSyntax(strings.TrimSuffix(caRepository, "/") + "/file")
+	if err != nil {
+		return "", err
+	}
+	segments := strings.Split(strings.TrimPrefix(caRepository, "rsync://"), "/")
+	if len(segments) < 2 || len(segments[1]) == 0 {
+		return "", errors.New("caRepository has no rsync module")
+	}
+	return "rsync://" + segments[0] + "/" + segments[1] + "/", nil
+}
+
+// uri should be rsync://host/path/file, and under one of uriScopes. when uriScopes is empty, it is rejected
+func checkRrdpUri(uri string, uriScopes []string) (err error) {
+	err = checkRrdpUriSyntax(uri)
+	if err != nil {
+		return err
+	}
+	if len(uriScopes) == 0 {
+		return errors.New("uri is out of repository, no caRepository is known")
+	}
+	for _, uriScope := range uriScopes {
+		if strings.HasPrefix(uri, uriScope) {
+			return nil
+		}
+	}
+	return errors.New("uri is out of repository " + strings.Join(uriScopes, ","))
+}
+
+// uri should be rsync://host/path/file without "..", ".", empty segment, percent-encoded separator,
+// backslash, query or control char
+func checkRrdpUriSyntax(uri string) (err error) {
+	if !strings.HasPrefix(uri, "rsync://") {
+		return errors.New("scheme is not rsync")
+	}
+	for _, c := range uri {
+		if c < 0x20 || c == 0x7f || c == '\\' || c == '?' || c == '#' {
+			return errors.New("uri has illegal char")
+		}
+	}
+	lowerUri := strings.ToLower(uri)
+	if strings.Contains(lowerUri, "%2f") || strings.Contains(lowerUri, "%5c") || strings.Contains(lowerUri, "%2e") ||
+		strings.Contains(lowerUri, "%00") {
+		return errors.New("uri has percent-encoded separator")
+	}
+
+	segments := strings.Split(strings.TrimPrefix(uri, "rsync://"), "/")
+	if len(segments) < 2 {
+		return errors.New("uri has no path")
+	}
+	if len(segments[0]) == 0 || strings.Contains(segments[0], "@") {
+		return errors.New("host of uri is illegal")
+	}
+	for _, segment := range segments[1:] {
+		if len(segment) == 0 || segment == "." || segment == ".." {
+			return errors.New("path of uri has empty, '.' or '..' segment")
+		}
+	}
+	return nil
+}
+
+// pathFileName should be under destPath
+func checkRrdpPathFileName(destPath, pathFileName string) (err error) {
+	cleanDestPath := filepath.Clean(destPath) + string(filepath.Separator)
+	if !strings.HasPrefix(filepath.Clean(pathFileName), cleanDestPath) {
+		return errors.New("file " + pathFileName + " is out of " + destPath)
+	}
+	return nil
+}
+
+// record error of uri, will be saved to rrdpUriErrors of sync result
+func (s *SnapshotDeltaResult) addUriError(uri string, err error) {
+	belogs.Error("addUriError(): uri is rejected, notifyUrl:", s.NotifyUrl, "  uri:", uri, err)
+	if len(s.UriErrors) < 1000 {
+		s.UriErrors = append(s.UriErrors, uri+": "+err.Error())
+	}
+}
+
+func getCaRepositoriesByRpkiNotifyDb(notifyUrl string) (caRepositories []string, err error) {
+	caRepositories = make([]string, 0)
+	sql := `select distinct caRepository from lab_rpki_cer_sia where rpkiNotify = ? and caRepository is not null`
+	err = xormdb.XormEngine.SQL(sql, notifyUrl).Find(&caRepositories)
+	if err != nil {
+		belogs.Error("getCaRepositoriesByRpkiNotifyDb(): select lab_rpki_cer_sia fail:", notifyUrl, err)
+		return nil, err
+	}
+	return caRepositories, nil
+}
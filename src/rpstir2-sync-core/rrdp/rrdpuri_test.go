@@ -0,0 +1,108 @@
+package rrdp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckRrdpUri(t *testing.T) {
+	uriScopes := []string{"rsync://example.net/repo/", "rsync://example.org/member/"}
+	tests := []struct {
+		uri string
+		ok  bool
+	}{
+		{"rsync://example.net/repo/a.cer", true},
+		{"rsync://example.net/repo/ca/sub/b.roa", true},
+		{"rsync://example.org/member/c.mft", true},
+		// traversal
+		{"rsync://example.net/repo/../other/a.cer", false},
+		{"rsync://example.net/repo/./a.cer", false},
+		{"rsync://example.net/repo//a.cer", false},
+		{"rsync://example.net/repo/ca/..", false},
+		// percent-encoded separator or dot
+		{"rsync://example.net/repo/..%2fother/a.cer", false},
+		{"rsync://example.net/repo/%2E%2E/a.cer", false},
+		{"rsync://example.net/repo/a%5cb.cer", false},
+		{"rsync://example.net/repo/a%00.cer", false},
+		// illegal char
+		{"rsync://example.net/repo/a\\b.cer", false},
+		{"rsync://example.net/repo/a.cer?x=1", false},
+		{"rsync://example.net/repo/a.cer#x", false},
+		{"rsync://example.net/repo/a\n.cer", false},
+		// not rsync
+		{"https://example.net/repo/a.cer", false},
+		{"file:///etc/passwd", false},
+		{"RSYNC://example.net/repo/a.cer", false},
+		{"/repo/a.cer", false},
+		// host
+		{"rsync:///repo/a.cer", false},
+		{"rsync://user@example.net/repo/a.cer", false},
+		{"rsync://example.net", false},
+		// out of scope
+		{"rsync://example.net/other/a.cer", false},
+		{"rsync://example.net/repository/a.cer", false},
+		{"rsync://evil.example.net/repo/a.cer", false},
+		{"rsync://example.org/repo/a.cer", false},
+	}
+	for _, test := range tests {
+		err := checkRrdpUri(test.uri, uriScopes)
+		if (err == nil) != test.ok {
+			t.Errorf("%q: ok should be %v, err: %v", test.uri, test.ok, err)
+		}
+	}
+
+	// no scope is known, so all are rejected
+	if err := checkRrdpUri("rsync://example.net/repo/a.cer", nil); err == nil {
+		t.Error("uri should be rejected when no scope is known")
+	}
+}
+
+func TestGetRrdpUriScope(t *testing.T) {
+	tests := []struct {
+		caRepository string
+		uriScope     string
+	}{
+		{"rsync://example.net/repo/ca/", "rsync://example.net/repo/"},
+		{"rsync://example.net/repo/", "rsync://example.net/repo/"},
+		{"rsync://example.net/repo", "rsync://example.net/repo/"},
+		{"rsync://example.net/", ""},
+		{"rsync://example.net/repo/../ca/", ""},
+		{"https://example.net/repo/", ""},
+	}
+	for _, test := range tests {
+		uriScope, err := getRrdpUriScope(test.caRepository)
+		if uriScope != test.uriScope || (err == nil) != (len(test.uriScope) > 0) {
+			t.Errorf("%q: uriScope = %q, err = %v, want %q", test.caRepository, uriScope, err, test.uriScope)
+		}
+	}
+}
+
+func TestCheckRrdpPathFileName(t *testing.T) {
+	destPath := filepath.Join(os.TempDir(), "rrdprepo")
+	sep := string(filepath.Separator)
+	tests := []struct {
+		pathFileName string
+		ok           bool
+	}{
+		{filepath.Join(destPath, "example.net", "repo", "a.cer"), true},
+		{destPath + sep + "example.net" + sep + "repo" + sep + ".." + sep + "a.cer", true},
+		{destPath + sep + ".." + sep + "a.cer", false},
+		{destPath + sep + "example.net" + sep + ".." + sep + ".." + sep + "etc" + sep + "passwd", false},
+		{destPath + "_stage" + sep + "a.cer", false},
+		{destPath + "other" + sep + "a.cer", false},
+		{destPath, false},
+		{destPath + sep, false},
+		{sep + "etc" + sep + "passwd", false},
+	}
+	for _, test := range tests {
+		err := checkRrdpPathFileName(destPath, test.pathFileName)
+		if (err == nil) != test.ok {
+			t.Errorf("%q: ok should be %v, err: %v", test.pathFileName, test.ok, err)
+		}
+	}
+	// destPath with trailing separator
+	if err := checkRrdpPathFileName(destPath+sep, filepath.Join(destPath, "a.cer")); err != nil {
+		t.Error(err)
+	}
+}
@@ -1,52 +1,190 @@
 package rrdp
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"io"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/conf"
 	"github.com/cpusoft/goutil/jsonutil"
+	"github.com/cpusoft/goutil/osutil"
 	"github.com/cpusoft/goutil/rrdputil"
 	"github.com/cpusoft/goutil/urlutil"
 	model "rpstir2-model"
+	coresync "rpstir2-sync-core/sync"
 )
 
-func getRrdpSnapshot(notificationModel *rrdputil.NotificationModel) (snapshotModel rrdputil.SnapshotModel, err error) {
+// snapshot.xml is downloaded to snapshotFile, and its sha256 is checked by notification while downloading
+func getRrdpSnapshot(notificationModel *rrdputil.NotificationModel, snapshotFile string,
+	snapshotDeltaResult *SnapshotDeltaResult) (err error) {
+	start := time.Now()
+	belogs.Debug("getRrdpSnapshot(): Snapshot.Uri :", notificationModel.Snapshot.Uri, "  snapshotFile:", snapshotFile)
 
-	belogs.Debug("getRrdpSnapshot(): Snapshot.Uri :", notificationModel.Snapshot.Uri)
-	snapshotModel, err = rrdputil.GetRrdpSnapshot(notificationModel.Snapshot.Uri)
+	timeout := time.Duration(conf.Int("rrdp::snapshotTimeoutMinutes")) * time.Minute
+	if timeout <= 0 {
+		timeout = 30 * time.Minute
+	}
+	timeout, err = getRrdpTimeout(timeout, snapshotDeltaResult.Deadline)
 	if err != nil {
-		belogs.Error("getRrdpSnapshot(): GetRrdpSnapshot fail,Snapshot.Uri :",
-			notificationModel.Snapshot.Uri, err)
-		return snapshotModel, err
+		belogs.Error("getRrdpSnapshot(): getRrdpTimeout fail, Snapshot.Uri :", notificationModel.Snapshot.Uri, err)
+		return err
 	}
+	err = os.MkdirAll(filepath.Dir(snapshotFile), os.ModePerm)
+	if err != nil {
+		belogs.Error("getRrdpSnapshot(): MkdirAll fail, snapshotFile:", snapshotFile, err)
+		return err
+	}
+	file, err := os.Create(snapshotFile)
+	if err != nil {
+		belogs.Error("getRrdpSnapshot(): Create fail, snapshotFile:", snapshotFile, err)
+		return err
+	}
+	defer file.Close()
 
-	err = rrdputil.CheckRrdpSnapshot(&snapshotModel, notificationModel)
+	hash := sha256.New()
+	_, _, _, err = fetchRrdpHttp(notificationModel.Snapshot.Uri, "", "", timeout,
+		newRrdpLimitWriter(io.MultiWriter(file, hash), getRrdpMaxFileBytes()), snapshotDeltaResult.FetchResult)
 	if err != nil {
-		belogs.Error("getRrdpSnapshot(): CheckRrdpSnapshot fail, Snapshot.Uri,snapshotModel :",
-			notificationModel.Snapshot.Uri, err)
-		belogs.Debug("getRrdpSnapshot(): CheckRrdpSnapshot fail, Snapshot.Uri,snapshotModel :",
-			notificationModel.Snapshot.Uri, jsonutil.MarshalJson(snapshotModel), err)
-		return snapshotModel, err
+		belogs.Error("getRrdpSnapshot(): fetchRrdpHttp fail, Snapshot.Uri :", notificationModel.Snapshot.Uri, "  snapshotFile:", snapshotFile, err)
+		return err
+	}
+	fileHash := hex.EncodeToString(hash.Sum(nil))
+	if !strings.EqualFold(fileHash, notificationModel.Snapshot.Hash) {
+		belogs.Error("getRrdpSnapshot(): hash mismatch, Snapshot.Uri :", notificationModel.Snapshot.Uri,
+			"  fileHash:", fileHash, "  notification hash:", notificationModel.Snapshot.Hash)
+		return errors.New("hash of snapshot " + notificationModel.Snapshot.Uri + " is not equal to notification")
+	}
+	belogs.Info("getRrdpSnapshot(): Snapshot.Uri :", notificationModel.Snapshot.Uri, "  time(s):", time.Since(start))
+	return nil
+}
+
+// snapshot.xml is read token by token, and every publish is passed to savePublish after decoded.
+// when savePublish is nil, it is just checked. it fails when more than maxObjects publishes, 0 is no limit
+func walkRrdpSnapshotFile(snapshotFile string, notificationModel *rrdputil.NotificationModel, maxObjects uint64,
+	savePublish func(uri string, bytes []byte) error) (count int, err error) {
+
+	file, err := os.Open(snapshotFile)
+	if err != nil {
+		belogs.Error("walkRrdpSnapshotFile(): Open fail, snapshotFile:", snapshotFile, err)
+		return 0, err
 	}
-	return snapshotModel, nil
+	defer file.Close()
+
+	decoder := xml.NewDecoder(file)
+	hasSnapshot := false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			belogs.Error("walkRrdpSnapshotFile(): Token fail, snapshotFile:", snapshotFile, err)
+			return count, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "snapshot":
+			attrs := make(map[string]string, len(start.Attr))
+			for _, attr := range start.Attr {
+				attrs[attr.Name.Local] = attr.Value
+			}
+			if attrs["version"] != "1" || attrs["session_id"] != notificationModel.SessionId ||
+				attrs["serial"] != strconv.FormatUint(notificationModel.Serial, 10) {
+				belogs.Error("walkRrdpSnapshotFile(): snapshot is not equal to notification, snapshotFile:", snapshotFile,
+					"  snapshot:", jsonutil.MarshalJson(attrs), "  sessionId:", notificationModel.SessionId,
+					"  serial:", notificationModel.Serial)
+				return count, errors.New("version, session_id or serial of snapshot is not equal to notification")
+			}
+			hasSnapshot = true
+		case "publish":
+			if !hasSnapshot {
+				belogs.Error("walkRrdpSnapshotFile(): publish is not in snapshot, snapshotFile:", snapshotFile)
+				return count, errors.New("publish is not in snapshot")
+			}
+			var uri string
+			for _, attr := range start.Attr {
+				if attr.Name.Local == "uri" {
+					uri = attr.Value
+				}
+			}
+			if len(uri) == 0 {
+				belogs.Error("walkRrdpSnapshotFile(): uri of publish is empty, snapshotFile:", snapshotFile)
+				return count, errors.New("uri of publish is empty")
+			}
+			if maxObjects > 0 && uint64(count) >= maxObjects {
+				belogs.Error("walkRrdpSnapshotFile(): count of publishes is more than limit, snapshotFile:", snapshotFile,
+					"  maxObjects:", maxObjects)
+				return count, errors.New("count of objects is more than limit " + strconv.FormatUint(maxObjects, 10))
+			}
 
+			// only one publish is in memory
+			var content struct {
+				Base64 string `xml:",chardata"`
+			}
+			err = decoder.DecodeElement(&content, &start)
+			if err != nil {
+				belogs.Error("walkRrdpSnapshotFile(): DecodeElement fail, uri:", uri, err)
+				return count, err
+			}
+			bytes, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(content.Base64), ""))
+			if err != nil {
+				belogs.Error("walkRrdpSnapshotFile(): DecodeString fail, uri:", uri, err)
+				return count, err
+			}
+			if savePublish != nil {
+				err = savePublish(uri, bytes)
+				if err != nil {
+					belogs.Error("walkRrdpSnapshotFile(): savePublish fail, uri:", uri, err)
+					return count, err
+				}
+			}
+			count++
+		}
+	}
+	if !hasSnapshot {
+		belogs.Error("walkRrdpSnapshotFile(): snapshot is not found, snapshotFile:", snapshotFile)
+		return count, errors.New("snapshot is not found")
+	}
+	return count, nil
 }
 
 func processRrdpSnapshot(syncLogId uint64, notificationModel *rrdputil.NotificationModel,
 	snapshotDeltaResult *SnapshotDeltaResult, syncLogFilesCh chan []model.LabRpkiSyncLogFile) (err error) {
 
-	belogs.Debug("processRrdpSnapshot():syncLogId:", syncLogId, "notificationModel.Snapshot.Uri, snapshotModel:",
+	belogs.Debug("processRrdpSnapshot():syncLogId:", syncLogId, "notificationModel.Snapshot.Uri:",
 		notificationModel.Snapshot.Uri)
-	// first to get snapshot files, because this may fail easily
-	snapshotModel, err := getRrdpSnapshot(notificationModel)
+	// first to get snapshot file and check it, because this may fail easily
+	stagePath := getRrdpStagePath(snapshotDeltaResult.DestPath, snapshotDeltaResult.NotifyUrl)
+	os.RemoveAll(stagePath)
+	defer os.RemoveAll(stagePath)
+	snapshotFile := osutil.JoinPathFile(stagePath, "snapshot.xml")
+	err = getRrdpSnapshot(notificationModel, snapshotFile, snapshotDeltaResult)
 	if err != nil {
 		belogs.Error("processRrdpSnapshot(): getRrdpSnapshot fail, Snapshot url: ",
 			notificationModel.Snapshot.Uri, err)
 		return err
 	}
-	belogs.Info("processRrdpSnapshot():notificationModel.Snapshot.Uri, snapshotModel:",
-		notificationModel.Snapshot.Uri,
-		snapshotModel.Serial, len(snapshotModel.SnapshotPublishs))
+	count, err := walkRrdpSnapshotFile(snapshotFile, notificationModel, coresync.GetMaxObjectsPerRepo(), nil)
+	if err != nil {
+		belogs.Error("processRrdpSnapshot(): walkRrdpSnapshotFile check fail, Snapshot url: ",
+			notificationModel.Snapshot.Uri, err)
+		return err
+	}
+	belogs.Info("processRrdpSnapshot():notificationModel.Snapshot.Uri, serial, count:",
+		notificationModel.Snapshot.Uri, notificationModel.Serial, count)
 
 	// rm disk files
 	repoHostPath, err := urlutil.JoinPrefixPathAndUrlHost(snapshotDeltaResult.DestPath, notificationModel.Snapshot.Uri)
@@ -67,21 +205,55 @@ func processRrdpSnapshot(syncLogId uint64, notificationModel *rrdputil.Notificat
 		belogs.Error("processRrdpSnapshot(): MkdirAll, repoHostPath: ", repoHostPath, err)
 	}
 
-	// download snapshot files
-	rrdpFiles, err := rrdputil.SaveRrdpSnapshotToRrdpFiles(&snapshotModel, snapshotDeltaResult.DestPath)
+	// save every publish to file when it is decoded
+	rrdpFiles := make([]rrdputil.RrdpFile, 0, count)
+	_, err = walkRrdpSnapshotFile(snapshotFile, notificationModel, 0, func(uri string, bytes []byte) error {
+		// publish out of repository is ignored
+		err := checkRrdpUri(uri, snapshotDeltaResult.UriScopes)
+		if err != nil {
+			snapshotDeltaResult.addUriError(uri, err)
+			return nil
+		}
+		pathFileName, err := urlutil.JoinPrefixPathAndUrlFileName(snapshotDeltaResult.DestPath, uri)
+		if err != nil {
+			belogs.Error("processRrdpSnapshot(): JoinPrefixPathAndUrlFileName fail, uri:", uri, err)
+			return err
+		}
+		err = checkRrdpPathFileName(snapshotDeltaResult.DestPath, pathFileName)
+		if err != nil {
+			snapshotDeltaResult.addUriError(uri, err)
+			return nil
+		}
+		err = os.MkdirAll(filepath.Dir(pathFileName), os.ModePerm)
+		if err != nil {
+			belogs.Error("processRrdpSnapshot(): MkdirAll fail, pathFileName:", pathFileName, err)
+			return err
+		}
+		err = os.WriteFile(pathFileName, bytes, 0644)
+		if err != nil {
+			belogs.Error("processRrdpSnapshot(): WriteFile fail, pathFileName:", pathFileName, err)
+			return err
+		}
+		filePath, fileName := osutil.GetFilePathAndFileName(pathFileName)
+		rrdpFiles = append(rrdpFiles, rrdputil.RrdpFile{
+			FilePath:  filePath,
+			FileName:  fileName,
+			SyncType:  "add",
+			SourceUrl: uri,
+		})
+		return nil
+	})
 	if err != nil {
-		belogs.Error("processRrdpSnapshot(): SaveRrdpSnapshotToRrdpFiles fail, Snapshot url,  DestPath: ",
+		belogs.Error("processRrdpSnapshot(): walkRrdpSnapshotFile save fail, Snapshot url,  DestPath: ",
 			notificationModel.Snapshot.Uri, snapshotDeltaResult.DestPath, err)
 		return err
 	}
 	snapshotDeltaResult.RrdpFiles = rrdpFiles
-	belogs.Debug("processRrdpSnapshot():SaveRrdpSnapshotToFiles, notificationModel.Snapshot.Uri, rrdpFiles,snapshotDeltaResult.DestPath:",
-		notificationModel.Snapshot.Uri, rrdpFiles, snapshotDeltaResult.DestPath)
-	belogs.Info("processRrdpSnapshot():SaveRrdpSnapshotToFiles, notificationModel.Snapshot.Uri, len(rrdpFiles),snapshotDeltaResult.DestPath:",
+	belogs.Info("processRrdpSnapshot():save snapshot, notificationModel.Snapshot.Uri, len(rrdpFiles),snapshotDeltaResult.DestPath:",
 		notificationModel.Snapshot.Uri, len(rrdpFiles), snapshotDeltaResult.DestPath)
 
 	// del old cer/crl/mft/roa and update to rrdplog
-	err = updateRrdpSnapshotDb(syncLogId, notificationModel, &snapshotModel,
+	err = updateRrdpSnapshotDb(syncLogId, notificationModel, notificationModel.Snapshot.Uri,
 		snapshotDeltaResult, syncLogFilesCh)
 	if err != nil {
 		belogs.Error("processRrdpSnapshot(): updateRrdpSnapshotDb fail, syncLogId, snapshotDeltaResult: ",
@@ -0,0 +1,96 @@
+package rrdp
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cpusoft/goutil/rrdputil"
+)
+
+const testRrdpSnapshot = `<snapshot xmlns="http://www.ripe.net/rpki/rrdp" version="1" session_id="9df4b597-af9e-4dca-bdda-719cce2c4e28" serial="3">
+  <publish uri="rsync://example.net/repo/a.cer">YTE=</publish>
+  <publish uri="rsync://example.net/repo/b.roa">
+    YjE=
+  </publish>
+</snapshot>`
+
+func testRrdpSnapshotFile(t *testing.T, content string) string {
+	snapshotFile := filepath.Join(t.TempDir(), "snapshot.xml")
+	err := os.WriteFile(snapshotFile, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return snapshotFile
+}
+
+func TestWalkRrdpSnapshotFile(t *testing.T) {
+	notificationModel := rrdputil.NotificationModel{SessionId: "9df4b597-af9e-4dca-bdda-719cce2c4e28", Serial: 3}
+	publishs := make(map[string]string)
+	count, err := walkRrdpSnapshotFile(testRrdpSnapshotFile(t, testRrdpSnapshot), &notificationModel, 2,
+		func(uri string, bytes []byte) error {
+			publishs[uri] = string(bytes)
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 || publishs["rsync://example.net/repo/a.cer"] != "a1" || publishs["rsync://example.net/repo/b.roa"] != "b1" {
+		t.Errorf("count = %d, publishs = %v", count, publishs)
+	}
+}
+
+func TestWalkRrdpSnapshotFileFail(t *testing.T) {
+	notificationModel := rrdputil.NotificationModel{SessionId: "9df4b597-af9e-4dca-bdda-719cce2c4e28", Serial: 3}
+	tests := []struct {
+		name       string
+		content    string
+		maxObjects uint64
+	}{
+		{"malformed xml", strings.Replace(testRrdpSnapshot, "</snapshot>", "</publish>", 1), 0},
+		{"truncated xml", testRrdpSnapshot[:len(testRrdpSnapshot)/2], 0},
+		{"not snapshot", `<notification version="1"/>`, 0},
+		{"publish out of snapshot", `<publish uri="rsync://example.net/repo/a.cer">YTE=</publish>`, 0},
+		{"session_id mismatch", strings.Replace(testRrdpSnapshot, "9df4b597", "00000000", 1), 0},
+		{"serial mismatch", strings.Replace(testRrdpSnapshot, `serial="3"`, `serial="4"`, 1), 0},
+		{"version mismatch", strings.Replace(testRrdpSnapshot, `version="1"`, `version="2"`, 1), 0},
+		{"empty uri", strings.Replace(testRrdpSnapshot, `uri="rsync://example.net/repo/a.cer"`, "", 1), 0},
+		{"bad base64", strings.Replace(testRrdpSnapshot, "YTE=", "Y!E=", 1), 0},
+		{"too many objects", testRrdpSnapshot, 1},
+	}
+	for _, test := range tests {
+		saved := 0
+		_, err := walkRrdpSnapshotFile(testRrdpSnapshotFile(t, test.content), &notificationModel, test.maxObjects,
+			func(uri string, bytes []byte) error {
+				saved++
+				return nil
+			})
+		if err == nil {
+			t.Errorf("%s: should fail", test.name)
+		}
+		if test.name == "too many objects" && saved != 1 {
+			t.Errorf("%s: saved = %d, want 1", test.name, saved)
+		}
+	}
+}
+
+func TestRrdpLimitWriter(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := io.Copy(newRrdpLimitWriter(&buf, uint64(len(testRrdpSnapshot))), strings.NewReader(testRrdpSnapshot))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	_, err = io.Copy(newRrdpLimitWriter(&buf, uint64(len(testRrdpSnapshot)-1)), strings.NewReader(testRrdpSnapshot))
+	if err == nil {
+		t.Error("oversized snapshot should fail")
+	}
+	buf.Reset()
+	_, err = io.Copy(newRrdpLimitWriter(&buf, 0), strings.NewReader(testRrdpSnapshot))
+	if err != nil || buf.Len() != len(testRrdpSnapshot) {
+		t.Errorf("no limit: len = %d, err = %v", buf.Len(), err)
+	}
+}
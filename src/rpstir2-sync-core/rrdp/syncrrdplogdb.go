@@ -109,3 +109,23 @@ func insertSyncRrdpLogDb(
 
 	return nil
 }
+
+// rrdpType: deltaFail/sessionReset, sessionId and serial are still the last ones,
+// so next sync will go on from the last ones when the following snapshot fails
+func insertSyncRrdpLogEventDb(rrdpByUrlModel *RrdpByUrlModel, rrdpType string, snapshotOrDeltaUrl string, errMsg string) {
+	if len(errMsg) > 1024 {
+		errMsg = errMsg[:1024]
+	}
+	sqlStr := `INSERT lab_rpki_sync_rrdp_log(syncLogId,  notifyUrl,  sessionId,  
+				lastSerial,	  curSerial,  
+				rrdpTime,  rrdpType, snapshotOrDeltaUrl, errMsg)
+				VALUES(?,?,?,   ?,?,    ?,?,?,?)`
+	_, err := xormdb.XormEngine.Exec(sqlStr, rrdpByUrlModel.SyncLogId, rrdpByUrlModel.NotifyUrl, rrdpByUrlModel.LastSessionId,
+		xormdb.SqlNullInt(int64(rrdpByUrlModel.LastCurSerial)), rrdpByUrlModel.LastCurSerial,
+		time.Now(), rrdpType, snapshotOrDeltaUrl, errMsg)
+	if err != nil {
+		belogs.Error("insertSyncRrdpLogEventDb(): INSERT lab_rpki_sync_rrdp_log fail:", rrdpType,
+			jsonutil.MarshalJson(rrdpByUrlModel), errMsg, err)
+		// no return
+	}
+}
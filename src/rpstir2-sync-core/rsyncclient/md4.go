@@ -0,0 +1,93 @@
+package rsyncclient
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// md4(rfc1320) is the whole file checksum of rsync protocol 27-29 (and of later protocols when it is negotiated),
+// there is no md4 in go standard library
+type md4Digest struct {
+	s   [4]uint32
+	x   [64]byte
+	nx  int
+	len uint64
+}
+
+func newMd4() *md4Digest {
+	d := &md4Digest{}
+	d.s = [4]uint32{0x67452301, 0xefcdab89, 0x98badcfe, 0x10325476}
+	return d
+}
+
+func (d *md4Digest) Write(p []byte) (n int, err error) {
+	n = len(p)
+	d.len += uint64(n)
+	if d.nx > 0 {
+		c := copy(d.x[d.nx:], p)
+		d.nx += c
+		p = p[c:]
+		if d.nx == 64 {
+			d.block(d.x[:])
+			d.nx = 0
+		}
+	}
+	for len(p) >= 64 {
+		d.block(p[:64])
+		p = p[64:]
+	}
+	if len(p) > 0 {
+		d.nx = copy(d.x[:], p)
+	}
+	return n, nil
+}
+
+func (d *md4Digest) Sum() []byte {
+	length := d.len
+	var pad [72]byte
+	pad[0] = 0x80
+	padLen := 56 - int(length%64)
+	if padLen <= 0 {
+		padLen += 64
+	}
+	binary.LittleEndian.PutUint64(pad[padLen:], length<<3)
+	d.Write(pad[:padLen+8])
+
+	sum := make([]byte, 16)
+	for i, s := range d.s {
+		binary.LittleEndian.PutUint32(sum[i*4:], s)
+	}
+	return sum
+}
+
+var md4Shift1 = []int{3, 7, 11, 19}
+var md4Shift2 = []int{3, 5, 9, 13}
+var md4Shift3 = []int{3, 9, 11, 15}
+var md4Xindex2 = []int{0, 4, 8, 12, 1, 5, 9, 13, 2, 6, 10, 14, 3, 7, 11, 15}
+var md4Xindex3 = []int{0, 8, 4, 12, 2, 10, 6, 14, 1, 9, 5, 13, 3, 11, 7, 15}
+
+func (d *md4Digest) block(p []byte) {
+	var x [16]uint32
+	for i := range x {
+		x[i] = binary.LittleEndian.Uint32(p[i*4:])
+	}
+	a, b, c, dd := d.s[0], d.s[1], d.s[2], d.s[3]
+
+	for i := 0; i < 16; i++ {
+		f := (b & c) | (^b & dd)
+		a, b, c, dd = dd, bits.RotateLeft32(a+f+x[i], md4Shift1[i%4]), b, c
+	}
+	for i := 0; i < 16; i++ {
+		g := (b & c) | (b & dd) | (c & dd)
+		a, b, c, dd = dd, bits.RotateLeft32(a+g+x[md4Xindex2[i]]+0x5a827999, md4Shift2[i%4]), b, c
+	}
+	for i := 0; i < 16; i++ {
+		h := b ^ c ^ dd
+		a, b, c, dd = dd, bits.RotateLeft32(a+h+x[md4Xindex3[i]]+0x6ed9eba1, md4Shift3[i%4]), b, c
+	}
+
+	d.s[0] += a
+	d.s[1] += b
+	d.s[2] += c
+	d.s[3] += dd
+}
@@ -0,0 +1,1010 @@
+package rsyncclient
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cpusoft/goutil/belogs"
+)
+
+// rsync client of rsync daemon(rsync://), it only receives files, and never changes files of rsync daemon.
+// protocol 27-31 is negotiated with rsync daemon, and file list, indexes and checksums are of the negotiated
+// protocol: md4 of seed and data before protocol 30, md5 or negotiated md4 from protocol 30. incremental
+// recursion is not used. files are always transferred whole, and unchanged files (same size and modTime) are skipped
+type RsyncClient struct {
+	// timeout of one call, include connect, 0 is no timeout
+	Timeout time.Duration
+	// max bytes of one file, 0 is no limit
+	MaxFileBytes uint64
+	// max bytes of all downloaded files of one call, 0 is no limit
+	MaxTotalBytes uint64
+	// timeout of connecting, 0 is same to Timeout
+	ConTimeout time.Duration
+	// max KBytes per second of receiving, 0 is no limit
+	BandwidthKBps uint64
+}
+
+func NewRsyncClient(timeout time.Duration, maxFileBytes uint64, maxTotalBytes uint64) *RsyncClient {
+	return &RsyncClient{
+		Timeout:       timeout,
+		MaxFileBytes:  maxFileBytes,
+		MaxTotalBytes: maxTotalBytes,
+	}
+}
+
+func NewRsyncClientByOptions(rsyncOptions RsyncOptions) *RsyncClient {
+	rsyncClient := NewRsyncClient(rsyncOptions.Timeout, rsyncOptions.MaxFileBytes, rsyncOptions.MaxTotalBytes)
+	rsyncClient.ConTimeout = rsyncOptions.ConTimeout
+	rsyncClient.BandwidthKBps = rsyncOptions.BandwidthKBps
+	return rsyncClient
+}
+
+const (
+	// client sends the highest protocol, and the lower one of client and rsync daemon is used
+	rsyncProtocolVersion    = 31
+	rsyncMinProtocolVersion = 27
+	rsyncDefaultPort        = "873"
+	// -e of server is not shell but supported compat flags of client from protocol 30: safe file list and
+	// varint flags (which also means negotiation of checksums). 'i' of incremental recursion is not sent
+	rsyncClientInfo = "-rte.fv"
+
+	// flags of file list. extended flags(second byte) are from protocol 28, all are varint when
+	// rsyncCfVarintFlistFlags is set
+	rsyncXmitSameMode       = 0x02
+	rsyncXmitExtendedFlags  = 0x04
+	rsyncXmitSameName       = 0x20
+	rsyncXmitLongName       = 0x40
+	rsyncXmitSameTime       = 0x80
+	rsyncXmitIoErrorEndlist = 0x1000
+	rsyncXmitModNsec        = 0x2000
+
+	// compat flags of protocol 30
+	rsyncCfIncRecurse       = 0x01
+	rsyncCfVarintFlistFlags = 0x80
+
+	// iflags of file index from protocol 29
+	rsyncItemBasisTypeFollows = 0x0800
+	rsyncItemXnameFollows     = 0x1000
+	rsyncItemTransfer         = 0x8000
+
+	rsyncMaxPath  = 4096
+	rsyncModeType = 0170000
+	rsyncModeDir  = 0040000
+	rsyncModeReg  = 0100000
+)
+
+// checksums of files which client supports, by preference
+var rsyncChecksums = []string{"md5", "md4"}
+
+// rsync://host[:port]/module/path
+type rsyncUrlModel struct {
+	Host     string
+	Address  string
+	Module   string
+	FilePath string
+	IsDir    bool
+}
+
+// entry of file list, name is cleaned
+type rsyncFileEntry struct {
+	name    string
+	size    int64
+	modTime int64
+	mode    uint32
+	// same name is in file list
+	duplicated bool
+}
+
+func (e *rsyncFileEntry) isDir() bool {
+	return e.mode&rsyncModeType == rsyncModeDir
+}
+
+func (e *rsyncFileEntry) isRegular() bool {
+	return e.mode&rsyncModeType == rsyncModeReg
+}
+
+// file list of rsyncUrl
+func (c *RsyncClient) List(rsyncUrl string) (rsyncFiles []RsyncFile, err error) {
+	start := time.Now()
+	belogs.Debug("List(): rsyncUrl:", rsyncUrl)
+	rsyncUrlModel, err := parseRsyncUrl(rsyncUrl)
+	if err != nil {
+		belogs.Error("List(): parseRsyncUrl fail:", rsyncUrl, err)
+		return nil, err
+	}
+	rsyncConn, err := c.connect(rsyncUrlModel)
+	if err != nil {
+		belogs.Error("List(): connect fail:", rsyncUrl, err)
+		return nil, err
+	}
+	defer rsyncConn.close()
+
+	seed, entries, _, err := receiveFileList(rsyncConn)
+	if err != nil {
+		belogs.Error("List(): receiveFileList fail:", rsyncUrl, err)
+		return nil, err
+	}
+	_, err = receiveFiles(rsyncConn, seed, entries, nil, nil)
+	if err != nil {
+		belogs.Error("List(): receiveFiles fail:", rsyncUrl, err)
+		return nil, err
+	}
+
+	rsyncFiles = make([]RsyncFile, 0, len(entries))
+	for i := range entries {
+		if entries[i].duplicated {
+			continue
+		}
+		rsyncFiles = append(rsyncFiles, RsyncFile{
+			Name:    entries[i].name,
+			Size:    entries[i].size,
+			ModTime: time.Unix(entries[i].modTime, 0),
+			Mode:    entries[i].mode,
+			IsDir:   entries[i].isDir(),
+		})
+	}
+	belogs.Info("List(): rsyncUrl:", rsyncUrl, "  len(rsyncFiles):", len(rsyncFiles), "  time(s):", time.Since(start))
+	return rsyncFiles, nil
+}
+
+// rsync rsyncUrl to destPath/host/module/path, as rsync -rt --delete does.
+// rsyncDestPath is local directory of rsyncUrl, or local directory of the file when rsyncUrl is a file
+func (c *RsyncClient) Rsync(rsyncUrl string, destPath string) (rsyncResult RsyncResult, err error) {
+	start := time.Now()
+	belogs.Debug("Rsync(): rsyncUrl:", rsyncUrl, "  destPath:", destPath)
+	rsyncUrlModel, err := parseRsyncUrl(rsyncUrl)
+	if err != nil {
+		belogs.Error("Rsync(): parseRsyncUrl fail:", rsyncUrl, err)
+		return rsyncResult, err
+	}
+	localDir := getLocalDir(rsyncUrlModel, destPath)
+	rsyncResult.RsyncDestPath = localDir + string(os.PathSeparator)
+
+	rsyncConn, err := c.connect(rsyncUrlModel)
+	if err != nil {
+		belogs.Error("Rsync(): connect fail:", rsyncUrl, err)
+		return rsyncResult, err
+	}
+	defer rsyncConn.close()
+
+	seed, entries, ioError, err := receiveFileList(rsyncConn)
+	if err != nil {
+		belogs.Error("Rsync(): receiveFileList fail:", rsyncUrl, err)
+		return rsyncResult, err
+	}
+
+	// make directories, and find changed files
+	var needBytes uint64
+	needs := make([]int, 0)
+	for i := range entries {
+		entry := &entries[i]
+		if entry.duplicated {
+			continue
+		}
+		localFile := filepath.Join(localDir, filepath.FromSlash(entry.name))
+		if entry.isDir() {
+			if err = makeLocalDir(localFile); err != nil {
+				belogs.Error("Rsync(): makeLocalDir fail:", rsyncUrl, localFile, err)
+				return rsyncResult, err
+			}
+			continue
+		}
+		if !entry.isRegular() {
+			continue
+		}
+		rsyncResult.FileCount++
+		if c.MaxFileBytes > 0 && uint64(entry.size) > c.MaxFileBytes {
+			belogs.Error("Rsync(): size of file is more than limit:", rsyncUrl, entry.name, entry.size, c.MaxFileBytes)
+			return rsyncResult, fmt.Errorf("%w: size of %s is %d, limit is %d bytes", ErrRsyncSizeLimit,
+				entry.name, entry.size, c.MaxFileBytes)
+		}
+		fileInfo, statErr := os.Stat(localFile)
+		if statErr == nil && fileInfo.Mode().IsRegular() && fileInfo.Size() == entry.size &&
+			fileInfo.ModTime().Unix() == entry.modTime {
+			continue
+		}
+		needs = append(needs, i)
+		needBytes += uint64(entry.size)
+	}
+	if c.MaxTotalBytes > 0 && needBytes > c.MaxTotalBytes {
+		belogs.Error("Rsync(): size of files is more than limit:", rsyncUrl, needBytes, c.MaxTotalBytes)
+		return rsyncResult, fmt.Errorf("%w: size of files is %d, limit is %d bytes", ErrRsyncSizeLimit,
+			needBytes, c.MaxTotalBytes)
+	}
+	belogs.Debug("Rsync(): rsyncUrl:", rsyncUrl, "  len(entries):", len(entries), "  len(needs):", len(needs),
+		"  needBytes:", needBytes)
+
+	receiver := &rsyncReceiver{
+		localDir:      localDir,
+		maxFileBytes:  c.MaxFileBytes,
+		maxTotalBytes: c.MaxTotalBytes,
+	}
+	received, err := receiveFiles(rsyncConn, seed, entries, needs, receiver)
+	rsyncResult.DownloadCount = received
+	rsyncResult.DownloadBytes = receiver.totalBytes
+	if err != nil {
+		belogs.Error("Rsync(): receiveFiles fail:", rsyncUrl, err)
+		return rsyncResult, err
+	}
+
+	// like rsync, when files cannot be read or sent by rsync daemon, local files are not deleted, and it fails
+	ioError |= rsyncConn.ioError
+	if ioError != 0 || received != uint64(len(needs)) {
+		belogs.Error("Rsync(): some files are not transferred:", rsyncUrl, "  ioError:", ioError,
+			"  len(needs):", len(needs), "  received:", received, "  lastError:", rsyncConn.lastError)
+		return rsyncResult, fmt.Errorf("%w: some files are not transferred, %d of %d are received, error from rsync daemon: %s",
+			ErrRsyncProtocol, received, len(needs), rsyncConn.lastError)
+	}
+	if rsyncUrlModel.IsDir {
+		rsyncResult.DeleteCount, err = deleteLocalFiles(localDir, entries)
+		if err != nil {
+			belogs.Error("Rsync(): deleteLocalFiles fail:", rsyncUrl, localDir, err)
+			return rsyncResult, err
+		}
+	}
+	belogs.Info("Rsync(): rsyncUrl:", rsyncUrl, "  rsyncResult:", rsyncResult, "  time(s):", time.Since(start))
+	return rsyncResult, nil
+}
+
+func parseRsyncUrl(rsyncUrl string) (rsyncUrlModel rsyncUrlModel, err error) {
+	u, err := url.Parse(rsyncUrl)
+	if err != nil || u.Scheme != "rsync" || len(u.Hostname()) == 0 {
+		return rsyncUrlModel, fmt.Errorf("%w: url is not rsync url: %s", ErrRsyncFile, rsyncUrl)
+	}
+	segments := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 2)
+	if len(segments[0]) == 0 {
+		return rsyncUrlModel, fmt.Errorf("%w: url has no module: %s", ErrRsyncFile, rsyncUrl)
+	}
+	rsyncUrlModel.Host = u.Hostname()
+	rsyncUrlModel.Address = u.Host
+	if len(u.Port()) == 0 {
+		rsyncUrlModel.Address = net.JoinHostPort(u.Hostname(), rsyncDefaultPort)
+	}
+	rsyncUrlModel.Module = segments[0]
+	rsyncUrlModel.IsDir = true
+	if len(segments) == 2 && len(segments[1]) > 0 {
+		rsyncUrlModel.FilePath = path.Clean(segments[1])
+		rsyncUrlModel.IsDir = strings.HasSuffix(segments[1], "/")
+		if rsyncUrlModel.FilePath == ".." || strings.HasPrefix(rsyncUrlModel.FilePath, "../") {
+			return rsyncUrlModel, fmt.Errorf("%w: url is not safe: %s", ErrRsyncFile, rsyncUrl)
+		}
+	}
+	return rsyncUrlModel, nil
+}
+
+// destPath/host/module/path, or its parent directory when rsync url is a file
+func getLocalDir(rsyncUrlModel rsyncUrlModel, destPath string) string {
+	localDir := filepath.Join(destPath, rsyncUrlModel.Host, rsyncUrlModel.Module, filepath.FromSlash(rsyncUrlModel.FilePath))
+	if !rsyncUrlModel.IsDir {
+		localDir = filepath.Dir(localDir)
+	}
+	return localDir
+}
+
+// connect and start rsync daemon as sender of module/path
+func (c *RsyncClient) connect(rsyncUrlModel rsyncUrlModel) (rsyncConn *rsyncConn, err error) {
+	conTimeout := c.Timeout
+	if c.ConTimeout > 0 && (conTimeout <= 0 || c.ConTimeout < conTimeout) {
+		conTimeout = c.ConTimeout
+	}
+	conn, err := net.DialTimeout("tcp", rsyncUrlModel.Address, conTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrRsyncConnect, rsyncUrlModel.Address, err)
+	}
+	if c.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(c.Timeout))
+	}
+	if c.BandwidthKBps > 0 {
+		rsyncConn = newRsyncConn(newBwlimitConn(conn, c.BandwidthKBps))
+	} else {
+		rsyncConn = newRsyncConn(conn)
+	}
+	defer func() {
+		if err != nil {
+			conn.Close()
+		}
+	}()
+
+	// greeting and module
+	rsyncConn.writeLine("@RSYNCD: " + strconv.Itoa(rsyncProtocolVersion) + ".0")
+	rsyncConn.writeLine(rsyncUrlModel.Module)
+	if err = rsyncConn.flush(); err != nil {
+		return nil, rsyncConn.wrapError("send greeting fail", err)
+	}
+	greeting, err := rsyncConn.readLine()
+	if err != nil {
+		return nil, rsyncConn.wrapError("read greeting fail", err)
+	}
+	version, err := parseRsyncGreeting(greeting)
+	if err != nil {
+		return nil, err
+	}
+	belogs.Debug("connect(): greeting:", rsyncUrlModel.Address, greeting)
+	if version < rsyncMinProtocolVersion {
+		return nil, fmt.Errorf("%w: protocol %d of rsync daemon is not supported", ErrRsyncProtocol, version)
+	}
+	rsyncConn.protocol = version
+	if rsyncConn.protocol > rsyncProtocolVersion {
+		rsyncConn.protocol = rsyncProtocolVersion
+	}
+	for {
+		line, err := rsyncConn.readLine()
+		if err != nil {
+			return nil, rsyncConn.wrapError("read module response fail", err)
+		}
+		if line == "@RSYNCD: OK" {
+			break
+		}
+		if strings.HasPrefix(line, "@ERROR") || line == "@RSYNCD: EXIT" {
+			return nil, fmt.Errorf("%w: %s: %s", ErrRsyncModule, rsyncUrlModel.Module, line)
+		}
+		if strings.HasPrefix(line, "@RSYNCD: AUTHREQD") {
+			return nil, fmt.Errorf("%w: %s: authentication is not supported", ErrRsyncModule, rsyncUrlModel.Module)
+		}
+		// motd
+		belogs.Debug("connect(): motd:", rsyncUrlModel.Address, line)
+	}
+
+	// arguments of server, and end with empty argument
+	serverPath := rsyncUrlModel.Module + "/"
+	if len(rsyncUrlModel.FilePath) > 0 {
+		serverPath += rsyncUrlModel.FilePath
+		if rsyncUrlModel.IsDir {
+			serverPath += "/"
+		}
+	}
+	for _, arg := range []string{"--server", "--sender", rsyncClientInfo, ".", serverPath, ""} {
+		rsyncConn.writeArg(arg)
+	}
+	if err = rsyncConn.flush(); err != nil {
+		return nil, rsyncConn.wrapError("send arguments fail", err)
+	}
+	return rsyncConn, nil
+}
+
+// "@RSYNCD: 31.0" --> 31
+func parseRsyncGreeting(greeting string) (int, error) {
+	if !strings.HasPrefix(greeting, "@RSYNCD: ") {
+		return 0, fmt.Errorf("%w: greeting is wrong: %s", ErrRsyncProtocol, greeting)
+	}
+	version := strings.TrimPrefix(greeting, "@RSYNCD: ")
+	if i := strings.IndexAny(version, ". "); i >= 0 {
+		version = version[:i]
+	}
+	v, err := strconv.Atoi(version)
+	if err != nil {
+		return 0, fmt.Errorf("%w: greeting is wrong: %s", ErrRsyncProtocol, greeting)
+	}
+	return v, nil
+}
+
+// compat flags and checksum from protocol 30, then checksum seed. checksum is negotiated when rsync daemon
+// sets rsyncCfVarintFlistFlags (rsync 3.2 and later), otherwise it is md5 from protocol 30, and md4 before
+func setupProtocol(rsyncConn *rsyncConn) (seed int32, err error) {
+	rsyncConn.checksum = "md4"
+	if rsyncConn.protocol >= 30 {
+		rsyncConn.checksum = "md5"
+		if rsyncConn.compatFlags, err = rsyncConn.readVarint(); err != nil {
+			return 0, rsyncConn.wrapError("read compat flags fail", err)
+		}
+		if rsyncConn.compatFlags&rsyncCfIncRecurse != 0 {
+			return 0, fmt.Errorf("%w: incremental recursion is not supported", ErrRsyncProtocol)
+		}
+		if rsyncConn.compatFlags&rsyncCfVarintFlistFlags != 0 {
+			if rsyncConn.checksum, err = negotiateChecksum(rsyncConn); err != nil {
+				return 0, err
+			}
+		}
+	}
+	seed, err = rsyncConn.readInt()
+	if err != nil {
+		return 0, rsyncConn.wrapError("read checksum seed fail", err)
+	}
+	belogs.Debug("setupProtocol(): protocol:", rsyncConn.protocol, "  compatFlags:", rsyncConn.compatFlags,
+		"  checksum:", rsyncConn.checksum)
+	return seed, nil
+}
+
+// both sides send names of checksums they support, and the first one of client which rsync daemon supports is used
+func negotiateChecksum(rsyncConn *rsyncConn) (string, error) {
+	rsyncConn.writeVstring(strings.Join(rsyncChecksums, " "))
+	if err := rsyncConn.flush(); err != nil {
+		return "", rsyncConn.wrapError("send checksums fail", err)
+	}
+	serverChecksums, err := rsyncConn.readVstring()
+	if err != nil {
+		return "", rsyncConn.wrapError("read checksums fail", err)
+	}
+	names := strings.Fields(serverChecksums)
+	for _, checksum := range rsyncChecksums {
+		for _, name := range names {
+			if name == checksum {
+				return checksum, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("%w: no checksum of rsync daemon is supported: %s", ErrRsyncProtocol, serverChecksums)
+}
+
+// checksum seed, sorted file list, and io error of rsync daemon
+func receiveFileList(rsyncConn *rsyncConn) (seed int32, entries []rsyncFileEntry, ioError int32, err error) {
+	seed, err = setupProtocol(rsyncConn)
+	if err != nil {
+		return 0, nil, 0, err
+	}
+	rsyncConn.multiplex = true
+	rsyncConn.muxWriter.multiplex = rsyncConn.protocol >= 30
+
+	// empty filter list
+	rsyncConn.writeInt(0)
+	if err = rsyncConn.flush(); err != nil {
+		return 0, nil, 0, rsyncConn.wrapError("send filter list fail", err)
+	}
+
+	entries = make([]rsyncFileEntry, 0)
+	var last rsyncFileEntry
+	lastName := ""
+	for {
+		flags, endIoError, err := receiveXmitFlags(rsyncConn)
+		if err != nil {
+			return 0, nil, 0, rsyncConn.wrapError("read file list fail", err)
+		}
+		if flags == 0 {
+			ioError = endIoError
+			break
+		}
+		entry, err := receiveFileEntry(rsyncConn, flags, &last, lastName)
+		if err != nil {
+			return 0, nil, 0, err
+		}
+		lastName = entry.name
+		last = entry
+		entry.name, err = cleanRsyncFileName(entry.name)
+		if err != nil {
+			return 0, nil, 0, err
+		}
+		entries = append(entries, entry)
+	}
+	// io error is after file list before protocol 30, then in end of file list or in message
+	if rsyncConn.protocol < 30 {
+		ioError, err = rsyncConn.readInt()
+		if err != nil {
+			return 0, nil, 0, rsyncConn.wrapError("read io error fail", err)
+		}
+	}
+
+	// indexes of files are in sorted file list, and duplicated ones are kept but not used
+	sort.SliceStable(entries, func(i, j int) bool {
+		return compareRsyncFileName(rsyncConn.protocol, &entries[i], &entries[j]) < 0
+	})
+	for i := 1; i < len(entries); i++ {
+		if entries[i].name == entries[i-1].name {
+			entries[i].duplicated = true
+		}
+	}
+	return seed, entries, ioError, nil
+}
+
+// flags of file entry, 0 is end of file list with io error. io error is in end of file list when flags are
+// varint, or when rsync daemon sends rsyncXmitExtendedFlags|rsyncXmitIoErrorEndlist as end of safe file list
+func receiveXmitFlags(rsyncConn *rsyncConn) (flags int32, ioError int32, err error) {
+	if rsyncConn.compatFlags&rsyncCfVarintFlistFlags != 0 {
+		if flags, err = rsyncConn.readVarint(); err != nil || flags != 0 {
+			return flags, 0, err
+		}
+		ioError, err = rsyncConn.readVarint()
+		return 0, ioError, err
+	}
+	b, err := rsyncConn.readByte()
+	if err != nil || b == 0 {
+		return 0, 0, err
+	}
+	flags = int32(b)
+	if rsyncConn.protocol >= 28 && flags&rsyncXmitExtendedFlags != 0 {
+		if b, err = rsyncConn.readByte(); err != nil {
+			return 0, 0, err
+		}
+		flags |= int32(b) << 8
+		if flags == rsyncXmitExtendedFlags|rsyncXmitIoErrorEndlist {
+			ioError, err = rsyncConn.readVarint()
+			return 0, ioError, err
+		}
+	}
+	return flags, 0, nil
+}
+
+// size is varlong and modTime is varlong from protocol 30, nanoseconds of modTime are ignored.
+// uid, gid, devices, links and hard links are not in file list, because they are not in arguments of server
+func receiveFileEntry(rsyncConn *rsyncConn, flags int32, last *rsyncFileEntry, lastName string) (entry rsyncFileEntry, err error) {
+	var l1, l2 int
+	if flags&rsyncXmitSameName != 0 {
+		b, err := rsyncConn.readByte()
+		if err != nil {
+			return entry, rsyncConn.wrapError("read file name fail", err)
+		}
+		l1 = int(b)
+	}
+	if flags&rsyncXmitLongName != 0 {
+		i, err := rsyncConn.readVarint30()
+		if err != nil {
+			return entry, rsyncConn.wrapError("read file name fail", err)
+		}
+		l2 = int(i)
+	} else {
+		b, err := rsyncConn.readByte()
+		if err != nil {
+			return entry, rsyncConn.wrapError("read file name fail", err)
+		}
+		l2 = int(b)
+	}
+	if l1 > len(lastName) || l2 < 0 || l1+l2 > rsyncMaxPath {
+		return entry, fmt.Errorf("%w: length of file name is wrong", ErrRsyncProtocol)
+	}
+	name, err := rsyncConn.readFull(l2)
+	if err != nil {
+		return entry, rsyncConn.wrapError("read file name fail", err)
+	}
+	entry.name = lastName[:l1] + string(name)
+
+	entry.size, err = rsyncConn.readVarlong30(3)
+	if err != nil {
+		return entry, rsyncConn.wrapError("read file size fail", err)
+	}
+	if entry.size < 0 {
+		return entry, fmt.Errorf("%w: size of %s is wrong", ErrRsyncProtocol, entry.name)
+	}
+	entry.modTime = last.modTime
+	if flags&rsyncXmitSameTime == 0 {
+		if rsyncConn.protocol >= 30 {
+			entry.modTime, err = rsyncConn.readVarlong(4)
+		} else {
+			var modTime int32
+			modTime, err = rsyncConn.readInt()
+			entry.modTime = int64(modTime)
+		}
+		if err != nil {
+			return entry, rsyncConn.wrapError("read file time fail", err)
+		}
+	}
+	if flags&rsyncXmitModNsec != 0 {
+		if _, err = rsyncConn.readVarint(); err != nil {
+			return entry, rsyncConn.wrapError("read file time fail", err)
+		}
+	}
+	entry.mode = last.mode
+	if flags&rsyncXmitSameMode == 0 {
+		mode, err := rsyncConn.readInt()
+		if err != nil {
+			return entry, rsyncConn.wrapError("read file mode fail", err)
+		}
+		entry.mode = uint32(mode)
+	}
+	return entry, nil
+}
+
+// compares file names like f_name_cmp of rsync. before protocol 29, it is same to comparing of names.
+// from protocol 29, directory is compared as name with '/' after files of its parent, and "." is the first
+func compareRsyncFileName(protocol int, e1, e2 *rsyncFileEntry) int {
+	pathType := rsyncNameItem
+	if protocol >= 29 {
+		pathType = rsyncNamePath
+	}
+	dir1, dir2 := path.Dir(e1.name), path.Dir(e2.name)
+	if dir1 == dir2 {
+		dir1, dir2 = ".", "."
+	}
+	c1 := newRsyncNameCursor(e1, dir1, pathType)
+	c2 := newRsyncNameCursor(e2, dir2, pathType)
+	if c1.nameType != c2.nameType {
+		return c1.compareType()
+	}
+	for {
+		if len(c1.s) == 0 {
+			c1.next()
+			if len(c2.s) > 0 && c1.nameType != c2.nameType {
+				return c1.compareType()
+			}
+		}
+		if len(c2.s) == 0 {
+			c2.next()
+			if len(c1.s) > 0 && c1.nameType != c2.nameType {
+				return c1.compareType()
+			}
+		}
+		if len(c1.s) == 0 || len(c2.s) == 0 {
+			return len(c1.s) - len(c2.s)
+		}
+		if c1.s[0] != c2.s[0] {
+			return int(c1.s[0]) - int(c2.s[0])
+		}
+		c1.s, c2.s = c1.s[1:], c2.s[1:]
+	}
+}
+
+const (
+	rsyncNameItem = iota
+	rsyncNamePath
+)
+
+const (
+	rsyncNameStateDir = iota
+	rsyncNameStateSlash
+	rsyncNameStateBase
+	rsyncNameStateTrailing
+)
+
+// part of file name which is being compared: directory, '/', base name, and '/' after directory
+type rsyncNameCursor struct {
+	entry    *rsyncFileEntry
+	pathType int
+	nameType int
+	state    int
+	s        string
+}
+
+func newRsyncNameCursor(entry *rsyncFileEntry, dir string, pathType int) *rsyncNameCursor {
+	c := &rsyncNameCursor{entry: entry, pathType: pathType}
+	if dir != "." {
+		c.nameType, c.state, c.s = pathType, rsyncNameStateDir, dir
+		return c
+	}
+	c.nameType, c.state, c.s = c.typeOfEntry(), rsyncNameStateBase, path.Base(entry.name)
+	if c.nameType == rsyncNamePath && c.s == "." {
+		c.nameType, c.state, c.s = rsyncNameItem, rsyncNameStateTrailing, ""
+	}
+	return c
+}
+
+func (c *rsyncNameCursor) typeOfEntry() int {
+	if c.entry.isDir() {
+		return c.pathType
+	}
+	return rsyncNameItem
+}
+
+func (c *rsyncNameCursor) next() {
+	switch c.state {
+	case rsyncNameStateDir:
+		c.state, c.s = rsyncNameStateSlash, "/"
+	case rsyncNameStateSlash:
+		c.nameType, c.state, c.s = c.typeOfEntry(), rsyncNameStateBase, path.Base(c.entry.name)
+	case rsyncNameStateBase:
+		c.state = rsyncNameStateTrailing
+		if c.nameType == rsyncNamePath {
+			c.s = "/"
+			return
+		}
+		c.nameType = rsyncNameItem
+	case rsyncNameStateTrailing:
+		c.nameType = rsyncNameItem
+	}
+}
+
+// path is after item
+func (c *rsyncNameCursor) compareType() int {
+	if c.nameType == rsyncNamePath {
+		return 1
+	}
+	return -1
+}
+
+// file name should be under the rsync url
+func cleanRsyncFileName(name string) (string, error) {
+	cleaned := path.Clean(name)
+	if len(name) == 0 || strings.ContainsRune(name, 0) || path.IsAbs(cleaned) ||
+		cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("%w: file name from rsync daemon is not safe: %q", ErrRsyncFile, name)
+	}
+	return cleaned, nil
+}
+
+// save files of rsync daemon to local
+type rsyncReceiver struct {
+	localDir      string
+	maxFileBytes  uint64
+	maxTotalBytes uint64
+	totalBytes    uint64
+}
+
+// request files of needs(indexes of entries), and receive them by receiver.
+// there are two phases (three from protocol 29), every phase ends with done from both sides, then statistics
+// of rsync daemon and goodbye (rsync daemon replies it from protocol 31)
+func receiveFiles(rsyncConn *rsyncConn, seed int32, entries []rsyncFileEntry, needs []int,
+	receiver *rsyncReceiver) (received uint64, err error) {
+
+	// requests are sent when files are received, so rsync daemon will not be blocked
+	requested := make(map[int32]bool, len(needs))
+	for _, i := range needs {
+		requested[int32(i)] = true
+	}
+	requestCh := make(chan error, 1)
+	go func() {
+		for _, i := range needs {
+			// whole file: index, iflags from protocol 29, and sum head of no blocks (count, blength, s2length, remainder)
+			rsyncConn.writeNdx(int32(i))
+			if rsyncConn.protocol >= 29 {
+				rsyncConn.writeShortint(rsyncItemTransfer)
+			}
+			for j := 0; j < 4; j++ {
+				rsyncConn.writeInt(0)
+			}
+		}
+		rsyncConn.writeNdx(rsyncNdxDone)
+		requestCh <- rsyncConn.flush()
+	}()
+
+	maxPhase := 1
+	if rsyncConn.protocol >= 29 {
+		maxPhase = 2
+	}
+	phase := 0
+	for {
+		index, err := rsyncConn.readNdx()
+		if err != nil {
+			return received, rsyncConn.wrapError("read file index fail", err)
+		}
+		if index == rsyncNdxDone {
+			if phase >= maxPhase {
+				break
+			}
+			// no file is redone in later phases, all are whole files
+			if phase == 0 {
+				if err = <-requestCh; err != nil {
+					return received, rsyncConn.wrapError("send requests fail", err)
+				}
+			}
+			phase++
+			rsyncConn.writeNdx(rsyncNdxDone)
+			if err = rsyncConn.flush(); err != nil {
+				return received, rsyncConn.wrapError("send phase end fail", err)
+			}
+			continue
+		}
+		if !requested[index] || receiver == nil {
+			return received, fmt.Errorf("%w: file index %d is not requested", ErrRsyncProtocol, index)
+		}
+		delete(requested, index)
+		if rsyncConn.protocol >= 29 {
+			if err = receiveItemFlags(rsyncConn); err != nil {
+				return received, err
+			}
+		}
+		for j := 0; j < 4; j++ {
+			if _, err = rsyncConn.readInt(); err != nil {
+				return received, rsyncConn.wrapError("read sum head fail", err)
+			}
+		}
+		if err = receiver.receiveFile(rsyncConn, seed, &entries[index]); err != nil {
+			return received, err
+		}
+		received++
+	}
+
+	// statistics: total read, total written, total size, and build time and transfer time of file list
+	// from protocol 29
+	statCount := 3
+	if rsyncConn.protocol >= 29 {
+		statCount = 5
+	}
+	for j := 0; j < statCount; j++ {
+		if _, err = rsyncConn.readVarlong30(3); err != nil {
+			return received, rsyncConn.wrapError("read statistics fail", err)
+		}
+	}
+	rsyncConn.writeNdx(rsyncNdxDone)
+	if err = rsyncConn.flush(); err != nil {
+		return received, rsyncConn.wrapError("send goodbye fail", err)
+	}
+	if rsyncConn.protocol >= 31 {
+		index, err := rsyncConn.readNdx()
+		if err != nil {
+			return received, rsyncConn.wrapError("read goodbye fail", err)
+		}
+		if index != rsyncNdxDone {
+			return received, fmt.Errorf("%w: goodbye %d is wrong", ErrRsyncProtocol, index)
+		}
+	}
+	return received, nil
+}
+
+// iflags of file from protocol 29, which rsync daemon sends back, with optional basis type and name
+func receiveItemFlags(rsyncConn *rsyncConn) error {
+	iflags, err := rsyncConn.readShortint()
+	if err != nil {
+		return rsyncConn.wrapError("read iflags fail", err)
+	}
+	if iflags&rsyncItemBasisTypeFollows != 0 {
+		if _, err = rsyncConn.readByte(); err != nil {
+			return rsyncConn.wrapError("read basis type fail", err)
+		}
+	}
+	if iflags&rsyncItemXnameFollows != 0 {
+		if _, err = rsyncConn.readVstring(); err != nil {
+			return rsyncConn.wrapError("read xname fail", err)
+		}
+	}
+	return nil
+}
+
+// checksum of whole file
+type rsyncSum interface {
+	io.Writer
+	Sum() []byte
+}
+
+type rsyncMd5 struct {
+	hash.Hash
+}
+
+func (m rsyncMd5) Sum() []byte {
+	return m.Hash.Sum(nil)
+}
+
+// md4 of seed and data before protocol 30, then md5 or negotiated md4 of data
+func newRsyncSum(rsyncConn *rsyncConn, seed int32) rsyncSum {
+	if rsyncConn.checksum == "md5" {
+		return rsyncMd5{md5.New()}
+	}
+	md := newMd4()
+	if rsyncConn.protocol < 30 {
+		var seedBytes [4]byte
+		binary.LittleEndian.PutUint32(seedBytes[:], uint32(seed))
+		md.Write(seedBytes[:])
+	}
+	return md
+}
+
+// data is sent as tokens: length and literal data, and 0 is end. then checksum of data.
+// file is saved to temp file in same directory, and then renamed
+func (r *rsyncReceiver) receiveFile(rsyncConn *rsyncConn, seed int32, entry *rsyncFileEntry) (err error) {
+	localFile := filepath.Join(r.localDir, filepath.FromSlash(entry.name))
+	if err = makeLocalDir(filepath.Dir(localFile)); err != nil {
+		return err
+	}
+	tmpFile, err := os.CreateTemp(filepath.Dir(localFile), ".rsync-*")
+	if err != nil {
+		return fmt.Errorf("%w: create temp file of %s fail: %v", ErrRsyncFile, entry.name, err)
+	}
+	defer func() {
+		if err != nil {
+			tmpFile.Close()
+			os.Remove(tmpFile.Name())
+		}
+	}()
+
+	md := newRsyncSum(rsyncConn, seed)
+	writer := io.MultiWriter(tmpFile, md)
+
+	var fileBytes uint64
+	buf := make([]byte, 32*1024)
+	for {
+		token, err := rsyncConn.readInt()
+		if err != nil {
+			return rsyncConn.wrapError("read data of "+entry.name+" fail", err)
+		}
+		if token == 0 {
+			break
+		}
+		if token < 0 {
+			// block of local file, but no block is sent
+			return fmt.Errorf("%w: token %d of %s is wrong", ErrRsyncProtocol, token, entry.name)
+		}
+		fileBytes += uint64(token)
+		r.totalBytes += uint64(token)
+		if r.maxFileBytes > 0 && fileBytes > r.maxFileBytes {
+			return fmt.Errorf("%w: size of %s is more than %d bytes", ErrRsyncSizeLimit, entry.name, r.maxFileBytes)
+		}
+		if r.maxTotalBytes > 0 && r.totalBytes > r.maxTotalBytes {
+			return fmt.Errorf("%w: size of files is more than %d bytes", ErrRsyncSizeLimit, r.maxTotalBytes)
+		}
+		for left := int(token); left > 0; {
+			n := left
+			if n > len(buf) {
+				n = len(buf)
+			}
+			if _, err = io.ReadFull(rsyncConn, buf[:n]); err != nil {
+				return rsyncConn.wrapError("read data of "+entry.name+" fail", err)
+			}
+			if _, err = writer.Write(buf[:n]); err != nil {
+				return fmt.Errorf("%w: write %s fail: %v", ErrRsyncFile, entry.name, err)
+			}
+			left -= n
+		}
+	}
+	sum, err := rsyncConn.readFull(16)
+	if err != nil {
+		return rsyncConn.wrapError("read checksum of "+entry.name+" fail", err)
+	}
+	if !bytes.Equal(sum, md.Sum()) {
+		return fmt.Errorf("%w: %s", ErrRsyncChecksum, entry.name)
+	}
+
+	if err = tmpFile.Close(); err != nil {
+		return fmt.Errorf("%w: close %s fail: %v", ErrRsyncFile, entry.name, err)
+	}
+	if err = os.Chmod(tmpFile.Name(), 0644); err != nil {
+		return fmt.Errorf("%w: chmod %s fail: %v", ErrRsyncFile, entry.name, err)
+	}
+	// local directory of same name is replaced by file
+	if fileInfo, statErr := os.Lstat(localFile); statErr == nil && fileInfo.IsDir() {
+		os.RemoveAll(localFile)
+	}
+	if err = os.Rename(tmpFile.Name(), localFile); err != nil {
+		return fmt.Errorf("%w: rename %s fail: %v", ErrRsyncFile, entry.name, err)
+	}
+	modTime := time.Unix(entry.modTime, 0)
+	if err = os.Chtimes(localFile, modTime, modTime); err != nil {
+		belogs.Error("receiveFile(): Chtimes fail:", localFile, err)
+		// no return
+	}
+	return nil
+}
+
+// local file of same name is replaced by directory
+func makeLocalDir(dir string) error {
+	if fileInfo, err := os.Lstat(dir); err == nil {
+		if fileInfo.IsDir() {
+			return nil
+		}
+		os.Remove(dir)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("%w: make directory %s fail: %v", ErrRsyncFile, dir, err)
+	}
+	return nil
+}
+
+// local files and directories which are not in file list are deleted, returns count of deleted files
+func deleteLocalFiles(localDir string, entries []rsyncFileEntry) (deleteCount uint64, err error) {
+	names := make(map[string]bool, len(entries))
+	for i := range entries {
+		names[entries[i].name] = entries[i].isDir()
+	}
+	err = filepath.WalkDir(localDir, func(localFile string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(localDir, localFile)
+		if err != nil || name == "." {
+			return err
+		}
+		isDir, ok := names[filepath.ToSlash(name)]
+		if ok && isDir == d.IsDir() {
+			return nil
+		}
+		belogs.Debug("deleteLocalFiles(): delete:", localFile)
+		if !d.IsDir() {
+			deleteCount++
+			return os.Remove(localFile)
+		}
+		filepath.WalkDir(localFile, func(_ string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				deleteCount++
+			}
+			return nil
+		})
+		if err = os.RemoveAll(localFile); err != nil {
+			return err
+		}
+		return filepath.SkipDir
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return deleteCount, fmt.Errorf("%w: delete local files fail: %v", ErrRsyncFile, err)
+	}
+	return deleteCount, nil
+}
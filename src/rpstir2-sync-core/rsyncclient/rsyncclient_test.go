@@ -0,0 +1,831 @@
+package rsyncclient
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testRsyncFile struct {
+	data    []byte
+	modTime int32
+	isDir   bool
+}
+
+// stand-in of rsync daemon, it is sender of one module, and speaks protocol 27-31
+type testRsyncDaemon struct {
+	listener net.Listener
+	module   string
+	files    map[string]*testRsyncFile
+	// protocol in greeting
+	protocol int
+	// checksums to negotiate from protocol 30, empty is rsync daemon before 3.2 which does not negotiate
+	checksums string
+	// hang after module response
+	stall bool
+	// send wrong checksum
+	badChecksum bool
+}
+
+func newTestRsyncDaemon(t *testing.T, module string, files map[string]*testRsyncFile) *testRsyncDaemon {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &testRsyncDaemon{listener: listener, module: module, files: files,
+		protocol: 31, checksums: "xxh128 xxh3 xxh64 md5 md4 none"}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go d.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return d
+}
+
+func (d *testRsyncDaemon) url(path string) string {
+	return "rsync://" + d.listener.Addr().String() + "/" + path
+}
+
+// all data after seed is multiplexed
+type testMuxWriter struct {
+	w        *bufio.Writer
+	buf      bytes.Buffer
+	protocol int
+	ndxPrev  [2]int32
+}
+
+func (m *testMuxWriter) writeInt(i int32) {
+	binary.Write(&m.buf, binary.LittleEndian, i)
+}
+
+func (m *testMuxWriter) writeShortint(i uint16) {
+	binary.Write(&m.buf, binary.LittleEndian, i)
+}
+
+// longint before protocol 30
+func (m *testMuxWriter) writeVarlong30(i int64, minBytes int) {
+	if m.protocol < 30 {
+		m.writeInt(int32(i))
+		return
+	}
+	testWriteVarlong(&m.buf, i, minBytes)
+}
+
+func (m *testMuxWriter) writeNdx(ndx int32) {
+	if m.protocol < 30 {
+		m.writeInt(ndx)
+		return
+	}
+	if ndx == rsyncNdxDone {
+		m.buf.WriteByte(0)
+		return
+	}
+	prev := &m.ndxPrev[0]
+	if ndx < 0 {
+		m.buf.WriteByte(0xff)
+		ndx = -ndx
+		prev = &m.ndxPrev[1]
+	}
+	diff := ndx - *prev
+	*prev = ndx
+	switch {
+	case diff > 0 && diff < 0xfe:
+		m.buf.WriteByte(byte(diff))
+	case diff < 0 || diff > 0x7fff:
+		m.buf.Write([]byte{0xfe, byte(ndx>>24) | 0x80, byte(ndx), byte(ndx >> 8), byte(ndx >> 16)})
+	default:
+		m.buf.Write([]byte{0xfe, byte(diff >> 8), byte(diff)})
+	}
+}
+
+func (m *testMuxWriter) message(tag int, msg string) {
+	binary.Write(m.w, binary.LittleEndian, uint32(rsyncMplexBase+tag)<<24|uint32(len(msg)))
+	m.w.WriteString(msg)
+}
+
+func (m *testMuxWriter) flush() {
+	data := m.buf.Bytes()
+	for len(data) > 0 {
+		n := len(data)
+		if n > 1000 {
+			n = 1000
+		}
+		binary.Write(m.w, binary.LittleEndian, uint32(rsyncMplexBase)<<24|uint32(n))
+		m.w.Write(data[:n])
+		data = data[n:]
+	}
+	m.buf.Reset()
+	m.w.Flush()
+}
+
+// data from client, it is multiplexed after seed from protocol 30
+type testDemuxReader struct {
+	r         *bufio.Reader
+	multiplex bool
+	dataLeft  int
+	protocol  int
+	ndxPrev   [2]int32
+}
+
+func (m *testDemuxReader) Read(p []byte) (int, error) {
+	if !m.multiplex {
+		return m.r.Read(p)
+	}
+	for m.dataLeft == 0 {
+		var h uint32
+		if err := binary.Read(m.r, binary.LittleEndian, &h); err != nil {
+			return 0, err
+		}
+		if h>>24 != rsyncMplexBase {
+			return 0, errors.New("message of client is not data")
+		}
+		m.dataLeft = int(h & 0xffffff)
+	}
+	if len(p) > m.dataLeft {
+		p = p[:m.dataLeft]
+	}
+	n, err := m.r.Read(p)
+	m.dataLeft -= n
+	return n, err
+}
+
+func (m *testDemuxReader) readInt() int32 {
+	var i int32
+	if binary.Read(m, binary.LittleEndian, &i) != nil {
+		return -100
+	}
+	return i
+}
+
+func (m *testDemuxReader) readByte() int32 {
+	var b [1]byte
+	if _, err := io.ReadFull(m, b[:]); err != nil {
+		return -100
+	}
+	return int32(b[0])
+}
+
+func (m *testDemuxReader) readNdx() int32 {
+	if m.protocol < 30 {
+		return m.readInt()
+	}
+	b := m.readByte()
+	prev := &m.ndxPrev[0]
+	if b == 0xff {
+		b = m.readByte()
+		prev = &m.ndxPrev[1]
+	} else if b == 0 {
+		return rsyncNdxDone
+	}
+	if b < 0 {
+		return -100
+	}
+	num := b + *prev
+	if b == 0xfe {
+		b1, b2 := m.readByte(), m.readByte()
+		if b1&0x80 != 0 {
+			b3, b4 := m.readByte(), m.readByte()
+			num = (b1&^0x80)<<24 | b2 | b3<<8 | b4<<16
+		} else {
+			num = b1<<8 + b2 + *prev
+		}
+	}
+	*prev = num
+	if prev == &m.ndxPrev[1] {
+		num = -num
+	}
+	return num
+}
+
+// write_varint of rsync
+func testWriteVarint(buf *bytes.Buffer, x int32) {
+	var b [5]byte
+	binary.LittleEndian.PutUint32(b[1:], uint32(x))
+	cnt := 4
+	for cnt > 1 && b[cnt] == 0 {
+		cnt--
+	}
+	bit := byte(1) << (8 - cnt)
+	if b[cnt] >= bit {
+		cnt++
+		b[0] = ^(bit - 1)
+	} else if cnt > 1 {
+		b[0] = b[cnt] | ^(bit*2 - 1)
+	} else {
+		b[0] = b[cnt]
+	}
+	buf.Write(b[:cnt])
+}
+
+// write_varlong of rsync
+func testWriteVarlong(buf *bytes.Buffer, x int64, minBytes int) {
+	var b [9]byte
+	binary.LittleEndian.PutUint64(b[1:], uint64(x))
+	cnt := 8
+	for cnt > minBytes && b[cnt] == 0 {
+		cnt--
+	}
+	bit := byte(1) << (7 - cnt + minBytes)
+	if b[cnt] >= bit {
+		cnt++
+		b[0] = ^(bit - 1)
+	} else if cnt > minBytes {
+		b[0] = b[cnt] | ^(bit*2 - 1)
+	} else {
+		b[0] = b[cnt]
+	}
+	buf.Write(b[:cnt])
+}
+
+func testWriteVstring(w io.Writer, s string) {
+	if len(s) > 0x7f {
+		w.Write([]byte{byte(len(s)>>8) | 0x80})
+	}
+	w.Write([]byte{byte(len(s))})
+	io.WriteString(w, s)
+}
+
+func (d *testRsyncDaemon) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	if line, _ := r.ReadString('\n'); line != "@RSYNCD: 31.0\n" {
+		return
+	}
+	w.WriteString("@RSYNCD: " + strconv.Itoa(d.protocol) + ".0\n")
+	w.Flush()
+	protocol := d.protocol
+	if protocol > 31 {
+		protocol = 31
+	}
+	module, _ := r.ReadString('\n')
+	if strings.TrimSpace(module) != d.module {
+		w.WriteString("@ERROR: Unknown module '" + strings.TrimSpace(module) + "'\n")
+		w.Flush()
+		return
+	}
+	w.WriteString("welcome to test rsync daemon\n@RSYNCD: OK\n")
+	w.Flush()
+	if d.stall {
+		io.Copy(io.Discard, r)
+		return
+	}
+
+	// arguments end with '\n' before protocol 30, then with '\0'
+	delim := byte('\n')
+	if protocol >= 30 {
+		delim = 0
+	}
+	var serverPath, clientInfo string
+	for {
+		arg, err := r.ReadString(delim)
+		if err != nil {
+			return
+		}
+		arg = strings.TrimSuffix(arg, string(delim))
+		if len(arg) == 0 {
+			break
+		}
+		if i := strings.Index(arg, "e."); strings.HasPrefix(arg, "-") && i > 0 {
+			clientInfo = arg[i+2:]
+		}
+		serverPath = arg
+	}
+	prefix := strings.TrimPrefix(serverPath, d.module+"/")
+
+	// compat flags and negotiation of checksums from protocol 30
+	checksum := "md4"
+	var compatFlags int32
+	if protocol >= 30 {
+		checksum = "md5"
+		if strings.Contains(clientInfo, "f") {
+			compatFlags |= 0x08
+		}
+		if strings.Contains(clientInfo, "v") && len(d.checksums) > 0 {
+			compatFlags |= rsyncCfVarintFlistFlags
+		}
+		var flagsBuf bytes.Buffer
+		testWriteVarint(&flagsBuf, compatFlags)
+		w.Write(flagsBuf.Bytes())
+		if compatFlags&rsyncCfVarintFlistFlags != 0 {
+			testWriteVstring(w, d.checksums)
+			w.Flush()
+			length, _ := r.ReadByte()
+			clientChecksums := make([]byte, length)
+			io.ReadFull(r, clientChecksums)
+			checksum = ""
+			for _, name := range strings.Fields(string(clientChecksums)) {
+				if len(checksum) == 0 && strings.Contains(" "+d.checksums+" ", " "+name+" ") {
+					checksum = name
+				}
+			}
+			if len(checksum) == 0 {
+				w.WriteString("@ERROR: no checksum\n")
+				w.Flush()
+				return
+			}
+		}
+	}
+
+	seed := int32(0x12345678)
+	binary.Write(w, binary.LittleEndian, seed)
+	mux := &testMuxWriter{w: w, protocol: protocol, ndxPrev: [2]int32{-1, 1}}
+	mux.message(rsyncMsgInfo, "receiving file list")
+	mux.flush()
+	in := &testDemuxReader{r: r, multiplex: protocol >= 30, protocol: protocol, ndxPrev: [2]int32{-1, 1}}
+	if in.readInt() != 0 {
+		return
+	}
+
+	// file list of directory or one file, in reverse order so it is sorted by client
+	names := make([]string, 0)
+	if len(prefix) == 0 || strings.HasSuffix(prefix, "/") {
+		names = append(names, ".")
+		for name := range d.files {
+			if strings.HasPrefix(name, prefix) {
+				names = append(names, strings.TrimPrefix(name, prefix))
+			}
+		}
+	} else if _, ok := d.files[prefix]; ok {
+		names = append(names, filepath.Base(prefix))
+		prefix = filepath.Dir(prefix) + "/"
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	files := make([]*testRsyncFile, len(names))
+	lastName := ""
+	var lastTime int32
+	var lastMode int32
+	for i, name := range names {
+		files[i] = d.files[prefix+name]
+		if name == "." {
+			files[i] = &testRsyncFile{isDir: true, modTime: 1}
+		}
+		mode := int32(0100644)
+		if files[i].isDir {
+			mode = 040755
+		}
+		l1 := 0
+		for l1 < len(name) && l1 < len(lastName) && l1 < 255 && name[l1] == lastName[l1] {
+			l1++
+		}
+		flags := int32(rsyncXmitLongName)
+		if l1 > 0 {
+			flags |= rsyncXmitSameName
+		}
+		if files[i].modTime == lastTime {
+			flags |= rsyncXmitSameTime
+		}
+		if mode == lastMode {
+			flags |= rsyncXmitSameMode
+		}
+		// nanoseconds of files from protocol 31, they are in second byte of flags
+		if protocol >= 31 && !files[i].isDir {
+			flags |= rsyncXmitModNsec
+		}
+		if compatFlags&rsyncCfVarintFlistFlags != 0 {
+			testWriteVarint(&mux.buf, flags)
+		} else if protocol >= 28 && flags&0xff00 != 0 {
+			mux.writeShortint(uint16(flags | rsyncXmitExtendedFlags))
+		} else {
+			mux.buf.WriteByte(byte(flags))
+		}
+		if l1 > 0 {
+			mux.buf.WriteByte(byte(l1))
+		}
+		if protocol >= 30 {
+			testWriteVarint(&mux.buf, int32(len(name)-l1))
+		} else {
+			mux.writeInt(int32(len(name) - l1))
+		}
+		mux.buf.WriteString(name[l1:])
+		mux.writeVarlong30(int64(len(files[i].data)), 3)
+		if flags&rsyncXmitSameTime == 0 {
+			if protocol >= 30 {
+				testWriteVarlong(&mux.buf, int64(files[i].modTime), 4)
+			} else {
+				mux.writeInt(files[i].modTime)
+			}
+		}
+		if flags&rsyncXmitModNsec != 0 {
+			testWriteVarint(&mux.buf, 123456789)
+		}
+		if flags&rsyncXmitSameMode == 0 {
+			mux.writeInt(mode)
+		}
+		lastName, lastTime, lastMode = name, files[i].modTime, mode
+	}
+	// end of file list and io error: int after end before protocol 30, then in end of varint flags,
+	// or in extended flags of safe file list
+	switch {
+	case compatFlags&rsyncCfVarintFlistFlags != 0:
+		testWriteVarint(&mux.buf, 0)
+		testWriteVarint(&mux.buf, 0)
+	case compatFlags&0x08 != 0:
+		mux.writeShortint(rsyncXmitExtendedFlags | rsyncXmitIoErrorEndlist)
+		testWriteVarint(&mux.buf, 0)
+	default:
+		mux.buf.WriteByte(0)
+	}
+	if protocol < 30 {
+		mux.writeInt(0)
+	}
+	mux.flush()
+
+	// indexes are in file list sorted by rsync of the protocol
+	entries := make([]rsyncFileEntry, len(names))
+	for i, name := range names {
+		entries[i] = rsyncFileEntry{name: name, mode: 0100644}
+		if files[i].isDir {
+			entries[i].mode = 040755
+		}
+	}
+	sorted := make([]*testRsyncFile, len(names))
+	for i := range names {
+		j := 0
+		for k := range entries {
+			if compareRsyncFileName(protocol, &entries[k], &entries[i]) < 0 {
+				j++
+			}
+		}
+		sorted[j] = files[i]
+	}
+
+	maxPhase := 1
+	if protocol >= 29 {
+		maxPhase = 2
+	}
+	phase := 0
+	for {
+		index := in.readNdx()
+		if index == -100 {
+			return
+		}
+		if index == rsyncNdxDone {
+			phase++
+			if phase > maxPhase {
+				break
+			}
+			mux.writeNdx(rsyncNdxDone)
+			mux.flush()
+			continue
+		}
+		if protocol >= 29 && uint16(in.readByte()|in.readByte()<<8) != rsyncItemTransfer {
+			return
+		}
+		for j := 0; j < 4; j++ {
+			in.readInt()
+		}
+		mux.writeNdx(index)
+		if protocol >= 29 {
+			mux.writeShortint(rsyncItemTransfer)
+		}
+		for j := 0; j < 4; j++ {
+			mux.writeInt(0)
+		}
+		data := sorted[index].data
+		var sum []byte
+		switch checksum {
+		case "md5":
+			md5Sum := md5.Sum(data)
+			sum = md5Sum[:]
+		default:
+			md := newMd4()
+			if protocol < 30 {
+				binary.Write(md, binary.LittleEndian, seed)
+			}
+			md.Write(data)
+			sum = md.Sum()
+		}
+		for len(data) > 0 {
+			n := len(data)
+			if n > 3 {
+				n = 3
+			}
+			mux.writeInt(int32(n))
+			mux.buf.Write(data[:n])
+			data = data[n:]
+		}
+		mux.writeInt(0)
+		if d.badChecksum {
+			sum[0]++
+		}
+		mux.buf.Write(sum)
+		mux.flush()
+	}
+	// statistics, and build time and transfer time of file list from protocol 29
+	mux.writeNdx(rsyncNdxDone)
+	statCount := 3
+	if protocol >= 29 {
+		statCount = 5
+	}
+	for j := 0; j < statCount; j++ {
+		mux.writeVarlong30(100, 3)
+	}
+	mux.flush()
+	if in.readNdx() == rsyncNdxDone && protocol >= 31 {
+		mux.writeNdx(rsyncNdxDone)
+		mux.flush()
+	}
+}
+
+func TestMd4(t *testing.T) {
+	md := newMd4()
+	md.Write([]byte("abc"))
+	if hex.EncodeToString(md.Sum()) != "a448017aaf21d8525fc10ae87aa6729d" {
+		t.Fatal("md4 of abc is wrong")
+	}
+}
+
+func TestRsync(t *testing.T) {
+	files := map[string]*testRsyncFile{
+		"repo/":             {isDir: true, modTime: 1600000000},
+		"repo/ca.cer":       {data: []byte("certificate"), modTime: 1600000001},
+		"repo/ca.mft":       {data: []byte("manifest"), modTime: 1600000001},
+		"repo/sub/":         {isDir: true, modTime: 1600000000},
+		"repo/sub/a.roa":    {data: []byte("roa"), modTime: 1600000002},
+		"repo/sub/b.roa":    {data: []byte("another roa"), modTime: 1600000003},
+		"repo/sub-1.crl":    {data: []byte("crl"), modTime: 1600000004},
+		"other/ignored.cer": {data: []byte("ignored"), modTime: 1600000004},
+	}
+	// names of directories in file list have no '/'
+	for name, file := range files {
+		if file.isDir {
+			delete(files, name)
+			files[strings.TrimSuffix(name, "/")] = file
+		}
+	}
+	d := newTestRsyncDaemon(t, "module", files)
+	destPath := t.TempDir()
+	rsyncClient := NewRsyncClient(10*time.Second, 0, 0)
+
+	rsyncResult, err := rsyncClient.Rsync(d.url("module/repo/"), destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, _, _ := net.SplitHostPort(d.listener.Addr().String())
+	localDir := filepath.Join(destPath, host, "module", "repo") + string(os.PathSeparator)
+	if rsyncResult.RsyncDestPath != localDir || rsyncResult.FileCount != 5 || rsyncResult.DownloadCount != 5 {
+		t.Fatal("rsyncResult is wrong:", rsyncResult)
+	}
+	data, err := os.ReadFile(filepath.Join(localDir, "sub", "b.roa"))
+	if err != nil || string(data) != "another roa" {
+		t.Fatal("sub/b.roa is wrong:", string(data), err)
+	}
+	fileInfo, err := os.Stat(filepath.Join(localDir, "ca.cer"))
+	if err != nil || fileInfo.ModTime().Unix() != 1600000001 {
+		t.Fatal("modTime of ca.cer is wrong:", fileInfo, err)
+	}
+
+	// unchanged files are not downloaded, and local files not on server are deleted
+	os.WriteFile(filepath.Join(localDir, "sub", "old.roa"), []byte("old"), 0644)
+	os.MkdirAll(filepath.Join(localDir, "olddir"), 0755)
+	os.WriteFile(filepath.Join(localDir, "olddir", "old.cer"), []byte("old"), 0644)
+	files["repo/ca.mft"] = &testRsyncFile{data: []byte("new manifest"), modTime: 1600000009}
+	rsyncResult, err = rsyncClient.Rsync(d.url("module/repo/"), destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rsyncResult.DownloadCount != 1 || rsyncResult.DeleteCount != 2 {
+		t.Fatal("rsyncResult of second rsync is wrong:", rsyncResult)
+	}
+	if _, err = os.Stat(filepath.Join(localDir, "olddir")); !os.IsNotExist(err) {
+		t.Fatal("olddir should be deleted:", err)
+	}
+
+	// one file
+	rsyncResult, err = rsyncClient.Rsync(d.url("module/repo/sub/a.roa"), t.TempDir())
+	if err != nil || rsyncResult.DownloadCount != 1 || !strings.HasSuffix(rsyncResult.RsyncDestPath,
+		filepath.Join("module", "repo", "sub")+string(os.PathSeparator)) {
+		t.Fatal("rsync one file is wrong:", rsyncResult, err)
+	}
+
+	// options of one call
+	rsyncResult, err = NewRsyncClientByOptions(RsyncOptions{Timeout: 10 * time.Second, ConTimeout: time.Second,
+		BandwidthKBps: 1024}).Rsync(d.url("module/repo/"), t.TempDir())
+	if err != nil || rsyncResult.DownloadCount != 5 {
+		t.Fatal("rsync by options is wrong:", rsyncResult, err)
+	}
+
+	// from protocol 29, files are before directories
+	rsyncFiles, err := rsyncClient.List(d.url("module/repo/"))
+	if err != nil || len(rsyncFiles) != 7 || rsyncFiles[0].Name != "." || !rsyncFiles[0].IsDir ||
+		rsyncFiles[3].Name != "sub-1.crl" || rsyncFiles[4].Name != "sub" {
+		t.Fatal("list is wrong:", rsyncFiles, err)
+	}
+}
+
+func TestRsyncProtocols(t *testing.T) {
+	files := map[string]*testRsyncFile{
+		"repo":           {isDir: true, modTime: 1600000000},
+		"repo/ca.cer":    {data: []byte("certificate"), modTime: 1600000001},
+		"repo/sub":       {isDir: true, modTime: 1600000000},
+		"repo/sub/a.roa": {data: bytes.Repeat([]byte("roa"), 100), modTime: 1600000002},
+		"repo/sub-1.crl": {data: []byte("crl"), modTime: 1600000004},
+	}
+	tests := []struct {
+		protocol  int
+		checksums string
+		// names of list, sorted by rsync of the protocol
+		names string
+	}{
+		{protocol: 27, names: ". ca.cer sub sub-1.crl sub/a.roa"},
+		{protocol: 28, names: ". ca.cer sub sub-1.crl sub/a.roa"},
+		{protocol: 29, names: ". ca.cer sub-1.crl sub sub/a.roa"},
+		// md5 without negotiation, and safe file list
+		{protocol: 30, names: ". ca.cer sub-1.crl sub sub/a.roa"},
+		// rsync 3.1 does not negotiate
+		{protocol: 31, names: ". ca.cer sub-1.crl sub sub/a.roa"},
+		// rsync 3.2 negotiates checksums and varint flags
+		{protocol: 31, checksums: "xxh128 xxh3 xxh64 md5 md4 none", names: ". ca.cer sub-1.crl sub sub/a.roa"},
+		{protocol: 31, checksums: "xxh64 md4", names: ". ca.cer sub-1.crl sub sub/a.roa"},
+		// rsync daemon of higher protocol uses protocol of client
+		{protocol: 32, checksums: "md5", names: ". ca.cer sub-1.crl sub sub/a.roa"},
+	}
+	for _, test := range tests {
+		d := newTestRsyncDaemon(t, "module", files)
+		d.protocol = test.protocol
+		d.checksums = test.checksums
+		rsyncClient := NewRsyncClient(10*time.Second, 0, 0)
+
+		destPath := t.TempDir()
+		rsyncResult, err := rsyncClient.Rsync(d.url("module/repo/"), destPath)
+		if err != nil || rsyncResult.DownloadCount != 3 {
+			t.Fatal("rsync is wrong:", test.protocol, test.checksums, rsyncResult, err)
+		}
+		data, err := os.ReadFile(filepath.Join(rsyncResult.RsyncDestPath, "sub", "a.roa"))
+		if err != nil || !bytes.Equal(data, files["repo/sub/a.roa"].data) {
+			t.Fatal("sub/a.roa is wrong:", test.protocol, test.checksums, err)
+		}
+		fileInfo, err := os.Stat(filepath.Join(rsyncResult.RsyncDestPath, "sub-1.crl"))
+		if err != nil || fileInfo.ModTime().Unix() != 1600000004 {
+			t.Fatal("modTime of sub-1.crl is wrong:", test.protocol, test.checksums, fileInfo, err)
+		}
+		rsyncResult, err = rsyncClient.Rsync(d.url("module/repo/"), destPath)
+		if err != nil || rsyncResult.DownloadCount != 0 {
+			t.Fatal("second rsync is wrong:", test.protocol, test.checksums, rsyncResult, err)
+		}
+
+		rsyncFiles, err := rsyncClient.List(d.url("module/repo/"))
+		names := make([]string, 0, len(rsyncFiles))
+		for i := range rsyncFiles {
+			names = append(names, rsyncFiles[i].Name)
+		}
+		if err != nil || strings.Join(names, " ") != test.names {
+			t.Fatal("list is wrong:", test.protocol, test.checksums, names, err)
+		}
+	}
+}
+
+func TestCompareRsyncFileName(t *testing.T) {
+	entries := make([]rsyncFileEntry, 0)
+	for _, name := range []string{"b", "a/y/z", "a-b", "a/y0", ".", "a/x", "a.b", "a/y", "a"} {
+		entry := rsyncFileEntry{name: name, mode: 0100644}
+		if name == "." || name == "a" || name == "a/y" {
+			entry.mode = 040755
+		}
+		entries = append(entries, entry)
+	}
+	for protocol, want := range map[int]string{
+		27: ". a a-b a.b a/x a/y a/y/z a/y0 b",
+		29: ". a-b a.b b a a/x a/y0 a/y a/y/z",
+	} {
+		sort.SliceStable(entries, func(i, j int) bool {
+			return compareRsyncFileName(protocol, &entries[i], &entries[j]) < 0
+		})
+		names := make([]string, 0, len(entries))
+		for i := range entries {
+			names = append(names, entries[i].name)
+		}
+		if strings.Join(names, " ") != want {
+			t.Fatal("sorted names are wrong:", protocol, names)
+		}
+	}
+}
+
+func TestRsyncConnEncoding(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	reader, writer := newRsyncConn(client), newRsyncConn(server)
+	reader.protocol, writer.protocol = 30, 30
+	ndxs := []int32{0, 1, 5, 300, 2, 70000, 70001, rsyncNdxDone, -2, -101, -3, 1 << 30}
+	varints := []int32{0, 1, 0x7f, 0x80, 0x3fff, 0x4000, 1 << 24, -1}
+	varlongs := []int64{0, 1, 1600000000, 1 << 40, -1}
+	go func() {
+		for _, ndx := range ndxs {
+			writer.writeNdx(ndx)
+		}
+		var buf bytes.Buffer
+		for _, i := range varints {
+			testWriteVarint(&buf, i)
+		}
+		for _, i := range varlongs {
+			testWriteVarlong(&buf, i, 3)
+			testWriteVarlong(&buf, i, 4)
+		}
+		writer.writer.Write(buf.Bytes())
+		writer.flush()
+	}()
+	for _, want := range ndxs {
+		if ndx, err := reader.readNdx(); err != nil || ndx != want {
+			t.Fatal("ndx is wrong:", want, ndx, err)
+		}
+	}
+	for _, want := range varints {
+		if i, err := reader.readVarint(); err != nil || i != want {
+			t.Fatal("varint is wrong:", want, i, err)
+		}
+	}
+	for _, want := range varlongs {
+		for _, minBytes := range []int{3, 4} {
+			if i, err := reader.readVarlong(minBytes); err != nil || i != want {
+				t.Fatal("varlong is wrong:", want, minBytes, i, err)
+			}
+		}
+	}
+}
+
+func TestRsyncFail(t *testing.T) {
+	files := map[string]*testRsyncFile{
+		"repo":        {isDir: true, modTime: 1600000000},
+		"repo/ca.cer": {data: []byte("certificate"), modTime: 1600000001},
+	}
+	d := newTestRsyncDaemon(t, "module", files)
+
+	_, err := NewRsyncClient(10*time.Second, 0, 0).Rsync(d.url("nomodule/repo/"), t.TempDir())
+	if !errors.Is(err, ErrRsyncModule) {
+		t.Fatal("should be ErrRsyncModule:", err)
+	}
+	_, err = NewRsyncClient(10*time.Second, 4, 0).Rsync(d.url("module/repo/"), t.TempDir())
+	if !errors.Is(err, ErrRsyncSizeLimit) {
+		t.Fatal("should be ErrRsyncSizeLimit:", err)
+	}
+	_, err = NewRsyncClient(10*time.Second, 0, 0).Rsync("rsync://127.0.0.1:1/module/", t.TempDir())
+	if !errors.Is(err, ErrRsyncConnect) {
+		t.Fatal("should be ErrRsyncConnect:", err)
+	}
+
+	d.badChecksum = true
+	destPath := t.TempDir()
+	_, err = NewRsyncClient(10*time.Second, 0, 0).Rsync(d.url("module/repo/"), destPath)
+	if !errors.Is(err, ErrRsyncChecksum) {
+		t.Fatal("should be ErrRsyncChecksum:", err)
+	}
+	d.badChecksum = false
+
+	// protocol before 27, and no checksum to negotiate
+	d.protocol = 26
+	_, err = NewRsyncClient(10*time.Second, 0, 0).List(d.url("module/repo/"))
+	if !errors.Is(err, ErrRsyncProtocol) {
+		t.Fatal("should be ErrRsyncProtocol of protocol:", err)
+	}
+	d.protocol, d.checksums = 31, "xxh128 xxh3"
+	_, err = NewRsyncClient(10*time.Second, 0, 0).List(d.url("module/repo/"))
+	if !errors.Is(err, ErrRsyncProtocol) {
+		t.Fatal("should be ErrRsyncProtocol of checksum:", err)
+	}
+	d.checksums = "md5"
+
+	d.stall = true
+	start := time.Now()
+	_, err = NewRsyncClient(200*time.Millisecond, 0, 0).List(d.url("module/repo/"))
+	if !errors.Is(err, ErrRsyncTimeout) || time.Since(start) > 5*time.Second {
+		t.Fatal("should be ErrRsyncTimeout:", err)
+	}
+}
+
+func TestGetRsyncReceivedBytes(t *testing.T) {
+	output := `
+Number of files: 12 (reg: 10, dir: 2)
+Total file size: 45,678 bytes
+Total bytes sent: 123
+Total bytes received: 12,345
+
+sent 123 bytes  received 12,345 bytes  24,936.00 bytes/sec`
+	if got := getRsyncReceivedBytes(output); got != 12345 {
+		t.Fatal("should be 12345:", got)
+	}
+	if got := getRsyncReceivedBytes("Total bytes received: 678\n"); got != 678 {
+		t.Fatal("should be 678:", got)
+	}
+	if got := getRsyncReceivedBytes("rsync: failed"); got != 0 {
+		t.Fatal("should be 0:", got)
+	}
+}
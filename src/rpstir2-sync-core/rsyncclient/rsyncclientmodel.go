@@ -0,0 +1,60 @@
+package rsyncclient
+
+import (
+	"errors"
+	"time"
+)
+
+// errors of rsync client, the returned error wraps one of them, so can be checked by errors.Is()
+var (
+	// cannot connect to rsync daemon
+	ErrRsyncConnect = errors.New("rsync connect fail")
+	// rsync daemon refuses the module, such as "@ERROR: Unknown module"
+	ErrRsyncModule = errors.New("rsync module fail")
+	// call is not end in timeout
+	ErrRsyncTimeout = errors.New("rsync timeout")
+	// unexpected data from rsync daemon, or error message from it
+	ErrRsyncProtocol = errors.New("rsync protocol fail")
+	// file or all files are larger than limit
+	ErrRsyncSizeLimit = errors.New("rsync size is more than limit")
+	// md4 of received file is not equal to the one from rsync daemon
+	ErrRsyncChecksum = errors.New("rsync checksum fail")
+	// file name from rsync daemon is not safe, or cannot save file to local
+	ErrRsyncFile = errors.New("rsync file fail")
+)
+
+// file in file list of rsync daemon, name is relative to the rsync url
+type RsyncFile struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	Mode    uint32    `json:"mode"`
+	IsDir   bool      `json:"isDir"`
+}
+
+// result of one call of Rsync
+type RsyncResult struct {
+	// local directory of rsync url, ends with '/'
+	RsyncDestPath string `json:"rsyncDestPath"`
+	// count of files in file list, not include directories
+	FileCount uint64 `json:"fileCount"`
+	// downloaded files, unchanged files (same size and modTime) are not downloaded
+	DownloadCount uint64 `json:"downloadCount"`
+	DownloadBytes uint64 `json:"downloadBytes"`
+	// local files which are not in file list
+	DeleteCount uint64 `json:"deleteCount"`
+}
+
+// options of one rsync call, 0 is no limit
+type RsyncOptions struct {
+	// timeout of the whole call
+	Timeout time.Duration `json:"timeout"`
+	// timeout of connecting to rsync daemon, 0 is same to Timeout
+	ConTimeout time.Duration `json:"conTimeout"`
+	// max KBytes per second
+	BandwidthKBps uint64 `json:"bandwidthKBps"`
+	// max bytes of one file
+	MaxFileBytes uint64 `json:"maxFileBytes"`
+	// max bytes of all downloaded files, it is only used by native client
+	MaxTotalBytes uint64 `json:"maxTotalBytes"`
+}
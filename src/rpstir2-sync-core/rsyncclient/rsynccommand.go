@@ -0,0 +1,111 @@
+package rsyncclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cpusoft/goutil/belogs"
+)
+
+// exit codes of rsync command
+const (
+	rsyncExitSocketIo   = 10
+	rsyncExitTimeout    = 30
+	rsyncExitConTimeout = 35
+)
+
+// rsync by rsync command to the same local directory as native client. all options are arguments of this call,
+// so concurrent calls have their own options. MaxTotalBytes is not supported by rsync command.
+// DownloadBytes is "Total bytes received" of --stats
+func rsyncCommand(rsyncUrl string, destPath string, rsyncOptions RsyncOptions) (rsyncResult RsyncResult, err error) {
+	start := time.Now()
+	rsyncUrlModel, err := parseRsyncUrl(rsyncUrl)
+	if err != nil {
+		belogs.Error("rsyncCommand(): parseRsyncUrl fail:", rsyncUrl, err)
+		return rsyncResult, err
+	}
+	localDir := getLocalDir(rsyncUrlModel, destPath)
+	if err = os.MkdirAll(localDir, os.ModePerm); err != nil {
+		belogs.Error("rsyncCommand(): MkdirAll fail:", localDir, err)
+		return rsyncResult, fmt.Errorf("%w: %v", ErrRsyncFile, err)
+	}
+	rsyncDestPath := localDir + string(os.PathSeparator)
+
+	args := []string{"-rtz", "--delete", "--no-motd", "--stats"}
+	if rsyncOptions.Timeout > 0 {
+		args = append(args, "--timeout="+strconv.Itoa(getSeconds(rsyncOptions.Timeout)))
+	}
+	if rsyncOptions.ConTimeout > 0 {
+		args = append(args, "--contimeout="+strconv.Itoa(getSeconds(rsyncOptions.ConTimeout)))
+	}
+	if rsyncOptions.BandwidthKBps > 0 {
+		args = append(args, "--bwlimit="+strconv.FormatUint(rsyncOptions.BandwidthKBps, 10))
+	}
+	if rsyncOptions.MaxFileBytes > 0 {
+		args = append(args, "--max-size="+strconv.FormatUint(rsyncOptions.MaxFileBytes, 10))
+	}
+	args = append(args, rsyncUrl, rsyncDestPath)
+
+	ctx := context.Background()
+	if rsyncOptions.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, rsyncOptions.Timeout)
+		defer cancel()
+	}
+	belogs.Debug("rsyncCommand(): rsync", strings.Join(args, " "))
+	output, err := exec.CommandContext(ctx, "rsync", args...).CombinedOutput()
+	if err != nil {
+		msg := strings.TrimSpace(string(output))
+		belogs.Error("rsyncCommand(): rsync fail:", rsyncUrl, "  args:", args, "  output:", msg, err)
+		var exitErr *exec.ExitError
+		if ctx.Err() == context.DeadlineExceeded {
+			return rsyncResult, fmt.Errorf("%w: %s is not end in %v", ErrRsyncTimeout, rsyncUrl, rsyncOptions.Timeout)
+		} else if errors.As(err, &exitErr) {
+			switch exitErr.ExitCode() {
+			case rsyncExitTimeout:
+				return rsyncResult, fmt.Errorf("%w: %s: %s", ErrRsyncTimeout, rsyncUrl, msg)
+			case rsyncExitSocketIo, rsyncExitConTimeout:
+				return rsyncResult, fmt.Errorf("%w: %s: %s", ErrRsyncConnect, rsyncUrl, msg)
+			}
+		}
+		return rsyncResult, fmt.Errorf("%w: %s: %v: %s", ErrRsyncProtocol, rsyncUrl, err, msg)
+	}
+	rsyncResult.RsyncDestPath = rsyncDestPath
+	rsyncResult.DownloadBytes = getRsyncReceivedBytes(string(output))
+	belogs.Info("rsyncCommand(): rsyncUrl:", rsyncUrl, "  rsyncDestPath:", rsyncDestPath,
+		"  downloadBytes:", rsyncResult.DownloadBytes, "  time(s):", time.Since(start))
+	return rsyncResult, nil
+}
+
+// "Total bytes received: 1,234" in output of --stats, 0 when not found
+func getRsyncReceivedBytes(output string) uint64 {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "Total bytes received:") {
+			continue
+		}
+		value := strings.ReplaceAll(strings.TrimSpace(strings.TrimPrefix(line, "Total bytes received:")), ",", "")
+		receivedBytes, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			belogs.Error("getRsyncReceivedBytes(): ParseUint fail, line:", line, err)
+			return 0
+		}
+		return receivedBytes
+	}
+	return 0
+}
+
+// at least 1 second
+func getSeconds(d time.Duration) int {
+	seconds := int(d / time.Second)
+	if seconds < 1 {
+		return 1
+	}
+	return seconds
+}
@@ -0,0 +1,455 @@
+package rsyncclient
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/cpusoft/goutil/belogs"
+)
+
+const (
+	// tag of multiplexed message is rsyncMplexBase + rsyncMsg*
+	rsyncMplexBase    = 7
+	rsyncMsgData      = 0
+	rsyncMsgErrorXfer = 1
+	rsyncMsgInfo      = 2
+	rsyncMsgError     = 3
+	rsyncMsgWarning   = 4
+	rsyncMsgIoError   = 22
+	rsyncMsgNoSend    = 102
+
+	// max length of line of daemon greeting and motd
+	rsyncMaxLine = 4096
+
+	// index of end of phase, as -1 before protocol 30
+	rsyncNdxDone = -1
+)
+
+// extra bytes of varint and varlong, by first byte/4
+var rsyncIntByteExtra = [64]int{
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+	2, 2, 2, 2, 2, 2, 2, 2, 3, 3, 3, 3, 4, 4, 5, 6,
+}
+
+// connection to rsync daemon. all ints are little endian, and all data from server is multiplexed
+// after checksum seed. from protocol 30, data to server is multiplexed too, and varints are used
+type rsyncConn struct {
+	conn      net.Conn
+	reader    *bufio.Reader
+	writer    *bufio.Writer
+	muxWriter *rsyncMuxWriter
+
+	multiplex bool
+	dataLeft  int
+	// last error message from rsync daemon, it is added to error when connection fails
+	lastError string
+	// io error and indexes of files not sent, by messages of rsync daemon
+	ioError int32
+	noSends []int32
+
+	// negotiated protocol, compat flags(from protocol 30) and checksum of files
+	protocol    int
+	compatFlags int32
+	checksum    string
+	// last positive and negative index of readNdx and writeNdx, from protocol 30
+	readNdxPrev  [2]int32
+	writeNdxPrev [2]int32
+}
+
+func newRsyncConn(conn net.Conn) *rsyncConn {
+	muxWriter := &rsyncMuxWriter{w: conn}
+	return &rsyncConn{
+		conn:         conn,
+		reader:       bufio.NewReaderSize(conn, 64*1024),
+		writer:       bufio.NewWriterSize(muxWriter, 64*1024),
+		muxWriter:    muxWriter,
+		readNdxPrev:  [2]int32{-1, 1},
+		writeNdxPrev: [2]int32{-1, 1},
+	}
+}
+
+// data to rsync daemon is multiplexed as rsyncMsgData when multiplex is true
+type rsyncMuxWriter struct {
+	w         io.Writer
+	multiplex bool
+}
+
+func (m *rsyncMuxWriter) Write(p []byte) (n int, err error) {
+	if !m.multiplex {
+		return m.w.Write(p)
+	}
+	for len(p) > 0 {
+		length := len(p)
+		if length > 0xffffff {
+			length = 0xffffff
+		}
+		buf := make([]byte, 4, 4+length)
+		binary.LittleEndian.PutUint32(buf, uint32(rsyncMplexBase+rsyncMsgData)<<24|uint32(length))
+		if _, err = m.w.Write(append(buf, p[:length]...)); err != nil {
+			return n, err
+		}
+		n += length
+		p = p[length:]
+	}
+	return n, nil
+}
+
+// limits receiving to bandwidthKBps, by sleeping after read
+type bwlimitConn struct {
+	net.Conn
+	bytesPerSecond float64
+	start          time.Time
+	readBytes      uint64
+}
+
+func newBwlimitConn(conn net.Conn, bandwidthKBps uint64) *bwlimitConn {
+	return &bwlimitConn{
+		Conn:           conn,
+		bytesPerSecond: float64(bandwidthKBps) * 1024,
+		start:          time.Now(),
+	}
+}
+
+func (c *bwlimitConn) Read(p []byte) (n int, err error) {
+	n, err = c.Conn.Read(p)
+	c.readBytes += uint64(n)
+	expected := time.Duration(float64(c.readBytes) / c.bytesPerSecond * float64(time.Second))
+	if wait := expected - time.Since(c.start); wait > 0 {
+		time.Sleep(wait)
+	}
+	return n, err
+}
+
+func (c *rsyncConn) close() {
+	c.conn.Close()
+}
+
+// data of multiplexed stream, messages are logged
+func (c *rsyncConn) Read(p []byte) (n int, err error) {
+	if !c.multiplex {
+		return c.reader.Read(p)
+	}
+	for c.dataLeft == 0 {
+		var header [4]byte
+		if _, err = io.ReadFull(c.reader, header[:]); err != nil {
+			return 0, err
+		}
+		h := binary.LittleEndian.Uint32(header[:])
+		tag := int(h>>24) - rsyncMplexBase
+		length := int(h & 0xffffff)
+		if tag < 0 {
+			return 0, errors.New("tag of multiplexed message is wrong: " + fmt.Sprint(h>>24))
+		}
+		if tag == rsyncMsgData {
+			c.dataLeft = length
+			continue
+		}
+		msg := make([]byte, length)
+		if _, err = io.ReadFull(c.reader, msg); err != nil {
+			return 0, err
+		}
+		c.message(tag, msg)
+	}
+	if len(p) > c.dataLeft {
+		p = p[:c.dataLeft]
+	}
+	n, err = c.reader.Read(p)
+	c.dataLeft -= n
+	return n, err
+}
+
+func (c *rsyncConn) message(tag int, msg []byte) {
+	switch tag {
+	case rsyncMsgErrorXfer, rsyncMsgError:
+		belogs.Error("message(): error from rsync daemon:", c.conn.RemoteAddr(), strings.TrimSpace(string(msg)))
+		c.lastError = strings.TrimSpace(string(msg))
+	case rsyncMsgInfo, rsyncMsgWarning:
+		belogs.Debug("message(): message from rsync daemon:", c.conn.RemoteAddr(), tag, strings.TrimSpace(string(msg)))
+	case rsyncMsgIoError:
+		// io error of file list from protocol 30, instead of int after file list
+		if len(msg) == 4 {
+			c.ioError |= int32(binary.LittleEndian.Uint32(msg))
+		}
+		belogs.Debug("message(): io error from rsync daemon:", c.conn.RemoteAddr(), c.ioError)
+	case rsyncMsgNoSend:
+		// requested file cannot be sent by rsync daemon, from protocol 30
+		if len(msg) == 4 {
+			c.noSends = append(c.noSends, int32(binary.LittleEndian.Uint32(msg)))
+		}
+		belogs.Debug("message(): file is not sent by rsync daemon:", c.conn.RemoteAddr(), c.noSends)
+	default:
+		// other messages (such as noop and io timeout) are ignored
+		belogs.Debug("message(): ignore message from rsync daemon:", c.conn.RemoteAddr(), tag, len(msg))
+	}
+}
+
+func (c *rsyncConn) readFull(n int) ([]byte, error) {
+	buf := make([]byte, n)
+	_, err := io.ReadFull(c, buf)
+	return buf, err
+}
+
+func (c *rsyncConn) readByte() (byte, error) {
+	var buf [1]byte
+	_, err := io.ReadFull(c, buf[:])
+	return buf[0], err
+}
+
+func (c *rsyncConn) readInt() (int32, error) {
+	var buf [4]byte
+	if _, err := io.ReadFull(c, buf[:]); err != nil {
+		return 0, err
+	}
+	return int32(binary.LittleEndian.Uint32(buf[:])), nil
+}
+
+// int32, or -1 followed by int64
+func (c *rsyncConn) readLongint() (int64, error) {
+	i, err := c.readInt()
+	if err != nil || i != -1 {
+		return int64(i), err
+	}
+	var buf [8]byte
+	if _, err = io.ReadFull(c, buf[:]); err != nil {
+		return 0, err
+	}
+	return int64(binary.LittleEndian.Uint64(buf[:])), nil
+}
+
+// 1-5 bytes, count of extra bytes is in high bits of first byte. from protocol 30
+func (c *rsyncConn) readVarint() (int32, error) {
+	first, err := c.readByte()
+	if err != nil {
+		return 0, err
+	}
+	var buf [5]byte
+	extra := rsyncIntByteExtra[first/4]
+	if extra == 0 {
+		buf[0] = first
+	} else {
+		if extra > 4 {
+			return 0, errors.New("varint from rsync daemon is overflow")
+		}
+		if _, err = io.ReadFull(c, buf[:extra]); err != nil {
+			return 0, err
+		}
+		buf[extra] = first & (1<<(8-extra) - 1)
+	}
+	return int32(binary.LittleEndian.Uint32(buf[:4])), nil
+}
+
+// at least minBytes bytes, count of extra bytes is in high bits of first byte. from protocol 30
+func (c *rsyncConn) readVarlong(minBytes int) (int64, error) {
+	head := make([]byte, minBytes)
+	if _, err := io.ReadFull(c, head); err != nil {
+		return 0, err
+	}
+	var buf [9]byte
+	copy(buf[:], head[1:])
+	extra := rsyncIntByteExtra[head[0]/4]
+	if extra == 0 {
+		buf[minBytes-1] = head[0]
+	} else {
+		if minBytes+extra > len(buf) {
+			return 0, errors.New("varlong from rsync daemon is overflow")
+		}
+		if _, err := io.ReadFull(c, buf[minBytes-1:minBytes-1+extra]); err != nil {
+			return 0, err
+		}
+		buf[minBytes+extra-1] = head[0] & (1<<(8-extra) - 1)
+	}
+	return int64(binary.LittleEndian.Uint64(buf[:8])), nil
+}
+
+// int before protocol 30, then varint
+func (c *rsyncConn) readVarint30() (int32, error) {
+	if c.protocol < 30 {
+		return c.readInt()
+	}
+	return c.readVarint()
+}
+
+// longint before protocol 30, then varlong
+func (c *rsyncConn) readVarlong30(minBytes int) (int64, error) {
+	if c.protocol < 30 {
+		return c.readLongint()
+	}
+	return c.readVarlong(minBytes)
+}
+
+func (c *rsyncConn) readShortint() (uint16, error) {
+	var buf [2]byte
+	if _, err := io.ReadFull(c, buf[:]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint16(buf[:]), nil
+}
+
+// length is 1 byte, or 2 bytes when high bit of first byte is set
+func (c *rsyncConn) readVstring() (string, error) {
+	b, err := c.readByte()
+	if err != nil {
+		return "", err
+	}
+	length := int(b)
+	if b&0x80 != 0 {
+		if b, err = c.readByte(); err != nil {
+			return "", err
+		}
+		length = int(length&0x7f)<<8 + int(b)
+	}
+	buf, err := c.readFull(length)
+	return string(buf), err
+}
+
+// index of file: int before protocol 30. then done is 0, others are diff of last positive (or negative
+// after 0xff) index in 1 byte, or 0xfe and 2 bytes of diff, or 0xfe and 4 bytes of index with high bit set
+func (c *rsyncConn) readNdx() (int32, error) {
+	if c.protocol < 30 {
+		return c.readInt()
+	}
+	b, err := c.readByte()
+	if err != nil {
+		return 0, err
+	}
+	prev := &c.readNdxPrev[0]
+	if b == 0xff {
+		if b, err = c.readByte(); err != nil {
+			return 0, err
+		}
+		prev = &c.readNdxPrev[1]
+	} else if b == 0 {
+		return rsyncNdxDone, nil
+	}
+	var num int32
+	if b == 0xfe {
+		buf, err := c.readFull(2)
+		if err != nil {
+			return 0, err
+		}
+		if buf[0]&0x80 != 0 {
+			rest, err := c.readFull(2)
+			if err != nil {
+				return 0, err
+			}
+			num = int32(binary.LittleEndian.Uint32([]byte{buf[1], rest[0], rest[1], buf[0] &^ 0x80}))
+		} else {
+			num = int32(buf[0])<<8 + int32(buf[1]) + *prev
+		}
+	} else {
+		num = int32(b) + *prev
+	}
+	*prev = num
+	if prev == &c.readNdxPrev[1] {
+		num = -num
+	}
+	return num, nil
+}
+
+// line before multiplexed stream, without '\n'
+func (c *rsyncConn) readLine() (string, error) {
+	var sb strings.Builder
+	for sb.Len() < rsyncMaxLine {
+		b, err := c.reader.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if b == '\n' {
+			return strings.TrimSuffix(sb.String(), "\r"), nil
+		}
+		sb.WriteByte(b)
+	}
+	return "", errors.New("line from rsync daemon is too long")
+}
+
+func (c *rsyncConn) writeInt(i int32) error {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], uint32(i))
+	_, err := c.writer.Write(buf[:])
+	return err
+}
+
+func (c *rsyncConn) writeShortint(i uint16) error {
+	var buf [2]byte
+	binary.LittleEndian.PutUint16(buf[:], i)
+	_, err := c.writer.Write(buf[:])
+	return err
+}
+
+func (c *rsyncConn) writeVstring(s string) error {
+	if len(s) > 0x7fff {
+		return errors.New("vstring is too long")
+	}
+	if len(s) > 0x7f {
+		c.writer.WriteByte(byte(len(s)>>8) | 0x80)
+	}
+	c.writer.WriteByte(byte(len(s)))
+	_, err := c.writer.WriteString(s)
+	return err
+}
+
+// same encoding as readNdx
+func (c *rsyncConn) writeNdx(ndx int32) error {
+	if c.protocol < 30 {
+		return c.writeInt(ndx)
+	}
+	if ndx == rsyncNdxDone {
+		return c.writer.WriteByte(0)
+	}
+	buf := make([]byte, 0, 6)
+	prev := &c.writeNdxPrev[0]
+	if ndx < 0 {
+		buf = append(buf, 0xff)
+		ndx = -ndx
+		prev = &c.writeNdxPrev[1]
+	}
+	diff := ndx - *prev
+	*prev = ndx
+	if diff > 0 && diff < 0xfe {
+		buf = append(buf, byte(diff))
+	} else if diff < 0 || diff > 0x7fff {
+		buf = append(buf, 0xfe, byte(ndx>>24)|0x80, byte(ndx), byte(ndx>>8), byte(ndx>>16))
+	} else {
+		buf = append(buf, 0xfe, byte(diff>>8), byte(diff))
+	}
+	_, err := c.writer.Write(buf)
+	return err
+}
+
+func (c *rsyncConn) writeLine(line string) error {
+	_, err := c.writer.WriteString(line + "\n")
+	return err
+}
+
+// argument of server ends with '\n' before protocol 30, then with '\0'
+func (c *rsyncConn) writeArg(arg string) error {
+	if c.protocol < 30 {
+		return c.writeLine(arg)
+	}
+	_, err := c.writer.WriteString(arg + "\x00")
+	return err
+}
+
+func (c *rsyncConn) flush() error {
+	return c.writer.Flush()
+}
+
+// timeout is ErrRsyncTimeout, others are ErrRsyncProtocol with last error message of rsync daemon
+func (c *rsyncConn) wrapError(msg string, err error) error {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return fmt.Errorf("%w: %s: %v", ErrRsyncTimeout, msg, err)
+	}
+	if len(c.lastError) > 0 {
+		return fmt.Errorf("%w: %s: %v, error from rsync daemon: %s", ErrRsyncProtocol, msg, err, c.lastError)
+	}
+	return fmt.Errorf("%w: %s: %v", ErrRsyncProtocol, msg, err)
+}
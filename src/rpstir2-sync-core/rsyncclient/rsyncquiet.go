@@ -0,0 +1,76 @@
+package rsyncclient
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/conf"
+)
+
+// rsync::nativeClient, otherwise rsync command is used
+func IsNativeClient() bool {
+	return conf.Bool("rsync::nativeClient")
+}
+
+// options of one rsync in [rsync] of project.conf. timeout is rsync::timeoutMinutes, and is capped by deadline,
+// zero deadline is no deadline
+func GetRsyncOptions(deadline time.Time) (rsyncOptions RsyncOptions, err error) {
+	rsyncOptions = RsyncOptions{
+		Timeout:       time.Duration(conf.Int("rsync::timeoutMinutes")) * time.Minute,
+		ConTimeout:    time.Duration(conf.Int("rsync::conTimeoutSeconds")) * time.Second,
+		BandwidthKBps: getUint64("rsync::bandwidthKBps"),
+		MaxFileBytes:  getUint64("rsync::maxFileMegaBytes") * 1024 * 1024,
+		MaxTotalBytes: getUint64("rsync::maxTotalMegaBytes") * 1024 * 1024,
+	}
+	if rsyncOptions.Timeout < 0 {
+		rsyncOptions.Timeout = 0
+	}
+	if rsyncOptions.ConTimeout < 0 {
+		rsyncOptions.ConTimeout = 0
+	}
+	if !deadline.IsZero() {
+		left := time.Until(deadline)
+		if left <= 0 {
+			return rsyncOptions, fmt.Errorf("%w: deadline %v is passed", ErrRsyncTimeout, deadline)
+		}
+		if rsyncOptions.Timeout <= 0 || left < rsyncOptions.Timeout {
+			rsyncOptions.Timeout = left
+		}
+	}
+	return rsyncOptions, nil
+}
+
+// rsync by options of GetRsyncOptions(deadline). RsyncDestPath of rsyncResult is local directory of rsyncUrl
+func RsyncQuiet(rsyncUrl string, destPath string, deadline time.Time) (rsyncResult RsyncResult, err error) {
+	rsyncOptions, err := GetRsyncOptions(deadline)
+	if err != nil {
+		belogs.Error("RsyncQuiet(): GetRsyncOptions fail, rsyncUrl:", rsyncUrl, "  deadline:", deadline, err)
+		return rsyncResult, err
+	}
+	return RsyncByOptions(rsyncUrl, destPath, rsyncOptions)
+}
+
+// rsync by native client when rsync::nativeClient is true, or by rsync command. options are only used by this call.
+// rsync command only sets RsyncDestPath and DownloadBytes of rsyncResult
+func RsyncByOptions(rsyncUrl string, destPath string, rsyncOptions RsyncOptions) (rsyncResult RsyncResult, err error) {
+	if !IsNativeClient() {
+		return rsyncCommand(rsyncUrl, destPath, rsyncOptions)
+	}
+
+	rsyncResult, err = NewRsyncClientByOptions(rsyncOptions).Rsync(rsyncUrl, destPath)
+	if err != nil {
+		belogs.Error("RsyncByOptions(): Rsync fail, rsyncUrl:", rsyncUrl, "  destPath:", destPath, err)
+		return RsyncResult{}, err
+	}
+	return rsyncResult, nil
+}
+
+// 0 is no limit
+func getUint64(key string) uint64 {
+	value := conf.Int(key)
+	if value <= 0 {
+		return 0
+	}
+	return uint64(value)
+}
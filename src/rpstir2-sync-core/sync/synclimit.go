@@ -0,0 +1,27 @@
+package sync
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/cpusoft/goutil/conf"
+)
+
+// max objects of one repository, sync::maxObjectsPerRepo, 0 is no limit.
+// rsync and rrdp both use it
+func GetMaxObjectsPerRepo() uint64 {
+	maxObjects := conf.Int("sync::maxObjectsPerRepo")
+	if maxObjects <= 0 {
+		return 0
+	}
+	return uint64(maxObjects)
+}
+
+// maxObjects is 0, no limit
+func CheckMaxObjectsPerRepo(count uint64, maxObjects uint64) (err error) {
+	if maxObjects > 0 && count > maxObjects {
+		return errors.New("count of objects " + strconv.FormatUint(count, 10) +
+			" is more than limit " + strconv.FormatUint(maxObjects, 10))
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package sync
+
+import (
+	"testing"
+)
+
+func TestCheckMaxObjectsPerRepo(t *testing.T) {
+	tests := []struct {
+		count      uint64
+		maxObjects uint64
+		ok         bool
+	}{
+		{count: 100000, maxObjects: 0, ok: true},
+		{count: 9, maxObjects: 10, ok: true},
+		{count: 10, maxObjects: 10, ok: true},
+		{count: 11, maxObjects: 10, ok: false},
+	}
+	for _, tt := range tests {
+		err := CheckMaxObjectsPerRepo(tt.count, tt.maxObjects)
+		if (err == nil) != tt.ok {
+			t.Error("CheckMaxObjectsPerRepo(", tt.count, tt.maxObjects, "): err:", err)
+		}
+	}
+}
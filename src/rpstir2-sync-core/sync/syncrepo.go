@@ -0,0 +1,177 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	gosync "sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/jsonutil"
+	model "rpstir2-model"
+)
+
+// result of repository in this sync, one rsync module may have more than one rsync url
+type RepoResult struct {
+	RepoUrl     string        `json:"repoUrl"`
+	Protocol    string        `json:"protocol"`
+	Ok          bool          `json:"ok"`
+	Error       string        `json:"error"`
+	AttemptTime time.Time     `json:"attemptTime"`
+	Duration    time.Duration `json:"duration"`
+	// bytes downloaded by rrdp or rsync
+	Bytes uint64 `json:"bytes"`
+	// local files directly in rsync urls of rsync module, files of child repositories are not included.
+	// rrdp uses addCount and delCount
+	ObjectCount uint64 `json:"objectCount"`
+	AddCount    uint64 `json:"addCount"`
+	DelCount    uint64 `json:"delCount"`
+}
+
+// repoUrl --> result of repository in one sync, will save to lab_rpki_sync_repo at the end
+type RepoResults struct {
+	mutex   *gosync.Mutex
+	results map[string]*RepoResult
+}
+
+func NewRepoResults() *RepoResults {
+	return &RepoResults{
+		mutex:   new(gosync.Mutex),
+		results: make(map[string]*RepoResult),
+	}
+}
+
+// results of rsync urls of the same rsync module are added together
+func (r *RepoResults) AddRepoResult(repoResult RepoResult) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	existed, ok := r.results[repoResult.RepoUrl]
+	if !ok {
+		r.results[repoResult.RepoUrl] = &repoResult
+		return
+	}
+	if !repoResult.Ok {
+		existed.Ok = false
+		existed.Error = repoResult.Error
+	}
+	if repoResult.AttemptTime.Before(existed.AttemptTime) {
+		existed.AttemptTime = repoResult.AttemptTime
+	}
+	existed.Duration += repoResult.Duration
+	existed.Bytes += repoResult.Bytes
+	existed.ObjectCount += repoResult.ObjectCount
+	existed.AddCount += repoResult.AddCount
+	existed.DelCount += repoResult.DelCount
+}
+
+// save results of all repositories in this sync to lab_rpki_sync_repo and lab_rpki_sync_repo_log.
+// syncRrdpLogs are the last rrdp logs, may be nil when there is no rrdp. objectCount of rrdp is got by the last
+// rrdp log: all added files of snapshot, or last count changed by delta
+func (r *RepoResults) SaveSyncRepos(syncLogId uint64, syncRrdpLogs map[string]model.LabRpkiSyncRrdpLog) (err error) {
+	start := time.Now()
+	syncRepos, err := GetSyncReposDb()
+	if err != nil {
+		belogs.Error("SaveSyncRepos(): GetSyncReposDb fail:", err)
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	syncRepoLogs := make([]model.LabRpkiSyncRepoLog, 0, len(r.results))
+	for repoUrl, repoResult := range r.results {
+		syncRepoLog := model.LabRpkiSyncRepoLog{
+			RepoUrl:     repoUrl,
+			SyncLogId:   syncLogId,
+			Protocol:    repoResult.Protocol,
+			State:       "ok",
+			AttemptTime: repoResult.AttemptTime,
+			DurationMs:  uint64(repoResult.Duration.Milliseconds()),
+			Bytes:       repoResult.Bytes,
+			ObjectCount: repoResult.ObjectCount,
+		}
+		if !repoResult.Ok {
+			syncRepoLog.State = "fail"
+			syncRepoLog.Error = repoResult.Error
+			if len(syncRepoLog.Error) > 1024 {
+				syncRepoLog.Error = syncRepoLog.Error[:1024]
+			}
+		}
+		if syncRrdpLog, ok := syncRrdpLogs[repoUrl]; ok {
+			syncRepoLog.SessionId = syncRrdpLog.SessionId
+			syncRepoLog.Serial = syncRrdpLog.CurSerial
+			syncRepoLog.ObjectCount = syncRepos[repoUrl].ObjectCount
+			if syncRrdpLog.SyncLogId == syncLogId && syncRrdpLog.RrdpType == "snapshot" {
+				syncRepoLog.ObjectCount = repoResult.AddCount
+			} else if syncRrdpLog.SyncLogId == syncLogId && syncRrdpLog.RrdpType == "delta" {
+				syncRepoLog.ObjectCount += repoResult.AddCount
+				if syncRepoLog.ObjectCount > repoResult.DelCount {
+					syncRepoLog.ObjectCount -= repoResult.DelCount
+				} else {
+					syncRepoLog.ObjectCount = 0
+				}
+			}
+		}
+		syncRepoLogs = append(syncRepoLogs, syncRepoLog)
+	}
+	belogs.Debug("SaveSyncRepos(): syncRepoLogs:", jsonutil.MarshalJson(syncRepoLogs))
+
+	err = UpdateSyncReposDb(syncRepoLogs)
+	if err != nil {
+		belogs.Error("SaveSyncRepos(): UpdateSyncReposDb fail:", err)
+		return err
+	}
+	belogs.Info("SaveSyncRepos(): len(syncRepoLogs):", len(syncRepoLogs), "  time(s):", time.Since(start))
+	return nil
+}
+
+// rsync://host/module/
+func GetRsyncRepoUrl(rsyncUrl string) string {
+	segments := strings.Split(strings.TrimPrefix(rsyncUrl, "rsync://"), "/")
+	if len(segments) < 2 || len(segments[1]) == 0 {
+		return rsyncUrl
+	}
+	return "rsync://" + segments[0] + "/" + segments[1] + "/"
+}
+
+// count of local files directly in rsyncDestPath. sub directories are child repositories, which have
+// their own rsync urls and are counted by themselves
+func CountRsyncRepoObjects(rsyncDestPath string) (count uint64, err error) {
+	entries, err := os.ReadDir(rsyncDestPath)
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// remove local files directly in rsyncDestPath, which are counted by CountRsyncRepoObjects.
+// sub directories are child repositories, and are kept
+func RemoveRsyncRepoObjects(rsyncDestPath string) (err error) {
+	entries, err := os.ReadDir(rsyncDestPath)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		err = os.Remove(filepath.Join(rsyncDestPath, entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func AddRrdpFetchResult(all *model.RrdpFetchResult, one *model.RrdpFetchResult) {
+	atomic.AddUint64(&all.FetchCount, one.FetchCount)
+	atomic.AddUint64(&all.NotModifiedCount, one.NotModifiedCount)
+	atomic.AddUint64(&all.Bytes, one.Bytes)
+	atomic.AddUint64(&all.WireBytes, one.WireBytes)
+}
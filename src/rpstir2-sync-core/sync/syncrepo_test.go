@@ -0,0 +1,98 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCountRsyncRepoObjects(t *testing.T) {
+	rsyncDestPath := t.TempDir()
+	for _, file := range []string{"a.cer", "a.mft", "a.crl", "child/b.roa", "child/grandchild/c.roa"} {
+		pathFileName := filepath.Join(rsyncDestPath, filepath.FromSlash(file))
+		err := os.MkdirAll(filepath.Dir(pathFileName), os.ModePerm)
+		if err == nil {
+			err = os.WriteFile(pathFileName, []byte(file), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// files of child repositories are not counted by parent
+	count, err := CountRsyncRepoObjects(rsyncDestPath)
+	if err != nil || count != 3 {
+		t.Fatal("should be 3:", count, err)
+	}
+	count, err = CountRsyncRepoObjects(filepath.Join(rsyncDestPath, "child"))
+	if err != nil || count != 1 {
+		t.Fatal("should be 1:", count, err)
+	}
+	_, err = CountRsyncRepoObjects(filepath.Join(rsyncDestPath, "none"))
+	if err == nil {
+		t.Fatal("should fail")
+	}
+}
+
+func TestRemoveRsyncRepoObjects(t *testing.T) {
+	rsyncDestPath := t.TempDir()
+	for _, file := range []string{"a.cer", "a.mft", "child/b.roa", "child/grandchild/c.roa"} {
+		pathFileName := filepath.Join(rsyncDestPath, filepath.FromSlash(file))
+		err := os.MkdirAll(filepath.Dir(pathFileName), os.ModePerm)
+		if err == nil {
+			err = os.WriteFile(pathFileName, []byte(file), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// files of child repositories are kept
+	err := RemoveRsyncRepoObjects(rsyncDestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err := CountRsyncRepoObjects(rsyncDestPath)
+	if err != nil || count != 0 {
+		t.Fatal("should be 0:", count, err)
+	}
+	for _, file := range []string{"child/b.roa", "child/grandchild/c.roa"} {
+		if _, err = os.Stat(filepath.Join(rsyncDestPath, filepath.FromSlash(file))); err != nil {
+			t.Fatal("should be kept:", file, err)
+		}
+	}
+}
+
+func TestAddRepoResult(t *testing.T) {
+	start := time.Now()
+	repoResults := NewRepoResults()
+	repoResults.AddRepoResult(RepoResult{RepoUrl: "rsync://example.net/repo/", Ok: true, AttemptTime: start,
+		Duration: time.Second, Bytes: 100, ObjectCount: 3})
+	repoResults.AddRepoResult(RepoResult{RepoUrl: "rsync://example.net/repo/", Ok: false, Error: "timeout",
+		AttemptTime: start.Add(-time.Minute), Duration: time.Second, ObjectCount: 1})
+	repoResults.AddRepoResult(RepoResult{RepoUrl: "rsync://example.org/repo/", Ok: true, AttemptTime: start})
+	if len(repoResults.results) != 2 {
+		t.Fatal("should have 2 repositories:", len(repoResults.results))
+	}
+	repoResult := repoResults.results["rsync://example.net/repo/"]
+	if repoResult.Ok || repoResult.Error != "timeout" || !repoResult.AttemptTime.Equal(start.Add(-time.Minute)) ||
+		repoResult.Duration != 2*time.Second || repoResult.Bytes != 100 || repoResult.ObjectCount != 4 {
+		t.Fatal("repoResult is wrong:", *repoResult)
+	}
+}
+
+func TestGetRsyncRepoUrl(t *testing.T) {
+	tests := []struct {
+		rsyncUrl string
+		want     string
+	}{
+		{"rsync://example.net/repo/ca/child/", "rsync://example.net/repo/"},
+		{"rsync://example.net/repo/ta.cer", "rsync://example.net/repo/"},
+		{"rsync://example.net/repo", "rsync://example.net/repo/"},
+		{"rsync://example.net/", "rsync://example.net/"},
+	}
+	for _, test := range tests {
+		if got := GetRsyncRepoUrl(test.rsyncUrl); got != test.want {
+			t.Fatal(test.rsyncUrl, "  should be:", test.want, "  but:", got)
+		}
+	}
+}
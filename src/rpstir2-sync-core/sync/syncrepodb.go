@@ -0,0 +1,111 @@
+package sync
+
+import (
+	"time"
+
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/jsonutil"
+	"github.com/cpusoft/goutil/xormdb"
+	model "rpstir2-model"
+)
+
+// repoUrl --> repository
+func GetSyncReposDb() (syncRepos map[string]model.LabRpkiSyncRepo, err error) {
+	repos := make([]model.LabRpkiSyncRepo, 0)
+	sql := `select id, repoUrl, protocol, lastAttemptTime, lastSuccessTime, failCount, ifnull(lastError,'') as lastError,
+			ifnull(durationMs,0) as durationMs, ifnull(bytes,0) as bytes, ifnull(objectCount,0) as objectCount,
+			ifnull(sessionId,'') as sessionId, ifnull(serial,0) as serial, syncLogId
+		from lab_rpki_sync_repo`
+	err = xormdb.XormEngine.SQL(sql).Find(&repos)
+	if err != nil {
+		belogs.Error("GetSyncReposDb(): select lab_rpki_sync_repo fail:", err)
+		return nil, err
+	}
+	syncRepos = make(map[string]model.LabRpkiSyncRepo, len(repos))
+	for i := range repos {
+		syncRepos[repos[i].RepoUrl] = repos[i]
+	}
+	belogs.Info("GetSyncReposDb(): len(syncRepos):", len(syncRepos))
+	return syncRepos, nil
+}
+
+// every syncRepoLog is inserted, and its repository is updated: failCount is reset when it is ok, or added by 1 when fails.
+// lastSuccessTime and lastError are kept when there is no new one
+func UpdateSyncReposDb(syncRepoLogs []model.LabRpkiSyncRepoLog) (err error) {
+	start := time.Now()
+	session, err := xormdb.NewSession()
+	if err != nil {
+		belogs.Error("UpdateSyncReposDb(): NewSession fail:", err)
+		return err
+	}
+	defer session.Close()
+
+	logSql := `insert into lab_rpki_sync_repo_log(repoUrl,syncLogId,protocol,state,error,
+			attemptTime,durationMs,bytes,objectCount,sessionId,serial)
+		values(?,?,?,?,?,  ?,?,?,?,?,?)`
+	repoSql := `insert into lab_rpki_sync_repo(repoUrl,protocol,lastAttemptTime,lastSuccessTime,failCount,lastError,
+			durationMs,bytes,objectCount,sessionId,serial,syncLogId)
+		values(?,?,?,if(?='ok',?,null),if(?='ok',0,1),?,  ?,?,?,?,?,?)
+		on duplicate key update protocol=values(protocol), lastAttemptTime=values(lastAttemptTime),
+			lastSuccessTime=ifnull(values(lastSuccessTime),lastSuccessTime),
+			failCount=if(values(failCount)=0,0,failCount+1), lastError=ifnull(values(lastError),lastError),
+			durationMs=values(durationMs), bytes=values(bytes), objectCount=values(objectCount),
+			sessionId=values(sessionId), serial=values(serial), syncLogId=values(syncLogId)`
+	for i := range syncRepoLogs {
+		l := &syncRepoLogs[i]
+		serial := xormdb.SqlNullInt(int64(l.Serial))
+		if len(l.SessionId) == 0 {
+			serial.Valid = false
+		}
+		_, err = session.Exec(logSql, l.RepoUrl, l.SyncLogId, l.Protocol, l.State, xormdb.SqlNullString(l.Error),
+			l.AttemptTime, l.DurationMs, l.Bytes, l.ObjectCount, xormdb.SqlNullString(l.SessionId), serial)
+		if err != nil {
+			belogs.Error("UpdateSyncReposDb(): insert lab_rpki_sync_repo_log fail:", jsonutil.MarshalJson(l), err)
+			return xormdb.RollbackAndLogError(session, "UpdateSyncReposDb(): insert lab_rpki_sync_repo_log fail: ", err)
+		}
+		_, err = session.Exec(repoSql, l.RepoUrl, l.Protocol, l.AttemptTime, l.State, l.AttemptTime, l.State,
+			xormdb.SqlNullString(l.Error), l.DurationMs, l.Bytes, l.ObjectCount, xormdb.SqlNullString(l.SessionId), serial,
+			l.SyncLogId)
+		if err != nil {
+			belogs.Error("UpdateSyncReposDb(): insert lab_rpki_sync_repo fail:", jsonutil.MarshalJson(l), err)
+			return xormdb.RollbackAndLogError(session, "UpdateSyncReposDb(): insert lab_rpki_sync_repo fail: ", err)
+		}
+	}
+	err = xormdb.CommitSession(session)
+	if err != nil {
+		belogs.Error("UpdateSyncReposDb(): CommitSession fail:", err)
+		return err
+	}
+	belogs.Info("UpdateSyncReposDb(): len(syncRepoLogs):", len(syncRepoLogs), "  time(s):", time.Since(start))
+	return nil
+}
+
+// repositories which fail continuously at least minFailCount times
+func GetUnhealthySyncReposDb(minFailCount uint64) (syncRepos []model.LabRpkiSyncRepo, err error) {
+	syncRepos = make([]model.LabRpkiSyncRepo, 0)
+	sql := `select id, repoUrl, protocol, lastAttemptTime, lastSuccessTime, failCount, ifnull(lastError,'') as lastError,
+			ifnull(durationMs,0) as durationMs, ifnull(bytes,0) as bytes, ifnull(objectCount,0) as objectCount,
+			ifnull(sessionId,'') as sessionId, ifnull(serial,0) as serial, syncLogId
+		from lab_rpki_sync_repo where failCount >= ? order by failCount desc, repoUrl`
+	err = xormdb.XormEngine.SQL(sql, minFailCount).Find(&syncRepos)
+	if err != nil {
+		belogs.Error("GetUnhealthySyncReposDb(): select lab_rpki_sync_repo fail, minFailCount:", minFailCount, err)
+		return nil, err
+	}
+	return syncRepos, nil
+}
+
+// the latest syncs of repoUrl
+func GetSyncRepoLogsDb(repoUrl string, limit uint64) (syncRepoLogs []model.LabRpkiSyncRepoLog, err error) {
+	syncRepoLogs = make([]model.LabRpkiSyncRepoLog, 0)
+	sql := `select id, repoUrl, syncLogId, protocol, state, ifnull(error,'') as error, attemptTime,
+			ifnull(durationMs,0) as durationMs, ifnull(bytes,0) as bytes, ifnull(objectCount,0) as objectCount,
+			ifnull(sessionId,'') as sessionId, ifnull(serial,0) as serial
+		from lab_rpki_sync_repo_log where repoUrl = ? order by id desc limit ?`
+	err = xormdb.XormEngine.SQL(sql, repoUrl, limit).Find(&syncRepoLogs)
+	if err != nil {
+		belogs.Error("GetSyncRepoLogsDb(): select lab_rpki_sync_repo_log fail, repoUrl:", repoUrl, err)
+		return nil, err
+	}
+	return syncRepoLogs, nil
+}
@@ -0,0 +1,245 @@
+package mixsync
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/conf"
+	"github.com/cpusoft/goutil/httpclient"
+	"github.com/cpusoft/goutil/jsonutil"
+	model "rpstir2-model"
+	coremodel "rpstir2-sync-core/model"
+	coresync "rpstir2-sync-core/sync"
+)
+
+// replay sync: rsync urls are copied from local repository archive instead of network,
+// and objects are validated as on replayModel.ValidationTime. validation time of parsevalidate is sent by request
+func replaySync(replayModel model.ReplayModel) (nextStep string, err error) {
+	start := time.Now()
+	belogs.Info("replaySync():replayModel:", jsonutil.MarshalJson(replayModel))
+
+	model.SetValidationTime(replayModel.ValidationTime)
+	defer model.SetValidationTime(time.Time{})
+
+	// rsync destPath only has objects of repoPath, as rsync --delete does.
+	// it is usually empty after fullsync, and FoundDiffFiles will delete objects of last sync in db
+	rsyncDestPath := conf.String("rsync::destPath")
+	err = os.RemoveAll(rsyncDestPath)
+	if err == nil {
+		err = os.MkdirAll(rsyncDestPath, os.ModePerm)
+	}
+	if err != nil {
+		belogs.Error("replaySync():clear rsyncDestPath fail:", rsyncDestPath, err)
+		return "", err
+	}
+
+	repoPath := replayModel.RepoPath
+	if len(replayModel.ArchiveFile) > 0 {
+		repoPath, err = os.MkdirTemp("", "replay")
+		if err != nil {
+			belogs.Error("replaySync():MkdirTemp fail:", err)
+			return "", err
+		}
+		defer os.RemoveAll(repoPath)
+		err = extractReplayArchive(replayModel.ArchiveFile, repoPath)
+		if err != nil {
+			belogs.Error("replaySync():extractReplayArchive fail:", replayModel.ArchiveFile, err)
+			return "", err
+		}
+	}
+
+	syncState := coremodel.SyncState{StartTime: time.Now(), SyncStyle: "replay"}
+	syncLogId, err := coresync.InsertSyncLogStartDb("replay", "syncing")
+	if err != nil {
+		belogs.Error("replaySync():InsertSyncLogStartDb fail:", err)
+		return "", err
+	}
+	belogs.Info("replaySync():syncLogId:", syncLogId, "  repoPath:", repoPath, "  syncState:", jsonutil.MarshalJson(syncState))
+
+	// root cer of tals are found in repoPath
+	talModels, err := getReplayTals(model.ReplayModel{RepoPath: repoPath, TalPath: replayModel.TalPath})
+	if err != nil {
+		belogs.Error("replaySync(): getReplayTals failed, err:", err)
+		return "", err
+	}
+
+	err = callSync(syncLogId, talModels, &syncState, repoPath)
+	if err != nil {
+		belogs.Error("replaySync():callSync fail:", err)
+		return "", err
+	}
+
+	err = coresync.UpdateSyncLogEndDb(syncLogId, "synced", jsonutil.MarshalJson(syncState))
+	if err != nil {
+		belogs.Error("replaySync():UpdateSyncLogEndDb fail:", err)
+		return "", err
+	}
+	belogs.Info("replaySync(): end replay sync, will parsevalidate,  time(s):", time.Since(start))
+	return "parsevalidate", nil
+}
+
+func getReplayTals(replayModel model.ReplayModel) (talModels []model.TalModel, err error) {
+	// by /tal/getreplaytals
+	talModelsResponse := model.TalModelsResponse{}
+	err = httpclient.PostAndUnmarshalResponseModel("https://"+conf.String("rpstir2-rp::serverHost")+":"+conf.String("rpstir2-rp::serverHttpsPort")+
+		"/tal/getreplaytals", jsonutil.MarshalJson(replayModel), false, &talModelsResponse)
+	if err != nil {
+		belogs.Error("getReplayTals(): /tal/getreplaytals failed, err:", err)
+		return nil, err
+	}
+	if len(talModelsResponse.TalModels) == 0 {
+		belogs.Error("getReplayTals(): there is no tal file")
+		return nil, errors.New("there is no tal file")
+	}
+	return talModelsResponse.TalModels, nil
+}
+
+// copy rsync://host/module/path from repoPath/host/module/path to syncChan.Dest/host/module/path, as rsync does.
+// when url is a file, rsyncDestPath is its parent directory
+func replayRsync(repoPath string, syncChan SyncChan) (rsyncDestPath string, err error) {
+	relPath, err := getReplayRelPath(strings.TrimPrefix(syncChan.Url, "rsync://"))
+	if err != nil {
+		return "", err
+	}
+	srcPath := filepath.Join(repoPath, relPath)
+	destPath := filepath.Join(syncChan.Dest, relPath)
+	fi, err := os.Stat(srcPath)
+	if err != nil {
+		belogs.Error("replayRsync(): url is not in repoPath:", syncChan.Url, srcPath, err)
+		return "", err
+	}
+	if !fi.IsDir() {
+		err = copyReplayFile(srcPath, destPath, fi)
+		if err != nil {
+			return "", err
+		}
+		return filepath.Dir(destPath) + string(os.PathSeparator), nil
+	}
+
+	err = filepath.Walk(srcPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(srcPath, path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return os.MkdirAll(filepath.Join(destPath, rel), os.ModePerm)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		return copyReplayFile(path, filepath.Join(destPath, rel), info)
+	})
+	if err != nil {
+		belogs.Error("replayRsync(): copy fail:", srcPath, destPath, err)
+		return "", err
+	}
+	belogs.Debug("replayRsync(): url:", syncChan.Url, "  srcPath:", srcPath, "  destPath:", destPath)
+	return destPath + string(os.PathSeparator), nil
+}
+
+// keep modification time, so FoundDiffFiles will find it as rsync does
+func copyReplayFile(srcFile, destFile string, fi os.FileInfo) (err error) {
+	err = os.MkdirAll(filepath.Dir(destFile), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	src, err := os.Open(srcFile)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	err = writeReplayFile(destFile, src)
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(destFile, fi.ModTime(), fi.ModTime())
+}
+
+func writeReplayFile(destFile string, r io.Reader) (err error) {
+	dest, err := os.Create(destFile)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dest, r)
+	if closeErr := dest.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// extract .tar/.tar.gz/.tgz to destPath, only directories and regular files are extracted
+func extractReplayArchive(archiveFile, destPath string) (err error) {
+	start := time.Now()
+	f, err := os.Open(archiveFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(archiveFile, ".gz") || strings.HasSuffix(archiveFile, ".tgz") {
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		r = gr
+	}
+
+	tr := tar.NewReader(r)
+	var count int
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		relPath, err := getReplayRelPath(hdr.Name)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(destPath, relPath)
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, os.ModePerm)
+		case tar.TypeReg:
+			err = os.MkdirAll(filepath.Dir(target), os.ModePerm)
+			if err == nil {
+				err = writeReplayFile(target, tr)
+			}
+			if err == nil {
+				err = os.Chtimes(target, hdr.ModTime, hdr.ModTime)
+			}
+			count++
+		default:
+			belogs.Debug("extractReplayArchive(): ignore:", hdr.Name, "  typeflag:", hdr.Typeflag)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	belogs.Info("extractReplayArchive(): archiveFile:", archiveFile, "  destPath:", destPath,
+		"  files:", count, "  time(s):", time.Since(start))
+	return nil
+}
+
+// path should be relative and in this directory
+func getReplayRelPath(path string) (string, error) {
+	relPath := filepath.Clean(filepath.FromSlash(path))
+	if filepath.IsAbs(relPath) || relPath == ".." || strings.HasPrefix(relPath, ".."+string(os.PathSeparator)) {
+		return "", errors.New("path is not safe: " + path)
+	}
+	return relPath, nil
+}
@@ -0,0 +1,32 @@
+package mixsync
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestGetReplayRelPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"example.net/repo/ca/a.roa", filepath.FromSlash("example.net/repo/ca/a.roa")},
+		{"example.net/repo/ca/", filepath.FromSlash("example.net/repo/ca")},
+		{"./example.net//repo/./ca/../a.cer", filepath.FromSlash("example.net/repo/a.cer")},
+		{"example.net/..", "."},
+	}
+	for _, tt := range tests {
+		got, err := getReplayRelPath(tt.path)
+		if err != nil || got != tt.want {
+			t.Error("getReplayRelPath(", tt.path, "): should be:", tt.want, "  but:", got, err)
+		}
+	}
+
+	// out of repoPath
+	for _, path := range []string{"..", "../etc/passwd", "example.net/../../etc/passwd",
+		"/etc/passwd", "example.net/repo/../../../a.cer"} {
+		if got, err := getReplayRelPath(path); err == nil {
+			t.Error("getReplayRelPath(", path, "): should fail, but:", got)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package mixsync
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/conf"
+	"github.com/cpusoft/goutil/ginserver"
+	"github.com/cpusoft/goutil/httpclient"
+	"github.com/cpusoft/goutil/jsonutil"
+	"github.com/cpusoft/goutil/osutil"
+	"github.com/gin-gonic/gin"
+	model "rpstir2-model"
+)
+
+// start to replay sync from local repository archive: it will remove current data by fullsync except health of repositories,
+// then call ReplaySync
+func ReplayStart(c *gin.Context) {
+	belogs.Info("ReplayStart(): start")
+
+	replayModel, err := bindReplayModel(c)
+	if err != nil {
+		belogs.Error("ReplayStart(): bindReplayModel:", err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+
+	//check serviceState, same as SyncStart
+	ssr := model.ServiceState{}
+	err = httpclient.PostAndUnmarshalResponseModel("https://"+conf.String("rpstir2-rp::serverHost")+":"+conf.String("rpstir2-rp::serverHttpsPort")+
+		"/sys/servicestate", `{"operate":"enter","state":"sync"}`, false, &ssr)
+	if err != nil {
+		belogs.Error("ReplayStart(): PostAndUnmarshalResponseModel failed, err:", err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	httpclient.Post("https://"+conf.String("rpstir2-rp::serverHost")+":"+conf.String("rpstir2-rp::serverHttpsPort")+
+		"/sys/servicestate", `{"operate":"leave","state":"end"}`, false)
+
+	//{"sysStyle": "fullsync","syncPolicy":"replay","replayModel":{...}}
+	go httpclient.Post("https://"+conf.String("rpstir2-rp::serverHost")+":"+conf.String("rpstir2-rp::serverHttpsPort")+
+		"/sys/initreset", `{"sysStyle":"fullsync", "syncPolicy":"replay", "replayModel":`+jsonutil.MarshalJson(replayModel)+`}`, false)
+	ginserver.ResponseOk(c, nil)
+}
+
+// called by /sys/initreset after fullsync
+func ReplaySync(c *gin.Context) {
+	belogs.Info("ReplaySync(): start")
+	start := time.Now()
+
+	replayModel, err := bindReplayModel(c)
+	if err != nil {
+		belogs.Error("ReplaySync(): bindReplayModel:", err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+
+	//check serviceState
+	ssr := model.ServiceState{}
+	err = httpclient.PostAndUnmarshalResponseModel("https://"+conf.String("rpstir2-rp::serverHost")+":"+conf.String("rpstir2-rp::serverHttpsPort")+
+		"/sys/servicestate", `{"operate":"enter","state":"sync"}`, false, &ssr)
+	if err != nil {
+		belogs.Error("ReplaySync(): PostAndUnmarshalResponseModel failed, err:", err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+
+	go func() {
+		nextStep, err := replaySync(replayModel)
+		belogs.Debug("ReplaySync(): replaySync end,  nextStep is :", nextStep, "  time(s)", time.Since(start), " err:", err)
+
+		if err != nil {
+			// will end this whole sync
+			belogs.Error("ReplaySync(): replaySync fail, replayModel is :", jsonutil.MarshalJson(replayModel), err)
+			httpclient.Post("https://"+conf.String("rpstir2-rp::serverHost")+":"+conf.String("rpstir2-rp::serverHttpsPort")+
+				"/sys/servicestate", `{"operate":"leave","state":"end"}`, false)
+			return
+		}
+
+		// will end sync ,and will start next step
+		httpclient.Post("https://"+conf.String("rpstir2-rp::serverHost")+":"+conf.String("rpstir2-rp::serverHttpsPort")+
+			"/sys/servicestate", `{"operate":"leave","state":"sync"}`, false)
+		// objects are validated as on validationTime, and result is sent to rtr unless skipRtr
+		replayStepModel := model.ReplayStepModel{ValidationTime: replayModel.ValidationTime, Replay: true,
+			SkipRtr: replayModel.SkipRtr}
+		go httpclient.Post("https://"+conf.String("rpstir2-rp::serverHost")+":"+conf.String("rpstir2-rp::serverHttpsPort")+
+			"/parsevalidate/start", jsonutil.MarshalJson(replayStepModel), false)
+		belogs.Info("ReplaySync(): end, nextStep is :", nextStep)
+	}()
+	ginserver.ResponseOk(c, nil)
+}
+
+// one of repoPath and archiveFile should be set, and should exist
+func bindReplayModel(c *gin.Context) (replayModel model.ReplayModel, err error) {
+	err = c.ShouldBindJSON(&replayModel)
+	if err != nil {
+		return replayModel, err
+	}
+	belogs.Info("bindReplayModel(): replayModel:", jsonutil.MarshalJson(replayModel))
+
+	if (len(replayModel.RepoPath) == 0) == (len(replayModel.ArchiveFile) == 0) {
+		return replayModel, errors.New("one of repoPath and archiveFile should be set")
+	}
+	if len(replayModel.RepoPath) > 0 {
+		isDir, err := osutil.IsDir(replayModel.RepoPath)
+		if err != nil || !isDir {
+			return replayModel, errors.New("repoPath is not a directory: " + replayModel.RepoPath)
+		}
+	} else {
+		isFile, err := osutil.IsFile(replayModel.ArchiveFile)
+		if err != nil || !isFile {
+			return replayModel, errors.New("archiveFile is not a file: " + replayModel.ArchiveFile)
+		}
+	}
+	return replayModel, nil
+}
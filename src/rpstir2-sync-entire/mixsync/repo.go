@@ -0,0 +1,16 @@
+package mixsync
+
+import (
+	"github.com/cpusoft/goutil/belogs"
+	"rpstir2-sync-core/rrdp"
+)
+
+// save results of all repositories in this sync to lab_rpki_sync_repo and lab_rpki_sync_repo_log
+func saveSyncRepos(spQueue *SyncParseQueue) (err error) {
+	syncRrdpLogs, err := rrdp.GetLastSyncRrdpLogsDb()
+	if err != nil {
+		belogs.Error("saveSyncRepos(): GetLastSyncRrdpLogsDb fail:", err)
+		return err
+	}
+	return spQueue.repoResults.SaveSyncRepos(spQueue.LabRpkiSyncLogId, syncRrdpLogs)
+}
@@ -0,0 +1,94 @@
+package mixsync
+
+import (
+	"errors"
+
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/ginserver"
+	"github.com/cpusoft/goutil/jsonutil"
+	"github.com/gin-gonic/gin"
+	"rpstir2-sync-core/repopolicy"
+	coresync "rpstir2-sync-core/sync"
+)
+
+// {"minFailCount":1}, minFailCount is 1 by default
+type RepoUnhealthyRequest struct {
+	MinFailCount uint64 `json:"minFailCount"`
+}
+
+// {"repoUrl":"https://rrdp.ripe.net/notification.xml","limit":100}, limit is 100 by default
+type RepoHistoryRequest struct {
+	RepoUrl string `json:"repoUrl"`
+	Limit   uint64 `json:"limit"`
+}
+
+// repositories which fail continuously
+func RepoUnhealthy(c *gin.Context) {
+	belogs.Info("RepoUnhealthy(): start")
+
+	repoUnhealthyRequest := RepoUnhealthyRequest{}
+	err := c.ShouldBindJSON(&repoUnhealthyRequest)
+	if err != nil {
+		belogs.Error("RepoUnhealthy(): ShouldBindJSON fail:", err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	if repoUnhealthyRequest.MinFailCount == 0 {
+		repoUnhealthyRequest.MinFailCount = 1
+	}
+	syncRepos, err := coresync.GetUnhealthySyncReposDb(repoUnhealthyRequest.MinFailCount)
+	if err != nil {
+		belogs.Error("RepoUnhealthy(): GetUnhealthySyncReposDb fail:", jsonutil.MarshalJson(repoUnhealthyRequest), err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	belogs.Info("RepoUnhealthy(): minFailCount:", repoUnhealthyRequest.MinFailCount, "  len(syncRepos):", len(syncRepos))
+	ginserver.ResponseOk(c, syncRepos)
+}
+
+// the latest syncs of one repository
+func RepoHistory(c *gin.Context) {
+	belogs.Info("RepoHistory(): start")
+
+	repoHistoryRequest := RepoHistoryRequest{}
+	err := c.ShouldBindJSON(&repoHistoryRequest)
+	if err != nil {
+		belogs.Error("RepoHistory(): ShouldBindJSON fail:", err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	if len(repoHistoryRequest.RepoUrl) == 0 {
+		belogs.Error("RepoHistory(): repoUrl is empty")
+		ginserver.ResponseFail(c, errors.New("repoUrl is empty"), "")
+		return
+	}
+	if repoHistoryRequest.Limit == 0 {
+		repoHistoryRequest.Limit = 100
+	}
+	syncRepoLogs, err := coresync.GetSyncRepoLogsDb(repoHistoryRequest.RepoUrl, repoHistoryRequest.Limit)
+	if err != nil {
+		belogs.Error("RepoHistory(): GetSyncRepoLogsDb fail:", jsonutil.MarshalJson(repoHistoryRequest), err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	belogs.Info("RepoHistory(): repoUrl:", repoHistoryRequest.RepoUrl, "  len(syncRepoLogs):", len(syncRepoLogs))
+	ginserver.ResponseOk(c, syncRepoLogs)
+}
+
+// rules of sync::repoPolicyFile, and count of urls decided by every rule
+func RepoPolicy(c *gin.Context) {
+	belogs.Info("RepoPolicy(): start")
+	ginserver.ResponseOk(c, repopolicy.GetRepoPolicy())
+}
+
+// load sync::repoPolicyFile again without restart, counts of rules are reset
+func RepoPolicyReload(c *gin.Context) {
+	belogs.Info("RepoPolicyReload(): start")
+	err := repopolicy.ReloadRepoPolicy()
+	if err != nil {
+		belogs.Error("RepoPolicyReload(): ReloadRepoPolicy fail:", err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	ginserver.ResponseOk(c, repopolicy.GetRepoPolicy())
+}
@@ -7,7 +7,9 @@ import (
 	"github.com/cpusoft/goutil/belogs"
 	"github.com/cpusoft/goutil/jsonutil"
 	"github.com/cpusoft/goutil/osutil"
+	model "rpstir2-model"
 	"rpstir2-sync-core/rrdp"
+	coresync "rpstir2-sync-core/sync"
 )
 
 func rrdpByUrl(spQueue *SyncParseQueue, syncChan SyncChan) {
@@ -27,14 +29,20 @@ func rrdpByUrl(spQueue *SyncParseQueue, syncChan SyncChan) {
 	belogs.Debug("rrdpByUrl(): before rrdp, syncChan:", jsonutil.MarshalJson(syncChan),
 		"    SyncingCount:", atomic.LoadInt64(&spQueue.SyncingCount), "   startTime:", start)
 	lastSyncRrdpLog, hasLast := spQueue.LastSyncRrdpLogs[syncChan.Url]
+	// fetch result of this url, will add to sync result
+	var fetchResult model.RrdpFetchResult
 	rrdpByUrlModel := rrdp.RrdpByUrlModel{
-		NotifyUrl:     syncChan.Url,
-		DestPath:      syncChan.Dest,
-		HasPath:       true,
-		HasLast:       hasLast,
-		LastSessionId: lastSyncRrdpLog.SessionId,
-		LastCurSerial: lastSyncRrdpLog.CurSerial,
-		SyncLogId:     spQueue.LabRpkiSyncLogId,
+		NotifyUrl:      syncChan.Url,
+		DestPath:       syncChan.Dest,
+		HasPath:        true,
+		HasLast:        hasLast,
+		LastSessionId:  lastSyncRrdpLog.SessionId,
+		LastCurSerial:  lastSyncRrdpLog.CurSerial,
+		SyncLogId:      spQueue.LabRpkiSyncLogId,
+		CaRepositories: spQueue.getRrdpCaRepositories(syncChan.Url),
+		FetchResult:    &fetchResult,
+		UriErrors:      &spQueue.SyncResult.RrdpUriErrors,
+		Deadline:       getRepoSyncDeadline(start),
 	}
 	belogs.Debug("rrdpByUrl():rrdpByUrlModel:", jsonutil.MarshalJson(rrdpByUrlModel))
 	// will ignore connectRrdpUrlCh
@@ -45,8 +53,32 @@ func rrdpByUrl(spQueue *SyncParseQueue, syncChan SyncChan) {
 	rrdpFiles, err := rrdp.RrdpByUrlImpl(rrdpByUrlModel, connectRrdpUrlCh, nil)
 	atomic.AddInt64(&spQueue.SyncingCount, -1)
 	belogs.Debug("rrdpByUrl(): RrdpByUrlImpl, len(rrdpFiles), err:", len(rrdpFiles), err)
+	coresync.AddRrdpFetchResult(&spQueue.SyncResult.RrdpFetchResult, &fetchResult)
+	repoResult := coresync.RepoResult{
+		RepoUrl:     syncChan.Url,
+		Protocol:    "rrdp",
+		Ok:          err == nil,
+		AttemptTime: start,
+		Duration:    time.Since(start),
+		Bytes:       fetchResult.Bytes,
+	}
+	for i := range rrdpFiles {
+		if rrdpFiles[i].SyncType == "add" {
+			repoResult.AddCount++
+		} else if rrdpFiles[i].SyncType == "del" {
+			repoResult.DelCount++
+		}
+	}
+	if err != nil {
+		repoResult.Error = err.Error()
+	}
+	spQueue.repoResults.AddRepoResult(repoResult)
 
 	if err != nil {
+		if fallbackRrdpToRsync(spQueue, syncChan, err) {
+			belogs.Error("rrdpByUrl():RrdpByUrlImpl fail, fallback to rsync, syncChan.Url:", syncChan.Url, "   err:", err, "  time(s):", time.Since(start))
+			return
+		}
 		spQueue.SyncResult.FailUrls.Store(syncChan.Url, err.Error())
 		belogs.Error("rrdpByUrl():RrdpByUrlImpl fail, syncChan.Url:", syncChan.Url, "   err:", err, "  time(s):", time.Since(start))
 		belogs.Debug("rrdpByUrl():RrdpByUrlImpl fail, before SyncingAndParsingCount-1:", atomic.LoadInt64(&spQueue.SyncingAndParsingCount))
@@ -54,6 +86,7 @@ func rrdpByUrl(spQueue *SyncParseQueue, syncChan SyncChan) {
 		belogs.Debug("rrdpByUrl():RrdpByUrlImpl fail, after SyncingAndParsingCount-1:", atomic.LoadInt64(&spQueue.SyncingAndParsingCount))
 		return
 	}
+	resetRrdpFallback(spQueue, syncChan.Url, rrdpByUrlModel.CaRepositories)
 	if len(rrdpFiles) == 0 {
 		belogs.Debug("rrdpByUrl():len(rrdpFiles) == 0,no need rrdp,before:", syncChan.Url, "   , before SyncingAndParsingCount-1:", atomic.LoadInt64(&spQueue.SyncingAndParsingCount))
 		atomic.AddInt64(&spQueue.SyncingAndParsingCount, -1)
@@ -79,7 +112,7 @@ func rrdpByUrl(spQueue *SyncParseQueue, syncChan SyncChan) {
 
 		belogs.Debug("rrdpByUrl(): rrdpFiles[i]:", jsonutil.MarshalJson(rrdpFiles[i]))
 	}
-	parseChan := ParseChan{Url: syncChan.Url, FilePathNames: filePathNames}
+	parseChan := ParseChan{Url: syncChan.Url, FilePathNames: filePathNames, Depth: syncChan.Depth}
 	belogs.Debug("rrdpByUrl(): before parseChan:", jsonutil.MarshalJson(parseChan), "   len(spQueue.ParseChan):", len(spQueue.ParseChan))
 	spQueue.ParseChan <- parseChan
 	belogs.Debug("rrdpByUrl(): after parseChan:", jsonutil.MarshalJson(parseChan))
@@ -91,6 +124,7 @@ func rrdpByUrl(spQueue *SyncParseQueue, syncChan SyncChan) {
 
 }
 
+// fetch result of one url is added to all
 func parseRrdpCerFiles(spQueue *SyncParseQueue, parseChan ParseChan) {
 	defer func() {
 		belogs.Debug("parseRrdpCerFiles():defer spQueue.SyncingAndParsingCount:", atomic.LoadInt64(&spQueue.SyncingAndParsingCount),
@@ -102,6 +136,6 @@ func parseRrdpCerFiles(spQueue *SyncParseQueue, parseChan ParseChan) {
 	}()
 	belogs.Debug("parseRrdpCerFiles(): parseChan:", jsonutil.MarshalJson(parseChan))
 	belogs.Info("parseRrdpCerFiles():  parseChan.Url:", parseChan.Url, "   len(parseChan.FilePathNames):", len(parseChan.FilePathNames))
-	parseCerAndGetSubRepoUrlAndAddToSpQueue(spQueue, parseChan.FilePathNames)
+	parseCerAndGetSubRepoUrlAndAddToSpQueue(spQueue, parseChan, parseChan.FilePathNames)
 	belogs.Debug("parseRrdpCerFiles(): after parseCerAndGetSubRepoUrlAndAddToSpQueue parseChan:", jsonutil.MarshalJson(parseChan))
 }
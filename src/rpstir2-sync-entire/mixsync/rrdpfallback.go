@@ -0,0 +1,223 @@
+package mixsync
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/conf"
+	"github.com/cpusoft/goutil/jsonutil"
+	model "rpstir2-model"
+	"rpstir2-sync-core/rrdp"
+	coresync "rpstir2-sync-core/sync"
+)
+
+// saved in SyncResult.FallbackUrls
+type RrdpFallbackResult struct {
+	Reason       string    `json:"reason"`
+	RsyncUrls    []string  `json:"rsyncUrls"`
+	NextRrdpTime time.Time `json:"nextRrdpTime"`
+}
+
+// rrdp url is used, but when rrdp of notifyUrl has failed and is still in backoff, rsyncUrl is used.
+// rsyncUrl is the caRepository of the same publication point, it is saved to fallback when rrdp fails,
+// and is always saved as caRepository which referenced notifyUrl
+func (r *SyncParseQueue) GetSyncUrlWithFallback(notifyUrl, rsyncUrl, rsyncDest string, depth uint64) string {
+	r.rrdpFallbackMutex.Lock()
+	defer r.rrdpFallbackMutex.Unlock()
+	if !containsString(r.rrdpCaRepositories[notifyUrl], rsyncUrl) {
+		r.rrdpCaRepositories[notifyUrl] = append(r.rrdpCaRepositories[notifyUrl], rsyncUrl)
+	}
+	if rrdpFallback, ok := r.rrdpFallbacks[notifyUrl]; ok && time.Now().Before(rrdpFallback.NextRrdpTime) {
+		belogs.Debug("GetSyncUrlWithFallback(): rrdp is in backoff, will rsync:", notifyUrl, "  rsyncUrl:", rsyncUrl,
+			"  nextRrdpTime:", rrdpFallback.NextRrdpTime)
+		r.rrdpFallbackRsyncUrls[rsyncUrl] = true
+		return rsyncUrl
+	}
+	if !r.rrdpFinishedUrls[notifyUrl] {
+		r.rrdpFallbackUrls[notifyUrl] = append(r.rrdpFallbackUrls[notifyUrl], SyncChan{Url: rsyncUrl, Dest: rsyncDest, Depth: depth})
+	}
+	return notifyUrl
+}
+
+// set notifyUrl in backoff, and return rsync urls of it
+func (r *SyncParseQueue) setRrdpFallback(notifyUrl string, reason string) (rrdpFallback model.LabRpkiSyncRrdpFallback, rsyncChans []SyncChan) {
+	r.rrdpFallbackMutex.Lock()
+	defer r.rrdpFallbackMutex.Unlock()
+	rrdpFallback = r.rrdpFallbacks[notifyUrl]
+	rrdpFallback.NotifyUrl = notifyUrl
+	rrdpFallback.FailCount++
+	rrdpFallback.FailReason = reason
+	if len(rrdpFallback.FailReason) > 1024 {
+		rrdpFallback.FailReason = rrdpFallback.FailReason[:1024]
+	}
+	rrdpFallback.FailTime = time.Now()
+	rrdpFallback.NextRrdpTime = rrdpFallback.FailTime.Add(getRrdpFallbackBackoff(rrdpFallback.FailCount,
+		r.rrdpFallbackBackoff, r.rrdpFallbackMaxBackoff))
+	rrdpFallback.SyncLogId = r.LabRpkiSyncLogId
+	r.rrdpFallbacks[notifyUrl] = rrdpFallback
+
+	rsyncChans = r.rrdpFallbackUrls[notifyUrl]
+	delete(r.rrdpFallbackUrls, notifyUrl)
+	r.rrdpFinishedUrls[notifyUrl] = true
+	for i := range rsyncChans {
+		r.rrdpFallbackRsyncUrls[rsyncChans[i].Url] = true
+	}
+	return rrdpFallback, rsyncChans
+}
+
+// rsync url is used because rrdp fell back to rsync in this sync
+func (r *SyncParseQueue) isRrdpFallbackRsyncUrl(rsyncUrl string) bool {
+	r.rrdpFallbackMutex.Lock()
+	defer r.rrdpFallbackMutex.Unlock()
+	return r.rrdpFallbackRsyncUrls[rsyncUrl]
+}
+
+// rrdp has finished without fallback, so caRepositories of it are not saved any more
+func (r *SyncParseQueue) finishRrdpFallbackUrls(notifyUrl string) {
+	r.rrdpFallbackMutex.Lock()
+	defer r.rrdpFallbackMutex.Unlock()
+	delete(r.rrdpFallbackUrls, notifyUrl)
+	r.rrdpFinishedUrls[notifyUrl] = true
+}
+
+// rrdp is ok, return true when it fell back before
+func (r *SyncParseQueue) clearRrdpFallback(notifyUrl string) bool {
+	r.rrdpFallbackMutex.Lock()
+	defer r.rrdpFallbackMutex.Unlock()
+	delete(r.rrdpFallbackUrls, notifyUrl)
+	r.rrdpFinishedUrls[notifyUrl] = true
+	if _, ok := r.rrdpFallbacks[notifyUrl]; !ok {
+		return false
+	}
+	delete(r.rrdpFallbacks, notifyUrl)
+	return true
+}
+
+// caRepositories of cas which referenced notifyUrl, rrdp can only write objects in them.
+// they are kept after rrdp finishes or falls back
+func (r *SyncParseQueue) getRrdpCaRepositories(notifyUrl string) (caRepositories []string) {
+	r.rrdpFallbackMutex.Lock()
+	defer r.rrdpFallbackMutex.Unlock()
+	caRepositories = make([]string, len(r.rrdpCaRepositories[notifyUrl]))
+	copy(caRepositories, r.rrdpCaRepositories[notifyUrl])
+	return caRepositories
+}
+
+func containsString(ss []string, s string) bool {
+	for i := range ss {
+		if ss[i] == s {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff is doubled after every continuous fail, from rrdp::fallbackBackoffMinutes to rrdp::fallbackMaxBackoffMinutes,
+// default is from 60 minutes to 24 hours
+func getRrdpFallbackBackoff(failCount uint64, backoff, maxBackoff time.Duration) time.Duration {
+	if backoff <= 0 {
+		backoff = 60 * time.Minute
+	}
+	if maxBackoff < backoff {
+		maxBackoff = 24 * 60 * time.Minute
+	}
+	for i := uint64(1); i < failCount && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
+
+// rfc8182 3.4.5, when rrdp fails, rsync the same publication point by caRepository instead.
+// return false when there is no rsync url to fallback, then it is just a fail url
+func fallbackRrdpToRsync(spQueue *SyncParseQueue, syncChan SyncChan, rrdpErr error) bool {
+	if !conf.Bool("rrdp::fallbackToRsync") {
+		spQueue.finishRrdpFallbackUrls(syncChan.Url)
+		return false
+	}
+	rrdpFallback, rsyncChans := spQueue.setRrdpFallback(syncChan.Url, rrdpErr.Error())
+	err := rrdp.UpdateRrdpFallbackDb(&rrdpFallback)
+	if err != nil {
+		belogs.Error("fallbackRrdpToRsync(): UpdateRrdpFallbackDb fail:", jsonutil.MarshalJson(rrdpFallback), err)
+		// no return
+	}
+	if len(rsyncChans) == 0 {
+		belogs.Info("fallbackRrdpToRsync(): there is no rsync url to fallback:", syncChan.Url)
+		return false
+	}
+
+	rsyncUrls := make([]string, 0, len(rsyncChans))
+	for i := range rsyncChans {
+		rsyncUrls = append(rsyncUrls, rsyncChans[i].Url)
+	}
+	// rrdp objects of last sync are superseded by rsync objects, otherwise both are in db
+	removeRepoObjects(conf.String("rrdp::destPath"), rsyncUrls)
+	spQueue.SyncResult.FallbackUrls.Store(syncChan.Url, RrdpFallbackResult{
+		Reason:       rrdpFallback.FailReason,
+		RsyncUrls:    rsyncUrls,
+		NextRrdpTime: rrdpFallback.NextRrdpTime,
+	})
+	belogs.Info("fallbackRrdpToRsync(): rrdp fail, will rsync:", syncChan.Url, "  rsyncUrls:", rsyncUrls,
+		"  failCount:", rrdpFallback.FailCount, "  nextRrdpTime:", rrdpFallback.NextRrdpTime, "  rrdpErr:", rrdpErr)
+
+	// this rrdp url -1, and every rsync url +1
+	atomic.AddInt64(&spQueue.SyncingAndParsingCount, int64(len(rsyncChans))-1)
+	for i := range rsyncChans {
+		go spQueue.AddSyncUrl(rsyncChans[i].Url, rsyncChans[i].Dest, rsyncChans[i].Depth)
+	}
+	return true
+}
+
+// rrdp is ok again, so will not fallback. rsync objects of caRepositories of last fallback are superseded by rrdp objects
+func resetRrdpFallback(spQueue *SyncParseQueue, notifyUrl string, caRepositories []string) {
+	if !spQueue.clearRrdpFallback(notifyUrl) {
+		return
+	}
+	belogs.Info("resetRrdpFallback(): rrdp is ok again:", notifyUrl, "  caRepositories:", caRepositories)
+	removeRepoObjects(conf.String("rsync::destPath"), caRepositories)
+	err := rrdp.DelRrdpFallbackDb(notifyUrl)
+	if err != nil {
+		belogs.Error("resetRrdpFallback(): DelRrdpFallbackDb fail:", notifyUrl, err)
+	}
+}
+
+// remove local files and db records of caRepositories in destPath, which are saved by host and path of caRepository
+func removeRepoObjects(destPath string, caRepositories []string) {
+	for _, caRepository := range caRepositories {
+		repoPath := getRepoLocalPath(destPath, caRepository)
+		if len(repoPath) == 0 {
+			continue
+		}
+		err := coresync.DelByFilePathDb(repoPath)
+		if err != nil {
+			belogs.Error("removeRepoObjects(): DelByFilePathDb fail, repoPath:", repoPath, err)
+			// no return
+		}
+		err = os.RemoveAll(repoPath)
+		if err != nil {
+			belogs.Error("removeRepoObjects(): RemoveAll fail, repoPath:", repoPath, err)
+			// no return
+		}
+		belogs.Info("removeRepoObjects(): caRepository:", caRepository, "  repoPath:", repoPath)
+	}
+}
+
+// rsync://host/path/ --> destPath/host/path/, path.Clean of "/"+path cannot be out of destPath.
+// empty when there is no host
+func getRepoLocalPath(destPath, caRepository string) string {
+	if !strings.HasPrefix(caRepository, "rsync://") {
+		return ""
+	}
+	hostPath := path.Clean("/" + strings.TrimPrefix(caRepository, "rsync://"))
+	if hostPath == "/" {
+		return ""
+	}
+	return filepath.Join(destPath, filepath.FromSlash(hostPath)) + string(os.PathSeparator)
+}
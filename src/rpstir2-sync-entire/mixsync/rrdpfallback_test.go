@@ -0,0 +1,114 @@
+package mixsync
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	model "rpstir2-model"
+)
+
+func TestGetRrdpFallbackBackoff(t *testing.T) {
+	tests := []struct {
+		failCount  uint64
+		backoff    time.Duration
+		maxBackoff time.Duration
+		want       time.Duration
+	}{
+		{1, 0, 0, 60 * time.Minute},
+		{2, 0, 0, 120 * time.Minute},
+		{5, 0, 0, 16 * 60 * time.Minute},
+		{6, 0, 0, 24 * 60 * time.Minute},
+		{100, 0, 0, 24 * 60 * time.Minute},
+		{1, 10 * time.Minute, 30 * time.Minute, 10 * time.Minute},
+		{3, 10 * time.Minute, 30 * time.Minute, 30 * time.Minute},
+		// max is less than backoff, so default max is used
+		{3, 10 * time.Minute, 5 * time.Minute, 40 * time.Minute},
+	}
+	for _, test := range tests {
+		got := getRrdpFallbackBackoff(test.failCount, test.backoff, test.maxBackoff)
+		if got != test.want {
+			t.Fatal("failCount:", test.failCount, "  backoff:", test.backoff, "  maxBackoff:", test.maxBackoff,
+				"  should be:", test.want, "  but:", got)
+		}
+	}
+}
+
+func TestRrdpFallbackUrls(t *testing.T) {
+	spQueue := &SyncParseQueue{
+		rrdpFallbackMutex:     new(sync.Mutex),
+		rrdpFallbacks:         make(map[string]model.LabRpkiSyncRrdpFallback),
+		rrdpFallbackUrls:      make(map[string][]SyncChan),
+		rrdpFallbackRsyncUrls: make(map[string]bool),
+		rrdpFinishedUrls:      make(map[string]bool),
+		rrdpCaRepositories:    make(map[string][]string),
+	}
+	notifyUrl := "https://rrdp.example.net/notification.xml"
+	okNotifyUrl := "https://rrdp.example.org/notification.xml"
+	if url := spQueue.GetSyncUrlWithFallback(notifyUrl, "rsync://example.net/repo/a/", "/tmp", 1); url != notifyUrl {
+		t.Fatal("should rrdp:", url)
+	}
+	spQueue.GetSyncUrlWithFallback(notifyUrl, "rsync://example.net/repo/b/", "/tmp", 1)
+	spQueue.GetSyncUrlWithFallback(okNotifyUrl, "rsync://example.org/repo/", "/tmp", 1)
+	if caRepositories := spQueue.getRrdpCaRepositories(notifyUrl); len(caRepositories) != 2 {
+		t.Fatal("should have 2 caRepositories:", caRepositories)
+	}
+
+	rrdpFallback, rsyncChans := spQueue.setRrdpFallback(notifyUrl, "timeout")
+	if rrdpFallback.FailCount != 1 || len(rsyncChans) != 2 || !rrdpFallback.NextRrdpTime.After(time.Now()) {
+		t.Fatal("should fall back to 2 rsync urls:", rrdpFallback, rsyncChans)
+	}
+	if !spQueue.isRrdpFallbackRsyncUrl("rsync://example.net/repo/a/") {
+		t.Fatal("rsync://example.net/repo/a/ should be fallback rsync url")
+	}
+	// still in backoff
+	if url := spQueue.GetSyncUrlWithFallback(notifyUrl, "rsync://example.net/repo/c/", "/tmp", 1); url != "rsync://example.net/repo/c/" {
+		t.Fatal("should rsync:", url)
+	}
+	rrdpFallback, _ = spQueue.setRrdpFallback(notifyUrl, "timeout")
+	if rrdpFallback.FailCount != 2 {
+		t.Fatal("failCount should be 2:", rrdpFallback.FailCount)
+	}
+
+	// rrdp is ok, caRepositories which are found later are not saved
+	if spQueue.clearRrdpFallback(okNotifyUrl) {
+		t.Fatal(okNotifyUrl, "did not fall back")
+	}
+	spQueue.GetSyncUrlWithFallback(okNotifyUrl, "rsync://example.org/repo/child/", "/tmp", 2)
+	if len(spQueue.rrdpFallbackUrls) != 0 {
+		t.Fatal("rrdpFallbackUrls should be empty:", spQueue.rrdpFallbackUrls)
+	}
+	// caRepositories which referenced notifyUrl are kept after rrdp finishes or falls back
+	spQueue.GetSyncUrlWithFallback(okNotifyUrl, "rsync://example.org/repo/", "/tmp", 2)
+	if caRepositories := spQueue.getRrdpCaRepositories(okNotifyUrl); len(caRepositories) != 2 {
+		t.Fatal("should have 2 caRepositories:", caRepositories)
+	}
+	if caRepositories := spQueue.getRrdpCaRepositories(notifyUrl); len(caRepositories) != 3 {
+		t.Fatal("should have 3 caRepositories:", caRepositories)
+	}
+	if !spQueue.clearRrdpFallback(notifyUrl) || len(spQueue.rrdpFallbacks) != 0 {
+		t.Fatal(notifyUrl, "should be cleared:", spQueue.rrdpFallbacks)
+	}
+}
+
+func TestGetRepoLocalPath(t *testing.T) {
+	destPath := filepath.Join(os.TempDir(), "rsyncrepo")
+	sep := string(os.PathSeparator)
+	tests := []struct {
+		caRepository string
+		want         string
+	}{
+		{"rsync://example.net/repo/a/", filepath.Join(destPath, "example.net", "repo", "a") + sep},
+		{"rsync://example.net/repo/../../../etc/", filepath.Join(destPath, "etc") + sep},
+		{"rsync://", ""},
+		{"https://example.net/repo/", ""},
+	}
+	for _, test := range tests {
+		got := getRepoLocalPath(destPath, test.caRepository)
+		if got != test.want {
+			t.Fatal(test.caRepository, "  should be:", test.want, "  but:", got)
+		}
+	}
+}
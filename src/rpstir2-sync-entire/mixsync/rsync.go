@@ -7,7 +7,7 @@ import (
 	"github.com/cpusoft/goutil/belogs"
 	"github.com/cpusoft/goutil/jsonutil"
 	"github.com/cpusoft/goutil/osutil"
-	"github.com/cpusoft/goutil/rsyncutil"
+	coresync "rpstir2-sync-core/sync"
 )
 
 func rsyncByUrl(spQueue *SyncParseQueue, syncChan SyncChan) {
@@ -26,12 +26,54 @@ func rsyncByUrl(spQueue *SyncParseQueue, syncChan SyncChan) {
 	// SyncingCount should +1 and then -1
 	atomic.AddInt64(&spQueue.SyncingCount, 1)
 	belogs.Debug("rsyncByUrl(): before rsync, syncChan:", syncChan, "    SyncingCount:", atomic.LoadInt64(&spQueue.SyncingCount))
-	rsyncutil.SetTimeout(24)
-	defer rsyncutil.ResetAllTimeout()
-	rsyncDestPath, _, err := rsyncutil.RsyncQuiet(syncChan.Url, syncChan.Dest)
+	var rsyncDestPath string
+	var downloadBytes uint64
+	var err error
+	if len(spQueue.replayRepoPath) > 0 {
+		rsyncDestPath, err = replayRsync(spQueue.replayRepoPath, syncChan)
+	} else {
+		rsyncDestPath, downloadBytes, err = rsyncByModule(spQueue, syncChan)
+	}
 	atomic.AddInt64(&spQueue.SyncingCount, -1)
 	belogs.Debug("rsyncByUrl(): rsync syncChan:", syncChan, "     SyncingCount:", atomic.LoadInt64(&spQueue.SyncingCount),
 		"     rsyncDestPath:", rsyncDestPath)
+	repoResult := coresync.RepoResult{
+		RepoUrl:     coresync.GetRsyncRepoUrl(syncChan.Url),
+		Protocol:    "rsync",
+		Ok:          err == nil,
+		AttemptTime: start,
+		Duration:    time.Since(start),
+		Bytes:       downloadBytes,
+	}
+	if spQueue.isRrdpFallbackRsyncUrl(syncChan.Url) {
+		repoResult.Protocol = "fallback"
+	}
+	if err == nil {
+		var countErr error
+		repoResult.ObjectCount, countErr = coresync.CountRsyncRepoObjects(rsyncDestPath)
+		if countErr != nil {
+			belogs.Error("rsyncByUrl():CountRsyncRepoObjects fail, rsyncDestPath:", rsyncDestPath, countErr)
+			// no return
+		}
+		err = coresync.CheckMaxObjectsPerRepo(repoResult.ObjectCount, coresync.GetMaxObjectsPerRepo())
+		if err != nil {
+			// objects of this repository are removed, so they will not be found as new files.
+			// child repositories in sub directories are kept, they are limited by themselves
+			belogs.Error("rsyncByUrl():CheckMaxObjectsPerRepo fail, will remove objects in rsyncDestPath:", rsyncDestPath, err)
+			if len(rsyncDestPath) > 0 {
+				removeErr := coresync.RemoveRsyncRepoObjects(rsyncDestPath)
+				if removeErr != nil {
+					belogs.Error("rsyncByUrl():RemoveRsyncRepoObjects fail, rsyncDestPath:", rsyncDestPath, removeErr)
+					// no return
+				}
+			}
+			repoResult.Ok = false
+		}
+	}
+	if err != nil {
+		repoResult.Error = err.Error()
+	}
+	spQueue.repoResults.AddRepoResult(repoResult)
 	if err != nil {
 		spQueue.SyncResult.FailUrls.Store(syncChan.Url, err.Error())
 		belogs.Error("rsyncByUrl():RsyncQuiet fail, syncChan.Url:", syncChan.Url, "   err:", err, "  time(s):", time.Since(start))
@@ -44,7 +86,7 @@ func rsyncByUrl(spQueue *SyncParseQueue, syncChan SyncChan) {
 
 	filePathNames := make([]string, 0)
 	filePathNames = append(filePathNames, rsyncDestPath)
-	parseChan := ParseChan{Url: syncChan.Url, FilePathNames: filePathNames}
+	parseChan := ParseChan{Url: syncChan.Url, FilePathNames: filePathNames, Depth: syncChan.Depth}
 	belogs.Debug("rsyncByUrl():before parseChan:", jsonutil.MarshalJson(parseChan), "   len(spQueue.ParseChan):", len(spQueue.ParseChan))
 	spQueue.ParseChan <- parseChan
 	belogs.Info("rsyncByUrl(): after parseChan:", jsonutil.MarshalJson(parseChan),
@@ -90,6 +132,6 @@ func parseRsyncCerFiles(spQueue *SyncParseQueue, parseChan ParseChan) {
 	}
 	belogs.Debug("parseRsyncCerFiles(): parseChan.Url:", parseChan.Url, "  cerFiles:", cerFiles)
 	belogs.Info("parseRrdpCerFiles():  parseChan.Url:", parseChan.Url, "  len(cerFiles):", len(cerFiles))
-	parseCerAndGetSubRepoUrlAndAddToSpQueue(spQueue, cerFiles)
+	parseCerAndGetSubRepoUrlAndAddToSpQueue(spQueue, parseChan, cerFiles)
 	belogs.Debug("parseRsyncCerFiles(): after parseCerAndGetSubRepoUrlAndAddToSpQueue cerFiles:", cerFiles)
 }
@@ -0,0 +1,116 @@
+package mixsync
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cpusoft/goutil/belogs"
+	"rpstir2-sync-core/rsyncclient"
+	coresync "rpstir2-sync-core/sync"
+)
+
+// it is replaced in tests
+var rsyncQuiet = rsyncclient.RsyncQuiet
+
+// rsync of rsync://host/module/, the first rsync url of this module starts it, and others wait for it
+type rsyncModuleBatch struct {
+	done        chan struct{}
+	rsyncResult rsyncclient.RsyncResult
+	err         error
+}
+
+// when rsync::batchByModule is true, rsync urls of directory are grouped by host/module, and one rsync of
+// rsync://host/module/ serves all of them. when rsync of module fails, not because of connection or timeout,
+// every rsync url is rsynced by itself. downloadBytes of module rsync are only returned to the rsync url which starts it
+func rsyncByModule(spQueue *SyncParseQueue, syncChan SyncChan) (rsyncDestPath string, downloadBytes uint64, err error) {
+	moduleUrl := coresync.GetRsyncRepoUrl(syncChan.Url)
+	if !spQueue.rsyncBatchByModule || !strings.HasSuffix(syncChan.Url, "/") ||
+		!strings.HasPrefix(syncChan.Url, moduleUrl) {
+		rsyncResult, err := rsyncByLimit(spQueue, syncChan)
+		return rsyncResult.RsyncDestPath, rsyncResult.DownloadBytes, err
+	}
+
+	key := syncChan.Dest + " " + moduleUrl
+	spQueue.rsyncModulesMutex.Lock()
+	batch, ok := spQueue.rsyncModules[key]
+	if !ok {
+		batch = &rsyncModuleBatch{done: make(chan struct{})}
+		spQueue.rsyncModules[key] = batch
+	}
+	spQueue.rsyncModulesMutex.Unlock()
+	if !ok {
+		belogs.Info("rsyncByModule(): will rsync module:", moduleUrl, "  for url:", syncChan.Url)
+		batch.rsyncResult, batch.err = rsyncByLimit(spQueue, SyncChan{Url: moduleUrl, Dest: syncChan.Dest, Depth: syncChan.Depth})
+		downloadBytes = batch.rsyncResult.DownloadBytes
+		close(batch.done)
+	} else {
+		belogs.Debug("rsyncByModule(): wait for rsync of module:", moduleUrl, "  for url:", syncChan.Url)
+		<-batch.done
+	}
+
+	if batch.err != nil {
+		if errors.Is(batch.err, rsyncclient.ErrRsyncConnect) || errors.Is(batch.err, rsyncclient.ErrRsyncTimeout) {
+			return "", downloadBytes, batch.err
+		}
+		belogs.Error("rsyncByModule(): rsync of module fail, will rsync url by itself:", moduleUrl, syncChan.Url, batch.err)
+		rsyncResult, err := rsyncByLimit(spQueue, syncChan)
+		return rsyncResult.RsyncDestPath, downloadBytes + rsyncResult.DownloadBytes, err
+	}
+	// path.Clean of "/"+path cannot be out of module
+	subPath := path.Clean("/" + strings.TrimPrefix(syncChan.Url, moduleUrl))
+	rsyncDestPath = filepath.Join(batch.rsyncResult.RsyncDestPath, filepath.FromSlash(subPath)) + string(os.PathSeparator)
+	belogs.Debug("rsyncByModule(): url:", syncChan.Url, "  is in module:", moduleUrl, "  rsyncDestPath:", rsyncDestPath)
+	return rsyncDestPath, downloadBytes, nil
+}
+
+// rsync is limited by rsync::rsyncConcurrentCount and rsync::rsyncConcurrentCountPerHost,
+// and sync::maxRepoSyncMinutes is from when it starts
+func rsyncByLimit(spQueue *SyncParseQueue, syncChan SyncChan) (rsyncResult rsyncclient.RsyncResult, err error) {
+	release := spQueue.acquireRsync(getRsyncHost(syncChan.Url))
+	defer release()
+
+	start := time.Now()
+	rsyncResult, err = rsyncQuiet(syncChan.Url, syncChan.Dest, getRepoSyncDeadline(start))
+	belogs.Debug("rsyncByLimit(): url:", syncChan.Url, "  rsyncDestPath:", rsyncResult.RsyncDestPath,
+		"  downloadBytes:", rsyncResult.DownloadBytes, "  time(s):", time.Since(start), err)
+	return rsyncResult, err
+}
+
+// limit of host is got first, so waiting for one host does not hold global limit
+func (r *SyncParseQueue) acquireRsync(host string) (release func()) {
+	var hostLimit chan struct{}
+	if r.rsyncConcurrentCountPerHost > 0 {
+		r.rsyncHostLimitMutex.Lock()
+		hostLimit = r.rsyncHostLimits[host]
+		if hostLimit == nil {
+			hostLimit = make(chan struct{}, r.rsyncConcurrentCountPerHost)
+			r.rsyncHostLimits[host] = hostLimit
+		}
+		r.rsyncHostLimitMutex.Unlock()
+		hostLimit <- struct{}{}
+	}
+	if r.rsyncLimit != nil {
+		r.rsyncLimit <- struct{}{}
+	}
+	return func() {
+		if r.rsyncLimit != nil {
+			<-r.rsyncLimit
+		}
+		if hostLimit != nil {
+			<-hostLimit
+		}
+	}
+}
+
+// rsync://host/module/path --> host
+func getRsyncHost(rsyncUrl string) string {
+	host := strings.TrimPrefix(rsyncUrl, "rsync://")
+	if i := strings.Index(host, "/"); i >= 0 {
+		host = host[:i]
+	}
+	return host
+}
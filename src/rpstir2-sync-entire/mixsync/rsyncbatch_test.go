@@ -0,0 +1,157 @@
+package mixsync
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"rpstir2-sync-core/rsyncclient"
+)
+
+func newTestRsyncQueue(batchByModule bool, rsyncConcurrentCount, rsyncConcurrentCountPerHost int) *SyncParseQueue {
+	spq := &SyncParseQueue{
+		rsyncBatchByModule:          batchByModule,
+		rsyncModulesMutex:           new(sync.Mutex),
+		rsyncModules:                make(map[string]*rsyncModuleBatch),
+		rsyncConcurrentCountPerHost: rsyncConcurrentCountPerHost,
+		rsyncHostLimitMutex:         new(sync.Mutex),
+		rsyncHostLimits:             make(map[string]chan struct{}),
+	}
+	if rsyncConcurrentCount > 0 {
+		spq.rsyncLimit = make(chan struct{}, rsyncConcurrentCount)
+	}
+	return spq
+}
+
+// rsyncQuiet is replaced, rsync of url in failUrls returns its error
+func stubRsyncQuiet(t *testing.T, failUrls map[string]error) (rsyncUrls *[]string) {
+	var mutex sync.Mutex
+	rsyncUrls = &[]string{}
+	old := rsyncQuiet
+	rsyncQuiet = func(rsyncUrl string, destPath string, deadline time.Time) (rsyncclient.RsyncResult, error) {
+		mutex.Lock()
+		*rsyncUrls = append(*rsyncUrls, rsyncUrl)
+		mutex.Unlock()
+		if err := failUrls[rsyncUrl]; err != nil {
+			return rsyncclient.RsyncResult{}, err
+		}
+		return rsyncclient.RsyncResult{RsyncDestPath: destPath + strings.TrimPrefix(rsyncUrl, "rsync://"),
+			DownloadBytes: 100}, nil
+	}
+	t.Cleanup(func() { rsyncQuiet = old })
+	return rsyncUrls
+}
+
+func TestRsyncByModule(t *testing.T) {
+	rsyncUrls := stubRsyncQuiet(t, nil)
+	spq := newTestRsyncQueue(true, 0, 0)
+
+	urls := []string{"rsync://example.net/repo/ca1/", "rsync://example.net/repo/ca1/child1/", "rsync://example.net/repo/ca2/"}
+	rsyncDestPaths := make([]string, len(urls))
+	downloadBytes := make([]uint64, len(urls))
+	var wg sync.WaitGroup
+	for i := range urls {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			rsyncDestPaths[i], downloadBytes[i], err = rsyncByModule(spq, SyncChan{Url: urls[i], Dest: "/rsync/"})
+			if err != nil {
+				t.Error(urls[i], err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// only one rsync of module, and its downloadBytes are returned once
+	if len(*rsyncUrls) != 1 || (*rsyncUrls)[0] != "rsync://example.net/repo/" {
+		t.Fatal("should only rsync module:", *rsyncUrls)
+	}
+	if downloadBytes[0]+downloadBytes[1]+downloadBytes[2] != 100 {
+		t.Fatal("downloadBytes of module should be returned once:", downloadBytes)
+	}
+	for i := range urls {
+		if rsyncDestPaths[i] != "/rsync/"+strings.TrimPrefix(urls[i], "rsync://") {
+			t.Fatal(urls[i], "rsyncDestPath should be in module:", rsyncDestPaths[i])
+		}
+	}
+
+	// other dest is another module rsync, file url is rsynced by itself
+	rsyncByModule(spq, SyncChan{Url: "rsync://example.net/repo/ca1/", Dest: "/rsync/root/"})
+	rsyncByModule(spq, SyncChan{Url: "rsync://example.net/repo/ta.cer", Dest: "/rsync/root/"})
+	if fmt.Sprint(*rsyncUrls) != "[rsync://example.net/repo/ rsync://example.net/repo/ rsync://example.net/repo/ta.cer]" {
+		t.Fatal("should rsync module of other dest and file url:", *rsyncUrls)
+	}
+
+	// not batchByModule
+	*rsyncUrls = (*rsyncUrls)[:0]
+	rsyncByModule(newTestRsyncQueue(false, 0, 0), SyncChan{Url: "rsync://example.net/repo/ca1/", Dest: "/rsync/"})
+	if fmt.Sprint(*rsyncUrls) != "[rsync://example.net/repo/ca1/]" {
+		t.Fatal("should rsync url by itself:", *rsyncUrls)
+	}
+}
+
+func TestRsyncByModuleFallback(t *testing.T) {
+	// module is not permitted, every url is rsynced by itself
+	rsyncUrls := stubRsyncQuiet(t, map[string]error{"rsync://example.net/repo/": errors.New("module is not permitted")})
+	spq := newTestRsyncQueue(true, 0, 0)
+	for _, url := range []string{"rsync://example.net/repo/ca1/", "rsync://example.net/repo/ca2/"} {
+		rsyncDestPath, _, err := rsyncByModule(spq, SyncChan{Url: url, Dest: "/rsync/"})
+		if err != nil || rsyncDestPath != "/rsync/"+strings.TrimPrefix(url, "rsync://") {
+			t.Fatal(url, "should be rsynced by itself:", rsyncDestPath, err)
+		}
+	}
+	if fmt.Sprint(*rsyncUrls) != "[rsync://example.net/repo/ rsync://example.net/repo/ca1/ rsync://example.net/repo/ca2/]" {
+		t.Fatal("should rsync module once and every url:", *rsyncUrls)
+	}
+
+	// connection fails, url is not rsynced again
+	rsyncUrls = stubRsyncQuiet(t, map[string]error{"rsync://example.org/repo/": fmt.Errorf("%w: example.org", rsyncclient.ErrRsyncConnect)})
+	_, _, err := rsyncByModule(spq, SyncChan{Url: "rsync://example.org/repo/ca1/", Dest: "/rsync/"})
+	if !errors.Is(err, rsyncclient.ErrRsyncConnect) || len(*rsyncUrls) != 1 {
+		t.Fatal("should not rsync url after connection fails:", *rsyncUrls, err)
+	}
+}
+
+func TestAcquireRsync(t *testing.T) {
+	spq := newTestRsyncQueue(false, 2, 1)
+	releaseA1 := spq.acquireRsync("a.example.net")
+
+	// a2 waits for limit of host a, and does not hold global limit
+	acquiredA2 := make(chan func())
+	go func() {
+		acquiredA2 <- spq.acquireRsync("a.example.net")
+	}()
+	time.Sleep(50 * time.Millisecond)
+	acquiredB := make(chan func())
+	go func() {
+		acquiredB <- spq.acquireRsync("b.example.net")
+	}()
+	var releaseB func()
+	select {
+	case releaseB = <-acquiredB:
+	case <-time.After(time.Second):
+		t.Fatal("b should not wait for a")
+	}
+	select {
+	case <-acquiredA2:
+		t.Fatal("a2 should wait for a1")
+	default:
+	}
+
+	// a1 releases both limits, then a2 gets them
+	releaseA1()
+	select {
+	case releaseA2 := <-acquiredA2:
+		releaseA2()
+	case <-time.After(time.Second):
+		t.Fatal("a2 should get limit after a1")
+	}
+	releaseB()
+	if len(spq.rsyncLimit) != 0 || len(spq.rsyncHostLimits["a.example.net"]) != 0 {
+		t.Fatal("all limits should be released")
+	}
+}
@@ -3,6 +3,8 @@ package mixsync
 import (
 	"errors"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -42,7 +44,7 @@ func syncStart(syncStyle model.SyncStyle) (nextStep string, err error) {
 	belogs.Debug("syncStart(): len(talModels):", len(talModels))
 
 	// call rrdp and rsync and wait for result
-	err = callSync(syncLogId, talModels, &syncState)
+	err = callSync(syncLogId, talModels, &syncState, "")
 	if err != nil {
 		belogs.Error("syncStart():callSync fail:", err)
 		return "", err
@@ -81,9 +83,11 @@ func getTals() (talModels []model.TalModel, err error) {
 	return talModelsResponse.TalModels, nil
 }
 
-func callSync(syncLogId uint64, talModels []model.TalModel, syncState *coremodel.SyncState) (err error) {
+// replayRepoPath is local repository archive of replay sync, or empty
+func callSync(syncLogId uint64, talModels []model.TalModel, syncState *coremodel.SyncState, replayRepoPath string) (err error) {
 	start := time.Now()
-	belogs.Info("callSync(): syncLogId:", syncLogId, "   talModels:", jsonutil.MarshalJson(talModels))
+	belogs.Info("callSync(): syncLogId:", syncLogId, "   talModels:", jsonutil.MarshalJson(talModels),
+		"   replayRepoPath:", replayRepoPath)
 
 	// will call rrdp and sync
 	if len(talModels) == 0 {
@@ -97,10 +101,19 @@ func callSync(syncLogId uint64, talModels []model.TalModel, syncState *coremodel
 		return
 	}
 
+	// rrdp which fell back to rsync and is still in backoff
+	rrdpFallbacks, err := rrdp.GetRrdpFallbacksDb()
+	if err != nil {
+		belogs.Error("callSync(): rrdp: GetRrdpFallbacksDb fail:", err)
+		return
+	}
+
 	//start spQueue
 	spQueue := NewSyncParseQueue()
 	spQueue.LastSyncRrdpLogs = syncRrdpLogs
+	spQueue.rrdpFallbacks = rrdpFallbacks
 	spQueue.LabRpkiSyncLogId = syncLogId
+	spQueue.replayRepoPath = replayRepoPath
 	belogs.Debug("callSync(): before startRrdpServer spQueue:", jsonutil.MarshalJson(*spQueue))
 
 	var syncServerWg sync.WaitGroup
@@ -113,11 +126,19 @@ func callSync(syncLogId uint64, talModels []model.TalModel, syncState *coremodel
 	// otherwise, will have to load all root file manually
 	os.RemoveAll(conf.String("rrdp::destPath") + "/root/")
 	os.MkdirAll(conf.String("rrdp::destPath")+"/root/", os.ModePerm)
+	// root cer of replay is copied to rsync destPath, so it will be found by FoundDiffFiles
+	rootDestPath := conf.String("rrdp::destPath") + "/"
+	if len(replayRepoPath) > 0 {
+		rootDestPath = conf.String("rsync::destPath") + "/"
+	}
 	for _, talModel := range talModels {
 		for _, talSyncUrl := range talModel.TalSyncUrls {
 			url := ""
 			if talSyncUrl.SupportRrdp && len(talSyncUrl.RrdpUrl) > 0 {
 				url = talSyncUrl.RrdpUrl
+				if talSyncUrl.SupportRsync && len(talSyncUrl.RsyncUrl) > 0 {
+					url = spQueue.GetSyncUrlWithFallback(talSyncUrl.RrdpUrl, talSyncUrl.RsyncUrl, conf.String("rrdp::destPath")+"/", 0)
+				}
 			} else {
 				if talSyncUrl.SupportRsync && len(talSyncUrl.RsyncUrl) > 0 {
 					url = talSyncUrl.RsyncUrl
@@ -126,7 +147,7 @@ func callSync(syncLogId uint64, talModels []model.TalModel, syncState *coremodel
 			if len(url) > 0 {
 				atomic.AddInt64(&spQueue.SyncingAndParsingCount, int64(1))
 				belogs.Info("callSync(): will add url:", url, "   current SyncingAndParsingCount:", atomic.LoadInt64(&spQueue.SyncingAndParsingCount))
-				go spQueue.AddSyncUrl(url, conf.String("rrdp::destPath")+"/")
+				go spQueue.AddSyncUrl(url, rootDestPath, 0)
 			}
 		}
 	}
@@ -135,20 +156,44 @@ func callSync(syncLogId uint64, talModels []model.TalModel, syncState *coremodel
 	return nil
 }
 
-// call from parseRrdpCerFiles and parseRsyncCerFiles
-func parseCerAndGetSubRepoUrlAndAddToSpQueue(spQueue *SyncParseQueue, cerFiles []string) {
+// call from parseRrdpCerFiles and parseRsyncCerFiles, cerFiles are in repository of parseChan.Url.
+// sub repositories are not added when depth is more than limit, and only limited count of them of every ca are added
+func parseCerAndGetSubRepoUrlAndAddToSpQueue(spQueue *SyncParseQueue, parseChan ParseChan, cerFiles []string) {
 	// foreach every cerfiles to parseCerAndGetSubRepoUrl
 	belogs.Debug("parseCerAndGetSubRepoUrlAndAddToSpQueue():cerFiles:", cerFiles)
 
 	subRepoUrls := make([]string, 0, len(cerFiles))
+	depth := parseChan.Depth + 1
+	maxCaDepth := getMaxCaDepth()
+	if maxCaDepth > 0 && depth > maxCaDepth {
+		reason := "depth " + strconv.FormatUint(depth, 10) + " of sub repositories is more than limit " +
+			strconv.FormatUint(maxCaDepth, 10)
+		spQueue.SyncResult.LimitUrls.Store(parseChan.Url, reason)
+		belogs.Error("parseCerAndGetSubRepoUrlAndAddToSpQueue(): url:", parseChan.Url, "  ", reason)
+		cerFiles = nil
+	}
+	existed := make(map[string]bool)
+	maxChildRepos := getMaxChildReposPerCa()
 	for _, cerFile := range cerFiles {
 		// just trigger sync ,no need save to db, ignore err
-		subRepoUrl, _ := parseCerAndGetSubRepoUrl(spQueue, cerFile)
-		if len(subRepoUrl) > 0 {
-			subRepoUrls = append(subRepoUrls, subRepoUrl)
-		} else {
+		subRepoUrl, _ := parseCerAndGetSubRepoUrl(spQueue, cerFile, depth)
+		if len(subRepoUrl) == 0 {
 			belogs.Error("parseCerAndGetSubRepoUrlAndAddToSpQueue(): this file has no subRepoUrl:", cerFile)
+			continue
+		}
+		if existed[subRepoUrl] {
+			continue
 		}
+		// cerFiles may be of more than one ca, sub repositories are limited by ca which issued cerFile
+		caPath := filepath.Dir(cerFile)
+		if !spQueue.childRepos.addChildRepo(caPath, subRepoUrl, maxChildRepos) {
+			reason := "count of sub repositories of " + caPath + " is more than limit " + strconv.FormatUint(maxChildRepos, 10)
+			spQueue.SyncResult.LimitUrls.Store(parseChan.Url, reason)
+			belogs.Error("parseCerAndGetSubRepoUrlAndAddToSpQueue(): url:", parseChan.Url, "  ", reason, "  ignore:", subRepoUrl)
+			continue
+		}
+		existed[subRepoUrl] = true
+		subRepoUrls = append(subRepoUrls, subRepoUrl)
 	}
 	belogs.Debug("parseCerAndGetSubRepoUrlAndAddToSpQueue():cerFiles:", cerFiles, "  subRepoUrls:", subRepoUrls)
 
@@ -171,12 +216,12 @@ func parseCerAndGetSubRepoUrlAndAddToSpQueue(spQueue *SyncParseQueue, cerFiles [
 
 	// call add notifies to rsyncqueue
 	if len(subRepoUrls) > 0 {
-		addSubRepoUrlsToSpQueue(spQueue, subRepoUrls)
+		addSubRepoUrlsToSpQueue(spQueue, subRepoUrls, depth)
 	}
 }
 
 // call /parsevalidate/parse to parse cert, and save result
-func parseCerAndGetSubRepoUrl(spQueue *SyncParseQueue, cerFile string) (subRepoUrl string, err error) {
+func parseCerAndGetSubRepoUrl(spQueue *SyncParseQueue, cerFile string, depth uint64) (subRepoUrl string, err error) {
 
 	// call parse, not need to save body to db
 	start := time.Now()
@@ -190,10 +235,19 @@ func parseCerAndGetSubRepoUrl(spQueue *SyncParseQueue, cerFile string) (subRepoU
 		return "", err
 	}
 
-	// get the sub repo url in cer, and send it to rpqueue
+	// get the sub repo url in cer, and send it to rpqueue.
+	// caRepository is kept to fallback when rrdp fails, or is used when rrdp is in backoff
 	subRepoUrl = strings.TrimSpace(parseCerSimple.RpkiNotify)
+	caRepository := strings.TrimSpace(parseCerSimple.CaRepository)
+	if len(spQueue.replayRepoPath) > 0 {
+		// repository archive of replay is laid out by rsync url
+		subRepoUrl = ""
+	}
+	if len(subRepoUrl) > 0 && len(caRepository) > 0 {
+		subRepoUrl = spQueue.GetSyncUrlWithFallback(subRepoUrl, caRepository, conf.String("rsync::destPath")+"/", depth)
+	}
 	if len(subRepoUrl) == 0 {
-		subRepoUrl = strings.TrimSpace(parseCerSimple.CaRepository)
+		subRepoUrl = caRepository
 	}
 	if len(subRepoUrl) == 0 {
 		belogs.Error("parseCerAndGetSubRepoUrl(): all rsyncUrl or rrdpUrl is empty:", cerFile, jsonutil.MarshalJson(parseCerSimple))
@@ -206,7 +260,7 @@ func parseCerAndGetSubRepoUrl(spQueue *SyncParseQueue, cerFile string) (subRepoU
 
 }
 
-func addSubRepoUrlsToSpQueue(spQueue *SyncParseQueue, subRepoUrls []string) {
+func addSubRepoUrlsToSpQueue(spQueue *SyncParseQueue, subRepoUrls []string, depth uint64) {
 	rsyncDestPath := conf.String("rsync::destPath") + "/"
 	rrdpDestPath := conf.String("rrdp::destPath") + "/"
 
@@ -232,6 +286,6 @@ func addSubRepoUrlsToSpQueue(spQueue *SyncParseQueue, subRepoUrls []string) {
 			continue
 		}
 		belogs.Info("addSubRepoUrlsToSpQueue():will AddSyncUrl subRepoUrl: ", subRepoUrl, "  destPath:", destPath)
-		go spQueue.AddSyncUrl(subRepoUrl, destPath)
+		go spQueue.AddSyncUrl(subRepoUrl, destPath, depth)
 	}
 }
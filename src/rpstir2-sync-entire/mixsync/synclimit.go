@@ -0,0 +1,69 @@
+package mixsync
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cpusoft/goutil/conf"
+)
+
+// limits of every repository in [sync] of project.conf, 0 is no limit
+
+func getMaxCaDepth() uint64 {
+	maxCaDepth := conf.Int("sync::maxCaDepth")
+	if maxCaDepth <= 0 {
+		return 0
+	}
+	return uint64(maxCaDepth)
+}
+
+func getMaxChildReposPerCa() uint64 {
+	maxChildRepos := conf.Int("sync::maxChildReposPerCa")
+	if maxChildRepos <= 0 {
+		return 0
+	}
+	return uint64(maxChildRepos)
+}
+
+// caPath --> sub repositories of the ca in this sync, caPath is the directory of cer files of sub repositories.
+// cer files of one ca may be parsed in more than one batch, so sub repositories are counted across batches
+type childRepos struct {
+	mutex *sync.Mutex
+	repos map[string]map[string]bool
+}
+
+func newChildRepos() *childRepos {
+	return &childRepos{
+		mutex: new(sync.Mutex),
+		repos: make(map[string]map[string]bool),
+	}
+}
+
+// return false when count of sub repositories of caPath is more than maxChildRepos, 0 is no limit.
+// the sub repository which has been added is always ok
+func (c *childRepos) addChildRepo(caPath string, subRepoUrl string, maxChildRepos uint64) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	subRepoUrls, ok := c.repos[caPath]
+	if !ok {
+		subRepoUrls = make(map[string]bool)
+		c.repos[caPath] = subRepoUrls
+	}
+	if subRepoUrls[subRepoUrl] {
+		return true
+	}
+	if maxChildRepos > 0 && uint64(len(subRepoUrls)) >= maxChildRepos {
+		return false
+	}
+	subRepoUrls[subRepoUrl] = true
+	return true
+}
+
+// zero is no limit
+func getRepoSyncDeadline(start time.Time) time.Time {
+	maxMinutes := conf.Int("sync::maxRepoSyncMinutes")
+	if maxMinutes <= 0 {
+		return time.Time{}
+	}
+	return start.Add(time.Duration(maxMinutes) * time.Minute)
+}
@@ -0,0 +1,31 @@
+package mixsync
+
+import (
+	"testing"
+)
+
+func TestAddChildRepo(t *testing.T) {
+	c := newChildRepos()
+	// batch 1 of ca1
+	if !c.addChildRepo("/rsync/example.net/repo/ca1", "rsync://example.net/repo/ca1/child1/", 2) ||
+		!c.addChildRepo("/rsync/example.net/repo/ca1", "rsync://example.net/repo/ca1/child2/", 2) {
+		t.Fatal("should be added")
+	}
+	// batch 2 of ca1, added one is still ok, and new one is more than limit
+	if !c.addChildRepo("/rsync/example.net/repo/ca1", "rsync://example.net/repo/ca1/child1/", 2) {
+		t.Fatal("added one should be ok")
+	}
+	if c.addChildRepo("/rsync/example.net/repo/ca1", "rsync://example.net/repo/ca1/child3/", 2) {
+		t.Fatal("should be more than limit")
+	}
+	// other ca in the same batch has its own limit
+	if !c.addChildRepo("/rsync/example.net/repo/ca1/child1", "rsync://example.net/repo/ca1/child1/sub1/", 2) {
+		t.Fatal("should be added")
+	}
+	// 0 is no limit
+	for _, subRepoUrl := range []string{"rsync://example.org/a/", "rsync://example.org/b/", "rsync://example.org/c/"} {
+		if !c.addChildRepo("/rsync/example.org/repo", subRepoUrl, 0) {
+			t.Fatal("should be no limit:", subRepoUrl)
+		}
+	}
+}
@@ -11,6 +11,8 @@ import (
 	"github.com/cpusoft/goutil/conf"
 	"github.com/cpusoft/goutil/jsonutil"
 	model "rpstir2-model"
+	"rpstir2-sync-core/repopolicy"
+	coresync "rpstir2-sync-core/sync"
 )
 
 // queue for rrdp url of notify.xml
@@ -43,6 +45,39 @@ type SyncParseQueue struct {
 
 	// last saved syncRrdpLogs
 	LastSyncRrdpLogs map[string]model.LabRpkiSyncRrdpLog
+
+	// notifyUrl --> rrdp which fell back to rsync, and notifyUrl --> rsync urls(caRepository) of the same publication point
+	rrdpFallbackMutex *sync.Mutex
+	rrdpFallbacks     map[string]model.LabRpkiSyncRrdpFallback
+	rrdpFallbackUrls  map[string][]SyncChan
+	// rsync urls which rsync instead of rrdp
+	rrdpFallbackRsyncUrls map[string]bool
+	// notifyUrls whose rrdp has finished in this sync, caRepositories of them are not saved any more
+	rrdpFinishedUrls map[string]bool
+	// notifyUrl --> caRepositories of cas which referenced it in this sync, rrdp can only write objects in them
+	rrdpCaRepositories map[string][]string
+	// rrdp::fallbackBackoffMinutes and rrdp::fallbackMaxBackoffMinutes
+	rrdpFallbackBackoff    time.Duration
+	rrdpFallbackMaxBackoff time.Duration
+
+	// repoUrl --> result of repository in this sync, will save to lab_rpki_sync_repo at the end
+	repoResults *coresync.RepoResults
+
+	// caPath --> sub repositories of the ca in this sync, limited by sync::maxChildReposPerCa
+	childRepos *childRepos
+
+	// replay sync copies rsync urls from this local repository archive, instead of network
+	replayRepoPath string
+
+	// dest and rsync://host/module/ --> rsync of this module, which serves all rsync urls in it
+	rsyncBatchByModule bool
+	rsyncModulesMutex  *sync.Mutex
+	rsyncModules       map[string]*rsyncModuleBatch
+	// limit of concurrent rsync, and host --> limit of concurrent rsync of this host. nil or 0 is no limit
+	rsyncLimit                  chan struct{}
+	rsyncConcurrentCountPerHost int
+	rsyncHostLimitMutex         *sync.Mutex
+	rsyncHostLimits             map[string]chan struct{}
 }
 
 func NewSyncParseQueue() *SyncParseQueue {
@@ -57,9 +92,35 @@ func NewSyncParseQueue() *SyncParseQueue {
 	spq.syncUrlsMutex = new(sync.RWMutex)
 	spq.syncUrls = list.New()
 
+	spq.rrdpFallbackMutex = new(sync.Mutex)
+	spq.rrdpFallbacks = make(map[string]model.LabRpkiSyncRrdpFallback)
+	spq.rrdpFallbackUrls = make(map[string][]SyncChan)
+	spq.rrdpFallbackRsyncUrls = make(map[string]bool)
+	spq.rrdpFinishedUrls = make(map[string]bool)
+	spq.rrdpCaRepositories = make(map[string][]string)
+	spq.rrdpFallbackBackoff = time.Duration(conf.Int("rrdp::fallbackBackoffMinutes")) * time.Minute
+	spq.rrdpFallbackMaxBackoff = time.Duration(conf.Int("rrdp::fallbackMaxBackoffMinutes")) * time.Minute
+
+	spq.repoResults = coresync.NewRepoResults()
+	spq.childRepos = newChildRepos()
+
+	spq.rsyncBatchByModule = conf.Bool("rsync::batchByModule")
+	spq.rsyncModulesMutex = new(sync.Mutex)
+	spq.rsyncModules = make(map[string]*rsyncModuleBatch)
+	if rsyncConcurrentCount := conf.Int("rsync::rsyncConcurrentCount"); rsyncConcurrentCount > 0 {
+		spq.rsyncLimit = make(chan struct{}, rsyncConcurrentCount)
+	}
+	spq.rsyncConcurrentCountPerHost = conf.Int("rsync::rsyncConcurrentCountPerHost")
+	spq.rsyncHostLimitMutex = new(sync.Mutex)
+	spq.rsyncHostLimits = make(map[string]chan struct{})
+
 	spq.SyncResult.StartTime = time.Now()
 	spq.SyncResult.OkUrls = make([]string, 0, 100000)
 	spq.SyncResult.FailUrls = jsonutil.JsonSyncMap{}
+	spq.SyncResult.FallbackUrls = jsonutil.JsonSyncMap{}
+	spq.SyncResult.RrdpUriErrors = jsonutil.JsonSyncMap{}
+	spq.SyncResult.LimitUrls = jsonutil.JsonSyncMap{}
+	spq.SyncResult.DenyUrls = jsonutil.JsonSyncMap{}
 	spq.SyncResult.FailParseValidateCerts = jsonutil.JsonSyncMap{}
 	belogs.Debug("NewQueue():spq:", jsonutil.MarshalJson(spq))
 	return spq
@@ -73,7 +134,19 @@ func (r *SyncParseQueue) Close() {
 	r.syncUrls = nil
 	r.SyncResult.OkUrls = nil
 	r.SyncResult.FailUrls = jsonutil.JsonSyncMap{}
+	r.SyncResult.FallbackUrls = jsonutil.JsonSyncMap{}
+	r.SyncResult.RrdpUriErrors = jsonutil.JsonSyncMap{}
+	r.SyncResult.LimitUrls = jsonutil.JsonSyncMap{}
+	r.SyncResult.DenyUrls = jsonutil.JsonSyncMap{}
 	r.SyncResult.FailParseValidateCerts = jsonutil.JsonSyncMap{}
+	r.rrdpFallbackUrls = nil
+	r.rrdpFallbackRsyncUrls = nil
+	r.rrdpFinishedUrls = nil
+	r.rrdpCaRepositories = nil
+	r.repoResults = nil
+	r.childRepos = nil
+	r.rsyncModules = nil
+	r.rsyncHostLimits = nil
 	r = nil
 
 }
@@ -88,16 +161,10 @@ func (r *SyncParseQueue) PreCheckSyncUrl(url string) (ok bool) {
 		belogs.Error("PreCheckSyncUrl():url  is 0")
 		return false
 	}
-	if strings.HasPrefix(url, "rrdp://localhost") || strings.HasPrefix(url, "rrdp://127.0.0.1") ||
-		strings.HasPrefix(url, "https://localhost") || strings.HasPrefix(url, "https://127.0.0.1") ||
-		strings.HasPrefix(url, "http://localhost") || strings.HasPrefix(url, "http://127.0.0.1") ||
-		strings.HasPrefix(url, "rsync://localhost") || strings.HasPrefix(url, "rsync://127.0.0.1") {
-		belogs.Error("PreCheckSyncUrl():url is localhost:", url)
-		return false
-	}
-
-	if strings.Index(url, "ca.rg.net/rrdp/notify.xml") > 0 {
-		belogs.Error("PreCheckSyncUrl():this url is not rrdp url, so just ignore:", url)
+	// such as localhost, by sync::repoPolicyFile
+	if allow, reason := repopolicy.CheckRepoUrl(url); !allow {
+		r.SyncResult.DenyUrls.Store(url, reason)
+		belogs.Error("PreCheckSyncUrl():url is denied:", url, "  ", reason)
 		return false
 	}
 
@@ -119,9 +186,9 @@ func (r *SyncParseQueue) PreCheckSyncUrl(url string) (ok bool) {
 	return true
 }
 
-// add resync url
+// add resync url, depth is depth of ca which has this url
 // if have error, should set SyncingAndParsingCount-1
-func (r *SyncParseQueue) AddSyncUrl(url string, dest string) {
+func (r *SyncParseQueue) AddSyncUrl(url string, dest string, depth uint64) {
 
 	r.syncUrlsMutex.Lock()
 	defer r.syncUrlsMutex.Unlock()
@@ -131,7 +198,7 @@ func (r *SyncParseQueue) AddSyncUrl(url string, dest string) {
 			r.SyncAndParseEndChan <- SyncAndParseEndChan{}
 		}
 	}()
-	belogs.Debug("AddSyncUrl():url:", url, "    dest:", dest)
+	belogs.Debug("AddSyncUrl():url:", url, "    dest:", dest, "    depth:", depth)
 	if len(url) == 0 || len(dest) == 0 {
 		belogs.Error("AddSyncUrl():len(url) == 0 || len(dest) == 0, before SyncingAndParsingCount-1:", atomic.LoadInt64(&r.SyncingAndParsingCount))
 		atomic.AddInt64(&r.SyncingAndParsingCount, -1)
@@ -152,7 +219,7 @@ func (r *SyncParseQueue) AddSyncUrl(url string, dest string) {
 		e = e.Next()
 	}
 
-	syncChan := SyncChan{Url: url, Dest: dest}
+	syncChan := SyncChan{Url: url, Dest: dest, Depth: depth}
 	e = r.syncUrls.PushBack(syncChan)
 	belogs.Info("AddSyncUrl():will send to syncChan:", syncChan,
 		"   len(syncUrls):", r.syncUrls.Len())
@@ -174,16 +241,18 @@ func (r *SyncParseQueue) GetSyncUrls() (urls []string) {
 	return urls
 }
 
-// rrdp channel
+// rrdp channel, depth of url in tal is 0
 type SyncChan struct {
-	Url  string `json:"url"`
-	Dest string `jsong:"dest"`
+	Url   string `json:"url"`
+	Dest  string `jsong:"dest"`
+	Depth uint64 `json:"depth"`
 }
 
 // parse channel
 type ParseChan struct {
 	Url           string   `json:"url"`
 	FilePathNames []string `json:"filePathNames"`
+	Depth         uint64   `json:"depth"`
 }
 
 // rrdp and parse end channel, may be end
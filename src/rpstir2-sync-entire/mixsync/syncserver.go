@@ -67,6 +67,15 @@ func startSyncServer(spQueue *SyncParseQueue, syncState *coremodel.SyncState, sy
 			syncState.SyncResult = spQueue.SyncResult
 			belogs.Debug("startSyncServer():syncState:", jsonutil.MarshalJson(syncState))
 
+			// health of repositories, replay is not health of live repositories
+			if len(spQueue.replayRepoPath) == 0 {
+				err = saveSyncRepos(spQueue)
+				if err != nil {
+					belogs.Error("startSyncServer(): saveSyncRepos fail:", err)
+					// no return
+				}
+			}
+
 			// close spQueue
 			if !spQueue.IsClose() {
 				spQueue.Close()
@@ -15,6 +15,7 @@ import (
 	"github.com/cpusoft/goutil/randutil"
 	model "rpstir2-model"
 	"rpstir2-sync-core/rrdp"
+	coresync "rpstir2-sync-core/sync"
 )
 
 var rrQueue *RrdpParseQueue
@@ -75,6 +76,18 @@ func startRrdpServer() {
 			//		belogs.Debug("startRrdpServer(): tryAgainFailRrdpUrls continue")
 			//		continue
 			//	}
+			// health of repositories
+			syncRrdpLogs, err := rrdp.GetLastSyncRrdpLogsDb()
+			if err != nil {
+				belogs.Error("startRrdpServer(): GetLastSyncRrdpLogsDb fail:", err)
+				// no return
+			} else {
+				err = rrQueue.repoResults.SaveSyncRepos(rrQueue.LabRpkiSyncLogId, syncRrdpLogs)
+				if err != nil {
+					belogs.Error("startRrdpServer(): SaveSyncRepos fail:", err)
+					// no return
+				}
+			}
 			rrQueue.RrdpResult.EndTime = time.Now()
 			rrQueue.RrdpResult.OkUrls = rrQueue.GetRrdpUrls()
 			rrQueue.RrdpResult.OkUrlsLen = uint64(len(rrQueue.RrdpResult.OkUrls))
@@ -116,14 +129,19 @@ func rrdpByUrl(rrdpModelChan RrdpModelChan) {
 	belogs.Debug("RrdpByUrl(): before rrdp, rrdpModelChan:", rrdpModelChan,
 		"    CurRrdpingCount:", atomic.LoadInt64(&rrQueue.CurRrdpingCount), "   startTime:", start)
 	lastSyncRrdpLog, hasLast := rrQueue.LastSyncRrdpLogs[rrdpModelChan.Url]
+	// fetch result of this url, will add to rrdp result
+	var fetchResult model.RrdpFetchResult
 	rrdpByUrlModel := rrdp.RrdpByUrlModel{
-		NotifyUrl:     rrdpModelChan.Url,
-		DestPath:      rrdpModelChan.Dest,
-		HasPath:       true,
-		HasLast:       hasLast,
-		LastSessionId: lastSyncRrdpLog.SessionId,
-		LastCurSerial: lastSyncRrdpLog.CurSerial,
-		SyncLogId:     rrQueue.LabRpkiSyncLogId,
+		NotifyUrl:      rrdpModelChan.Url,
+		DestPath:       rrdpModelChan.Dest,
+		HasPath:        true,
+		HasLast:        hasLast,
+		LastSessionId:  lastSyncRrdpLog.SessionId,
+		LastCurSerial:  lastSyncRrdpLog.CurSerial,
+		SyncLogId:      rrQueue.LabRpkiSyncLogId,
+		CaRepositories: rrQueue.getCaRepositories(rrdpModelChan.Url),
+		FetchResult:    &fetchResult,
+		UriErrors:      &rrQueue.RrdpResult.RrdpUriErrors,
 	}
 	belogs.Debug("RrdpByUrl():rrdpByUrlModel:", jsonutil.MarshalJson(rrdpByUrlModel))
 	// will ignore connectRrdpUrlCh
@@ -134,6 +152,26 @@ func rrdpByUrl(rrdpModelChan RrdpModelChan) {
 	rrdpFiles, err := rrdp.RrdpByUrlImpl(rrdpByUrlModel, connectRrdpUrlCh, nil)
 	atomic.AddInt64(&rrQueue.CurRrdpingCount, -1)
 	belogs.Debug("RrdpByUrl(): RrdpByUrlImpl, len(rrdpFiles), err:", len(rrdpFiles), err)
+	coresync.AddRrdpFetchResult(&rrQueue.RrdpResult.RrdpFetchResult, &fetchResult)
+	repoResult := coresync.RepoResult{
+		RepoUrl:     rrdpModelChan.Url,
+		Protocol:    "rrdp",
+		Ok:          err == nil,
+		AttemptTime: start,
+		Duration:    time.Since(start),
+		Bytes:       fetchResult.Bytes,
+	}
+	for i := range rrdpFiles {
+		if rrdpFiles[i].SyncType == "add" {
+			repoResult.AddCount++
+		} else if rrdpFiles[i].SyncType == "del" {
+			repoResult.DelCount++
+		}
+	}
+	if err != nil {
+		repoResult.Error = err.Error()
+	}
+	rrQueue.repoResults.AddRepoResult(repoResult)
 
 	if err != nil {
 		rrQueue.RrdpResult.FailUrls.Store(rrdpModelChan.Url, err.Error())
@@ -249,7 +287,11 @@ func parseCerAndGetRpkiNotify(cerFile string) (rpkiNotify string) {
 		return ""
 	}
 
-	// get the sub repo url in cer, and send it to rpqueue
+	// get the sub repo url in cer, and send it to rpqueue.
+	// caRepository is the scope of objects which rrdp of rpkiNotify can write
+	if len(parseCerSimple.RpkiNotify) > 0 && len(parseCerSimple.CaRepository) > 0 {
+		rrQueue.addCaRepository(parseCerSimple.RpkiNotify, parseCerSimple.CaRepository)
+	}
 	belogs.Info("parseCerAndGetRpkiNotify(): cerFile:", cerFile, "    parseCerSimple:", jsonutil.MarshalJson(parseCerSimple),
 		"  time(s):", time.Since(start))
 	return parseCerSimple.RpkiNotify
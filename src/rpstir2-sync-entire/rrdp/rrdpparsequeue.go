@@ -10,6 +10,8 @@ import (
 	"github.com/cpusoft/goutil/belogs"
 	"github.com/cpusoft/goutil/jsonutil"
 	model "rpstir2-model"
+	"rpstir2-sync-core/repopolicy"
+	coresync "rpstir2-sync-core/sync"
 )
 
 // queue for rrdp url of notify.xml
@@ -42,6 +44,13 @@ type RrdpParseQueue struct {
 
 	// last saved syncRrdpLogs
 	LastSyncRrdpLogs map[string]model.LabRpkiSyncRrdpLog
+
+	// notifyUrl --> caRepositories of cas which referenced it, rrdp can only write objects in them
+	caRepositoriesMutex *sync.Mutex
+	caRepositories      map[string][]string
+
+	// repoUrl --> result of repository in this rrdp, will save to lab_rpki_sync_repo at the end
+	repoResults *coresync.RepoResults
 }
 
 func NewQueue() *RrdpParseQueue {
@@ -56,9 +65,14 @@ func NewQueue() *RrdpParseQueue {
 	rq.rrdpAddedUrlsMutex = new(sync.RWMutex)
 	rq.rrdpAddedUrls = list.New()
 
+	rq.caRepositoriesMutex = new(sync.Mutex)
+	rq.caRepositories = make(map[string][]string)
+	rq.repoResults = coresync.NewRepoResults()
+
 	rq.RrdpResult.StartTime = time.Now()
 	rq.RrdpResult.OkUrls = make([]string, 0, 100000)
 	rq.RrdpResult.FailUrls = jsonutil.JsonSyncMap{}
+	rq.RrdpResult.RrdpUriErrors = jsonutil.JsonSyncMap{}
 	rq.RrdpResult.FailParseValidateCerts = jsonutil.JsonSyncMap{}
 	belogs.Debug("NewQueue():rq:", jsonutil.MarshalJson(rq))
 	return rq
@@ -72,6 +86,7 @@ func (r *RrdpParseQueue) Close() {
 	r.rrdpAddedUrls = nil
 	r.RrdpResult.OkUrls = nil
 	r.RrdpResult.FailUrls = jsonutil.JsonSyncMap{}
+	r.RrdpResult.RrdpUriErrors = jsonutil.JsonSyncMap{}
 	r.RrdpResult.FailParseValidateCerts = jsonutil.JsonSyncMap{}
 	r = nil
 
@@ -107,13 +122,9 @@ func (r *RrdpParseQueue) PreCheckRrdpUrl(url string) (ok bool) {
 		belogs.Error("PreCheckRrdpUrl():url  is 0")
 		return false
 	}
-	if strings.HasPrefix(url, "rrdp://localhost") || strings.HasPrefix(url, "rrdp://127.0.0.1") {
-		belogs.Error("PreCheckRrdpUrl():url is localhost:", url)
-		return false
-	}
-	//chloe.sobornost.net/rpki/news-public.xml
-	if strings.Index(url, "https://ca.rg.net/rrdp/notify.xml") > 0 {
-		belogs.Error("PreCheckRrdpUrl():this url is not rrdp url, so just ignore:", url)
+	// such as localhost, by sync::repoPolicyFile
+	if allow, reason := repopolicy.CheckRepoUrl(url); !allow {
+		belogs.Error("PreCheckRrdpUrl():url is denied:", url, "  ", reason)
 		return false
 	}
 
@@ -147,13 +158,6 @@ func (r *RrdpParseQueue) AddRrdpUrl(url string, dest string) {
 		belogs.Debug("AddRrdpUrl():len(url) == 0 || len(dest) == 0, after RrdpingParsingCount-1:", atomic.LoadInt64(&r.RrdpingParsingCount))
 		return
 	}
-	if strings.HasPrefix(url, "https://localhost") || strings.HasPrefix(url, "https://127.0.0.1") {
-		belogs.Error("AddRrdpUrl():url is localhost:", url)
-		belogs.Debug("AddRrdpUrl():url is localhost, before RrdpingParsingCount-1:", atomic.LoadInt64(&r.RrdpingParsingCount))
-		atomic.AddInt64(&r.RrdpingParsingCount, -1)
-		belogs.Debug("AddRrdpUrl()::url is localhost, after RrdpingParsingCount-1:", atomic.LoadInt64(&r.RrdpingParsingCount))
-		return
-	}
 	e := r.rrdpAddedUrls.Front()
 	for e != nil {
 		if strings.Contains(url, e.Value.(RrdpModelChan).Url) {
@@ -177,6 +181,25 @@ func (r *RrdpParseQueue) AddRrdpUrl(url string, dest string) {
 	return
 }
 
+func (r *RrdpParseQueue) addCaRepository(notifyUrl string, caRepository string) {
+	r.caRepositoriesMutex.Lock()
+	defer r.caRepositoriesMutex.Unlock()
+	for _, existed := range r.caRepositories[notifyUrl] {
+		if existed == caRepository {
+			return
+		}
+	}
+	r.caRepositories[notifyUrl] = append(r.caRepositories[notifyUrl], caRepository)
+}
+
+func (r *RrdpParseQueue) getCaRepositories(notifyUrl string) (caRepositories []string) {
+	r.caRepositoriesMutex.Lock()
+	defer r.caRepositoriesMutex.Unlock()
+	caRepositories = make([]string, len(r.caRepositories[notifyUrl]))
+	copy(caRepositories, r.caRepositories[notifyUrl])
+	return caRepositories
+}
+
 func (r *RrdpParseQueue) GetRrdpUrls() (urls []string) {
 	r.rrdpAddedUrlsMutex.Lock()
 	defer r.rrdpAddedUrlsMutex.Unlock()
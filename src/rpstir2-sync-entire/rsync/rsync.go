@@ -76,6 +76,12 @@ func startRsyncServer() {
 				belogs.Error("startRsyncServer(): FoundDiffFiles fail:", err)
 				// no return
 			}
+			// health of repositories
+			err = rpQueue.repoResults.SaveSyncRepos(rpQueue.LabRpkiSyncLogId, nil)
+			if err != nil {
+				belogs.Error("startRsyncServer(): SaveSyncRepos fail:", err)
+				// no return
+			}
 			rpQueue.RsyncResult.EndTime = time.Now()
 			rpQueue.RsyncResult.OkUrls = rpQueue.GetRsyncUrls()
 			rpQueue.RsyncResult.OkUrlsLen = uint64(len(rpQueue.RsyncResult.OkUrls))
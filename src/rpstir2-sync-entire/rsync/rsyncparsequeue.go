@@ -10,6 +10,8 @@ import (
 	"github.com/cpusoft/goutil/belogs"
 	"github.com/cpusoft/goutil/jsonutil"
 	model "rpstir2-model"
+	"rpstir2-sync-core/repopolicy"
+	coresync "rpstir2-sync-core/sync"
 )
 
 // queue for rsync url
@@ -36,6 +38,9 @@ type RsyncParseQueue struct {
 	// other save to synclog,
 	LabRpkiSyncLogId uint64
 	RsyncResult      model.SyncResult
+
+	// repoUrl --> result of repository in this rsync, will save to lab_rpki_sync_repo at the end
+	repoResults *coresync.RepoResults
 }
 
 func NewQueue() *RsyncParseQueue {
@@ -49,6 +54,7 @@ func NewQueue() *RsyncParseQueue {
 
 	rq.rsyncAddedUrlsMutex = new(sync.RWMutex)
 	rq.rsyncAddedUrls = list.New()
+	rq.repoResults = coresync.NewRepoResults()
 
 	rq.RsyncResult.StartTime = time.Now()
 	rq.RsyncResult.OkUrls = make([]string, 0, 100000)
@@ -97,8 +103,9 @@ func (r *RsyncParseQueue) PreCheckRsyncUrl(url string) (ok bool) {
 		belogs.Error("PreCheckRsyncUrl():url  is 0")
 		return false
 	}
-	if strings.HasPrefix(url, "rsync://localhost") || strings.HasPrefix(url, "rsync://127.0.0.1") {
-		belogs.Error("PreCheckRsyncUrl():url is localhost:", url)
+	// such as localhost, by sync::repoPolicyFile
+	if allow, reason := repopolicy.CheckRepoUrl(url); !allow {
+		belogs.Error("PreCheckRsyncUrl():url is denied:", url, "  ", reason)
 		return false
 	}
 	e := r.rsyncAddedUrls.Front()
@@ -131,13 +138,6 @@ func (r *RsyncParseQueue) AddRsyncUrl(url string, dest string) {
 		belogs.Debug("AddRsyncUrl():len(url) == 0 || len(dest) == 0, after RsyncingParsingCount-1:", atomic.LoadInt64(&r.RsyncingParsingCount))
 		return
 	}
-	if strings.HasPrefix(url, "rsync://localhost") || strings.HasPrefix(url, "rsync://127.0.0.1") {
-		belogs.Error("AddRsyncUrl():url is localhost:", url)
-		belogs.Debug("AddRsyncUrl():url is localhost, before RsyncingParsingCount-1:", atomic.LoadInt64(&r.RsyncingParsingCount))
-		atomic.AddInt64(&r.RsyncingParsingCount, -1)
-		belogs.Debug("AddRsyncUrl()::url is localhost, after RsyncingParsingCount-1:", atomic.LoadInt64(&r.RsyncingParsingCount))
-		return
-	}
 	e := r.rsyncAddedUrls.Front()
 	for e != nil {
 		if strings.Contains(url, e.Value.(RsyncModelChan).Url) {
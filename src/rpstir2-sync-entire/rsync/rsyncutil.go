@@ -12,8 +12,9 @@ import (
 	"github.com/cpusoft/goutil/jsonutil"
 	"github.com/cpusoft/goutil/osutil"
 	"github.com/cpusoft/goutil/randutil"
-	"github.com/cpusoft/goutil/rsyncutil"
 	model "rpstir2-model"
+	"rpstir2-sync-core/rsyncclient"
+	coresync "rpstir2-sync-core/sync"
 )
 
 func rsyncByUrl(rsyncModelChan RsyncModelChan) {
@@ -32,12 +33,30 @@ func rsyncByUrl(rsyncModelChan RsyncModelChan) {
 	// CurRsyncingCount should +1 and then -1
 	atomic.AddInt64(&rpQueue.CurRsyncingCount, 1)
 	belogs.Debug("RsyncByUrl(): before rsync, rsyncModelChan:", rsyncModelChan, "    CurRsyncingCount:", atomic.LoadInt64(&rpQueue.CurRsyncingCount))
-	rsyncutil.SetTimeout(24)
-	defer rsyncutil.ResetAllTimeout()
-	rsyncDestPath, _, err := rsyncutil.RsyncQuiet(rsyncModelChan.Url, rsyncModelChan.Dest)
+	rsyncResult, err := rsyncclient.RsyncQuiet(rsyncModelChan.Url, rsyncModelChan.Dest, time.Time{})
 	atomic.AddInt64(&rpQueue.CurRsyncingCount, -1)
+	rsyncDestPath := rsyncResult.RsyncDestPath
 	belogs.Debug("RsyncByUrl(): rsync rsyncModelChan:", rsyncModelChan, "     CurRsyncingCount:", atomic.LoadInt64(&rpQueue.CurRsyncingCount),
 		"     rsyncDestPath:", rsyncDestPath)
+	repoResult := coresync.RepoResult{
+		RepoUrl:     coresync.GetRsyncRepoUrl(rsyncModelChan.Url),
+		Protocol:    "rsync",
+		Ok:          err == nil,
+		AttemptTime: start,
+		Duration:    time.Since(start),
+		Bytes:       rsyncResult.DownloadBytes,
+	}
+	if err == nil {
+		var countErr error
+		repoResult.ObjectCount, countErr = coresync.CountRsyncRepoObjects(rsyncDestPath)
+		if countErr != nil {
+			belogs.Error("RsyncByUrl():CountRsyncRepoObjects fail, rsyncDestPath:", rsyncDestPath, countErr)
+			// no return
+		}
+	} else {
+		repoResult.Error = err.Error()
+	}
+	rpQueue.repoResults.AddRepoResult(repoResult)
 	if err != nil {
 		rpQueue.RsyncResult.FailUrls.Store(rsyncModelChan.Url, err.Error())
 		belogs.Error("RsyncByUrl():RsyncQuiet fail, rsyncModelChan.Url:", rsyncModelChan.Url, "   err:", err, "  time(s):", time.Since(start))
@@ -18,9 +18,9 @@ import (
 	"github.com/cpusoft/goutil/jsonutil"
 	"github.com/cpusoft/goutil/osutil"
 	"github.com/cpusoft/goutil/rrdputil"
-	"github.com/cpusoft/goutil/rsyncutil"
 	"github.com/cpusoft/goutil/urlutil"
 	model "rpstir2-model"
+	"rpstir2-sync-core/rsyncclient"
 )
 
 func getTals() (passTalModels []model.TalModel, err error) {
@@ -229,16 +229,14 @@ func syncToLocalAndParseValidateCer(tmpDir, talUrl, subjectPublicKeyInfo string,
 
 	} else if strings.HasPrefix(talUrl, "rsync:") {
 		// rsycn to local file
-		rsyncutil.SetTimeout(24)
-		defer rsyncutil.ResetAllTimeout()
-		rsyncDestPath, _, err := rsyncutil.RsyncQuiet(talUrl, tmpDir)
+		rsyncResult, err := rsyncclient.RsyncQuiet(talUrl, tmpDir, time.Time{})
 		if err != nil {
 			belogs.Error("syncToLocalAndParseValidateCer(): RsyncQuiet fail, url, tmpDir, err:", talUrl, tmpDir, err)
 			talSyncUrl.Error = err.Error()
 			talSyncUrl.SupportRsync = false
 			return
 		}
-		talSyncUrl.LocalFile = osutil.JoinPathFile(rsyncDestPath, file)
+		talSyncUrl.LocalFile = osutil.JoinPathFile(rsyncResult.RsyncDestPath, file)
 
 	} else {
 		talSyncUrl.Error = "talUrl is not supported:" + talUrl
@@ -310,9 +308,7 @@ func parseAndValidateCer(talUrl, subjectPublicKeyInfo, tmpDir string, talSyncUrl
 		// must start with "rsync", otherwise root cer cannot  download by rsync
 		if strings.HasPrefix(talSyncUrl.TalUrl, "rsync:") {
 			belogs.Debug("parseAndValidateCer(): test rsync is ok:", talSyncUrl.TalUrl)
-			rsyncutil.SetTimeout(24)
-			defer rsyncutil.ResetAllTimeout()
-			_, _, err := rsyncutil.RsyncQuiet(talUrl, tmpDir)
+			_, err := rsyncclient.RsyncQuiet(talUrl, tmpDir, time.Time{})
 			if err != nil {
 				belogs.Error("parseAndValidateCer(): RsyncQuiet fail, url,err:", talSyncUrl.TalUrl, err)
 				talSyncUrl.SupportRsync = false
@@ -23,3 +23,25 @@ func GetTals(c *gin.Context) {
 	ginserver.ResponseOk(c, talModelsResponse)
 
 }
+
+// tals of replay sync, root cer is found in repoPath instead of network
+func GetReplayTals(c *gin.Context) {
+	belogs.Info("GetReplayTals")
+
+	replayModel := model.ReplayModel{}
+	err := c.ShouldBindJSON(&replayModel)
+	if err != nil {
+		belogs.Error("GetReplayTals(): ShouldBindJSON:", err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	talModels, err := getReplayTals(replayModel)
+	if err != nil {
+		belogs.Error("GetReplayTals(): getReplayTals fail:", jsonutil.MarshalJson(replayModel), err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	belogs.Debug("GetReplayTals(): getReplayTals, talModels:", jsonutil.MarshalJson(talModels))
+	talModelsResponse := model.TalModelsResponse{TalModels: talModels}
+	ginserver.ResponseOk(c, talModelsResponse)
+}
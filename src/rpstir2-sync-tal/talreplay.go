@@ -0,0 +1,99 @@
+package tal
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cpusoft/goutil/base64util"
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/conf"
+	"github.com/cpusoft/goutil/httpclient"
+	"github.com/cpusoft/goutil/jsonutil"
+	"github.com/cpusoft/goutil/osutil"
+	model "rpstir2-model"
+)
+
+// tals of replay sync: root cer of rsync url in tal is found in repoPath(host/module/path), no network is used.
+// https url in tal is ignored, because repoPath is laid out by rsync url
+func getReplayTals(replayModel model.ReplayModel) (passTalModels []model.TalModel, err error) {
+	start := time.Now()
+	talPath := replayModel.TalPath
+	if len(talPath) == 0 {
+		talPath = conf.String("sync::talPath")
+	}
+	belogs.Debug("getReplayTals(): talPath:", talPath, "  repoPath:", replayModel.RepoPath)
+
+	files, err := getAllTalFiles(talPath)
+	if err != nil {
+		belogs.Error("getReplayTals(): getAllTalFiles fail:", talPath, err)
+		return nil, err
+	}
+	talModels, err := parseTalFiles(files)
+	if err != nil {
+		belogs.Error("getReplayTals(): parseTalFiles fail:", files, err)
+		return nil, err
+	}
+
+	passTalModels = make([]model.TalModel, 0, len(talModels))
+	for i := range talModels {
+		passTalSyncUrls := make([]model.TalSyncUrl, 0, len(talModels[i].TalSyncUrls))
+		for j := range talModels[i].TalSyncUrls {
+			talSyncUrl := talModels[i].TalSyncUrls[j]
+			if !talSyncUrl.SupportRsync {
+				belogs.Info("getReplayTals(): ignore url which is not rsync:", talSyncUrl.TalUrl)
+				continue
+			}
+			err = findAndValidateReplayCer(replayModel.RepoPath, talModels[i].SubjectPublicKeyInfo, &talSyncUrl)
+			if err != nil {
+				belogs.Error("getReplayTals(): findAndValidateReplayCer fail, will ignore:", talSyncUrl.TalUrl, err)
+				continue
+			}
+			passTalSyncUrls = append(passTalSyncUrls, talSyncUrl)
+		}
+		if len(passTalSyncUrls) > 0 {
+			talModels[i].TalSyncUrls = passTalSyncUrls
+			passTalModels = append(passTalModels, talModels[i])
+		}
+	}
+	if len(passTalModels) == 0 {
+		belogs.Error("getReplayTals(): no root cer of tal is found in repoPath:", replayModel.RepoPath)
+		return nil, errors.New("no root cer of tal is found in repoPath")
+	}
+	belogs.Info("getReplayTals(): passTalModels:", jsonutil.MarshalJson(passTalModels), "  time(s):", time.Since(start))
+	return passTalModels, nil
+}
+
+// rsync://host/module/ta.cer --> repoPath/host/module/ta.cer, and check subjectPublicKeyInfo as syncToLocalAndParseValidateCer
+func findAndValidateReplayCer(repoPath, subjectPublicKeyInfo string, talSyncUrl *model.TalSyncUrl) (err error) {
+	relPath := filepath.Clean(filepath.FromSlash(strings.TrimPrefix(talSyncUrl.TalUrl, "rsync://")))
+	if strings.HasPrefix(relPath, "..") || filepath.IsAbs(relPath) {
+		return errors.New("rsync url of tal is not safe: " + talSyncUrl.TalUrl)
+	}
+	talSyncUrl.LocalFile = filepath.Join(repoPath, relPath)
+	isFile, err := osutil.IsFile(talSyncUrl.LocalFile)
+	if err != nil || !isFile {
+		return errors.New("root cer is not in repoPath: " + talSyncUrl.LocalFile)
+	}
+
+	parseCerSimple := model.ParseCerSimple{}
+	err = httpclient.PostFileAndUnmarshalResponseModel("http://"+conf.String("rpstir2-rp::serverHost")+":"+conf.String("rpstir2-rp::serverHttpPort")+
+		"/parsevalidate/parsefilesimple", talSyncUrl.LocalFile, "file", false, &parseCerSimple)
+	if err != nil {
+		belogs.Error("findAndValidateReplayCer(): PostFileAndUnmarshalResponseModel fail:", talSyncUrl.LocalFile, err)
+		return err
+	}
+	subjectPublicKeyInfoInCer := base64util.EncodeBase64(parseCerSimple.SubjectPublicKeyInfo)
+	if subjectPublicKeyInfoInCer != subjectPublicKeyInfo {
+		belogs.Error("findAndValidateReplayCer(): subjectInfo is not equal:", talSyncUrl.LocalFile,
+			"  subjectPublicKeyInfoInCer:", subjectPublicKeyInfoInCer, "   subjectPublicKeyInfo:", subjectPublicKeyInfo)
+		// no return, same as syncToLocalAndParseValidateCer
+	}
+	talSyncUrl.RsyncUrl = talSyncUrl.TalUrl
+	talSyncUrl.SupportRsync = true
+	talSyncUrl.SupportRrdp = false
+	talSyncUrl.Error = ""
+	belogs.Debug("findAndValidateReplayCer(): talSyncUrl:", jsonutil.MarshalJson(talSyncUrl))
+	return nil
+}
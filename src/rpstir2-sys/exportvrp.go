@@ -0,0 +1,307 @@
+package sys
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cpusoft/goutil/belogs"
+	"github.com/cpusoft/goutil/convert"
+	"github.com/cpusoft/goutil/iputil"
+	"github.com/cpusoft/goutil/jsonutil"
+	model "rpstir2-model"
+	"xorm.io/xorm"
+)
+
+// tal name in request and in export --> rir in origin of roa
+var exportTalRirs = map[string]string{
+	"afrinic": model.ORIGIN_RIR_AFRINIC,
+	"apnic":   model.ORIGIN_RIR_APNIC,
+	"arin":    model.ORIGIN_RIR_ARIN,
+	"lacnic":  model.ORIGIN_RIR_LACNIC,
+	"ripe":    model.ORIGIN_RIR_RIPE_NCC,
+	"slurm":   "slurm",
+}
+
+// check request and get serialNumber and counts, so errors can be responsed before streaming
+func getExportVrpMetadata(session *xorm.Session, exportVrpRequest ExportVrpRequest) (exportVrpMetadata ExportVrpMetadata, err error) {
+	switch exportVrpRequest.Format {
+	case EXPORT_VRP_FORMAT_JSON, EXPORT_VRP_FORMAT_CSV, EXPORT_VRP_FORMAT_OPENBGPD,
+		EXPORT_VRP_FORMAT_BIRD2, EXPORT_VRP_FORMAT_RFC8416:
+	default:
+		return exportVrpMetadata, errors.New("format should be json, csv, openbgpd, bird2 or rfc8416")
+	}
+	rirs, err := convertExportTalsToRirs(exportVrpRequest.Tals)
+	if err != nil {
+		belogs.Error("getExportVrpMetadata(): convertExportTalsToRirs fail:", exportVrpRequest.Tals, err)
+		return exportVrpMetadata, err
+	}
+
+	serialNumber, vrpCount, aspaCount, err := getExportVrpMetadataDb(session, exportVrpRequest.WithoutSlurm, rirs)
+	if err != nil {
+		belogs.Error("getExportVrpMetadata(): getExportVrpMetadataDb fail:", jsonutil.MarshalJson(exportVrpRequest), err)
+		return exportVrpMetadata, err
+	}
+	exportVrpMetadata = ExportVrpMetadata{
+		Format:        exportVrpRequest.Format,
+		SerialNumber:  serialNumber,
+		GeneratedTime: time.Now(),
+		VrpCount:      vrpCount,
+		AspaCount:     aspaCount,
+		WithoutSlurm:  exportVrpRequest.WithoutSlurm,
+		Tals:          exportVrpRequest.Tals,
+	}
+	belogs.Info("getExportVrpMetadata(): exportVrpMetadata:", jsonutil.MarshalJson(exportVrpMetadata))
+	return exportVrpMetadata, nil
+}
+
+// vrps and aspas are written one by one, in the same session of getExportVrpMetadata
+func exportVrps(session *xorm.Session, exportVrpMetadata *ExportVrpMetadata, w io.Writer) (err error) {
+	start := time.Now()
+	rirs, err := convertExportTalsToRirs(exportVrpMetadata.Tals)
+	if err != nil {
+		belogs.Error("exportVrps(): convertExportTalsToRirs fail:", exportVrpMetadata.Tals, err)
+		return err
+	}
+	bw := bufio.NewWriterSize(w, 64*1024)
+	iterateVrps := func(fn func(exportVrp *ExportVrp) error) error {
+		return iterateExportVrpsDb(session, exportVrpMetadata.WithoutSlurm, rirs, func(exportVrp *ExportVrp) error {
+			if err := fillExportVrp(exportVrp); err != nil {
+				return err
+			}
+			return fn(exportVrp)
+		})
+	}
+	iterateAspas := func(fn func(exportAspa *ExportAspa) error) error {
+		return iterateExportAspasDb(session, exportVrpMetadata.WithoutSlurm, rirs, func(exportAspa *ExportAspa) error {
+			exportAspa.Ta = convertExportRirToTal(exportAspa.Ta)
+			return fn(exportAspa)
+		})
+	}
+
+	switch exportVrpMetadata.Format {
+	case EXPORT_VRP_FORMAT_JSON:
+		err = exportVrpsJson(exportVrpMetadata, bw, iterateVrps, iterateAspas)
+	case EXPORT_VRP_FORMAT_CSV:
+		err = exportVrpsCsv(bw, iterateVrps)
+	case EXPORT_VRP_FORMAT_OPENBGPD:
+		err = exportVrpsOpenBgpd(exportVrpMetadata, bw, iterateVrps, iterateAspas)
+	case EXPORT_VRP_FORMAT_BIRD2:
+		err = exportVrpsBird2(exportVrpMetadata, bw, iterateVrps)
+	case EXPORT_VRP_FORMAT_RFC8416:
+		err = exportVrpsRfc8416(exportVrpMetadata, bw, iterateVrps, iterateAspas)
+	}
+	if err != nil {
+		belogs.Error("exportVrps(): export fail, format:", exportVrpMetadata.Format, err)
+		return err
+	}
+	if err = bw.Flush(); err != nil {
+		belogs.Error("exportVrps(): Flush fail, format:", exportVrpMetadata.Format, err)
+		return err
+	}
+	belogs.Info("exportVrps(): format:", exportVrpMetadata.Format, "  vrpCount:", exportVrpMetadata.VrpCount,
+		"  aspaCount:", exportVrpMetadata.AspaCount, "  time(s):", time.Since(start))
+	return nil
+}
+
+// rpki-client json: {"metadata":{},"roas":[{"asn":64496,"prefix":"192.0.2.0/24","maxLength":24,"ta":"apnic"}],
+// "aspas":[{"customer_asid":64496,"providers":[64497],"ta":"apnic"}]}
+func exportVrpsJson(exportVrpMetadata *ExportVrpMetadata, bw *bufio.Writer,
+	iterateVrps func(func(*ExportVrp) error) error, iterateAspas func(func(*ExportAspa) error) error) (err error) {
+	metadata := map[string]interface{}{
+		"generator":    "rpstir2",
+		"buildtime":    exportVrpMetadata.GeneratedTime.UTC().Format(time.RFC3339),
+		"generated":    exportVrpMetadata.GeneratedTime.Unix(),
+		"serialNumber": exportVrpMetadata.SerialNumber,
+		"vrps":         exportVrpMetadata.VrpCount,
+		"aspas":        exportVrpMetadata.AspaCount,
+		"withoutSlurm": exportVrpMetadata.WithoutSlurm,
+		"tals":         exportVrpMetadata.Tals,
+	}
+	bw.WriteString(`{"metadata":` + jsonutil.MarshalJson(metadata) + `,"roas":[`)
+	first := true
+	err = iterateVrps(func(exportVrp *ExportVrp) error {
+		return writeExportJsonElement(bw, exportVrp, &first)
+	})
+	if err != nil {
+		return err
+	}
+	bw.WriteString(`],"aspas":[`)
+	first = true
+	err = iterateAspas(func(exportAspa *ExportAspa) error {
+		return writeExportJsonElement(bw, exportAspa, &first)
+	})
+	if err != nil {
+		return err
+	}
+	_, err = bw.WriteString("]}\n")
+	return err
+}
+
+// routinator csv: ASN,IP Prefix,Max Length,Trust Anchor
+func exportVrpsCsv(bw *bufio.Writer, iterateVrps func(func(*ExportVrp) error) error) (err error) {
+	cw := csv.NewWriter(bw)
+	cw.Write([]string{"ASN", "IP Prefix", "Max Length", "Trust Anchor"})
+	err = iterateVrps(func(exportVrp *ExportVrp) error {
+		return cw.Write([]string{"AS" + convert.ToString(exportVrp.Asn), exportVrp.Prefix,
+			convert.ToString(exportVrp.MaxLength), exportVrp.Ta})
+	})
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// openbgpd roa-set and aspa-set, providers of all address families are in one provider-as
+func exportVrpsOpenBgpd(exportVrpMetadata *ExportVrpMetadata, bw *bufio.Writer,
+	iterateVrps func(func(*ExportVrp) error) error, iterateAspas func(func(*ExportAspa) error) error) (err error) {
+	writeExportComment(exportVrpMetadata, bw)
+	bw.WriteString("roa-set {\n")
+	err = iterateVrps(func(exportVrp *ExportVrp) error {
+		_, err := bw.WriteString("\t" + exportVrp.Prefix + " maxlen " + convert.ToString(exportVrp.MaxLength) +
+			" source-as " + convert.ToString(exportVrp.Asn) + "\n")
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	bw.WriteString("}\n\naspa-set {\n")
+	err = iterateAspas(func(exportAspa *ExportAspa) error {
+		providerAsns := make([]string, 0, len(exportAspa.ProviderAsns))
+		for _, providerAsn := range exportAspa.ProviderAsns {
+			providerAsns = append(providerAsns, convert.ToString(providerAsn))
+		}
+		_, err := bw.WriteString("\tcustomer-as " + convert.ToString(exportAspa.CustomerAsn) +
+			" provider-as { " + strings.Join(providerAsns, ", ") + " }\n")
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	_, err = bw.WriteString("}\n")
+	return err
+}
+
+// bird2 roa4/roa6 tables by static protocols, vrps are ipv4 first
+func exportVrpsBird2(exportVrpMetadata *ExportVrpMetadata, bw *bufio.Writer,
+	iterateVrps func(func(*ExportVrp) error) error) (err error) {
+	writeExportComment(exportVrpMetadata, bw)
+	bw.WriteString("roa4 table ROAS4;\nroa6 table ROAS6;\n\nprotocol static {\n\troa4 { table ROAS4; };\n")
+	isIpv6 := false
+	err = iterateVrps(func(exportVrp *ExportVrp) error {
+		if !isIpv6 && strings.Contains(exportVrp.Prefix, ":") {
+			isIpv6 = true
+			bw.WriteString("}\n\nprotocol static {\n\troa6 { table ROAS6; };\n")
+		}
+		_, err := bw.WriteString("\troute " + exportVrp.Prefix + " max " + convert.ToString(exportVrp.MaxLength) +
+			" as " + convert.ToString(exportVrp.Asn) + ";\n")
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if !isIpv6 {
+		bw.WriteString("}\n\nprotocol static {\n\troa6 { table ROAS6; };\n")
+	}
+	_, err = bw.WriteString("}\n")
+	return err
+}
+
+// all vrps/aspas as locallyAddedAssertions of slurm, ta is in comment. it is slurmVersion 2 when there are aspas
+func exportVrpsRfc8416(exportVrpMetadata *ExportVrpMetadata, bw *bufio.Writer,
+	iterateVrps func(func(*ExportVrp) error) error, iterateAspas func(func(*ExportAspa) error) error) (err error) {
+	if exportVrpMetadata.AspaCount == 0 {
+		bw.WriteString(`{"slurmVersion":1,"validationOutputFilters":{"prefixFilters":[],"bgpsecFilters":[]},` +
+			`"locallyAddedAssertions":{"bgpsecAssertions":[],"prefixAssertions":[`)
+	} else {
+		bw.WriteString(`{"slurmVersion":2,"validationOutputFilters":{"prefixFilters":[],"bgpsecFilters":[],"aspaFilters":[]},` +
+			`"locallyAddedAssertions":{"bgpsecAssertions":[],"prefixAssertions":[`)
+	}
+	first := true
+	err = iterateVrps(func(exportVrp *ExportVrp) error {
+		return writeExportJsonElement(bw, map[string]interface{}{"asn": exportVrp.Asn, "prefix": exportVrp.Prefix,
+			"maxPrefixLength": exportVrp.MaxLength, "comment": exportVrp.Ta}, &first)
+	})
+	if err != nil {
+		return err
+	}
+	if exportVrpMetadata.AspaCount > 0 {
+		bw.WriteString(`],"aspaAssertions":[`)
+		first = true
+		err = iterateAspas(func(exportAspa *ExportAspa) error {
+			providers := make([]map[string]uint64, 0, len(exportAspa.ProviderAsns))
+			for _, providerAsn := range exportAspa.ProviderAsns {
+				providers = append(providers, map[string]uint64{"providerAsid": providerAsn})
+			}
+			return writeExportJsonElement(bw, map[string]interface{}{"customerAsid": exportAspa.CustomerAsn,
+				"providers": providers, "comment": exportAspa.Ta}, &first)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	_, err = bw.WriteString("]}}\n")
+	return err
+}
+
+func writeExportJsonElement(bw *bufio.Writer, v interface{}, first *bool) (err error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if !*first {
+		bw.WriteByte(',')
+	}
+	*first = false
+	bw.WriteString("\n")
+	_, err = bw.Write(b)
+	return err
+}
+
+func writeExportComment(exportVrpMetadata *ExportVrpMetadata, bw *bufio.Writer) {
+	bw.WriteString("# generated by rpstir2 at " + exportVrpMetadata.GeneratedTime.UTC().Format(time.RFC3339) +
+		", serialNumber: " + convert.ToString(exportVrpMetadata.SerialNumber) +
+		", vrps: " + convert.ToString(exportVrpMetadata.VrpCount) + ", aspas: " + convert.ToString(exportVrpMetadata.AspaCount) + "\n\n")
+}
+
+// prefix with full address, maxLength is prefixLength when it is empty in roa
+func fillExportVrp(exportVrp *ExportVrp) (err error) {
+	addressFill, err := iputil.FillAddressWithZero(exportVrp.Address, iputil.GetIpType(exportVrp.Address))
+	if err != nil {
+		belogs.Error("fillExportVrp(): FillAddressWithZero fail:", jsonutil.MarshalJson(exportVrp), err)
+		return err
+	}
+	exportVrp.Prefix = addressFill + "/" + strconv.FormatUint(exportVrp.PrefixLength, 10)
+	if exportVrp.MaxLength == 0 {
+		exportVrp.MaxLength = exportVrp.PrefixLength
+	}
+	exportVrp.Ta = convertExportRirToTal(exportVrp.Ta)
+	return nil
+}
+
+func convertExportTalsToRirs(tals []string) (rirs []string, err error) {
+	rirs = make([]string, 0, len(tals))
+	for _, tal := range tals {
+		rir, ok := exportTalRirs[strings.ToLower(tal)]
+		if !ok {
+			return nil, errors.New("tal " + tal + " should be afrinic, apnic, arin, lacnic, ripe or slurm")
+		}
+		rirs = append(rirs, rir)
+	}
+	return rirs, nil
+}
+
+func convertExportRirToTal(rir string) string {
+	for tal, r := range exportTalRirs {
+		if r == rir {
+			return tal
+		}
+	}
+	return strings.ToLower(rir)
+}
@@ -0,0 +1,159 @@
+package sys
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+	"time"
+)
+
+var testExportVrps = []ExportVrp{
+	{Asn: 64496, Prefix: "192.0.2.0/24", MaxLength: 24, Ta: "apnic"},
+	{Asn: 64497, Prefix: "198.51.100.0/22", MaxLength: 24, Ta: "slurm"},
+	{Asn: 64498, Prefix: "2001:db8::/32", MaxLength: 48, Ta: "ripe"},
+}
+
+var testExportAspas = []ExportAspa{
+	{CustomerAsn: 64496, ProviderAsns: []uint64{64500, 64501}, Ta: "apnic"},
+}
+
+func testExportRender(t *testing.T, format string, exportVrps []ExportVrp, exportAspas []ExportAspa) string {
+	exportVrpMetadata := &ExportVrpMetadata{
+		Format:        format,
+		SerialNumber:  7,
+		GeneratedTime: time.Date(2023, 1, 2, 15, 4, 5, 0, time.UTC),
+		VrpCount:      uint64(len(exportVrps)),
+		AspaCount:     uint64(len(exportAspas)),
+		Tals:          []string{},
+	}
+	iterateVrps := func(f func(*ExportVrp) error) error {
+		for i := range exportVrps {
+			if err := f(&exportVrps[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	iterateAspas := func(f func(*ExportAspa) error) error {
+		for i := range exportAspas {
+			if err := f(&exportAspas[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	var buf bytes.Buffer
+	bw := bufio.NewWriter(&buf)
+	var err error
+	switch format {
+	case EXPORT_VRP_FORMAT_JSON:
+		err = exportVrpsJson(exportVrpMetadata, bw, iterateVrps, iterateAspas)
+	case EXPORT_VRP_FORMAT_CSV:
+		err = exportVrpsCsv(bw, iterateVrps)
+	case EXPORT_VRP_FORMAT_OPENBGPD:
+		err = exportVrpsOpenBgpd(exportVrpMetadata, bw, iterateVrps, iterateAspas)
+	case EXPORT_VRP_FORMAT_BIRD2:
+		err = exportVrpsBird2(exportVrpMetadata, bw, iterateVrps)
+	case EXPORT_VRP_FORMAT_RFC8416:
+		err = exportVrpsRfc8416(exportVrpMetadata, bw, iterateVrps, iterateAspas)
+	}
+	if err != nil {
+		t.Fatal(format, err)
+	}
+	bw.Flush()
+	return buf.String()
+}
+
+// golden outputs of all formats, for empty set and for ipv4/ipv6 vrps and aspas
+func TestExportVrps(t *testing.T) {
+	tests := []struct {
+		format string
+		full   bool
+		golden string
+	}{
+		{EXPORT_VRP_FORMAT_JSON, false, `{"metadata":{"aspas":0,"buildtime":"2023-01-02T15:04:05Z","generated":1672671845,"generator":"rpstir2","serialNumber":7,"tals":[],"vrps":0,"withoutSlurm":false},"roas":[],"aspas":[]}
+`},
+		{EXPORT_VRP_FORMAT_JSON, true, `{"metadata":{"aspas":1,"buildtime":"2023-01-02T15:04:05Z","generated":1672671845,"generator":"rpstir2","serialNumber":7,"tals":[],"vrps":3,"withoutSlurm":false},"roas":[
+{"asn":64496,"prefix":"192.0.2.0/24","maxLength":24,"ta":"apnic"},
+{"asn":64497,"prefix":"198.51.100.0/22","maxLength":24,"ta":"slurm"},
+{"asn":64498,"prefix":"2001:db8::/32","maxLength":48,"ta":"ripe"}],"aspas":[
+{"customer_asid":64496,"providers":[64500,64501],"ta":"apnic"}]}
+`},
+		{EXPORT_VRP_FORMAT_CSV, false, `ASN,IP Prefix,Max Length,Trust Anchor
+`},
+		{EXPORT_VRP_FORMAT_CSV, true, `ASN,IP Prefix,Max Length,Trust Anchor
+AS64496,192.0.2.0/24,24,apnic
+AS64497,198.51.100.0/22,24,slurm
+AS64498,2001:db8::/32,48,ripe
+`},
+		{EXPORT_VRP_FORMAT_OPENBGPD, false, `# generated by rpstir2 at 2023-01-02T15:04:05Z, serialNumber: 7, vrps: 0, aspas: 0
+
+roa-set {
+}
+
+aspa-set {
+}
+`},
+		{EXPORT_VRP_FORMAT_OPENBGPD, true, `# generated by rpstir2 at 2023-01-02T15:04:05Z, serialNumber: 7, vrps: 3, aspas: 1
+
+roa-set {
+	192.0.2.0/24 maxlen 24 source-as 64496
+	198.51.100.0/22 maxlen 24 source-as 64497
+	2001:db8::/32 maxlen 48 source-as 64498
+}
+
+aspa-set {
+	customer-as 64496 provider-as { 64500, 64501 }
+}
+`},
+		{EXPORT_VRP_FORMAT_BIRD2, false, `# generated by rpstir2 at 2023-01-02T15:04:05Z, serialNumber: 7, vrps: 0, aspas: 0
+
+roa4 table ROAS4;
+roa6 table ROAS6;
+
+protocol static {
+	roa4 { table ROAS4; };
+}
+
+protocol static {
+	roa6 { table ROAS6; };
+}
+`},
+		{EXPORT_VRP_FORMAT_BIRD2, true, `# generated by rpstir2 at 2023-01-02T15:04:05Z, serialNumber: 7, vrps: 3, aspas: 1
+
+roa4 table ROAS4;
+roa6 table ROAS6;
+
+protocol static {
+	roa4 { table ROAS4; };
+	route 192.0.2.0/24 max 24 as 64496;
+	route 198.51.100.0/22 max 24 as 64497;
+}
+
+protocol static {
+	roa6 { table ROAS6; };
+	route 2001:db8::/32 max 48 as 64498;
+}
+`},
+		{EXPORT_VRP_FORMAT_RFC8416, false, `{"slurmVersion":1,"validationOutputFilters":{"prefixFilters":[],"bgpsecFilters":[]},"locallyAddedAssertions":{"bgpsecAssertions":[],"prefixAssertions":[]}}
+`},
+		{EXPORT_VRP_FORMAT_RFC8416, true, `{"slurmVersion":2,"validationOutputFilters":{"prefixFilters":[],"bgpsecFilters":[],"aspaFilters":[]},"locallyAddedAssertions":{"bgpsecAssertions":[],"prefixAssertions":[
+{"asn":64496,"comment":"apnic","maxPrefixLength":24,"prefix":"192.0.2.0/24"},
+{"asn":64497,"comment":"slurm","maxPrefixLength":24,"prefix":"198.51.100.0/22"},
+{"asn":64498,"comment":"ripe","maxPrefixLength":48,"prefix":"2001:db8::/32"}],"aspaAssertions":[
+{"comment":"apnic","customerAsid":64496,"providers":[{"providerAsid":64500},{"providerAsid":64501}]}]}}
+`},
+	}
+	for _, test := range tests {
+		var exportVrps []ExportVrp
+		var exportAspas []ExportAspa
+		if test.full {
+			exportVrps = append(exportVrps, testExportVrps...)
+			exportAspas = append(exportAspas, testExportAspas...)
+		}
+		output := testExportRender(t, test.format, exportVrps, exportAspas)
+		if output != test.golden {
+			t.Fatal(test.format, " full:", test.full, " should be:\n", test.golden, "\nbut:\n", output)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package sys
 import (
 	"errors"
 	"math/rand"
+	"strings"
 	"time"
 
 	"github.com/cpusoft/goutil/belogs"
@@ -42,16 +43,25 @@ var initSqls []string = []string{
 	`drop table if exists lab_rpki_rtr_asa_full_log`,
 	`drop table if exists lab_rpki_rtr_asa_full`,
 	`drop table if exists lab_rpki_rtr_asa_incremental`,
+	`drop table if exists lab_rpki_rtr_router_key_full_log`,
+	`drop table if exists lab_rpki_rtr_router_key_full`,
+	`drop table if exists lab_rpki_rtr_router_key_incremental`,
 	`drop table if exists lab_rpki_rtr_serial_number`,
 	`drop table if exists lab_rpki_rtr_session`,
 	`drop table if exists lab_rpki_rush_node`,
 	`drop table if exists lab_rpki_slurm`,
+	`drop table if exists lab_rpki_slurm_revision`,
+	`drop table if exists lab_rpki_slurm_log_file`,
+	`drop table if exists lab_rpki_slurm_log`,
 	`drop table if exists lab_rpki_sync_log_file`,
 	`drop table if exists lab_rpki_sync_log`,
 	`drop table if exists lab_rpki_sync_rrdp_log`,
 	`drop table if exists lab_rpki_sync_url`,
 	`drop table if exists lab_rpki_sync_rrdp_notify`,
 	`drop table if exists lab_rpki_sync_rrdp_delta`,
+	`drop table if exists lab_rpki_sync_rrdp_fallback`,
+	`drop table if exists lab_rpki_sync_repo`,
+	`drop table if exists lab_rpki_sync_repo_log`,
 	`drop view if exists lab_rpki_crl_revoked_cert_view`,
 	`drop view if exists lab_rpki_mft_file_hash_view`,
 	`drop view if exists lab_rpki_roa_ipaddress_count_view`,
@@ -456,8 +466,9 @@ CREATE TABLE lab_rpki_sync_rrdp_log (
 	lastSerial int(10) unsigned comment 'last serial',
 	curSerial int(10) unsigned not null comment 'current serial',
 	rrdpTime datetime not null comment 'rrdp time',
-	rrdpType varchar(16) not null comment 'snapshot/delta' ,
+	rrdpType varchar(16) not null comment 'snapshot/delta/deltaFail/sessionReset' ,
 	snapshotOrDeltaUrl varchar(256) not null comment 'snapshot/delta url' ,
+	errMsg varchar(1024) comment 'reason of deltaFail/sessionReset' ,
 	foreign key (syncLogId) references lab_rpki_sync_log(id),
 	index notifyUrl (notifyUrl) 
 ) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin COMMENT='recored notification.xml update log'
@@ -488,6 +499,8 @@ CREATE TABLE lab_rpki_sync_rrdp_notify (
 	state json comment '{state:valid}',
 	preceptTime datetime not null comment 'precept time',
 	downloadTime datetime comment 'download from notify time',
+	etag varchar(512) comment 'ETag of notification.xml, will send as If-None-Match',
+	lastModified varchar(128) comment 'Last-Modified of notification.xml, will send as If-Modified-Since',
 	unique notifyUrl (notifyUrl) 
 ) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin COMMENT='rrdp url'
 `,
@@ -503,6 +516,55 @@ CREATE TABLE lab_rpki_sync_rrdp_delta (
 	index notifyUrl (notifyUrl) ,
 	index serial (serial)
 ) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin COMMENT='rrdp url'
+`,
+	`
+CREATE TABLE lab_rpki_sync_rrdp_fallback (
+	id int(10) unsigned not null primary key auto_increment,
+	notifyUrl varchar(512) not null comment 'notification.xml url',
+	failCount int(10) unsigned not null comment 'count of continuous rrdp fails',
+	failReason varchar(1024) comment 'last rrdp fail reason',
+	failTime datetime not null comment 'last rrdp fail time',
+	nextRrdpTime datetime not null comment 'will rsync until this time, then try rrdp again',
+	syncLogId int(10) unsigned not null comment 'the sync which fell back to rsync',
+	unique notifyUrl (notifyUrl)
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin COMMENT='rrdp which fell back to rsync'
+`,
+	`
+CREATE TABLE lab_rpki_sync_repo (
+	id int(10) unsigned not null primary key auto_increment,
+	repoUrl varchar(512) not null comment 'notification.xml url of rrdp, or rsync://host/module/ of rsync',
+	protocol varchar(16) not null comment 'rrdp/rsync/fallback, fallback is rsync after rrdp failed',
+	lastAttemptTime datetime not null comment 'last sync time',
+	lastSuccessTime datetime comment 'last success sync time',
+	failCount int(10) unsigned not null comment 'count of continuous fails, 0 is ok',
+	lastError varchar(1024) comment 'last fail reason',
+	durationMs bigint(20) unsigned comment 'duration of last sync, in milliseconds',
+	bytes bigint(20) unsigned comment 'bytes downloaded by rrdp, or size of local files of rsync module',
+	objectCount int(10) unsigned comment 'count of local objects',
+	sessionId varchar(512) comment 'current session_id of rrdp',
+	serial int(10) unsigned comment 'current serial of rrdp',
+	syncLogId int(10) unsigned not null comment 'last sync',
+	unique repoUrl (repoUrl),
+	key failCount (failCount)
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin COMMENT='health of repository'
+`,
+	`
+CREATE TABLE lab_rpki_sync_repo_log (
+	id int(10) unsigned not null primary key auto_increment,
+	repoUrl varchar(512) not null comment 'notification.xml url of rrdp, or rsync://host/module/ of rsync',
+	syncLogId int(10) unsigned not null comment 'sync',
+	protocol varchar(16) not null comment 'rrdp/rsync/fallback',
+	state varchar(16) not null comment 'ok/fail',
+	error varchar(1024) comment 'fail reason',
+	attemptTime datetime not null comment 'sync time',
+	durationMs bigint(20) unsigned comment 'duration, in milliseconds',
+	bytes bigint(20) unsigned comment 'bytes downloaded by rrdp, or size of local files of rsync module',
+	objectCount int(10) unsigned comment 'count of local objects',
+	sessionId varchar(512) comment 'session_id of rrdp',
+	serial int(10) unsigned comment 'serial of rrdp',
+	key repoUrl (repoUrl),
+	key syncLogId (syncLogId)
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin COMMENT='every sync of repository'
 `,
 	`
 ##################
@@ -628,6 +690,48 @@ CREATE TABLE lab_rpki_rtr_asa_incremental (
 	key providerAsn(providerAsn),
 	unique rtrAsaIncremental(serialNumber,customerAsn,providerAsn,addressFamily)
 ) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin COMMENT='incremental rtr asa'
+`,
+
+	`
+CREATE TABLE lab_rpki_rtr_router_key_full (
+	id int(10) unsigned not null primary key auto_increment,
+	serialNumber bigint(20) unsigned not null,
+	asn int(10) unsigned not null,
+	ski varchar(128) not null comment 'base64url of subjectKeyIdentifier',
+	routerPublicKey varchar(512) not null comment 'base64url of subjectPublicKeyInfo',
+	sourceFrom json not null comment 'come from : {souce:sync/slurm/rush,syncLogId/syncLogFileId/slurmId/slurmFileId/rushDataLogId}',
+	key serialNumber(serialNumber),
+	key asn(asn),
+	unique rtrRouterKeyFull(serialNumber,asn,ski,routerPublicKey)
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin COMMENT='full rtr router key'
+`,
+
+	`
+CREATE TABLE lab_rpki_rtr_router_key_full_log (
+	id int(10) unsigned not null primary key auto_increment,
+	serialNumber bigint(20) unsigned not null,
+	asn int(10) unsigned not null,
+	ski varchar(128) not null comment 'base64url of subjectKeyIdentifier',
+	routerPublicKey varchar(512) not null comment 'base64url of subjectPublicKeyInfo',
+	sourceFrom json not null comment 'come from : {souce:sync/slurm/rush,syncLogId/syncLogFileId/slurmId/slurmFileId/rushDataLogId}',
+	key serialNumber(serialNumber),
+	key asn(asn)
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin COMMENT='full rtr router key log history'
+`,
+
+	`
+CREATE TABLE lab_rpki_rtr_router_key_incremental (
+	id int(10) unsigned not null primary key auto_increment,
+	serialNumber bigint(20) unsigned not null,
+	style varchar(16) not null comment 'announce/withdraw, is 1/0 in protocol',
+	asn int(10) unsigned not null,
+	ski varchar(128) not null comment 'base64url of subjectKeyIdentifier',
+	routerPublicKey varchar(512) not null comment 'base64url of subjectPublicKeyInfo',
+	sourceFrom json not null comment 'come from : {souce:sync/slurm/rush,syncLogId/syncLogFileId/slurmId/slurmFileId/rushDataLogId}',
+	key serialNumber(serialNumber),
+	key asn(asn),
+	unique rtrRouterKeyIncremental(serialNumber,asn,ski,routerPublicKey)
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin COMMENT='incremental rtr router key'
 `,
 
 	`
@@ -662,6 +766,44 @@ CREATE TABLE lab_rpki_slurm (
 	key providerAsn(providerAsn),
 	unique slurmPrefixAsa (asn,addressPrefix,maxLength,customerAsn,providerAsn,addressFamily)
 ) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin COMMENT='valid slurms'
+`,
+
+	`
+CREATE TABLE lab_rpki_slurm_log (
+	id int(10) unsigned not null primary key auto_increment,
+	state varchar(16) not null comment 'uploaded/active/inactive',
+	uploadTime datetime not null,
+	activateTime datetime,
+	deactivateTime datetime,
+	note varchar(512),
+	key state(state)
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin COMMENT='recored every uploaded slurm'
+`,
+
+	`
+CREATE TABLE lab_rpki_slurm_log_file (
+	id int(10) unsigned not null primary key auto_increment,
+	slurmLogId int(10) unsigned not null comment 'foreign key references lab_rpki_slurm_log(id)',
+	fileName varchar(128) NOT NULL ,
+	fileHash varchar(512) ,
+	slurmVersion int(10) unsigned not null,
+	jsonAll json not null comment 'slurm file content',
+	foreign key (slurmLogId) references lab_rpki_slurm_log(id)
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin COMMENT='recored slurm file'
+`,
+
+	`
+CREATE TABLE lab_rpki_slurm_revision (
+	id int(10) unsigned not null primary key auto_increment,
+	action varchar(16) not null comment 'activate/deactivate/rollback',
+	slurmLogId int(10) unsigned comment 'activated/deactivated lab_rpki_slurm_log.id',
+	rollbackRevisionId int(10) unsigned comment 'rollback to lab_rpki_slurm_revision.id',
+	author varchar(256),
+	comment varchar(1024),
+	revisionTime datetime not null,
+	activeSlurmLogIds json not null comment 'all active lab_rpki_slurm_log.id after this revision',
+	entries json not null comment 'all rows of lab_rpki_slurm after this revision'
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin COMMENT='every change of active slurm, only insert'
 `,
 
 	`
@@ -799,6 +941,13 @@ var fullSyncSqls []string = []string{
 	`truncate  table  lab_rpki_sync_rrdp_delta`,
 }
 
+// health and rrdp fallback of repositories, they are kept by fullsync of replay
+var repoHealthSqls []string = []string{
+	`truncate  table  lab_rpki_sync_rrdp_fallback`,
+	`truncate  table  lab_rpki_sync_repo`,
+	`truncate  table  lab_rpki_sync_repo_log`,
+}
+
 var resetAllOtherSqls []string = []string{
 	`truncate  table  lab_rpki_conf`,
 	`truncate  table  lab_rpki_rtr_session`,
@@ -809,7 +958,13 @@ var resetAllOtherSqls []string = []string{
 	`truncate  table  lab_rpki_rtr_asa_full`,
 	`truncate  table  lab_rpki_rtr_asa_full_log`,
 	`truncate  table  lab_rpki_rtr_asa_incremental`,
+	`truncate  table  lab_rpki_rtr_router_key_full`,
+	`truncate  table  lab_rpki_rtr_router_key_full_log`,
+	`truncate  table  lab_rpki_rtr_router_key_incremental`,
 	`truncate  table  lab_rpki_slurm`,
+	`truncate  table  lab_rpki_slurm_revision`,
+	`truncate  table  lab_rpki_slurm_log_file`,
+	`truncate  table  lab_rpki_slurm_log`,
 	`truncate  table  lab_rpki_rush_node`,
 }
 
@@ -842,6 +997,9 @@ var optimizeSqls []string = []string{
 	`optimize  table  lab_rpki_sync_url`,
 	`optimize  table  lab_rpki_sync_rrdp_notify`,
 	`optimize  table  lab_rpki_sync_rrdp_delta`,
+	`optimize  table  lab_rpki_sync_rrdp_fallback`,
+	`optimize  table  lab_rpki_sync_repo`,
+	`optimize  table  lab_rpki_sync_repo_log`,
 	`optimize  table  lab_rpki_rtr_session`,
 	`optimize  table  lab_rpki_rtr_serial_number`,
 	`optimize  table  lab_rpki_rtr_full`,
@@ -850,7 +1008,13 @@ var optimizeSqls []string = []string{
 	`optimize  table  lab_rpki_rtr_asa_full`,
 	`optimize  table  lab_rpki_rtr_asa_full_log`,
 	`optimize  table  lab_rpki_rtr_asa_incremental`,
+	`optimize  table  lab_rpki_rtr_router_key_full`,
+	`optimize  table  lab_rpki_rtr_router_key_full_log`,
+	`optimize  table  lab_rpki_rtr_router_key_incremental`,
 	`optimize  table  lab_rpki_slurm`,
+	`optimize  table  lab_rpki_slurm_revision`,
+	`optimize  table  lab_rpki_slurm_log_file`,
+	`optimize  table  lab_rpki_slurm_log`,
 	`optimize  table  lab_rpki_rush_node`,
 }
 
@@ -900,6 +1064,9 @@ func initResetImplDb(session *xorm.Session, sysStyle SysStyle) error {
 		sqls = initSqls
 	} else if sysStyle.SysStyle == "fullsync" || sysStyle.SysStyle == "resetall" {
 		sqls = fullSyncSqls
+		if sysStyle.SyncPolicy != "replay" {
+			sqls = append(sqls, repoHealthSqls...)
+		}
 		if sysStyle.SysStyle == "resetall" {
 			sqls = append(sqls, resetAllOtherSqls...)
 		}
@@ -1017,3 +1184,158 @@ func exportRtrForManrsDb() (rtrForManrss []RtrForManrs, err error) {
 	belogs.Debug("exportRtrForManrsDb():len(rtrForManrss):", len(rtrForManrss))
 	return rtrForManrss, nil
 }
+
+// ta is rir of roa, or source(such as slurm) which is not from roa. rirs is empty means all
+func getExportVrpSql(withoutSlurm bool, rirs []string) (sql string, args []interface{}) {
+	if withoutSlurm {
+		sql = `select distinct v.asn as asn, substring_index(v.addressPrefix, '/', 1) as address,
+				substring_index(v.addressPrefix, '/', -1) as prefixLength, v.maxLength as maxLength, v.rir as ta
+			from lab_rpki_roa_ipaddress_view v`
+	} else {
+		sql = `select f.asn as asn, f.address as address, f.prefixLength as prefixLength, f.maxLength as maxLength,
+				ifnull(r.origin->>'$.rir', f.sourceFrom->>'$.source') as ta
+			from lab_rpki_rtr_full f left join lab_rpki_roa r
+				on f.sourceFrom->>'$.source' = 'sync' and r.syncLogFileId = f.sourceFrom->>'$.syncLogFileId'`
+	}
+	sql = `select asn, address, prefixLength, maxLength, ta from (` + sql + `) t `
+	args = make([]interface{}, 0, len(rirs))
+	if len(rirs) > 0 {
+		sql += ` where t.ta in (?` + strings.Repeat(`,?`, len(rirs)-1) + `) `
+		for i := range rirs {
+			args = append(args, rirs[i])
+		}
+	}
+	return sql, args
+}
+
+func getExportAspaSql(withoutSlurm bool, rirs []string) (sql string, args []interface{}) {
+	if withoutSlurm {
+		sql = `select c.customerAsn as customerAsn, p.providerAsn as providerAsn, a.origin->>'$.rir' as ta
+			from lab_rpki_asa a, lab_rpki_asa_customer_asn c, lab_rpki_asa_provider_asn p
+			where c.asaId = a.id and p.customerAsnId = c.id and a.state->>'$.state' in ('valid','warning')`
+	} else {
+		sql = `select f.customerAsn as customerAsn, f.providerAsn as providerAsn,
+				if(f.sourceFrom->>'$.source' = 'sync',
+					(select a.origin->>'$.rir' from lab_rpki_asa a, lab_rpki_asa_customer_asn c
+					where c.asaId = a.id and c.customerAsn = f.customerAsn limit 1),
+					f.sourceFrom->>'$.source') as ta
+			from lab_rpki_rtr_asa_full f`
+	}
+	sql = `select distinct customerAsn, providerAsn, ta from (` + sql + `) t `
+	args = make([]interface{}, 0, len(rirs))
+	if len(rirs) > 0 {
+		sql += ` where t.ta in (?` + strings.Repeat(`,?`, len(rirs)-1) + `) `
+		for i := range rirs {
+			args = append(args, rirs[i])
+		}
+	}
+	return sql, args
+}
+
+// metadata and rows of export are read in one transaction. mysql repeatable read uses the snapshot of the first read
+// for all reads of this transaction, so they are of the same serial
+func newExportVrpSessionDb() (session *xorm.Session, err error) {
+	session, err = xormdb.NewSession()
+	if err != nil {
+		belogs.Error("newExportVrpSessionDb(): NewSession fail:", err)
+		return nil, err
+	}
+	return session, nil
+}
+
+// nothing is changed by export, so just rollback
+func closeExportVrpSessionDb(session *xorm.Session) {
+	if err := session.Rollback(); err != nil {
+		belogs.Error("closeExportVrpSessionDb(): Rollback fail:", err)
+		// no return
+	}
+	session.Close()
+}
+
+func getExportVrpMetadataDb(session *xorm.Session, withoutSlurm bool, rirs []string) (serialNumber, vrpCount, aspaCount uint64, err error) {
+	_, err = session.SQL(`select serialNumber from lab_rpki_rtr_serial_number order by id desc limit 1`).Get(&serialNumber)
+	if err != nil {
+		belogs.Error("getExportVrpMetadataDb(): select serialNumber fail:", err)
+		return 0, 0, 0, err
+	}
+	sql, args := getExportVrpSql(withoutSlurm, rirs)
+	_, err = session.SQL(`select count(*) from (`+sql+`) c`, args...).Get(&vrpCount)
+	if err != nil {
+		belogs.Error("getExportVrpMetadataDb(): select count of vrps fail:", err)
+		return 0, 0, 0, err
+	}
+	sql, args = getExportAspaSql(withoutSlurm, rirs)
+	_, err = session.SQL(`select count(distinct customerAsn) from (`+sql+`) c`, args...).Get(&aspaCount)
+	if err != nil {
+		belogs.Error("getExportVrpMetadataDb(): select count of aspas fail:", err)
+		return 0, 0, 0, err
+	}
+	belogs.Debug("getExportVrpMetadataDb(): serialNumber:", serialNumber, "  vrpCount:", vrpCount, "  aspaCount:", aspaCount)
+	return serialNumber, vrpCount, aspaCount, nil
+}
+
+// ipv4 first, then ipv6. rows are read one by one, so large outputs are not loaded into memory
+func iterateExportVrpsDb(session *xorm.Session, withoutSlurm bool, rirs []string, fn func(exportVrp *ExportVrp) error) (err error) {
+	sql, args := getExportVrpSql(withoutSlurm, rirs)
+	sql += ` order by instr(address, ':') > 0, address, prefixLength, maxLength, asn `
+	rows, err := session.SQL(sql, args...).Rows(new(ExportVrp))
+	if err != nil {
+		belogs.Error("iterateExportVrpsDb(): Rows fail:", err)
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		exportVrp := ExportVrp{}
+		err = rows.Scan(&exportVrp)
+		if err != nil {
+			belogs.Error("iterateExportVrpsDb(): Scan fail:", err)
+			return err
+		}
+		if err = fn(&exportVrp); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// rows of one customerAsn are merged
+func iterateExportAspasDb(session *xorm.Session, withoutSlurm bool, rirs []string, fn func(exportAspa *ExportAspa) error) (err error) {
+	sql, args := getExportAspaSql(withoutSlurm, rirs)
+	sql += ` order by customerAsn, providerAsn `
+	rows, err := session.SQL(sql, args...).Rows(new(exportAspaDb))
+	if err != nil {
+		belogs.Error("iterateExportAspasDb(): Rows fail:", err)
+		return err
+	}
+	defer rows.Close()
+	var exportAspa *ExportAspa
+	for rows.Next() {
+		aspa := exportAspaDb{}
+		err = rows.Scan(&aspa)
+		if err != nil {
+			belogs.Error("iterateExportAspasDb(): Scan fail:", err)
+			return err
+		}
+		if exportAspa != nil && exportAspa.CustomerAsn == aspa.CustomerAsn {
+			// the same provider of different tas
+			if exportAspa.ProviderAsns[len(exportAspa.ProviderAsns)-1] != aspa.ProviderAsn {
+				exportAspa.ProviderAsns = append(exportAspa.ProviderAsns, aspa.ProviderAsn)
+			}
+			continue
+		}
+		if exportAspa != nil {
+			if err = fn(exportAspa); err != nil {
+				return err
+			}
+		}
+		exportAspa = &ExportAspa{CustomerAsn: aspa.CustomerAsn, ProviderAsns: []uint64{aspa.ProviderAsn}, Ta: aspa.Ta}
+	}
+	if err = rows.Err(); err != nil {
+		belogs.Error("iterateExportAspasDb(): rows fail:", err)
+		return err
+	}
+	if exportAspa != nil {
+		return fn(exportAspa)
+	}
+	return nil
+}
@@ -4,9 +4,11 @@ import (
 	"errors"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/cpusoft/goutil/belogs"
 	"github.com/cpusoft/goutil/conf"
+	"github.com/cpusoft/goutil/convert"
 	"github.com/cpusoft/goutil/fileutil"
 	"github.com/cpusoft/goutil/ginserver"
 	"github.com/cpusoft/goutil/httpclient"
@@ -42,6 +44,10 @@ func InitReset(c *gin.Context) {
 				path = url + "/entiresync/syncstart"
 				belogs.Info("initReset(): will call entire sync:", path)
 				go httpclient.Post(path, `{"syncStyle": "sync"}`, false)
+			} else if sysStyle.SyncPolicy == "replay" {
+				path = url + "/entiresync/replaysync"
+				belogs.Info("initReset(): will call replay sync:", path)
+				go httpclient.Post(path, jsonutil.MarshalJson(sysStyle.ReplayModel), false)
 			}
 
 		}
@@ -97,6 +103,57 @@ func ExportRoas(c *gin.Context) {
 	c.JSON(http.StatusOK, r)
 }
 
+// {"format":"json","withoutSlurm":false,"tals":["apnic"]}, format is json/csv/openbgpd/bird2/rfc8416.
+// vrps are streamed, generatedTime and serialNumber are also in http header
+func ExportVrps(c *gin.Context) {
+	belogs.Info("ExportVrps()")
+	exportVrpRequest := ExportVrpRequest{}
+	err := c.ShouldBindJSON(&exportVrpRequest)
+	if err != nil {
+		belogs.Error("ExportVrps(): ShouldBindJSON:", err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	session, err := newExportVrpSessionDb()
+	if err != nil {
+		belogs.Error("ExportVrps(): newExportVrpSessionDb fail:", err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+	defer closeExportVrpSessionDb(session)
+	exportVrpMetadata, err := getExportVrpMetadata(session, exportVrpRequest)
+	if err != nil {
+		belogs.Error("ExportVrps(): getExportVrpMetadata fail:", jsonutil.MarshalJson(exportVrpRequest), err)
+		ginserver.ResponseFail(c, err, "")
+		return
+	}
+
+	contentType := "text/plain; charset=utf-8"
+	fileName := "vrps.txt"
+	switch exportVrpRequest.Format {
+	case EXPORT_VRP_FORMAT_JSON, EXPORT_VRP_FORMAT_RFC8416:
+		contentType = "application/json; charset=utf-8"
+		fileName = "vrps.json"
+	case EXPORT_VRP_FORMAT_CSV:
+		contentType = "text/csv; charset=utf-8"
+		fileName = "vrps.csv"
+	case EXPORT_VRP_FORMAT_OPENBGPD, EXPORT_VRP_FORMAT_BIRD2:
+		fileName = "vrps.conf"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", "attachment; filename="+fileName)
+	c.Header("X-Generated-Time", exportVrpMetadata.GeneratedTime.UTC().Format(time.RFC3339))
+	c.Header("X-Serial-Number", convert.ToString(exportVrpMetadata.SerialNumber))
+	c.Status(http.StatusOK)
+	// status has been sent, so only log the error
+	err = exportVrps(session, &exportVrpMetadata, c.Writer)
+	if err != nil {
+		belogs.Error("ExportVrps(): exportVrps fail:", jsonutil.MarshalJson(exportVrpMetadata), err)
+		return
+	}
+	belogs.Info("ExportVrps(): ok, exportVrpMetadata:", jsonutil.MarshalJson(exportVrpMetadata))
+}
+
 // export all rtrs for manrs to valdations
 // https://github.com/manrs-tools/MANRS-IXP-validation-tool
 // https://github.com/manrs-tools/MANRS-IXP-validation-tool/blob/main/validator/tests/roa_test.json
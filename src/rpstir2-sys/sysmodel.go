@@ -1,12 +1,21 @@
 package sys
 
+import (
+	"time"
+
+	model "rpstir2-model"
+)
+
 type SysStyle struct {
 	// "init" :  will create all table;
 	// "fullsync": will remove current data to forece full sync data, and retain rtr/slurm/transfer data.
 	// "resetall" will remove all data including rtr/slurm/transfer;
 	SysStyle string `json:"sysStyle"`
-	// distributed/entire
+	// distributed/entire/replay
 	SyncPolicy string `json:"syncPolicy"`
+	// when syncPolicy is replay, it will be sent to /entiresync/replaysync after fullsync,
+	// and health and rrdp fallback of repositories are kept
+	ReplayModel model.ReplayModel `json:"replayModel"`
 }
 
 type CertResults struct {
@@ -40,3 +49,54 @@ type RtrForManrs struct {
 	Address      string `json:"-" xorm:"address varchar(255)"`
 	PrefixLength int    `json:"-"  xorm:"prefixLength int"`
 }
+
+// format of /sys/exportvrps
+const (
+	EXPORT_VRP_FORMAT_JSON     = "json"
+	EXPORT_VRP_FORMAT_CSV      = "csv"
+	EXPORT_VRP_FORMAT_OPENBGPD = "openbgpd"
+	EXPORT_VRP_FORMAT_BIRD2    = "bird2"
+	EXPORT_VRP_FORMAT_RFC8416  = "rfc8416"
+)
+
+// withoutSlurm: vrps/aspas from valid roas/asas, not from rtr which has been filtered and added by slurm.
+// tals: apnic/arin/afrinic/lacnic/ripe, and slurm for vrps/aspas added by slurm. empty means all
+type ExportVrpRequest struct {
+	Format       string   `json:"format"`
+	WithoutSlurm bool     `json:"withoutSlurm"`
+	Tals         []string `json:"tals"`
+}
+
+type ExportVrpMetadata struct {
+	Format        string    `json:"format"`
+	SerialNumber  uint64    `json:"serialNumber"`
+	GeneratedTime time.Time `json:"generatedTime"`
+	VrpCount      uint64    `json:"vrpCount"`
+	AspaCount     uint64    `json:"aspaCount"`
+	WithoutSlurm  bool      `json:"withoutSlurm"`
+	Tals          []string  `json:"tals"`
+}
+
+// address may be trimmed in lab_rpki_rtr_full, Ta is rir of roa or "slurm"
+type ExportVrp struct {
+	Asn          uint64 `json:"asn" xorm:"asn bigint"`
+	Address      string `json:"-" xorm:"address varchar(512)"`
+	PrefixLength uint64 `json:"-" xorm:"prefixLength int"`
+	Prefix       string `json:"prefix"`
+	MaxLength    uint64 `json:"maxLength" xorm:"maxLength int"`
+	Ta           string `json:"ta" xorm:"ta varchar(64)"`
+}
+
+// one row of customerAsn and providerAsn
+type exportAspaDb struct {
+	CustomerAsn uint64 `xorm:"customerAsn int"`
+	ProviderAsn uint64 `xorm:"providerAsn int"`
+	Ta          string `xorm:"ta varchar(64)"`
+}
+
+// providerAsns of all address families
+type ExportAspa struct {
+	CustomerAsn  uint64   `json:"customer_asid"`
+	ProviderAsns []uint64 `json:"providers"`
+	Ta           string   `json:"ta"`
+}
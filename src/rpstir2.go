@@ -9,9 +9,12 @@ import (
 	chainvalidate "rpstir2-chainvalidate"
 	clear "rpstir2-clear"
 	parsevalidatecentralized "rpstir2-parsevalidate-centralized"
+	rov "rpstir2-rov"
+	"rpstir2-rov/bmp"
 	rtrclient "rpstir2-rtrclient"
 	rtrproducer "rpstir2-rtrproducer"
 	rtrserver "rpstir2-rtrserver"
+	"rpstir2-sync-core/repopolicy"
 	entiremixsync "rpstir2-sync-entire/mixsync"
 	entirerrdp "rpstir2-sync-entire/rrdp"
 	entirersync "rpstir2-sync-entire/rsync"
@@ -38,6 +41,14 @@ func main() {
 		return
 	}
 	defer xormdb.XormEngine.Close()
+
+	// policy of repositories, it can be reloaded by /entiresync/repo/policy/reload
+	err = repopolicy.ReloadRepoPolicy()
+	if err != nil {
+		belogs.Error("main(): ReloadRepoPolicy failed:", err)
+		fmt.Println("rpstir2 failed to start, ", err)
+		return
+	}
 	// start rp server
 	go startRpServer()
 
@@ -66,13 +77,20 @@ func startRpServer() {
 	engine.Use(gin.Recovery())
 
 	engine.POST("/tal/gettals", tal.GetTals)
+	engine.POST("/tal/getreplaytals", tal.GetReplayTals)
 
 	engine.POST("/entiresync/syncstart", entiremixsync.SyncStart)
+	engine.POST("/entiresync/replaystart", entiremixsync.ReplayStart)
+	engine.POST("/entiresync/replaysync", entiremixsync.ReplaySync)
 	//engine.POST("/entiresync/syncstart", entiresync.SyncStart)
 	engine.POST("/entiresync/rrdpresult", entiresync.RrdpResult)
 	engine.POST("/entiresync/rsyncresult", entiresync.RsyncResult)
 	engine.POST("/entiresync/rrdprequest", entirerrdp.RrdpRequest)
 	engine.POST("/entiresync/rsyncrequest", entirersync.RsyncRequest)
+	engine.POST("/entiresync/repo/unhealthy", entiremixsync.RepoUnhealthy)
+	engine.POST("/entiresync/repo/history", entiremixsync.RepoHistory)
+	engine.POST("/entiresync/repo/policy", entiremixsync.RepoPolicy)
+	engine.POST("/entiresync/repo/policy/reload", entiremixsync.RepoPolicyReload)
 	engine.POST("/parsevalidate/start", parsevalidatecentralized.ParseValidateStart)
 	engine.POST("/parsevalidate/file", parsevalidatecentralized.ParseValidateFile)
 	engine.POST("/parsevalidate/parsefile", parsevalidatecentralized.ParseFile)
@@ -83,6 +101,9 @@ func startRpServer() {
 	engine.POST("/sys/servicestate", sys.ServiceState)
 	engine.POST("/sys/results", sys.Results)
 	engine.POST("/sys/exportroas", sys.ExportRoas)
+	engine.POST("/sys/exportvrps", sys.ExportVrps)
+	engine.POST("/rov/impactanalysis", rov.ImpactAnalysis)
+	engine.POST("/rov/irrreport", rov.IrrReport)
 
 	/////////////////////
 
@@ -141,12 +162,34 @@ func startVcServer() {
 	engine.Use(gin.Recovery())
 
 	engine.POST("/rtrproducer/updatefromsync", rtrproducer.RtrUpdateFromSync)
+	engine.POST("/rtrproducer/updatefromslurm", rtrproducer.RtrUpdateFromSlurm)
+	engine.POST("/rtrproducer/slurm/validate", rtrproducer.SlurmValidate)
+	engine.POST("/rtrproducer/slurm/lint", rtrproducer.SlurmLint)
+	engine.POST("/rtrproducer/slurm/upload", rtrproducer.SlurmUpload)
+	engine.POST("/rtrproducer/slurm/activate", rtrproducer.SlurmActivate)
+	engine.POST("/rtrproducer/slurm/deactivate", rtrproducer.SlurmDeactivate)
+	engine.POST("/rtrproducer/slurm/list", rtrproducer.SlurmList)
+	engine.POST("/rtrproducer/slurm/revision/list", rtrproducer.SlurmRevisionList)
+	engine.POST("/rtrproducer/slurm/revision/diff", rtrproducer.SlurmRevisionDiff)
+	engine.POST("/rtrproducer/slurm/rollback", rtrproducer.SlurmRollback)
+	engine.POST("/rtrproducer/preview", rtrproducer.RtrPreview)
+	engine.POST("/rtrproducer/preview/approve", rtrproducer.RtrPreviewApprove)
+	engine.POST("/rtrproducer/preview/reject", rtrproducer.RtrPreviewReject)
+	engine.POST("/rtrproducer/brake/release", rtrproducer.RtrBrakeRelease)
+	engine.POST("/rtrproducer/brake/discard", rtrproducer.RtrBrakeDiscard)
+	engine.POST("/rtrproducer/history/serials", rtrproducer.HistorySerials)
+	engine.POST("/rtrproducer/history/vrps", rtrproducer.HistoryVrps)
+	engine.POST("/rtrproducer/history/diff", rtrproducer.HistoryDiff)
+	engine.POST("/rtrproducer/provenance", rtrproducer.Provenance)
 	engine.POST("/sys/initreset", sys.InitReset)
 	engine.POST("/rtr/server/sendserialnotify", rtrserver.ServerSendSerialNotify)
 	engine.POST("/rtr/client/start", rtrclient.ClientStart)
 	engine.POST("/rtr/client/stop", rtrclient.ClientStop)
 	engine.POST("/rtr/client/sendserialquery", rtrclient.ClientSendSerialQuery)
 	engine.POST("/rtr/client/sendresetquery", rtrclient.ClientSendResetQuery)
+	engine.POST("/rov/bmp/peers", rov.BmpPeers)
+	engine.POST("/rov/bmp/invalidroutes", rov.BmpInvalidRoutes)
+	engine.POST("/rov/bmp/statechanges", rov.BmpStateChanges)
 
 	/////////////////////
 
@@ -193,4 +236,10 @@ func startTcpServer() {
 	belogs.Debug("startTcpServer():will start tcp server:", tcpPort)
 	rtrserver.RtrServerStart(tcpPort)
 
+	// bmp
+	if conf.Bool("bmp::enable") {
+		bmpTcpPort := conf.String("bmp::serverTcpPort")
+		belogs.Debug("startTcpServer():will start bmp server:", bmpTcpPort)
+		bmp.BmpServerStart(bmpTcpPort)
+	}
 }